@@ -25,6 +25,9 @@ type dinImpl struct {
 	// 0 means no early stop
 	earlyStop int
 
+	// loss set by rcmd.TrainLoss, nil means the loss of rcmd.LabelObjective
+	loss rcmd.Loss
+
 	learner *din.DinNet
 	pred    *din.DinNet
 }
@@ -41,6 +44,10 @@ func (d *dinImpl) Predict(X tensor.Tensor) tensor.Tensor {
 	return yDense
 }
 
+func (d *dinImpl) SetLoss(loss rcmd.Loss) {
+	d.loss = loss
+}
+
 func (d *dinImpl) Fit(trainSample *rcmd.TrainSample) (pred rcmd.PredictAbstract, err error) {
 	d.uProfileDim = trainSample.Info.UserProfileRange[1] - trainSample.Info.UserProfileRange[0]
 	d.uBehaviorSize = rcmd.UserBehaviorLen
@@ -60,7 +67,7 @@ func (d *dinImpl) Fit(trainSample *rcmd.TrainSample) (pred rcmd.PredictAbstract,
 
 	d.learner = din.NewDinNet(d.uProfileDim, d.uBehaviorSize, d.uBehaviorDim, d.iFeatureDim, d.cFeatureDim)
 
-	err = model.Train(d.uProfileDim, d.uBehaviorSize, d.uBehaviorDim, d.iFeatureDim, d.cFeatureDim,
+	err = model.TrainWithLoss(d.loss, d.uProfileDim, d.uBehaviorSize, d.uBehaviorDim, d.iFeatureDim, d.cFeatureDim,
 		trainSample.Rows, d.BatchSize, d.epochs, d.earlyStop,
 		d.sampleInfo,
 		inputs, labels,
@@ -68,7 +68,7 @@ func TestDinOnMovielens(t *testing.T) {
 			}
 			//yTrue.Set(i, 0, BinarizeLabel(rating))
 			yTrue = append(yTrue, BinarizeLabel32(rating))
-			sampleKeys = append(sampleKeys, rcmd.Sample{userId, itemId, 0, timestamp})
+			sampleKeys = append(sampleKeys, rcmd.Sample{UserId: userId, ItemId: itemId, Timestamp: timestamp})
 		}
 		batchPredictCtx := context.Background()
 		dinPred := &dnnPredictor{
@@ -137,7 +137,7 @@ func (recSys *MovielensRec) GetItemFeature(ctx context.Context, itemId int) (ten
 		})
 		return
 	} else {
-		err = fmt.Errorf("itemId %d not found", itemId)
+		err = fmt.Errorf("%w: itemId %d not found", rcmd.ErrMissingItem, itemId)
 		return
 	}
 }
@@ -152,7 +152,7 @@ func (recSys *MovielensRec) GetUserFeature(ctx context.Context, userId int) (ten
 		top5GenresTensor [50]float32
 	)
 	// get stage value from ctx
-	stage := ctx.Value(rcmd.StageKey).(rcmd.Stage)
+	stage, _ := rcmd.StageOf(ctx)
 	switch stage {
 	case rcmd.TrainStage:
 		tableName = "user_feature_train"
@@ -189,7 +189,7 @@ func (recSys *MovielensRec) GetUserFeature(ctx context.Context, userId int) (ten
 		}
 		return
 	} else {
-		err = fmt.Errorf("userId %d not found", userId)
+		err = fmt.Errorf("%w: userId %d not found", rcmd.ErrMissingUser, userId)
 		log.Errorf("userId %d not found", userId)
 		return
 	}
@@ -97,7 +97,7 @@ func TestFeatureEngineer(t *testing.T) {
 				t.Errorf("scan error: %v", err)
 			}
 			yTrue.Set(i, 0, BinarizeLabel(float64(rating)))
-			sampleKeys = append(sampleKeys, rcmd.Sample{userId, itemId, 0, timestamp})
+			sampleKeys = append(sampleKeys, rcmd.Sample{UserId: userId, ItemId: itemId, Timestamp: timestamp})
 		}
 		batchPredictCtx := context.Background()
 		yPred, err := rcmd.BatchPredict(batchPredictCtx, model, sampleKeys)
@@ -18,7 +18,7 @@ func (recSys *MovielensRec) GetUserBehavior(ctx context.Context, userId int,
 	)
 
 	// get stage value from ctx
-	stage := ctx.Value(rcmd.StageKey).(rcmd.Stage)
+	stage, _ := rcmd.StageOf(ctx)
 	switch stage {
 	case rcmd.TrainStage:
 		tableName = "ratings_train"
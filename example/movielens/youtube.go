@@ -25,6 +25,9 @@ type YoutubeDnnImpl struct {
 	// 0 means no early stop
 	earlyStop int
 
+	// loss set by rcmd.TrainLoss, nil means the loss of rcmd.LabelObjective
+	loss rcmd.Loss
+
 	learner *youtube.YoutubeDnn
 	pred    *youtube.YoutubeDnn
 }
@@ -41,6 +44,10 @@ func (d *YoutubeDnnImpl) Predict(X tensor.Tensor) tensor.Tensor {
 	return yDense
 }
 
+func (d *YoutubeDnnImpl) SetLoss(loss rcmd.Loss) {
+	d.loss = loss
+}
+
 func (d *YoutubeDnnImpl) Fit(trainSample *rcmd.TrainSample) (pred rcmd.PredictAbstract, err error) {
 	d.uProfileDim = trainSample.Info.UserProfileRange[1] - trainSample.Info.UserProfileRange[0]
 	d.uBehaviorSize = rcmd.UserBehaviorLen
@@ -58,7 +65,7 @@ func (d *YoutubeDnnImpl) Fit(trainSample *rcmd.TrainSample) (pred rcmd.PredictAb
 
 	inputs := tensor.New(tensor.WithShape(trainSample.Rows, trainSample.XCols), tensor.WithBacking(trainSample.X))
 	labels := tensor.New(tensor.WithShape(trainSample.Rows, 1), tensor.WithBacking(trainSample.Y))
-	err = model.Train(d.uProfileDim, d.uBehaviorSize, d.uBehaviorDim, d.iFeatureDim, d.cFeatureDim,
+	err = model.TrainWithLoss(d.loss, d.uProfileDim, d.uBehaviorSize, d.uBehaviorDim, d.iFeatureDim, d.cFeatureDim,
 		trainSample.Rows, d.batchSize, d.epochs, d.earlyStop,
 		d.sampleInfo,
 		inputs, labels,
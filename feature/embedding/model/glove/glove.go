@@ -0,0 +1,227 @@
+package glove
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/auxten/go-ctr/feature/embedding/corpus"
+	"github.com/auxten/go-ctr/feature/embedding/corpus/memory"
+	"github.com/auxten/go-ctr/feature/embedding/model"
+	"github.com/auxten/go-ctr/feature/embedding/model/modelutil/matrix"
+	"github.com/auxten/go-ctr/feature/embedding/model/modelutil/vector"
+	"github.com/auxten/go-ctr/feature/embedding/util/clock"
+	"github.com/auxten/go-ctr/feature/embedding/util/verbose"
+)
+
+// cooccurrence is the weighted count x of word j in the context of word i
+type cooccurrence struct {
+	i, j int
+	x    float64
+}
+
+// glove trains the word vectors by factorizing the log co-occurrence matrix
+// with AdaGrad, see https://nlp.stanford.edu/pubs/glove.pdf
+type glove struct {
+	opts Options
+
+	corpus corpus.Corpus
+
+	// param holds the word vectors then the context vectors, bias holds the
+	// word biases then the context biases, gradsq the AdaGrad sums of both
+	param, gradsq    *matrix.Matrix
+	bias, biasGradsq []float64
+	embeddingMap     map[string][]float64
+
+	verbose *verbose.Verbose
+}
+
+func New(opts ...ModelOption) (model.Model, error) {
+	options := DefaultOptions()
+	for _, fn := range opts {
+		fn(&options)
+	}
+
+	return NewForOptions(options)
+}
+
+func NewForOptions(opts Options) (model.Model, error) {
+	if opts.Dim <= 0 || opts.Window <= 0 || opts.Xmax <= 0 {
+		return nil, fmt.Errorf("invalid glove options: dim %d window %d xmax %d", opts.Dim, opts.Window, opts.Xmax)
+	}
+	return &glove{
+		opts:    opts,
+		verbose: verbose.New(opts.Verbose),
+	}, nil
+}
+
+func (g *glove) Train(r <-chan string) error {
+	return g.TrainContext(context.Background(), r)
+}
+
+// TrainContext is Train returning ctx.Err() promptly after ctx is done
+func (g *glove) TrainContext(ctx context.Context, r <-chan string) error {
+	g.corpus = memory.New(r, g.opts.ToLower, g.opts.MaxCount, g.opts.MinCount)
+	if err := g.corpus.Load(g.verbose, g.opts.LogBatch); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var (
+		words = g.corpus.Dictionary().Len()
+		dim   = g.opts.Dim
+		rnd   = rand.New(rand.NewSource(g.opts.Seed))
+	)
+	g.param = matrix.New(words*2, dim, func(_ int, vec []float64) {
+		for i := range vec {
+			vec[i] = (rnd.Float64() - 0.5) / float64(dim)
+		}
+	})
+	g.gradsq = matrix.New(words*2, dim, func(_ int, vec []float64) {
+		for i := range vec {
+			vec[i] = 1
+		}
+	})
+	g.bias = make([]float64, words*2)
+	g.biasGradsq = make([]float64, words*2)
+	for i := range g.biasGradsq {
+		g.biasGradsq[i] = 1
+	}
+
+	pairs := g.cooccurrences()
+	for iter := 1; iter <= g.opts.Iter; iter++ {
+		clk := clock.New()
+		rnd.Shuffle(len(pairs), func(i, j int) { pairs[i], pairs[j] = pairs[j], pairs[i] })
+		var cost float64
+		for n, p := range pairs {
+			if n%1024 == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			cost += g.update(p, words)
+		}
+		g.verbose.Do(func() {
+			fmt.Printf("iter %d cost %f %v\r\n", iter, cost/float64(len(pairs)), clk.AllElapsed())
+		})
+	}
+	return nil
+}
+
+// cooccurrences counts the words within the window weighted by 1/distance
+func (g *glove) cooccurrences() (pairs []cooccurrence) {
+	var (
+		doc    = g.corpus.IndexedDoc()
+		counts = make(map[[2]int]float64)
+	)
+	for pos, i := range doc {
+		for c := pos + 1; c <= pos+g.opts.Window && c < len(doc); c++ {
+			j, w := doc[c], 1/float64(c-pos)
+			counts[[2]int{i, j}] += w
+			counts[[2]int{j, i}] += w
+		}
+	}
+	pairs = make([]cooccurrence, 0, len(counts))
+	for ij, x := range counts {
+		pairs = append(pairs, cooccurrence{i: ij[0], j: ij[1], x: x})
+	}
+	// the order of the map is random, sort to make the shuffle by Seed
+	// reproducible
+	sort.Slice(pairs, func(a, b int) bool {
+		if pairs[a].i != pairs[b].i {
+			return pairs[a].i < pairs[b].i
+		}
+		return pairs[a].j < pairs[b].j
+	})
+	return
+}
+
+// update does one AdaGrad step on the pair and returns the weighted cost
+func (g *glove) update(p cooccurrence, words int) float64 {
+	var (
+		wi, wj   = g.param.Slice(p.i), g.param.Slice(p.j + words)
+		gi, gj   = g.gradsq.Slice(p.i), g.gradsq.Slice(p.j + words)
+		bi, bj   = p.i, p.j + words
+		diff     = g.bias[bi] + g.bias[bj] - math.Log(p.x)
+		weighted = 1.0
+	)
+	for d := range wi {
+		diff += wi[d] * wj[d]
+	}
+	if p.x < float64(g.opts.Xmax) {
+		weighted = math.Pow(p.x/float64(g.opts.Xmax), g.opts.Alpha)
+	}
+	fdiff := weighted * diff
+	cost := 0.5 * fdiff * diff
+	fdiff *= g.opts.Initlr
+	for d := range wi {
+		grad1, grad2 := fdiff*wj[d], fdiff*wi[d]
+		wi[d] -= grad1 / math.Sqrt(gi[d])
+		wj[d] -= grad2 / math.Sqrt(gj[d])
+		gi[d] += grad1 * grad1
+		gj[d] += grad2 * grad2
+	}
+	g.bias[bi] -= fdiff / math.Sqrt(g.biasGradsq[bi])
+	g.bias[bj] -= fdiff / math.Sqrt(g.biasGradsq[bj])
+	g.biasGradsq[bi] += fdiff * fdiff
+	g.biasGradsq[bj] += fdiff * fdiff
+	return cost
+}
+
+func (g *glove) Save(f io.Writer, typ vector.Type) error {
+	return vector.Save(f, g.corpus.Dictionary(), g.WordVector(typ), g.verbose, g.opts.LogBatch)
+}
+
+// WordVector of vector.Agg is the sum of the word and the context vectors as
+// suggested by the paper, vector.Single is the word vector only
+func (g *glove) WordVector(typ vector.Type) *matrix.Matrix {
+	words := g.corpus.Dictionary().Len()
+	return matrix.New(words, g.opts.Dim, func(row int, vec []float64) {
+		copy(vec, g.param.Slice(row))
+		if typ == vector.Agg {
+			for i, v := range g.param.Slice(row + words) {
+				vec[i] += v
+			}
+		}
+	})
+}
+
+func (g *glove) GenEmbeddingMap() (embMap map[string][]float64, err error) {
+	dict := g.corpus.Dictionary()
+	if dict.Len() == 0 {
+		err = fmt.Errorf("dictionary is empty")
+		return
+	}
+	wordVec := g.WordVector(vector.Agg)
+	embMap = make(map[string][]float64, dict.Len())
+	for i := 0; i < dict.Len(); i++ {
+		word, _ := dict.Word(i)
+		embMap[word] = wordVec.Slice(i)
+	}
+	g.embeddingMap = embMap
+	return
+}
+
+func (g *glove) GenEmbeddingMap32() (embMap map[string][]float32, err error) {
+	emb64, err := g.GenEmbeddingMap()
+	if err != nil {
+		return
+	}
+	embMap = make(map[string][]float32, len(emb64))
+	for word, vec := range emb64 {
+		vec32 := make([]float32, len(vec))
+		for i, v := range vec {
+			vec32[i] = float32(v)
+		}
+		embMap[word] = vec32
+	}
+	return
+}
+
+func (g *glove) EmbeddingByWord(word string) (vec []float64, ok bool) {
+	vec, ok = g.embeddingMap[word]
+	return
+}
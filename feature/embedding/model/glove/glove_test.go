@@ -0,0 +1,71 @@
+package glove
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i] * b[i])
+		na += float64(a[i] * a[i])
+		nb += float64(b[i] * b[i])
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// clusterCorpus generates blocks of words "a0"-"a4" and "b0"-"b4" in turn
+func clusterCorpus(blocks int) <-chan string {
+	inputCh := make(chan string, 100)
+	go func() {
+		defer close(inputCh)
+		for i := 0; i < blocks; i++ {
+			cluster := "ab"[i%2]
+			for j := 0; j < 10; j++ {
+				inputCh <- fmt.Sprintf("%c%d", cluster, (i*3+j*7)%5)
+			}
+		}
+	}()
+	return inputCh
+}
+
+func TestGloVe(t *testing.T) {
+	Convey("glove embedding", t, func() {
+		train := func() map[string][]float32 {
+			mod, err := New(Dim(8), Window(3), Iter(30), MinCount(1))
+			So(err, ShouldBeNil)
+			So(mod.Train(clusterCorpus(400)), ShouldBeNil)
+			embMap, err := mod.GenEmbeddingMap32()
+			So(err, ShouldBeNil)
+			return embMap
+		}
+		embMap := train()
+		So(embMap, ShouldHaveLength, 10)
+		for i := 1; i < 5; i++ {
+			a, b := fmt.Sprintf("a%d", i), fmt.Sprintf("b%d", i)
+			So(cosine(embMap["a0"], embMap[a]), ShouldBeGreaterThan, cosine(embMap["a0"], embMap[b]))
+			So(cosine(embMap["b0"], embMap[b]), ShouldBeGreaterThan, cosine(embMap["b0"], embMap[a]))
+		}
+		// reproducible by Seed
+		So(train(), ShouldResemble, embMap)
+	})
+
+	Convey("glove errors", t, func() {
+		_, err := New(Dim(0))
+		So(err, ShouldNotBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		mod, err := New()
+		So(err, ShouldBeNil)
+		err = mod.(interface {
+			TrainContext(context.Context, <-chan string) error
+		}).TrainContext(ctx, clusterCorpus(10))
+		So(err, ShouldEqual, context.Canceled)
+	})
+}
@@ -0,0 +1,124 @@
+package glove
+
+var (
+	defaultAlpha    = 0.75
+	defaultDim      = 10
+	defaultInitlr   = 0.05
+	defaultIter     = 15
+	defaultLogBatch = 100000
+	defaultMaxCount = -1
+	defaultMinCount = 5
+	defaultSeed     = int64(1)
+	defaultToLower  = false
+	defaultVerbose  = false
+	defaultWindow   = 5
+	defaultXmax     = 100
+)
+
+type Options struct {
+	// Alpha and Xmax are the parameters of the weighting function
+	//	f(x) = (x/Xmax)^Alpha if x < Xmax else 1
+	Alpha    float64
+	Dim      int
+	Initlr   float64
+	Iter     int
+	LogBatch int
+	MaxCount int
+	MinCount int
+	Seed     int64
+	ToLower  bool
+	Verbose  bool
+	Window   int
+	Xmax     int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Alpha:    defaultAlpha,
+		Dim:      defaultDim,
+		Initlr:   defaultInitlr,
+		Iter:     defaultIter,
+		LogBatch: defaultLogBatch,
+		MaxCount: defaultMaxCount,
+		MinCount: defaultMinCount,
+		Seed:     defaultSeed,
+		ToLower:  defaultToLower,
+		Verbose:  defaultVerbose,
+		Window:   defaultWindow,
+		Xmax:     defaultXmax,
+	}
+}
+
+type ModelOption func(*Options)
+
+func Alpha(v float64) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Alpha = v
+	})
+}
+
+func Dim(v int) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Dim = v
+	})
+}
+
+func Initlr(v float64) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Initlr = v
+	})
+}
+
+func Iter(v int) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Iter = v
+	})
+}
+
+func LogBatch(v int) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.LogBatch = v
+	})
+}
+
+func MaxCount(v int) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.MaxCount = v
+	})
+}
+
+func MinCount(v int) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.MinCount = v
+	})
+}
+
+func Seed(v int64) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Seed = v
+	})
+}
+
+func ToLower() ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.ToLower = true
+	})
+}
+
+func Verbose() ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Verbose = true
+	})
+}
+
+func Window(v int) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Window = v
+	})
+}
+
+func Xmax(v int) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Xmax = v
+	})
+}
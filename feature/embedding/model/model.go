@@ -15,6 +15,7 @@
 package model
 
 import (
+	"context"
 	"io"
 
 	"github.com/auxten/go-ctr/feature/embedding/model/modelutil/matrix"
@@ -29,3 +30,9 @@ type Model interface {
 	GenEmbeddingMap32() (map[string][]float32, error)
 	EmbeddingByWord(word string) ([]float64, bool)
 }
+
+// ContextTrainer is implemented by the Model that can stop training when
+// ctx is done
+type ContextTrainer interface {
+	TrainContext(context.Context, <-chan string) error
+}
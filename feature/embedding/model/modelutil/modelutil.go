@@ -16,6 +16,7 @@ package modelutil
 
 import (
 	"math"
+	"math/rand"
 )
 
 var (
@@ -28,6 +29,35 @@ func NextRandom(value int) int {
 	return int(next % uint64(value))
 }
 
+// Random is the linear congruential generator of NextRandom of its own
+// seed, not safe for concurrent use. A nil Random draws from NextRandom and
+// math/rand.
+type Random struct {
+	next uint64
+}
+
+func NewRandom(seed uint64) *Random {
+	return &Random{next: seed}
+}
+
+// Intn is NextRandom of r
+func (r *Random) Intn(value int) int {
+	if r == nil {
+		return NextRandom(value)
+	}
+	r.next = r.next*uint64(25214903917) + 11
+	return int(r.next % uint64(value))
+}
+
+// Float64 returns a float64 in [0, 1)
+func (r *Random) Float64() float64 {
+	if r == nil {
+		return rand.Float64()
+	}
+	r.next = r.next*uint64(25214903917) + 11
+	return float64(r.next>>11) / (1 << 53)
+}
+
 // IndexPerThread creates interval of indices per thread.
 func IndexPerThread(threadSize, dataSize int) []int {
 	indexPerThread := make([]int, threadSize+1)
@@ -16,18 +16,20 @@ package subsample
 
 import (
 	"math"
-	"math/rand"
 
 	"github.com/auxten/go-ctr/feature/embedding/corpus/dictionary"
+	"github.com/auxten/go-ctr/feature/embedding/model/modelutil"
 )
 
 type Subsampler struct {
 	samples []float64
+	rnd     *modelutil.Random
 }
 
 func New(
 	dic *dictionary.Dictionary,
 	threshold float64,
+	rnd *modelutil.Random,
 ) *Subsampler {
 	samples := make([]float64, dic.Len())
 	for i := 0; i < dic.Len(); i++ {
@@ -39,11 +41,12 @@ func New(
 	}
 	return &Subsampler{
 		samples: samples,
+		rnd:     rnd,
 	}
 }
 
 func (s *Subsampler) Trial(id int) bool {
-	bernoulliTrial := rand.Float64()
+	bernoulliTrial := s.rnd.Float64()
 	var ok bool
 	if s.samples[id] > bernoulliTrial {
 		ok = true
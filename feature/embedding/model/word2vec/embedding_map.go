@@ -0,0 +1,173 @@
+package word2vec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// SaveEmbeddingMap32 saves embMap to path in the format of the extension:
+// ".json" for JSON, ".bin" for the binary format of the original word2vec,
+// otherwise the text format written by Model.Save.
+func SaveEmbeddingMap32(path string, embMap EmbeddingMap32) (err error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	w := bufio.NewWriter(f)
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.NewEncoder(w).Encode(embMap)
+	case ".bin":
+		err = embMap.WriteBinary(w)
+	default:
+		err = embMap.WriteText(w)
+	}
+	if err != nil {
+		return
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadEmbeddingMap32 loads the file saved by SaveEmbeddingMap32 or Model.Save
+func LoadEmbeddingMap32(path string) (embMap EmbeddingMap32, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.NewDecoder(r).Decode(&embMap)
+		return
+	case ".bin":
+		return ReadEmbeddingMap32Binary(r)
+	}
+	emb64, err := LoadEmbeddingMap(r)
+	if err != nil {
+		return
+	}
+	embMap = make(EmbeddingMap32, len(emb64))
+	for word, vec := range emb64 {
+		vec32 := make([]float32, len(vec))
+		for i, v := range vec {
+			vec32[i] = float32(v)
+		}
+		embMap[word] = vec32
+	}
+	return
+}
+
+func (m EmbeddingMap32) sortedWords() (words []string, dim int, err error) {
+	words = make([]string, 0, len(m))
+	dim = -1
+	for word, vec := range m {
+		if dim == -1 {
+			dim = len(vec)
+		} else if len(vec) != dim {
+			err = fmt.Errorf("dimension of %s mismatch: %d:%d", word, dim, len(vec))
+			return
+		}
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return
+}
+
+// WriteText writes "word v1 v2 ...\n" lines ordered by word
+func (m EmbeddingMap32) WriteText(w io.Writer) (err error) {
+	words, _, err := m.sortedWords()
+	if err != nil {
+		return
+	}
+	bw := bufio.NewWriter(w)
+	for _, word := range words {
+		bw.WriteString(word)
+		for _, v := range m[word] {
+			bw.WriteByte(' ')
+			bw.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// WriteBinary writes the binary format of the original word2vec, which could
+// be loaded by gensim KeyedVectors.load_word2vec_format(path, binary=True):
+//
+//	"<words> <dim>\n" then "<word> " + dim little-endian float32 + "\n" for each word
+func (m EmbeddingMap32) WriteBinary(w io.Writer) (err error) {
+	words, dim, err := m.sortedWords()
+	if err != nil {
+		return
+	}
+	if dim < 0 {
+		dim = 0
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%d %d\n", len(words), dim)
+	buf := make([]byte, 4*dim)
+	for _, word := range words {
+		bw.WriteString(word)
+		bw.WriteByte(' ')
+		for i, v := range m[word] {
+			binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+		}
+		bw.Write(buf)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ReadEmbeddingMap32Binary reads the format written by WriteBinary
+func ReadEmbeddingMap32Binary(r io.Reader) (embMap EmbeddingMap32, err error) {
+	br := bufio.NewReader(r)
+	var count, dim int
+	if _, err = fmt.Fscanf(br, "%d %d\n", &count, &dim); err != nil {
+		err = fmt.Errorf("bad word2vec binary header: %v", err)
+		return
+	}
+	embMap = make(EmbeddingMap32, count)
+	buf := make([]byte, 4*dim)
+	for i := 0; i < count; i++ {
+		var word string
+		if word, err = br.ReadString(' '); err != nil {
+			return nil, fmt.Errorf("read word %d error: %v", i, err)
+		}
+		// the newline after the previous vector is optional
+		word = word[:len(word)-1]
+		if len(word) > 0 && word[0] == '\n' {
+			word = word[1:]
+		}
+		if _, err = io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("read vector of %s error: %v", word, err)
+		}
+		vec := make([]float32, dim)
+		for j := range vec {
+			vec[j] = math.Float32frombits(binary.LittleEndian.Uint32(buf[j*4:]))
+		}
+		embMap[word] = vec
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package word2vec
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEmbeddingMap32SaveLoad(t *testing.T) {
+	embMap := EmbeddingMap32{
+		"1":  {0.1, -0.2, 3},
+		"22": {1e-7, 0, -1.5},
+		"3":  {4, 5, 6},
+	}
+	dir := t.TempDir()
+	Convey("save and load embedding map", t, func() {
+		for _, name := range []string{"emb.json", "emb.bin", "emb.txt"} {
+			path := filepath.Join(dir, name)
+			So(SaveEmbeddingMap32(path, embMap), ShouldBeNil)
+			loaded, err := LoadEmbeddingMap32(path)
+			So(err, ShouldBeNil)
+			So(loaded, ShouldResemble, embMap)
+		}
+	})
+
+	Convey("binary format", t, func() {
+		var buf bytes.Buffer
+		So(embMap.WriteBinary(&buf), ShouldBeNil)
+		So(bytes.HasPrefix(buf.Bytes(), []byte("3 3\n1 ")), ShouldBeTrue)
+		So(buf.Len(), ShouldEqual, len("3 3\n")+3*(3*4+1)+len("1 22 3 "))
+
+		// the newline after each vector is optional
+		var noNewline bytes.Buffer
+		b := buf.Bytes()
+		noNewline.Write(b[:4])
+		for off := 4; off < len(b); {
+			space := bytes.IndexByte(b[off:], ' ')
+			noNewline.Write(b[off : off+space+1+12])
+			off += space + 1 + 12 + 1
+		}
+		loaded, err := ReadEmbeddingMap32Binary(&noNewline)
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, embMap)
+	})
+
+	Convey("dimension mismatch", t, func() {
+		var buf bytes.Buffer
+		err := EmbeddingMap32{"1": {1}, "2": {1, 2}}.WriteBinary(&buf)
+		So(err, ShouldNotBeNil)
+	})
+}
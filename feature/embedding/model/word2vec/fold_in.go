@@ -0,0 +1,170 @@
+package word2vec
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// FoldInOptions controls EmbeddingMap32.FoldIn
+type FoldInOptions struct {
+	Window   int
+	Negative int
+	Iter     int
+	Initlr   float32
+	// Freeze keeps the vectors of the existing words unchanged, else they are
+	// also updated by the pairs with the new words
+	Freeze bool
+	Seed   int64
+}
+
+func DefaultFoldInOptions() FoldInOptions {
+	return FoldInOptions{
+		Window:   5,
+		Negative: 5,
+		Iter:     5,
+		Initlr:   0.025,
+		Freeze:   true,
+		Seed:     1,
+	}
+}
+
+// FoldIn adds the words of r missing in m without retraining the whole model.
+// The new vectors start from the average of their known context words, then
+// are trained by skip-gram with negative sampling against the vectors in m
+// for opts.Iter epochs. Only the pairs with at least one new word are trained.
+// r is a word sequence like the input of Train. m is modified in place even
+// if an error is returned, fold in a copy to keep m intact.
+func (m EmbeddingMap32) FoldIn(ctx context.Context, r <-chan string, opts FoldInOptions) (added []string, err error) {
+	var dim int
+	for _, vec := range m {
+		dim = len(vec)
+		break
+	}
+	if dim == 0 {
+		err = fmt.Errorf("fold in to empty embedding map")
+		return
+	}
+
+	doc, err := readDoc(ctx, r)
+	if err != nil {
+		return
+	}
+	var (
+		isNew = make(map[string]bool)
+		sums  = make(map[string][]float32)
+		cnts  = make(map[string]int)
+		rnd   = rand.New(rand.NewSource(opts.Seed))
+	)
+	for _, word := range doc {
+		if _, ok := m[word]; ok || isNew[word] {
+			continue
+		}
+		isNew[word] = true
+		added = append(added, word)
+		sums[word] = make([]float32, dim)
+	}
+	if len(added) == 0 {
+		return
+	}
+	for pos, word := range doc {
+		if !isNew[word] {
+			continue
+		}
+		for c := pos - opts.Window; c <= pos+opts.Window; c++ {
+			if c < 0 || c >= len(doc) || c == pos || isNew[doc[c]] {
+				continue
+			}
+			for i, v := range m[doc[c]] {
+				sums[word][i] += v
+			}
+			cnts[word]++
+		}
+	}
+	for _, word := range added {
+		vec := sums[word]
+		if cnts[word] == 0 {
+			for i := range vec {
+				vec[i] = (rnd.Float32() - 0.5) / float32(dim)
+			}
+		} else {
+			for i := range vec {
+				vec[i] /= float32(cnts[word])
+			}
+		}
+		m[word] = vec
+	}
+
+	var (
+		grad  = make([]float32, dim)
+		total = opts.Iter * len(doc)
+		step  int
+	)
+	for iter := 0; iter < opts.Iter; iter++ {
+		for pos, word := range doc {
+			step++
+			if pos%1024 == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lr := opts.Initlr * (1 - float32(step)/float32(total+1))
+			for c := pos - opts.Window; c <= pos+opts.Window; c++ {
+				if c < 0 || c >= len(doc) || c == pos || !(isNew[word] || isNew[doc[c]]) {
+					continue
+				}
+				for i := range grad {
+					grad[i] = 0
+				}
+				m.foldInPair(word, doc[c], 1, lr, grad, isNew, opts.Freeze)
+				for n := 0; n < opts.Negative; n++ {
+					neg := doc[rnd.Intn(len(doc))]
+					if neg == doc[c] {
+						continue
+					}
+					m.foldInPair(word, neg, 0, lr, grad, isNew, opts.Freeze)
+				}
+				if isNew[word] || !opts.Freeze {
+					for i, g := range grad {
+						m[word][i] += g
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func readDoc(ctx context.Context, r <-chan string) (doc []string, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case word, ok := <-r:
+			if !ok {
+				return
+			}
+			doc = append(doc, word)
+		}
+	}
+}
+
+// foldInPair accumulates the gradient of word to grad and updates target
+func (m EmbeddingMap32) foldInPair(word, target string, label float32, lr float32, grad []float32, isNew map[string]bool, freeze bool) {
+	var (
+		vec = m[word]
+		tgt = m[target]
+		dot float64
+	)
+	for i := range vec {
+		dot += float64(vec[i] * tgt[i])
+	}
+	g := lr * (label - float32(1/(1+math.Exp(-dot))))
+	for i := range grad {
+		grad[i] += g * tgt[i]
+	}
+	if isNew[target] || !freeze {
+		for i := range tgt {
+			tgt[i] += g * vec[i]
+		}
+	}
+}
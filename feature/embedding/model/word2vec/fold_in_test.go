@@ -0,0 +1,86 @@
+package word2vec
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i] * b[i])
+		na += float64(a[i] * a[i])
+		nb += float64(b[i] * b[i])
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// clusterMap has words a0-a4 around +x and b0-b4 around -x
+func clusterMap() EmbeddingMap32 {
+	m := make(EmbeddingMap32)
+	for i := 0; i < 5; i++ {
+		m[fmt.Sprintf("a%d", i)] = []float32{1, 0.1 * float32(i), 0, 0.2}
+		m[fmt.Sprintf("b%d", i)] = []float32{-1, 0, 0.1 * float32(i), 0.2}
+	}
+	return m
+}
+
+// clusterDoc has new word n0 among a words and n1 among b words
+func clusterDoc() <-chan string {
+	ch := make(chan string, 1000)
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 5; j++ {
+			ch <- fmt.Sprintf("a%d", (i+j)%5)
+		}
+		ch <- "n0"
+		for j := 0; j < 5; j++ {
+			ch <- fmt.Sprintf("b%d", (i+j)%5)
+		}
+		ch <- "n1"
+	}
+	close(ch)
+	return ch
+}
+
+func TestFoldIn(t *testing.T) {
+	Convey("fold in new words with frozen vectors", t, func() {
+		m := clusterMap()
+		a0 := append([]float32(nil), m["a0"]...)
+		added, err := m.FoldIn(context.Background(), clusterDoc(), DefaultFoldInOptions())
+		So(err, ShouldBeNil)
+		So(added, ShouldResemble, []string{"n0", "n1"})
+		So(m, ShouldHaveLength, 12)
+		So(m["a0"], ShouldResemble, a0)
+		So(cosine(m["n0"], m["a0"]), ShouldBeGreaterThan, cosine(m["n0"], m["b0"]))
+		So(cosine(m["n1"], m["b0"]), ShouldBeGreaterThan, cosine(m["n1"], m["a0"]))
+
+		added, err = m.FoldIn(context.Background(), clusterDoc(), DefaultFoldInOptions())
+		So(err, ShouldBeNil)
+		So(added, ShouldBeEmpty)
+	})
+
+	Convey("fold in without freeze updates the old vectors", t, func() {
+		m := clusterMap()
+		a0 := append([]float32(nil), m["a0"]...)
+		opts := DefaultFoldInOptions()
+		opts.Freeze = false
+		added, err := m.FoldIn(context.Background(), clusterDoc(), opts)
+		So(err, ShouldBeNil)
+		So(added, ShouldHaveLength, 2)
+		So(m["a0"], ShouldNotResemble, a0)
+	})
+
+	Convey("fold in errors", t, func() {
+		_, err := EmbeddingMap32{}.FoldIn(context.Background(), clusterDoc(), DefaultFoldInOptions())
+		So(err, ShouldNotBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = clusterMap().FoldIn(ctx, make(chan string), DefaultFoldInOptions())
+		So(err, ShouldEqual, context.Canceled)
+	})
+}
@@ -32,9 +32,10 @@ type mod interface {
 type skipGram struct {
 	ch     chan []float64
 	window int
+	rnd    *modelutil.Random
 }
 
-func newSkipGram(opts Options) mod {
+func newSkipGram(opts Options, rnd *modelutil.Random) mod {
 	ch := make(chan []float64, opts.Goroutines)
 	for i := 0; i < opts.Goroutines; i++ {
 		ch <- make([]float64, opts.Dim)
@@ -42,6 +43,7 @@ func newSkipGram(opts Options) mod {
 	return &skipGram{
 		ch:     ch,
 		window: opts.Window,
+		rnd:    rnd,
 	}
 }
 
@@ -56,7 +58,7 @@ func (mod *skipGram) trainOne(
 	defer func() {
 		mod.ch <- tmp
 	}()
-	del := modelutil.NextRandom(mod.window)
+	del := mod.rnd.Intn(mod.window)
 	for a := del; a < mod.window*2+1-del; a++ {
 		if a == mod.window {
 			continue
@@ -80,16 +82,19 @@ func (mod *skipGram) trainOne(
 type cbow struct {
 	ch     chan []float64
 	window int
+	rnd    *modelutil.Random
 }
 
-func newCbow(opts Options) mod {
+func newCbow(opts Options, rnd *modelutil.Random) mod {
+	// every trainOne takes 2 buffers
 	ch := make(chan []float64, opts.Goroutines*2)
-	for i := 0; i < opts.Goroutines; i++ {
+	for i := 0; i < opts.Goroutines*2; i++ {
 		ch <- make([]float64, opts.Dim)
 	}
 	return &cbow{
 		ch:     ch,
 		window: opts.Window,
+		rnd:    rnd,
 	}
 }
 
@@ -120,7 +125,7 @@ func (mod *cbow) dowith(
 	agg, tmp []float64,
 	fn func(ctx, agg, tmp []float64),
 ) {
-	del := modelutil.NextRandom(mod.window)
+	del := mod.rnd.Intn(mod.window)
 	for a := del; a < mod.window*2+1-del; a++ {
 		if a == mod.window {
 			continue
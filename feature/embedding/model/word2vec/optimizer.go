@@ -15,8 +15,6 @@
 package word2vec
 
 import (
-	"math/rand"
-
 	"github.com/auxten/go-ctr/feature/embedding/corpus/dictionary"
 	"github.com/auxten/go-ctr/feature/embedding/corpus/dictionary/node"
 	"github.com/auxten/go-ctr/feature/embedding/model/modelutil"
@@ -31,21 +29,23 @@ type negativeSampling struct {
 	ctx        *matrix.Matrix
 	sigtable   *sigmoidTable
 	sampleSize int
+	rand       *modelutil.Random
 }
 
-func newNegativeSampling(dic *dictionary.Dictionary, opts Options) optimizer {
+func newNegativeSampling(dic *dictionary.Dictionary, opts Options, rnd *modelutil.Random) optimizer {
 	return &negativeSampling{
 		ctx: matrix.New(
 			dic.Len(),
 			opts.Dim,
 			func(_ int, vec []float64) {
 				for i := 0; i < opts.Dim; i++ {
-					vec[i] = (rand.Float64() - 0.5) / float64(opts.Dim)
+					vec[i] = (rnd.Float64() - 0.5) / float64(opts.Dim)
 				}
 			},
 		),
 		sigtable:   newSigmoidTable(),
 		sampleSize: opts.NegativeSampleSize,
+		rand:       rnd,
 	}
 }
 
@@ -65,7 +65,7 @@ func (opt *negativeSampling) optim(
 			picked = id
 		} else {
 			label = 0
-			picked = modelutil.NextRandom(opt.ctx.Row())
+			picked = opt.rand.Intn(opt.ctx.Row())
 			if id == picked {
 				continue
 			}
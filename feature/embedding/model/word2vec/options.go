@@ -50,6 +50,7 @@ var (
 	defaultModelType          = Cbow
 	defaultNegativeSampleSize = 5
 	defaultOptimizerType      = NegativeSampling
+	defaultSeed               = int64(0)
 	defaultSubsampleThreshold = 1.0e-3
 	defaultToLower            = false
 	defaultUpdateLRBatch      = 100000
@@ -72,6 +73,10 @@ type Options struct {
 	ModelType          ModelType
 	NegativeSampleSize int
 	OptimizerType      OptimizerType
+	// Seed seeds the init weights, the windows, the negative samples and
+	// the subsampling if not 0, the training runs on a single goroutine to
+	// be reproducible then
+	Seed               int64
 	SubsampleThreshold float64
 	ToLower            bool
 	UpdateLRBatch      int
@@ -95,6 +100,7 @@ func DefaultOptions() Options {
 		ModelType:          defaultModelType,
 		NegativeSampleSize: defaultNegativeSampleSize,
 		OptimizerType:      defaultOptimizerType,
+		Seed:               defaultSeed,
 		SubsampleThreshold: defaultSubsampleThreshold,
 		ToLower:            defaultToLower,
 		UpdateLRBatch:      defaultUpdateLRBatch,
@@ -118,6 +124,7 @@ func LoadForCmd(cmd *cobra.Command, opts *Options) {
 	cmd.Flags().StringVar(&opts.ModelType, "model", defaultModelType, fmt.Sprintf("which model does it use? one of: %s|%s", Cbow, SkipGram))
 	cmd.Flags().IntVar(&opts.NegativeSampleSize, "sample", defaultNegativeSampleSize, "negative sample size(for negative sampling only)")
 	cmd.Flags().StringVar(&opts.OptimizerType, "optimizer", defaultOptimizerType, fmt.Sprintf("which optimizer does it use? one of: %s|%s", HierarchicalSoftmax, NegativeSampling))
+	cmd.Flags().Int64Var(&opts.Seed, "seed", defaultSeed, "seed for reproducible training on a single goroutine, 0 is unseeded")
 	cmd.Flags().Float64Var(&opts.SubsampleThreshold, "threshold", defaultSubsampleThreshold, "threshold for subsampling")
 	cmd.Flags().BoolVar(&opts.ToLower, "to-lower", defaultToLower, "whether the words on corpus convert to lowercase or not")
 	cmd.Flags().IntVar(&opts.UpdateLRBatch, "update-lr-batch", defaultUpdateLRBatch, "batch size to update learning rate")
@@ -211,6 +218,12 @@ func Optimizer(typ OptimizerType) ModelOption {
 	})
 }
 
+func Seed(v int64) ModelOption {
+	return ModelOption(func(opts *Options) {
+		opts.Seed = v
+	})
+}
+
 func SubsampleThreshold(v float64) ModelOption {
 	return ModelOption(func(opts *Options) {
 		opts.SubsampleThreshold = v
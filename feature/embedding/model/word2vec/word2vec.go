@@ -18,7 +18,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"math/rand"
 	"sync"
 
 	"github.com/auxten/go-ctr/feature/embedding/emb"
@@ -47,6 +46,7 @@ type word2vec struct {
 	currentlr      float64
 	mod            mod
 	optimizer      optimizer
+	rnd            *modelutil.Random
 	embeddingMap   EmbeddingMap
 	embeddingMap32 EmbeddingMap32
 
@@ -77,6 +77,10 @@ func New(opts ...ModelOption) (model.Model, error) {
 
 func NewForOptions(opts Options) (model.Model, error) {
 	// TODO: validate Options
+	if opts.Seed != 0 {
+		// the goroutines update the weights racily
+		opts.Goroutines = 1
+	}
 	v := verbose.New(opts.Verbose)
 	return &word2vec{
 		opts: opts,
@@ -88,6 +92,12 @@ func NewForOptions(opts Options) (model.Model, error) {
 }
 
 func (w *word2vec) Train(r <-chan string) error {
+	return w.TrainContext(context.Background(), r)
+}
+
+// TrainContext is Train returning ctx.Err() promptly after ctx is done
+func (w *word2vec) TrainContext(ctx context.Context, r <-chan string) error {
+	r = untilDone(ctx, r)
 	if w.opts.DocInMemory {
 		w.corpus = memory.New(r, w.opts.ToLower, w.opts.MaxCount, w.opts.MinCount)
 	} else {
@@ -97,26 +107,32 @@ func (w *word2vec) Train(r <-chan string) error {
 	if err := w.corpus.Load(w.verbose, w.opts.LogBatch); err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	dic, dim := w.corpus.Dictionary(), w.opts.Dim
+	if w.opts.Seed != 0 {
+		w.rnd = modelutil.NewRandom(uint64(w.opts.Seed))
+	}
 
 	w.param = matrix.New(
 		dic.Len(),
 		dim,
 		func(_ int, vec []float64) {
 			for i := 0; i < dim; i++ {
-				vec[i] = (rand.Float64() - 0.5) / float64(dim)
+				vec[i] = (w.rnd.Float64() - 0.5) / float64(dim)
 			}
 		},
 	)
 
-	w.subsampler = subsample.New(dic, w.opts.SubsampleThreshold)
+	w.subsampler = subsample.New(dic, w.opts.SubsampleThreshold, w.rnd)
 
 	switch w.opts.ModelType {
 	case SkipGram:
-		w.mod = newSkipGram(w.opts)
+		w.mod = newSkipGram(w.opts, w.rnd)
 	case Cbow:
-		w.mod = newCbow(w.opts)
+		w.mod = newCbow(w.opts, w.rnd)
 	default:
 		return fmt.Errorf("invalid model: %s not in %s|%s", w.opts.ModelType, Cbow, SkipGram)
 	}
@@ -126,6 +142,7 @@ func (w *word2vec) Train(r <-chan string) error {
 		w.optimizer = newNegativeSampling(
 			w.corpus.Dictionary(),
 			w.opts,
+			w.rnd,
 		)
 	case HierarchicalSoftmax:
 		w.optimizer = newHierarchicalSoftmax(
@@ -137,18 +154,45 @@ func (w *word2vec) Train(r <-chan string) error {
 	}
 
 	if w.opts.DocInMemory {
-		if err := w.train(); err != nil {
+		if err := w.train(ctx); err != nil {
 			return err
 		}
 	} else {
-		if err := w.batchTrain(); err != nil {
+		if err := w.batchTrain(ctx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (w *word2vec) train() error {
+// untilDone forwards r until it is closed or ctx is done
+func untilDone(ctx context.Context, r <-chan string) <-chan string {
+	if ctx.Done() == nil {
+		return r
+	}
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line, ok := <-r:
+				if !ok {
+					return
+				}
+				select {
+				case out <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (w *word2vec) train(ctx context.Context) error {
 	doc := w.corpus.IndexedDoc()
 	indexPerThread := modelutil.IndexPerThread(
 		w.opts.Goroutines,
@@ -165,16 +209,19 @@ func (w *word2vec) train() error {
 		for i := 0; i < w.opts.Goroutines; i++ {
 			wg.Add(1)
 			s, e := indexPerThread[i], indexPerThread[i+1]
-			go w.trainPerThread(doc[s:e], trained, sem, wg)
+			go w.trainPerThread(ctx, doc[s:e], trained, sem, wg)
 		}
 
 		wg.Wait()
 		close(trained)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (w *word2vec) batchTrain() error {
+func (w *word2vec) batchTrain(ctx context.Context) error {
 	for i := 1; i <= w.opts.Iter; i++ {
 		trained, clk := make(chan struct{}), clock.New()
 		go w.observe(trained, clk)
@@ -185,32 +232,41 @@ func (w *word2vec) batchTrain() error {
 		in := make(chan []int, w.opts.Goroutines)
 		go w.corpus.BatchWords(in, w.opts.BatchSize)
 		for doc := range in {
+			if ctx.Err() != nil {
+				// drain to let BatchWords exit
+				continue
+			}
 			wg.Add(1)
-			go w.trainPerThread(doc, trained, sem, wg)
+			go w.trainPerThread(ctx, doc, trained, sem, wg)
 		}
 
 		wg.Wait()
 		close(trained)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (w *word2vec) trainPerThread(
+	ctx context.Context,
 	doc []int,
 	trained chan struct{},
 	sem *semaphore.Weighted,
 	wg *sync.WaitGroup,
 ) error {
-	defer func() {
-		wg.Done()
-		sem.Release(1)
-	}()
+	defer wg.Done()
 
-	if err := sem.Acquire(context.Background(), 1); err != nil {
+	if err := sem.Acquire(ctx, 1); err != nil {
 		return err
 	}
+	defer sem.Release(1)
 
 	for pos, id := range doc {
+		if pos%1024 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if w.subsampler.Trial(id) {
 			w.mod.trainOne(doc, pos, w.currentlr, w.param, w.optimizer)
 		}
@@ -0,0 +1,182 @@
+// Package node2vec generates the node2vec random walks on the item
+// co-occurrence graph, see https://arxiv.org/abs/1607.00653. The walks are
+// the corpus of the word2vec model instead of the raw sessions, which links
+// the items of short sessions through the items they share.
+package node2vec
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+type Options struct {
+	// Window is the max distance of the co-occurred items in a session,
+	// <= 0 means the whole session
+	Window       int
+	WalkLength   int
+	WalksPerNode int
+	// P is the return parameter, a higher P explores more
+	P float64
+	// Q is the in-out parameter, Q > 1 walks like BFS, Q < 1 like DFS
+	Q    float64
+	Seed int64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Window:       5,
+		WalkLength:   20,
+		WalksPerNode: 10,
+		P:            1,
+		Q:            1,
+		Seed:         1,
+	}
+}
+
+// Graph is the undirected item co-occurrence graph weighted by the count
+type Graph struct {
+	ids   map[string]int
+	items []string
+	adj   []map[int]float64
+	// neighbors of adj in order for the reproducible walks
+	neighbors [][]int
+}
+
+func NewGraph() *Graph {
+	return &Graph{ids: make(map[string]int)}
+}
+
+func (g *Graph) id(item string) int {
+	if id, ok := g.ids[item]; ok {
+		return id
+	}
+	id := len(g.items)
+	g.ids[item] = id
+	g.items = append(g.items, item)
+	g.adj = append(g.adj, make(map[int]float64))
+	return id
+}
+
+// AddSession links the items of session within window, window <= 0 links
+// all of them
+func (g *Graph) AddSession(session []string, window int) {
+	g.neighbors = nil
+	ids := make([]int, len(session))
+	for i, item := range session {
+		ids[i] = g.id(item)
+	}
+	for i, a := range ids {
+		for j := i + 1; j < len(ids) && (window <= 0 || j-i <= window); j++ {
+			if b := ids[j]; a != b {
+				g.adj[a][b]++
+				g.adj[b][a]++
+			}
+		}
+	}
+}
+
+// Len is the count of the items
+func (g *Graph) Len() int {
+	return len(g.items)
+}
+
+// Weight of the edge between a and b, 0 if not linked
+func (g *Graph) Weight(a, b string) float64 {
+	ia, ok := g.ids[a]
+	if !ok {
+		return 0
+	}
+	ib, ok := g.ids[b]
+	if !ok {
+		return 0
+	}
+	return g.adj[ia][ib]
+}
+
+func (g *Graph) sortNeighbors() {
+	if g.neighbors != nil {
+		return
+	}
+	g.neighbors = make([][]int, len(g.adj))
+	for id, edges := range g.adj {
+		for n := range edges {
+			g.neighbors[id] = append(g.neighbors[id], n)
+		}
+		sort.Ints(g.neighbors[id])
+	}
+}
+
+// Walk calls emit with opts.WalksPerNode walks from every item with any
+// neighbor until emit returns an error or ctx is done
+func (g *Graph) Walk(ctx context.Context, opts Options, emit func(walk []string) error) (err error) {
+	if opts.WalkLength < 2 || opts.P <= 0 || opts.Q <= 0 {
+		return fmt.Errorf("invalid node2vec options: walk length %d p %v q %v", opts.WalkLength, opts.P, opts.Q)
+	}
+	g.sortNeighbors()
+	var (
+		rnd   = rand.New(rand.NewSource(opts.Seed))
+		order = make([]int, len(g.items))
+		walk  = make([]int, 0, opts.WalkLength)
+		items = make([]string, 0, opts.WalkLength)
+		probs []float64
+	)
+	for i := range order {
+		order[i] = i
+	}
+	for n := 0; n < opts.WalksPerNode; n++ {
+		rnd.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		for _, start := range order {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			if len(g.neighbors[start]) == 0 {
+				continue
+			}
+			walk = append(walk[:0], start)
+			for len(walk) < opts.WalkLength {
+				cur := walk[len(walk)-1]
+				neighbors := g.neighbors[cur]
+				probs = probs[:0]
+				for _, x := range neighbors {
+					w := g.adj[cur][x]
+					if len(walk) > 1 {
+						prev := walk[len(walk)-2]
+						if x == prev {
+							w /= opts.P
+						} else if _, ok := g.adj[prev][x]; !ok {
+							w /= opts.Q
+						}
+					}
+					probs = append(probs, w)
+				}
+				walk = append(walk, neighbors[sample(rnd, probs)])
+			}
+			items = items[:0]
+			for _, id := range walk {
+				items = append(items, g.items[id])
+			}
+			if err = emit(items); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// sample returns the index drawn by the unnormalized probs
+func sample(rnd *rand.Rand, probs []float64) int {
+	var sum float64
+	for _, p := range probs {
+		sum += p
+	}
+	r := rnd.Float64() * sum
+	for i, p := range probs {
+		if r < p {
+			return i
+		}
+		r -= p
+	}
+	return len(probs) - 1
+}
@@ -0,0 +1,75 @@
+package node2vec
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGraph(t *testing.T) {
+	Convey("co-occurrence graph", t, func() {
+		g := NewGraph()
+		g.AddSession([]string{"a", "b", "c"}, 1)
+		g.AddSession([]string{"a", "b"}, 0)
+		g.AddSession([]string{"d"}, 0)
+		So(g.Len(), ShouldEqual, 4)
+		So(g.Weight("a", "b"), ShouldEqual, 2)
+		So(g.Weight("b", "a"), ShouldEqual, 2)
+		So(g.Weight("b", "c"), ShouldEqual, 1)
+		So(g.Weight("a", "c"), ShouldEqual, 0)
+		So(g.Weight("a", "x"), ShouldEqual, 0)
+
+		g.AddSession([]string{"a", "b", "c"}, 0)
+		So(g.Weight("a", "c"), ShouldEqual, 1)
+	})
+
+	Convey("random walks", t, func() {
+		g := NewGraph()
+		g.AddSession([]string{"a", "b", "c"}, 0)
+		g.AddSession([]string{"c", "d"}, 0)
+		g.AddSession([]string{"e"}, 0)
+		opts := DefaultOptions()
+		opts.WalkLength, opts.WalksPerNode = 5, 3
+
+		walk := func() (walks [][]string) {
+			So(g.Walk(context.Background(), opts, func(w []string) error {
+				walks = append(walks, append([]string(nil), w...))
+				return nil
+			}), ShouldBeNil)
+			return
+		}
+		walks := walk()
+		// e is isolated
+		So(walks, ShouldHaveLength, 4*3)
+		for _, w := range walks {
+			So(w, ShouldHaveLength, 5)
+			for i := 1; i < len(w); i++ {
+				So(g.Weight(w[i-1], w[i]), ShouldBeGreaterThan, 0)
+			}
+		}
+		So(walk(), ShouldResemble, walks)
+
+		// a tiny P always returns to the previous item
+		opts.P = 1e-9
+		for _, w := range walk() {
+			So(w[2], ShouldEqual, w[0])
+		}
+	})
+
+	Convey("walk errors", t, func() {
+		g := NewGraph()
+		g.AddSession([]string{"a", "b"}, 0)
+		opts := DefaultOptions()
+		opts.WalkLength = 1
+		So(g.Walk(context.Background(), opts, func([]string) error { return nil }), ShouldNotBeNil)
+
+		stop := errors.New("stop")
+		So(g.Walk(context.Background(), DefaultOptions(), func([]string) error { return stop }), ShouldEqual, stop)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		So(g.Walk(ctx, DefaultOptions(), func([]string) error { return nil }), ShouldEqual, context.Canceled)
+	})
+}
@@ -1,25 +1,102 @@
 package embedding
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/auxten/go-ctr/feature/embedding/model"
+	"github.com/auxten/go-ctr/feature/embedding/model/glove"
 	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
 	log "github.com/sirupsen/logrus"
 )
 
 func TrainEmbedding(inputCh <-chan string, window int, dim int, iter int) (mod model.Model, err error) {
-	if mod, err = word2vec.New(
-		word2vec.Window(window),
-		word2vec.Dim(dim),
-		word2vec.Model(word2vec.SkipGram),
-		word2vec.Optimizer(word2vec.HierarchicalSoftmax),
-		word2vec.Verbose(),
-		word2vec.Iter(iter),
-		word2vec.DocInMemory(),
-	); err != nil {
+	return TrainEmbeddingContext(context.Background(), inputCh, window, dim, iter)
+}
+
+// Algorithm of the embedding model
+type Algorithm = string
+
+const (
+	Cbow     Algorithm = word2vec.Cbow
+	SkipGram Algorithm = word2vec.SkipGram
+	GloVe    Algorithm = "glove"
+)
+
+// Options of TrainEmbeddingWithOptions, Optimizer and NegativeSampleSize
+// only apply to Cbow and SkipGram
+type Options struct {
+	Algorithm          Algorithm
+	Optimizer          word2vec.OptimizerType
+	Window             int
+	Dim                int
+	Iter               int
+	MinCount           int
+	NegativeSampleSize int
+	// Seed makes the training reproducible if not 0, Cbow and SkipGram
+	// train on a single goroutine then
+	Seed int64
+}
+
+// DefaultOptions is the configuration used by TrainEmbedding
+func DefaultOptions(window int, dim int, iter int) Options {
+	return Options{
+		Algorithm:          SkipGram,
+		Optimizer:          word2vec.HierarchicalSoftmax,
+		Window:             window,
+		Dim:                dim,
+		Iter:               iter,
+		MinCount:           word2vec.DefaultOptions().MinCount,
+		NegativeSampleSize: word2vec.DefaultOptions().NegativeSampleSize,
+	}
+}
+
+// TrainEmbeddingContext is TrainEmbedding returning ctx.Err() if ctx is done
+func TrainEmbeddingContext(ctx context.Context, inputCh <-chan string, window int, dim int, iter int) (mod model.Model, err error) {
+	return TrainEmbeddingWithOptions(ctx, inputCh, DefaultOptions(window, dim, iter))
+}
+
+// TrainEmbeddingWithOptions trains the embedding model of opts.Algorithm
+func TrainEmbeddingWithOptions(ctx context.Context, inputCh <-chan string, opts Options) (mod model.Model, err error) {
+	switch opts.Algorithm {
+	case Cbow, SkipGram:
+		mod, err = word2vec.New(
+			word2vec.Window(opts.Window),
+			word2vec.Dim(opts.Dim),
+			word2vec.Model(opts.Algorithm),
+			word2vec.Optimizer(opts.Optimizer),
+			word2vec.NegativeSampleSize(opts.NegativeSampleSize),
+			word2vec.MinCount(opts.MinCount),
+			word2vec.Verbose(),
+			word2vec.Iter(opts.Iter),
+			word2vec.DocInMemory(),
+			word2vec.Seed(opts.Seed),
+		)
+	case GloVe:
+		gloveOpts := []glove.ModelOption{
+			glove.Window(opts.Window),
+			glove.Dim(opts.Dim),
+			glove.MinCount(opts.MinCount),
+			glove.Verbose(),
+			glove.Iter(opts.Iter),
+		}
+		if opts.Seed != 0 {
+			gloveOpts = append(gloveOpts, glove.Seed(opts.Seed))
+		}
+		mod, err = glove.New(gloveOpts...)
+	default:
+		err = fmt.Errorf("invalid embedding algorithm: %s not in %s|%s|%s", opts.Algorithm, Cbow, SkipGram, GloVe)
+	}
+	if err != nil {
 		return
 	}
 
-	if err = mod.Train(inputCh); err != nil {
+	if ct, ok := mod.(model.ContextTrainer); ok {
+		err = ct.TrainContext(ctx, inputCh)
+	} else {
+		err = mod.Train(inputCh)
+	}
+	if err != nil {
 		log.Errorf("failed to train embedding: %v", err)
 		return
 	}
@@ -1,13 +1,16 @@
 package embedding
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/auxten/go-ctr/feature/embedding/emb"
 	"github.com/auxten/go-ctr/feature/embedding/model/modelutil/vector"
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
 	"github.com/auxten/go-ctr/feature/embedding/search"
 	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
@@ -92,3 +95,84 @@ func TestEmbedding(t *testing.T) {
 		}
 	})
 }
+
+func TestEmbeddingCancel(t *testing.T) {
+	Convey("embedding training cancelled", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		inputCh := make(chan string)
+		go func() {
+			defer close(inputCh)
+			for i := 0; ; i++ {
+				select {
+				case inputCh <- fmt.Sprintf("%d %d %d", i%10, (i+1)%10, (i+2)%10):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+		_, err := TrainEmbeddingContext(ctx, inputCh, 2, 4, 1)
+		So(err, ShouldEqual, context.Canceled)
+	})
+}
+
+// clusterCorpus generates blocks of words "a0"-"a4" and "b0"-"b4" in turn
+func clusterCorpus(blocks int) <-chan string {
+	inputCh := make(chan string, 100)
+	go func() {
+		defer close(inputCh)
+		for i := 0; i < blocks; i++ {
+			cluster := "ab"[i%2]
+			for j := 0; j < 10; j++ {
+				inputCh <- fmt.Sprintf("%c%d", cluster, (i*3+j*7)%5)
+			}
+		}
+	}()
+	return inputCh
+}
+
+func TestEmbeddingOptions(t *testing.T) {
+	Convey("embedding algorithms", t, func() {
+		for _, algo := range []Algorithm{Cbow, SkipGram, GloVe} {
+			opts := DefaultOptions(3, 4, 3)
+			opts.Algorithm = algo
+			opts.Optimizer = word2vec.NegativeSampling
+			opts.MinCount = 1
+			mod, err := TrainEmbeddingWithOptions(context.Background(), clusterCorpus(200), opts)
+			So(err, ShouldBeNil)
+			embMap, err := mod.GenEmbeddingMap32()
+			So(err, ShouldBeNil)
+			So(embMap, ShouldHaveLength, 10)
+			So(embMap["a0"], ShouldHaveLength, 4)
+		}
+
+		opts := DefaultOptions(3, 4, 3)
+		opts.Algorithm = "fasttext"
+		_, err := TrainEmbeddingWithOptions(context.Background(), clusterCorpus(1), opts)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestEmbeddingSeed(t *testing.T) {
+	Convey("seeded embeddings are reproducible", t, func() {
+		for _, algo := range []Algorithm{Cbow, SkipGram, GloVe} {
+			var maps []map[string][]float32
+			for run := 0; run < 2; run++ {
+				opts := DefaultOptions(3, 4, 3)
+				opts.Algorithm = algo
+				opts.Optimizer = word2vec.NegativeSampling
+				opts.MinCount = 1
+				opts.Seed = 7
+				mod, err := TrainEmbeddingWithOptions(context.Background(), clusterCorpus(200), opts)
+				So(err, ShouldBeNil)
+				embMap, err := mod.GenEmbeddingMap32()
+				So(err, ShouldBeNil)
+				maps = append(maps, embMap)
+			}
+			So(maps[1], ShouldResemble, maps[0])
+		}
+	})
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"embed"
+	"encoding/json"
 	"flag"
+	"os"
+	"time"
 
 	"github.com/auxten/go-ctr/example/movielens"
 	"github.com/auxten/go-ctr/model/mlp"
@@ -15,7 +18,17 @@ import (
 //go:embed frontend/website/*
 var f embed.FS
 
-var verFlag = flag.Bool("v", false, "show binary version")
+var (
+	verFlag        = flag.Bool("v", false, "show binary version")
+	requestLogFlag = flag.String("request-log", "", "append the api requests to the file for replay")
+	replayFlag     = flag.String("replay", "", "replay the request log against the model trained and exit")
+	toleranceFlag  = flag.Float64("replay-tolerance", 1e-5, "max score difference of a replayed item")
+	validateFlag   = flag.Bool("validate", false, "validate the training pipeline with a small dry run and exit")
+
+	selftestQpsFlag      = flag.Int("selftest-qps", 0, "load test the model trained in process at the qps and exit")
+	selftestDurationFlag = flag.Duration("selftest-duration", 30*time.Second, "duration of the load test")
+	selftestLogFlag      = flag.String("selftest-log", "", "request log to load test with, synthetic requests if empty")
+)
 
 var Version = "unknown-version"
 var Commit = "unknown-commit"
@@ -49,9 +62,76 @@ func main() {
 	// fiter.LearningRateInit = .0025
 
 	trainCtx := context.Background()
+	if *validateFlag {
+		report, err := rcmd.ValidatePipeline(trainCtx, recSys, &mlp.SimpleMlpFitWrap{Model: fiter})
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		if !report.OK() {
+			os.Exit(1)
+		}
+		return
+	}
 	model, err = rcmd.Train(trainCtx, recSys, &mlp.SimpleMlpFitWrap{Model: fiter})
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *replayFlag != "" {
+		replay(model)
+		return
+	}
+	if *selftestQpsFlag > 0 {
+		selftest(model)
+		return
+	}
+	if *requestLogFlag != "" {
+		logFile, err := os.OpenFile(*requestLogFlag, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer logFile.Close()
+		rcmd.RequestLog = rcmd.NewRequestLogger(logFile)
+	}
 	rcmd.StartHttpApi(model, "/api/v1/recommend", ":8080", &f)
 }
+
+func replay(model rcmd.Predictor) {
+	logFile, err := os.Open(*replayFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logFile.Close()
+	report, err := rcmd.Replay(context.Background(), model, logFile, float32(*toleranceFlag))
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+func selftest(model rcmd.Predictor) {
+	opts := rcmd.DefaultLoadTestOptions(*selftestQpsFlag)
+	opts.Duration = *selftestDurationFlag
+	if *selftestLogFlag != "" {
+		logFile, err := os.Open(*selftestLogFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Requests, err = rcmd.LoadRequests(logFile)
+		logFile.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	report, err := rcmd.LoadTest(context.Background(), model, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
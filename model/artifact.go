@@ -0,0 +1,303 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/auxten/go-ctr/utils"
+)
+
+// Artifact is a flat binary model encoding, tensors are stored 4 bytes
+// aligned so they could be used in place without decoding. With MmapArtifact
+// loading a model costs nearly nothing but a mmap syscall.
+//
+// Layout, all little-endian:
+//
+//	magic "CTRA" | version uint32 | dims count uint32 | tensors count uint32
+//	dims:    [name len uint32 | name | pad to 4 | value int64] ...
+//	tensors: [name len uint32 | name | pad to 4 | dtype uint32 | len uint32 | data] ...
+//
+// data is float32 * len for dtypeFloat32, for dtypeInt8 it is a float32 scale
+// followed by int8 * len padded to 4, see QuantizeInt8.
+// Version 1 artifacts have no dtype, all tensors are float32.
+type Artifact struct {
+	Dims    map[string]int
+	Tensors map[string][]float32
+	// QuantizeInt8 makes Marshal store the tensors as symmetric per tensor
+	// int8, 4x smaller but the tensors are dequantized (copied) on load.
+	QuantizeInt8 bool
+
+	// data is the mmapped file or the buffer tensors point to
+	data   []byte
+	unmmap func() error
+}
+
+const (
+	artifactMagic   = "CTRA"
+	artifactVersion = 2
+
+	dtypeFloat32 = 0
+	dtypeInt8    = 1
+)
+
+func NewArtifact() *Artifact {
+	return &Artifact{
+		Dims:    make(map[string]int),
+		Tensors: make(map[string][]float32),
+	}
+}
+
+// Marshal encodes the artifact
+func (a *Artifact) Marshal() (data []byte, err error) {
+	var buf bytes.Buffer
+	buf.WriteString(artifactMagic)
+	writeUint32(&buf, artifactVersion)
+	writeUint32(&buf, uint32(len(a.Dims)))
+	writeUint32(&buf, uint32(len(a.Tensors)))
+
+	for _, name := range sortedKeys(a.Dims) {
+		writeName(&buf, name)
+		var v [8]byte
+		binary.LittleEndian.PutUint64(v[:], uint64(int64(a.Dims[name])))
+		buf.Write(v[:])
+	}
+	for _, name := range sortedKeys(a.Tensors) {
+		t := a.Tensors[name]
+		writeName(&buf, name)
+		if a.QuantizeInt8 {
+			writeUint32(&buf, dtypeInt8)
+			writeUint32(&buf, uint32(len(t)))
+			scale, q := QuantizeInt8(t)
+			if err = binary.Write(&buf, binary.LittleEndian, scale); err != nil {
+				return
+			}
+			if err = binary.Write(&buf, binary.LittleEndian, q); err != nil {
+				return
+			}
+			for buf.Len()%4 != 0 {
+				buf.WriteByte(0)
+			}
+			continue
+		}
+		writeUint32(&buf, dtypeFloat32)
+		writeUint32(&buf, uint32(len(t)))
+		if err = binary.Write(&buf, binary.LittleEndian, t); err != nil {
+			return
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteArtifact writes the artifact to path
+func (a *Artifact) WriteArtifact(path string) (err error) {
+	data, err := a.Marshal()
+	if err != nil {
+		return
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// UnmarshalArtifact decodes data, tensors share the memory of data if
+// possible, see utils.Float32sFromBytes, so data should not be modified after.
+func UnmarshalArtifact(data []byte) (a *Artifact, err error) {
+	a = NewArtifact()
+	a.data = data
+	r := artifactReader{data: data}
+	if string(r.next(4)) != artifactMagic {
+		return nil, fmt.Errorf("not a model artifact")
+	}
+	version := r.uint32()
+	if version < 1 || version > artifactVersion {
+		return nil, fmt.Errorf("unsupported artifact version: %d", version)
+	}
+	dims, tensors := int(r.uint32()), int(r.uint32())
+	for i := 0; i < dims && r.err == nil; i++ {
+		name := r.name()
+		a.Dims[name] = int(int64(binary.LittleEndian.Uint64(r.next(8))))
+	}
+	for i := 0; i < tensors && r.err == nil; i++ {
+		name := r.name()
+		dtype := uint32(dtypeFloat32)
+		if version >= 2 {
+			dtype = r.uint32()
+		}
+		n := int(r.uint32())
+		switch dtype {
+		case dtypeFloat32:
+			a.Tensors[name] = r.float32s(n)
+		case dtypeInt8:
+			a.QuantizeInt8 = true
+			a.Tensors[name] = r.int8s(n)
+		default:
+			return nil, fmt.Errorf("unsupported dtype %d of tensor %s", dtype, name)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return
+}
+
+// MmapArtifact maps the artifact file at path into memory read only,
+// the tensors must not be modified. Close the artifact after the model
+// using it is dropped.
+func MmapArtifact(path string) (a *Artifact, err error) {
+	data, unmmap, err := utils.MmapFile(path)
+	if err != nil {
+		return
+	}
+	if a, err = UnmarshalArtifact(data); err != nil {
+		unmmap()
+		return
+	}
+	a.unmmap = unmmap
+	return
+}
+
+func (a *Artifact) Close() error {
+	if a.unmmap == nil {
+		return nil
+	}
+	unmmap := a.unmmap
+	a.unmmap = nil
+	return unmmap()
+}
+
+// Dim returns the dim named name or an error if not found
+func (a *Artifact) Dim(name string) (int, error) {
+	v, ok := a.Dims[name]
+	if !ok {
+		return 0, fmt.Errorf("dim %s not found in artifact", name)
+	}
+	return v, nil
+}
+
+// Tensor returns the tensor named name and checks its size
+func (a *Artifact) Tensor(name string, size int) ([]float32, error) {
+	t, ok := a.Tensors[name]
+	if !ok {
+		return nil, fmt.Errorf("tensor %s not found in artifact", name)
+	}
+	if len(t) != size {
+		return nil, fmt.Errorf("tensor %s size mismatch: %d:%d", name, size, len(t))
+	}
+	return t, nil
+}
+
+func sortedKeys[V any](m map[string]V) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func writeUint32(w io.Writer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.Write(b[:])
+}
+
+func writeName(buf *bytes.Buffer, name string) {
+	writeUint32(buf, uint32(len(name)))
+	buf.WriteString(name)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// artifactZeros is read after an error, the length of the corrupted data is
+// never allocated
+var artifactZeros [8]byte
+
+type artifactReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *artifactReader) next(n int) []byte {
+	if r.err != nil || n < 0 || r.off+n > len(r.data) {
+		if r.err == nil {
+			r.err = fmt.Errorf("artifact truncated at %d", r.off)
+		}
+		if n >= 0 && n <= len(artifactZeros) {
+			return artifactZeros[:n]
+		}
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *artifactReader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.next(4))
+}
+
+func (r *artifactReader) name() string {
+	name := string(r.next(int(r.uint32())))
+	if pad := r.off % 4; pad != 0 {
+		r.next(4 - pad)
+	}
+	return name
+}
+
+func (r *artifactReader) float32s(n int) []float32 {
+	b := r.next(n * 4)
+	if r.err != nil {
+		return nil
+	}
+	return utils.Float32sFromBytes(b)
+}
+
+func (r *artifactReader) int8s(n int) []float32 {
+	scale := math.Float32frombits(r.uint32())
+	b := r.next(n)
+	if pad := r.off % 4; pad != 0 {
+		r.next(4 - pad)
+	}
+	if r.err != nil {
+		return nil
+	}
+	q := make([]int8, n)
+	for i := range b {
+		q[i] = int8(b[i])
+	}
+	return DequantizeInt8(scale, q)
+}
+
+// QuantizeInt8 quantizes t symmetrically: t[i] ~= scale * q[i]
+func QuantizeInt8(t []float32) (scale float32, q []int8) {
+	var maxAbs float32
+	for _, v := range t {
+		if v < 0 {
+			v = -v
+		}
+		if v > maxAbs {
+			maxAbs = v
+		}
+	}
+	q = make([]int8, len(t))
+	if maxAbs == 0 {
+		return 0, q
+	}
+	scale = maxAbs / 127
+	for i, v := range t {
+		q[i] = int8(math.Round(float64(v / scale)))
+	}
+	return
+}
+
+func DequantizeInt8(scale float32, q []int8) (t []float32) {
+	t = make([]float32, len(q))
+	for i, v := range q {
+		t[i] = scale * float32(v)
+	}
+	return
+}
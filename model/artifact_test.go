@@ -0,0 +1,85 @@
+package model_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/auxten/go-ctr/model"
+	"github.com/auxten/go-ctr/model/din"
+	"github.com/auxten/go-ctr/model/youtube"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestArtifact(t *testing.T) {
+	Convey("artifact roundtrip", t, func() {
+		a := model.NewArtifact()
+		a.Dims["d"] = 3
+		a.Tensors["odd"] = []float32{1, 2, 3}
+		a.Tensors["w"] = []float32{-1.5, 0, 2.25}
+		data, err := a.Marshal()
+		So(err, ShouldBeNil)
+
+		b, err := model.UnmarshalArtifact(data)
+		So(err, ShouldBeNil)
+		So(b.Dims, ShouldResemble, a.Dims)
+		So(b.Tensors, ShouldResemble, a.Tensors)
+		_, err = b.Tensor("w", 4)
+		So(err, ShouldNotBeNil)
+
+		a.QuantizeInt8 = true
+		qData, err := a.Marshal()
+		So(err, ShouldBeNil)
+		So(len(qData), ShouldBeLessThan, len(data))
+		q, err := model.UnmarshalArtifact(qData)
+		So(err, ShouldBeNil)
+		So(q.QuantizeInt8, ShouldBeTrue)
+		for name, tensor := range a.Tensors {
+			So(q.Tensors[name], ShouldHaveLength, len(tensor))
+			for i := range tensor {
+				So(q.Tensors[name][i], ShouldAlmostEqual, tensor[i], 0.02)
+			}
+		}
+
+		_, err = model.UnmarshalArtifact(data[:len(data)-1])
+		So(err, ShouldNotBeNil)
+		_, err = model.UnmarshalArtifact([]byte("json"))
+		So(err, ShouldNotBeNil)
+		// the corrupted length of a dim name
+		_, err = model.UnmarshalArtifact([]byte("CTRA\x02\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\xf0\xff\xff\xff"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("mmap din and youtube artifact", t, func() {
+		dir := t.TempDir()
+		dinNet := din.NewDinNet(5, 3, 7, 7, 5)
+		data, err := dinNet.MarshalArtifact()
+		So(err, ShouldBeNil)
+		a, err := model.UnmarshalArtifact(data)
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "din.ctra")
+		So(a.WriteArtifact(path), ShouldBeNil)
+
+		mapped, err := model.MmapArtifact(path)
+		So(err, ShouldBeNil)
+		defer mapped.Close()
+		loaded, err := din.NewDinNetFromArtifact(mapped)
+		So(err, ShouldBeNil)
+		origin, _ := dinNet.Marshal()
+		got, _ := loaded.Marshal()
+		So(string(got), ShouldEqual, string(origin))
+
+		ytb := youtube.NewYoutubeDnn(5, 3, 7, 7, 5)
+		data, err = ytb.MarshalArtifact()
+		So(err, ShouldBeNil)
+		a, err = model.UnmarshalArtifact(data)
+		So(err, ShouldBeNil)
+		ytbLoaded, err := youtube.NewYoutubeDnnFromArtifact(a)
+		So(err, ShouldBeNil)
+		origin, _ = ytb.Marshal()
+		got, _ = ytbLoaded.Marshal()
+		So(string(got), ShouldEqual, string(origin))
+
+		_, err = youtube.NewYoutubeDnnFromArtifact(model.NewArtifact())
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -1,9 +1,23 @@
 package model
 
 import (
+	"fmt"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
 	G "gorgonia.org/gorgonia"
 )
 
+// ObjectiveCost32 is the cost of the labels of objective, MSE32 for
+// rcmd.ObjectiveRegression else BinaryCrossEntropy32. The output of the
+// models is sigmoid, so the regression labels should be scaled to [0, 1],
+// e.g. the rating 1-5 / 5.
+func ObjectiveCost32(objective rcmd.Objective, yPred, yTrue *G.Node) *G.Node {
+	if objective == rcmd.ObjectiveRegression {
+		return MSE32(yPred, yTrue)
+	}
+	return BinaryCrossEntropy32(yPred, yTrue)
+}
+
 // BinaryCrossEntropy32 calculates the binary cross entropy cost
 // loss formula: -y_true * log(y_pred) - (1 - y_true) * log(1 - y_pred)
 func BinaryCrossEntropy32(yPred, yTrue *G.Node) *G.Node {
@@ -27,3 +41,57 @@ func RMS32(yPred, yTrue *G.Node) *G.Node {
 	cost := G.Must(G.Sqrt(G.Must(G.Mean(G.Must(G.Square(G.Must(G.Sub(yPred, yTrue))))))))
 	return cost
 }
+
+// GraphLoss is a rcmd.Loss building its own cost node, for the losses
+// Cost32 does not know
+type GraphLoss interface {
+	rcmd.Loss
+	Cost32(yPred, yTrue *G.Node) *G.Node
+}
+
+// Cost32 returns the mean cost node of loss, the ObjectiveCost32 of
+// rcmd.LabelObjective if loss is nil
+func Cost32(loss rcmd.Loss, yPred, yTrue *G.Node) (cost *G.Node, err error) {
+	var (
+		one  = G.NewConstant(float32(1.0))
+		half = G.NewConstant(float32(0.5))
+		mean = func(n *G.Node) *G.Node { return G.Must(G.Mean(n)) }
+	)
+	switch l := loss.(type) {
+	case nil:
+		return ObjectiveCost32(rcmd.LabelObjective, yPred, yTrue), nil
+	case GraphLoss:
+		return l.Cost32(yPred, yTrue), nil
+	case rcmd.LogLoss:
+		return BinaryCrossEntropy32(yPred, yTrue), nil
+	case rcmd.HingeLoss:
+		// max(0, x) = (x + |x|) / 2 of x = 1 - (2y - 1)(2p - 1)
+		two := G.NewConstant(float32(2.0))
+		t := G.Must(G.Sub(G.Must(G.Mul(two, yTrue)), one))
+		m := G.Must(G.Sub(G.Must(G.Mul(two, yPred)), one))
+		x := G.Must(G.Sub(one, G.Must(G.HadamardProd(t, m))))
+		return mean(G.Must(G.Mul(half, G.Must(G.Add(x, G.Must(G.Abs(x))))))), nil
+	case rcmd.FocalLoss:
+		var (
+			eps   = G.NewConstant(float32(1e-7))
+			gamma = G.NewConstant(l.Gamma)
+			alpha = G.NewConstant(l.Alpha)
+			beta  = G.NewConstant(1 - l.Alpha)
+			q     = G.Must(G.Add(yPred, eps))
+			notQ  = G.Must(G.Add(G.Must(G.Sub(one, yPred)), eps))
+		)
+		pos := G.Must(G.HadamardProd(G.Must(G.Pow(notQ, gamma)), G.Must(G.Log(q))))
+		pos = G.Must(G.HadamardProd(G.Must(G.Mul(alpha, pos)), yTrue))
+		neg := G.Must(G.HadamardProd(G.Must(G.Pow(q, gamma)), G.Must(G.Log(notQ))))
+		neg = G.Must(G.HadamardProd(G.Must(G.Mul(beta, neg)), G.Must(G.Sub(one, yTrue))))
+		return G.Must(G.Neg(mean(G.Must(G.Add(pos, neg))))), nil
+	case rcmd.HuberLoss:
+		// the squared part is min(|d|, delta) = (|d| + delta - ||d| - delta|) / 2
+		delta := G.NewConstant(l.Delta)
+		a := G.Must(G.Abs(G.Must(G.Sub(yPred, yTrue))))
+		sq := G.Must(G.Mul(half, G.Must(G.Sub(G.Must(G.Add(a, delta)), G.Must(G.Abs(G.Must(G.Sub(a, delta))))))))
+		lin := G.Must(G.Sub(a, sq))
+		return mean(G.Must(G.Add(G.Must(G.Mul(half, G.Must(G.Square(sq)))), G.Must(G.Mul(delta, lin))))), nil
+	}
+	return nil, fmt.Errorf("loss %s is not a GraphLoss", loss.Name())
+}
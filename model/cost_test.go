@@ -3,6 +3,7 @@ package model
 import (
 	"testing"
 
+	rcmd "github.com/auxten/go-ctr/recommend"
 	. "github.com/smartystreets/goconvey/convey"
 	G "gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
@@ -88,3 +89,26 @@ func TestRMS32(t *testing.T) {
 		So(output.Value().Data(), ShouldAlmostEqual, 0.0894427, 0.000001)
 	})
 }
+
+func TestCost32(t *testing.T) {
+	Convey("graph costs match the losses", t, func() {
+		pred := []float32{0.1, 0.6, 0.9, 0.3, 0.97, 0.02}
+		label := []float32{0, 1, 1, 1, 0, 0}
+		for _, loss := range []rcmd.Loss{
+			rcmd.LogLoss{},
+			rcmd.HingeLoss{},
+			rcmd.NewFocalLoss(),
+			rcmd.HuberLoss{Delta: 0.5},
+		} {
+			g := G.NewGraph()
+			yPred := G.NodeFromAny(g, tensor.New(tensor.WithShape(len(pred), 1), tensor.WithBacking(append([]float32(nil), pred...))), G.WithName("yPred"))
+			yTrue := G.NodeFromAny(g, tensor.New(tensor.WithShape(len(pred), 1), tensor.WithBacking(append([]float32(nil), label...))), G.WithName("yTrue"))
+			output, err := Cost32(loss, yPred, yTrue)
+			So(err, ShouldBeNil)
+			m := G.NewTapeMachine(g)
+			So(m.RunAll(), ShouldBeNil)
+			m.Close()
+			So(output.Value().Data(), ShouldAlmostEqual, rcmd.MeanLoss(loss, pred, label), 0.0001)
+		}
+	})
+}
@@ -84,6 +84,62 @@ func NewDinNetFromJson(data []byte) (din *DinNet, err error) {
 	if err = json.Unmarshal(data, &m); err != nil {
 		return
 	}
+	return newDinNetFromModel(&m), nil
+}
+
+// MarshalArtifact encodes the model as a model.Artifact, see NewDinNetFromArtifact
+func (din *DinNet) MarshalArtifact() (data []byte, err error) {
+	return din.Artifact().Marshal()
+}
+
+// Artifact returns the weights of the model as a model.Artifact, set
+// QuantizeInt8 of it before Marshal for a smaller artifact.
+func (din *DinNet) Artifact() (a *model.Artifact) {
+	a = model.NewArtifact()
+	a.Dims["uProfileDim"] = din.uProfileDim
+	a.Dims["uBehaviorSize"] = din.uBehaviorSize
+	a.Dims["uBehaviorDim"] = din.uBehaviorDim
+	a.Dims["iFeatureDim"] = din.iFeatureDim
+	a.Dims["cFeatureDim"] = din.cFeatureDim
+	a.Tensors["mlp0"] = din.mlp0.Value().Data().([]float32)
+	a.Tensors["mlp1"] = din.mlp1.Value().Data().([]float32)
+	a.Tensors["mlp2"] = din.mlp2.Value().Data().([]float32)
+	a.Tensors["att0"] = din.att0.Value().Data().([]float32)
+	return
+}
+
+// NewDinNetFromArtifact creates the model using the tensors of a in place,
+// a should not be closed before the model is dropped.
+func NewDinNetFromArtifact(a *model.Artifact) (din *DinNet, err error) {
+	var m dinModel
+	for name, dim := range map[string]*int{
+		"uProfileDim":   &m.UProfileDim,
+		"uBehaviorSize": &m.UBehaviorSize,
+		"uBehaviorDim":  &m.UBehaviorDim,
+		"iFeatureDim":   &m.IFeatureDim,
+		"cFeatureDim":   &m.CFeatureDim,
+	} {
+		if *dim, err = a.Dim(name); err != nil {
+			return
+		}
+	}
+	inputDim := m.UProfileDim + m.UBehaviorDim + m.IFeatureDim + m.CFeatureDim
+	if m.Mlp0, err = a.Tensor("mlp0", inputDim*mlp0_1); err != nil {
+		return
+	}
+	if m.Mlp1, err = a.Tensor("mlp1", mlp0_1*mlp1_2); err != nil {
+		return
+	}
+	if m.Mlp2, err = a.Tensor("mlp2", mlp1_2); err != nil {
+		return
+	}
+	if m.Att0, err = a.Tensor("att0", m.UBehaviorSize); err != nil {
+		return
+	}
+	return newDinNetFromModel(&m), nil
+}
+
+func newDinNetFromModel(m *dinModel) (din *DinNet) {
 	var (
 		g             = G.NewGraph()
 		uProfileDim   = m.UProfileDim
@@ -0,0 +1,297 @@
+package esmm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/auxten/go-ctr/model"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	log "github.com/sirupsen/logrus"
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// ESMM is the Entire Space Multi-task Model: the tasks share the bottom
+// layer and have their own heads, the head of task k predicts its label
+// given the label of task k-1, e.g. pCVR given the click. Training on the
+// entire space fits the product of the heads up to task k, e.g. pCTCVR, to
+// the labels of the tasks up to k all set, so the conversion head learns
+// from all the impressions instead of the clicked ones only.
+//
+// Predict returns the score combined by Combine in the first column and
+// the head scores, e.g. pCTR and pCVR, in the next ones.
+type ESMM struct {
+	Tasks      int `json:"tasks"`
+	InputDim   int `json:"inputDim"`
+	Hidden     int `json:"hidden"`
+	HeadHidden int `json:"headHidden"`
+
+	Bottom     []float32 `json:"bottom"`
+	BottomBias []float32 `json:"bottomBias"`
+	Heads      []Head    `json:"heads"`
+
+	// Combine is ProductScore if nil, it is not marshaled
+	Combine rcmd.ScoreFormula `json:"-"`
+}
+
+// Head is the weights of the tower of a task
+type Head struct {
+	Hidden     []float32 `json:"hidden"`
+	HiddenBias []float32 `json:"hiddenBias"`
+	Out        []float32 `json:"out"`
+	OutBias    float32   `json:"outBias"`
+}
+
+// Fitter trains an ESMM on the TrainSample.Labels of the tasks, or on Y as
+// a single task if the samples have no Labels
+type Fitter struct {
+	Hidden     int
+	HeadHidden int
+	Epochs     int
+	BatchSize  int
+	LearnRate  float64
+	Combine    rcmd.ScoreFormula
+	// Loss of every task, the log loss if nil
+	Loss rcmd.Loss
+	// Seed of the weight init
+	Seed int64
+}
+
+func NewFitter() *Fitter {
+	return &Fitter{
+		Hidden:     64,
+		HeadHidden: 32,
+		Epochs:     10,
+		BatchSize:  100,
+		LearnRate:  0.01,
+		Seed:       1,
+	}
+}
+
+// SetSeed implements rcmd.SeedFitter
+func (fit *Fitter) SetSeed(seed int64) {
+	fit.Seed = seed
+}
+
+func NewESMMFromJson(data []byte) (m *ESMM, err error) {
+	m = &ESMM{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if len(m.Bottom) != m.InputDim*m.Hidden || len(m.Heads) != m.Tasks {
+		return nil, fmt.Errorf("esmm weights mismatch the dims %d x %d of %d tasks", m.InputDim, m.Hidden, m.Tasks)
+	}
+	return
+}
+
+func (m *ESMM) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (fit *Fitter) SetLoss(loss rcmd.Loss) {
+	fit.Loss = loss
+}
+
+func (fit *Fitter) Fit(sample *rcmd.TrainSample) (pred rcmd.PredictAbstract, err error) {
+	tasks, labels := sample.Tasks, sample.Labels
+	if tasks == 0 {
+		tasks, labels = 1, sample.Y
+	}
+	if sample.Rows == 0 {
+		return nil, fmt.Errorf("no sample to fit")
+	}
+	loss := fit.Loss
+	if loss == nil {
+		loss = rcmd.LogLoss{}
+	}
+	batchSize := fit.BatchSize
+	if batchSize <= 0 || batchSize > sample.Rows {
+		batchSize = sample.Rows
+	}
+
+	// the GlorotN of gorgonia is seeded by the time
+	rnd := rand.New(rand.NewSource(fit.Seed))
+	glorotN := func(_ tensor.Dtype, s ...int) interface{} {
+		std := math.Sqrt(2 / float64(s[0]+s[1]))
+		w := make([]float32, s[0]*s[1])
+		for i := range w {
+			w[i] = float32(rnd.NormFloat64() * std)
+		}
+		return w
+	}
+	var (
+		g     = G.NewGraph()
+		dims  = [3]int{sample.XCols, fit.Hidden, fit.HeadHidden}
+		x     = G.NewMatrix(g, model.DT, G.WithShape(batchSize, dims[0]), G.WithName("x"))
+		w0    = G.NewMatrix(g, model.DT, G.WithShape(dims[0], dims[1]), G.WithName("bottom"), G.WithInit(glorotN))
+		b0    = G.NewMatrix(g, model.DT, G.WithShape(1, dims[1]), G.WithName("bottomBias"), G.WithInit(G.Zeroes()))
+		ys    = make([]*G.Node, tasks)
+		heads = make([][4]*G.Node, tasks)
+		learn = G.Nodes{w0, b0}
+		outs  = make([]*G.Node, tasks)
+		chain *G.Node
+		cost  *G.Node
+		dense = func(in, w, b *G.Node) *G.Node {
+			return G.Must(G.Sigmoid(G.Must(G.BroadcastAdd(G.Must(G.Mul(in, w)), b, nil, []byte{0}))))
+		}
+	)
+	bottom := dense(x, w0, b0)
+	for k := 0; k < tasks; k++ {
+		name := fmt.Sprintf("head%d", k)
+		heads[k] = [4]*G.Node{
+			G.NewMatrix(g, model.DT, G.WithShape(dims[1], dims[2]), G.WithName(name+"Hidden"), G.WithInit(glorotN)),
+			G.NewMatrix(g, model.DT, G.WithShape(1, dims[2]), G.WithName(name+"HiddenBias"), G.WithInit(G.Zeroes())),
+			G.NewMatrix(g, model.DT, G.WithShape(dims[2], 1), G.WithName(name+"Out"), G.WithInit(glorotN)),
+			G.NewMatrix(g, model.DT, G.WithShape(1, 1), G.WithName(name+"OutBias"), G.WithInit(G.Zeroes())),
+		}
+		learn = append(learn, heads[k][:]...)
+		outs[k] = dense(dense(bottom, heads[k][0], heads[k][1]), heads[k][2], heads[k][3])
+		if chain == nil {
+			chain = outs[k]
+		} else {
+			chain = G.Must(G.HadamardProd(chain, outs[k]))
+		}
+		ys[k] = G.NewMatrix(g, model.DT, G.WithShape(batchSize, 1), G.WithName(fmt.Sprintf("y%d", k)))
+		var taskCost *G.Node
+		if taskCost, err = model.Cost32(loss, chain, ys[k]); err != nil {
+			return
+		}
+		if cost == nil {
+			cost = taskCost
+		} else {
+			cost = G.Must(G.Add(cost, taskCost))
+		}
+	}
+	if _, err = G.Grad(cost, learn...); err != nil {
+		log.Errorf("esmm grad error: %v", err)
+		return
+	}
+	vm := G.NewTapeMachine(g, G.BindDualValues(learn...))
+	defer vm.Close()
+	solver := G.NewAdamSolver(G.WithLearnRate(fit.LearnRate), G.WithBatchSize(float64(batchSize)))
+
+	var (
+		xBatch  = make([]float32, batchSize*dims[0])
+		yBatch  = make([][]float32, tasks)
+		batches = (sample.Rows + batchSize - 1) / batchSize
+	)
+	for k := range yBatch {
+		yBatch[k] = make([]float32, batchSize)
+	}
+	for epoch := 0; epoch < fit.Epochs; epoch++ {
+		var epochCost float32
+		for b := 0; b < batches; b++ {
+			// the last batch is filled with the first rows
+			for i := 0; i < batchSize; i++ {
+				row := (b*batchSize + i) % sample.Rows
+				copy(xBatch[i*dims[0]:(i+1)*dims[0]], sample.X[row*dims[0]:(row+1)*dims[0]])
+				// the chained label of task k is set if the labels up to k are
+				chained := float32(1)
+				for k := 0; k < tasks; k++ {
+					if labels[row*tasks+k] <= 0.5 {
+						chained = 0
+					}
+					yBatch[k][i] = chained
+				}
+			}
+			if err = G.Let(x, tensor.New(tensor.WithShape(batchSize, dims[0]), tensor.WithBacking(xBatch))); err != nil {
+				return
+			}
+			for k := range ys {
+				if err = G.Let(ys[k], tensor.New(tensor.WithShape(batchSize, 1), tensor.WithBacking(yBatch[k]))); err != nil {
+					return
+				}
+			}
+			if err = vm.RunAll(); err != nil {
+				log.Errorf("esmm epoch %d batch %d error: %v", epoch, b, err)
+				return
+			}
+			if err = solver.Step(G.NodesToValueGrads(learn)); err != nil {
+				log.Errorf("esmm epoch %d batch %d solver error: %v", epoch, b, err)
+				return
+			}
+			epochCost += cost.Value().Data().(float32)
+			rcmd.ReportProgress(rcmd.Progress{
+				Stage:   rcmd.ProgressFit,
+				Epoch:   epoch + 1,
+				Epochs:  fit.Epochs,
+				Batch:   b + 1,
+				Batches: batches,
+				Samples: (epoch*batches + b + 1) * batchSize,
+				Loss:    float64(cost.Value().Data().(float32)),
+			})
+			vm.Reset()
+		}
+		log.Debugf("esmm epoch %d cost %v", epoch, epochCost/float32(batches))
+	}
+
+	weights := func(n *G.Node) []float32 {
+		return append([]float32(nil), n.Value().Data().([]float32)...)
+	}
+	m := &ESMM{
+		Tasks:      tasks,
+		InputDim:   dims[0],
+		Hidden:     dims[1],
+		HeadHidden: dims[2],
+		Bottom:     weights(w0),
+		BottomBias: weights(b0),
+		Heads:      make([]Head, tasks),
+		Combine:    fit.Combine,
+	}
+	for k, h := range heads {
+		m.Heads[k] = Head{
+			Hidden:     weights(h[0]),
+			HiddenBias: weights(h[1]),
+			Out:        weights(h[2]),
+			OutBias:    weights(h[3])[0],
+		}
+	}
+	return m, nil
+}
+
+// Predict returns the combined score and the head scores of every row of X
+func (m *ESMM) Predict(X tensor.Tensor) tensor.Tensor {
+	var (
+		rows    = X.Shape()[0]
+		data    = X.Data().([]float32)
+		cols    = 1 + m.Tasks
+		y       = make([]float32, rows*cols)
+		bottom  = make([]float32, m.Hidden)
+		hidden  = make([]float32, m.HeadHidden)
+		combine = m.Combine
+	)
+	if combine == nil {
+		combine = rcmd.ProductScore
+	}
+	for i := 0; i < rows; i++ {
+		dense(data[i*m.InputDim:(i+1)*m.InputDim], m.Bottom, m.BottomBias, bottom)
+		tasks := y[i*cols+1 : (i+1)*cols]
+		for k, h := range m.Heads {
+			dense(bottom, h.Hidden, h.HiddenBias, hidden)
+			var out [1]float32
+			dense(hidden, h.Out, []float32{h.OutBias}, out[:])
+			tasks[k] = out[0]
+		}
+		y[i*cols] = combine(tasks)
+	}
+	return tensor.New(tensor.WithShape(rows, cols), tensor.WithBacking(y))
+}
+
+// dense sets out to sigmoid(in * w + b), w is len(in) x len(out) row-major
+func dense(in, w, b, out []float32) {
+	copy(out, b)
+	for i, v := range in {
+		if v == 0 {
+			continue
+		}
+		row := w[i*len(out) : (i+1)*len(out)]
+		for j := range out {
+			out[j] += v * row[j]
+		}
+	}
+	for j, v := range out {
+		out[j] = float32(1 / (1 + math.Exp(-float64(v))))
+	}
+}
@@ -0,0 +1,76 @@
+package esmm
+
+import (
+	"math/rand"
+	"testing"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+func TestESMM(t *testing.T) {
+	Convey("click and conversion", t, func() {
+		// clicked if x0 is set, converted after the click if x1 is set
+		const rows, cols = 400, 3
+		rnd := rand.New(rand.NewSource(1))
+		sample := &rcmd.TrainSample{Rows: rows, XCols: cols, Tasks: 2}
+		for i := 0; i < rows; i++ {
+			x0, x1 := float32(rnd.Intn(2)), float32(rnd.Intn(2))
+			sample.X = append(sample.X, x0, x1, rnd.Float32())
+			sample.Y = append(sample.Y, x0)
+			sample.Labels = append(sample.Labels, x0, x0*x1)
+		}
+		fit := NewFitter()
+		fit.Hidden, fit.HeadHidden, fit.Epochs, fit.BatchSize = 8, 4, 60, 50
+		pred, err := fit.Fit(sample)
+		So(err, ShouldBeNil)
+
+		X := tensor.New(tensor.WithShape(3, cols), tensor.WithBacking([]float32{
+			1, 1, 0.5,
+			1, 0, 0.5,
+			0, 1, 0.5,
+		}))
+		y := pred.Predict(X)
+		So(y.Shape(), ShouldResemble, tensor.Shape{3, 3})
+		at := func(i, j int) float32 {
+			v, _ := y.At(i, j)
+			return v.(float32)
+		}
+		// pCTR
+		So(at(0, 1), ShouldBeGreaterThan, 0.8)
+		So(at(2, 1), ShouldBeLessThan, 0.2)
+		// pCVR
+		So(at(0, 2), ShouldBeGreaterThan, at(1, 2))
+		// pCTCVR
+		So(at(0, 0), ShouldAlmostEqual, at(0, 1)*at(0, 2), 1e-6)
+		So(at(0, 0), ShouldBeGreaterThan, at(1, 0))
+		So(at(0, 0), ShouldBeGreaterThan, at(2, 0))
+
+		Convey("marshal and combine", func() {
+			data, err := pred.(*ESMM).Marshal()
+			So(err, ShouldBeNil)
+			m, err := NewESMMFromJson(data)
+			So(err, ShouldBeNil)
+			m.Combine = rcmd.WeightedScore(1, 0)
+			y2 := m.Predict(X)
+			v, _ := y2.At(1, 0)
+			So(v, ShouldEqual, at(1, 1))
+		})
+
+		Convey("focal loss", func() {
+			fitSeeded := func() []float32 {
+				pred, err := fit.Fit(sample)
+				So(err, ShouldBeNil)
+				return pred.Predict(X).Data().([]float32)
+			}
+			logLoss := fitSeeded()
+			So(fitSeeded(), ShouldResemble, logLoss)
+
+			fit.SetLoss(rcmd.NewFocalLoss())
+			focal := fitSeeded()
+			So(focal[1], ShouldBeGreaterThan, 0.5)
+			So(focal, ShouldNotResemble, logLoss)
+		})
+	})
+}
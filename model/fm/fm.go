@@ -0,0 +1,187 @@
+package fm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"gorgonia.org/tensor"
+)
+
+// FM is the factorization machine of the degree 2: the margin is
+// Bias + sum(W[i] * x[i]) + sum(<V[i], V[j]> * x[i] * x[j]) of i < j, the
+// logit of the score for ObjectiveBinary. It is the logistic regression if
+// Factors is 0.
+type FM struct {
+	Objective string    `json:"objective"`
+	Features  int       `json:"features"`
+	Factors   int       `json:"factors"`
+	Bias      float32   `json:"bias"`
+	W         []float32 `json:"w"`
+	// V is Features x Factors row-major
+	V []float32 `json:"v,omitempty"`
+}
+
+// Fitter trains a FM by SGD on the loss of rcmd.LabelObjective, the log
+// loss or the squared error. It is a baseline to sanity check the feature
+// pipeline with before debugging the deep models.
+type Fitter struct {
+	Factors   int
+	Epochs    int
+	LearnRate float64
+	// L2 is the L2 regularization of W and V
+	L2 float64
+	// InitStd is the stddev of the initial V
+	InitStd float64
+	Seed    int64
+}
+
+// NewFitter returns the Fitter of a FM of 8 factors
+func NewFitter() *Fitter {
+	return &Fitter{
+		Factors:   8,
+		Epochs:    10,
+		LearnRate: 0.05,
+		L2:        1e-4,
+		InitStd:   0.01,
+		Seed:      1,
+	}
+}
+
+// NewLRFitter returns the Fitter of the logistic regression, or the linear
+// regression for ObjectiveRegression
+func NewLRFitter() *Fitter {
+	fit := NewFitter()
+	fit.Factors = 0
+	return fit
+}
+
+// SetSeed implements rcmd.SeedFitter
+func (fit *Fitter) SetSeed(seed int64) {
+	fit.Seed = seed
+}
+
+func NewFMFromJson(data []byte) (m *FM, err error) {
+	m = &FM{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if len(m.W) != m.Features || len(m.V) != m.Features*m.Factors {
+		return nil, fmt.Errorf("fm weights mismatch the dims %d x %d", m.Features, m.Factors)
+	}
+	return
+}
+
+func (m *FM) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (fit *Fitter) Fit(sample *rcmd.TrainSample) (pred rcmd.PredictAbstract, err error) {
+	if sample.Rows == 0 {
+		return nil, fmt.Errorf("no sample to fit")
+	}
+	var (
+		rows, cols = sample.Rows, sample.XCols
+		binary     = rcmd.LabelObjective == rcmd.ObjectiveBinary
+		rnd        = rand.New(rand.NewSource(fit.Seed))
+		lr, l2     = float32(fit.LearnRate), float32(fit.L2)
+		sum        = make([]float32, fit.Factors)
+		m          = &FM{
+			Objective: rcmd.LabelObjective.String(),
+			Features:  cols,
+			Factors:   fit.Factors,
+			W:         make([]float32, cols),
+			V:         make([]float32, cols*fit.Factors),
+		}
+	)
+	for i := range m.V {
+		m.V[i] = float32(rnd.NormFloat64() * fit.InitStd)
+	}
+	for epoch := 0; epoch < fit.Epochs; epoch++ {
+		var loss float64
+		for _, r := range rnd.Perm(rows) {
+			x, y := sample.X[r*cols:(r+1)*cols], sample.Y[r]
+			margin := m.margin(x, sum)
+			// the gradient of the loss by the margin
+			var g float32
+			if binary {
+				p := 1 / (1 + math.Exp(-float64(margin)))
+				g = float32(p) - y
+				q := math.Min(math.Max(p, 1e-7), 1-1e-7)
+				loss -= float64(y)*math.Log(q) + float64(1-y)*math.Log(1-q)
+			} else {
+				g = margin - y
+				loss += float64(g * g)
+			}
+
+			m.Bias -= lr * g
+			for i, v := range x {
+				if v == 0 {
+					continue
+				}
+				m.W[i] -= lr * (g*v + l2*m.W[i])
+				vi := m.V[i*m.Factors : (i+1)*m.Factors]
+				for f, s := range sum {
+					vi[f] -= lr * (g*v*(s-vi[f]*v) + l2*vi[f])
+				}
+			}
+		}
+		rcmd.ReportProgress(rcmd.Progress{
+			Stage:   rcmd.ProgressFit,
+			Epoch:   epoch + 1,
+			Epochs:  fit.Epochs,
+			Samples: (epoch + 1) * rows,
+			Loss:    loss / float64(rows),
+			Model:   m,
+		})
+	}
+	return m, nil
+}
+
+// margin returns the margin of the row x, sum is set to the sums of the
+// factors weighted by x
+func (m *FM) margin(x, sum []float32) float32 {
+	for f := range sum {
+		sum[f] = 0
+	}
+	var (
+		margin = m.Bias
+		square float32
+	)
+	for i, v := range x {
+		if v == 0 {
+			continue
+		}
+		margin += m.W[i] * v
+		for f, w := range m.V[i*m.Factors : (i+1)*m.Factors] {
+			sum[f] += w * v
+			square += w * w * v * v
+		}
+	}
+	for _, s := range sum {
+		square -= s * s
+	}
+	return margin - square/2
+}
+
+// Predict returns the probability of every row of X for ObjectiveBinary,
+// or else the value
+func (m *FM) Predict(X tensor.Tensor) tensor.Tensor {
+	var (
+		rows = X.Shape()[0]
+		data = X.Data().([]float32)
+		sum  = make([]float32, m.Factors)
+		y    = make([]float32, rows)
+	)
+	for i := range y {
+		margin := m.margin(data[i*m.Features:(i+1)*m.Features], sum)
+		if m.Objective == rcmd.ObjectiveRegression.String() {
+			y[i] = margin
+		} else {
+			y[i] = float32(1 / (1 + math.Exp(-float64(margin))))
+		}
+	}
+	return tensor.New(tensor.WithShape(rows, 1), tensor.WithBacking(y))
+}
@@ -0,0 +1,79 @@
+package fm
+
+import (
+	"math/rand"
+	"testing"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// interactionSample is the one-hot user and item, liked if both are odd or
+// both are even, which is not linearly separable
+func interactionSample() *rcmd.TrainSample {
+	const rows, users, items = 2000, 6, 6
+	rnd := rand.New(rand.NewSource(1))
+	sample := &rcmd.TrainSample{Rows: rows, XCols: users + items}
+	for r := 0; r < rows; r++ {
+		u, i := rnd.Intn(users), rnd.Intn(items)
+		x := make([]float32, users+items)
+		x[u], x[users+i] = 1, 1
+		sample.X = append(sample.X, x...)
+		if u%2 == i%2 {
+			sample.Y = append(sample.Y, 1)
+		} else {
+			sample.Y = append(sample.Y, 0)
+		}
+	}
+	return sample
+}
+
+func TestFM(t *testing.T) {
+	Convey("interaction", t, func() {
+		sample := interactionSample()
+
+		fit := NewFitter()
+		fit.Epochs = 20
+		pred, err := fit.Fit(sample)
+		So(err, ShouldBeNil)
+		m, err := rcmd.Evaluate(pred, sample)
+		So(err, ShouldBeNil)
+		So(m.AUC, ShouldBeGreaterThan, 0.99)
+
+		lr, err := NewLRFitter().Fit(sample)
+		So(err, ShouldBeNil)
+		mLR, err := rcmd.Evaluate(lr, sample)
+		So(err, ShouldBeNil)
+		So(mLR.AUC, ShouldBeLessThan, 0.6)
+
+		Convey("marshal", func() {
+			data, err := pred.(*FM).Marshal()
+			So(err, ShouldBeNil)
+			m2, err := NewFMFromJson(data)
+			So(err, ShouldBeNil)
+			mm, err := rcmd.Evaluate(m2, sample)
+			So(err, ShouldBeNil)
+			So(mm.LogLoss, ShouldEqual, m.LogLoss)
+		})
+	})
+
+	Convey("linear regression", t, func() {
+		defer func(o rcmd.Objective) { rcmd.LabelObjective = o }(rcmd.LabelObjective)
+		rcmd.LabelObjective = rcmd.ObjectiveRegression
+		const rows = 500
+		rnd := rand.New(rand.NewSource(1))
+		sample := &rcmd.TrainSample{Rows: rows, XCols: 2}
+		for r := 0; r < rows; r++ {
+			a, b := rnd.Float32(), rnd.Float32()
+			sample.X = append(sample.X, a, b)
+			sample.Y = append(sample.Y, 1+2*a-b)
+		}
+		fit := NewLRFitter()
+		fit.Epochs = 30
+		pred, err := fit.Fit(sample)
+		So(err, ShouldBeNil)
+		m, err := rcmd.Evaluate(pred, sample)
+		So(err, ShouldBeNil)
+		So(m.RMSE, ShouldBeLessThan, 0.05)
+	})
+}
@@ -0,0 +1,331 @@
+package gbdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"gorgonia.org/tensor"
+)
+
+// GBDT is a gradient-boosted trees model, the sum of the Trees and
+// BaseScore is the margin, the logit of the score for ObjectiveBinary
+type GBDT struct {
+	Objective string  `json:"objective"`
+	Features  int     `json:"features"`
+	BaseScore float32 `json:"baseScore"`
+	Trees     []Tree  `json:"trees"`
+}
+
+// Tree is a binary tree, Nodes[0] is the root
+type Tree struct {
+	Nodes []Node `json:"nodes"`
+}
+
+// Node is a leaf of Value if Feature < 0, or else the rows of the Feature
+// <= Threshold go to the Left node and the others to the Right one
+type Node struct {
+	Feature   int     `json:"f"`
+	Threshold float32 `json:"t,omitempty"`
+	Left      int     `json:"l,omitempty"`
+	Right     int     `json:"r,omitempty"`
+	Value     float32 `json:"v,omitempty"`
+}
+
+// Fitter trains a GBDT the XGBoost way: every tree fits the first and
+// second order gradients of the loss of rcmd.LabelObjective, the log loss
+// or the squared error, on the histograms of the features binned by
+// quantiles, regularized by Lambda and Gamma.
+type Fitter struct {
+	Trees     int
+	MaxDepth  int
+	LearnRate float64
+	// Lambda is the L2 regularization of the leaf values
+	Lambda float64
+	// Gamma is the min loss reduction to split
+	Gamma float64
+	// MinChildWeight is the min hessian sum of a child
+	MinChildWeight float64
+	// Bins is the max histogram bins of a feature, at most 256
+	Bins int
+	// Subsample is the rows sampled for every tree, 1 uses all
+	Subsample float64
+	Seed      int64
+}
+
+func NewFitter() *Fitter {
+	return &Fitter{
+		Trees:          100,
+		MaxDepth:       6,
+		LearnRate:      0.3,
+		Lambda:         1,
+		MinChildWeight: 1,
+		Bins:           64,
+		Subsample:      1,
+		Seed:           1,
+	}
+}
+
+// SetSeed implements rcmd.SeedFitter
+func (fit *Fitter) SetSeed(seed int64) {
+	fit.Seed = seed
+}
+
+func NewGBDTFromJson(data []byte) (m *GBDT, err error) {
+	m = &GBDT{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	for i, t := range m.Trees {
+		if len(t.Nodes) == 0 {
+			return nil, fmt.Errorf("gbdt tree %d is empty", i)
+		}
+		for _, n := range t.Nodes {
+			if n.Feature >= m.Features || n.Feature >= 0 &&
+				(n.Left <= 0 || n.Left >= len(t.Nodes) || n.Right <= 0 || n.Right >= len(t.Nodes)) {
+				return nil, fmt.Errorf("gbdt tree %d is broken", i)
+			}
+		}
+	}
+	return
+}
+
+func (m *GBDT) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// grower is the state of the training of a tree
+type grower struct {
+	*Fitter
+	cols int
+	bins []uint8
+	cuts [][]float32
+	g, h []float64
+	tree *Tree
+	// histogram buffers of the gradients and hessians
+	histG, histH []float64
+}
+
+func (fit *Fitter) Fit(sample *rcmd.TrainSample) (pred rcmd.PredictAbstract, err error) {
+	if sample.Rows == 0 {
+		return nil, fmt.Errorf("no sample to fit")
+	}
+	if fit.Bins < 2 || fit.Bins > 256 {
+		return nil, fmt.Errorf("gbdt bins %d out of [2, 256]", fit.Bins)
+	}
+	var (
+		rows, cols = sample.Rows, sample.XCols
+		binary     = rcmd.LabelObjective == rcmd.ObjectiveBinary
+		margin     = make([]float64, rows)
+		rnd        = rand.New(rand.NewSource(fit.Seed))
+		m          = &GBDT{Objective: rcmd.LabelObjective.String(), Features: cols}
+		gr         = &grower{
+			Fitter: fit,
+			cols:   cols,
+			g:      make([]float64, rows),
+			h:      make([]float64, rows),
+			histG:  make([]float64, fit.Bins),
+			histH:  make([]float64, fit.Bins),
+		}
+	)
+	gr.cuts, gr.bins = binFeatures(sample, fit.Bins)
+
+	var mean float64
+	for _, y := range sample.Y {
+		mean += float64(y)
+	}
+	mean /= float64(rows)
+	if binary {
+		mean = math.Min(math.Max(mean, 1e-6), 1-1e-6)
+		m.BaseScore = float32(math.Log(mean / (1 - mean)))
+	} else {
+		m.BaseScore = float32(mean)
+	}
+	for i := range margin {
+		margin[i] = float64(m.BaseScore)
+	}
+
+	all := make([]int, rows)
+	for i := range all {
+		all[i] = i
+	}
+	for t := 0; t < fit.Trees; t++ {
+		var loss float64
+		for i, y := range sample.Y {
+			if binary {
+				p := 1 / (1 + math.Exp(-margin[i]))
+				gr.g[i], gr.h[i] = p-float64(y), math.Max(p*(1-p), 1e-16)
+				q := math.Min(math.Max(p, 1e-7), 1-1e-7)
+				loss -= float64(y)*math.Log(q) + float64(1-y)*math.Log(1-q)
+			} else {
+				gr.g[i], gr.h[i] = margin[i]-float64(y), 1
+				loss += gr.g[i] * gr.g[i]
+			}
+		}
+
+		subset := all
+		if fit.Subsample > 0 && fit.Subsample < 1 {
+			subset = make([]int, 0, int(float64(rows)*fit.Subsample)+1)
+			for _, i := range all {
+				if rnd.Float64() < fit.Subsample {
+					subset = append(subset, i)
+				}
+			}
+		}
+		gr.tree = &Tree{}
+		gr.grow(subset, 0)
+		for i := range margin {
+			margin[i] += float64(gr.tree.value(sample.X[i*cols : (i+1)*cols]))
+		}
+		m.Trees = append(m.Trees, *gr.tree)
+		rcmd.ReportProgress(rcmd.Progress{
+			Stage:   rcmd.ProgressFit,
+			Epoch:   t + 1,
+			Epochs:  fit.Trees,
+			Samples: (t + 1) * rows,
+			Loss:    loss / float64(rows),
+			Model:   m,
+		})
+	}
+	return m, nil
+}
+
+// binFeatures returns the quantile cuts of every feature and the bin of
+// every value, the values <= cuts[f][b] are in the bins <= b
+func binFeatures(sample *rcmd.TrainSample, maxBins int) (cuts [][]float32, bins []uint8) {
+	var (
+		rows, cols = sample.Rows, sample.XCols
+		values     = make([]float32, rows)
+	)
+	cuts = make([][]float32, cols)
+	bins = make([]uint8, rows*cols)
+	for f := 0; f < cols; f++ {
+		for i := range values {
+			values[i] = sample.X[i*cols+f]
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		for b := 1; b < maxBins; b++ {
+			c := values[(rows-1)*b/maxBins]
+			if len(cuts[f]) == 0 || c > cuts[f][len(cuts[f])-1] {
+				cuts[f] = append(cuts[f], c)
+			}
+		}
+		// the max value is left for the last bin
+		if n := len(cuts[f]); n > 0 && cuts[f][n-1] == values[rows-1] {
+			cuts[f] = cuts[f][:n-1]
+		}
+		for i := 0; i < rows; i++ {
+			v := sample.X[i*cols+f]
+			bins[i*cols+f] = uint8(sort.Search(len(cuts[f]), func(b int) bool { return cuts[f][b] >= v }))
+		}
+	}
+	return
+}
+
+// grow adds the node of rows to the tree and returns its index
+func (gr *grower) grow(rows []int, depth int) int {
+	var sumG, sumH float64
+	for _, i := range rows {
+		sumG += gr.g[i]
+		sumH += gr.h[i]
+	}
+	idx := len(gr.tree.Nodes)
+	gr.tree.Nodes = append(gr.tree.Nodes, Node{
+		Feature: -1,
+		Value:   float32(-sumG / (sumH + gr.Lambda) * gr.LearnRate),
+	})
+	if depth >= gr.MaxDepth || len(rows) < 2 {
+		return idx
+	}
+
+	var (
+		bestGain    = gr.Gamma
+		bestFeature = -1
+		bestBin     int
+		parent      = sumG * sumG / (sumH + gr.Lambda)
+	)
+	for f := 0; f < gr.cols; f++ {
+		nCuts := len(gr.cuts[f])
+		if nCuts == 0 {
+			continue
+		}
+		histG, histH := gr.histG[:nCuts+1], gr.histH[:nCuts+1]
+		for b := range histG {
+			histG[b], histH[b] = 0, 0
+		}
+		for _, i := range rows {
+			b := gr.bins[i*gr.cols+f]
+			histG[b] += gr.g[i]
+			histH[b] += gr.h[i]
+		}
+		var gl, hl float64
+		for b := 0; b < nCuts; b++ {
+			gl += histG[b]
+			hl += histH[b]
+			g, h := sumG-gl, sumH-hl
+			if hl < gr.MinChildWeight || h < gr.MinChildWeight {
+				continue
+			}
+			gain := 0.5 * (gl*gl/(hl+gr.Lambda) + g*g/(h+gr.Lambda) - parent)
+			if gain > bestGain {
+				bestGain, bestFeature, bestBin = gain, f, b
+			}
+		}
+	}
+	if bestFeature < 0 {
+		return idx
+	}
+
+	var left, right []int
+	for _, i := range rows {
+		if int(gr.bins[i*gr.cols+bestFeature]) <= bestBin {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+	node := Node{Feature: bestFeature, Threshold: gr.cuts[bestFeature][bestBin]}
+	node.Left = gr.grow(left, depth+1)
+	node.Right = gr.grow(right, depth+1)
+	gr.tree.Nodes[idx] = node
+	return idx
+}
+
+// value returns the leaf value of the row x
+func (t *Tree) value(x []float32) float32 {
+	n := &t.Nodes[0]
+	for n.Feature >= 0 {
+		if x[n.Feature] <= n.Threshold {
+			n = &t.Nodes[n.Left]
+		} else {
+			n = &t.Nodes[n.Right]
+		}
+	}
+	return n.Value
+}
+
+// Predict returns the probability of every row of X for ObjectiveBinary,
+// or else the value
+func (m *GBDT) Predict(X tensor.Tensor) tensor.Tensor {
+	var (
+		rows = X.Shape()[0]
+		data = X.Data().([]float32)
+		y    = make([]float32, rows)
+	)
+	for i := range y {
+		x := data[i*m.Features : (i+1)*m.Features]
+		margin := m.BaseScore
+		for t := range m.Trees {
+			margin += m.Trees[t].value(x)
+		}
+		if m.Objective == rcmd.ObjectiveRegression.String() {
+			y[i] = margin
+		} else {
+			y[i] = float32(1 / (1 + math.Exp(-float64(margin))))
+		}
+	}
+	return tensor.New(tensor.WithShape(rows, 1), tensor.WithBacking(y))
+}
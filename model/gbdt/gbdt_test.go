@@ -0,0 +1,65 @@
+package gbdt
+
+import (
+	"math/rand"
+	"testing"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGBDT(t *testing.T) {
+	Convey("xor of two features", t, func() {
+		const rows, cols = 1000, 3
+		rnd := rand.New(rand.NewSource(1))
+		sample := &rcmd.TrainSample{Rows: rows, XCols: cols}
+		for i := 0; i < rows; i++ {
+			a, b := rnd.Float32(), rnd.Float32()
+			sample.X = append(sample.X, a, b, rnd.Float32())
+			if (a > 0.5) != (b > 0.5) {
+				sample.Y = append(sample.Y, 1)
+			} else {
+				sample.Y = append(sample.Y, 0)
+			}
+		}
+		fit := NewFitter()
+		fit.Trees, fit.MaxDepth, fit.Subsample = 20, 3, 0.8
+		pred, err := fit.Fit(sample)
+		So(err, ShouldBeNil)
+		m, err := rcmd.Evaluate(pred, sample)
+		So(err, ShouldBeNil)
+		So(m.AUC, ShouldBeGreaterThan, 0.99)
+		So(m.LogLoss, ShouldBeLessThan, 0.2)
+
+		Convey("marshal", func() {
+			data, err := pred.(*GBDT).Marshal()
+			So(err, ShouldBeNil)
+			m2, err := NewGBDTFromJson(data)
+			So(err, ShouldBeNil)
+			m3, err := rcmd.Evaluate(m2, sample)
+			So(err, ShouldBeNil)
+			So(m3.LogLoss, ShouldEqual, m.LogLoss)
+
+			_, err = NewGBDTFromJson([]byte(`{"features":1,"trees":[{"nodes":[{"f":0,"l":1,"r":2}]}]}`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("regression", t, func() {
+		defer func(o rcmd.Objective) { rcmd.LabelObjective = o }(rcmd.LabelObjective)
+		rcmd.LabelObjective = rcmd.ObjectiveRegression
+		const rows, cols = 500, 2
+		rnd := rand.New(rand.NewSource(1))
+		sample := &rcmd.TrainSample{Rows: rows, XCols: cols}
+		for i := 0; i < rows; i++ {
+			a, b := rnd.Float32(), rnd.Float32()
+			sample.X = append(sample.X, a, b)
+			sample.Y = append(sample.Y, 1+4*a*b)
+		}
+		pred, err := NewFitter().Fit(sample)
+		So(err, ShouldBeNil)
+		m, err := rcmd.Evaluate(pred, sample)
+		So(err, ShouldBeNil)
+		So(m.RMSE, ShouldBeLessThan, 0.1)
+	})
+}
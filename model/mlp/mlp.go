@@ -1,6 +1,9 @@
 package mlp
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/auxten/go-ctr/nn/base"
 	nn "github.com/auxten/go-ctr/nn/neural_network"
 	rcmd "github.com/auxten/go-ctr/recommend"
@@ -43,6 +46,136 @@ type SimpleMlpFitWrap struct {
 }
 
 func (fit *SimpleMlpFitWrap) Fit(trainSample *rcmd.TrainSample) (rcmd.PredictAbstract, error) {
+	sampleDense, yClass := sampleToDense(trainSample)
+
+	pred := fit.Model.Fit(sampleDense, yClass)
+
+	return &SimpleMlpPredWrap{
+		pred: pred.(base.Predicter),
+	}, nil
+}
+
+// SetSeed seeds the weight init and the shuffling of the MLP
+func (fit *SimpleMlpFitWrap) SetSeed(seed int64) {
+	fit.Model.RandomState = base.NewLockedSource(uint64(seed))
+}
+
+// SimpleMlpRegressorFitWrap fits the regression labels, e.g. the watch time
+// or the rating, by the squared loss, see rcmd.ObjectiveRegression
+type SimpleMlpRegressorFitWrap struct {
+	Model *nn.MLPRegressor
+}
+
+func (fit *SimpleMlpRegressorFitWrap) Fit(trainSample *rcmd.TrainSample) (rcmd.PredictAbstract, error) {
+	sampleDense, y := sampleToDense(trainSample)
+
+	pred := fit.Model.Fit(sampleDense, y)
+
+	return &SimpleMlpPredWrap{
+		pred: pred.(base.Predicter),
+	}, nil
+}
+
+// SetSeed seeds the weight init and the shuffling of the MLP
+func (fit *SimpleMlpRegressorFitWrap) SetSeed(seed int64) {
+	fit.Model.RandomState = base.NewLockedSource(uint64(seed))
+}
+
+// FitCheckpoint trains the model in chunks of ckpt.Every epochs and saves the
+// weights and the optimizer state after every chunk. The ones saved in ckpt
+// are loaded first if any, so only the remaining epochs are trained and the
+// optimizer continues from where it stopped.
+func (fit *SimpleMlpFitWrap) FitCheckpoint(trainSample *rcmd.TrainSample, ckpt *rcmd.Checkpoint) (rcmd.PredictAbstract, error) {
+	sampleDense, yClass := sampleToDense(trainSample)
+
+	epochs, warmStart := fit.Model.MaxIter, fit.Model.WarmStart
+	defer func() {
+		fit.Model.MaxIter, fit.Model.WarmStart = epochs, warmStart
+	}()
+	every := ckpt.Every
+	if every <= 0 {
+		every = epochs
+	}
+
+	done, data, err := ckpt.LoadModel()
+	if err != nil {
+		return nil, err
+	}
+	var state checkpointState
+	if data != nil {
+		if err = fit.Model.Unmarshal(data); err != nil {
+			return nil, fmt.Errorf("load checkpoint weights error: %v", err)
+		}
+		if err = json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("load checkpoint optimizer error: %v", err)
+		}
+		fit.Model.WarmStart = true
+	}
+	for done < epochs {
+		if state.Optimizer != nil {
+			if err = fit.Model.SetOptimizerState(state.Optimizer); err != nil {
+				return nil, fmt.Errorf("restore optimizer error: %v", err)
+			}
+		}
+		n := every
+		if done+n > epochs {
+			n = epochs - done
+		}
+		fit.Model.MaxIter = n
+		fit.Model.Fit(sampleDense, yClass)
+		fit.Model.WarmStart = true
+		done += n
+
+		state.Optimizer = fit.Model.OptimizerState()
+		if data, err = marshalCheckpoint(&fit.Model.BaseMultilayerPerceptron64, state); err != nil {
+			return nil, err
+		}
+		if err = ckpt.SaveModel(done, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SimpleMlpPredWrap{
+		pred: fit.Model,
+	}, nil
+}
+
+// checkpointState is saved along the weights in the checkpoint, Unmarshal
+// of the weights ignores it
+type checkpointState struct {
+	Optimizer *nn.OptimizerState64 `json:"optimizer_,omitempty"`
+}
+
+// MarshalWeights marshals the coefs and intercepts of mlp in the json format
+// accepted by its Unmarshal
+func MarshalWeights(mlp *nn.BaseMultilayerPerceptron64) ([]byte, error) {
+	return json.Marshal(weightsOf(mlp))
+}
+
+func marshalCheckpoint(mlp *nn.BaseMultilayerPerceptron64, state checkpointState) ([]byte, error) {
+	weights := weightsOf(mlp)
+	if state.Optimizer != nil {
+		weights["optimizer_"] = state.Optimizer
+	}
+	return json.Marshal(weights)
+}
+
+func weightsOf(mlp *nn.BaseMultilayerPerceptron64) map[string]interface{} {
+	coefs := make([][][]float64, len(mlp.Coefs))
+	for i, c := range mlp.Coefs {
+		coefs[i] = make([][]float64, c.Rows)
+		for r := 0; r < c.Rows; r++ {
+			coefs[i][r] = c.Data[r*c.Stride : r*c.Stride+c.Cols]
+		}
+	}
+	return map[string]interface{}{
+		"params":      map[string]interface{}{},
+		"coefs_":      coefs,
+		"intercepts_": mlp.Intercepts,
+	}
+}
+
+func sampleToDense(trainSample *rcmd.TrainSample) (sampleDense, yClass *mat.Dense) {
 	sampleLen := trainSample.Rows
 	x64 := make([]float64, sampleLen*trainSample.XCols)
 	for i := 0; i < sampleLen; i++ {
@@ -50,16 +183,11 @@ func (fit *SimpleMlpFitWrap) Fit(trainSample *rcmd.TrainSample) (rcmd.PredictAbs
 			x64[i*trainSample.XCols+j] = float64(trainSample.X[i*trainSample.XCols+j])
 		}
 	}
-	sampleDense := mat.NewDense(sampleLen, trainSample.XCols, x64)
+	sampleDense = mat.NewDense(sampleLen, trainSample.XCols, x64)
 
-	yClass := mat.NewDense(sampleLen, 1, nil)
+	yClass = mat.NewDense(sampleLen, 1, nil)
 	for i, sample := range trainSample.Y {
 		yClass.Set(i, 0, float64(sample))
 	}
-
-	pred := fit.Model.Fit(sampleDense, yClass)
-
-	return &SimpleMlpPredWrap{
-		pred: pred.(base.Predicter),
-	}, nil
+	return
 }
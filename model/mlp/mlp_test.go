@@ -0,0 +1,110 @@
+package mlp
+
+import (
+	"math/rand"
+	"testing"
+
+	nn "github.com/auxten/go-ctr/nn/neural_network"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+func TestFitCheckpoint(t *testing.T) {
+	Convey("fit with checkpoint and resume", t, func() {
+		const rows, cols = 64, 3
+		rnd := rand.New(rand.NewSource(1))
+		sample := &rcmd.TrainSample{Rows: rows, XCols: cols}
+		for i := 0; i < rows; i++ {
+			var sum float32
+			for j := 0; j < cols; j++ {
+				v := rnd.Float32()
+				sum += v
+				sample.X = append(sample.X, v)
+			}
+			if sum > cols/2. {
+				sample.Y = append(sample.Y, 1)
+			} else {
+				sample.Y = append(sample.Y, 0)
+			}
+		}
+
+		ckpt, err := rcmd.OpenCheckpoint(t.TempDir())
+		So(err, ShouldBeNil)
+		ckpt.Every = 2
+		model := nn.NewMLPClassifier([]int{4}, "relu", "adam", 1e-5)
+		model.MaxIter = 4
+		pred, err := (&SimpleMlpFitWrap{Model: model}).FitCheckpoint(sample, ckpt)
+		So(err, ShouldBeNil)
+		So(ckpt.Meta.Epoch, ShouldEqual, 4)
+
+		resumed, err := rcmd.OpenCheckpoint(ckpt.Dir)
+		So(err, ShouldBeNil)
+		So(resumed.Meta.Epoch, ShouldEqual, 4)
+		model2 := nn.NewMLPClassifier([]int{4}, "relu", "adam", 1e-5)
+		model2.MaxIter = 4
+		pred2, err := (&SimpleMlpFitWrap{Model: model2}).FitCheckpoint(sample, resumed)
+		So(err, ShouldBeNil)
+
+		x := tensor.New(tensor.WithShape(rows, cols), tensor.WithBacking(sample.X))
+		So(pred2.Predict(x).Data(), ShouldResemble, pred.Predict(x).Data())
+
+		// resumed after 2 epochs like trained in one go, the optimizer
+		// continues from the checkpoint
+		newModel := func(epochs int) *SimpleMlpFitWrap {
+			fit := &SimpleMlpFitWrap{Model: nn.NewMLPClassifier([]int{4}, "relu", "adam", 1e-5)}
+			fit.Model.MaxIter = epochs
+			fit.Model.Shuffle = false
+			fit.SetSeed(7)
+			return fit
+		}
+		whole, err := rcmd.OpenCheckpoint(t.TempDir())
+		So(err, ShouldBeNil)
+		whole.Every = 4
+		fit := newModel(4)
+		_, err = fit.FitCheckpoint(sample, whole)
+		So(err, ShouldBeNil)
+		weights, err := MarshalWeights(&fit.Model.BaseMultilayerPerceptron64)
+		So(err, ShouldBeNil)
+
+		half, err := rcmd.OpenCheckpoint(t.TempDir())
+		So(err, ShouldBeNil)
+		_, err = newModel(2).FitCheckpoint(sample, half)
+		So(err, ShouldBeNil)
+		resumed, err = rcmd.OpenCheckpoint(half.Dir)
+		So(err, ShouldBeNil)
+		So(resumed.Meta.Epoch, ShouldEqual, 2)
+		fit = newModel(4)
+		_, err = fit.FitCheckpoint(sample, resumed)
+		So(err, ShouldBeNil)
+		So(resumed.Meta.Epoch, ShouldEqual, 4)
+		weights2, err := MarshalWeights(&fit.Model.BaseMultilayerPerceptron64)
+		So(err, ShouldBeNil)
+		So(string(weights2), ShouldEqual, string(weights))
+	})
+}
+
+func TestRegressor(t *testing.T) {
+	Convey("fit the ratings", t, func() {
+		defer func(o rcmd.Objective) { rcmd.LabelObjective = o }(rcmd.LabelObjective)
+		rcmd.LabelObjective = rcmd.ObjectiveRegression
+		const rows, cols = 200, 2
+		rnd := rand.New(rand.NewSource(1))
+		sample := &rcmd.TrainSample{Rows: rows, XCols: cols}
+		for i := 0; i < rows; i++ {
+			a, b := rnd.Float32(), rnd.Float32()
+			sample.X = append(sample.X, a, b)
+			// rating 1-5
+			sample.Y = append(sample.Y, 1+2*a+2*b)
+		}
+		model := nn.NewMLPRegressor([]int{8}, "relu", "adam", 1e-5)
+		model.MaxIter = 500
+		pred, err := (&SimpleMlpRegressorFitWrap{Model: model}).Fit(sample)
+		So(err, ShouldBeNil)
+		m, err := rcmd.Evaluate(pred, sample)
+		So(err, ShouldBeNil)
+		// predicting the mean rating is RMSE 0.82
+		So(m.RMSE, ShouldBeLessThan, 0.5)
+		So(m.MAE, ShouldBeLessThan, m.RMSE+1e-9)
+	})
+}
@@ -0,0 +1,252 @@
+package mlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	nn "github.com/auxten/go-ctr/nn/neural_network"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"gorgonia.org/tensor"
+)
+
+// QuantizedMLP is the int8 post-training quantization of a fitted MLP for
+// the CPU-only edge devices. The weights are quantized symmetrically per
+// output unit, the activations per row on the fly, the dot products are
+// accumulated in int32 and rescaled to float32 before the bias and the
+// activation. It takes about 1/8 the memory of the float64 weights.
+type QuantizedMLP struct {
+	Activation    string       `json:"activation"`
+	OutActivation string       `json:"outActivation"`
+	Layers        []QuantLayer `json:"layers"`
+}
+
+// QuantLayer is a dense layer of In inputs and Out units, W is In x Out
+// row-major and the weight j of unit o is W[j*Out+o] * Scale[o]
+type QuantLayer struct {
+	In    int       `json:"in"`
+	Out   int       `json:"out"`
+	W     []int8    `json:"w"`
+	Scale []float32 `json:"scale"`
+	Bias  []float32 `json:"bias"`
+}
+
+// QuantReport compares the QuantizedMLP against the float model on the
+// same samples
+type QuantReport struct {
+	Rows        int               `json:"rows"`
+	MaxAbsDiff  float64           `json:"maxAbsDiff"`
+	MeanAbsDiff float64           `json:"meanAbsDiff"`
+	Float       *rcmd.EvalMetrics `json:"float"`
+	Quantized   *rcmd.EvalMetrics `json:"quantized"`
+	FloatBytes  int               `json:"floatBytes"`
+	QuantBytes  int               `json:"quantBytes"`
+}
+
+var quantActivations = map[string]func(float32) float32{
+	"identity": func(v float32) float32 { return v },
+	"logistic": func(v float32) float32 { return float32(1 / (1 + math.Exp(-float64(v)))) },
+	"tanh":     func(v float32) float32 { return float32(math.Tanh(float64(v))) },
+	"relu": func(v float32) float32 {
+		if v < 0 {
+			return 0
+		}
+		return v
+	},
+}
+
+// Quantize returns the QuantizedMLP of the predictor fitted by
+// SimpleMlpFitWrap or SimpleMlpRegressorFitWrap
+func Quantize(pred rcmd.PredictAbstract) (q *QuantizedMLP, err error) {
+	wrap, ok := pred.(*SimpleMlpPredWrap)
+	if !ok {
+		return nil, fmt.Errorf("quantize %T is not supported", pred)
+	}
+	var mlp *nn.BaseMultilayerPerceptron64
+	switch m := wrap.pred.(type) {
+	case *nn.MLPClassifier:
+		mlp = &m.BaseMultilayerPerceptron64
+	case *nn.MLPRegressor:
+		mlp = &m.BaseMultilayerPerceptron64
+	default:
+		return nil, fmt.Errorf("quantize %T is not supported", wrap.pred)
+	}
+	if mlp.GetNOutputs() != mlp.NOutputs {
+		return nil, fmt.Errorf("quantize the label binarized mlp is not supported")
+	}
+	for _, act := range []string{mlp.Activation, mlp.OutActivation} {
+		if _, ok := quantActivations[act]; !ok {
+			return nil, fmt.Errorf("quantize activation %s is not supported", act)
+		}
+	}
+
+	q = &QuantizedMLP{
+		Activation:    mlp.Activation,
+		OutActivation: mlp.OutActivation,
+		Layers:        make([]QuantLayer, len(mlp.Coefs)),
+	}
+	for i, c := range mlp.Coefs {
+		l := QuantLayer{
+			In:    c.Rows,
+			Out:   c.Cols,
+			W:     make([]int8, c.Rows*c.Cols),
+			Scale: make([]float32, c.Cols),
+			Bias:  make([]float32, c.Cols),
+		}
+		for o := 0; o < c.Cols; o++ {
+			l.Bias[o] = float32(mlp.Intercepts[i][o])
+			var maxAbs float64
+			for j := 0; j < c.Rows; j++ {
+				maxAbs = math.Max(maxAbs, math.Abs(c.Data[j*c.Stride+o]))
+			}
+			if maxAbs == 0 {
+				continue
+			}
+			scale := maxAbs / 127
+			for j := 0; j < c.Rows; j++ {
+				l.W[j*c.Cols+o] = int8(math.Round(c.Data[j*c.Stride+o] / scale))
+			}
+			l.Scale[o] = float32(scale)
+		}
+		q.Layers[i] = l
+	}
+	return
+}
+
+func NewQuantizedMLPFromJson(data []byte) (q *QuantizedMLP, err error) {
+	q = &QuantizedMLP{}
+	if err = json.Unmarshal(data, q); err != nil {
+		return nil, err
+	}
+	for i, l := range q.Layers {
+		if len(l.W) != l.In*l.Out || len(l.Scale) != l.Out || len(l.Bias) != l.Out {
+			return nil, fmt.Errorf("quantized layer %d mismatch the dims %d x %d", i, l.In, l.Out)
+		}
+	}
+	return
+}
+
+func (q *QuantizedMLP) Marshal() ([]byte, error) {
+	return json.Marshal(q)
+}
+
+// Bytes is the memory taken by the weights
+func (q *QuantizedMLP) Bytes() (n int) {
+	for _, l := range q.Layers {
+		n += len(l.W) + 4*(len(l.Scale)+len(l.Bias))
+	}
+	return
+}
+
+// Predict returns the output of the last layer for every row of X
+func (q *QuantizedMLP) Predict(X tensor.Tensor) tensor.Tensor {
+	var (
+		rows    = X.Shape()[0]
+		data    = X.Data().([]float32)
+		width   = 0
+		hidden  = quantActivations[q.Activation]
+		outAct  = quantActivations[q.OutActivation]
+		outCols = q.Layers[len(q.Layers)-1].Out
+		y       = make([]float32, rows*outCols)
+	)
+	for _, l := range q.Layers {
+		if l.Out > width {
+			width = l.Out
+		}
+		if l.In > width {
+			width = l.In
+		}
+	}
+	var (
+		in   = make([]float32, width)
+		out  = make([]float32, width)
+		inQ  = make([]int8, width)
+		acc  = make([]int32, width)
+		cols = q.Layers[0].In
+	)
+	for r := 0; r < rows; r++ {
+		in = in[:cols]
+		copy(in, data[r*cols:(r+1)*cols])
+		for i, l := range q.Layers {
+			act := hidden
+			if i == len(q.Layers)-1 {
+				act = outAct
+			}
+			out = out[:l.Out]
+			l.forward(in, inQ[:l.In], acc[:l.Out], out, act)
+			in, out = out, in[:cap(in)]
+		}
+		copy(y[r*outCols:(r+1)*outCols], in)
+	}
+	return tensor.New(tensor.WithShape(rows, outCols), tensor.WithBacking(y))
+}
+
+// forward quantizes in to inQ and sets out to act(in * W + Bias), the zero
+// inputs, e.g. of relu, are skipped
+func (l *QuantLayer) forward(in []float32, inQ []int8, acc []int32, out []float32, act func(float32) float32) {
+	var maxAbs float32
+	for _, v := range in {
+		if v < 0 {
+			v = -v
+		}
+		if v > maxAbs {
+			maxAbs = v
+		}
+	}
+	for o := range acc {
+		acc[o] = 0
+	}
+	inScale := maxAbs / 127
+	if inScale != 0 {
+		inv := 1 / inScale
+		for j, v := range in {
+			// round half away from zero
+			if v < 0 {
+				inQ[j] = int8(v*inv - 0.5)
+			} else {
+				inQ[j] = int8(v*inv + 0.5)
+			}
+		}
+		for j, x := range inQ {
+			if x != 0 {
+				axpyInt8(int32(x), l.W[j*l.Out:(j+1)*l.Out], acc)
+			}
+		}
+	}
+	for o := range out {
+		out[o] = act(float32(acc[o])*inScale*l.Scale[o] + l.Bias[o])
+	}
+}
+
+// axpyInt8 adds x * w to acc, len(acc) >= len(w)
+func axpyInt8(x int32, w []int8, acc []int32) {
+	acc = acc[:len(w)]
+	for o, v := range w {
+		acc[o] += x * int32(v)
+	}
+}
+
+// CompareQuantized reports the accuracy of q against the float model pred
+// on sample
+func CompareQuantized(pred rcmd.PredictAbstract, q *QuantizedMLP, sample *rcmd.TrainSample) (report *QuantReport, err error) {
+	report = &QuantReport{Rows: sample.Rows, QuantBytes: q.Bytes()}
+	for _, l := range q.Layers {
+		report.FloatBytes += 8 * (len(l.W) + len(l.Bias))
+	}
+	if report.Float, err = rcmd.Evaluate(pred, sample); err != nil {
+		return nil, err
+	}
+	if report.Quantized, err = rcmd.Evaluate(q, sample); err != nil {
+		return nil, err
+	}
+
+	X := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+	yFloat, yQuant := pred.Predict(X).Data().([]float32), q.Predict(X).Data().([]float32)
+	for i := 0; i < sample.Rows; i++ {
+		d := math.Abs(float64(yFloat[i]) - float64(yQuant[i]))
+		report.MaxAbsDiff = math.Max(report.MaxAbsDiff, d)
+		report.MeanAbsDiff += d
+	}
+	report.MeanAbsDiff /= float64(sample.Rows)
+	return
+}
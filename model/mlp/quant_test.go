@@ -0,0 +1,86 @@
+package mlp
+
+import (
+	"math/rand"
+	"testing"
+
+	nn "github.com/auxten/go-ctr/nn/neural_network"
+	rcmd "github.com/auxten/go-ctr/recommend"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+func quantSample(rows, cols int) *rcmd.TrainSample {
+	rnd := rand.New(rand.NewSource(1))
+	sample := &rcmd.TrainSample{Rows: rows, XCols: cols}
+	for i := 0; i < rows; i++ {
+		var sum float32
+		for j := 0; j < cols; j++ {
+			v := rnd.Float32()
+			sum += v
+			sample.X = append(sample.X, v)
+		}
+		if sum > float32(cols)/2 {
+			sample.Y = append(sample.Y, 1)
+		} else {
+			sample.Y = append(sample.Y, 0)
+		}
+	}
+	return sample
+}
+
+func TestQuantize(t *testing.T) {
+	Convey("quantized predict", t, func() {
+		sample := quantSample(300, 8)
+		model := nn.NewMLPClassifier([]int{16, 8}, "relu", "adam", 1e-5)
+		model.MaxIter = 100
+		pred, err := (&SimpleMlpFitWrap{Model: model}).Fit(sample)
+		So(err, ShouldBeNil)
+
+		q, err := Quantize(pred)
+		So(err, ShouldBeNil)
+		So(q.Layers, ShouldHaveLength, 3)
+
+		report, err := CompareQuantized(pred, q, sample)
+		So(err, ShouldBeNil)
+		So(report.MaxAbsDiff, ShouldBeLessThan, 0.05)
+		So(report.Quantized.AUC, ShouldAlmostEqual, report.Float.AUC, 0.05)
+		So(report.QuantBytes*4, ShouldBeLessThan, report.FloatBytes)
+
+		Convey("marshal", func() {
+			data, err := q.Marshal()
+			So(err, ShouldBeNil)
+			q2, err := NewQuantizedMLPFromJson(data)
+			So(err, ShouldBeNil)
+			X := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+			So(q2.Predict(X).Data(), ShouldResemble, q.Predict(X).Data())
+		})
+
+		Convey("unsupported", func() {
+			_, err := Quantize(q)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func BenchmarkPredict(b *testing.B) {
+	sample := quantSample(1000, 64)
+	model := nn.NewMLPClassifier([]int{128, 64}, "relu", "adam", 1e-5)
+	model.MaxIter = 1
+	pred, _ := (&SimpleMlpFitWrap{Model: model}).Fit(sample)
+	q, err := Quantize(pred)
+	if err != nil {
+		b.Fatal(err)
+	}
+	X := tensor.New(tensor.WithShape(sample.Rows, sample.XCols), tensor.WithBacking(sample.X))
+	b.Run("float", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pred.Predict(X)
+		}
+	})
+	b.Run("int8", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			q.Predict(X)
+		}
+	})
+}
@@ -30,6 +30,18 @@ func Train(uProfileDim, uBehaviorSize, uBehaviorDim, iFeatureDim, cFeatureDim in
 	inputs, targets tensor.Tensor,
 //testInputs, testTargets tensor.Tensor,
 	m Model,
+) (err error) {
+	return TrainWithLoss(nil, uProfileDim, uBehaviorSize, uBehaviorDim, iFeatureDim, cFeatureDim,
+		numExamples, batchSize, epochs, earlyStop, si, inputs, targets, m)
+}
+
+// TrainWithLoss is Train minimizing the Cost32 of loss, e.g. the
+// rcmd.TrainLoss set to a rcmd.LossFitter
+func TrainWithLoss(loss rcmd.Loss, uProfileDim, uBehaviorSize, uBehaviorDim, iFeatureDim, cFeatureDim int,
+	numExamples, batchSize, epochs, earlyStop int,
+	si *rcmd.SampleInfo,
+	inputs, targets tensor.Tensor,
+	m Model,
 ) (err error) {
 	g := m.Graph()
 	xUserProfile := G.NewMatrix(g, DT, G.WithShape(batchSize, uProfileDim), G.WithName("xUserProfile"))
@@ -45,7 +57,10 @@ func Train(uProfileDim, uBehaviorSize, uBehaviorDim, iFeatureDim, cFeatureDim in
 
 	//losses := G.Must(G.HadamardProd(G.Must(G.Neg(G.Must(G.Log(m.out)))), y))
 	//losses := G.Must(G.Square(G.Must(G.Sub(m.Out(), y))))
-	cost := BinaryCrossEntropy32(m.Out(), y)
+	cost, err := Cost32(loss, m.Out(), y)
+	if err != nil {
+		return
+	}
 	// we want to track costs
 	//var costVal G.Value
 	//G.Read(cost, &costVal)
@@ -192,6 +207,15 @@ func Train(uProfileDim, uBehaviorSize, uBehaviorDim, iFeatureDim, cFeatureDim in
 			if err = solver.Step(G.NodesToValueGrads(m.Learnable())); err != nil {
 				log.Fatalf("Failed to update nodes with gradients at epoch %d, batch %d. Error %v", i, b, err)
 			}
+			rcmd.ReportProgress(rcmd.Progress{
+				Stage:   rcmd.ProgressFit,
+				Epoch:   i + 1,
+				Epochs:  epochs,
+				Batch:   b + 1,
+				Batches: batches,
+				Samples: i*numExamples + end,
+				Loss:    float64(cost.Value().Data().(float32)),
+			})
 			vm.Reset()
 			bar.Increment()
 		}
@@ -0,0 +1,402 @@
+package twotower
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	"gorgonia.org/tensor"
+)
+
+// TwoTower is the retrieval model of a user tower and an item tower, the
+// linear maps of the user and the item features to Dim, the margin is the
+// dot of the two embeddings. The item features are [ItemRange[0],
+// ItemRange[1]) of a row, the user tower takes the others.
+type TwoTower struct {
+	Features  int    `json:"features"`
+	ItemRange [2]int `json:"itemRange"`
+	Dim       int    `json:"dim"`
+	// UserW is (Features - item features) x Dim row-major
+	UserW []float32 `json:"userW"`
+	UserB []float32 `json:"userB"`
+	// ItemW is item features x Dim row-major
+	ItemW []float32 `json:"itemW"`
+	ItemB []float32 `json:"itemB"`
+}
+
+// Fitter trains a TwoTower by SGD. With InBatchNegatives only the positive
+// rows are trained on, the items of the other rows of a mini-batch are the
+// negatives of every user by the sampled softmax, which is much cheaper
+// than generating the negatives. Or else every row is trained on by the log
+// loss.
+type Fitter struct {
+	Dim       int
+	Epochs    int
+	BatchSize int
+	LearnRate float64
+	// L2 is the L2 regularization of the weights
+	L2 float64
+	// InitStd is the stddev of the initial weights
+	InitStd          float64
+	InBatchNegatives bool
+	// LogQCorrection subtracts the log of the frequency of the items in the
+	// positives from the in-batch logits, so the popular items sampled as
+	// the negatives more often are not over-penalized
+	LogQCorrection bool
+	// ItemRange is the item features of the rows, empty is ItemFeatureRange
+	// to CtxFeatureRange of the sample Info
+	ItemRange [2]int
+	Seed      int64
+}
+
+// NewFitter returns the Fitter of in-batch negatives of log-Q correction
+func NewFitter() *Fitter {
+	return &Fitter{
+		Dim:              16,
+		Epochs:           10,
+		BatchSize:        256,
+		LearnRate:        0.05,
+		L2:               1e-5,
+		InitStd:          0.1,
+		InBatchNegatives: true,
+		LogQCorrection:   true,
+		Seed:             1,
+	}
+}
+
+// SetSeed implements rcmd.SeedFitter
+func (fit *Fitter) SetSeed(seed int64) {
+	fit.Seed = seed
+}
+
+func NewTwoTowerFromJson(data []byte) (m *TwoTower, err error) {
+	m = &TwoTower{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	itemCols := m.ItemRange[1] - m.ItemRange[0]
+	if m.ItemRange[0] < 0 || itemCols <= 0 || m.ItemRange[1] > m.Features ||
+		len(m.UserW) != (m.Features-itemCols)*m.Dim || len(m.ItemW) != itemCols*m.Dim ||
+		len(m.UserB) != m.Dim || len(m.ItemB) != m.Dim {
+		return nil, fmt.Errorf("two tower weights mismatch the dims %d x %d", m.Features, m.Dim)
+	}
+	return
+}
+
+func (m *TwoTower) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (fit *Fitter) Fit(sample *rcmd.TrainSample) (pred rcmd.PredictAbstract, err error) {
+	if sample.Rows == 0 {
+		return nil, fmt.Errorf("no sample to fit")
+	}
+	itemRange := fit.ItemRange
+	if itemRange[1] <= itemRange[0] {
+		itemRange = [2]int{sample.Info.ItemFeatureRange[0], sample.Info.CtxFeatureRange[1]}
+	}
+	itemCols := itemRange[1] - itemRange[0]
+	if itemRange[0] < 0 || itemCols <= 0 || itemRange[1] > sample.XCols {
+		return nil, fmt.Errorf("invalid item range %v of %d features", itemRange, sample.XCols)
+	}
+
+	var (
+		cols = sample.XCols
+		rnd  = rand.New(rand.NewSource(fit.Seed))
+		m    = &TwoTower{
+			Features:  cols,
+			ItemRange: itemRange,
+			Dim:       fit.Dim,
+			UserW:     make([]float32, (cols-itemCols)*fit.Dim),
+			UserB:     make([]float32, fit.Dim),
+			ItemW:     make([]float32, itemCols*fit.Dim),
+			ItemB:     make([]float32, fit.Dim),
+		}
+	)
+	for _, w := range [][]float32{m.UserW, m.ItemW} {
+		for i := range w {
+			w[i] = float32(rnd.NormFloat64() * fit.InitStd)
+		}
+	}
+
+	tr := &trainer{Fitter: fit, m: m, sample: sample}
+	if fit.InBatchNegatives {
+		err = tr.inBatch(rnd)
+	} else {
+		err = tr.pointwise(rnd)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// trainer is the state of the training of a TwoTower
+type trainer struct {
+	*Fitter
+	m      *TwoTower
+	sample *rcmd.TrainSample
+}
+
+// pointwise trains on every row by the log loss of the sigmoid of the margin
+func (tr *trainer) pointwise(rnd *rand.Rand) error {
+	var (
+		m, sample = tr.m, tr.sample
+		cols      = sample.XCols
+		u, v      = make([]float32, m.Dim), make([]float32, m.Dim)
+		du, dv    = make([]float32, m.Dim), make([]float32, m.Dim)
+	)
+	for epoch := 0; epoch < tr.Epochs; epoch++ {
+		var loss float64
+		for _, r := range rnd.Perm(sample.Rows) {
+			x, y := sample.X[r*cols:(r+1)*cols], sample.Y[r]
+			m.embed(x, u, v)
+			p := 1 / (1 + math.Exp(-float64(dot(u, v))))
+			q := math.Min(math.Max(p, 1e-7), 1-1e-7)
+			loss -= float64(y)*math.Log(q) + float64(1-y)*math.Log(1-q)
+			g := float32(p) - y
+			for d := range du {
+				du[d], dv[d] = g*v[d], g*u[d]
+			}
+			tr.update(x, du, dv)
+		}
+		tr.report(epoch, loss/float64(sample.Rows))
+	}
+	return nil
+}
+
+// inBatch trains on the positive rows by the softmax over the items of the
+// mini-batch, the rows of the same item as the positive are masked
+func (tr *trainer) inBatch(rnd *rand.Rand) error {
+	var (
+		m, sample = tr.m, tr.sample
+		cols      = sample.XCols
+		positives []int
+		items     = tr.itemIds()
+		freq      = make(map[uint64]float64)
+	)
+	for r, y := range sample.Y[:sample.Rows] {
+		if y >= 0.5 {
+			positives = append(positives, r)
+			freq[items[r]]++
+		}
+	}
+	if len(positives) < 2 {
+		return fmt.Errorf("in-batch negatives need at least 2 positives, got %d", len(positives))
+	}
+	batchSize := tr.BatchSize
+	if batchSize < 2 {
+		batchSize = 2
+	}
+
+	var (
+		u, v   = newMatrix(batchSize, m.Dim), newMatrix(batchSize, m.Dim)
+		du, dv = newMatrix(batchSize, m.Dim), newMatrix(batchSize, m.Dim)
+		logits = make([]float64, batchSize)
+		logQ   = make([]float64, batchSize)
+	)
+	for epoch := 0; epoch < tr.Epochs; epoch++ {
+		var loss float64
+		rnd.Shuffle(len(positives), func(i, j int) { positives[i], positives[j] = positives[j], positives[i] })
+		for start := 0; start < len(positives); start += batchSize {
+			end := start + batchSize
+			if end > len(positives) {
+				end = len(positives)
+			}
+			batch := positives[start:end]
+			n := len(batch)
+			for i, r := range batch {
+				m.embed(sample.X[r*cols:(r+1)*cols], u[i], v[i])
+				if tr.LogQCorrection {
+					logQ[i] = math.Log(freq[items[r]] / float64(len(positives)))
+				}
+				for d := range du[i] {
+					du[i][d], dv[i][d] = 0, 0
+				}
+			}
+			for i := 0; i < n; i++ {
+				maxLogit := math.Inf(-1)
+				for j := 0; j < n; j++ {
+					if j != i && items[batch[j]] == items[batch[i]] {
+						logits[j] = math.Inf(-1)
+						continue
+					}
+					logits[j] = float64(dot(u[i], v[j])) - logQ[j]
+					maxLogit = math.Max(maxLogit, logits[j])
+				}
+				var sum float64
+				for j := 0; j < n; j++ {
+					logits[j] = math.Exp(logits[j] - maxLogit)
+					sum += logits[j]
+				}
+				loss -= math.Log(math.Max(logits[i]/sum, 1e-12))
+				// the gradient of the loss by the logit j is p_j - [i == j]
+				for j := 0; j < n; j++ {
+					g := logits[j] / sum
+					if j == i {
+						g--
+					}
+					if g == 0 {
+						continue
+					}
+					g32 := float32(g / float64(n))
+					for d := 0; d < m.Dim; d++ {
+						du[i][d] += g32 * v[j][d]
+						dv[j][d] += g32 * u[i][d]
+					}
+				}
+			}
+			for i, r := range batch {
+				tr.update(sample.X[r*cols:(r+1)*cols], du[i], dv[i])
+			}
+		}
+		tr.report(epoch, loss/float64(len(positives)))
+	}
+	return nil
+}
+
+// update descends the weights of the row x by the gradients du and dv of
+// the user and the item embeddings
+func (tr *trainer) update(x []float32, du, dv []float32) {
+	var (
+		m      = tr.m
+		lr, l2 = float32(tr.LearnRate), float32(tr.L2)
+	)
+	for c, xc := range x {
+		if xc == 0 {
+			continue
+		}
+		w, grad := m.row(c), du
+		if c >= m.ItemRange[0] && c < m.ItemRange[1] {
+			grad = dv
+		}
+		for d, g := range grad {
+			w[d] -= lr * (g*xc + l2*w[d])
+		}
+	}
+	for d := range du {
+		m.UserB[d] -= lr * du[d]
+		m.ItemB[d] -= lr * dv[d]
+	}
+}
+
+func (tr *trainer) report(epoch int, loss float64) {
+	rcmd.ReportProgress(rcmd.Progress{
+		Stage:   rcmd.ProgressFit,
+		Epoch:   epoch + 1,
+		Epochs:  tr.Epochs,
+		Samples: (epoch + 1) * tr.sample.Rows,
+		Loss:    loss,
+		Model:   tr.m,
+	})
+}
+
+// itemIds returns the item of every row, the ItemId of the Keys if any, or
+// else the hash of the item features
+func (tr *trainer) itemIds() (ids []uint64) {
+	var (
+		sample = tr.sample
+		cols   = sample.XCols
+		lo, hi = tr.m.ItemRange[0], tr.m.ItemRange[1]
+	)
+	ids = make([]uint64, sample.Rows)
+	if len(sample.Keys) == sample.Rows {
+		for r, key := range sample.Keys {
+			ids[r] = uint64(key.ItemId)
+		}
+		return
+	}
+	var buf [4]byte
+	for r := range ids {
+		h := fnv.New64a()
+		for _, v := range sample.X[r*cols+lo : r*cols+hi] {
+			bits := math.Float32bits(v)
+			buf[0], buf[1], buf[2], buf[3] = byte(bits), byte(bits>>8), byte(bits>>16), byte(bits>>24)
+			h.Write(buf[:])
+		}
+		ids[r] = h.Sum64()
+	}
+	return
+}
+
+// row returns the weights of the feature c in its tower
+func (m *TwoTower) row(c int) []float32 {
+	lo, hi := m.ItemRange[0], m.ItemRange[1]
+	switch {
+	case c < lo:
+		return m.UserW[c*m.Dim : (c+1)*m.Dim]
+	case c < hi:
+		return m.ItemW[(c-lo)*m.Dim : (c-lo+1)*m.Dim]
+	default:
+		c -= hi - lo
+		return m.UserW[c*m.Dim : (c+1)*m.Dim]
+	}
+}
+
+// embed sets u and v to the user and the item embeddings of the row x
+func (m *TwoTower) embed(x []float32, u, v []float32) {
+	copy(u, m.UserB)
+	copy(v, m.ItemB)
+	for c, xc := range x {
+		if xc == 0 {
+			continue
+		}
+		out := u
+		if c >= m.ItemRange[0] && c < m.ItemRange[1] {
+			out = v
+		}
+		for d, w := range m.row(c) {
+			out[d] += w * xc
+		}
+	}
+}
+
+// UserEmbedding returns the user embedding of the row x, the item features
+// of x are ignored
+func (m *TwoTower) UserEmbedding(x []float32) []float32 {
+	u, v := make([]float32, m.Dim), make([]float32, m.Dim)
+	m.embed(x, u, v)
+	return u
+}
+
+// ItemEmbedding returns the item embedding of the row x, the user features
+// of x are ignored
+func (m *TwoTower) ItemEmbedding(x []float32) []float32 {
+	u, v := make([]float32, m.Dim), make([]float32, m.Dim)
+	m.embed(x, u, v)
+	return v
+}
+
+// Predict returns the sigmoid of the margin of every row of X
+func (m *TwoTower) Predict(X tensor.Tensor) tensor.Tensor {
+	var (
+		rows = X.Shape()[0]
+		data = X.Data().([]float32)
+		u, v = make([]float32, m.Dim), make([]float32, m.Dim)
+		y    = make([]float32, rows)
+	)
+	for i := range y {
+		m.embed(data[i*m.Features:(i+1)*m.Features], u, v)
+		y[i] = float32(1 / (1 + math.Exp(-float64(dot(u, v)))))
+	}
+	return tensor.New(tensor.WithShape(rows, 1), tensor.WithBacking(y))
+}
+
+func dot(a, b []float32) (s float32) {
+	for i, v := range a {
+		s += v * b[i]
+	}
+	return
+}
+
+func newMatrix(rows, cols int) [][]float32 {
+	data := make([]float32, rows*cols)
+	m := make([][]float32, rows)
+	for i := range m {
+		m[i] = data[i*cols : (i+1)*cols]
+	}
+	return m
+}
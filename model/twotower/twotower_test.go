@@ -0,0 +1,102 @@
+package twotower
+
+import (
+	"math/rand"
+	"testing"
+
+	rcmd "github.com/auxten/go-ctr/recommend"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const users, items = 10, 10
+
+// row is the one-hot user u and item i
+func row(u, i int) []float32 {
+	x := make([]float32, users+items)
+	x[u], x[users+i] = 1, 1
+	return x
+}
+
+// pairSample is the pairs of the users and the items of the popularity
+// skewed to the small items, liked if both are odd or both are even
+func pairSample(rows int, positivesOnly bool) *rcmd.TrainSample {
+	rnd := rand.New(rand.NewSource(1))
+	sample := &rcmd.TrainSample{XCols: users + items}
+	for sample.Rows < rows {
+		u, i := rnd.Intn(users), int(rnd.ExpFloat64()*3)%items
+		liked := u%2 == i%2
+		if positivesOnly && !liked {
+			continue
+		}
+		sample.X = append(sample.X, row(u, i)...)
+		sample.Keys = append(sample.Keys, rcmd.SampleKey{UserId: u, ItemId: i})
+		if liked {
+			sample.Y = append(sample.Y, 1)
+		} else {
+			sample.Y = append(sample.Y, 0)
+		}
+		sample.Rows++
+	}
+	return sample
+}
+
+// allPairs is every pair of the users and the items
+func allPairs() *rcmd.TrainSample {
+	sample := &rcmd.TrainSample{XCols: users + items}
+	for u := 0; u < users; u++ {
+		for i := 0; i < items; i++ {
+			sample.X = append(sample.X, row(u, i)...)
+			if u%2 == i%2 {
+				sample.Y = append(sample.Y, 1)
+			} else {
+				sample.Y = append(sample.Y, 0)
+			}
+			sample.Rows++
+		}
+	}
+	return sample
+}
+
+func TestTwoTower(t *testing.T) {
+	Convey("two tower", t, func() {
+		fit := NewFitter()
+		fit.ItemRange = [2]int{users, users + items}
+		fit.BatchSize = 32
+
+		for _, logQ := range []bool{true, false} {
+			fit.LogQCorrection = logQ
+			pred, err := fit.Fit(pairSample(2000, true))
+			So(err, ShouldBeNil)
+			m, err := rcmd.Evaluate(pred, allPairs())
+			So(err, ShouldBeNil)
+			So(m.AUC, ShouldBeGreaterThan, 0.95)
+		}
+
+		fit.InBatchNegatives = false
+		pred, err := fit.Fit(pairSample(2000, false))
+		So(err, ShouldBeNil)
+		m, err := rcmd.Evaluate(pred, allPairs())
+		So(err, ShouldBeNil)
+		So(m.AUC, ShouldBeGreaterThan, 0.95)
+
+		Convey("embeddings and marshal", func() {
+			tt := pred.(*TwoTower)
+			x := row(1, 3)
+			So(dot(tt.UserEmbedding(x), tt.ItemEmbedding(x)), ShouldBeGreaterThan, 0)
+			data, err := tt.Marshal()
+			So(err, ShouldBeNil)
+			tt2, err := NewTwoTowerFromJson(data)
+			So(err, ShouldBeNil)
+			m2, err := rcmd.Evaluate(tt2, allPairs())
+			So(err, ShouldBeNil)
+			So(m2.LogLoss, ShouldEqual, m.LogLoss)
+		})
+	})
+
+	Convey("too few positives", t, func() {
+		fit := NewFitter()
+		fit.ItemRange = [2]int{users, users + items}
+		_, err := fit.Fit(&rcmd.TrainSample{Rows: 1, XCols: users + items, X: row(0, 0), Y: []float32{1}})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -65,6 +65,58 @@ func NewYoutubeDnnFromJson(data []byte) (mlp *YoutubeDnn, err error) {
 	if err = json.Unmarshal(data, &m); err != nil {
 		return
 	}
+	return newYoutubeDnnFromModel(&m), nil
+}
+
+// MarshalArtifact encodes the model as a model.Artifact, see NewYoutubeDnnFromArtifact
+func (mlp *YoutubeDnn) MarshalArtifact() (data []byte, err error) {
+	return mlp.Artifact().Marshal()
+}
+
+// Artifact returns the weights of the model as a model.Artifact, set
+// QuantizeInt8 of it before Marshal for a smaller artifact.
+func (mlp *YoutubeDnn) Artifact() (a *model.Artifact) {
+	a = model.NewArtifact()
+	a.Dims["uProfileDim"] = mlp.uProfileDim
+	a.Dims["uBehaviorSize"] = mlp.uBehaviorSize
+	a.Dims["uBehaviorDim"] = mlp.uBehaviorDim
+	a.Dims["iFeatureDim"] = mlp.iFeatureDim
+	a.Dims["cFeatureDim"] = mlp.cFeatureDim
+	a.Tensors["mlp0"] = mlp.mlp0.Value().Data().([]float32)
+	a.Tensors["mlp1"] = mlp.mlp1.Value().Data().([]float32)
+	a.Tensors["mlp2"] = mlp.mlp2.Value().Data().([]float32)
+	return
+}
+
+// NewYoutubeDnnFromArtifact creates the model using the tensors of a in place,
+// a should not be closed before the model is dropped.
+func NewYoutubeDnnFromArtifact(a *model.Artifact) (mlp *YoutubeDnn, err error) {
+	var m mlpModel
+	for name, dim := range map[string]*int{
+		"uProfileDim":   &m.UProfileDim,
+		"uBehaviorSize": &m.UBehaviorSize,
+		"uBehaviorDim":  &m.UBehaviorDim,
+		"iFeatureDim":   &m.IFeatureDim,
+		"cFeatureDim":   &m.CFeatureDim,
+	} {
+		if *dim, err = a.Dim(name); err != nil {
+			return
+		}
+	}
+	inputDim := m.UProfileDim + m.UBehaviorDim + m.IFeatureDim + m.CFeatureDim
+	if m.Mlp0, err = a.Tensor("mlp0", inputDim*mlp0_1); err != nil {
+		return
+	}
+	if m.Mlp1, err = a.Tensor("mlp1", mlp0_1*mlp1_2); err != nil {
+		return
+	}
+	if m.Mlp2, err = a.Tensor("mlp2", mlp1_2); err != nil {
+		return
+	}
+	return newYoutubeDnnFromModel(&m), nil
+}
+
+func newYoutubeDnnFromModel(m *mlpModel) (mlp *YoutubeDnn) {
 	var (
 		g             = G.NewGraph()
 		uProfileDim   = m.UProfileDim
@@ -1195,6 +1195,7 @@ func (mlp *BaseMultilayerPerceptron32) Unmarshal(buf []byte) error {
 				packedSize += (1 + layerUnits[il]) * layerUnits[il+1]
 			}
 			layerUnits[mlp.NLayers-1] = mlp.NOutputs
+			copy(mlp.HiddenLayerSizes, layerUnits[1:mlp.NLayers-1])
 			mlp.initialize(mlp.NOutputs, layerUnits, true, mlp.NOutputs > 1)
 
 			for i := 0; i < mlp.NLayers-1; i++ {
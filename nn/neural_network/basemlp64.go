@@ -66,11 +66,13 @@ type BaseMultilayerPerceptron64 struct {
 	BestLoss            float64
 	NoImprovementCount  int
 	optimizer           Optimizer64
-	packedParameters    []float64
-	packedGrads         []float64 // packedGrads allow tests to check gradients
-	bestParameters      []float64
-	batchNorm           [][]float64
-	lb                  *LabelBinarizer64
+	// resumeOptimizer keeps the optimizer set by SetOptimizerState on Fit
+	resumeOptimizer  bool
+	packedParameters []float64
+	packedGrads      []float64 // packedGrads allow tests to check gradients
+	bestParameters   []float64
+	batchNorm        [][]float64
+	lb               *LabelBinarizer64
 	// beforeMinimize allow test to set weights
 	beforeMinimize func(optimize.Problem, []float64)
 }
@@ -255,7 +257,8 @@ func NewBaseMultilayerPerceptron64() *BaseMultilayerPerceptron64 {
 
 // forwardPass Perform a forward pass on the network by computing the values
 // of the neurons in the hidden layers and the output layer.
-//        activations : []blas64General, length = nLayers - 1
+//
+//	activations : []blas64General, length = nLayers - 1
 func (mlp *BaseMultilayerPerceptron64) forwardPass(activations []blas64General) {
 	hiddenActivation := Activations64[mlp.Activation]
 	var i int
@@ -411,6 +414,8 @@ func (mlp *BaseMultilayerPerceptron64) initialize(yCols int, layerUnits []int, i
 	mlp.NIter = 0
 	mlp.t = 0
 	mlp.NOutputs = yCols
+	// the optimizer updates the parameters allocated here
+	mlp.optimizer, mlp.resumeOptimizer = nil, false
 
 	//# Compute the number of layers
 	mlp.NLayers = len(layerUnits)
@@ -728,7 +733,7 @@ func (mlp *BaseMultilayerPerceptron64) fitLbfgs(X, y blas64General, activations,
 
 func (mlp *BaseMultilayerPerceptron64) fitStochastic(X, y blas64General, activations, deltas, coefGrads []blas64General,
 	interceptGrads [][]float64, packedGrads []float64, layerUnits []int, incremental bool) {
-	if !incremental || mlp.optimizer == Optimizer64(nil) {
+	if (!incremental && !mlp.resumeOptimizer) || mlp.optimizer == Optimizer64(nil) {
 		params := mlp.packedParameters
 		switch mlp.Solver {
 		case "sgd":
@@ -750,6 +755,7 @@ func (mlp *BaseMultilayerPerceptron64) fitStochastic(X, y blas64General, activat
 			}
 		}
 	}
+	mlp.resumeOptimizer = false
 	// # earlyStopping in partialFit doesn"t make sense
 	earlyStopping := mlp.EarlyStopping && !incremental
 	var XVal, yVal blas64General
@@ -1090,6 +1096,99 @@ func (opt *AdamOptimizer64) updateParams(grads []float64) {
 	}
 }
 
+// OptimizerState64 is the state of the stochastic optimizer, it is saved
+// with the weights to resume the training without restarting the moments
+// and the learning rate schedule. The early stopping state is not kept.
+type OptimizerState64 struct {
+	Solver             string    `json:"solver"`
+	T                  int       `json:"t"`
+	NIter              int       `json:"n_iter"`
+	BestLoss           float64   `json:"best_loss"`
+	NoImprovementCount int       `json:"no_improvement_count"`
+	LearningRateInit   float64   `json:"learning_rate_init"`
+	LearningRate       float64   `json:"learning_rate"`
+	Velocities         []float64 `json:"velocities,omitempty"`
+	Step               float64   `json:"step,omitempty"`
+	Ms                 []float64 `json:"ms,omitempty"`
+	Vs                 []float64 `json:"vs,omitempty"`
+	Beta1t             float64   `json:"beta1t,omitempty"`
+	Beta2t             float64   `json:"beta2t,omitempty"`
+}
+
+// OptimizerState returns a copy of the optimizer state, nil if the model is
+// not fitted by the sgd or adam solver
+func (mlp *BaseMultilayerPerceptron64) OptimizerState() *OptimizerState64 {
+	state := &OptimizerState64{
+		Solver:             mlp.Solver,
+		T:                  mlp.t,
+		NIter:              mlp.NIter,
+		BestLoss:           mlp.BestLoss,
+		NoImprovementCount: mlp.NoImprovementCount,
+	}
+	switch opt := mlp.optimizer.(type) {
+	case *SGDOptimizer64:
+		state.LearningRateInit, state.LearningRate = opt.LearningRateInit, opt.LearningRate
+		state.Velocities = append([]float64(nil), opt.velocities...)
+	case *AdamOptimizer64:
+		state.LearningRateInit, state.LearningRate = opt.LearningRateInit, opt.LearningRate
+		state.Step, state.Beta1t, state.Beta2t = opt.t, opt.beta1t, opt.beta2t
+		state.Ms = append([]float64(nil), opt.ms...)
+		state.Vs = append([]float64(nil), opt.vs...)
+	default:
+		return nil
+	}
+	return state
+}
+
+// SetOptimizerState restores the optimizer from state, the next Fit with
+// WarmStart continues with it instead of a new one. The weights must be set
+// before, e.g. by Unmarshal.
+func (mlp *BaseMultilayerPerceptron64) SetOptimizerState(state *OptimizerState64) error {
+	if !strings.EqualFold(state.Solver, mlp.Solver) {
+		return fmt.Errorf("optimizer state of solver %s, model solver %s", state.Solver, mlp.Solver)
+	}
+	params := mlp.packedParameters
+	for _, moments := range [][]float64{state.Velocities, state.Ms, state.Vs} {
+		if moments != nil && len(moments) != len(params) {
+			return fmt.Errorf("optimizer state of %d params, model params %d", len(moments), len(params))
+		}
+	}
+	if state.Step > 0 && (state.Ms == nil || state.Vs == nil) {
+		return fmt.Errorf("adam moments missing at step %g", state.Step)
+	}
+	switch mlp.Solver {
+	case "sgd":
+		mlp.optimizer = &SGDOptimizer64{
+			Params:           params,
+			LearningRateInit: state.LearningRateInit,
+			LearningRate:     state.LearningRate,
+			LRSchedule:       mlp.LearningRate,
+			PowerT:           mlp.PowerT,
+			Momentum:         mlp.Momentum,
+			Nesterov:         mlp.NesterovsMomentum,
+			velocities:       append([]float64(nil), state.Velocities...),
+		}
+	case "adam":
+		mlp.optimizer = &AdamOptimizer64{
+			Params:           params,
+			LearningRateInit: state.LearningRateInit,
+			LearningRate:     state.LearningRate,
+			LRSchedule:       mlp.LearningRate,
+			Beta1:            mlp.Beta1, Beta2: mlp.Beta2, Epsilon: mlp.Epsilon,
+			t:      state.Step,
+			ms:     append([]float64(nil), state.Ms...),
+			vs:     append([]float64(nil), state.Vs...),
+			beta1t: state.Beta1t, beta2t: state.Beta2t,
+		}
+	default:
+		return fmt.Errorf("no optimizer state for solver %s", mlp.Solver)
+	}
+	mlp.t, mlp.NIter = state.T, state.NIter
+	mlp.BestLoss, mlp.NoImprovementCount = state.BestLoss, state.NoImprovementCount
+	mlp.resumeOptimizer = true
+	return nil
+}
+
 func toLogits64(ym blas64General) {
 	for i, ypos := 0, 0; i < ym.Rows; i, ypos = i+1, ypos+ym.Stride {
 		if ym.Cols == 1 {
@@ -1214,6 +1313,7 @@ func (mlp *BaseMultilayerPerceptron64) Unmarshal(buf []byte) error {
 				packedSize += (1 + layerUnits[il]) * layerUnits[il+1]
 			}
 			layerUnits[mlp.NLayers-1] = mlp.NOutputs
+			copy(mlp.HiddenLayerSizes, layerUnits[1:mlp.NLayers-1])
 			mlp.initialize(mlp.NOutputs, layerUnits, true, mlp.NOutputs > 1)
 
 			for i := 0; i < mlp.NLayers-1; i++ {
@@ -0,0 +1,137 @@
+package recommend
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/karlseguin/ccache/v2"
+)
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15 // 4-bit counters as TinyLFU
+	sketchMinWidth   = 1024
+)
+
+// ItemCacheAdmission is the admission policy of the item feature cache, nil
+// means every fetched item is admitted and the LRU evicts. With TinyLFU a
+// scan of cold items, e.g. the samples of Train sharing the cache with the
+// serving, does not evict the hot serving set.
+var ItemCacheAdmission *TinyLFU
+
+// TinyLFU is a TinyLFU-style admission policy: the accesses of the keys are
+// counted approximately in a count-min sketch aged by halving every Window
+// accesses. While the cache holds less than Capacity items every fetched
+// key is admitted, after that only the keys accessed at least MinFrequency
+// times within the window, the LRU evicts among the admitted ones.
+type TinyLFU struct {
+	Capacity     int64
+	MinFrequency uint8
+	Window       int
+
+	admitted uint64
+	rejected uint64
+
+	sync.Mutex
+	counters [sketchDepth][]uint8
+	accesses int
+}
+
+// NewTinyLFU returns the TinyLFU of a cache of capacity items, the window
+// is 10x the capacity as the TinyLFU paper suggests
+func NewTinyLFU(capacity int64) *TinyLFU {
+	t := &TinyLFU{
+		Capacity:     capacity,
+		MinFrequency: 2,
+		Window:       int(capacity) * 10,
+	}
+	width := nextPow2(int(capacity))
+	for i := range t.counters {
+		t.counters[i] = make([]uint8, width)
+	}
+	return t
+}
+
+func nextPow2(n int) int {
+	p := sketchMinWidth
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+func (t *TinyLFU) indexes(key string) (idx [sketchDepth]int) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)
+	mask := uint32(len(t.counters[0]) - 1)
+	for i := range idx {
+		idx[i] = int((h1 + uint32(i)*h2) & mask)
+	}
+	return
+}
+
+// Record counts an access of key
+func (t *TinyLFU) Record(key string) {
+	idx := t.indexes(key)
+	t.Lock()
+	defer t.Unlock()
+	for i, j := range idx {
+		if t.counters[i][j] < sketchMaxCounter {
+			t.counters[i][j]++
+		}
+	}
+	t.accesses++
+	if t.Window > 0 && t.accesses >= t.Window {
+		t.age()
+	}
+}
+
+// age halves all the counters so the old popularity fades
+func (t *TinyLFU) age() {
+	for i := range t.counters {
+		for j := range t.counters[i] {
+			t.counters[i][j] >>= 1
+		}
+	}
+	t.accesses = 0
+}
+
+// Frequency is the estimated accesses of key within the window
+func (t *TinyLFU) Frequency(key string) uint8 {
+	idx := t.indexes(key)
+	t.Lock()
+	defer t.Unlock()
+	freq := uint8(sketchMaxCounter)
+	for i, j := range idx {
+		if t.counters[i][j] < freq {
+			freq = t.counters[i][j]
+		}
+	}
+	return freq
+}
+
+// Admit tells if key fetched should be put into cache
+func (t *TinyLFU) Admit(cache *ccache.Cache, key string) bool {
+	if int64(cache.ItemCount()) < t.Capacity || t.Frequency(key) >= t.MinFrequency {
+		atomic.AddUint64(&t.admitted, 1)
+		return true
+	}
+	atomic.AddUint64(&t.rejected, 1)
+	return false
+}
+
+// Stats returns the keys admitted and rejected
+func (t *TinyLFU) Stats() (admitted, rejected uint64) {
+	return atomic.LoadUint64(&t.admitted), atomic.LoadUint64(&t.rejected)
+}
+
+// admissionOf returns the admission policy of the cache named name
+func admissionOf(name string) *TinyLFU {
+	if name == cacheItem {
+		return ItemCacheAdmission
+	}
+	return nil
+}
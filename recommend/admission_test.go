@@ -0,0 +1,57 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/karlseguin/ccache/v2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTinyLFU(t *testing.T) {
+	defer func(a *TinyLFU) { ItemCacheAdmission = a }(ItemCacheAdmission)
+
+	Convey("tinyLFU sketch", t, func() {
+		lfu := NewTinyLFU(64)
+		lfu.Window = 100
+		for i := 0; i < 5; i++ {
+			lfu.Record("hot")
+		}
+		So(lfu.Frequency("hot"), ShouldEqual, 5)
+		So(lfu.Frequency("cold"), ShouldEqual, 0)
+		for i := 0; i < 95; i++ {
+			lfu.Record(fmt.Sprint("scan", i))
+		}
+		So(lfu.Frequency("hot"), ShouldBeLessThan, 5)
+	})
+
+	Convey("scan does not evict the hot items", t, func() {
+		ctx := context.Background()
+		cache := ccache.New(ccache.Configure().MaxSize(4).ItemsToPrune(1))
+		ItemCacheAdmission = NewTinyLFU(4)
+		ItemCacheAdmission.Window = 1000
+		fetch := func(itemId int) {
+			_, err := fetchItemFeature(ctx, cache, idPredictor{}, &Sample{ItemId: itemId})
+			So(err, ShouldBeNil)
+		}
+		for itemId := 1; itemId <= 4; itemId++ {
+			fetch(itemId)
+		}
+		for itemId := 100; itemId < 200; itemId++ {
+			fetch(itemId)
+		}
+		admitted, rejected := ItemCacheAdmission.Stats()
+		So(admitted, ShouldEqual, 4)
+		So(rejected, ShouldEqual, 100)
+		for itemId := 1; itemId <= 4; itemId++ {
+			So(cache.Get(strconv.Itoa(itemId)) != nil, ShouldBeTrue)
+		}
+
+		// accessed again, the item is popular enough
+		fetch(150)
+		admitted, _ = ItemCacheAdmission.Stats()
+		So(admitted, ShouldEqual, 5)
+	})
+}
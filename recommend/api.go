@@ -1,20 +1,105 @@
 package recommend
 
 import (
+	"context"
 	"embed"
-	"github.com/gin-gonic/gin"
+	"fmt"
 	"io/fs"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 type RecApiRequest struct {
 	UserId     int   `json:"userId"`
 	ItemIdList []int `json:"itemIdList"`
+	// UserKey and ItemKeyList are the external ids mapped by UserIds and
+	// ItemIds, the ItemKeyList items are appended to the ItemIdList. An
+	// unknown UserKey is ranked as the user 0 of no features.
+	UserKey     string   `json:"userKey,omitempty"`
+	ItemKeyList []string `json:"itemKeyList,omitempty"`
+	// Items are scored with their inline features, see InlineItem
+	Items []InlineItem `json:"items,omitempty"`
+	// Context is the context features of the request, see CtxFeatureWidth
+	Context Tensor `json:"context,omitempty"`
+	// Version pins the request to a model version if predict is a ModelRegistry
+	Version string `json:"version,omitempty"`
+	// Epsilon overrides the Exploration with EpsilonGreedy if > 0
+	Epsilon float64 `json:"epsilon,omitempty"`
+	// Diversity reorders the result by ReRankMMR with lambda = 1 - Diversity if > 0
+	Diversity float32 `json:"diversity,omitempty"`
+	// Debug returns the DebugTrace of all the items in the response, the
+	// request must carry DebugToken in DebugTokenHeader like the /debug api
+	Debug bool `json:"debug,omitempty"`
 }
 
 type RecApiResponse struct {
 	ItemScoreList []ItemScore `json:"itemScoreList"`
+	Version       string      `json:"version,omitempty"`
+	Debug         *DebugTrace `json:"debug,omitempty"`
+}
+
+// candidates is the number of the items of req of all the forms
+func (req *RecApiRequest) candidates() int {
+	return len(req.ItemIdList) + len(req.ItemKeyList) + len(req.Items)
+}
+
+// serveRecRequest ranks req as the recommend api, code is the http status
+func serveRecRequest(ctx context.Context, predict Predictor, req RecApiRequest) (resp RecApiResponse, code int, err error) {
+	if err = mapRequestIds(&req); err != nil {
+		return resp, 400, err
+	}
+	model := predict
+	if registry, ok := predict.(*ModelRegistry); ok {
+		// resolve once to use the same version during the whole request
+		var meta ModelMeta
+		if model, meta, err = registry.Resolve(req.Version); err != nil {
+			return resp, 400, err
+		}
+		resp.Version = meta.Version
+		ctx = WithModelVersion(ctx, meta.Version)
+	}
+	if len(req.ItemIdList) == 0 && len(req.Items) == 0 {
+		retriever, ok := model.(Retriever)
+		if !ok {
+			return resp, 400, fmt.Errorf("itemIdList is empty")
+		}
+		if req.ItemIdList, err = retriever.Retrieve(ctx, req.UserId, RetrieveSize); err != nil {
+			return resp, 500, err
+		}
+		if len(req.ItemIdList) == 0 {
+			resp.ItemScoreList = []ItemScore{}
+			return resp, 200, nil
+		}
+	}
+	if err = validateInlineItems(req.Items); err != nil {
+		return resp, 400, err
+	}
+	if req.Context != nil {
+		if err = checkCtxFeatures(req.Context); err != nil {
+			return resp, 400, err
+		}
+		ctx = WithCtxFeatures(ctx, req.Context)
+	}
+	if req.Epsilon > 0 {
+		ctx = WithExploration(ctx, NewEpsilonGreedy(req.Epsilon, time.Now().UnixNano()))
+	}
+	if req.Debug {
+		ctx, resp.Debug = WithDebug(ctx, nil, nil)
+	}
+	scores, err := RankInline(ctx, model, req.UserId, req.ItemIdList, req.Items)
+	if err != nil {
+		return resp, 500, err
+	}
+	if req.Diversity > 0 {
+		scores = ReRankMMR(scores, 1-req.Diversity, 0)
+	}
+	externalItemKeys(scores)
+	resp.ItemScoreList = scores
+	return resp, 200, nil
 }
 
 // StartHttpApi starts the http api for recommendation
@@ -25,7 +110,15 @@ type RecApiResponse struct {
 //	  --data '{"userId":107,"itemIdList":[1,2,39]}' \
 //	  http://localhost:8080/api/v1/recommend
 func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (err error) {
+	if CacheSnapshotPath != "" {
+		restoreCacheSnapshot(CacheSnapshotPath)
+	}
 	engine := gin.Default()
+	// let the featurers see the deadline and the trace of the request ctx
+	engine.ContextWithFallback = true
+	if IsEdgeProfile() {
+		engine.Use(edgeApiFilter(path))
+	}
 	engine.GET("/service/useritems", func(c *gin.Context) {
 		querys := c.Request.URL.Query()
 
@@ -51,6 +144,7 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 				c.JSON(500, gin.H{"error": err.Error()})
 				return
 			}
+			aggregateUsers(c, predict, &users)
 			c.JSON(200, users)
 		} else {
 			c.JSON(200, "do not support feature overview")
@@ -82,6 +176,7 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 				c.JSON(500, gin.H{"error": err.Error()})
 				return
 			}
+			aggregateItems(c, predict, &users)
 			c.JSON(200, users)
 		} else {
 			c.JSON(200, "do not support item overview")
@@ -96,6 +191,13 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 				c.JSON(500, gin.H{"error": err.Error()})
 				return
 			}
+			if users.LabelBalance == nil {
+				if users.LabelBalance, err = cachedLabelBalance(c, predict); err != nil {
+					c.JSON(500, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			users.Training = LastProgress()
 			c.JSON(200, users)
 		} else {
 			c.JSON(200, "do not support overview")
@@ -103,6 +205,115 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 		return
 	})
 
+	engine.GET("/service/featurestats", func(c *gin.Context) {
+		stats := LastFeatureStats()
+		if stats == nil {
+			c.JSON(200, "no feature stats, sample first")
+			return
+		}
+		c.JSON(200, stats)
+	})
+
+	engine.GET("/service/modelhistory", func(c *gin.Context) {
+		var history ModelHistoryOverview = ModelHistory
+		if overview, ok := predict.(ModelHistoryOverview); ok {
+			history = overview
+		}
+		if history == nil {
+			c.JSON(200, "do not support model history")
+			return
+		}
+		records, err := history.GetModelHistory(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, records)
+	})
+
+	// OpenAPI 3 document of this api, generate client SDKs from it
+	engine.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(200, OpenAPISpec(path))
+	})
+
+	// Prometheus text exposition of the serving and training metrics
+	engine.GET("/metrics", gin.WrapH(Collector()))
+
+	if InvalidationSecret != "" {
+		engine.POST("/service/invalidate", InvalidationHandler(InvalidationSecret))
+	}
+
+	engine.GET("/service/history", func(c *gin.Context) {
+		if RecommendHistory == nil {
+			c.JSON(200, "do not support recommend history")
+			return
+		}
+		userId, err := strconv.Atoi(c.Query("user"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid user: " + err.Error()})
+			return
+		}
+		var since int64
+		if data := c.Query("since"); data != "" {
+			if since, err = strconv.ParseInt(data, 10, 64); err != nil {
+				c.JSON(400, gin.H{"error": "invalid since: " + err.Error()})
+				return
+			}
+		}
+		records, err := RecommendHistory.History(c, userId, since)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"userId": userId, "records": records})
+	})
+
+	// the debug api reveals the features and the behavior of any user, it
+	// is served only with DebugToken
+	if DebugToken != "" {
+		DebugRoutes(engine.Group("/debug", DebugAuth(DebugToken)), predict)
+	}
+
+	// the items similar to the item by the item embedding:
+	//	curl "http://localhost:8080/service/similar?item=1&k=10"
+	engine.GET("/service/similar", func(c *gin.Context) {
+		itemId, err := strconv.Atoi(c.Query("item"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid item: " + err.Error()})
+			return
+		}
+		k := 10
+		if data := c.Query("k"); data != "" {
+			if k, err = strconv.Atoi(data); err != nil {
+				c.JSON(400, gin.H{"error": "invalid k: " + err.Error()})
+				return
+			}
+			if k <= 0 {
+				c.JSON(400, gin.H{"error": "invalid k: " + data})
+				return
+			}
+		}
+		itemScores, err := SimilarItems(c, itemId, k)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, itemScores)
+	})
+
+	engine.GET("/service/models", func(c *gin.Context) {
+		if registry, ok := predict.(*ModelRegistry); ok {
+			c.JSON(200, registry.Versions())
+		} else {
+			c.JSON(200, "do not support model registry")
+		}
+	})
+
+	// signed as the invalidation, disabled without InvalidationSecret
+	if registry, ok := predict.(*ModelRegistry); ok && InvalidationSecret != "" {
+		engine.POST("/service/models/activate", ActivationHandler(registry, InvalidationSecret))
+	}
+
 	engine.Any(path, func(c *gin.Context) {
 		// bind request to RecApiRequest
 		var (
@@ -112,23 +323,49 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
-		if len(req.ItemIdList) == 0 {
-			// todo: some default recall algorithm
-			c.JSON(400, gin.H{"error": "itemIdList is empty"})
+		// the trace reveals the features of the user and the items
+		if req.Debug && !debugAuthorized(c, DebugToken) {
+			c.JSON(401, gin.H{"error": "invalid debug token"})
 			return
-		} else {
-			resp := RecApiResponse{}
-			// get features in request from gin Context
-			scores, err := Rank(c, predict, req.UserId, req.ItemIdList)
+		}
+		meta := requestMetaOfHttp(c)
+		c.Header(RequestIdHeader, meta.RequestId)
+		c.Request = c.Request.WithContext(WithRequestMeta(c.Request.Context(), meta))
+		if Quotas != nil {
+			err := Quotas.Allow(meta.Tenant, meta.Surface, req.candidates())
 			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
+				c.JSON(429, gin.H{"error": err.Error()})
 				return
 			}
-			resp.ItemScoreList = scores
-			c.JSON(200, resp)
+		}
+		if extractor, ok := Tracing.(TraceExtractor); ok {
+			c.Request = c.Request.WithContext(extractor.Extract(c.Request.Context(), c.Request.Header))
+		}
+		// get features in request from gin Context
+		start := time.Now()
+		resp, code, err := serveRecRequest(c, predict, req)
+		if RequestLog != nil {
+			RequestLog.LogRequest(start, req, resp, err)
+		}
+		if err != nil {
+			if code == 500 {
+				Notify(EventServingDegraded, map[string]interface{}{"error": err.Error()})
+			}
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
+		if err = RecordHistory(c, req.UserId, resp.ItemScoreList); err != nil {
+			logOf(c).Errorf("record history of user %d error: %v", req.UserId, err)
+		}
+		if err = RecordImpressions(c, req.UserId, resp.ItemScoreList); err != nil {
+			logOf(c).Errorf("record impressions of user %d error: %v", req.UserId, err)
+		}
+		c.JSON(code, resp)
 	})
+	if efs == nil {
+		// no dashboard, e.g. edge build
+		return engine.Run(addr)
+	}
 	var assetsFs, rootFs fs.FS
 	assetsFs, err = fs.Sub(efs, "frontend/website/assets")
 	if err != nil {
@@ -151,3 +388,128 @@ func StartHttpApi(predict Predictor, path string, addr string, efs *embed.FS) (e
 
 	return engine.Run(addr)
 }
+
+// DebugRoutes registers the debug api of predict on group, e.g. the /debug
+// group of StartHttpApi guarded by DebugAuth
+func DebugRoutes(group gin.IRoutes, predict Predictor) {
+	// debug sample feature breakdown by:
+	//	curl -H "X-Debug-Token: $TOKEN" "http://localhost:8080/debug/sample?user=107&item=1"
+	group.GET("/sample", func(c *gin.Context) {
+		userId, err := strconv.Atoi(c.Query("user"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid user: " + err.Error()})
+			return
+		}
+		itemId, err := strconv.Atoi(c.Query("item"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid item: " + err.Error()})
+			return
+		}
+		sd, err := DebugSample(c, predict, userId, itemId)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, sd)
+	})
+
+	// explain the scores by feature groups:
+	//	curl -H "X-Debug-Token: $TOKEN" "http://localhost:8080/debug/explain?user=107&items=1,2,39"
+	group.GET("/explain", func(c *gin.Context) {
+		userId, err := strconv.Atoi(c.Query("user"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid user: " + err.Error()})
+			return
+		}
+		var itemIds []int
+		for _, str := range strings.Split(c.Query("items"), ",") {
+			itemId, err := strconv.Atoi(str)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "invalid items: " + err.Error()})
+				return
+			}
+			itemIds = append(itemIds, itemId)
+		}
+		explanations, err := RankExplain(c, predict, userId, itemIds)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, explanations)
+	})
+
+	// inspect what is recommended to the user and why:
+	//	curl -H "X-Debug-Token: $TOKEN" "http://localhost:8080/debug/user?user=107&k=10"
+	group.GET("/user", func(c *gin.Context) {
+		userId, err := strconv.Atoi(c.Query("user"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid user: " + err.Error()})
+			return
+		}
+		var k int
+		if data := c.Query("k"); data != "" {
+			if k, err = strconv.Atoi(data); err != nil {
+				c.JSON(400, gin.H{"error": "invalid k: " + err.Error()})
+				return
+			}
+		}
+		var itemIds []int
+		if data := c.Query("items"); data != "" {
+			for _, str := range strings.Split(data, ",") {
+				itemId, err := strconv.Atoi(str)
+				if err != nil {
+					c.JSON(400, gin.H{"error": "invalid items: " + err.Error()})
+					return
+				}
+				itemIds = append(itemIds, itemId)
+			}
+		}
+		ui, err := InspectUser(c, predict, userId, itemIds, k)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, ui)
+	})
+
+	// the users similar to the user by the user embedding, debug only as
+	// it tells the user ids of the look-alike audience:
+	//	curl -H "X-Debug-Token: $TOKEN" "http://localhost:8080/debug/similarusers?user=107&k=10"
+	group.GET("/similarusers", func(c *gin.Context) {
+		userId, err := strconv.Atoi(c.Query("user"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid user: " + err.Error()})
+			return
+		}
+		k := 10
+		if data := c.Query("k"); data != "" {
+			if k, err = strconv.Atoi(data); err != nil {
+				c.JSON(400, gin.H{"error": "invalid k: " + err.Error()})
+				return
+			}
+			if k <= 0 {
+				c.JSON(400, gin.H{"error": "invalid k: " + data})
+				return
+			}
+		}
+		userScores, err := SimilarUsers(c, userId, k)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, userScores)
+	})
+}
+
+// edgeApiFilter only allows the api subset of the edge profile
+func edgeApiFilter(rankPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if p == rankPath || p == "/openapi.json" || p == "/metrics" ||
+			(p == "/service/models" && c.Request.Method == http.MethodGet) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(404, gin.H{"error": ErrEdgeProfile.Error()})
+	}
+}
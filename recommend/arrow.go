@@ -0,0 +1,327 @@
+package recommend
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/karlseguin/ccache/v2"
+)
+
+// Column names of the Arrow IPC streams. In Python:
+//
+//	df = pyarrow.ipc.open_stream(f).read_pandas()
+//	x = numpy.stack(df["x"])
+const (
+	ArrowXColumn       = "x"
+	ArrowYColumn       = "y"
+	ArrowIdColumn      = "id"
+	ArrowFeatureColumn = "feature"
+)
+
+var arrowRangeKeys = []string{
+	"user_profile_range", "user_behavior_range", "item_feature_range", "ctx_feature_range",
+	"request_ctx_range", "sparse_range",
+}
+
+func infoRanges(info *SampleInfo) []*[2]int {
+	return []*[2]int{
+		&info.UserProfileRange, &info.UserBehaviorRange,
+		&info.ItemFeatureRange, &info.CtxFeatureRange,
+		&info.RequestCtxRange, &info.SparseRange,
+	}
+}
+
+// float32List wraps x as a fixed_size_list<float32>[width] array without copy
+func float32List(x []float32, width int) *array.FixedSizeList {
+	values := array.NewData(arrow.PrimitiveTypes.Float32, len(x),
+		[]*memory.Buffer{nil, memory.NewBufferBytes(arrow.Float32Traits.CastToBytes(x))}, nil, 0, 0)
+	defer values.Release()
+	data := array.NewData(arrow.FixedSizeListOf(int32(width), arrow.PrimitiveTypes.Float32), len(x)/width,
+		[]*memory.Buffer{nil}, []*array.Data{values}, 0, 0)
+	defer data.Release()
+	return array.NewFixedSizeListData(data)
+}
+
+func float32Array(x []float32) *array.Float32 {
+	data := array.NewData(arrow.PrimitiveTypes.Float32, len(x),
+		[]*memory.Buffer{nil, memory.NewBufferBytes(arrow.Float32Traits.CastToBytes(x))}, nil, 0, 0)
+	defer data.Release()
+	return array.NewFloat32Data(data)
+}
+
+// listValues returns the float32 values of a fixed_size_list<float32> column
+func listValues(col array.Interface) (values []float32, width int, err error) {
+	list, ok := col.(*array.FixedSizeList)
+	if !ok {
+		err = fmt.Errorf("not a fixed_size_list column: %s", col.DataType())
+		return
+	}
+	width = int(list.DataType().(*arrow.FixedSizeListType).Len())
+	child, ok := list.ListValues().(*array.Float32)
+	if !ok {
+		err = fmt.Errorf("not a float32 list column: %s", col.DataType())
+		return
+	}
+	values = child.Float32Values()
+	if off := list.Data().Offset() * width; off != 0 || len(values) != list.Len()*width {
+		values = values[off : off+list.Len()*width]
+	}
+	return
+}
+
+func writeArrowRecords(w io.Writer, schema *arrow.Schema, rows int, cols func(start, end int) []array.Interface) (err error) {
+	writer := ipc.NewWriter(w, ipc.WithSchema(schema))
+	defer func() {
+		if er := writer.Close(); err == nil {
+			err = er
+		}
+	}()
+	for start := 0; start < rows; start += MiniBatchSize {
+		end := start + MiniBatchSize
+		if end > rows {
+			end = rows
+		}
+		arrs := cols(start, end)
+		rec := array.NewRecord(schema, arrs, int64(end-start))
+		err = writer.Write(rec)
+		rec.Release()
+		for _, a := range arrs {
+			a.Release()
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// WriteArrowSample writes sample as an Arrow IPC stream of record batches of
+// MiniBatchSize rows, with columns "x" fixed_size_list<float32>[XCols] and
+// "y" float32. The SampleInfo ranges are kept in the schema metadata.
+// sample.X is written without copy.
+func WriteArrowSample(w io.Writer, sample *TrainSample) (err error) {
+	if sample.XCols == 0 {
+		return fmt.Errorf("empty sample")
+	}
+	values := make([]string, len(arrowRangeKeys))
+	for i, r := range infoRanges(&sample.Info) {
+		values[i] = fmt.Sprintf("%d,%d", r[0], r[1])
+	}
+	meta := arrow.NewMetadata(arrowRangeKeys, values)
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: ArrowXColumn, Type: arrow.FixedSizeListOf(int32(sample.XCols), arrow.PrimitiveTypes.Float32)},
+		{Name: ArrowYColumn, Type: arrow.PrimitiveTypes.Float32},
+	}, &meta)
+	return writeArrowRecords(w, schema, sample.Rows, func(start, end int) []array.Interface {
+		return []array.Interface{
+			float32List(sample.X[start*sample.XCols:end*sample.XCols], sample.XCols),
+			float32Array(sample.Y[start:end]),
+		}
+	})
+}
+
+// ReadArrowSample reads the TrainSample written by WriteArrowSample or any
+// Arrow IPC stream with the same "x" and "y" columns
+func ReadArrowSample(r io.Reader) (sample *TrainSample, err error) {
+	reader, err := ipc.NewReader(r)
+	if err != nil {
+		return
+	}
+	defer reader.Release()
+	schema := reader.Schema()
+	xIdx, yIdx := schema.FieldIndices(ArrowXColumn), schema.FieldIndices(ArrowYColumn)
+	if len(xIdx) != 1 || len(yIdx) != 1 {
+		err = fmt.Errorf("columns %q and %q are required", ArrowXColumn, ArrowYColumn)
+		return
+	}
+
+	sample = &TrainSample{}
+	meta := schema.Metadata()
+	for i, r := range infoRanges(&sample.Info) {
+		if k := meta.FindKey(arrowRangeKeys[i]); k >= 0 {
+			if _, err = fmt.Sscanf(meta.Values()[k], "%d,%d", &r[0], &r[1]); err != nil {
+				err = fmt.Errorf("bad %s metadata: %v", arrowRangeKeys[i], err)
+				return nil, err
+			}
+		}
+	}
+	for reader.Next() {
+		rec := reader.Record()
+		x, width, er := listValues(rec.Column(xIdx[0]))
+		if er != nil {
+			return nil, er
+		}
+		y, ok := rec.Column(yIdx[0]).(*array.Float32)
+		if !ok {
+			return nil, fmt.Errorf("column %q is not float32", ArrowYColumn)
+		}
+		sample.XCols = width
+		sample.X = append(sample.X, x...)
+		sample.Y = append(sample.Y, y.Float32Values()...)
+		sample.Rows += int(rec.NumRows())
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+	if sample.Rows*sample.XCols != len(sample.X) || sample.Rows != len(sample.Y) {
+		return nil, fmt.Errorf("sample size not match: %d x %d", sample.Rows, sample.XCols)
+	}
+	return
+}
+
+// WriteArrowFeatures writes features as an Arrow IPC stream with columns
+// "id" int64 and "feature" fixed_size_list<float32>, ordered by id
+func WriteArrowFeatures(w io.Writer, features map[int]Tensor) (err error) {
+	var (
+		ids   = make([]int, 0, len(features))
+		width = -1
+	)
+	for id, f := range features {
+		if width == -1 {
+			width = len(f)
+		} else if len(f) != width {
+			return fmt.Errorf("feature width of id %d mismatch: %d:%d", id, width, len(f))
+		}
+		ids = append(ids, id)
+	}
+	if width <= 0 {
+		return fmt.Errorf("empty features")
+	}
+	sort.Ints(ids)
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: ArrowIdColumn, Type: arrow.PrimitiveTypes.Int64},
+		{Name: ArrowFeatureColumn, Type: arrow.FixedSizeListOf(int32(width), arrow.PrimitiveTypes.Float32)},
+	}, nil)
+	return writeArrowRecords(w, schema, len(ids), func(start, end int) []array.Interface {
+		var (
+			idCol = make([]int64, 0, end-start)
+			x     = make([]float32, 0, (end-start)*width)
+		)
+		for _, id := range ids[start:end] {
+			idCol = append(idCol, int64(id))
+			x = append(x, features[id]...)
+		}
+		data := array.NewData(arrow.PrimitiveTypes.Int64, len(idCol),
+			[]*memory.Buffer{nil, memory.NewBufferBytes(arrow.Int64Traits.CastToBytes(idCol))}, nil, 0, 0)
+		defer data.Release()
+		return []array.Interface{array.NewInt64Data(data), float32List(x, width)}
+	})
+}
+
+// ReadArrowFeatures reads the features keyed by the "id" int64 or int32
+// column. The feature of a row is the "feature" fixed_size_list<float32>
+// column if exists, else all the other float32 and float64 columns in the
+// schema order, which is the layout of a pandas DataFrame written by
+// pyarrow. Null values are read as 0.
+func ReadArrowFeatures(r io.Reader) (features map[int]Tensor, err error) {
+	reader, err := ipc.NewReader(r)
+	if err != nil {
+		return
+	}
+	defer reader.Release()
+	schema := reader.Schema()
+	idIdx := schema.FieldIndices(ArrowIdColumn)
+	if len(idIdx) != 1 {
+		err = fmt.Errorf("column %q is required", ArrowIdColumn)
+		return
+	}
+	var featureCols []int
+	if idx := schema.FieldIndices(ArrowFeatureColumn); len(idx) == 1 {
+		featureCols = idx
+	} else {
+		for i, f := range schema.Fields() {
+			switch f.Type.ID() {
+			case arrow.FLOAT32, arrow.FLOAT64:
+				featureCols = append(featureCols, i)
+			}
+		}
+	}
+	if len(featureCols) == 0 {
+		err = fmt.Errorf("no feature column in schema: %s", strings.TrimSpace(schema.String()))
+		return
+	}
+
+	features = make(map[int]Tensor)
+	for reader.Next() {
+		rec := reader.Record()
+		rows := int(rec.NumRows())
+		ids := make([]int, rows)
+		switch col := rec.Column(idIdx[0]).(type) {
+		case *array.Int64:
+			for i, id := range col.Int64Values() {
+				ids[i] = int(id)
+			}
+		case *array.Int32:
+			for i, id := range col.Int32Values() {
+				ids[i] = int(id)
+			}
+		default:
+			return nil, fmt.Errorf("column %q is not int64 or int32", ArrowIdColumn)
+		}
+		batch := make([]Tensor, rows)
+		for _, c := range featureCols {
+			switch col := rec.Column(c).(type) {
+			case *array.FixedSizeList:
+				x, width, er := listValues(col)
+				if er != nil {
+					return nil, er
+				}
+				for i := range batch {
+					batch[i] = append(batch[i], x[i*width:(i+1)*width]...)
+				}
+			case *array.Float32:
+				for i := range batch {
+					var v float32
+					if col.IsValid(i) {
+						v = col.Value(i)
+					}
+					batch[i] = append(batch[i], v)
+				}
+			case *array.Float64:
+				for i := range batch {
+					var v float32
+					if col.IsValid(i) {
+						v = float32(col.Value(i))
+					}
+					batch[i] = append(batch[i], v)
+				}
+			default:
+				return nil, fmt.Errorf("unsupported feature column %q: %s",
+					schema.Field(c).Name, col.DataType())
+			}
+		}
+		for i, id := range ids {
+			features[id] = batch[i]
+		}
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// IngestArrowFeatures puts the features read by ReadArrowFeatures into cache,
+// e.g. UserFeatureCache or ItemFeatureCache, so that they are not fetched from
+// the feature provider until ttl.
+func IngestArrowFeatures(r io.Reader, cache *ccache.Cache, ttl time.Duration) (n int, err error) {
+	if cache == nil {
+		err = fmt.Errorf("feature cache not initialized")
+		return
+	}
+	features, err := ReadArrowFeatures(r)
+	if err != nil {
+		return
+	}
+	for id, f := range features {
+		cache.Set(strconv.Itoa(id), f, ttl)
+	}
+	return len(features), nil
+}
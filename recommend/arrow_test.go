@@ -0,0 +1,78 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestArrow(t *testing.T) {
+	Convey("arrow ipc sample and features", t, func() {
+		Convey("TrainSample roundtrip in batches", func() {
+			batchSize := MiniBatchSize
+			MiniBatchSize = 2
+			defer func() { MiniBatchSize = batchSize }()
+
+			sample := &TrainSample{
+				X:     []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Y:     []float32{0, 1, 0, 1, 1},
+				Rows:  5,
+				XCols: 2,
+				Info:  newSampleInfo(1, 0),
+			}
+			var buf bytes.Buffer
+			So(WriteArrowSample(&buf, sample), ShouldBeNil)
+			got, err := ReadArrowSample(&buf)
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, sample)
+		})
+
+		Convey("features roundtrip", func() {
+			features := map[int]Tensor{3: {3, 0.3}, 1: {1, 0.1}}
+			var buf bytes.Buffer
+			So(WriteArrowFeatures(&buf, features), ShouldBeNil)
+			got, err := ReadArrowFeatures(&buf)
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, features)
+
+			So(WriteArrowFeatures(&buf, map[int]Tensor{1: {1}, 2: {1, 2}}), ShouldNotBeNil)
+		})
+
+		Convey("pandas columns ingested into cache", func() {
+			mem := memory.NewGoAllocator()
+			schema := arrow.NewSchema([]arrow.Field{
+				{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+				{Name: "name", Type: arrow.BinaryTypes.String},
+				{Name: "price", Type: arrow.PrimitiveTypes.Float64},
+			}, nil)
+			b := array.NewRecordBuilder(mem, schema)
+			defer b.Release()
+			b.Field(0).(*array.Int32Builder).AppendValues([]int32{5, 6}, nil)
+			b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b"}, nil)
+			b.Field(2).(*array.Float64Builder).AppendValues([]float64{50, 0}, []bool{true, false})
+			rec := b.NewRecord()
+			defer rec.Release()
+
+			var buf bytes.Buffer
+			w := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+			So(w.Write(rec), ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+
+			resetFeatureCache()
+			n, err := IngestArrowFeatures(&buf, ItemFeatureCache, time.Hour)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			scores, err := Rank(context.Background(), idPredictor{}, 1, []int{5, 6})
+			So(err, ShouldBeNil)
+			So(scores[0].Score, ShouldEqual, 50)
+			So(scores[1].Score, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,210 @@
+package recommend
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+)
+
+// ShuffleBatches controls whether the BatchProvider created by Train
+// shuffles samples on every epoch
+var ShuffleBatches = true
+
+// BatchProvider feeds the training samples to BatchFitter in mini-batches,
+// it can be iterated for multiple epochs.
+//
+//	for epoch := 0; epoch < epochs; epoch++ {
+//		bp.Reset()
+//		for batch, ok := bp.Next(); ok; batch, ok = bp.Next() {
+//			...
+//		}
+//		if err := bp.Err(); err != nil {
+//			return nil, err
+//		}
+//	}
+type BatchProvider interface {
+	// SampleInfo returns the layout of the sample vector
+	SampleInfo() SampleInfo
+	// Len returns the total rows of one epoch, -1 if unknown
+	Len() int
+	// Reset starts a new epoch, samples are reshuffled if shuffling is enabled
+	Reset()
+	// Next returns the next mini-batch of current epoch, ok is false at the
+	// end of the epoch or on an error
+	Next() (batch MiniBatch, ok bool)
+	// Err returns the error stopped Next, the fitter must check it after
+	// every epoch
+	Err() error
+}
+
+// BatchFitter is implemented by the Fitters iterating the samples by
+// themselves. If the Fitter passed to Train implements BatchFitter,
+// FitBatches is used instead of Fit.
+type BatchFitter interface {
+	FitBatches(bp BatchProvider) (PredictAbstract, error)
+}
+
+// MemBatchProvider is a BatchProvider over an in memory TrainSample
+type MemBatchProvider struct {
+	BatchSize int
+	Shuffle   bool
+	Rand      *rand.Rand
+
+	sample *TrainSample
+	index  []int
+	cursor int
+}
+
+// NewMemBatchProvider returns the MemBatchProvider of sample, the batches
+// are shuffled by seed, or randomly if 0
+func NewMemBatchProvider(sample *TrainSample, batchSize int, shuffle bool, seed int64) *MemBatchProvider {
+	bp := &MemBatchProvider{
+		BatchSize: batchSize,
+		Shuffle:   shuffle,
+		Rand:      newSeedRand(seed),
+		sample:    sample,
+		index:     make([]int, sample.Rows),
+	}
+	for i := range bp.index {
+		bp.index[i] = i
+	}
+	bp.Reset()
+	return bp
+}
+
+func (bp *MemBatchProvider) SampleInfo() SampleInfo {
+	return bp.sample.Info
+}
+
+func (bp *MemBatchProvider) Len() int {
+	return bp.sample.Rows
+}
+
+func (bp *MemBatchProvider) Reset() {
+	bp.cursor = 0
+	if bp.Shuffle {
+		bp.Rand.Shuffle(len(bp.index), func(i, j int) {
+			bp.index[i], bp.index[j] = bp.index[j], bp.index[i]
+		})
+	}
+}
+
+func (bp *MemBatchProvider) Next() (batch MiniBatch, ok bool) {
+	if bp.cursor >= len(bp.index) || bp.BatchSize <= 0 {
+		return
+	}
+	end := bp.cursor + bp.BatchSize
+	if end > len(bp.index) {
+		end = len(bp.index)
+	}
+	xCols, tasks := bp.sample.XCols, bp.sample.Tasks
+	batch = newMiniBatch(end-bp.cursor, xCols, tasks)
+	for _, row := range bp.index[bp.cursor:end] {
+		batch.X = append(batch.X, bp.sample.X[row*xCols:(row+1)*xCols]...)
+		batch.Y = append(batch.Y, bp.sample.Y[row])
+		if tasks != 0 {
+			batch.Labels = append(batch.Labels, bp.sample.Labels[row*tasks:(row+1)*tasks]...)
+		}
+		batch.Rows++
+	}
+	bp.cursor = end
+	return batch, true
+}
+
+func (bp *MemBatchProvider) Err() error {
+	return nil
+}
+
+// SpillBatchProvider is a BatchProvider replaying the mini-batches spilled by
+// GetSampleStream, only the order of batches is shuffled.
+type SpillBatchProvider struct {
+	Shuffle bool
+	Rand    *rand.Rand
+
+	path    string
+	info    SampleInfo
+	rows    int
+	offsets []int64
+	order   []int
+	cursor  int
+	f       *os.File
+	err     error
+}
+
+// NewSpillBatchProvider scans the spill file at path to index the batches,
+// they are shuffled by seed, or randomly if 0
+func NewSpillBatchProvider(path string, info SampleInfo, shuffle bool, seed int64) (bp *SpillBatchProvider, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	bp = &SpillBatchProvider{
+		Shuffle: shuffle,
+		Rand:    newSeedRand(seed),
+		path:    path,
+		info:    info,
+		f:       f,
+	}
+	var (
+		offset int64
+		r      = bufio.NewReader(f)
+	)
+	for {
+		batch, er := readMiniBatch(r)
+		if er == io.EOF {
+			break
+		}
+		if er != nil {
+			f.Close()
+			return nil, fmt.Errorf("read spill file %s error: %v", path, er)
+		}
+		bp.offsets = append(bp.offsets, offset)
+		bp.order = append(bp.order, len(bp.order))
+		bp.rows += batch.Rows
+		offset += spillSize(batch)
+	}
+	bp.Reset()
+	return
+}
+
+func (bp *SpillBatchProvider) SampleInfo() SampleInfo {
+	return bp.info
+}
+
+func (bp *SpillBatchProvider) Len() int {
+	return bp.rows
+}
+
+func (bp *SpillBatchProvider) Reset() {
+	bp.cursor = 0
+	if bp.Shuffle {
+		bp.Rand.Shuffle(len(bp.order), func(i, j int) {
+			bp.order[i], bp.order[j] = bp.order[j], bp.order[i]
+		})
+	}
+}
+
+func (bp *SpillBatchProvider) Next() (batch MiniBatch, ok bool) {
+	if bp.err != nil || bp.cursor >= len(bp.order) {
+		return
+	}
+	offset := bp.offsets[bp.order[bp.cursor]]
+	bp.cursor++
+	batch, err := readMiniBatch(io.NewSectionReader(bp.f, offset, 1<<62))
+	if err != nil {
+		bp.err = fmt.Errorf("read spill file %s at %d error: %v", bp.path, offset, err)
+		return MiniBatch{}, false
+	}
+	return batch, true
+}
+
+// Err returns the error of reading a batch, the provider is not usable after
+func (bp *SpillBatchProvider) Err() error {
+	return bp.err
+}
+
+func (bp *SpillBatchProvider) Close() error {
+	return bp.f.Close()
+}
@@ -0,0 +1,88 @@
+package recommend
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemBatchProvider(t *testing.T) {
+	Convey("iterate mini-batches for epochs", t, func() {
+		sample := &TrainSample{
+			X:     []float32{0, 0, 1, 1, 2, 2, 3, 3, 4, 4},
+			Y:     []float32{0, 1, 2, 3, 4},
+			Rows:  5,
+			XCols: 2,
+		}
+		bp := NewMemBatchProvider(sample, 2, true, 0)
+		So(bp.Len(), ShouldEqual, 5)
+		for epoch := 0; epoch < 3; epoch++ {
+			bp.Reset()
+			var (
+				ys    []float64
+				sizes []int
+			)
+			for batch, ok := bp.Next(); ok; batch, ok = bp.Next() {
+				sizes = append(sizes, batch.Rows)
+				for i, y := range batch.Y {
+					// rows are kept together after shuffling
+					So(batch.X[i*2], ShouldEqual, y)
+					So(batch.X[i*2+1], ShouldEqual, y)
+					ys = append(ys, float64(y))
+				}
+			}
+			sort.Float64s(ys)
+			So(ys, ShouldResemble, []float64{0, 1, 2, 3, 4})
+			So(sizes, ShouldResemble, []int{2, 2, 1})
+		}
+	})
+}
+
+func TestSpillBatchProvider(t *testing.T) {
+	Convey("replay the spilled mini-batches", t, func() {
+		path := filepath.Join(t.TempDir(), "spill.bin")
+		sw, err := newSpillWriter(path)
+		So(err, ShouldBeNil)
+		for i := 0; i < 3; i++ {
+			So(sw.Write(MiniBatch{X: []float32{float32(i), float32(i)}, Y: []float32{float32(i)}, Rows: 1, XCols: 2}), ShouldBeNil)
+		}
+		So(sw.Close(), ShouldBeNil)
+
+		bp, err := NewSpillBatchProvider(path, SampleInfo{}, true, 0)
+		So(err, ShouldBeNil)
+		defer bp.Close()
+		So(bp.Len(), ShouldEqual, 3)
+		for epoch := 0; epoch < 2; epoch++ {
+			bp.Reset()
+			var ys []float64
+			for batch, ok := bp.Next(); ok; batch, ok = bp.Next() {
+				So(batch.X[0], ShouldEqual, batch.Y[0])
+				ys = append(ys, float64(batch.Y[0]))
+			}
+			So(bp.Err(), ShouldBeNil)
+			sort.Float64s(ys)
+			So(ys, ShouldResemble, []float64{0, 1, 2})
+		}
+
+		Convey("the read error is not the end of epoch", func() {
+			fi, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			So(os.Truncate(path, fi.Size()-4), ShouldBeNil)
+			bp.Reset()
+			var rows int
+			for batch, ok := bp.Next(); ok; batch, ok = bp.Next() {
+				rows += batch.Rows
+			}
+			So(rows, ShouldBeLessThan, 3)
+			So(bp.Err(), ShouldNotBeNil)
+			_, ok := bp.Next()
+			So(ok, ShouldBeFalse)
+		})
+
+		_, err = NewSpillBatchProvider(filepath.Join(t.TempDir(), "none.bin"), SampleInfo{}, false, 0)
+		So(err, ShouldNotBeNil)
+	})
+}
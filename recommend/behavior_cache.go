@@ -0,0 +1,73 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	// BehaviorCacheTTL is the time the item sequences of UserBehavior are
+	// cached in UserBehaviorCache, 0 disables the cache
+	BehaviorCacheTTL = 10 * time.Minute
+	// BehaviorCacheBucket is the maxTs bucket of the UserBehaviorCache keys,
+	// the lookups of a user with maxTs in the same bucket share the sequence
+	BehaviorCacheBucket = time.Minute
+	// BehaviorCacheTraining caches the lookups of the training samples too.
+	// The cached lookups are of the start of the bucket of maxTs, so no
+	// sample sees the interactions after its own maxTs, but the ones in the
+	// bucket before maxTs are dropped.
+	BehaviorCacheTraining = true
+)
+
+// behaviorBucketTs returns the start of the BehaviorCacheBucket of maxTs,
+// the maxTs of the cached lookups
+func behaviorBucketTs(maxTs int64) int64 {
+	bucket := int64(BehaviorCacheBucket / time.Second)
+	if bucket > 1 && maxTs > 0 {
+		maxTs -= maxTs % bucket
+	}
+	return maxTs
+}
+
+// behaviorCacheKey is the UserBehaviorCache key of userId and maxTs, the
+// prefix "userId:" is dropped by InvalidateUser
+func behaviorCacheKey(userId int, maxTs int64) string {
+	return fmt.Sprintf("%d:%d", userId, behaviorBucketTs(maxTs))
+}
+
+// behaviorCachePrefix is the prefix of all the UserBehaviorCache keys of userId
+func behaviorCachePrefix(userId int) string {
+	return strconv.Itoa(userId) + ":"
+}
+
+// getUserBehavior returns the item sequence of userId by recSysUb through
+// UserBehaviorCache
+func getUserBehavior(ctx context.Context, recSysUb UserBehavior, userId int,
+	maxLen int64, maxPk int64, maxTs int64) (itemSeq []int, err error) {
+	fetch := func(ctx context.Context) (interface{}, error) {
+		ctx, span := startSpan(ctx, "GetUserBehavior")
+		itemSeq, err := recSysUb.GetUserBehavior(ctx, userId, maxLen, maxPk, maxTs)
+		endSpan(span, err)
+		return itemSeq, err
+	}
+	if UserBehaviorCache == nil || BehaviorCacheTTL <= 0 || maxPk >= 0 ||
+		(!BehaviorCacheTraining && inStage(ctx, TrainStage)) {
+		start := time.Now()
+		defer metrics.providerSeconds[cacheUserBehavior].since(start)
+		value, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return value.([]int), nil
+	}
+	// fetch the sequence of the bucket shared by the key, not the exact maxTs
+	// of the first lookup, which the later ones in the bucket must not see
+	maxTs = behaviorBucketTs(maxTs)
+	value, err := fetchCache(ctx, UserBehaviorCache, cacheUserBehavior, behaviorCacheKey(userId, maxTs), BehaviorCacheTTL, fetch)
+	if err != nil {
+		return
+	}
+	return value.([]int), nil
+}
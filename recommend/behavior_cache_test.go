@@ -0,0 +1,71 @@
+package recommend
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingBehavior returns the item sequence of userId counting the lookups
+type countingBehavior struct {
+	lookups int64
+}
+
+func (b *countingBehavior) GetUserBehavior(_ context.Context, userId int, _ int64, _ int64, maxTs int64) ([]int, error) {
+	atomic.AddInt64(&b.lookups, 1)
+	return []int{userId, int(maxTs)}, nil
+}
+
+func TestBehaviorCache(t *testing.T) {
+	defer func(training bool) { BehaviorCacheTraining = training }(BehaviorCacheTraining)
+
+	Convey("behavior cache", t, func() {
+		resetFeatureCache()
+		BehaviorCacheTraining = true
+		ctx := context.Background()
+		ub := &countingBehavior{}
+
+		seq, err := getUserBehavior(ctx, ub, 1, UserBehaviorLen, -1, 120)
+		So(err, ShouldBeNil)
+		So(seq, ShouldResemble, []int{1, 120})
+		// the same minute bucket
+		seq, err = getUserBehavior(ctx, ub, 1, UserBehaviorLen, -1, 150)
+		So(err, ShouldBeNil)
+		So(seq, ShouldResemble, []int{1, 120})
+		So(ub.lookups, ShouldEqual, 1)
+
+		_, _ = getUserBehavior(ctx, ub, 1, UserBehaviorLen, -1, 180)
+		_, _ = getUserBehavior(ctx, ub, 2, UserBehaviorLen, -1, 120)
+		So(ub.lookups, ShouldEqual, 3)
+
+		// the first lookup of a bucket fetches as of the bucket start, no
+		// later sample of the bucket sees beyond its own maxTs
+		seq, err = getUserBehavior(WithStage(ctx, TrainStage), ub, 3, UserBehaviorLen, -1, 170)
+		So(err, ShouldBeNil)
+		So(seq, ShouldResemble, []int{3, 120})
+		seq, err = getUserBehavior(WithStage(ctx, TrainStage), ub, 3, UserBehaviorLen, -1, 130)
+		So(err, ShouldBeNil)
+		So(seq, ShouldResemble, []int{3, 120})
+		So(ub.lookups, ShouldEqual, 4)
+
+		Convey("invalidate", func() {
+			So(InvalidateUser(1), ShouldBeTrue)
+			So(InvalidateUser(1), ShouldBeFalse)
+			_, _ = getUserBehavior(ctx, ub, 1, UserBehaviorLen, -1, 120)
+			So(ub.lookups, ShouldEqual, 5)
+			_, _ = getUserBehavior(ctx, ub, 2, UserBehaviorLen, -1, 120)
+			So(ub.lookups, ShouldEqual, 5)
+		})
+
+		Convey("training opt-out", func() {
+			BehaviorCacheTraining = false
+			seq, err := getUserBehavior(WithStage(ctx, TrainStage), ub, 1, UserBehaviorLen, -1, 150)
+			So(err, ShouldBeNil)
+			So(seq, ShouldResemble, []int{1, 150})
+			So(ub.lookups, ShouldEqual, 5)
+			BehaviorCacheTraining = true
+		})
+	})
+}
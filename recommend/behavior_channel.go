@@ -0,0 +1,62 @@
+package recommend
+
+import (
+	"context"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+)
+
+// MultiBehavior is UserBehavior of several behavior types, e.g. "click",
+// "cart" and "purchase". The sequences of BehaviorChannels are encoded into
+// their own ranges of the sample vector, see SampleInfo.BehaviorChannelRanges,
+// so the model learns the different signal strength of them. The limits are
+// the same as UserBehavior and apply to each sequence.
+type MultiBehavior interface {
+	GetUserBehaviors(ctx context.Context, userId int,
+		maxLen int64, maxPk int64, maxTs int64) (channels map[string][]int, err error)
+}
+
+// BehaviorChannels are the behavior types of MultiBehavior encoded in order,
+// each into ItemEmbDim*UserBehaviorLen columns after the CtxFeatureRange. The
+// columns are zeros if MultiBehavior is not implemented. Must be the same in
+// Train and predict.
+var BehaviorChannels []string
+
+// BehaviorChannelRange is the range of a behavior channel in the sample vector
+type BehaviorChannelRange struct {
+	Name  string
+	Range [2]int // [start, end)
+}
+
+// behaviorChannelsWidth is the width of all the behavior channel ranges
+func behaviorChannelsWidth() int {
+	return len(BehaviorChannels) * ItemEmbDim * UserBehaviorLen
+}
+
+// getBehaviorChannels fills the item embeddings of the BehaviorChannels
+// sequences of userId one after another
+func getBehaviorChannels(ctx context.Context, recSysMb MultiBehavior, itemFeatureCache *ccache.Cache,
+	featureProvider BasicFeatureProvider, userId int, maxTs int64) (chTensor Tensor, err error) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "GetUserBehaviors")
+	channels, err := recSysMb.GetUserBehaviors(ctx, userId, UserBehaviorLen, -1, maxTs)
+	endSpan(span, err)
+	metrics.providerSeconds[cacheUserBehavior].since(start)
+	if err != nil {
+		return
+	}
+	chTensor = make(Tensor, behaviorChannelsWidth())
+	for c, name := range BehaviorChannels {
+		block := chTensor[c*ItemEmbDim*UserBehaviorLen : (c+1)*ItemEmbDim*UserBehaviorLen]
+		for i, itemId := range channels[name] {
+			if i == UserBehaviorLen {
+				break
+			}
+			if itemEmb, ok := itemEmbeddingOf(ctx, itemFeatureCache, featureProvider, itemId); ok {
+				copy(block[i*ItemEmbDim:], itemEmb)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// multiPredictor clicked items 1 and 2, and purchased item 3
+type multiPredictor struct {
+	idPredictor
+}
+
+func (multiPredictor) GetUserBehaviors(context.Context, int, int64, int64, int64) (map[string][]int, error) {
+	return map[string][]int{"click": {1, 2}, "purchase": {3}}, nil
+}
+
+func TestBehaviorChannels(t *testing.T) {
+	defer func(m word2vec.EmbeddingMap32, channels []string) {
+		itemEmbeddingMap.store(m)
+		BehaviorChannels = channels
+	}(itemEmbeddingMap.load(), BehaviorChannels)
+
+	Convey("behavior channels in their own ranges", t, func() {
+		resetFeatureCache()
+		emb := func(v float32) []float32 {
+			e := make([]float32, ItemEmbDim)
+			e[0] = v
+			return e
+		}
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": emb(1), "2": emb(2), "3": emb(3)})
+		BehaviorChannels = []string{"purchase", "cart", "click"}
+
+		vec, uWidth, iWidth, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache, multiPredictor{}, &Sample{UserId: 1, ItemId: 2})
+		So(err, ShouldBeNil)
+		info := newSampleInfo(uWidth, iWidth)
+		So(info.BehaviorChannelRanges, ShouldHaveLength, 3)
+		So(info.BehaviorChannelRanges[0].Name, ShouldEqual, "purchase")
+		So(info.BehaviorChannelRanges[0].Range[0], ShouldEqual, info.CtxFeatureRange[1])
+		So(info.BehaviorChannelRanges[2].Range[1], ShouldEqual, len(vec))
+		So(vec[info.CtxFeatureRange[0]], ShouldEqual, 2)
+
+		purchase := vec[info.BehaviorChannelRanges[0].Range[0]:info.BehaviorChannelRanges[0].Range[1]]
+		So(purchase[0], ShouldEqual, 3)
+		So(purchase[ItemEmbDim], ShouldEqual, 0)
+		cart := vec[info.BehaviorChannelRanges[1].Range[0]:info.BehaviorChannelRanges[1].Range[1]]
+		So(cart, ShouldResemble, make([]float32, ItemEmbDim*UserBehaviorLen))
+		click := vec[info.BehaviorChannelRanges[2].Range[0]:info.BehaviorChannelRanges[2].Range[1]]
+		So(click[0], ShouldEqual, 1)
+		So(click[ItemEmbDim], ShouldEqual, 2)
+
+		// zeros if not implemented
+		vec, _, _, err = GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache, idPredictor{}, &Sample{UserId: 1, ItemId: 2})
+		So(err, ShouldBeNil)
+		So(vec, ShouldHaveLength, info.BehaviorChannelRanges[2].Range[1])
+
+		sd, err := DebugSample(context.Background(), multiPredictor{}, 1, 2)
+		So(err, ShouldBeNil)
+		So(sd.Segments, ShouldHaveLength, 7)
+		So(sd.Segments[4].Name, ShouldEqual, "Behavior:purchase")
+		So(sd.Segments[4].Source, ShouldEqual, SourceProvider)
+		So(sd.Segments[4].Values[0], ShouldEqual, 3)
+	})
+}
@@ -0,0 +1,85 @@
+package recommend
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+)
+
+// BehaviorEvent is an item the user interacted with at Timestamp in seconds
+type BehaviorEvent struct {
+	ItemId    int
+	Timestamp int64
+}
+
+// TimedUserBehavior is UserBehavior with the time of the interactions. If
+// implemented, it is used instead of UserBehavior, and the recency of every
+// position is encoded in the UserBehaviorRange if BehaviorTimeFeatures.
+type TimedUserBehavior interface {
+	GetUserBehaviorEvents(ctx context.Context, userId int,
+		maxLen int64, maxPk int64, maxTs int64) (events []BehaviorEvent, err error)
+}
+
+var (
+	// BehaviorTimeFeatures appends UserBehaviorLen recency features to the
+	// item embeddings in the UserBehaviorRange, one per position. Must be the
+	// same in Train and predict.
+	BehaviorTimeFeatures bool
+
+	// BehaviorTimeBuckets are the upper bounds in seconds of the time since
+	// the interaction bucketized by the recency features. The recency of
+	// bucket b of n buckets is (n+1-b)/(n+1), which is 1 for the newest bucket
+	// and 0 for the empty positions.
+	BehaviorTimeBuckets = []int64{60, 3600, 86400, 7 * 86400, 30 * 86400}
+)
+
+// userBehaviorWidth is the width of the UserBehaviorRange
+func userBehaviorWidth() int {
+	if BehaviorTimeFeatures {
+		return (ItemEmbDim + 1) * UserBehaviorLen
+	}
+	return ItemEmbDim * UserBehaviorLen
+}
+
+// behaviorRecency returns the bucketized recency of an interaction at ts
+func behaviorRecency(now, ts int64) float32 {
+	var (
+		delta = now - ts
+		n     = len(BehaviorTimeBuckets)
+	)
+	b := sort.Search(n, func(i int) bool { return delta <= BehaviorTimeBuckets[i] })
+	return float32(n+1-b) / float32(n+1)
+}
+
+// getTimedBehavior fills the item embeddings of the events of userId before
+// maxTs and their recency relative to maxTs into the user behavior tensor
+func getTimedBehavior(ctx context.Context, recSysTb TimedUserBehavior, itemFeatureCache *ccache.Cache,
+	featureProvider BasicFeatureProvider, userId int, maxTs int64) (ubTensor Tensor, err error) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "GetUserBehaviorEvents")
+	events, err := recSysTb.GetUserBehaviorEvents(ctx, userId, UserBehaviorLen, -1, maxTs)
+	endSpan(span, err)
+	metrics.providerSeconds[cacheUserBehavior].since(start)
+	if err != nil {
+		return
+	}
+	now := maxTs
+	if now <= 0 {
+		now = time.Now().Unix()
+	}
+	ubTensor = make(Tensor, userBehaviorWidth())
+	for i, event := range events {
+		if i == UserBehaviorLen {
+			break
+		}
+		if itemEmb, ok := itemEmbeddingOf(ctx, itemFeatureCache, featureProvider, event.ItemId); ok {
+			copy(ubTensor[i*ItemEmbDim:], itemEmb)
+		}
+		if BehaviorTimeFeatures {
+			ubTensor[ItemEmbDim*UserBehaviorLen+i] = behaviorRecency(now, event.Timestamp)
+		}
+	}
+	return
+}
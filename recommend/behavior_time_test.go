@@ -0,0 +1,61 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// timedPredictor interacted with item 1 a minute ago and item 2 a month ago
+type timedPredictor struct {
+	idPredictor
+}
+
+func (timedPredictor) GetUserBehaviorEvents(_ context.Context, _ int, _, _, maxTs int64) ([]BehaviorEvent, error) {
+	return []BehaviorEvent{{ItemId: 1, Timestamp: maxTs - 30}, {ItemId: 2, Timestamp: maxTs - 40*86400}}, nil
+}
+
+func TestBehaviorTimeFeatures(t *testing.T) {
+	defer func(m word2vec.EmbeddingMap32, b bool) {
+		itemEmbeddingMap.store(m)
+		BehaviorTimeFeatures = b
+	}(itemEmbeddingMap.load(), BehaviorTimeFeatures)
+
+	Convey("bucketized recency", t, func() {
+		So(behaviorRecency(100, 100), ShouldEqual, 1)
+		So(behaviorRecency(100, 40), ShouldEqual, 1)
+		So(behaviorRecency(100, 39), ShouldEqual, float32(5)/6)
+		So(behaviorRecency(100*86400, 0), ShouldEqual, float32(1)/6)
+	})
+
+	Convey("recency in the user behavior block", t, func() {
+		ones := make([]float32, ItemEmbDim)
+		for i := range ones {
+			ones[i] = 1
+		}
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": ones, "2": ones})
+		for _, timeFeatures := range []bool{false, true} {
+			resetFeatureCache()
+			BehaviorTimeFeatures = timeFeatures
+			vec, uWidth, iWidth, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache,
+				timedPredictor{}, &Sample{UserId: 1, ItemId: 3, Timestamp: 1e9})
+			So(err, ShouldBeNil)
+			info := newSampleInfo(uWidth, iWidth)
+			So(vec, ShouldHaveLength, info.CtxFeatureRange[1])
+			ub := vec[info.UserBehaviorRange[0]:info.UserBehaviorRange[1]]
+			So(ub[0], ShouldEqual, 1)
+			So(ub[ItemEmbDim], ShouldEqual, 1)
+			if !timeFeatures {
+				So(ub, ShouldHaveLength, ItemEmbDim*UserBehaviorLen)
+				continue
+			}
+			So(ub, ShouldHaveLength, (ItemEmbDim+1)*UserBehaviorLen)
+			recency := ub[ItemEmbDim*UserBehaviorLen:]
+			So(recency[0], ShouldEqual, 1)
+			So(recency[1], ShouldEqual, float32(1)/6)
+			So(recency[2], ShouldEqual, 0)
+		}
+	})
+}
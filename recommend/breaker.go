@@ -0,0 +1,211 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProviderBreaker retries the failed user and item feature fetches with
+// backoff, and stops calling the provider for OpenTimeout after
+// FailureThreshold consecutive failures, so a flapping feature store does
+// not make every sample wait for the full timeout. The fetches rejected
+// fail with ErrCircuitOpen and are predicted with DefaultUserFeature and
+// DefaultItemFeature if not nil. nil means disabled.
+var ProviderBreaker *BreakerPolicy
+
+// ErrCircuitOpen is the error of the fetches rejected by ProviderBreaker
+var ErrCircuitOpen = errors.New("feature provider circuit open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	// BreakerHalfOpen lets one fetch probe the provider after OpenTimeout
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+type BreakerPolicy struct {
+	// Retries of a failed fetch, the Backoff before the first retry is
+	// doubled for every next one up to MaxBackoff
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// FailureThreshold is the consecutive failures opening the breaker
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	sync.Mutex
+	breakers map[string]*breaker
+}
+
+// breaker is the state of the fetches of a feature
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	rejected uint64
+	retries  uint64
+}
+
+func NewBreakerPolicy() *BreakerPolicy {
+	return &BreakerPolicy{
+		Retries:          2,
+		Backoff:          10 * time.Millisecond,
+		MaxBackoff:       200 * time.Millisecond,
+		FailureThreshold: 5,
+		OpenTimeout:      10 * time.Second,
+		breakers:         make(map[string]*breaker),
+	}
+}
+
+// BreakerStats of the fetches of a feature, Failures are the consecutive ones
+type BreakerStats struct {
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	Rejected uint64 `json:"rejected"`
+	Retries  uint64 `json:"retries"`
+}
+
+// Stats returns the BreakerStats of the user and item feature fetches
+func (p *BreakerPolicy) Stats() map[string]BreakerStats {
+	p.Lock()
+	defer p.Unlock()
+	stats := make(map[string]BreakerStats, 2)
+	for _, name := range []string{cacheUser, cacheItem} {
+		b := p.breakerOf(name)
+		stats[name] = BreakerStats{
+			State:    b.state.String(),
+			Failures: b.failures,
+			Rejected: b.rejected,
+			Retries:  b.retries,
+		}
+	}
+	return stats
+}
+
+// State returns the BreakerState of the fetches of name
+func (p *BreakerPolicy) State(name string) BreakerState {
+	p.Lock()
+	defer p.Unlock()
+	return p.breakerOf(name).state
+}
+
+func (p *BreakerPolicy) breakerOf(name string) *breaker {
+	if p.breakers == nil {
+		p.breakers = make(map[string]*breaker)
+	}
+	b := p.breakers[name]
+	if b == nil {
+		b = &breaker{}
+		p.breakers[name] = b
+	}
+	return b
+}
+
+// allow tells if a fetch of name could call the provider
+func (p *BreakerPolicy) allow(name string) bool {
+	p.Lock()
+	defer p.Unlock()
+	b := p.breakerOf(name)
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < p.OpenTimeout {
+			b.rejected++
+			return false
+		}
+		b.state, b.probing = BreakerHalfOpen, true
+	case BreakerHalfOpen:
+		if b.probing {
+			b.rejected++
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// record records the result of a fetch of name allowed
+func (p *BreakerPolicy) record(name string, failed bool, retries int) {
+	p.Lock()
+	defer p.Unlock()
+	b := p.breakerOf(name)
+	b.retries += uint64(retries)
+	b.probing = false
+	if !failed {
+		b.state, b.failures = BreakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= p.FailureThreshold {
+		b.state, b.openedAt = BreakerOpen, time.Now()
+	}
+}
+
+// abort releases the probe of a fetch of name cancelled by its ctx
+func (p *BreakerPolicy) abort(name string, retries int) {
+	p.Lock()
+	defer p.Unlock()
+	b := p.breakerOf(name)
+	b.retries += uint64(retries)
+	b.probing = false
+}
+
+// providerFailed tells if err of a fetch is a failure of the provider, the
+// users and items not found and the fetches cancelled by ctx are not
+func providerFailed(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() == nil &&
+		!errors.Is(err, ErrMissingUser) && !errors.Is(err, ErrMissingItem)
+}
+
+// breakerFetch calls fetch of name through ProviderBreaker
+func breakerFetch(ctx context.Context, name string, fetch func(ctx context.Context) (Tensor, error)) (feature Tensor, err error) {
+	p := ProviderBreaker
+	if p == nil {
+		return fetch(ctx)
+	}
+	if !p.allow(name) {
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, name)
+	}
+	backoff, retries := p.Backoff, 0
+	for {
+		feature, err = fetch(ctx)
+		if !providerFailed(ctx, err) || retries >= p.Retries {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		retries++
+		if backoff *= 2; p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+	if ctx.Err() != nil {
+		// neither a success nor a failure of the provider
+		p.abort(name, retries)
+		return
+	}
+	p.record(name, providerFailed(ctx, err), retries)
+	return
+}
@@ -0,0 +1,92 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// flappingPredictor is idPredictor whose item feature store fails while down
+type flappingPredictor struct {
+	idPredictor
+	down  int32
+	calls int64
+}
+
+func (p *flappingPredictor) GetItemFeature(ctx context.Context, itemId int) (Tensor, error) {
+	atomic.AddInt64(&p.calls, 1)
+	if atomic.LoadInt32(&p.down) != 0 {
+		return nil, errors.New("connection refused")
+	}
+	if itemId < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrMissingItem, itemId)
+	}
+	return p.idPredictor.GetItemFeature(ctx, itemId)
+}
+
+func TestProviderBreaker(t *testing.T) {
+	defer func(b *BreakerPolicy) { ProviderBreaker = b }(ProviderBreaker)
+	defer func(f []float32) { DefaultItemFeature = f }(DefaultItemFeature)
+
+	Convey("circuit breaker", t, func() {
+		resetFeatureCache()
+		ProviderBreaker = NewBreakerPolicy()
+		ProviderBreaker.Backoff = time.Millisecond
+		ProviderBreaker.FailureThreshold = 2
+		ProviderBreaker.OpenTimeout = 50 * time.Millisecond
+		DefaultItemFeature = nil
+		ctx := WithStage(context.Background(), PredictStage)
+		p := &flappingPredictor{down: 1}
+
+		// retried, then opened after 2 failures
+		for id := 1; id <= 2; id++ {
+			_, err := fetchItemFeature(ctx, ItemFeatureCache, p, &Sample{ItemId: id})
+			So(err, ShouldNotBeNil)
+		}
+		So(p.calls, ShouldEqual, 6)
+		So(ProviderBreaker.State(cacheItem), ShouldEqual, BreakerOpen)
+		_, err := fetchItemFeature(ctx, ItemFeatureCache, p, &Sample{ItemId: 3})
+		So(errors.Is(err, ErrCircuitOpen), ShouldBeTrue)
+		So(p.calls, ShouldEqual, 6)
+
+		// the missing items are not failures
+		atomic.StoreInt32(&p.down, 0)
+		So(ProviderBreaker.State(cacheUser), ShouldEqual, BreakerClosed)
+
+		Convey("default feature when open", func() {
+			DefaultItemFeature = []float32{42}
+			scores, err := Rank(context.Background(), p, 1, []int{5})
+			So(err, ShouldBeNil)
+			So(scores[0].Score, ShouldEqual, 42)
+			DefaultItemFeature = nil
+		})
+
+		Convey("half-open probe closes", func() {
+			time.Sleep(60 * time.Millisecond)
+			_, err := fetchItemFeature(ctx, ItemFeatureCache, p, &Sample{ItemId: -1})
+			So(errors.Is(err, ErrMissingItem), ShouldBeTrue)
+			So(ProviderBreaker.State(cacheItem), ShouldEqual, BreakerClosed)
+			feature, err := fetchItemFeature(ctx, ItemFeatureCache, p, &Sample{ItemId: 3})
+			So(err, ShouldBeNil)
+			So(feature, ShouldResemble, Tensor{3})
+
+			stats := ProviderBreaker.Stats()[cacheItem]
+			So(stats.Rejected, ShouldEqual, 1)
+			So(stats.Retries, ShouldEqual, 4)
+		})
+
+		Convey("metrics", func() {
+			var buf strings.Builder
+			_, err := metrics.WriteTo(&buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, `ctr_breaker_state{feature="item"} 1`)
+			So(buf.String(), ShouldContainSubstring, `ctr_breaker_rejected_total{feature="item"} 1`)
+		})
+	})
+}
@@ -0,0 +1,207 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const bulkFeaturesKey ctxKey = "bulkFeatures"
+
+// BulkFetchSize is the samples of Train whose features missing in the caches
+// are fetched in one call of BatchUserFeaturer and BatchItemFeaturer
+var BulkFetchSize = 256
+
+// BatchUserFeaturer is implemented by the feature providers fetching the
+// features of many users in one round-trip, e.g. a remote database. The users
+// not found are left out of the map.
+type BatchUserFeaturer interface {
+	GetUserFeatures(ctx context.Context, userIds []int) (map[int]Tensor, error)
+}
+
+// BatchItemFeaturer is BatchUserFeaturer of the items
+type BatchItemFeaturer interface {
+	GetItemFeatures(ctx context.Context, itemIds []int) (map[int]Tensor, error)
+}
+
+// bulkFeatures are the features of a batch of samples fetched in bulk, nil
+// features are the ones not found
+type bulkFeatures struct {
+	users map[int]Tensor
+	items map[int]Tensor
+}
+
+func withBulkFeatures(ctx context.Context, bulk *bulkFeatures) context.Context {
+	if bulk == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, bulkFeaturesKey, bulk)
+}
+
+// bulkOrFetch returns the feature of id fetched in bulk if any, else the one
+// of the hedged fetch
+func bulkOrFetch(ctx context.Context, name string, id int, fetch func(ctx context.Context) (Tensor, error)) (Tensor, error) {
+	if bulk, _ := ctx.Value(bulkFeaturesKey).(*bulkFeatures); bulk != nil {
+		features, missing := bulk.users, ErrMissingUser
+		if name == cacheItem {
+			features, missing = bulk.items, ErrMissingItem
+		}
+		if feature, ok := features[id]; ok {
+			if feature == nil {
+				return nil, fmt.Errorf("%w: %s %d not found in bulk fetch", missing, name, id)
+			}
+			return feature, nil
+		}
+	}
+	return breakerFetch(ctx, name, func(ctx context.Context) (Tensor, error) {
+		return hedgedFetch(ctx, name, fetch)
+	})
+}
+
+func cached(cache *ccache.Cache, id int) bool {
+	item := cache.Get(strconv.Itoa(id))
+	return item != nil && !item.Expired()
+}
+
+// fetchBulk fetches the features of sampleKeys missing in the caches by the
+// BatchUserFeaturer and BatchItemFeaturer of featureProvider, nil if neither
+// is implemented. A failed bulk fetch is logged and the features are fetched
+// one by one then.
+func fetchBulk(ctx context.Context, featureProvider interface{}, sampleKeys []Sample) (bulk *bulkFeatures) {
+	batchUser, userOk := featureProvider.(BatchUserFeaturer)
+	batchItem, itemOk := featureProvider.(BatchItemFeaturer)
+	if !userOk && !itemOk {
+		return
+	}
+	var (
+		userIds, itemIds []int
+		seenUsers        = make(map[int]bool)
+		seenItems        = make(map[int]bool)
+	)
+	for i := range sampleKeys {
+		userId, itemId := sampleKeys[i].UserId, sampleKeys[i].ItemId
+		if userOk && !seenUsers[userId] {
+			seenUsers[userId] = true
+			if !cached(UserFeatureCache, userId) {
+				userIds = append(userIds, userId)
+			}
+		}
+		if itemOk && !seenItems[itemId] {
+			seenItems[itemId] = true
+			if _, isInline := inlineItemOf(ctx, itemId); isInline {
+				continue
+			}
+			if SharedItemFeatures != nil {
+				if feature, _ := SharedItemFeatures.Get(itemId); feature != nil {
+					continue
+				}
+			}
+			if !cached(ItemFeatureCache, itemId) {
+				itemIds = append(itemIds, itemId)
+			}
+		}
+	}
+
+	bulk = &bulkFeatures{}
+	if len(userIds) != 0 {
+		bulk.users = fetchBulkOf(ctx, cacheUser, userIds, batchUser.GetUserFeatures)
+	}
+	if len(itemIds) != 0 {
+		bulk.items = fetchBulkOf(ctx, cacheItem, itemIds, batchItem.GetItemFeatures)
+	}
+	return
+}
+
+func fetchBulkOf(ctx context.Context, name string, ids []int,
+	fetch func(context.Context, []int) (map[int]Tensor, error)) (features map[int]Tensor) {
+	ctx, span := startSpan(ctx, "GetFeatures")
+	span.SetAttribute("cache", name)
+	span.SetAttribute("ids", len(ids))
+	if name == cacheItem && ItemFetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ItemFetchTimeout)
+		defer cancel()
+	}
+	fetched, err := fetch(ctx, ids)
+	endSpan(span, err)
+	if err != nil {
+		log.Warnf("bulk fetch %d %s features error: %v", len(ids), name, err)
+		return nil
+	}
+	features = make(map[int]Tensor, len(ids))
+	for _, id := range ids {
+		// nil marks the ones not found
+		features[id] = fetched[id]
+	}
+	return
+}
+
+// bulkSample is a sample of Train with the features of its chunk fetched in
+// bulk
+type bulkSample struct {
+	Sample
+	bulk *bulkFeatures
+	// seq is the order of the sample in sampleCh
+	seq int
+}
+
+// bulkSamples reads sampleCh in chunks of up to BulkFetchSize and fetches the
+// features of every chunk in bulk. A chunk ends early if no more sample is
+// ready, so the stream of StreamTrain is not held up. The samples are
+// forwarded one by one if featureProvider fetches in bulk neither.
+func bulkSamples(ctx context.Context, featureProvider interface{}, sampleCh <-chan Sample) <-chan bulkSample {
+	_, userOk := featureProvider.(BatchUserFeaturer)
+	_, itemOk := featureProvider.(BatchItemFeaturer)
+	bulkSize := 1
+	if (userOk || itemOk) && BulkFetchSize > 1 {
+		bulkSize = BulkFetchSize
+	}
+
+	out := make(chan bulkSample, bulkSize)
+	go func() {
+		defer close(out)
+		chunk := make([]Sample, 0, bulkSize)
+		seq := 0
+		for {
+			chunk = chunk[:0]
+			select {
+			case <-ctx.Done():
+				return
+			case s, ok := <-sampleCh:
+				if !ok {
+					return
+				}
+				chunk = append(chunk, s)
+			}
+		fill:
+			for len(chunk) < bulkSize {
+				select {
+				case s, ok := <-sampleCh:
+					if !ok {
+						break fill
+					}
+					chunk = append(chunk, s)
+				default:
+					break fill
+				}
+			}
+
+			var bulk *bulkFeatures
+			if bulkSize > 1 {
+				bulk = fetchBulk(ctx, featureProvider, chunk)
+			}
+			for _, s := range chunk {
+				select {
+				case out <- bulkSample{Sample: s, bulk: bulk, seq: seq}:
+				case <-ctx.Done():
+					return
+				}
+				seq++
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,88 @@
+package recommend
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// bulkRecSys is idRecSys fetching the features in bulk, the items >= 100
+// are not found
+type bulkRecSys struct {
+	idRecSys
+	single, userBulks, itemBulks int64
+}
+
+func (r *bulkRecSys) GetUserFeature(ctx context.Context, userId int) (Tensor, error) {
+	atomic.AddInt64(&r.single, 1)
+	return r.idRecSys.GetUserFeature(ctx, userId)
+}
+
+func (r *bulkRecSys) GetItemFeature(ctx context.Context, itemId int) (Tensor, error) {
+	atomic.AddInt64(&r.single, 1)
+	return r.idRecSys.GetItemFeature(ctx, itemId)
+}
+
+func (r *bulkRecSys) GetUserFeatures(_ context.Context, userIds []int) (map[int]Tensor, error) {
+	atomic.AddInt64(&r.userBulks, 1)
+	features := make(map[int]Tensor)
+	for _, id := range userIds {
+		features[id] = Tensor{float32(id)}
+	}
+	return features, nil
+}
+
+func (r *bulkRecSys) GetItemFeatures(_ context.Context, itemIds []int) (map[int]Tensor, error) {
+	atomic.AddInt64(&r.itemBulks, 1)
+	features := make(map[int]Tensor)
+	for _, id := range itemIds {
+		if id < 100 {
+			features[id] = Tensor{float32(id)}
+		}
+	}
+	return features, nil
+}
+
+func TestBulkFetch(t *testing.T) {
+	Convey("bulk fetch", t, func() {
+		resetFeatureCache()
+
+		Convey("batch predict", func() {
+			recSys := &bulkRecSys{}
+			scores, err := Rank(context.Background(), recSys, 1, []int{3, 4, 5, 3})
+			So(err, ShouldBeNil)
+			So(scores, ShouldHaveLength, 4)
+			So(recSys.single, ShouldEqual, 0)
+			So(recSys.userBulks, ShouldEqual, 1)
+			So(recSys.itemBulks, ShouldEqual, 1)
+
+			// cached now
+			_, err = Rank(context.Background(), recSys, 1, []int{3, 4})
+			So(err, ShouldBeNil)
+			So(recSys.userBulks, ShouldEqual, 1)
+			So(recSys.itemBulks, ShouldEqual, 1)
+
+			// not found in bulk is missing without the single fetch
+			Strict = true
+			defer func() { Strict = false }()
+			_, err = Rank(context.Background(), recSys, 1, []int{6, 200})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "item 200 not found in bulk fetch")
+			So(recSys.single, ShouldEqual, 0)
+		})
+
+		Convey("train", func() {
+			BulkFetchSize = 64
+			defer func() { BulkFetchSize = 256 }()
+			recSys := &bulkRecSys{}
+			fitter := &idFitter{}
+			_, err := TrainWithResult(context.Background(), recSys, fitter)
+			So(err, ShouldBeNil)
+			So(recSys.single, ShouldEqual, 0)
+			So(recSys.itemBulks, ShouldBeGreaterThan, 0)
+			So(fitter.rows, ShouldEqual, 1000)
+		})
+	})
+}
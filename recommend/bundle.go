@@ -0,0 +1,303 @@
+package recommend
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bundleVersion = 1
+
+	bundleMetaFile          = "bundle.json"
+	bundleModelFile         = "model.bin"
+	bundleItemEmbeddingFile = "item_embedding.json"
+	bundleUserEmbeddingFile = "user_embedding.json"
+	bundleUserCacheFile     = "user_cache.json"
+	bundleItemCacheFile     = "item_cache.json"
+
+	// BundleFormatArtifact is the model encoded by MarshalArtifact, see
+	// model.Artifact
+	BundleFormatArtifact = "artifact"
+	// BundleFormatMarshal is the model encoded by Marshal
+	BundleFormatMarshal = "marshal"
+)
+
+// SampleLayout is the configuration the sample vector layout depends on,
+// a model is only valid with the same SampleLayout it is trained with
+type SampleLayout struct {
+	ItemEmbDim           int      `json:"itemEmbDim"`
+	UserBehaviorLen      int      `json:"userBehaviorLen"`
+	BehaviorTimeFeatures bool     `json:"behaviorTimeFeatures"`
+	AppendUserEmbedding  bool     `json:"appendUserEmbedding"`
+	BehaviorChannels     []string `json:"behaviorChannels"`
+	CtxFeatureWidth      int      `json:"ctxFeatureWidth"`
+	CyclicalTimeFeatures bool     `json:"cyclicalTimeFeatures"`
+	SparseFeatureDim     int      `json:"sparseFeatureDim"`
+}
+
+// CurrentSampleLayout returns the SampleLayout of the current configuration
+func CurrentSampleLayout() SampleLayout {
+	return SampleLayout{
+		ItemEmbDim:           ItemEmbDim,
+		UserBehaviorLen:      UserBehaviorLen,
+		BehaviorTimeFeatures: BehaviorTimeFeatures,
+		AppendUserEmbedding:  AppendUserEmbedding,
+		BehaviorChannels:     append([]string{}, BehaviorChannels...),
+		CtxFeatureWidth:      CtxFeatureWidth,
+		CyclicalTimeFeatures: CyclicalTimeFeatures,
+		SparseFeatureDim:     SparseFeatureDim,
+	}
+}
+
+// BundleMeta describes a serving bundle
+type BundleMeta struct {
+	Version     int          `json:"version"`
+	CreatedAt   int64        `json:"createdAt"`
+	ModelFormat string       `json:"modelFormat"`
+	SampleCount int          `json:"sampleCount"`
+	SampleInfo  SampleInfo   `json:"sampleInfo"`
+	Layout      SampleLayout `json:"layout"`
+	// Schema is the FeatureSchema the model is trained with if any
+	Schema     *FeatureSchema `json:"schema,omitempty"`
+	UserCached int            `json:"userCached"`
+	ItemCached int            `json:"itemCached"`
+}
+
+// ServingBundle is a training run loaded by LoadServingBundle
+type ServingBundle struct {
+	Meta  BundleMeta
+	Model PredictAbstract
+}
+
+// Predictor returns the Predictor of the bundle model with the features of
+// featureProvider, BatchPredict checks the FeatureSchema of featureProvider
+// against the bundle one
+func (b *ServingBundle) Predictor(featureProvider BasicFeatureProvider) Predictor {
+	return &modelImpl{
+		UserFeaturer:    featureProvider,
+		ItemFeaturer:    featureProvider,
+		PredictAbstract: b.Model,
+		schema:          b.Meta.Schema,
+	}
+}
+
+// ModelDecoder decodes the model of a bundle, format is BundleFormatArtifact
+// or BundleFormatMarshal, e.g. youtube.NewYoutubeDnnFromArtifact
+type ModelDecoder func(format string, data []byte) (PredictAbstract, error)
+
+type cacheEntry struct {
+	Key     string `json:"k"`
+	Value   Tensor `json:"v"`
+	Expires int64  `json:"e"` // unix seconds
+}
+
+// ExportServingBundle writes the model of result, the item and user
+// embeddings, the snapshot of UserFeatureCache and ItemFeatureCache and the
+// SampleLayout to path as one tar file, so a fresh serving process loading
+// it with LoadServingBundle is warm. The Fitted model of result must
+// implement MarshalArtifact() or Marshal() ([]byte, error).
+func ExportServingBundle(path string, result *TrainResult) (err error) {
+	meta := BundleMeta{
+		Version:     bundleVersion,
+		CreatedAt:   time.Now().Unix(),
+		SampleCount: result.SampleCount,
+		SampleInfo:  result.SampleInfo,
+		Layout:      CurrentSampleLayout(),
+		Schema:      result.Schema,
+	}
+	var modelData []byte
+	switch m := result.Fitted.(type) {
+	case interface{ MarshalArtifact() ([]byte, error) }:
+		meta.ModelFormat = BundleFormatArtifact
+		modelData, err = m.MarshalArtifact()
+	case interface{ Marshal() ([]byte, error) }:
+		meta.ModelFormat = BundleFormatMarshal
+		modelData, err = m.Marshal()
+	default:
+		return fmt.Errorf("model %T could not be marshaled", result.Fitted)
+	}
+	if err != nil {
+		log.Errorf("marshal model error: %v", err)
+		return
+	}
+	userCache, itemCache := snapshotCache(UserFeatureCache), snapshotCache(ItemFeatureCache)
+	meta.UserCached, meta.ItemCached = len(userCache), len(itemCache)
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	tw := tar.NewWriter(f)
+	for _, entry := range []struct {
+		name  string
+		value interface{}
+	}{
+		{bundleMetaFile, meta},
+		{bundleModelFile, modelData},
+		{bundleItemEmbeddingFile, itemEmbeddingMap.load()},
+		{bundleUserEmbeddingFile, userEmbeddingMap.load()},
+		{bundleUserCacheFile, userCache},
+		{bundleItemCacheFile, itemCache},
+	} {
+		data, ok := entry.value.([]byte)
+		if !ok {
+			if data, err = json.Marshal(entry.value); err != nil {
+				return
+			}
+		}
+		if err = tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			return
+		}
+		if _, err = tw.Write(data); err != nil {
+			return
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadServingBundle loads the bundle exported by ExportServingBundle: the
+// model is decoded by decode, the item and user embeddings replace the ones
+// in use and the feature cache snapshots are loaded into UserFeatureCache
+// and ItemFeatureCache. The SampleLayout of the bundle must equal the
+// current one.
+func LoadServingBundle(path string, decode ModelDecoder) (bundle *ServingBundle, err error) {
+	files, err := readBundleFiles(path)
+	if err != nil {
+		return
+	}
+	for _, name := range []string{bundleMetaFile, bundleModelFile} {
+		if files[name] == nil {
+			return nil, fmt.Errorf("%s not found in bundle %s", name, path)
+		}
+	}
+
+	bundle = &ServingBundle{}
+	if err = json.Unmarshal(files[bundleMetaFile], &bundle.Meta); err != nil {
+		return nil, fmt.Errorf("unmarshal bundle meta error: %v", err)
+	}
+	if bundle.Meta.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version: %d", bundle.Meta.Version)
+	}
+	if layout := CurrentSampleLayout(); !layoutEqual(bundle.Meta.Layout, layout) {
+		return nil, fmt.Errorf("bundle layout %+v mismatch the current %+v", bundle.Meta.Layout, layout)
+	}
+	if bundle.Model, err = decode(bundle.Meta.ModelFormat, files[bundleModelFile]); err != nil {
+		log.Errorf("decode bundle model error: %v", err)
+		return nil, err
+	}
+
+	var itemEmb, userEmb word2vec.EmbeddingMap32
+	var userCache, itemCache []cacheEntry
+	for name, v := range map[string]interface{}{
+		bundleItemEmbeddingFile: &itemEmb,
+		bundleUserEmbeddingFile: &userEmb,
+		bundleUserCacheFile:     &userCache,
+		bundleItemCacheFile:     &itemCache,
+	} {
+		if data := files[name]; data != nil {
+			if err = json.Unmarshal(data, v); err != nil {
+				return nil, fmt.Errorf("unmarshal bundle %s error: %v", name, err)
+			}
+		}
+	}
+	itemEmbeddingMap.store(itemEmb)
+	userEmbeddingMap.store(userEmb)
+	initFeatureCaches()
+	restoreCache(UserFeatureCache, userCache)
+	restoreCache(ItemFeatureCache, itemCache)
+	log.Infof("loaded serving bundle %s: %d item embeddings, %d users and %d items cached",
+		path, len(itemEmb), len(userCache), len(itemCache))
+	return
+}
+
+// readBundleFiles returns the files in the bundle of path by name
+func readBundleFiles(path string) (files map[string][]byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	files = make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for {
+		var hdr *tar.Header
+		if hdr, err = tr.Next(); err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("read bundle %s error: %v", path, err)
+		}
+		if files[hdr.Name], err = io.ReadAll(tr); err != nil {
+			return
+		}
+	}
+}
+
+// ReadBundleItemEmbedding returns the item embedding in the bundle of path
+// without loading the bundle
+func ReadBundleItemEmbedding(path string) (itemEmb word2vec.EmbeddingMap32, err error) {
+	files, err := readBundleFiles(path)
+	if err != nil {
+		return
+	}
+	if data := files[bundleItemEmbeddingFile]; data != nil {
+		if err = json.Unmarshal(data, &itemEmb); err != nil {
+			return nil, fmt.Errorf("unmarshal bundle %s error: %v", bundleItemEmbeddingFile, err)
+		}
+	}
+	return
+}
+
+func layoutEqual(a, b SampleLayout) bool {
+	if len(a.BehaviorChannels) == 0 && len(b.BehaviorChannels) == 0 {
+		a.BehaviorChannels, b.BehaviorChannels = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// snapshotCache returns the unexpired features in cache
+func snapshotCache(cache *ccache.Cache) (entries []cacheEntry) {
+	if cache == nil {
+		return
+	}
+	cache.ForEachFunc(func(key string, item *ccache.Item) bool {
+		if t, ok := item.Value().(Tensor); ok && !item.Expired() {
+			entries = append(entries, cacheEntry{Key: key, Value: t, Expires: item.Expires().Unix()})
+		}
+		return true
+	})
+	return
+}
+
+// restoreCache sets the unexpired entries into cache, restored is the count
+func restoreCache(cache *ccache.Cache, entries []cacheEntry) (restored int) {
+	now := time.Now()
+	for _, e := range entries {
+		if ttl := time.Unix(e.Expires, 0).Sub(now); ttl > 0 {
+			cache.Set(e.Key, e.Value, ttl)
+			restored++
+		}
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	"github.com/karlseguin/ccache/v2"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// jsonPredictor scores by the last column times Scale
+type jsonPredictor struct {
+	Scale float32 `json:"scale"`
+}
+
+func (p *jsonPredictor) Predict(X tensor.Tensor) tensor.Tensor {
+	y := idPredictor{}.Predict(X)
+	data := y.Data().([]float32)
+	for i := range data {
+		data[i] *= p.Scale
+	}
+	return y
+}
+
+func (p *jsonPredictor) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func decodeJsonPredictor(format string, data []byte) (PredictAbstract, error) {
+	if format != BundleFormatMarshal {
+		return nil, fmt.Errorf("unexpected format %s", format)
+	}
+	p := &jsonPredictor{}
+	return p, json.Unmarshal(data, p)
+}
+
+func TestServingBundle(t *testing.T) {
+	defer func(m word2vec.EmbeddingMap32, u word2vec.EmbeddingMap32) {
+		itemEmbeddingMap.store(m)
+		userEmbeddingMap.store(u)
+	}(itemEmbeddingMap.load(), userEmbeddingMap.load())
+	defer func(w int) { CtxFeatureWidth = w }(CtxFeatureWidth)
+
+	Convey("serving bundle", t, func() {
+		resetFeatureCache()
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": make([]float32, ItemEmbDim)})
+		userEmbeddingMap.store(word2vec.EmbeddingMap32{userWord(1): make([]float32, ItemEmbDim)})
+		UserFeatureCache.Set("1", Tensor{1}, time.Hour)
+		ItemFeatureCache.Set("2", Tensor{2}, time.Hour)
+		ItemFeatureCache.Set("3", Tensor{3}, -time.Second)
+		path := filepath.Join(t.TempDir(), "serving.bundle")
+		So(ExportServingBundle(path, &TrainResult{Fitted: &jsonPredictor{Scale: 10}, SampleCount: 5}), ShouldBeNil)
+
+		// a fresh serving process
+		itemEmbeddingMap.store(nil)
+		userEmbeddingMap.store(nil)
+		UserFeatureCache, ItemFeatureCache = nil, nil
+		bundle, err := LoadServingBundle(path, decodeJsonPredictor)
+		So(err, ShouldBeNil)
+		So(bundle.Meta.SampleCount, ShouldEqual, 5)
+		So(bundle.Meta.UserCached, ShouldEqual, 1)
+		So(bundle.Meta.ItemCached, ShouldEqual, 1)
+		So(itemEmbeddingMap.load(), ShouldContainKey, "1")
+		_, ok := GetUserEmbedding(1)
+		So(ok, ShouldBeTrue)
+		So(UserFeatureCache.Get("1").Value(), ShouldResemble, Tensor{1})
+		So(ItemFeatureCache.Get("3"), ShouldBeNil)
+
+		// item 2 is served from the cache, not the provider
+		scores, err := Rank(context.Background(), bundle.Predictor(sparsePredictor{}), 1, []int{2})
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{{ItemId: 2, Score: 20}})
+
+		Convey("layout mismatch", func() {
+			CtxFeatureWidth = 3
+			_, err := LoadServingBundle(path, decodeJsonPredictor)
+			So(err, ShouldNotBeNil)
+			CtxFeatureWidth = 0
+		})
+
+		Convey("model not marshalable", func() {
+			So(ExportServingBundle(path, &TrainResult{Fitted: idPredictor{}}), ShouldNotBeNil)
+		})
+	})
+	UserFeatureCache, ItemFeatureCache = ccache.New(ccache.Configure()), ccache.New(ccache.Configure())
+}
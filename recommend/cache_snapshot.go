@@ -0,0 +1,118 @@
+package recommend
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	log "github.com/sirupsen/logrus"
+)
+
+const cacheSnapshotVersion = 1
+
+// CacheSnapshotPath makes StartHttpApi load the feature cache snapshot of
+// it on startup if not empty, so a restarted serving node does not fetch all
+// the features from the feature store at once. The caller saves one with
+// SaveCacheSnapshot on its own shutdown
+var CacheSnapshotPath string
+
+// cacheSnapshot is the gzipped json file of SaveCacheSnapshot
+type cacheSnapshot struct {
+	Version       int                     `json:"version"`
+	CreatedAt     int64                   `json:"createdAt"`
+	Layout        SampleLayout            `json:"layout"`
+	Users         []cacheEntry            `json:"users"`
+	Items         []cacheEntry            `json:"items"`
+	ItemEmbedding word2vec.EmbeddingMap32 `json:"itemEmbedding,omitempty"`
+	UserEmbedding word2vec.EmbeddingMap32 `json:"userEmbedding,omitempty"`
+}
+
+// SaveCacheSnapshot writes the unexpired features in UserFeatureCache and
+// ItemFeatureCache and the item and user embeddings in use to path
+func SaveCacheSnapshot(path string) (err error) {
+	snapshot := cacheSnapshot{
+		Version:       cacheSnapshotVersion,
+		CreatedAt:     time.Now().Unix(),
+		Layout:        CurrentSampleLayout(),
+		Users:         snapshotCache(UserFeatureCache),
+		Items:         snapshotCache(ItemFeatureCache),
+		ItemEmbedding: itemEmbeddingMap.load(),
+		UserEmbedding: userEmbeddingMap.load(),
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	zw := gzip.NewWriter(f)
+	if err = json.NewEncoder(zw).Encode(snapshot); err != nil {
+		return
+	}
+	if err = zw.Close(); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return
+	}
+	log.Infof("saved cache snapshot %s: %d users and %d items cached",
+		path, len(snapshot.Users), len(snapshot.Items))
+	return
+}
+
+// LoadCacheSnapshot loads the snapshot saved by SaveCacheSnapshot into
+// UserFeatureCache and ItemFeatureCache, the entries expired meanwhile are
+// skipped. The embeddings of the snapshot are used only if none is loaded,
+// e.g. by LoadServingBundle. The SampleLayout of the snapshot must equal the
+// current one.
+func LoadCacheSnapshot(path string) (users int, items int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("read cache snapshot %s error: %v", path, err)
+	}
+	var snapshot cacheSnapshot
+	if err = json.NewDecoder(zr).Decode(&snapshot); err != nil {
+		return 0, 0, fmt.Errorf("unmarshal cache snapshot %s error: %v", path, err)
+	}
+	if snapshot.Version != cacheSnapshotVersion {
+		return 0, 0, fmt.Errorf("unsupported cache snapshot version: %d", snapshot.Version)
+	}
+	if layout := CurrentSampleLayout(); !layoutEqual(snapshot.Layout, layout) {
+		return 0, 0, fmt.Errorf("cache snapshot layout %+v mismatch the current %+v", snapshot.Layout, layout)
+	}
+	if len(snapshot.ItemEmbedding) != 0 {
+		itemEmbeddingMap.storeIfEmpty(snapshot.ItemEmbedding)
+	}
+	if len(snapshot.UserEmbedding) != 0 {
+		userEmbeddingMap.storeIfEmpty(snapshot.UserEmbedding)
+	}
+	initFeatureCaches()
+	users = restoreCache(UserFeatureCache, snapshot.Users)
+	items = restoreCache(ItemFeatureCache, snapshot.Items)
+	log.Infof("loaded cache snapshot %s of %v: %d users and %d items cached",
+		path, time.Unix(snapshot.CreatedAt, 0), users, items)
+	return
+}
+
+// restoreCacheSnapshot loads the snapshot of path if any
+func restoreCacheSnapshot(path string) {
+	if _, _, err := LoadCacheSnapshot(path); err != nil && !os.IsNotExist(err) {
+		log.Errorf("load cache snapshot error: %v", err)
+	}
+}
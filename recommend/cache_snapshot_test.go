@@ -0,0 +1,62 @@
+package recommend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheSnapshot(t *testing.T) {
+	defer func(m word2vec.EmbeddingMap32, u word2vec.EmbeddingMap32) {
+		itemEmbeddingMap.store(m)
+		userEmbeddingMap.store(u)
+	}(itemEmbeddingMap.load(), userEmbeddingMap.load())
+	defer func(w int) { CtxFeatureWidth = w }(CtxFeatureWidth)
+
+	Convey("cache snapshot", t, func() {
+		resetFeatureCache()
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": make([]float32, ItemEmbDim)})
+		userEmbeddingMap.store(nil)
+		UserFeatureCache.Set("1", Tensor{1}, time.Hour)
+		ItemFeatureCache.Set("2", Tensor{2}, time.Hour)
+		ItemFeatureCache.Set("3", Tensor{3}, -time.Second)
+		path := filepath.Join(t.TempDir(), "cache.snapshot")
+		So(SaveCacheSnapshot(path), ShouldBeNil)
+
+		Convey("restart", func() {
+			resetFeatureCache()
+			itemEmbeddingMap.store(nil)
+			users, items, err := LoadCacheSnapshot(path)
+			So(err, ShouldBeNil)
+			So(users, ShouldEqual, 1)
+			So(items, ShouldEqual, 1)
+			So(UserFeatureCache.Get("1").Value(), ShouldResemble, Tensor{1})
+			So(ItemFeatureCache.Get("2").Value(), ShouldResemble, Tensor{2})
+			So(ItemFeatureCache.Get("3"), ShouldBeNil)
+			So(itemEmbeddingMap.load(), ShouldContainKey, "1")
+		})
+
+		Convey("loaded embedding kept", func() {
+			itemEmbeddingMap.store(word2vec.EmbeddingMap32{"9": make([]float32, ItemEmbDim)})
+			_, _, err := LoadCacheSnapshot(path)
+			So(err, ShouldBeNil)
+			So(itemEmbeddingMap.load(), ShouldNotContainKey, "1")
+		})
+
+		Convey("layout mismatch", func() {
+			CtxFeatureWidth++
+			_, _, err := LoadCacheSnapshot(path)
+			CtxFeatureWidth--
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("no snapshot", func() {
+			_, _, err := LoadCacheSnapshot(path + ".missing")
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package recommend
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// CacheStat is the statistics of a feature cache since the start, a low
+// HitRate with many Evictions means the cache is too small for the catalog
+type CacheStat struct {
+	Name      string  `json:"name"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	HitRate   float64 `json:"hitRate"`
+	Evictions uint64  `json:"evictions"`
+	// Size is the items in the cache now
+	Size int `json:"size"`
+	// LoaderMeanSeconds and LoaderP99Seconds are the latency of the feature
+	// provider on miss, the p99 is the upper bound of its MetricsBuckets
+	LoaderMeanSeconds float64 `json:"loaderMeanSeconds"`
+	LoaderP99Seconds  float64 `json:"loaderP99Seconds"`
+}
+
+// cacheOf returns the cache named name
+func cacheOf(name string) *ccache.Cache {
+	switch name {
+	case cacheUser:
+		return UserFeatureCache
+	case cacheItem:
+		return ItemFeatureCache
+	case cacheUserBehavior:
+		return UserBehaviorCache
+	}
+	return nil
+}
+
+// evictions returns the items evicted from the cache named name so far,
+// ccache counts the dropped items since the last GetDropped only
+func (m *MetricsCollector) evictions(name string) uint64 {
+	if cache := cacheOf(name); cache != nil {
+		return atomic.AddUint64(m.cacheEvictions[name], uint64(cache.GetDropped()))
+	}
+	return atomic.LoadUint64(m.cacheEvictions[name])
+}
+
+// CacheStats returns the statistics of the user feature, item feature and
+// user behavior caches
+func CacheStats() (stats []CacheStat) {
+	for _, name := range metricsCaches {
+		stat := CacheStat{
+			Name:      name,
+			Hits:      atomic.LoadUint64(metrics.cacheHits[name]),
+			Misses:    atomic.LoadUint64(metrics.cacheMisses[name]),
+			Evictions: metrics.evictions(name),
+		}
+		if total := stat.Hits + stat.Misses; total != 0 {
+			stat.HitRate = float64(stat.Hits) / float64(total)
+		}
+		if cache := cacheOf(name); cache != nil {
+			stat.Size = cache.ItemCount()
+		}
+		stat.LoaderMeanSeconds, stat.LoaderP99Seconds = metrics.providerSeconds[name].meanAndQuantile(0.99)
+		stats = append(stats, stat)
+	}
+	return
+}
+
+// LogCacheStats logs the CacheStats every interval until ctx is done
+func LogCacheStats(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, stat := range CacheStats() {
+					if stat.Hits+stat.Misses == 0 {
+						continue
+					}
+					log.Infof("%s cache: size %d, hit rate %.3f (%d/%d), %d evictions, loader mean %.4fs p99 %.4fs",
+						stat.Name, stat.Size, stat.HitRate, stat.Hits, stat.Hits+stat.Misses, stat.Evictions,
+						stat.LoaderMeanSeconds, stat.LoaderP99Seconds)
+				}
+			}
+		}
+	}()
+}
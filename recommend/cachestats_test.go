@@ -0,0 +1,64 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func cacheStatOf(name string) CacheStat {
+	for _, stat := range CacheStats() {
+		if stat.Name == name {
+			return stat
+		}
+	}
+	return CacheStat{}
+}
+
+func TestCacheStats(t *testing.T) {
+	Convey("cache stats", t, func() {
+		resetFeatureCache()
+		ItemFeatureCache = ccache.New(ccache.Configure().MaxSize(4).ItemsToPrune(2))
+		defer resetFeatureCache()
+		before := cacheStatOf(cacheItem)
+
+		ctx := context.Background()
+		for _, itemId := range []int{1, 2, 1, 1} {
+			_, err := fetchItemFeature(ctx, ItemFeatureCache, idPredictor{}, &Sample{ItemId: itemId})
+			So(err, ShouldBeNil)
+		}
+		stat := cacheStatOf(cacheItem)
+		So(stat.Hits-before.Hits, ShouldEqual, 2)
+		So(stat.Misses-before.Misses, ShouldEqual, 2)
+		So(stat.Size, ShouldEqual, 2)
+		So(stat.HitRate, ShouldBeGreaterThan, 0)
+		So(stat.LoaderMeanSeconds, ShouldBeGreaterThan, 0)
+		So(stat.LoaderP99Seconds, ShouldBeGreaterThanOrEqualTo, stat.LoaderMeanSeconds)
+
+		for itemId := 10; itemId < 30; itemId++ {
+			_, err := fetchItemFeature(ctx, ItemFeatureCache, idPredictor{}, &Sample{ItemId: itemId})
+			So(err, ShouldBeNil)
+		}
+		// the evictions are async in ccache
+		deadline := time.Now().Add(time.Second)
+		for cacheStatOf(cacheItem).Evictions == before.Evictions && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		So(cacheStatOf(cacheItem).Evictions, ShouldBeGreaterThan, before.Evictions)
+	})
+
+	Convey("histogram quantile", t, func() {
+		h := newHistogram([]float64{1, 2, 4})
+		for _, v := range []float64{0.5, 1.5, 1.5, 3} {
+			h.observe(v)
+		}
+		mean, p50 := h.meanAndQuantile(0.5)
+		So(mean, ShouldEqual, 1.625)
+		So(p50, ShouldEqual, 2)
+		_, p99 := h.meanAndQuantile(0.99)
+		So(p99, ShouldEqual, 4)
+	})
+}
@@ -0,0 +1,66 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// endlessRecSys generates samples until ctx is done
+type endlessRecSys struct {
+	idPredictor
+}
+
+func (endlessRecSys) SampleGenerator(ctx context.Context) (<-chan Sample, error) {
+	ch := make(chan Sample)
+	go func() {
+		defer close(ch)
+		for i := 0; ; i++ {
+			select {
+			case ch <- Sample{UserId: i % 7, ItemId: i % 100}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestSampleCancel(t *testing.T) {
+	Convey("sample assembly cancelled", t, func() {
+		resetFeatureCache()
+		time.Sleep(10 * time.Millisecond)
+		goroutines := runtime.NumGoroutine()
+
+		Convey("GetSample", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := GetSample(endlessRecSys{}, ctx)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+
+		Convey("GetSampleStream consumer gone", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			_, batchCh, errCh, err := GetSampleStream(endlessRecSys{}, ctx, 10)
+			So(err, ShouldBeNil)
+			<-batchCh
+			cancel()
+			for range batchCh {
+			}
+			So(<-errCh, ShouldEqual, context.Canceled)
+		})
+
+		// all the generator and assembler goroutines exit
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(runtime.NumGoroutine(), ShouldBeLessThanOrEqualTo, goroutines)
+	})
+}
@@ -0,0 +1,248 @@
+package recommend
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability is an optional interface of the recSys detected by the type
+// assertions of this package
+type Capability struct {
+	Interface   string `json:"interface"`
+	Implemented bool   `json:"implemented"`
+	// Effect is what the interface enables
+	Effect string `json:"effect"`
+}
+
+// FeatureBlock is a block of the sample vector and its source, the inactive
+// blocks are zeros
+type FeatureBlock struct {
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+	Source string `json:"source"`
+}
+
+// CapabilityReport tells which optional interfaces the recSys implements and
+// which feature blocks are active therefore, Warnings are the likely
+// misconfigurations
+type CapabilityReport struct {
+	Capabilities  []Capability   `json:"capabilities"`
+	FeatureBlocks []FeatureBlock `json:"featureBlocks"`
+	Warnings      []string       `json:"warnings,omitempty"`
+}
+
+func (r *CapabilityReport) String() string {
+	var sb strings.Builder
+	for _, c := range r.Capabilities {
+		mark := " "
+		if c.Implemented {
+			mark = "x"
+		}
+		fmt.Fprintf(&sb, "[%s] %s: %s\n", mark, c.Interface, c.Effect)
+	}
+	for _, b := range r.FeatureBlocks {
+		state := "zeros"
+		if b.Active {
+			state = "active"
+		}
+		fmt.Fprintf(&sb, "%s: %s (%s)\n", b.Name, state, b.Source)
+	}
+	for _, w := range r.Warnings {
+		fmt.Fprintf(&sb, "warning: %s\n", w)
+	}
+	return sb.String()
+}
+
+func (r *CapabilityReport) warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Capabilities reports the optional interfaces recSys implements and the
+// feature blocks GetSampleVector assembles with the current configuration
+func Capabilities(recSys interface{}) (report *CapabilityReport) {
+	report = &CapabilityReport{}
+	has := func(name string, ok bool, effect string) bool {
+		report.Capabilities = append(report.Capabilities, Capability{Interface: name, Implemented: ok, Effect: effect})
+		return ok
+	}
+	var ok bool
+	_, ok = recSys.(UserFeaturer)
+	userFeaturer := has("UserFeaturer", ok, "user profile features")
+	_, ok = recSys.(ItemFeaturer)
+	itemFeaturer := has("ItemFeaturer", ok, "item features")
+	_, ok = recSys.(BatchUserFeaturer)
+	has("BatchUserFeaturer", ok, "user features fetched in bulk by BatchPredict and Train")
+	_, ok = recSys.(BatchItemFeaturer)
+	has("BatchItemFeaturer", ok, "item features fetched in bulk by BatchPredict and Train")
+	_, ok = recSys.(Trainer)
+	trainer := has("Trainer", ok, "training samples of Train")
+	_, ok = recSys.(ItemEmbedding)
+	itemSeq := has("ItemEmbedding", ok, "item2vec item embedding trained on the item sequence")
+	_, ok = recSys.(ItemSession)
+	itemSession := has("ItemSession", ok, "node2vec item embedding trained on the item sessions, over ItemEmbedding")
+	_, ok = recSys.(ItemContentEmbedder)
+	content := has("ItemContentEmbedder", ok || ContentEmbedder != nil, "content embedding of the items without item embedding")
+	_, ok = recSys.(UserEmbedding)
+	userEmbedding := has("UserEmbedding", ok, "user2vec embedding appended to the user profile if AppendUserEmbedding")
+	_, ok = recSys.(SessionBehavior)
+	sessionBehavior := has("SessionBehavior", ok, "session recency weighted user behavior, over TimedUserBehavior and UserBehavior")
+	_, ok = recSys.(TimedUserBehavior)
+	timedBehavior := has("TimedUserBehavior", ok, "user behavior with the recency features, over UserBehavior")
+	_, ok = recSys.(UserBehavior)
+	userBehavior := has("UserBehavior", ok, "user behavior item embeddings")
+	_, ok = recSys.(MultiBehavior)
+	multiBehavior := has("MultiBehavior", ok, "user behavior item embeddings of BehaviorChannels")
+	_, ok = recSys.(CtxFeaturer)
+	ctxFeaturer := has("CtxFeaturer", ok, "context features of the samples if CtxFeatureWidth > 0")
+	_, ok = recSys.(FeatureImputer)
+	has("FeatureImputer", ok, "imputation of the missing features in predict, over UserImputer and ItemImputer")
+	_, ok = recSys.(SparseFeaturer)
+	sparseFeaturer := has("SparseFeaturer", ok, "sparse features if SparseFeatureDim > 0")
+	_, ok = recSys.(ItemScorer)
+	has("ItemScorer", ok, "items scored without the sample vectors, e.g. RulesRanker")
+	_, ok = recSys.(Retriever)
+	has("Retriever", ok, "candidate items of the recommend api requests without items")
+	_, ok = recSys.(PreTrainer)
+	has("PreTrainer", ok, "called before Train")
+	_, ok = recSys.(PreRanker)
+	has("PreRanker", ok, "called before BatchPredict")
+	_, ok = recSys.(PostRanker)
+	has("PostRanker", ok, "business rules applied at the end of Rank")
+	_, ok = recSys.(FeatureOverview)
+	has("FeatureOverview", ok, "dashboard overview of the users and items")
+	_, ok = recSys.(SchemaProvider)
+	has("SchemaProvider", ok, "feature schema validated in Train and checked against the model in predict")
+	_, ok = recSys.(FeatureNamer)
+	has("FeatureNamer", ok, "feature names in DebugSample")
+	_, ok = recSys.(ItemCategorizer)
+	has("ItemCategorizer", ok, "category caps of the digests")
+
+	if !userFeaturer || !itemFeaturer {
+		report.warnf("UserFeaturer and ItemFeaturer are required to rank")
+	}
+	if !trainer {
+		report.warnf("not a Trainer, Train will fail")
+	}
+
+	// the item embedding is trained by Train, loaded or shared
+	var embSource string
+	switch {
+	case itemSession:
+		embSource = "ItemSession"
+		if itemSeq {
+			report.warnf("both ItemSession and ItemEmbedding implemented, ItemEmbedding is not used")
+		}
+	case itemSeq:
+		embSource = "ItemEmbedding"
+	case SharedItemEmbedding != nil:
+		embSource = "SharedItemEmbedding"
+	case len(itemEmbeddingMap.load()) != 0:
+		embSource = "trained"
+	}
+	if ItemEmbeddingFile != "" && (itemSession || itemSeq) {
+		embSource += ", ItemEmbeddingFile"
+	}
+	itemEmb := embSource != ""
+	if content {
+		if embSource == "" {
+			report.warnf("ItemContentEmbedder is not used without any item embedding")
+		} else {
+			embSource += ", ItemContentEmbedder"
+		}
+	}
+
+	userSource := "UserFeaturer"
+	if AppendUserEmbedding {
+		userSource += ", user embedding of ItemEmbDim"
+		if !userEmbedding {
+			userSource += " averaged from the user behavior"
+		}
+	} else if userEmbedding {
+		report.warnf("UserEmbedding implemented but AppendUserEmbedding is false")
+	}
+	report.FeatureBlocks = append(report.FeatureBlocks, FeatureBlock{Name: "UserProfile", Active: userFeaturer, Source: userSource})
+
+	behaviorSource := ""
+	switch {
+	case sessionBehavior:
+		behaviorSource = "SessionBehavior"
+		if timedBehavior || userBehavior {
+			report.warnf("SessionBehavior shadows TimedUserBehavior and UserBehavior")
+		}
+	case timedBehavior:
+		behaviorSource = "TimedUserBehavior"
+		if userBehavior {
+			report.warnf("TimedUserBehavior shadows UserBehavior")
+		}
+	case userBehavior:
+		behaviorSource = "UserBehavior"
+	}
+	if behaviorSource != "" && !itemEmb {
+		report.warnf("%s implemented but no item embedding, the user behavior is zeros", behaviorSource)
+	}
+	report.FeatureBlocks = append(report.FeatureBlocks, FeatureBlock{
+		Name: "UserBehavior", Active: behaviorSource != "" && itemEmb, Source: behaviorSource,
+	})
+	if BehaviorTimeFeatures {
+		active := timedBehavior && !sessionBehavior && itemEmb
+		if !active {
+			report.warnf("BehaviorTimeFeatures set but the recency is filled by TimedUserBehavior only")
+		}
+		report.FeatureBlocks = append(report.FeatureBlocks, FeatureBlock{Name: "BehaviorRecency", Active: active, Source: "TimedUserBehavior"})
+	}
+
+	report.FeatureBlocks = append(report.FeatureBlocks,
+		FeatureBlock{Name: "ItemEmbedding", Active: itemEmb, Source: embSource},
+		FeatureBlock{Name: "ItemFeature", Active: itemFeaturer || SharedItemFeatures != nil, Source: itemFeatureSource(itemFeaturer)},
+	)
+
+	if len(BehaviorChannels) != 0 && !multiBehavior {
+		report.warnf("BehaviorChannels set but MultiBehavior not implemented, the channels are zeros")
+	} else if len(BehaviorChannels) == 0 && multiBehavior {
+		report.warnf("MultiBehavior implemented but BehaviorChannels is empty")
+	}
+	for _, name := range BehaviorChannels {
+		report.FeatureBlocks = append(report.FeatureBlocks, FeatureBlock{
+			Name: "Behavior:" + name, Active: multiBehavior && itemEmb, Source: "MultiBehavior",
+		})
+	}
+
+	if CtxFeatureWidth > 0 {
+		if !ctxFeaturer {
+			report.warnf("CtxFeatureWidth set but CtxFeaturer not implemented, the context features are zeros in Train")
+		}
+		report.FeatureBlocks = append(report.FeatureBlocks, FeatureBlock{
+			Name: "RequestCtx", Active: ctxFeaturer, Source: "CtxFeaturer, RankWithContext",
+		})
+	} else if ctxFeaturer {
+		report.warnf("CtxFeaturer implemented but CtxFeatureWidth is 0")
+	}
+	if CyclicalTimeFeatures {
+		report.FeatureBlocks = append(report.FeatureBlocks, FeatureBlock{
+			Name: "CyclicalTime", Active: true, Source: "Sample.Timestamp",
+		})
+	}
+	if SparseFeatureDim > 0 {
+		if !sparseFeaturer {
+			report.warnf("SparseFeatureDim set but SparseFeaturer not implemented, the sparse features are zeros")
+		}
+		report.FeatureBlocks = append(report.FeatureBlocks, FeatureBlock{
+			Name: "Sparse", Active: sparseFeaturer, Source: "SparseFeaturer",
+		})
+	} else if sparseFeaturer {
+		report.warnf("SparseFeaturer implemented but SparseFeatureDim is 0")
+	}
+	return
+}
+
+func itemFeatureSource(itemFeaturer bool) string {
+	switch {
+	case SharedItemFeatures != nil && itemFeaturer:
+		return "SharedItemFeatures, ItemFeaturer"
+	case SharedItemFeatures != nil:
+		return "SharedItemFeatures"
+	case itemFeaturer:
+		return "ItemFeaturer"
+	}
+	return ""
+}
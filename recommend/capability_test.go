@@ -0,0 +1,55 @@
+package recommend
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func capabilityOf(report *CapabilityReport, name string) Capability {
+	for _, c := range report.Capabilities {
+		if c.Interface == name {
+			return c
+		}
+	}
+	return Capability{}
+}
+
+func blockOf(report *CapabilityReport, name string) FeatureBlock {
+	for _, b := range report.FeatureBlocks {
+		if b.Name == name {
+			return b
+		}
+	}
+	return FeatureBlock{}
+}
+
+func TestCapabilities(t *testing.T) {
+	Convey("capabilities of a complete recSys", t, func() {
+		report := Capabilities(&behaviorRecSys{})
+		So(report.Warnings, ShouldBeEmpty)
+		So(capabilityOf(report, "ItemEmbedding").Implemented, ShouldBeTrue)
+		So(capabilityOf(report, "UserBehavior").Implemented, ShouldBeTrue)
+		So(capabilityOf(report, "PostRanker").Implemented, ShouldBeFalse)
+		So(blockOf(report, "UserBehavior"), ShouldResemble, FeatureBlock{Name: "UserBehavior", Active: true, Source: "UserBehavior"})
+		So(blockOf(report, "ItemEmbedding").Source, ShouldEqual, "ItemEmbedding")
+		So(report.String(), ShouldContainSubstring, "[x] UserBehavior")
+	})
+
+	Convey("misconfigurations warned", t, func() {
+		report := Capabilities(sessionPredictor{})
+		So(report.Warnings, ShouldHaveLength, 3)
+		So(report.Warnings[0], ShouldContainSubstring, "not a Trainer")
+		So(report.Warnings[1], ShouldContainSubstring, "SessionBehavior shadows")
+		So(report.Warnings[2], ShouldContainSubstring, "no item embedding")
+		So(blockOf(report, "UserBehavior").Active, ShouldBeFalse)
+		So(blockOf(report, "ItemEmbedding").Active, ShouldBeFalse)
+
+		defer func(channels []string) { BehaviorChannels = channels }(BehaviorChannels)
+		BehaviorChannels = []string{"click"}
+		report = Capabilities(idRecSys{})
+		So(report.Warnings, ShouldHaveLength, 1)
+		So(report.Warnings[0], ShouldContainSubstring, "MultiBehavior not implemented")
+		So(blockOf(report, "Behavior:click").Active, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,251 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	checkpointMetaFile      = "meta.json"
+	checkpointEmbeddingFile = "embedding.json"
+	checkpointSampleFile    = "samples.bin"
+	checkpointModelFile     = "model.ckpt"
+)
+
+var (
+	// CheckpointDir is the dir Train writes checkpoints to if not empty,
+	// use ResumeTrain to continue a crashed training from it.
+	CheckpointDir string
+	// CheckpointEvery is the epochs between two model checkpoints
+	CheckpointEvery = 1
+)
+
+// CheckpointMeta describes the progress saved in a Checkpoint
+type CheckpointMeta struct {
+	EmbeddingDone bool       `json:"embeddingDone"`
+	SampleDone    bool       `json:"sampleDone"`
+	SampleInfo    SampleInfo `json:"sampleInfo"`
+	// SampleCursor is the rows of samples saved
+	SampleCursor int   `json:"sampleCursor"`
+	XCols        int   `json:"xCols"`
+	Epoch        int   `json:"epoch"`
+	UpdatedAt    int64 `json:"updatedAt"`
+	// Tasks is the TrainSample.Tasks of the multi-task samples
+	Tasks int `json:"tasks,omitempty"`
+}
+
+// Checkpoint saves the embedding, assembled samples and partial model
+// weights of a training in Dir
+type Checkpoint struct {
+	Dir   string
+	Every int
+	Meta  CheckpointMeta
+}
+
+// CheckpointFitter is implemented by the Fitters which can save their
+// weights every ckpt.Every epochs with ckpt.SaveModel, and continue from
+// ckpt.LoadModel if it is not empty.
+type CheckpointFitter interface {
+	FitCheckpoint(sample *TrainSample, ckpt *Checkpoint) (PredictAbstract, error)
+}
+
+// OpenCheckpoint opens or creates the checkpoint in dir
+func OpenCheckpoint(dir string) (ckpt *Checkpoint, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	ckpt = &Checkpoint{Dir: dir, Every: CheckpointEvery}
+	data, err := os.ReadFile(filepath.Join(dir, checkpointMetaFile))
+	if os.IsNotExist(err) {
+		return ckpt, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &ckpt.Meta); err != nil {
+		return nil, fmt.Errorf("unmarshal checkpoint meta error: %v", err)
+	}
+	return
+}
+
+func (c *Checkpoint) path(name string) string {
+	return filepath.Join(c.Dir, name)
+}
+
+// writeFile writes data to a temp file and renames it to name, so a crash
+// never leaves a half written file
+func (c *Checkpoint) writeFile(name string, data []byte) (err error) {
+	tmp := c.path(name + ".tmp")
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, c.path(name))
+}
+
+// Reset drops the progress of the previous training in Dir, the empty meta
+// is saved first so a crash after it never resumes from the stale files
+func (c *Checkpoint) Reset() (err error) {
+	c.Meta = CheckpointMeta{}
+	if err = c.saveMeta(); err != nil {
+		return
+	}
+	for _, name := range []string{checkpointEmbeddingFile, checkpointSampleFile, checkpointModelFile} {
+		if err = os.Remove(c.path(name)); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	return nil
+}
+
+func (c *Checkpoint) saveMeta() (err error) {
+	c.Meta.UpdatedAt = time.Now().Unix()
+	data, err := json.Marshal(c.Meta)
+	if err != nil {
+		return
+	}
+	return c.writeFile(checkpointMetaFile, data)
+}
+
+func (c *Checkpoint) SaveEmbedding(embMap word2vec.EmbeddingMap32) (err error) {
+	data, err := json.Marshal(embMap)
+	if err != nil {
+		return
+	}
+	if err = c.writeFile(checkpointEmbeddingFile, data); err != nil {
+		return
+	}
+	c.Meta.EmbeddingDone = true
+	return c.saveMeta()
+}
+
+func (c *Checkpoint) LoadEmbedding() (embMap word2vec.EmbeddingMap32, err error) {
+	data, err := os.ReadFile(c.path(checkpointEmbeddingFile))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &embMap)
+	return
+}
+
+// SaveSample saves all the samples in the spill format, see ReplaySpill
+func (c *Checkpoint) SaveSample(sample *TrainSample) (err error) {
+	tmp := c.path(checkpointSampleFile + ".tmp")
+	sw, err := newSpillWriter(tmp)
+	if err != nil {
+		return
+	}
+	for start := 0; start < sample.Rows; start += MiniBatchSize {
+		end := start + MiniBatchSize
+		if end > sample.Rows {
+			end = sample.Rows
+		}
+		batch := MiniBatch{
+			X:     sample.X[start*sample.XCols : end*sample.XCols],
+			Y:     sample.Y[start:end],
+			Rows:  end - start,
+			XCols: sample.XCols,
+			Tasks: sample.Tasks,
+		}
+		if sample.Tasks != 0 {
+			batch.Labels = sample.Labels[start*sample.Tasks : end*sample.Tasks]
+		}
+		if err = sw.Write(batch); err != nil {
+			sw.Close()
+			return
+		}
+	}
+	if err = sw.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, c.path(checkpointSampleFile)); err != nil {
+		return
+	}
+	return c.sampleDone(sample.Info, sample.Rows, sample.XCols, sample.Tasks)
+}
+
+func (c *Checkpoint) sampleDone(info SampleInfo, rows, xCols, tasks int) error {
+	c.Meta.SampleDone = true
+	c.Meta.SampleInfo = info
+	c.Meta.SampleCursor = rows
+	c.Meta.XCols = xCols
+	c.Meta.Tasks = tasks
+	return c.saveMeta()
+}
+
+func (c *Checkpoint) LoadSample() (sample *TrainSample, err error) {
+	batchCh, errCh, err := ReplaySpill(c.path(checkpointSampleFile))
+	if err != nil {
+		return
+	}
+	sample = &TrainSample{
+		X:     make([]float32, 0, c.Meta.SampleCursor*c.Meta.XCols),
+		Y:     make([]float32, 0, c.Meta.SampleCursor),
+		XCols: c.Meta.XCols,
+		Info:  c.Meta.SampleInfo,
+		Tasks: c.Meta.Tasks,
+	}
+	for batch := range batchCh {
+		if batch.Tasks != sample.Tasks {
+			err = fmt.Errorf("checkpoint sample tasks mismatch: %d:%d", sample.Tasks, batch.Tasks)
+		}
+		sample.X = append(sample.X, batch.X...)
+		sample.Y = append(sample.Y, batch.Y...)
+		sample.Labels = append(sample.Labels, batch.Labels...)
+		sample.Rows += batch.Rows
+	}
+	if err != nil {
+		// drained to let the replay exit
+		<-errCh
+		return nil, err
+	}
+	if err = <-errCh; err != nil {
+		return nil, err
+	}
+	if sample.Rows != c.Meta.SampleCursor {
+		return nil, fmt.Errorf("checkpoint sample rows mismatch: %d:%d", c.Meta.SampleCursor, sample.Rows)
+	}
+	return
+}
+
+// SaveModel saves the model weights trained for epoch epochs
+func (c *Checkpoint) SaveModel(epoch int, data []byte) (err error) {
+	if err = c.writeFile(checkpointModelFile, data); err != nil {
+		return
+	}
+	c.Meta.Epoch = epoch
+	log.Infof("checkpoint saved at epoch %d", epoch)
+	return c.saveMeta()
+}
+
+// LoadModel returns the model weights saved, data is nil if no weights saved
+func (c *Checkpoint) LoadModel() (epoch int, data []byte, err error) {
+	if c.Meta.Epoch == 0 {
+		return
+	}
+	data, err = os.ReadFile(c.path(checkpointModelFile))
+	return c.Meta.Epoch, data, err
+}
+
+// ResumeTrain continues the training saved in checkpointPath by Train with
+// CheckpointDir set. Finished stages are loaded instead of rerun, samples are
+// reassembled from scratch if the crash happened during assembling.
+func ResumeTrain(ctx context.Context, checkpointPath string, recSys RecSys, mlp Fitter) (model Predictor, err error) {
+	ckpt, err := OpenCheckpoint(checkpointPath)
+	if err != nil {
+		log.Errorf("open checkpoint error: %v", err)
+		return
+	}
+	log.Infof("resume training from checkpoint %s: %+v", checkpointPath, ckpt.Meta)
+	result, err := train(ctx, recSys, mlp, ckpt)
+	if err != nil {
+		return
+	}
+	return result.Model, nil
+}
@@ -0,0 +1,57 @@
+package recommend
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckpointSample(t *testing.T) {
+	Convey("save and load the multi-task samples", t, func() {
+		defer func(size int) { MiniBatchSize = size }(MiniBatchSize)
+		MiniBatchSize = 2
+		ckpt, err := OpenCheckpoint(t.TempDir())
+		So(err, ShouldBeNil)
+		sample := &TrainSample{
+			X:      []float32{1, 2, 3, 4, 5, 6},
+			Y:      []float32{1, 0, 1},
+			Rows:   3,
+			XCols:  2,
+			Tasks:  2,
+			Labels: []float32{1, 1, 0, 0, 1, 0},
+		}
+		So(ckpt.SaveSample(sample), ShouldBeNil)
+
+		ckpt, err = OpenCheckpoint(ckpt.Dir)
+		So(err, ShouldBeNil)
+		So(ckpt.Meta.SampleDone, ShouldBeTrue)
+		loaded, err := ckpt.LoadSample()
+		So(err, ShouldBeNil)
+		So(loaded.Rows, ShouldEqual, 3)
+		So(loaded.X, ShouldResemble, sample.X)
+		So(loaded.Y, ShouldResemble, sample.Y)
+		So(loaded.Tasks, ShouldEqual, 2)
+		So(loaded.Labels, ShouldResemble, sample.Labels)
+	})
+}
+
+func TestCheckpointReset(t *testing.T) {
+	Convey("reset drops the previous training on disk", t, func() {
+		ckpt, err := OpenCheckpoint(t.TempDir())
+		So(err, ShouldBeNil)
+		So(ckpt.SaveSample(&TrainSample{X: []float32{1, 2}, Y: []float32{1}, Rows: 1, XCols: 2}), ShouldBeNil)
+		So(ckpt.SaveModel(3, []byte("weights")), ShouldBeNil)
+		So(ckpt.Reset(), ShouldBeNil)
+
+		ckpt, err = OpenCheckpoint(ckpt.Dir)
+		So(err, ShouldBeNil)
+		So(ckpt.Meta.SampleDone, ShouldBeFalse)
+		So(ckpt.Meta.Epoch, ShouldEqual, 0)
+		for _, name := range []string{checkpointSampleFile, checkpointModelFile} {
+			_, err = os.Stat(ckpt.path(name))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		}
+		So(ckpt.Reset(), ShouldBeNil)
+	})
+}
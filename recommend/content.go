@@ -0,0 +1,72 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ItemContentEmbedder supplies the embedding of the items missing in the
+// item2vec embedding, e.g. the cold-start items never seen in the behavior
+// sequences. The vector should be of ItemEmbDim and close to the item2vec
+// space, e.g. the average item2vec embedding of the items in the same
+// category, or a text embedding projected to ItemEmbDim.
+// The recSys may implement it, or register one to ContentEmbedder.
+type ItemContentEmbedder interface {
+	GetItemContentEmbedding(ctx context.Context, itemId int) ([]float32, error)
+}
+
+// ItemContentEmbedderFunc is an adapter to use a func as an ItemContentEmbedder
+type ItemContentEmbedderFunc func(ctx context.Context, itemId int) ([]float32, error)
+
+func (f ItemContentEmbedderFunc) GetItemContentEmbedding(ctx context.Context, itemId int) ([]float32, error) {
+	return f(ctx, itemId)
+}
+
+var (
+	// ContentEmbedder is used if the recSys does not implement ItemContentEmbedder
+	ContentEmbedder ItemContentEmbedder
+	// ContentEmbeddingTTL is the cache TTL of the content embeddings in
+	// ItemFeatureCache
+	ContentEmbeddingTTL = time.Hour
+)
+
+func contentEmbedderOf(featureProvider interface{}) ItemContentEmbedder {
+	if embedder, ok := featureProvider.(ItemContentEmbedder); ok {
+		return embedder
+	}
+	return ContentEmbedder
+}
+
+// itemEmbeddingOf returns the item2vec embedding of itemId, or the content
+// embedding if the item is missing and an ItemContentEmbedder is available
+func itemEmbeddingOf(ctx context.Context, cache *ccache.Cache, featureProvider interface{}, itemId int) (emb []float32, ok bool) {
+	if emb, ok = getItemEmbedding(itemId); ok {
+		return
+	}
+	embedder := contentEmbedderOf(featureProvider)
+	if embedder == nil || cache == nil {
+		return nil, false
+	}
+	value, err := fetchCache(ctx, cache, cacheItem, "content:"+strconv.Itoa(itemId), ContentEmbeddingTTL, func(ctx context.Context) (ci interface{}, err error) {
+		ctx, span := startSpan(ctx, "GetItemContentEmbedding")
+		defer func() { endSpan(span, err) }()
+		vec, err := embedder.GetItemContentEmbedding(ctx, itemId)
+		if err != nil {
+			return
+		}
+		if len(vec) != ItemEmbDim {
+			return nil, fmt.Errorf("content embedding of item %d dim %d != %d", itemId, len(vec), ItemEmbDim)
+		}
+		return Tensor(vec), nil
+	})
+	if err != nil {
+		log.Debugf("get item content embedding error: %v", err)
+		return nil, false
+	}
+	return value.(Tensor), true
+}
@@ -0,0 +1,79 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func filled(v float32, n int) []float32 {
+	vec := make([]float32, n)
+	for i := range vec {
+		vec[i] = v
+	}
+	return vec
+}
+
+// contentPredictor embeds the items by content as [3, 3, ...]
+type contentPredictor struct {
+	idPredictor
+}
+
+func (contentPredictor) GetItemContentEmbedding(context.Context, int) ([]float32, error) {
+	return filled(3, ItemEmbDim), nil
+}
+
+func TestItemContentEmbedder(t *testing.T) {
+	defer func(m word2vec.EmbeddingMap32, e ItemContentEmbedder) {
+		itemEmbeddingMap.store(m)
+		ContentEmbedder = e
+	}(itemEmbeddingMap.load(), ContentEmbedder)
+
+	itemEmbOf := func(recSys BasicFeatureProvider, itemId int) []float32 {
+		vec, _, _, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache,
+			recSys, &Sample{UserId: 1, ItemId: itemId})
+		So(err, ShouldBeNil)
+		// user feature, user behaviors, item embedding, item feature
+		start := 1 + ItemEmbDim*UserBehaviorLen
+		return vec[start : start+ItemEmbDim]
+	}
+
+	Convey("content embedding for the items missing in item2vec", t, func() {
+		resetFeatureCache()
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": filled(1, ItemEmbDim)})
+		var calls int
+		ContentEmbedder = ItemContentEmbedderFunc(func(_ context.Context, itemId int) ([]float32, error) {
+			calls++
+			switch itemId {
+			case 2:
+				return filled(2, ItemEmbDim), nil
+			case 3:
+				return nil, errors.New("no content")
+			}
+			return filled(4, 2), nil
+		})
+
+		So(itemEmbOf(idPredictor{}, 1), ShouldResemble, filled(1, ItemEmbDim))
+		So(calls, ShouldEqual, 0)
+		So(itemEmbOf(idPredictor{}, 2), ShouldResemble, filled(2, ItemEmbDim))
+		So(itemEmbOf(idPredictor{}, 3), ShouldResemble, filled(0, ItemEmbDim))
+		So(itemEmbOf(idPredictor{}, 4), ShouldResemble, filled(0, ItemEmbDim))
+		So(calls, ShouldEqual, 3)
+
+		// cached
+		So(itemEmbOf(idPredictor{}, 2), ShouldResemble, filled(2, ItemEmbDim))
+		So(calls, ShouldEqual, 3)
+
+		// the recSys implementation takes precedence
+		resetFeatureCache()
+		So(itemEmbOf(contentPredictor{}, 2), ShouldResemble, filled(3, ItemEmbDim))
+		So(calls, ShouldEqual, 3)
+
+		ContentEmbedder = nil
+		resetFeatureCache()
+		So(itemEmbOf(idPredictor{}, 2), ShouldResemble, filled(0, ItemEmbDim))
+	})
+}
@@ -0,0 +1,79 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/auxten/go-ctr/utils"
+)
+
+const ctxFeaturesKey ctxKey = "ctxFeatures"
+
+// CtxFeaturer provides the context features of a sample, e.g. the device,
+// the placement, the hour or the geo of the request. In Train they are the
+// context of the sample when it happened, in predict the ones passed to
+// RankWithContext take precedence.
+type CtxFeaturer interface {
+	GetCtxFeature(ctx context.Context, sample *Sample) (Tensor, error)
+}
+
+// CtxFeatureWidth is the width of the request context features appended
+// after all the other features, see SampleInfo.RequestCtxRange. 0 means no
+// context features. The features are zeros if neither CtxFeaturer nor
+// RankWithContext provides them. Must be the same in Train and predict.
+var CtxFeatureWidth int
+
+// WithCtxFeatures returns the ctx predicting with the context features
+func WithCtxFeatures(ctx context.Context, ctxFeatures Tensor) context.Context {
+	return context.WithValue(ctx, ctxFeaturesKey, ctxFeatures)
+}
+
+// RankWithContext is Rank with the context features of the request
+func RankWithContext(ctx context.Context, recSys Predictor, userId int, itemIds []int, ctxFeatures Tensor) (itemScores []ItemScore, err error) {
+	if err = checkCtxFeatures(ctxFeatures); err != nil {
+		return
+	}
+	return Rank(WithCtxFeatures(ctx, ctxFeatures), recSys, userId, itemIds)
+}
+
+func checkCtxFeatures(ctxFeatures Tensor) error {
+	if len(ctxFeatures) != CtxFeatureWidth {
+		return fmt.Errorf("context feature width %d != %d", len(ctxFeatures), CtxFeatureWidth)
+	}
+	return nil
+}
+
+// getCtxFeature returns the context features of sampleKey followed by the
+// CyclicalTimeEncoding if CyclicalTimeFeatures
+func getCtxFeature(ctx context.Context, featureProvider interface{}, sampleKey *Sample) (ctxFeature Tensor, err error) {
+	if ctxFeature, err = getRequestCtxFeature(ctx, featureProvider, sampleKey); err != nil {
+		return
+	}
+	if CyclicalTimeFeatures {
+		ctxFeature = utils.ConcatSlice32(ctxFeature, CyclicalTimeEncoding(sampleKey.Timestamp, CyclicalTimeLocation))
+	}
+	return
+}
+
+func getRequestCtxFeature(ctx context.Context, featureProvider interface{}, sampleKey *Sample) (ctxFeature Tensor, err error) {
+	if CtxFeatureWidth <= 0 {
+		return
+	}
+	if ctxFeature, _ = ctx.Value(ctxFeaturesKey).(Tensor); ctxFeature == nil {
+		if ctxFeaturer, ok := featureProvider.(CtxFeaturer); ok {
+			ctx, span := startSpan(ctx, "GetCtxFeature")
+			ctxFeature, err = ctxFeaturer.GetCtxFeature(ctx, sampleKey)
+			endSpan(span, err)
+			if err != nil {
+				return nil, newSampleError(sampleKey, ErrProvider, err)
+			}
+		}
+	}
+	if ctxFeature == nil {
+		return make(Tensor, CtxFeatureWidth), nil
+	}
+	if err = checkCtxFeatures(ctxFeature); err != nil {
+		return nil, newSampleError(sampleKey, ErrProvider, err)
+	}
+	return
+}
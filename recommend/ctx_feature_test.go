@@ -0,0 +1,63 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// ctxPredictor has the context features [hour, 1] of the samples, the score
+// is the last context feature
+type ctxPredictor struct {
+	idPredictor
+}
+
+func (ctxPredictor) GetCtxFeature(_ context.Context, sample *Sample) (Tensor, error) {
+	return Tensor{float32(sample.Timestamp / 3600 % 24), 1}, nil
+}
+
+func TestCtxFeatures(t *testing.T) {
+	defer func(w int) { CtxFeatureWidth = w }(CtxFeatureWidth)
+
+	Convey("context features of train and serve", t, func() {
+		resetFeatureCache()
+		CtxFeatureWidth = 2
+		vec, uWidth, iWidth, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache,
+			ctxPredictor{}, &Sample{UserId: 1, ItemId: 2, Timestamp: 5 * 3600})
+		So(err, ShouldBeNil)
+		info := newSampleInfo(uWidth, iWidth)
+		So(info.RequestCtxRange[1], ShouldEqual, len(vec))
+		So(vec[info.RequestCtxRange[0]:], ShouldResemble, []float32{5, 1})
+		So(vec[info.CtxFeatureRange[0]], ShouldEqual, 2)
+
+		scores, err := Rank(context.Background(), ctxPredictor{}, 1, []int{1, 2})
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{{ItemId: 1, Score: 1}, {ItemId: 2, Score: 1}})
+
+		scores, err = RankWithContext(context.Background(), ctxPredictor{}, 1, []int{1, 2}, Tensor{0, 9})
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{{ItemId: 1, Score: 9}, {ItemId: 2, Score: 9}})
+
+		// zeros without CtxFeaturer
+		scores, err = Rank(context.Background(), idPredictor{}, 1, []int{1})
+		So(err, ShouldBeNil)
+		So(scores[0].Score, ShouldEqual, 0)
+
+		_, err = RankWithContext(context.Background(), ctxPredictor{}, 1, []int{1}, Tensor{1})
+		So(err, ShouldNotBeNil)
+		_, code, err := serveRecRequest(context.Background(), ctxPredictor{}, RecApiRequest{UserId: 1, ItemIdList: []int{1}, Context: Tensor{1}})
+		So(err, ShouldNotBeNil)
+		So(code, ShouldEqual, 400)
+		resp, _, err := serveRecRequest(context.Background(), ctxPredictor{}, RecApiRequest{UserId: 1, ItemIdList: []int{1}, Context: Tensor{0, 3}})
+		So(err, ShouldBeNil)
+		So(resp.ItemScoreList[0].Score, ShouldEqual, 3)
+
+		sd, err := DebugSample(WithCtxFeatures(context.Background(), Tensor{0, 4}), ctxPredictor{}, 1, 2)
+		So(err, ShouldBeNil)
+		last := sd.Segments[len(sd.Segments)-1]
+		So(last.Name, ShouldEqual, "RequestCtx")
+		So(last.Source, ShouldEqual, "request")
+		So(last.Values, ShouldResemble, []float32{0, 4})
+	})
+}
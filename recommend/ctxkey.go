@@ -0,0 +1,105 @@
+package recommend
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ctxKey is the type of the ctx keys of the package, the keys never collide
+// with the string keys of the other packages, e.g. the Keys of gin.Context
+type ctxKey string
+
+const (
+	// StageKey is the ctx key of the Stage, see WithStage and StageOf
+	StageKey       ctxKey = "stage"
+	requestMetaKey ctxKey = "requestMeta"
+)
+
+// RequestIdHeader is the http header of the recommend api carrying the
+// request id, a request without it gets a generated one
+const RequestIdHeader = "X-Request-Id"
+
+var requestSeq uint64
+
+// RequestMeta is the metadata of a request carried through ctx, the
+// featurers, the middlewares and the logs get it by RequestMetaOf
+type RequestMeta struct {
+	// Stage is set by Train and BatchPredict, ignored by WithRequestMeta
+	Stage     Stage     `json:"stage"`
+	RequestId string    `json:"requestId,omitempty"`
+	Surface   string    `json:"surface,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Deadline  time.Time `json:"deadline,omitempty"`
+}
+
+// Fields returns the log fields of the non-empty metadata
+func (m RequestMeta) Fields() log.Fields {
+	fields := log.Fields{}
+	if m.RequestId != "" {
+		fields["requestId"] = m.RequestId
+	}
+	if m.Surface != "" {
+		fields["surface"] = m.Surface
+	}
+	if m.Tenant != "" {
+		fields["tenant"] = m.Tenant
+	}
+	return fields
+}
+
+// WithStage returns the ctx of stage
+func WithStage(ctx context.Context, stage Stage) context.Context {
+	return context.WithValue(ctx, StageKey, stage)
+}
+
+// StageOf returns the Stage of ctx, ok is false if not set
+func StageOf(ctx context.Context) (stage Stage, ok bool) {
+	stage, ok = ctx.Value(StageKey).(Stage)
+	return
+}
+
+// inStage tells if ctx is of stage
+func inStage(ctx context.Context, stage Stage) bool {
+	s, ok := StageOf(ctx)
+	return ok && s == stage
+}
+
+// WithRequestMeta returns the ctx carrying meta
+func WithRequestMeta(ctx context.Context, meta RequestMeta) context.Context {
+	return context.WithValue(ctx, requestMetaKey, meta)
+}
+
+// RequestMetaOf returns the RequestMeta of ctx, the Stage is the one of ctx
+// and the Deadline is the one of ctx if not set
+func RequestMetaOf(ctx context.Context) (meta RequestMeta) {
+	meta, _ = ctx.Value(requestMetaKey).(RequestMeta)
+	meta.Stage, _ = StageOf(ctx)
+	if meta.Deadline.IsZero() {
+		meta.Deadline, _ = ctx.Deadline()
+	}
+	return
+}
+
+// logOf returns the logger with the fields of the RequestMeta of ctx
+func logOf(ctx context.Context) *log.Entry {
+	return log.WithFields(RequestMetaOf(ctx).Fields())
+}
+
+// requestMetaOfHttp returns the RequestMeta of the headers of c
+func requestMetaOfHttp(c *gin.Context) RequestMeta {
+	meta := RequestMeta{
+		RequestId: c.GetHeader(RequestIdHeader),
+		Surface:   c.GetHeader(SurfaceHeader),
+		Tenant:    c.GetHeader(TenantHeader),
+	}
+	if meta.RequestId == "" {
+		meta.RequestId = strconv.FormatInt(time.Now().UnixNano(), 36) + "-" +
+			strconv.FormatUint(atomic.AddUint64(&requestSeq, 1), 36)
+	}
+	return meta
+}
@@ -0,0 +1,50 @@
+package recommend
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequestMeta(t *testing.T) {
+	Convey("request meta", t, func() {
+		ctx := context.Background()
+		_, ok := StageOf(ctx)
+		So(ok, ShouldBeFalse)
+		So(inStage(ctx, TrainStage), ShouldBeFalse)
+		// the string key of other packages does not collide
+		ctx = context.WithValue(ctx, "stage", PredictStage)
+		_, ok = StageOf(ctx)
+		So(ok, ShouldBeFalse)
+
+		ctx = WithRequestMeta(WithStage(ctx, PredictStage), RequestMeta{RequestId: "r1", Tenant: "acme"})
+		ctx, cancel := context.WithDeadline(ctx, time.Unix(2000000000, 0))
+		defer cancel()
+		meta := RequestMetaOf(ctx)
+		So(meta.Stage, ShouldEqual, PredictStage)
+		So(meta.RequestId, ShouldEqual, "r1")
+		So(meta.Deadline.Unix(), ShouldEqual, 2000000000)
+		So(meta.Fields(), ShouldResemble, log.Fields{"requestId": "r1", "tenant": "acme"})
+		So(inStage(ctx, PredictStage), ShouldBeTrue)
+	})
+
+	Convey("request meta of http headers", t, func() {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/api/v1/recommend", nil)
+		c.Request.Header.Set(TenantHeader, "acme")
+		c.Request.Header.Set(SurfaceHeader, "home")
+		meta := requestMetaOfHttp(c)
+		So(meta.Tenant, ShouldEqual, "acme")
+		So(meta.Surface, ShouldEqual, "home")
+		So(meta.RequestId, ShouldNotBeEmpty)
+		So(requestMetaOfHttp(c).RequestId, ShouldNotEqual, meta.RequestId)
+
+		c.Request.Header.Set(RequestIdHeader, "r2")
+		So(requestMetaOfHttp(c).RequestId, ShouldEqual, "r2")
+	})
+}
@@ -0,0 +1,209 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CVFold is the train and validation rows of a cross-validation fold
+type CVFold struct {
+	Train *TrainSample
+	Valid *TrainSample
+}
+
+// MetricSummary is the mean of a metric over the folds with the 95%
+// confidence interval [Low, High] of the Student's t distribution
+type MetricSummary struct {
+	Mean float64 `json:"mean"`
+	Std  float64 `json:"std"`
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// CVReport is the EvalMetrics of every fold and their summaries, AUC and
+// LogLoss are of ObjectiveBinary only
+type CVReport struct {
+	Folds   []*EvalMetrics `json:"folds"`
+	AUC     *MetricSummary `json:"auc,omitempty"`
+	LogLoss *MetricSummary `json:"logLoss,omitempty"`
+	RMSE    *MetricSummary `json:"rmse"`
+	MAE     *MetricSummary `json:"mae"`
+}
+
+// KFoldByUser splits the rows of sample into k folds by the hash of the
+// user, so the rows of a user are all in the same fold and the validation
+// is on the unseen users
+func KFoldByUser(sample *TrainSample, k int) (folds []CVFold, err error) {
+	if err = checkKeys(sample, k); err != nil {
+		return
+	}
+	fold := make([][]int, k)
+	for i, key := range sample.Keys {
+		h := fnv.New32a()
+		h.Write([]byte(strconv.Itoa(key.UserId)))
+		f := int(h.Sum32() % uint32(k))
+		fold[f] = append(fold[f], i)
+	}
+	for f := range fold {
+		var train []int
+		for g := range fold {
+			if g != f {
+				train = append(train, fold[g]...)
+			}
+		}
+		sort.Ints(train)
+		folds = append(folds, CVFold{Train: sample.subset(train), Valid: sample.subset(fold[f])})
+	}
+	return
+}
+
+// TimeSeriesFolds splits the rows of sample ordered by the time into k+1
+// windows of the same rows, the fold i trains on the windows up to i and
+// validates on the window i+1, so the model never sees the future
+func TimeSeriesFolds(sample *TrainSample, k int) (folds []CVFold, err error) {
+	if err = checkKeys(sample, k); err != nil {
+		return
+	}
+	order := make([]int, sample.Rows)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sample.Keys[order[i]].Timestamp < sample.Keys[order[j]].Timestamp
+	})
+	window := sample.Rows / (k + 1)
+	if window == 0 {
+		return nil, fmt.Errorf("too few rows %d for %d time windows", sample.Rows, k+1)
+	}
+	for f := 1; f <= k; f++ {
+		end := (f + 1) * window
+		if f == k {
+			end = sample.Rows
+		}
+		folds = append(folds, CVFold{
+			Train: sample.subset(order[:f*window]),
+			Valid: sample.subset(order[f*window : end]),
+		})
+	}
+	return
+}
+
+func checkKeys(sample *TrainSample, k int) error {
+	if k < 2 {
+		return fmt.Errorf("folds %d < 2", k)
+	}
+	if len(sample.Keys) != sample.Rows {
+		return fmt.Errorf("sample has no keys to split")
+	}
+	return nil
+}
+
+// CrossValidate fits a Fitter of newFitter on every fold, seeded by
+// WithTrainSeed of ctx if any, and summarizes the EvalMetrics of them by
+// LabelObjective
+func CrossValidate(ctx context.Context, folds []CVFold, newFitter func() Fitter) (report *CVReport, err error) {
+	report = &CVReport{}
+	for i, fold := range folds {
+		if fold.Train.Rows == 0 || fold.Valid.Rows == 0 {
+			return nil, fmt.Errorf("fold %d is empty", i)
+		}
+		fitter := newFitter()
+		if err = setTrainLoss(fitter); err != nil {
+			return nil, err
+		}
+		setTrainSeed(ctx, fitter)
+		var pred PredictAbstract
+		if pred, err = fitter.Fit(fold.Train); err != nil {
+			return nil, fmt.Errorf("fit fold %d error: %v", i, err)
+		}
+		var m *EvalMetrics
+		if m, err = Evaluate(pred, fold.Valid); err != nil {
+			return nil, fmt.Errorf("evaluate fold %d error: %v", i, err)
+		}
+		log.Infof("cv fold %d: %+v", i, *m)
+		report.Folds = append(report.Folds, m)
+	}
+
+	metric := func(f func(m *EvalMetrics) float64) *MetricSummary {
+		values := make([]float64, len(report.Folds))
+		for i, m := range report.Folds {
+			values[i] = f(m)
+		}
+		return summarize(values)
+	}
+	report.RMSE = metric(func(m *EvalMetrics) float64 { return m.RMSE })
+	report.MAE = metric(func(m *EvalMetrics) float64 { return m.MAE })
+	if LabelObjective == ObjectiveBinary {
+		report.AUC = metric(func(m *EvalMetrics) float64 { return float64(m.AUC) })
+		report.LogLoss = metric(func(m *EvalMetrics) float64 { return m.LogLoss })
+	}
+	return
+}
+
+// tQuantiles975 is the 0.975 quantile of the Student's t distribution of
+// the degrees of freedom 1 to 30
+var tQuantiles975 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// summarize returns the MetricSummary of values
+func summarize(values []float64) (s *MetricSummary) {
+	s = &MetricSummary{}
+	n := float64(len(values))
+	if n == 0 {
+		return
+	}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= n
+	s.Low, s.High = s.Mean, s.Mean
+	if len(values) < 2 {
+		return
+	}
+	for _, v := range values {
+		s.Std += (v - s.Mean) * (v - s.Mean)
+	}
+	s.Std = math.Sqrt(s.Std / (n - 1))
+	t := 1.96
+	if df := len(values) - 1; df <= len(tQuantiles975) {
+		t = tQuantiles975[df-1]
+	}
+	half := t * s.Std / math.Sqrt(n)
+	s.Low, s.High = s.Mean-half, s.Mean+half
+	return
+}
+
+// subset returns the TrainSample of the rows of sample
+func (sample *TrainSample) subset(rows []int) (sub *TrainSample) {
+	sub = &TrainSample{
+		X:     make([]float32, 0, len(rows)*sample.XCols),
+		Y:     make([]float32, 0, len(rows)),
+		Rows:  len(rows),
+		XCols: sample.XCols,
+		Info:  sample.Info,
+		Tasks: sample.Tasks,
+	}
+	for _, r := range rows {
+		sub.X = append(sub.X, sample.X[r*sample.XCols:(r+1)*sample.XCols]...)
+		sub.Y = append(sub.Y, sample.Y[r])
+		if sample.Sparse != nil {
+			sub.Sparse = append(sub.Sparse, sample.Sparse[r])
+		}
+		if sample.Tasks != 0 {
+			sub.Labels = append(sub.Labels, sample.Labels[r*sample.Tasks:(r+1)*sample.Tasks]...)
+		}
+		if len(sample.Keys) == sample.Rows {
+			sub.Keys = append(sub.Keys, sample.Keys[r])
+		}
+	}
+	return
+}
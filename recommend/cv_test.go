@@ -0,0 +1,98 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCrossValidation(t *testing.T) {
+	Convey("sample keys", t, func() {
+		resetFeatureCache()
+		sample, err := GetSample(idRecSys{}, context.Background())
+		So(err, ShouldBeNil)
+		So(sample.Keys, ShouldHaveLength, sample.Rows)
+		for i, key := range sample.Keys {
+			So(sample.X[(i+1)*sample.XCols-1], ShouldEqual, key.ItemId)
+		}
+	})
+
+	Convey("cross validate", t, func() {
+		// the item id is the feature, the label is set from the item 50
+		sample := &TrainSample{XCols: 1}
+		for i := 0; i < 600; i++ {
+			item := i % 100
+			sample.X = append(sample.X, float32(item))
+			if item >= 50 {
+				sample.Y = append(sample.Y, 1)
+			} else {
+				sample.Y = append(sample.Y, 0)
+			}
+			sample.Keys = append(sample.Keys, SampleKey{UserId: i % 13, ItemId: item, Timestamp: int64(600 - i)})
+			sample.Rows++
+		}
+
+		Convey("by user", func() {
+			folds, err := KFoldByUser(sample, 4)
+			So(err, ShouldBeNil)
+			So(folds, ShouldHaveLength, 4)
+			var validRows int
+			for _, fold := range folds {
+				So(fold.Train.Rows+fold.Valid.Rows, ShouldEqual, sample.Rows)
+				users := make(map[int]bool)
+				for _, key := range fold.Valid.Keys {
+					users[key.UserId] = true
+				}
+				for _, key := range fold.Train.Keys {
+					So(users[key.UserId], ShouldBeFalse)
+				}
+				validRows += fold.Valid.Rows
+			}
+			So(validRows, ShouldEqual, sample.Rows)
+
+			report, err := CrossValidate(context.Background(), folds, func() Fitter { return &idFitter{} })
+			So(err, ShouldBeNil)
+			So(report.Folds, ShouldHaveLength, 4)
+			So(report.AUC.Mean, ShouldEqual, 1)
+			So(report.AUC.Low, ShouldEqual, 1)
+			So(report.RMSE.Std, ShouldBeGreaterThan, 0)
+			So(report.RMSE.Low, ShouldBeLessThan, report.RMSE.Mean)
+			So(report.RMSE.High, ShouldBeGreaterThan, report.RMSE.Mean)
+		})
+
+		Convey("by time", func() {
+			folds, err := TimeSeriesFolds(sample, 3)
+			So(err, ShouldBeNil)
+			So(folds, ShouldHaveLength, 3)
+			for i, fold := range folds {
+				So(fold.Train.Rows, ShouldEqual, 150*(i+1))
+				So(fold.Valid.Rows, ShouldEqual, 150)
+				var last int64
+				for _, key := range fold.Train.Keys {
+					if key.Timestamp > last {
+						last = key.Timestamp
+					}
+				}
+				for _, key := range fold.Valid.Keys {
+					So(key.Timestamp, ShouldBeGreaterThan, last)
+				}
+			}
+		})
+
+		Convey("no keys", func() {
+			sample.Keys = nil
+			_, err := KFoldByUser(sample, 4)
+			So(err, ShouldNotBeNil)
+			_, err = TimeSeriesFolds(sample, 1)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("summarize", t, func() {
+		s := summarize([]float64{1, 2, 3})
+		So(s.Mean, ShouldEqual, 2)
+		So(s.Std, ShouldEqual, 1)
+		So(s.High-s.Mean, ShouldAlmostEqual, 4.303/1.7320508, 1e-4)
+	})
+}
@@ -0,0 +1,239 @@
+package recommend
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/karlseguin/ccache/v2"
+)
+
+// DebugTokenHeader is the header carrying DebugToken
+const DebugTokenHeader = "X-Debug-Token"
+
+// DebugToken enables the /debug endpoints of the recommend api if not empty,
+// the requests must carry it in DebugTokenHeader
+var DebugToken string
+
+// DebugKey is the ctx key of the DebugTrace set by WithDebug
+const DebugKey ctxKey = "debug"
+
+const (
+	SourceCache    = "cache"
+	SourceProvider = "provider"
+	SourceNone     = "none"
+	SourceShared   = "shared"
+)
+
+// DebugAuth is the gin middleware rejecting the requests without token in
+// DebugTokenHeader
+func DebugAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !debugAuthorized(c, token) {
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid debug token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// debugAuthorized returns true if c carries token in DebugTokenHeader, an
+// empty token authorizes nothing
+func debugAuthorized(c *gin.Context, token string) bool {
+	got := c.GetHeader(DebugTokenHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// FeatureNamer is optional for the feature provider, the names are used to
+// label the vector values in debug output
+type FeatureNamer interface {
+	UserFeatureNames() []string
+	ItemFeatureNames() []string
+}
+
+// FeatureSegment is a SampleInfo range of an assembled sample vector
+type FeatureSegment struct {
+	Name   string    `json:"name"`
+	Range  [2]int    `json:"range"`
+	Source string    `json:"source"`
+	Names  []string  `json:"names,omitempty"`
+	Values []float32 `json:"values"`
+}
+
+// SampleDebug is the feature breakdown of a user-item sample
+type SampleDebug struct {
+	UserId   int              `json:"userId"`
+	ItemId   int              `json:"itemId"`
+	Info     SampleInfo       `json:"info"`
+	Segments []FeatureSegment `json:"segments"`
+	Score    float32          `json:"score"`
+}
+
+// DebugSample assembles the sample vector of userId and itemId like
+// BatchPredict does, and returns it segmented by SampleInfo ranges with
+// the score predicted.
+func DebugSample(ctx context.Context, recSys Predictor, userId int, itemId int) (sd *SampleDebug, err error) {
+	if UserFeatureCache == nil || ItemFeatureCache == nil {
+		err = fmt.Errorf("feature cache not initialized")
+		return
+	}
+	sampleKey := Sample{
+		UserId:    userId,
+		ItemId:    itemId,
+		Timestamp: time.Now().Unix(),
+	}
+	userSource := cacheSource(UserFeatureCache, strconv.Itoa(userId))
+	itemSource := cacheSource(ItemFeatureCache, strconv.Itoa(itemId))
+	if SharedItemFeatures != nil {
+		if _, ok := SharedItemFeatures.Get(itemId); ok {
+			itemSource = SourceShared
+		}
+	}
+	behaviorSource, channelSource, embSource := SourceNone, SourceNone, SourceNone
+	if hasItemEmbedding() {
+		embSource = "embedding"
+		if hasBehavior(recSys) {
+			behaviorSource = SourceProvider
+		}
+		if _, ok := recSys.(MultiBehavior); ok {
+			channelSource = SourceProvider
+		}
+	}
+
+	ctxSource := SourceNone
+	if _, ok := ctx.Value(ctxFeaturesKey).(Tensor); ok {
+		ctxSource = "request"
+	} else if _, ok := recSys.(CtxFeaturer); ok {
+		ctxSource = SourceProvider
+	}
+	sparseSource := SourceNone
+	if _, ok := recSys.(SparseFeaturer); ok {
+		sparseSource = SourceProvider
+	}
+
+	vec, uWidth, iWidth, err := GetSampleVector(WithStage(ctx, PredictStage),
+		UserFeatureCache, ItemFeatureCache, recSys, &sampleKey)
+	if err != nil {
+		return
+	}
+	y, err := BatchPredict(ctx, recSys, []Sample{sampleKey})
+	if err != nil {
+		return
+	}
+	score, err := y.At(0, 0)
+	if err != nil {
+		return
+	}
+
+	var userNames, itemNames []string
+	if namer, ok := recSys.(FeatureNamer); ok {
+		userNames = namer.UserFeatureNames()
+		itemNames = namer.ItemFeatureNames()
+	} else if schema := featureSchemaOf(recSys); schema != nil {
+		userNames, itemNames = schema.fieldNames(schema.User), schema.fieldNames(schema.Item)
+	}
+	info := newSampleInfo(uWidth, iWidth)
+	sd = &SampleDebug{
+		UserId: userId,
+		ItemId: itemId,
+		Info:   info,
+		Score:  score.(float32),
+		Segments: []FeatureSegment{
+			newFeatureSegment("UserProfile", info.UserProfileRange, userSource, userNames, vec),
+			newFeatureSegment("UserBehavior", info.UserBehaviorRange, behaviorSource, nil, vec),
+			newFeatureSegment("ItemEmbedding", info.ItemFeatureRange, embSource, nil, vec),
+			newFeatureSegment("ItemFeature", info.CtxFeatureRange, itemSource, itemNames, vec),
+		},
+	}
+	for _, ch := range info.BehaviorChannelRanges {
+		sd.Segments = append(sd.Segments, newFeatureSegment("Behavior:"+ch.Name, ch.Range, channelSource, nil, vec))
+	}
+	if ctxFeatureWidth() > 0 {
+		sd.Segments = append(sd.Segments, newFeatureSegment("RequestCtx", info.RequestCtxRange, ctxSource, nil, vec))
+	}
+	if SparseFeatureDim > 0 {
+		sd.Segments = append(sd.Segments, newFeatureSegment("Sparse", info.SparseRange, sparseSource, nil, vec))
+	}
+	return
+}
+
+func newFeatureSegment(name string, rng [2]int, source string, names []string, vec []float32) FeatureSegment {
+	if len(names) != rng[1]-rng[0] {
+		names = nil
+	}
+	return FeatureSegment{
+		Name:   name,
+		Range:  rng,
+		Source: source,
+		Names:  names,
+		Values: vec[rng[0]:rng[1]],
+	}
+}
+
+// cacheSource tells whether the feature of key will be served from cache
+func cacheSource(cache *ccache.Cache, key string) string {
+	if item := cache.Get(key); item != nil && !item.Expired() {
+		return SourceCache
+	}
+	return SourceProvider
+}
+
+// DebugEntry is a sample matched by the DebugTrace in BatchPredict
+type DebugEntry struct {
+	UserId int        `json:"userId"`
+	ItemId int        `json:"itemId"`
+	Info   SampleInfo `json:"info"`
+	Vector []float32  `json:"vector"`
+	Score  float32    `json:"score"`
+	// Error is set if the sample failed and was predicted with a zero vector
+	Error string `json:"error,omitempty"`
+}
+
+// DebugTrace collects the assembled vectors and scores of the matched samples
+// of a single request, see WithDebug
+type DebugTrace struct {
+	mu      sync.Mutex
+	userIds map[int]bool
+	itemIds map[int]bool
+	Entries []DebugEntry `json:"entries"`
+}
+
+// WithDebug returns a ctx making BatchPredict collect the samples of userIds
+// and itemIds into the returned DebugTrace, empty userIds or itemIds match
+// all. It replaces the racy DebugUserId and DebugItemId globals.
+func WithDebug(ctx context.Context, userIds, itemIds []int) (context.Context, *DebugTrace) {
+	trace := &DebugTrace{}
+	if len(userIds) != 0 {
+		trace.userIds = make(map[int]bool, len(userIds))
+		for _, id := range userIds {
+			trace.userIds[id] = true
+		}
+	}
+	if len(itemIds) != 0 {
+		trace.itemIds = make(map[int]bool, len(itemIds))
+		for _, id := range itemIds {
+			trace.itemIds[id] = true
+		}
+	}
+	return context.WithValue(ctx, DebugKey, trace), trace
+}
+
+func debugTraceOf(ctx context.Context) *DebugTrace {
+	trace, _ := ctx.Value(DebugKey).(*DebugTrace)
+	return trace
+}
+
+func (t *DebugTrace) match(sampleKey *Sample) bool {
+	return (t.userIds == nil || t.userIds[sampleKey.UserId]) &&
+		(t.itemIds == nil || t.itemIds[sampleKey.ItemId])
+}
+
+func (t *DebugTrace) add(entries ...DebugEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Entries = append(t.Entries, entries...)
+}
@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDebugTrace(t *testing.T) {
+	Convey("per request debug trace", t, func() {
+		resetFeatureCache()
+		ctx, trace := WithDebug(context.Background(), []int{1}, []int{20, 99})
+
+		_, err := Rank(ctx, lossyRecSys{}, 1, []int{10, 20, 99})
+		So(err, ShouldBeNil)
+		So(trace.Entries, ShouldHaveLength, 2)
+		So(trace.Entries[0].ItemId, ShouldEqual, 20)
+		So(trace.Entries[0].Score, ShouldEqual, 20)
+		So(trace.Entries[0].Vector[trace.Entries[0].Info.CtxFeatureRange[0]], ShouldEqual, 20)
+		So(trace.Entries[0].Error, ShouldBeEmpty)
+		// zero vector of the missing item
+		So(trace.Entries[1].ItemId, ShouldEqual, 99)
+		So(trace.Entries[1].Error, ShouldNotBeEmpty)
+
+		// other users not matched, requests without WithDebug not traced
+		_, err = Rank(ctx, idPredictor{}, 2, []int{20})
+		So(err, ShouldBeNil)
+		_, err = Rank(context.Background(), idPredictor{}, 1, []int{20})
+		So(err, ShouldBeNil)
+		So(trace.Entries, ShouldHaveLength, 2)
+
+		ctx, trace = WithDebug(context.Background(), nil, nil)
+		_, err = Rank(ctx, idPredictor{}, 3, []int{1, 2})
+		So(err, ShouldBeNil)
+		So(trace.Entries, ShouldHaveLength, 2)
+	})
+}
+
+func TestDebugSample(t *testing.T) {
+	Convey("feature breakdown of the sample", t, func() {
+		resetFeatureCache()
+		ctx := context.Background()
+		sd, err := DebugSample(ctx, idPredictor{}, 3, 42)
+		So(err, ShouldBeNil)
+		So(sd.Score, ShouldEqual, 42)
+		So(sd.Segments, ShouldHaveLength, 4)
+		So(sd.Segments[0].Name, ShouldEqual, "UserProfile")
+		So(sd.Segments[0].Source, ShouldEqual, SourceProvider)
+		So(sd.Segments[0].Values, ShouldResemble, []float32{3})
+		So(sd.Segments[3].Name, ShouldEqual, "ItemFeature")
+		So(sd.Segments[3].Values, ShouldResemble, []float32{42})
+
+		// cached by the first sample
+		sd, err = DebugSample(ctx, idPredictor{}, 3, 42)
+		So(err, ShouldBeNil)
+		So(sd.Segments[0].Source, ShouldEqual, SourceCache)
+		So(sd.Segments[3].Source, ShouldEqual, SourceCache)
+	})
+
+	Convey("debug api guarded by the token", t, func() {
+		resetFeatureCache()
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		DebugRoutes(engine.Group("/debug", DebugAuth("s3cret")), idPredictor{})
+		get := func(path, token string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", path, nil)
+			if token != "" {
+				req.Header.Set(DebugTokenHeader, token)
+			}
+			engine.ServeHTTP(w, req)
+			return w
+		}
+		for _, path := range []string{"/debug/sample?user=3&item=42", "/debug/explain?user=3&items=1,2", "/debug/user?user=3",
+			"/debug/similarusers?user=3"} {
+			So(get(path, "").Code, ShouldEqual, 401)
+			So(get(path, "bad").Code, ShouldEqual, 401)
+		}
+
+		w := get("/debug/sample?user=3&item=42", "s3cret")
+		So(w.Code, ShouldEqual, 200)
+		var sd SampleDebug
+		So(json.Unmarshal(w.Body.Bytes(), &sd), ShouldBeNil)
+		So(sd.UserId, ShouldEqual, 3)
+		So(sd.Score, ShouldEqual, 42)
+		So(get("/debug/sample?user=3&item=x", "s3cret").Code, ShouldEqual, 400)
+		So(get("/debug/similarusers?user=3&k=-1", "s3cret").Code, ShouldEqual, 400)
+
+		// the debug flag of the recommend api
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/api/v1/recommend", nil)
+		So(debugAuthorized(c, "s3cret"), ShouldBeFalse)
+		c.Request.Header.Set(DebugTokenHeader, "s3cret")
+		So(debugAuthorized(c, "s3cret"), ShouldBeTrue)
+		So(debugAuthorized(c, ""), ShouldBeFalse)
+
+		// no token configured rejects all
+		engine = gin.New()
+		DebugRoutes(engine.Group("/debug", DebugAuth("")), idPredictor{})
+		So(get("/debug/sample?user=3&item=42", "").Code, ShouldEqual, 401)
+	})
+}
@@ -0,0 +1,114 @@
+package recommend
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+var (
+	// DedupSamples drops the samples of the same user, item, label and
+	// DedupBucket of the timestamp as an earlier one, counted in
+	// DropStats.Duplicate. The keys seen are kept in memory for a pass.
+	DedupSamples bool
+	// DedupBucket is the width of the timestamp buckets of DedupSamples in
+	// the unit of Sample.Timestamp, 0 compares the exact timestamps
+	DedupBucket int64
+	// ShuffleBuffer shuffles the samples of the SampleGenerator in a buffer
+	// of the size before the assembler, so the samples ordered by user
+	// spread over the mini-batches, 0 disables it. The shuffle is seeded by
+	// WithTrainSeed.
+	ShuffleBuffer int
+)
+
+type dedupKey struct {
+	userId, itemId int
+	label          float32
+	bucket         int64
+}
+
+// dedupShuffle forwards the samples of sampleCh deduplicated by
+// DedupSamples and shuffled by ShuffleBuffer, sampleCh itself if neither
+func dedupShuffle(ctx context.Context, sampleCh <-chan Sample, drops *dropCounter) <-chan Sample {
+	if !DedupSamples && ShuffleBuffer <= 0 {
+		return sampleCh
+	}
+	var (
+		dedup      = DedupSamples
+		bucketSize = DedupBucket
+		bufSize    = ShuffleBuffer
+		out        = make(chan Sample, 1000)
+	)
+	go func() {
+		defer close(out)
+		var (
+			seen = make(map[dedupKey]struct{})
+			buf  = make([]Sample, 0, bufSize)
+			rnd  = newTrainRand(ctx)
+		)
+		send := func(s Sample) bool {
+			select {
+			case out <- s:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			var (
+				s  Sample
+				ok bool
+			)
+			select {
+			case <-ctx.Done():
+				return
+			case s, ok = <-sampleCh:
+			}
+			if !ok {
+				break
+			}
+			if dedup {
+				key := dedupKey{userId: s.UserId, itemId: s.ItemId, label: s.Label, bucket: s.Timestamp}
+				if bucketSize > 0 {
+					key.bucket = floorDiv(s.Timestamp, bucketSize)
+				}
+				if _, dup := seen[key]; dup {
+					atomic.AddInt64(&drops.duplicate, 1)
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+			if bufSize <= 0 {
+				if !send(s) {
+					return
+				}
+				continue
+			}
+			if len(buf) < bufSize {
+				buf = append(buf, s)
+				continue
+			}
+			// send a random one of the full buffer and keep s instead
+			i := rnd.Intn(bufSize)
+			if !send(buf[i]) {
+				return
+			}
+			buf[i] = s
+		}
+		rnd.Shuffle(len(buf), func(i, j int) { buf[i], buf[j] = buf[j], buf[i] })
+		for _, s := range buf {
+			if !send(s) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// floorDiv is a / b rounded down for the negative a too
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,76 @@
+package recommend
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDedupShuffle(t *testing.T) {
+	Convey("dedup and shuffle samples", t, func() {
+		defer func() {
+			DedupSamples, DedupBucket, ShuffleBuffer = false, 0, 0
+		}()
+		collect := func(samples []Sample, drops *dropCounter) (out []Sample) {
+			ch := make(chan Sample)
+			go func() {
+				defer close(ch)
+				for _, s := range samples {
+					ch <- s
+				}
+			}()
+			for s := range dedupShuffle(context.Background(), ch, drops) {
+				out = append(out, s)
+			}
+			return
+		}
+
+		Convey("dedup by the timestamp bucket", func() {
+			DedupSamples, DedupBucket = true, 10
+			var drops dropCounter
+			out := collect([]Sample{
+				{UserId: 1, ItemId: 1, Timestamp: 3},
+				{UserId: 1, ItemId: 1, Timestamp: 7},
+				{UserId: 1, ItemId: 1, Timestamp: 13},
+				{UserId: 1, ItemId: 1, Label: 1, Timestamp: 7},
+				{UserId: 1, ItemId: 1, Timestamp: -3},
+			}, &drops)
+			So(out, ShouldHaveLength, 4)
+			So(drops.stats().Duplicate, ShouldEqual, 1)
+		})
+
+		Convey("shuffle in the buffer", func() {
+			ShuffleBuffer = 100
+			var samples []Sample
+			for i := 0; i < 1000; i++ {
+				samples = append(samples, Sample{UserId: i / 10, ItemId: i})
+			}
+			out := collect(samples, &dropCounter{})
+			So(out, ShouldHaveLength, 1000)
+			var moved int
+			items := make([]int, len(out))
+			for i, s := range out {
+				items[i] = s.ItemId
+				if s.ItemId != i {
+					moved++
+				}
+			}
+			So(moved, ShouldBeGreaterThan, 900)
+			sort.Ints(items)
+			for i, item := range items {
+				So(item, ShouldEqual, i)
+			}
+		})
+
+		Convey("dedup in GetSample", func() {
+			resetFeatureCache()
+			DedupSamples = true
+			sample, err := GetSample(idRecSys{}, context.Background())
+			So(err, ShouldBeNil)
+			So(sample.Rows, ShouldEqual, 700)
+			So(sample.Dropped.Duplicate, ShouldEqual, 300)
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package recommend
+
+import (
+	"context"
+)
+
+// FakeNegativeCalibration recovers the probability p of the models trained
+// on the fake negatives of LabelJoiner.FakeNegatives, which learn the biased
+// b = p/(1+p) of the duplicated positives, by p = b/(1-b). It calibrates
+// the Score if task < 0, or else the Tasks[task] of a multi-task model of
+// the delayed task only, e.g. the conversion. Register it to the
+// PostProcessors or return it from the PostRanker of the Predictor.
+func FakeNegativeCalibration(task int) PostRanker {
+	return PostRankFunc(func(_ context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+		for i := range itemScores {
+			if task < 0 {
+				itemScores[i].Score = CalibrateFakeNegative(itemScores[i].Score)
+			} else if task < len(itemScores[i].Tasks) {
+				itemScores[i].Tasks[task] = CalibrateFakeNegative(itemScores[i].Tasks[task])
+			}
+		}
+		return itemScores, nil
+	})
+}
+
+// CalibrateFakeNegative returns b/(1-b) of the fake negative biased b, in
+// [0, 1]
+func CalibrateFakeNegative(b float32) float32 {
+	if b <= 0 {
+		return 0
+	}
+	if b >= 0.5 {
+		return 1
+	}
+	return b / (1 - b)
+}
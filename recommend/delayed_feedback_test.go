@@ -0,0 +1,34 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFakeNegativeCalibration(t *testing.T) {
+	Convey("calibrate the fake negative biased scores", t, func() {
+		So(CalibrateFakeNegative(0), ShouldEqual, 0)
+		So(CalibrateFakeNegative(0.2), ShouldAlmostEqual, 0.25, 1e-6)
+		So(CalibrateFakeNegative(0.5), ShouldEqual, 1)
+		// b = p/(1+p) round trip
+		p := float32(0.3)
+		So(CalibrateFakeNegative(p/(1+p)), ShouldAlmostEqual, p, 1e-6)
+
+		ctx := context.Background()
+		itemScores, err := FakeNegativeCalibration(-1).PostRank(ctx, 1, []ItemScore{{ItemId: 1, Score: 0.2}})
+		So(err, ShouldBeNil)
+		So(itemScores[0].Score, ShouldAlmostEqual, 0.25, 1e-6)
+
+		itemScores, err = FakeNegativeCalibration(1).PostRank(ctx, 1, []ItemScore{
+			{ItemId: 1, Score: 0.2, Tasks: []float32{0.2, 0.2}},
+			{ItemId: 2, Score: 0.2},
+		})
+		So(err, ShouldBeNil)
+		So(itemScores[0].Score, ShouldEqual, 0.2)
+		So(itemScores[0].Tasks[0], ShouldEqual, 0.2)
+		So(itemScores[0].Tasks[1], ShouldAlmostEqual, 0.25, 1e-6)
+		So(itemScores[1].Score, ShouldEqual, 0.2)
+	})
+}
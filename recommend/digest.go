@@ -0,0 +1,166 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ItemCategorizer is implemented by the recSys which can tell the category
+// of items, DigestPolicy.MaxPerCategory only works with it.
+type ItemCategorizer interface {
+	GetItemCategory(ctx context.Context, itemId int) (string, error)
+}
+
+// DigestPolicy is the channel specific rules applied on top of Rank
+type DigestPolicy struct {
+	// Channel is the name of the channel, e.g. "email"
+	Channel string
+	// TopK is the max items in a digest
+	TopK int
+	// DedupWindow drops the items recommended to the user within the window
+	// according to RecommendHistory, 0 means dedup against all the history.
+	DedupWindow time.Duration
+	// MaxPerCategory limits the items of the same category, 0 means no limit
+	MaxPerCategory int
+	// MinScore drops the items scored lower
+	MinScore float32
+}
+
+// Digest is the top-K recommendations generated for a user of a channel
+type Digest struct {
+	UserId    int         `json:"userId"`
+	Channel   string      `json:"channel"`
+	Items     []ItemScore `json:"items"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+// DigestSink receives the generated digests, e.g. an email sender or a file
+type DigestSink interface {
+	WriteDigest(ctx context.Context, digest *Digest) error
+}
+
+// GenerateDigest ranks itemIds for every user in userIds, applies the policy
+// and writes non-empty digests to sink. The digested items are recorded to
+// RecommendHistory so that the next digest will not repeat them.
+// The failure of a single user is logged and skipped, err is only returned
+// if the sink fails.
+func GenerateDigest(ctx context.Context, recSys Predictor, userIds []int, itemIds []int,
+	policy DigestPolicy, sink DigestSink) (written int, err error) {
+	if policy.TopK <= 0 {
+		err = fmt.Errorf("invalid digest top k: %d", policy.TopK)
+		return
+	}
+	for _, userId := range userIds {
+		var digest *Digest
+		if digest, err = genUserDigest(ctx, recSys, userId, itemIds, policy); err != nil {
+			log.Errorf("gen digest of user %d error: %v", userId, err)
+			err = nil
+			continue
+		}
+		if len(digest.Items) == 0 {
+			continue
+		}
+		if err = sink.WriteDigest(ctx, digest); err != nil {
+			log.Errorf("write digest of user %d error: %v", userId, err)
+			return
+		}
+		written++
+		if RecommendHistory != nil {
+			if er := RecommendHistory.Record(ctx, userId, digest.Items, digest.Timestamp); er != nil {
+				log.Errorf("record digest history of user %d error: %v", userId, er)
+			}
+		}
+	}
+	return
+}
+
+func genUserDigest(ctx context.Context, recSys Predictor, userId int, itemIds []int,
+	policy DigestPolicy) (digest *Digest, err error) {
+	now := time.Now()
+	digest = &Digest{
+		UserId:    userId,
+		Channel:   policy.Channel,
+		Timestamp: now.Unix(),
+	}
+
+	seen := make(map[int]bool)
+	if RecommendHistory != nil {
+		var since int64
+		if policy.DedupWindow > 0 {
+			since = now.Add(-policy.DedupWindow).Unix()
+		}
+		var records []RecRecord
+		if records, err = RecommendHistory.History(ctx, userId, since); err != nil {
+			return
+		}
+		for _, r := range records {
+			seen[r.ItemId] = true
+		}
+	}
+	candidates := make([]int, 0, len(itemIds))
+	for _, itemId := range itemIds {
+		if !seen[itemId] {
+			candidates = append(candidates, itemId)
+			// also dedup itemIds itself
+			seen[itemId] = true
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	scores, err := Rank(ctx, recSys, userId, candidates)
+	if err != nil {
+		return
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+
+	categorizer, _ := recSys.(ItemCategorizer)
+	categoryCnt := make(map[string]int)
+	for _, s := range scores {
+		if len(digest.Items) >= policy.TopK {
+			break
+		}
+		if s.Score < policy.MinScore {
+			break
+		}
+		if policy.MaxPerCategory > 0 && categorizer != nil {
+			var category string
+			if category, err = categorizer.GetItemCategory(ctx, s.ItemId); err != nil {
+				return
+			}
+			if categoryCnt[category] >= policy.MaxPerCategory {
+				continue
+			}
+			categoryCnt[category]++
+		}
+		digest.Items = append(digest.Items, s)
+	}
+	return
+}
+
+// JsonDigestSink writes digests to W as json lines
+type JsonDigestSink struct {
+	sync.Mutex
+	W io.Writer
+}
+
+func (s *JsonDigestSink) WriteDigest(_ context.Context, digest *Digest) (err error) {
+	data, err := json.Marshal(digest)
+	if err != nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.W.Write(append(data, '\n'))
+	return
+}
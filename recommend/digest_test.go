@@ -0,0 +1,86 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/karlseguin/ccache/v2"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// idPredictor scores the items by item id, item feature is [itemId]
+type idPredictor struct{}
+
+func (idPredictor) GetUserFeature(_ context.Context, userId int) (Tensor, error) {
+	return Tensor{float32(userId)}, nil
+}
+
+func (idPredictor) GetItemFeature(_ context.Context, itemId int) (Tensor, error) {
+	return Tensor{float32(itemId)}, nil
+}
+
+func (idPredictor) GetItemCategory(_ context.Context, itemId int) (string, error) {
+	return fmt.Sprint(itemId % 2), nil
+}
+
+func (idPredictor) Predict(X tensor.Tensor) tensor.Tensor {
+	rows, cols := X.Shape()[0], X.Shape()[1]
+	x := X.Data().([]float32)
+	y := make([]float32, rows)
+	for i := range y {
+		y[i] = x[i*cols+cols-1]
+	}
+	return tensor.New(tensor.WithShape(rows, 1), tensor.WithBacking(y))
+}
+
+func scoredIds(items []ItemScore) (ids []int) {
+	for _, item := range items {
+		ids = append(ids, item.ItemId)
+	}
+	return
+}
+
+func resetFeatureCache() {
+	UserFeatureCache = ccache.New(ccache.Configure())
+	ItemFeatureCache = ccache.New(ccache.Configure())
+	UserBehaviorCache = ccache.New(ccache.Configure())
+}
+
+func TestGenerateDigest(t *testing.T) {
+	Convey("generate digest", t, func() {
+		ctx := context.Background()
+		resetFeatureCache()
+		history := NewMemRecHistory(0)
+		RecommendHistory = history
+		defer func() { RecommendHistory = nil }()
+		So(history.Record(ctx, 1, []ItemScore{{ItemId: 6}}, 1), ShouldBeNil)
+
+		var buf bytes.Buffer
+		policy := DigestPolicy{Channel: "email", TopK: 3, MaxPerCategory: 2}
+		n, err := GenerateDigest(ctx, idPredictor{}, []int{1, 2}, []int{1, 2, 3, 4, 5, 6}, policy, &JsonDigestSink{W: &buf})
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+
+		dec := json.NewDecoder(&buf)
+		var d Digest
+		So(dec.Decode(&d), ShouldBeNil)
+		So(d.UserId, ShouldEqual, 1)
+		So(d.Channel, ShouldEqual, "email")
+		// 6 is in history, at most 2 even items
+		So(scoredIds(d.Items), ShouldResemble, []int{5, 4, 3})
+		So(dec.Decode(&d), ShouldBeNil)
+		So(d.UserId, ShouldEqual, 2)
+		So(scoredIds(d.Items), ShouldResemble, []int{6, 5, 4})
+
+		// digested items are deduped next time
+		buf.Reset()
+		_, err = GenerateDigest(ctx, idPredictor{}, []int{1}, []int{1, 2, 3, 4, 5, 6}, policy, &JsonDigestSink{W: &buf})
+		So(err, ShouldBeNil)
+		So(dec.Decode(&d), ShouldBeNil)
+		So(scoredIds(d.Items), ShouldResemble, []int{2, 1})
+	})
+}
@@ -0,0 +1,128 @@
+package recommend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorgonia.org/tensor"
+)
+
+var (
+	// DistillTeacher scores the training samples for the student Fitter to
+	// train on the soft targets blended with the observed labels, nil
+	// disables the distillation. It may be a large model trained by Train
+	// or an external one, e.g. a RemoteTeacher serving an ONNX model. The
+	// soft targets replace Y only, not the multi-task Labels.
+	DistillTeacher PredictAbstract
+	// DistillAlpha is the weight of the soft targets, 1 trains on the
+	// teacher scores only
+	DistillAlpha float32 = 0.5
+	// DistillTemperature softens the teacher probabilities by scaling their
+	// logits by 1/T, 1 keeps them
+	DistillTemperature float32 = 1
+	// DistillBatchSize is the rows scored by the teacher at once
+	DistillBatchSize = 1024
+)
+
+// RemoteTeacher is a teacher model served over HTTP. It posts the feature
+// rows as {"rows": n, "cols": m, "x": [...]} and expects the first column
+// scores back as {"scores": [...]}.
+type RemoteTeacher struct {
+	URL    string
+	Client *http.Client
+}
+
+type teacherRequest struct {
+	Rows int       `json:"rows"`
+	Cols int       `json:"cols"`
+	X    []float32 `json:"x"`
+}
+
+type teacherResponse struct {
+	Scores []float32 `json:"scores"`
+}
+
+func NewRemoteTeacher(url string) *RemoteTeacher {
+	return &RemoteTeacher{
+		URL:    url,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Predict returns nil if the teacher fails
+func (t *RemoteTeacher) Predict(X tensor.Tensor) tensor.Tensor {
+	shape := X.Shape()
+	body, err := json.Marshal(teacherRequest{Rows: shape[0], Cols: shape[1], X: X.Data().([]float32)})
+	if err != nil {
+		log.Errorf("marshal teacher request error: %v", err)
+		return nil
+	}
+	resp, err := t.Client.Post(t.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Errorf("post teacher %s error: %v", t.URL, err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("teacher %s status %d", t.URL, resp.StatusCode)
+		return nil
+	}
+	var res teacherResponse
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		log.Errorf("decode teacher response error: %v", err)
+		return nil
+	}
+	if len(res.Scores) != shape[0] {
+		log.Errorf("teacher returned %d scores of %d rows", len(res.Scores), shape[0])
+		return nil
+	}
+	return tensor.New(tensor.WithShape(shape[0], 1), tensor.WithBacking(res.Scores))
+}
+
+// distillSample sets the Y of the dense sample to the teacher scores
+// blended with the observed labels by DistillAlpha
+func distillSample(teacher PredictAbstract, sample *TrainSample) (err error) {
+	if DistillAlpha < 0 || DistillAlpha > 1 {
+		return fmt.Errorf("distill alpha %v out of [0, 1]", DistillAlpha)
+	}
+	batch := DistillBatchSize
+	if batch <= 0 {
+		batch = sample.Rows
+	}
+	var soft []float32
+	for start := 0; start < sample.Rows; start += batch {
+		end := start + batch
+		if end > sample.Rows {
+			end = sample.Rows
+		}
+		var scores []float32
+		scores, err = predictColumn(teacher, sample.X[start*sample.XCols:end*sample.XCols], end-start, sample.XCols)
+		if err != nil {
+			return fmt.Errorf("teacher predict rows %d-%d error: %v", start, end, err)
+		}
+		soft = append(soft, scores...)
+	}
+	for i, s := range soft {
+		if LabelObjective == ObjectiveBinary {
+			s = soften(s, DistillTemperature)
+		}
+		sample.Y[i] = DistillAlpha*s + (1-DistillAlpha)*sample.Y[i]
+	}
+	log.Infof("distilled %d samples with alpha %v", sample.Rows, DistillAlpha)
+	return
+}
+
+// soften scales the logit of the probability p by 1/temperature
+func soften(p, temperature float32) float32 {
+	if temperature == 1 || temperature <= 0 {
+		return p
+	}
+	q := clampProb(p)
+	logit := math.Log(q/(1-q)) / float64(temperature)
+	return float32(1 / (1 + math.Exp(-logit)))
+}
@@ -0,0 +1,82 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+type constTeacher float32
+
+func (c constTeacher) Predict(X tensor.Tensor) tensor.Tensor {
+	y := make([]float32, X.Shape()[0])
+	for i := range y {
+		y[i] = float32(c)
+	}
+	return tensor.New(tensor.WithShape(len(y), 1), tensor.WithBacking(y))
+}
+
+type labelFitter struct {
+	y []float32
+}
+
+func (f *labelFitter) Fit(sample *TrainSample) (PredictAbstract, error) {
+	f.y = append([]float32(nil), sample.Y...)
+	return idPredictor{}, nil
+}
+
+func TestDistill(t *testing.T) {
+	Convey("train on the soft targets", t, func() {
+		resetFeatureCache()
+		DistillTeacher = constTeacher(0.8)
+		defer func() { DistillTeacher = nil }()
+
+		fitter := &labelFitter{}
+		_, err := TrainWithResult(context.Background(), idRecSys{}, fitter)
+		So(err, ShouldBeNil)
+		So(fitter.y, ShouldNotBeEmpty)
+		for _, y := range fitter.y {
+			So(y == 0.4 || y == 0.9, ShouldBeTrue)
+		}
+	})
+
+	Convey("distill sample", t, func() {
+		sample := &TrainSample{X: []float32{1, 2, 3}, Y: []float32{0, 1, 1}, Rows: 3, XCols: 1}
+
+		Convey("batches and temperature", func() {
+			defer func(b int, a, tt float32) { DistillBatchSize, DistillAlpha, DistillTemperature = b, a, tt }(
+				DistillBatchSize, DistillAlpha, DistillTemperature)
+			DistillBatchSize, DistillAlpha, DistillTemperature = 2, 1, 2
+			So(distillSample(constTeacher(0.9), sample), ShouldBeNil)
+			for _, y := range sample.Y {
+				So(y, ShouldAlmostEqual, 0.75, 1e-4)
+			}
+		})
+
+		Convey("teacher failure", func() {
+			So(distillSample(NewRemoteTeacher("http://127.0.0.1:1/score"), sample), ShouldNotBeNil)
+			So(sample.Y, ShouldResemble, []float32{0, 1, 1})
+		})
+
+		Convey("remote teacher", func() {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req teacherRequest
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				res := teacherResponse{}
+				for i := 0; i < req.Rows; i++ {
+					res.Scores = append(res.Scores, req.X[i*req.Cols]/10)
+				}
+				_ = json.NewEncoder(w).Encode(res)
+			}))
+			defer srv.Close()
+			So(distillSample(NewRemoteTeacher(srv.URL), sample), ShouldBeNil)
+			So(sample.Y[0], ShouldAlmostEqual, 0.05, 1e-6)
+			So(sample.Y[2], ShouldAlmostEqual, 0.65, 1e-6)
+		})
+	})
+}
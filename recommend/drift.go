@@ -0,0 +1,246 @@
+package recommend
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ServingDrift compares the feature vectors served by BatchPredict to
+	// the training distribution, nil disables it, e.g.
+	//
+	//	ServingDrift = NewDriftMonitor(result.DriftBaseline)
+	ServingDrift *DriftMonitor
+	// DriftBins is the max quantile bins of every feature of a DriftBaseline
+	DriftBins = 10
+	// DriftBaselineRows is the training rows sampled for the DriftBaseline
+	// of Train, 0 disables it
+	DriftBaselineRows = 10000
+	// DriftWindow is the served rows of a window compared to the baseline
+	DriftWindow = 10000
+	// DriftThreshold is the PSI of a feature range or the labels alerting
+	// EventDriftAlert, 0.2 is the rule of thumb of a significant shift
+	DriftThreshold = 0.2
+)
+
+// DriftBaseline is the training distribution: the quantile cuts of every
+// feature and the labels, and the ratios of the rows in their bins, the
+// values <= Cuts[f][b] are in the bins <= b
+type DriftBaseline struct {
+	Info        SampleInfo  `json:"info"`
+	Cuts        [][]float32 `json:"cuts"`
+	Ratios      [][]float64 `json:"ratios"`
+	LabelCuts   []float32   `json:"labelCuts"`
+	LabelRatios []float64   `json:"labelRatios"`
+}
+
+// NewDriftBaseline returns the DriftBaseline of up to maxRows rows of
+// sample evenly spaced, all if maxRows <= 0
+func NewDriftBaseline(sample *TrainSample, maxRows int) *DriftBaseline {
+	stride := 1
+	if maxRows > 0 && sample.Rows > maxRows {
+		stride = (sample.Rows + maxRows - 1) / maxRows
+	}
+	var (
+		rows   = (sample.Rows + stride - 1) / stride
+		values = make([]float32, rows)
+		b      = &DriftBaseline{
+			Info:   sample.Info,
+			Cuts:   make([][]float32, sample.XCols),
+			Ratios: make([][]float64, sample.XCols),
+		}
+	)
+	for f := 0; f < sample.XCols; f++ {
+		for i := range values {
+			values[i] = sample.X[i*stride*sample.XCols+f]
+		}
+		b.Cuts[f], b.Ratios[f] = quantileBins(values)
+	}
+	for i := range values {
+		values[i] = sample.Y[i*stride]
+	}
+	b.LabelCuts, b.LabelRatios = quantileBins(values)
+	return b
+}
+
+// quantileBins returns the DriftBins quantile cuts of values and the ratios
+// of values in the bins, values are sorted
+func quantileBins(values []float32) (cuts []float32, ratios []float64) {
+	if len(values) == 0 {
+		return
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for b := 1; b < DriftBins; b++ {
+		c := values[(len(values)-1)*b/DriftBins]
+		if len(cuts) == 0 || c > cuts[len(cuts)-1] {
+			cuts = append(cuts, c)
+		}
+	}
+	// the max value is left for the last bin
+	if n := len(cuts); n > 0 && cuts[n-1] == values[len(values)-1] {
+		cuts = cuts[:n-1]
+	}
+	ratios = make([]float64, len(cuts)+1)
+	for _, v := range values {
+		ratios[binOf(cuts, v)]++
+	}
+	for i := range ratios {
+		ratios[i] /= float64(len(values))
+	}
+	return
+}
+
+func binOf(cuts []float32, v float32) int {
+	return sort.Search(len(cuts), func(b int) bool { return cuts[b] >= v })
+}
+
+// DriftReport compares a window of the served rows to the DriftBaseline,
+// Alerts are the names of the ranges, or "label", of PSI > DriftThreshold
+type DriftReport struct {
+	Rows   int          `json:"rows"`
+	Ranges []RangeDrift `json:"ranges"`
+	Labels int          `json:"labels"`
+	// Label is nil if no label is observed
+	Label  *Divergence `json:"label,omitempty"`
+	Alerts []string    `json:"alerts,omitempty"`
+}
+
+// RangeDrift is the Divergence of the most drifted Feature of a range
+type RangeDrift struct {
+	Name    string `json:"name"`
+	Range   [2]int `json:"range"`
+	Feature int    `json:"feature"`
+	Divergence
+}
+
+// Divergence of the live distribution from the training one, KL is the
+// KL divergence of the live one from the training one
+type Divergence struct {
+	PSI float64 `json:"psi"`
+	KL  float64 `json:"kl"`
+}
+
+// DriftMonitor keeps the histograms of the served feature vectors and the
+// observed labels in the bins of a DriftBaseline. Every DriftWindow rows
+// the window is compared to the baseline, the ranges drifted over
+// DriftThreshold are alerted by EventDriftAlert, and a new window starts.
+type DriftMonitor struct {
+	base *DriftBaseline
+
+	mu          sync.Mutex
+	counts      [][]float64
+	rows        int
+	labelCounts []float64
+	labels      int
+	last        *DriftReport
+}
+
+func NewDriftMonitor(base *DriftBaseline) *DriftMonitor {
+	m := &DriftMonitor{base: base}
+	m.reset()
+	return m
+}
+
+func (m *DriftMonitor) reset() {
+	m.counts = make([][]float64, len(m.base.Cuts))
+	for f, cuts := range m.base.Cuts {
+		m.counts[f] = make([]float64, len(cuts)+1)
+	}
+	m.labelCounts = make([]float64, len(m.base.LabelCuts)+1)
+	m.rows, m.labels = 0, 0
+}
+
+// Observe adds the rows of x of cols features to the window, ignored if
+// cols mismatches the baseline, e.g. of another model
+func (m *DriftMonitor) Observe(x []float32, rows, cols int) {
+	if cols != len(m.base.Cuts) {
+		return
+	}
+	m.mu.Lock()
+	for r := 0; r < rows; r++ {
+		for f, v := range x[r*cols : (r+1)*cols] {
+			m.counts[f][binOf(m.base.Cuts[f], v)]++
+		}
+	}
+	m.rows += rows
+	var report *DriftReport
+	if m.rows >= DriftWindow {
+		report = m.report()
+		m.last = report
+		m.reset()
+	}
+	m.mu.Unlock()
+	if report != nil && len(report.Alerts) != 0 {
+		log.Warnf("feature drift of %v over %d rows", report.Alerts, report.Rows)
+		Notify(EventDriftAlert, map[string]interface{}{"report": report})
+	}
+}
+
+// ObserveLabels adds the labels of the served rows fed back to the window
+func (m *DriftMonitor) ObserveLabels(y []float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range y {
+		m.labelCounts[binOf(m.base.LabelCuts, v)]++
+	}
+	m.labels += len(y)
+}
+
+// Report returns the DriftReport of the current window
+func (m *DriftMonitor) Report() *DriftReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.report()
+}
+
+// LastReport returns the DriftReport of the last full window, nil if none
+func (m *DriftMonitor) LastReport() *DriftReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+func (m *DriftMonitor) report() (report *DriftReport) {
+	report = &DriftReport{Rows: m.rows, Labels: m.labels}
+	if m.rows > 0 {
+		for _, fr := range featureRanges(m.base.Info) {
+			rd := RangeDrift{Name: fr.Name, Range: fr.Range, Feature: -1}
+			for f := fr.Range[0]; f < fr.Range[1] && f < len(m.counts); f++ {
+				if d := divergence(m.counts[f], m.rows, m.base.Ratios[f]); rd.Feature < 0 || d.PSI > rd.PSI {
+					rd.Feature, rd.Divergence = f, d
+				}
+			}
+			if rd.Feature < 0 {
+				continue
+			}
+			report.Ranges = append(report.Ranges, rd)
+			if rd.PSI > DriftThreshold {
+				report.Alerts = append(report.Alerts, rd.Name)
+			}
+		}
+	}
+	if m.labels > 0 {
+		d := divergence(m.labelCounts, m.labels, m.base.LabelRatios)
+		report.Label = &d
+		if d.PSI > DriftThreshold {
+			report.Alerts = append(report.Alerts, "label")
+		}
+	}
+	return
+}
+
+// divergence returns the Divergence of counts of total from the expected
+// ratios, the empty bins are smoothed
+func divergence(counts []float64, total int, expected []float64) (d Divergence) {
+	const eps = 1e-4
+	for b, c := range counts {
+		a := math.Max(c/float64(total), eps)
+		e := math.Max(expected[b], eps)
+		d.PSI += (a - e) * math.Log(a/e)
+		d.KL += a * math.Log(a/e)
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// uniformRows returns rows of the user feature and the item feature in
+// [0, 1), the item feature shifted by shift
+func uniformRows(rnd *rand.Rand, rows int, shift float32) (x []float32) {
+	for r := 0; r < rows; r++ {
+		x = append(x, rnd.Float32(), rnd.Float32()+shift)
+	}
+	return
+}
+
+func TestFeatureDrift(t *testing.T) {
+	Convey("feature and label drift", t, func() {
+		defer func(window int) { DriftWindow = window }(DriftWindow)
+		DriftWindow = 1000
+		rnd := rand.New(rand.NewSource(1))
+		sample := &TrainSample{
+			X:     uniformRows(rnd, 2000, 0),
+			Rows:  2000,
+			XCols: 2,
+			Info: SampleInfo{
+				UserProfileRange:  [2]int{0, 1},
+				UserBehaviorRange: [2]int{1, 1},
+				ItemFeatureRange:  [2]int{1, 1},
+				CtxFeatureRange:   [2]int{1, 2},
+			},
+		}
+		for r := 0; r < sample.Rows; r++ {
+			sample.Y = append(sample.Y, float32(r*2/sample.Rows))
+		}
+		base := NewDriftBaseline(sample, 1000)
+		So(base.Cuts, ShouldHaveLength, 2)
+		So(base.Ratios[0], ShouldHaveLength, DriftBins)
+		So(base.LabelRatios, ShouldResemble, []float64{0.5, 0.5})
+
+		Convey("no drift", func() {
+			m := NewDriftMonitor(base)
+			m.Observe(uniformRows(rnd, 500, 0), 500, 2)
+			m.ObserveLabels([]float32{0, 1, 0, 1})
+			report := m.Report()
+			So(report.Rows, ShouldEqual, 500)
+			So(report.Ranges, ShouldHaveLength, 2)
+			for _, rd := range report.Ranges {
+				So(rd.PSI, ShouldBeLessThan, 0.1)
+			}
+			So(report.Label.PSI, ShouldBeLessThan, 1e-9)
+			So(report.Alerts, ShouldBeEmpty)
+			So(m.LastReport(), ShouldBeNil)
+			m.Observe(uniformRows(rnd, 10, 0), 10, 3)
+			So(m.Report().Rows, ShouldEqual, 500)
+		})
+
+		Convey("alert the drifted range", func() {
+			alerts := make(chan WebhookEvent, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				var event WebhookEvent
+				_ = json.Unmarshal(body, &event)
+				alerts <- event
+			}))
+			defer srv.Close()
+			Webhooks = []Webhook{{URL: srv.URL, Events: []string{EventDriftAlert}}}
+			defer func() { Webhooks = nil }()
+
+			m := NewDriftMonitor(base)
+			m.ObserveLabels([]float32{1, 1, 1, 1})
+			m.Observe(uniformRows(rnd, 1000, 0.5), 1000, 2)
+			report := m.LastReport()
+			So(report, ShouldNotBeNil)
+			So(report.Rows, ShouldEqual, 1000)
+			So(report.Alerts, ShouldResemble, []string{"ItemFeature", "label"})
+			So(report.Ranges[1].Feature, ShouldEqual, 1)
+			So(report.Ranges[1].KL, ShouldBeGreaterThan, 0.2)
+			So(m.Report().Rows, ShouldEqual, 0)
+			select {
+			case event := <-alerts:
+				So(event.Type, ShouldEqual, EventDriftAlert)
+			case <-time.After(5 * time.Second):
+				So("no alert", ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("baseline of Train", t, func() {
+		resetFeatureCache()
+		result, err := TrainWithResult(context.Background(), idRecSys{}, &idFitter{})
+		So(err, ShouldBeNil)
+		So(result.DriftBaseline, ShouldNotBeNil)
+		So(result.DriftBaseline.Cuts, ShouldHaveLength, result.DriftBaseline.Info.CtxFeatureRange[1])
+	})
+}
@@ -0,0 +1,51 @@
+package recommend
+
+import (
+	"errors"
+
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// EdgeUserCacheSize and EdgeItemCacheSize cap the feature caches in
+	// the edge profile
+	EdgeUserCacheSize = 10000
+	EdgeItemCacheSize = 50000
+	// EdgeBehaviorCacheSize caps the item sequences in UserBehaviorCache in
+	// the edge profile, about one per user of EdgeUserCacheSize
+	EdgeBehaviorCacheSize = 10000
+
+	ErrEdgeProfile = errors.New("not supported in edge profile")
+
+	edgeProfile bool
+)
+
+// ApplyEdgeProfile switches to the edge runtime profile for devices with tiny
+// memory, it is applied automatically if built with `-tags edge`:
+//   - feature caches are capped to EdgeUserCacheSize and EdgeItemCacheSize,
+//     UserBehaviorCache to EdgeBehaviorCacheSize
+//   - Train and ResumeTrain return ErrEdgeProfile, models are trained
+//     elsewhere and pulled read-only, e.g. model.MmapArtifact of an int8
+//     quantized artifact
+//   - StartHttpApi only serves the rank path, /openapi.json and
+//     GET /service/models
+func ApplyEdgeProfile() {
+	edgeProfile = true
+	UserFeatureCache = ccache.New(
+		ccache.Configure().MaxSize(int64(EdgeUserCacheSize)).ItemsToPrune(uint32(EdgeUserCacheSize/100 + 1)),
+	)
+	ItemFeatureCache = ccache.New(
+		ccache.Configure().MaxSize(int64(EdgeItemCacheSize)).ItemsToPrune(uint32(EdgeItemCacheSize/100 + 1)),
+	)
+	UserBehaviorCache = ccache.New(
+		ccache.Configure().MaxSize(int64(EdgeBehaviorCacheSize)).ItemsToPrune(uint32(EdgeBehaviorCacheSize/100 + 1)),
+	)
+	log.Infof("edge profile applied, user cache: %d, item cache: %d, behavior cache: %d",
+		EdgeUserCacheSize, EdgeItemCacheSize, EdgeBehaviorCacheSize)
+}
+
+// IsEdgeProfile returns true if the edge profile is applied
+func IsEdgeProfile() bool {
+	return edgeProfile
+}
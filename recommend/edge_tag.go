@@ -0,0 +1,7 @@
+//go:build edge
+
+package recommend
+
+func init() {
+	ApplyEdgeProfile()
+}
@@ -0,0 +1,40 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEdgeProfile(t *testing.T) {
+	Convey("edge profile", t, func() {
+		defer func(size int) { EdgeBehaviorCacheSize = size }(EdgeBehaviorCacheSize)
+		EdgeBehaviorCacheSize = 10
+		ApplyEdgeProfile()
+		defer func() {
+			edgeProfile = false
+			resetFeatureCache()
+		}()
+		So(IsEdgeProfile(), ShouldBeTrue)
+
+		// the behavior cache is pruned to the cap
+		for userId := 0; userId < 100; userId++ {
+			UserBehaviorCache.Set(behaviorCacheKey(userId, 0), []int{userId}, time.Minute)
+		}
+		deadline := time.Now().Add(time.Second)
+		for UserBehaviorCache.ItemCount() > EdgeBehaviorCacheSize && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		So(UserBehaviorCache.ItemCount(), ShouldBeLessThanOrEqualTo, EdgeBehaviorCacheSize)
+
+		_, err := Train(context.Background(), nil, nil)
+		So(err, ShouldEqual, ErrEdgeProfile)
+
+		paths := OpenAPISpec("/rank")["paths"].(map[string]interface{})
+		So(paths, ShouldHaveLength, 2)
+		So(paths, ShouldContainKey, "/rank")
+		So(paths, ShouldContainKey, "/service/models")
+	})
+}
@@ -0,0 +1,195 @@
+package recommend
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+var (
+	// DriftNeighbors is the k of the nearest neighbors compared by
+	// CompareItemEmbeddings
+	DriftNeighbors = 10
+	// DriftNeighborItems bounds the items whose neighborhoods are compared,
+	// the neighbors are searched among them only
+	DriftNeighborItems = 2000
+	// DriftTopItems is the most displaced items in the report
+	DriftTopItems = 20
+)
+
+// EmbeddingDriftReport compares the item embeddings of two model versions.
+// The new space is aligned to the old one by the orthogonal Procrustes
+// rotation first, a large UnalignedDisplacement with a small
+// MeanDisplacement means the space is only rotated, which still breaks the
+// ANN indexes built on the old one. A low NeighborOverlap means the
+// neighborhoods of the items really changed.
+type EmbeddingDriftReport struct {
+	CommonItems int `json:"commonItems"`
+	OnlyOld     int `json:"onlyOld"`
+	OnlyNew     int `json:"onlyNew"`
+	// the displacements are the euclidean distances of the L2 normalized
+	// vectors, in [0, 2]
+	UnalignedDisplacement float64 `json:"unalignedDisplacement"`
+	MeanDisplacement      float64 `json:"meanDisplacement"`
+	MaxDisplacement       float64 `json:"maxDisplacement"`
+	// NeighborOverlap is the mean ratio of the DriftNeighbors nearest
+	// neighbors shared by both versions
+	NeighborOverlap float64 `json:"neighborOverlap"`
+	// TopItems are the DriftTopItems most displaced items
+	TopItems []ItemDrift `json:"topItems"`
+}
+
+type ItemDrift struct {
+	ItemId       string  `json:"itemId"`
+	Displacement float64 `json:"displacement"`
+	// NeighborOverlap is -1 if the neighborhood is not compared, see
+	// DriftNeighborItems
+	NeighborOverlap float64 `json:"neighborOverlap"`
+}
+
+// CompareBundleEmbeddings is CompareItemEmbeddings of the item embeddings in
+// the serving bundles of oldPath and newPath
+func CompareBundleEmbeddings(oldPath, newPath string) (report *EmbeddingDriftReport, err error) {
+	oldEmb, err := ReadBundleItemEmbedding(oldPath)
+	if err != nil {
+		return
+	}
+	newEmb, err := ReadBundleItemEmbedding(newPath)
+	if err != nil {
+		return
+	}
+	return CompareItemEmbeddings(oldEmb, newEmb)
+}
+
+// CompareItemEmbeddings compares the item embeddings of two model versions
+// over their common items, see EmbeddingDriftReport
+func CompareItemEmbeddings(oldEmb, newEmb word2vec.EmbeddingMap32) (report *EmbeddingDriftReport, err error) {
+	report = &EmbeddingDriftReport{}
+	var ids []string
+	for id := range oldEmb {
+		if _, ok := newEmb[id]; ok {
+			ids = append(ids, id)
+		} else {
+			report.OnlyOld++
+		}
+	}
+	report.OnlyNew = len(newEmb) - len(ids)
+	report.CommonItems = len(ids)
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("%d common items to compare", len(ids))
+	}
+	sort.Strings(ids)
+
+	dim := len(oldEmb[ids[0]])
+	a, b := mat.NewDense(len(ids), dim, nil), mat.NewDense(len(ids), dim, nil)
+	for i, id := range ids {
+		if len(oldEmb[id]) != dim || len(newEmb[id]) != dim {
+			return nil, fmt.Errorf("item %s dim %d, %d != %d", id, len(oldEmb[id]), len(newEmb[id]), dim)
+		}
+		setNormalizedRow(a, i, oldEmb[id])
+		setNormalizedRow(b, i, newEmb[id])
+	}
+
+	// orthogonal Procrustes: R = U * V^T of the SVD of B^T * A minimizes
+	// |B * R - A|
+	var m mat.Dense
+	m.Mul(b.T(), a)
+	var svd mat.SVD
+	if !svd.Factorize(&m, mat.SVDThin) {
+		return nil, fmt.Errorf("svd of the %d common items failed", len(ids))
+	}
+	var u, v, r, aligned mat.Dense
+	svd.UTo(&u)
+	svd.VTo(&v)
+	r.Mul(&u, v.T())
+	aligned.Mul(b, &r)
+
+	drifts := make([]ItemDrift, len(ids))
+	for i, id := range ids {
+		d := floats.Distance(aligned.RawRowView(i), a.RawRowView(i), 2)
+		drifts[i] = ItemDrift{ItemId: id, Displacement: d, NeighborOverlap: -1}
+		report.MeanDisplacement += d
+		report.UnalignedDisplacement += floats.Distance(b.RawRowView(i), a.RawRowView(i), 2)
+		if d > report.MaxDisplacement {
+			report.MaxDisplacement = d
+		}
+	}
+	report.MeanDisplacement /= float64(len(ids))
+	report.UnalignedDisplacement /= float64(len(ids))
+
+	// the neighborhoods are rotation invariant, no alignment needed
+	n := len(ids)
+	if n > DriftNeighborItems {
+		n = DriftNeighborItems
+	}
+	k := DriftNeighbors
+	if k > n-1 {
+		k = n - 1
+	}
+	if k > 0 {
+		for i := 0; i < n; i++ {
+			oldNeighbors := nearestRows(a, i, n, k)
+			overlap := 0
+			for j := range nearestRows(b, i, n, k) {
+				if oldNeighbors[j] {
+					overlap++
+				}
+			}
+			drifts[i].NeighborOverlap = float64(overlap) / float64(k)
+			report.NeighborOverlap += drifts[i].NeighborOverlap
+		}
+		report.NeighborOverlap /= float64(n)
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool { return drifts[i].Displacement > drifts[j].Displacement })
+	if len(drifts) > DriftTopItems {
+		drifts = drifts[:DriftTopItems]
+	}
+	report.TopItems = drifts
+	return
+}
+
+func setNormalizedRow(m *mat.Dense, i int, vec []float32) {
+	var norm float64
+	for _, x := range vec {
+		norm += float64(x) * float64(x)
+	}
+	norm = math.Sqrt(norm)
+	row := m.RawRowView(i)
+	for j, x := range vec {
+		if norm > 0 {
+			row[j] = float64(x) / norm
+		}
+	}
+}
+
+// nearestRows returns the k rows of m[:n] of the largest cosine to row i,
+// the rows are L2 normalized
+func nearestRows(m *mat.Dense, i, n, k int) map[int]bool {
+	type neighbor struct {
+		row int
+		cos float64
+	}
+	x := m.RawRowView(i)
+	neighbors := make([]neighbor, 0, n-1)
+	for j := 0; j < n; j++ {
+		if j != i {
+			neighbors = append(neighbors, neighbor{j, floats.Dot(x, m.RawRowView(j))})
+		}
+	}
+	sort.Slice(neighbors, func(a, b int) bool {
+		if neighbors[a].cos != neighbors[b].cos {
+			return neighbors[a].cos > neighbors[b].cos
+		}
+		return neighbors[a].row < neighbors[b].row
+	})
+	nearest := make(map[int]bool, k)
+	for _, nb := range neighbors[:k] {
+		nearest[nb.row] = true
+	}
+	return nearest
+}
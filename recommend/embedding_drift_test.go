@@ -0,0 +1,52 @@
+package recommend
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompareItemEmbeddings(t *testing.T) {
+	Convey("embedding drift", t, func() {
+		rnd := rand.New(rand.NewSource(1))
+		oldEmb, rotated := make(word2vec.EmbeddingMap32), make(word2vec.EmbeddingMap32)
+		sin, cos := float32(math.Sin(1)), float32(math.Cos(1))
+		for i := 0; i < 50; i++ {
+			v := []float32{rnd.Float32() - 0.5, rnd.Float32() - 0.5, rnd.Float32() - 0.5}
+			oldEmb[fmt.Sprint(i)] = v
+			// rotated around the z axis
+			rotated[fmt.Sprint(i)] = []float32{cos*v[0] - sin*v[1], sin*v[0] + cos*v[1], v[2]}
+		}
+		rotated["new"] = []float32{1, 0, 0}
+
+		Convey("rotation only", func() {
+			report, err := CompareItemEmbeddings(oldEmb, rotated)
+			So(err, ShouldBeNil)
+			So(report.CommonItems, ShouldEqual, 50)
+			So(report.OnlyNew, ShouldEqual, 1)
+			So(report.UnalignedDisplacement, ShouldBeGreaterThan, 0.5)
+			So(report.MeanDisplacement, ShouldBeLessThan, 1e-6)
+			So(report.NeighborOverlap, ShouldEqual, 1)
+			So(report.TopItems, ShouldHaveLength, DriftTopItems)
+		})
+
+		Convey("displaced items", func() {
+			rotated["7"] = []float32{-rotated["7"][0], -rotated["7"][1], -rotated["7"][2]}
+			report, err := CompareItemEmbeddings(oldEmb, rotated)
+			So(err, ShouldBeNil)
+			So(report.TopItems[0].ItemId, ShouldEqual, "7")
+			So(report.TopItems[0].Displacement, ShouldBeGreaterThan, 1.5)
+			So(report.TopItems[0].NeighborOverlap, ShouldBeLessThan, 0.5)
+			So(report.NeighborOverlap, ShouldBeLessThan, 1)
+		})
+
+		Convey("too few common items", func() {
+			_, err := CompareItemEmbeddings(oldEmb, word2vec.EmbeddingMap32{"1": {1, 0, 0}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
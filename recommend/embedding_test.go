@@ -0,0 +1,173 @@
+package recommend
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingItemSeq generates one item id per string like the movielens example,
+// and counts the calls of ItemSeqGenerator
+type countingItemSeq struct {
+	calls int
+}
+
+func (s *countingItemSeq) ItemSeqGenerator(context.Context) (<-chan string, error) {
+	s.calls++
+	ch := make(chan string, 500)
+	for i := 0; i < 500; i++ {
+		ch <- strconv.Itoa(i * 7 % 20)
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestItemEmbeddingFile(t *testing.T) {
+	defer func(f string, m word2vec.EmbeddingMap32) {
+		ItemEmbeddingFile = f
+		itemEmbeddingMap.store(m)
+	}(ItemEmbeddingFile, itemEmbeddingMap.load())
+
+	Convey("train once then load the embedding file", t, func() {
+		ItemEmbeddingFile = filepath.Join(t.TempDir(), "item.bin")
+		seq := &countingItemSeq{}
+		trained, err := loadOrTrainItemEmbedding(context.Background(), seq)
+		So(err, ShouldBeNil)
+		So(seq.calls, ShouldEqual, 1)
+		So(trained, ShouldContainKey, "0")
+		So(trained["0"], ShouldHaveLength, ItemEmbDim)
+
+		loaded, err := loadOrTrainItemEmbedding(context.Background(), seq)
+		So(err, ShouldBeNil)
+		So(seq.calls, ShouldEqual, 1)
+		So(loaded, ShouldResemble, trained)
+	})
+
+	Convey("SaveItemEmbedding", t, func() {
+		itemEmbeddingMap.store(nil)
+		So(SaveItemEmbedding(filepath.Join(t.TempDir(), "item.json")), ShouldNotBeNil)
+
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": {1, 2}})
+		path := filepath.Join(t.TempDir(), "item.json")
+		So(SaveItemEmbedding(path), ShouldBeNil)
+		loaded, err := word2vec.LoadEmbeddingMap32(path)
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, itemEmbeddingMap.load())
+	})
+}
+
+// newItemSeq appends new items 20-24 to the sequence of countingItemSeq
+type newItemSeq struct {
+	countingItemSeq
+}
+
+func (s *newItemSeq) ItemSeqGenerator(ctx context.Context) (<-chan string, error) {
+	old, _ := s.countingItemSeq.ItemSeqGenerator(ctx)
+	ch := make(chan string, 600)
+	for item := range old {
+		ch <- item
+	}
+	for i := 0; i < 100; i++ {
+		ch <- strconv.Itoa(20 + i%5)
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestUpdateItemEmbedding(t *testing.T) {
+	defer func(f string, m word2vec.EmbeddingMap32) {
+		ItemEmbeddingFile = f
+		itemEmbeddingMap.store(m)
+	}(ItemEmbeddingFile, itemEmbeddingMap.load())
+
+	Convey("fold new items into the item embedding", t, func() {
+		itemEmbeddingMap.store(nil)
+		_, err := UpdateItemEmbedding(context.Background(), &newItemSeq{}, true)
+		So(err, ShouldNotBeNil)
+
+		ItemEmbeddingFile = ""
+		trained, err := loadOrTrainItemEmbedding(context.Background(), &countingItemSeq{})
+		So(err, ShouldBeNil)
+		itemEmbeddingMap.store(trained)
+		_, ok := getItemEmbedding(20)
+		So(ok, ShouldBeFalse)
+
+		added, err := UpdateItemEmbedding(context.Background(), &newItemSeq{}, true)
+		So(err, ShouldBeNil)
+		So(added, ShouldEqual, 5)
+		emb, ok := getItemEmbedding(20)
+		So(ok, ShouldBeTrue)
+		So(emb, ShouldHaveLength, ItemEmbDim)
+		So(itemEmbeddingMap.load()["0"], ShouldResemble, trained["0"])
+		// the embedding in use is not modified in place
+		So(trained, ShouldHaveLength, 20)
+	})
+}
+
+// sessionRecSys has short sessions of 2 items, items i and i+1 of 0-19 are
+// in a session
+type sessionRecSys struct {
+	idRecSys
+}
+
+func (sessionRecSys) ItemSessionGenerator(context.Context) (<-chan []string, error) {
+	ch := make(chan []string, 100)
+	for i := 0; i < 100; i++ {
+		ch <- []string{strconv.Itoa(i % 20), strconv.Itoa((i + 1) % 20)}
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestNode2VecItemEmbedding(t *testing.T) {
+	defer func(f string, m word2vec.EmbeddingMap32) {
+		ItemEmbeddingFile = f
+		itemEmbeddingMap.store(m)
+	}(ItemEmbeddingFile, itemEmbeddingMap.load())
+
+	Convey("item embedding from node2vec walks", t, func() {
+		_, ok := itemEmbeddingOfRecSys(&idRecSys{})
+		So(ok, ShouldBeFalse)
+
+		itemEbd, ok := itemEmbeddingOfRecSys(&sessionRecSys{})
+		So(ok, ShouldBeTrue)
+		So(itemEbd, ShouldHaveSameTypeAs, &Node2VecItemEmbedding{})
+
+		ItemEmbeddingFile = ""
+		embMap, err := loadOrTrainItemEmbedding(context.Background(), itemEbd)
+		So(err, ShouldBeNil)
+		So(embMap, ShouldHaveLength, 20)
+		So(embMap["19"], ShouldHaveLength, ItemEmbDim)
+	})
+}
+
+func TestItemEmbeddingSwap(t *testing.T) {
+	defer itemEmbeddingMap.store(itemEmbeddingMap.load())
+
+	Convey("swap the item embedding while serving", t, func() {
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": {1}})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": {float32(i)}})
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			_, ok := getItemEmbedding(1)
+			So(ok, ShouldBeTrue)
+		}
+		wg.Wait()
+
+		So(itemEmbeddingMap.storeIfEmpty(word2vec.EmbeddingMap32{"2": {2}}), ShouldBeFalse)
+		itemEmbeddingMap.store(nil)
+		So(itemEmbeddingMap.storeIfEmpty(word2vec.EmbeddingMap32{"2": {2}}), ShouldBeTrue)
+		So(itemEmbeddingMap.load(), ShouldContainKey, "2")
+	})
+}
@@ -0,0 +1,93 @@
+package recommend
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	// ErrMissingUser should be wrapped by GetUserFeature if the user is not found
+	ErrMissingUser = errors.New("missing user")
+	// ErrMissingItem should be wrapped by GetItemFeature if the item is not found
+	ErrMissingItem = errors.New("missing item")
+	// ErrProvider is any other error of the feature provider
+	ErrProvider = errors.New("feature provider error")
+
+	// Strict fails GetSample and BatchPredict on the first sample error instead
+	// of dropping the sample or predicting it with a zero vector
+	Strict = false
+)
+
+// SampleError is returned by GetSampleVector, errors.Is(err, ErrMissingUser),
+// errors.Is(err, ErrMissingItem) or errors.Is(err, ErrProvider) tells the kind
+type SampleError struct {
+	Kind   error
+	UserId int
+	ItemId int
+	Err    error
+}
+
+func (e *SampleError) Error() string {
+	return fmt.Sprintf("%v: user %d item %d: %v", e.Kind, e.UserId, e.ItemId, e.Err)
+}
+
+func (e *SampleError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SampleError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// newSampleError classifies err of the provider as missing if it wraps
+// missing, else ErrProvider
+func newSampleError(sampleKey *Sample, missing error, err error) error {
+	kind := ErrProvider
+	if errors.Is(err, missing) {
+		kind = missing
+	}
+	return &SampleError{Kind: kind, UserId: sampleKey.UserId, ItemId: sampleKey.ItemId, Err: err}
+}
+
+// DropStats is the count of the samples dropped by kind
+type DropStats struct {
+	MissingUser int `json:"missingUser"`
+	MissingItem int `json:"missingItem"`
+	Provider    int `json:"provider"`
+	Other       int `json:"other"`
+	// Duplicate is the samples dropped by DedupSamples
+	Duplicate int `json:"duplicate,omitempty"`
+}
+
+func (d DropStats) Total() int {
+	return d.MissingUser + d.MissingItem + d.Provider + d.Other + d.Duplicate
+}
+
+// dropCounter is the concurrent version of DropStats
+type dropCounter struct {
+	missingUser, missingItem, provider, other, duplicate int64
+}
+
+func (c *dropCounter) add(err error) {
+	switch {
+	case errors.Is(err, ErrMissingUser):
+		atomic.AddInt64(&c.missingUser, 1)
+	case errors.Is(err, ErrMissingItem):
+		atomic.AddInt64(&c.missingItem, 1)
+	case errors.Is(err, ErrProvider):
+		atomic.AddInt64(&c.provider, 1)
+	default:
+		atomic.AddInt64(&c.other, 1)
+	}
+}
+
+func (c *dropCounter) stats() DropStats {
+	return DropStats{
+		MissingUser: int(atomic.LoadInt64(&c.missingUser)),
+		MissingItem: int(atomic.LoadInt64(&c.missingItem)),
+		Provider:    int(atomic.LoadInt64(&c.provider)),
+		Other:       int(atomic.LoadInt64(&c.other)),
+		Duplicate:   int(atomic.LoadInt64(&c.duplicate)),
+	}
+}
@@ -0,0 +1,74 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// lossyRecSys misses user 3, item 99 and fails the provider of item 98
+type lossyRecSys struct {
+	idRecSys
+}
+
+func (lossyRecSys) GetUserFeature(_ context.Context, userId int) (Tensor, error) {
+	if userId == 3 {
+		return nil, fmt.Errorf("%w: %d", ErrMissingUser, userId)
+	}
+	return Tensor{float32(userId)}, nil
+}
+
+func (lossyRecSys) GetItemFeature(_ context.Context, itemId int) (Tensor, error) {
+	switch itemId {
+	case 99:
+		return nil, fmt.Errorf("%w: %d", ErrMissingItem, itemId)
+	case 98:
+		return nil, errors.New("connection refused")
+	}
+	return Tensor{float32(itemId)}, nil
+}
+
+func TestSampleErrors(t *testing.T) {
+	Convey("typed sample errors", t, func() {
+		resetFeatureCache()
+		ctx := WithStage(context.Background(), TrainStage)
+
+		Convey("classified", func() {
+			_, _, _, err := GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, lossyRecSys{}, &Sample{UserId: 3, ItemId: 1})
+			So(errors.Is(err, ErrMissingUser), ShouldBeTrue)
+			_, _, _, err = GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, lossyRecSys{}, &Sample{UserId: 1, ItemId: 98})
+			So(errors.Is(err, ErrProvider), ShouldBeTrue)
+			So(errors.Is(err, ErrMissingItem), ShouldBeFalse)
+			var se *SampleError
+			So(errors.As(err, &se), ShouldBeTrue)
+			So(se.ItemId, ShouldEqual, 98)
+		})
+
+		Convey("dropped samples counted", func() {
+			sample, err := GetSample(lossyRecSys{}, ctx)
+			So(err, ShouldBeNil)
+			// 1000 samples of user i%7 and item i%100
+			So(sample.Dropped, ShouldResemble, DropStats{MissingUser: 143, MissingItem: 8, Provider: 9})
+			So(sample.Rows, ShouldEqual, 1000-sample.Dropped.Total())
+		})
+
+		Convey("strict fails fast", func() {
+			Strict = true
+			defer func() { Strict = false }()
+			_, err := GetSample(lossyRecSys{}, ctx)
+			So(err, ShouldNotBeNil)
+
+			_, err = BatchPredict(context.Background(), lossyRecSys{}, []Sample{{UserId: 1, ItemId: 1}, {UserId: 1, ItemId: 99}})
+			So(errors.Is(err, ErrMissingItem), ShouldBeTrue)
+		})
+
+		Convey("zero vector when not strict", func() {
+			y, err := BatchPredict(context.Background(), lossyRecSys{}, []Sample{{UserId: 1, ItemId: 1}, {UserId: 1, ItemId: 99}})
+			So(err, ShouldBeNil)
+			So(y.Shape()[0], ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package recommend
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/auxten/go-ctr/utils"
+	"gorgonia.org/tensor"
+)
+
+// Objective is the kind of the Sample labels
+type Objective int
+
+const (
+	// ObjectiveBinary labels are 0 or 1, e.g. the click
+	ObjectiveBinary Objective = iota
+	// ObjectiveRegression labels are real values or graded, e.g. the watch
+	// time or the rating 1-5
+	ObjectiveRegression
+)
+
+func (o Objective) String() string {
+	if o == ObjectiveRegression {
+		return "regression"
+	}
+	return "binary"
+}
+
+// LabelObjective is the Objective of the training labels, it selects the
+// label validation of ValidatePipeline, the loss of model.Train and the
+// metrics of Evaluate and PermutationImportance. The Fitter must match it,
+// e.g. mlp.SimpleMlpRegressorFitWrap for ObjectiveRegression.
+var LabelObjective = ObjectiveBinary
+
+// EvalMetrics are the metrics of a model on the samples, AUC and LogLoss
+// are of ObjectiveBinary only
+type EvalMetrics struct {
+	Objective string  `json:"objective"`
+	Rows      int     `json:"rows"`
+	AUC       float32 `json:"auc,omitempty"`
+	LogLoss   float64 `json:"logLoss,omitempty"`
+	RMSE      float64 `json:"rmse"`
+	MAE       float64 `json:"mae"`
+}
+
+// Evaluate returns the EvalMetrics of pred on sample by LabelObjective
+func Evaluate(pred PredictAbstract, sample *TrainSample) (m *EvalMetrics, err error) {
+	if sample.Rows == 0 {
+		return nil, fmt.Errorf("no sample to evaluate")
+	}
+	yPred, err := predictColumn(pred, sample.X, sample.Rows, sample.XCols)
+	if err != nil {
+		return
+	}
+	m = &EvalMetrics{Objective: LabelObjective.String(), Rows: sample.Rows}
+	m.RMSE, m.MAE = regressionErrors(yPred, sample.Y)
+	if LabelObjective == ObjectiveBinary {
+		m.AUC = utils.RocAuc32(yPred, sample.Y)
+		const eps = 1e-7
+		for i, p := range yPred {
+			p := math.Min(math.Max(float64(p), eps), 1-eps)
+			if sample.Y[i] > 0.5 {
+				m.LogLoss -= math.Log(p)
+			} else {
+				m.LogLoss -= math.Log(1 - p)
+			}
+		}
+		m.LogLoss /= float64(sample.Rows)
+	}
+	return
+}
+
+// regressionErrors returns the RMSE and MAE of yPred
+func regressionErrors(yPred, y []float32) (rmse, mae float64) {
+	for i, p := range yPred {
+		d := float64(p) - float64(y[i])
+		rmse += d * d
+		mae += math.Abs(d)
+	}
+	n := float64(len(yPred))
+	return math.Sqrt(rmse / n), mae / n
+}
+
+// evalScore is the higher the better score of yPred by LabelObjective, the
+// AUC or the negative RMSE
+func evalScore(yPred, y []float32) float32 {
+	if LabelObjective == ObjectiveRegression {
+		rmse, _ := regressionErrors(yPred, y)
+		return float32(-rmse)
+	}
+	return utils.RocAuc32(yPred, y)
+}
+
+// score is the evalScore of the metrics
+func (m *EvalMetrics) score() float32 {
+	if m.Objective == ObjectiveRegression.String() {
+		return float32(-m.RMSE)
+	}
+	return m.AUC
+}
+
+// predictColumn returns the first column predicted by pred of the rows of x
+func predictColumn(pred PredictAbstract, x []float32, rows, cols int) (yPred []float32, err error) {
+	y := pred.Predict(tensor.New(tensor.WithShape(rows, cols), tensor.WithBacking(x)))
+	if y == nil {
+		return nil, fmt.Errorf("predict %d rows failed", rows)
+	}
+	yPred = make([]float32, rows)
+	for i := range yPred {
+		var v interface{}
+		if v, err = y.At(i, 0); err != nil {
+			return nil, err
+		}
+		yPred[i] = v.(float32)
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvaluate(t *testing.T) {
+	defer func(o Objective) { LabelObjective = o }(LabelObjective)
+
+	Convey("binary", t, func() {
+		LabelObjective = ObjectiveBinary
+		// idPredictor scores the last column
+		sample := &TrainSample{
+			X:     []float32{0, 0.1, 0, 0.9, 0, 0.2, 0, 0.8},
+			Y:     []float32{0, 1, 0, 1},
+			Rows:  4,
+			XCols: 2,
+		}
+		m, err := Evaluate(idPredictor{}, sample)
+		So(err, ShouldBeNil)
+		So(m.Objective, ShouldEqual, "binary")
+		So(m.AUC, ShouldEqual, 1)
+		So(m.LogLoss, ShouldAlmostEqual, -(math.Log(0.9)+math.Log(0.9)+math.Log(0.8)+math.Log(0.8))/4, 1e-6)
+		So(m.MAE, ShouldAlmostEqual, 0.15, 1e-6)
+	})
+
+	Convey("regression", t, func() {
+		LabelObjective = ObjectiveRegression
+		sample := &TrainSample{
+			X:     []float32{0, 3, 0, 5, 0, 1},
+			Y:     []float32{4, 5, 2},
+			Rows:  3,
+			XCols: 2,
+		}
+		m, err := Evaluate(idPredictor{}, sample)
+		So(err, ShouldBeNil)
+		So(m.Objective, ShouldEqual, "regression")
+		So(m.AUC, ShouldEqual, 0)
+		So(m.RMSE, ShouldAlmostEqual, math.Sqrt(2./3), 1e-6)
+		So(m.MAE, ShouldAlmostEqual, 2./3, 1e-6)
+
+		// the graded labels are valid
+		report, err := ValidatePipeline(context.Background(), badLabelRecSys{}, nil)
+		So(err, ShouldBeNil)
+		for _, issue := range report.Issues {
+			So(issue, ShouldNotContainSubstring, "label")
+		}
+		LabelObjective = ObjectiveBinary
+	})
+
+	Convey("train result", t, func() {
+		resetFeatureCache()
+		defer func(rows int) { ImportanceRows = rows }(ImportanceRows)
+		ImportanceRows = 200
+		res, err := TrainWithResult(context.Background(), idRecSys{}, &idFitter{})
+		So(err, ShouldBeNil)
+		So(res.Eval, ShouldNotBeNil)
+		So(res.Eval.Rows, ShouldEqual, 200)
+	})
+}
@@ -0,0 +1,77 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+)
+
+// Variant is a bucket of an Experiment
+type Variant struct {
+	Name string
+	// Weight is the share of users routed to this variant
+	Weight    int
+	Predictor Predictor
+}
+
+// Experiment deterministically routes users to variants by hashing the
+// userId with Salt, the same user always hits the same variant as long as
+// Salt and Variants are unchanged.
+type Experiment struct {
+	Name     string
+	Salt     string
+	Variants []Variant
+
+	totalWeight int
+}
+
+func NewExperiment(name string, salt string, variants ...Variant) (exp *Experiment, err error) {
+	exp = &Experiment{
+		Name:     name,
+		Salt:     salt,
+		Variants: variants,
+	}
+	for _, v := range variants {
+		if v.Weight <= 0 {
+			return nil, fmt.Errorf("invalid weight %d of variant %s", v.Weight, v.Name)
+		}
+		if v.Predictor == nil {
+			return nil, fmt.Errorf("nil predictor of variant %s", v.Name)
+		}
+		exp.totalWeight += v.Weight
+	}
+	if exp.totalWeight == 0 {
+		return nil, fmt.Errorf("no variant in experiment %s", name)
+	}
+	return
+}
+
+// Bucket returns the variant of userId
+func (e *Experiment) Bucket(userId int) *Variant {
+	h := fnv.New32a()
+	h.Write([]byte(e.Salt))
+	h.Write([]byte(strconv.Itoa(userId)))
+	b := int(h.Sum32() % uint32(e.totalWeight))
+	for i := range e.Variants {
+		if b < e.Variants[i].Weight {
+			return &e.Variants[i]
+		}
+		b -= e.Variants[i].Weight
+	}
+	// unreachable
+	return &e.Variants[len(e.Variants)-1]
+}
+
+// Rank ranks itemIds with the variant of userId, ItemScore.Variant is set
+// to the variant name.
+func (e *Experiment) Rank(ctx context.Context, userId int, itemIds []int) (itemScores []ItemScore, err error) {
+	v := e.Bucket(userId)
+	if itemScores, err = Rank(ctx, v.Predictor, userId, itemIds); err != nil {
+		return
+	}
+	for i := range itemScores {
+		itemScores[i].Variant = v.Name
+	}
+	return
+}
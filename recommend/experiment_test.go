@@ -0,0 +1,40 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExperiment(t *testing.T) {
+	Convey("experiment bucketing", t, func() {
+		_, err := NewExperiment("empty", "s")
+		So(err, ShouldNotBeNil)
+		_, err = NewExperiment("zero", "s", Variant{Name: "a", Predictor: idPredictor{}})
+		So(err, ShouldNotBeNil)
+
+		exp, err := NewExperiment("exp", "salt",
+			Variant{Name: "control", Weight: 1, Predictor: idPredictor{}},
+			Variant{Name: "treatment", Weight: 3, Predictor: idPredictor{}},
+		)
+		So(err, ShouldBeNil)
+
+		cnt := make(map[string]int)
+		for userId := 0; userId < 10000; userId++ {
+			v := exp.Bucket(userId)
+			So(exp.Bucket(userId), ShouldEqual, v)
+			cnt[v.Name]++
+		}
+		So(cnt["control"], ShouldBeBetween, 2000, 3000)
+		So(cnt["treatment"], ShouldBeBetween, 7000, 8000)
+
+		resetFeatureCache()
+		scores, err := exp.Rank(context.Background(), 42, []int{1, 2})
+		So(err, ShouldBeNil)
+		So(scores, ShouldHaveLength, 2)
+		for _, s := range scores {
+			So(s.Variant, ShouldEqual, exp.Bucket(42).Name)
+		}
+	})
+}
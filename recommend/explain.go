@@ -0,0 +1,130 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorgonia.org/tensor"
+)
+
+// Contribution is the score delta of a feature group, which is the score
+// minus the score with the group zeroed.
+type Contribution struct {
+	Name  string  `json:"name"`
+	Range [2]int  `json:"range"`
+	Delta float32 `json:"delta"`
+}
+
+// Explanation is the per feature group contributions to the score of an item
+type Explanation struct {
+	ItemId        int            `json:"itemId"`
+	Score         float32        `json:"score"`
+	Contributions []Contribution `json:"contributions"`
+}
+
+// RankExplain scores itemIds like Rank and explains each score by zeroing
+// the UserProfile, UserBehavior, ItemEmbedding and ItemFeature(ctx) groups of
+// SampleInfo one by one. All the variants are predicted in one batch.
+// Exploration and PostRanker are not applied.
+func RankExplain(ctx context.Context, recSys Predictor, userId int, itemIds []int) (explanations []Explanation, err error) {
+	ctx = WithStage(ctx, PredictStage)
+	if ctx, recSys, err = servingModel(ctx, recSys); err != nil {
+		return
+	}
+	if preRanker, ok := recSys.(PreRanker); ok {
+		if err = preRanker.PreRank(ctx); err != nil {
+			log.Errorf("pre rank error: %v", err)
+			return
+		}
+	}
+	if UserFeatureCache == nil || ItemFeatureCache == nil {
+		err = fmt.Errorf("feature cache not initialized")
+		return
+	}
+	if len(itemIds) == 0 {
+		return
+	}
+
+	var (
+		info   SampleInfo
+		groups []Contribution
+		xWidth int
+		xData  []float32
+		now    = time.Now().Unix()
+	)
+	for i, itemId := range itemIds {
+		sampleKey := Sample{UserId: userId, ItemId: itemId, Timestamp: now}
+		vec, uWidth, iWidth, er := GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, recSys, &sampleKey)
+		if er != nil {
+			err = fmt.Errorf("get sample vector of item %d error: %v", itemId, er)
+			return
+		}
+		if i == 0 {
+			info = newSampleInfo(uWidth, iWidth)
+			groups = []Contribution{
+				{Name: "UserProfile", Range: info.UserProfileRange},
+				{Name: "UserBehavior", Range: info.UserBehaviorRange},
+				{Name: "ItemEmbedding", Range: info.ItemFeatureRange},
+				{Name: "ItemFeature", Range: info.CtxFeatureRange},
+			}
+			for _, ch := range info.BehaviorChannelRanges {
+				groups = append(groups, Contribution{Name: "Behavior:" + ch.Name, Range: ch.Range})
+			}
+			if ctxFeatureWidth() > 0 {
+				groups = append(groups, Contribution{Name: "RequestCtx", Range: info.RequestCtxRange})
+			}
+			if SparseFeatureDim > 0 {
+				groups = append(groups, Contribution{Name: "Sparse", Range: info.SparseRange})
+			}
+			xWidth = len(vec)
+			xData = make([]float32, 0, len(itemIds)*(1+len(groups))*xWidth)
+		}
+		if len(vec) != xWidth {
+			err = fmt.Errorf("x slice length %d != x col %d", len(vec), xWidth)
+			return
+		}
+		// original row followed by a row for each zeroed group
+		xData = append(xData, vec...)
+		for _, g := range groups {
+			start := len(xData)
+			xData = append(xData, vec...)
+			for j := g.Range[0]; j < g.Range[1]; j++ {
+				xData[start+j] = 0
+			}
+		}
+	}
+
+	rows := len(xData) / xWidth
+	y := recSys.Predict(tensor.NewDense(tensor.Float32, tensor.Shape{rows, xWidth}, tensor.WithBacking(xData)))
+	score := func(row int) (s float32, er error) {
+		v, er := y.At(row, 0)
+		if er != nil {
+			return
+		}
+		return v.(float32), nil
+	}
+
+	explanations = make([]Explanation, len(itemIds))
+	for i, itemId := range itemIds {
+		base := i * (1 + len(groups))
+		exp := Explanation{
+			ItemId:        itemId,
+			Contributions: make([]Contribution, len(groups)),
+		}
+		if exp.Score, err = score(base); err != nil {
+			return nil, err
+		}
+		for j, g := range groups {
+			var s float32
+			if s, err = score(base + 1 + j); err != nil {
+				return nil, err
+			}
+			g.Delta = exp.Score - s
+			exp.Contributions[j] = g
+		}
+		explanations[i] = exp
+	}
+	return
+}
@@ -0,0 +1,31 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRankExplain(t *testing.T) {
+	Convey("explain by zeroing feature groups", t, func() {
+		resetFeatureCache()
+		// idPredictor scores by the item feature only
+		explanations, err := RankExplain(context.Background(), idPredictor{}, 1, []int{3, 5})
+		So(err, ShouldBeNil)
+		So(explanations, ShouldHaveLength, 2)
+		for i, itemId := range []int{3, 5} {
+			exp := explanations[i]
+			So(exp.ItemId, ShouldEqual, itemId)
+			So(exp.Score, ShouldEqual, itemId)
+			So(exp.Contributions, ShouldHaveLength, 4)
+			for _, c := range exp.Contributions {
+				if c.Name == "ItemFeature" {
+					So(c.Delta, ShouldEqual, itemId)
+				} else {
+					So(c.Delta, ShouldEqual, 0)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// ExplorationKey is the ctx key of the per request ExplorationPolicy
+const ExplorationKey ctxKey = "exploration"
+
+// Exploration is the default ExplorationPolicy applied in Rank, nil means
+// pure exploitation. It could be overridden per request by WithExploration.
+var Exploration ExplorationPolicy
+
+// ExplorationPolicy adjusts the scores of Rank to let under-served items get
+// some traffic. Explored items should be marked with ItemScore.Explored.
+type ExplorationPolicy interface {
+	Explore(ctx context.Context, userId int, itemScores []ItemScore)
+}
+
+// WithExploration returns a ctx making Rank use policy, nil policy disables
+// the exploration for the request even if Exploration is set.
+func WithExploration(ctx context.Context, policy ExplorationPolicy) context.Context {
+	return context.WithValue(ctx, ExplorationKey, explorationValue{policy})
+}
+
+type explorationValue struct {
+	ExplorationPolicy
+}
+
+func explorationOf(ctx context.Context) ExplorationPolicy {
+	if v, ok := ctx.Value(ExplorationKey).(explorationValue); ok {
+		return v.ExplorationPolicy
+	}
+	return Exploration
+}
+
+// lockedRand is a rand.Rand safe for concurrent use
+type lockedRand struct {
+	sync.Mutex
+	r *rand.Rand
+}
+
+func (lr *lockedRand) Float64() float64 {
+	lr.Lock()
+	defer lr.Unlock()
+	return lr.r.Float64()
+}
+
+func (lr *lockedRand) NormFloat64() float64 {
+	lr.Lock()
+	defer lr.Unlock()
+	return lr.r.NormFloat64()
+}
+
+func (lr *lockedRand) Intn(n int) int {
+	lr.Lock()
+	defer lr.Unlock()
+	return lr.r.Intn(n)
+}
+
+// beta samples Beta(alpha, beta) by the ratio of the gamma samples
+func (lr *lockedRand) beta(alpha, beta float64) float64 {
+	x, y := lr.gamma(alpha), lr.gamma(beta)
+	if x+y == 0 {
+		return alpha / (alpha + beta)
+	}
+	return x / (x + y)
+}
+
+// gamma samples Gamma(shape, 1) by Marsaglia and Tsang, the shape below 1
+// is boosted by a uniform power
+func (lr *lockedRand) gamma(shape float64) float64 {
+	if shape < 1 {
+		return lr.gamma(shape+1) * math.Pow(lr.Float64(), 1/shape)
+	}
+	d := shape - 1./3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := lr.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		if u := lr.Float64(); math.Log(u) < x*x/2+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// EpsilonGreedy swaps the score of the best item with a random other item in
+// Epsilon of the requests.
+type EpsilonGreedy struct {
+	Epsilon float64
+	rand    *lockedRand
+}
+
+func NewEpsilonGreedy(epsilon float64, seed int64) *EpsilonGreedy {
+	return &EpsilonGreedy{
+		Epsilon: epsilon,
+		rand:    &lockedRand{r: rand.New(rand.NewSource(seed))},
+	}
+}
+
+func (e *EpsilonGreedy) Explore(_ context.Context, _ int, itemScores []ItemScore) {
+	if len(itemScores) < 2 || e.rand.Float64() >= e.Epsilon {
+		return
+	}
+	best := 0
+	for i := range itemScores {
+		if itemScores[i].Score > itemScores[best].Score {
+			best = i
+		}
+	}
+	// pick one of the others
+	j := e.rand.Intn(len(itemScores) - 1)
+	if j >= best {
+		j++
+	}
+	itemScores[best].Score, itemScores[j].Score = itemScores[j].Score, itemScores[best].Score
+	itemScores[j].Explored = true
+}
+
+// ScorePerturb adds gaussian noise to the scores, the stddev of an item is
+// Sigma / sqrt(1 + impressions), so less shown items are more likely to be
+// lifted. Impressions is optional, nil means all items have 0 impressions.
+// Items lifted above the original best score are marked Explored.
+type ScorePerturb struct {
+	Sigma       float64
+	Impressions func(itemId int) int
+	rand        *lockedRand
+}
+
+func NewScorePerturb(sigma float64, impressions func(itemId int) int, seed int64) *ScorePerturb {
+	return &ScorePerturb{
+		Sigma:       sigma,
+		Impressions: impressions,
+		rand:        &lockedRand{r: rand.New(rand.NewSource(seed))},
+	}
+}
+
+func (t *ScorePerturb) Explore(_ context.Context, _ int, itemScores []ItemScore) {
+	best := bestScore(itemScores)
+	for i := range itemScores {
+		var imp int
+		if t.Impressions != nil {
+			imp = t.Impressions(itemScores[i].ItemId)
+		}
+		origin := itemScores[i].Score
+		itemScores[i].Score += float32(t.rand.NormFloat64() * t.Sigma / math.Sqrt(1+float64(imp)))
+		if origin < best && itemScores[i].Score > best {
+			itemScores[i].Explored = true
+		}
+	}
+}
+
+// ThompsonSampling replaces the score of an item by a sample of its Beta
+// posterior of the CTR: the score is the prior mean of PriorWeight pseudo
+// impressions, updated by the impressions and clicks of Feedback. The
+// posteriors of the less shown items are wider, so they are more likely to
+// be sampled above the original best score, those are marked Explored. The
+// scores are taken as the probabilities in [0, 1]. Feedback is optional,
+// nil samples from the priors only.
+type ThompsonSampling struct {
+	PriorWeight float64
+	Feedback    func(itemId int) (impressions, clicks int)
+	rand        *lockedRand
+}
+
+func NewThompsonSampling(priorWeight float64, feedback func(itemId int) (impressions, clicks int), seed int64) *ThompsonSampling {
+	return &ThompsonSampling{
+		PriorWeight: priorWeight,
+		Feedback:    feedback,
+		rand:        &lockedRand{r: rand.New(rand.NewSource(seed))},
+	}
+}
+
+func (t *ThompsonSampling) Explore(_ context.Context, _ int, itemScores []ItemScore) {
+	const minProb = 1e-6
+	best := bestScore(itemScores)
+	for i := range itemScores {
+		var imp, clicks int
+		if t.Feedback != nil {
+			imp, clicks = t.Feedback(itemScores[i].ItemId)
+		}
+		if clicks > imp {
+			clicks = imp
+		}
+		origin := itemScores[i].Score
+		p := math.Min(math.Max(float64(origin), minProb), 1-minProb)
+		alpha := p*t.PriorWeight + float64(clicks)
+		beta := (1-p)*t.PriorWeight + float64(imp-clicks)
+		if alpha <= 0 || beta <= 0 {
+			continue
+		}
+		itemScores[i].Score = float32(t.rand.beta(alpha, beta))
+		if origin < best && itemScores[i].Score > best {
+			itemScores[i].Explored = true
+		}
+	}
+}
+
+func bestScore(itemScores []ItemScore) (best float32) {
+	best = -math.MaxFloat32
+	for _, s := range itemScores {
+		if s.Score > best {
+			best = s.Score
+		}
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExploration(t *testing.T) {
+	Convey("epsilon greedy", t, func() {
+		ctx := context.Background()
+		resetFeatureCache()
+		scores, err := Rank(WithExploration(ctx, NewEpsilonGreedy(1, 1)), idPredictor{}, 1, []int{1, 2, 3})
+		So(err, ShouldBeNil)
+		// best score 3 swapped to another item
+		So(scores[2].Score, ShouldBeLessThan, 3)
+		var explored int
+		for _, s := range scores {
+			if s.Explored {
+				explored++
+				So(s.Score, ShouldEqual, 3)
+			}
+		}
+		So(explored, ShouldEqual, 1)
+
+		Exploration = NewEpsilonGreedy(1, 1)
+		defer func() { Exploration = nil }()
+		// disabled per request
+		scores, err = Rank(WithExploration(ctx, nil), idPredictor{}, 1, []int{1, 2, 3})
+		So(err, ShouldBeNil)
+		So(scores[2].Score, ShouldEqual, 3)
+		So(scores[2].Explored, ShouldBeFalse)
+	})
+
+	Convey("score perturb", t, func() {
+		shown := map[int]int{1: 0, 2: 1000000}
+		tp := NewScorePerturb(0.5, func(itemId int) int { return shown[itemId] }, 1)
+		var lifted int
+		for i := 0; i < 1000; i++ {
+			scores := []ItemScore{{ItemId: 1, Score: 0.5}, {ItemId: 2, Score: 0.6}}
+			tp.Explore(context.Background(), 1, scores)
+			So(scores[1].Score, ShouldAlmostEqual, 0.6, 0.01)
+			if scores[0].Explored {
+				lifted++
+			}
+		}
+		So(lifted, ShouldBeBetween, 200, 500)
+	})
+
+	Convey("thompson sampling", t, func() {
+		// impressions and clicks
+		feedback := map[int][2]int{1: {0, 0}, 2: {1000000, 600000}, 3: {1000000, 100000}}
+		ts := NewThompsonSampling(2, func(itemId int) (int, int) {
+			return feedback[itemId][0], feedback[itemId][1]
+		}, 1)
+		var lifted, liftedShown int
+		var mean float64
+		for i := 0; i < 1000; i++ {
+			scores := []ItemScore{{ItemId: 1, Score: 0.5}, {ItemId: 2, Score: 0.6}, {ItemId: 3, Score: 0.5}}
+			ts.Explore(context.Background(), 1, scores)
+			So(scores[1].Score, ShouldAlmostEqual, 0.6, 0.01)
+			So(scores[2].Score, ShouldAlmostEqual, 0.1, 0.01)
+			mean += float64(scores[0].Score) / 1000
+			if scores[0].Explored {
+				lifted++
+			}
+			if scores[2].Explored {
+				liftedShown++
+			}
+		}
+		// the unseen item samples Beta(1, 1), above 0.6 in 40%
+		So(lifted, ShouldBeBetween, 300, 500)
+		So(mean, ShouldAlmostEqual, 0.5, 0.05)
+		// the well shown poor item is never explored
+		So(liftedShown, ShouldEqual, 0)
+	})
+}
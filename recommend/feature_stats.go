@@ -0,0 +1,146 @@
+package recommend
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+var (
+	// FeatureStatsRows is the rows of GetSample sampled for the quantiles of
+	// the FeatureStats, 0 disables the FeatureStats
+	FeatureStatsRows = 10000
+	// FeatureStatsQuantiles are the quantiles of every FeatureSummary
+	FeatureStatsQuantiles = []float64{0.01, 0.25, 0.5, 0.75, 0.99}
+
+	lastFeatureStats struct {
+		sync.Mutex
+		stats *FeatureStats
+	}
+)
+
+// FeatureStats is the distribution of every feature of the samples of the
+// last GetSample, served by /service/featurestats for the dashboard to show
+// the data-quality problems, e.g. the NaNs or the constant features, before
+// the training
+type FeatureStats struct {
+	Rows      int            `json:"rows"`
+	Quantiles []float64      `json:"quantiles"`
+	Ranges    []RangeStats   `json:"ranges"`
+	Label     FeatureSummary `json:"label"`
+}
+
+// RangeStats is the FeatureSummary of every feature of a range of SampleInfo
+type RangeStats struct {
+	Name     string           `json:"name"`
+	Range    [2]int           `json:"range"`
+	Features []FeatureSummary `json:"features"`
+}
+
+// FeatureSummary of a feature over the rows, NullRate is the ratio of NaN
+// or Inf values which Min, Max, Mean and Quantiles skip. Constant is true if
+// all the values are the same, the feature is useless then.
+type FeatureSummary struct {
+	Feature   int       `json:"feature"`
+	Min       float32   `json:"min"`
+	Max       float32   `json:"max"`
+	Mean      float64   `json:"mean"`
+	Quantiles []float32 `json:"quantiles"`
+	NullRate  float64   `json:"nullRate"`
+	ZeroRate  float64   `json:"zeroRate"`
+	Constant  bool      `json:"constant,omitempty"`
+}
+
+// LastFeatureStats returns the FeatureStats of the last GetSample, nil if
+// none
+func LastFeatureStats() *FeatureStats {
+	lastFeatureStats.Lock()
+	defer lastFeatureStats.Unlock()
+	return lastFeatureStats.stats
+}
+
+func setLastFeatureStats(stats *FeatureStats) {
+	lastFeatureStats.Lock()
+	defer lastFeatureStats.Unlock()
+	lastFeatureStats.stats = stats
+}
+
+// NewFeatureStats returns the FeatureStats of sample, the quantiles are of
+// up to maxRows rows evenly spaced, all if maxRows <= 0
+func NewFeatureStats(sample *TrainSample, maxRows int) *FeatureStats {
+	stats := &FeatureStats{Rows: sample.Rows, Quantiles: FeatureStatsQuantiles}
+	stride := 1
+	if maxRows > 0 && sample.Rows > maxRows {
+		stride = (sample.Rows + maxRows - 1) / maxRows
+	}
+	values := make([]float32, 0, (sample.Rows+stride-1)/stride)
+	column := func(f int) func(r int) float32 {
+		return func(r int) float32 { return sample.X[r*sample.XCols+f] }
+	}
+	for _, fr := range featureRanges(sample.Info) {
+		rs := RangeStats{Name: fr.Name, Range: fr.Range}
+		for f := fr.Range[0]; f < fr.Range[1] && f < sample.XCols; f++ {
+			rs.Features = append(rs.Features, summarizeFeature(f, sample.Rows, stride, column(f), values))
+		}
+		if len(rs.Features) == 0 {
+			continue
+		}
+		stats.Ranges = append(stats.Ranges, rs)
+	}
+	stats.Label = summarizeFeature(-1, sample.Rows, stride, func(r int) float32 { return sample.Y[r] }, values)
+	return stats
+}
+
+// summarizeFeature returns the FeatureSummary of the rows values of at, values is
+// the buffer of the quantile rows
+func summarizeFeature(feature, rows, stride int, at func(r int) float32, values []float32) (s FeatureSummary) {
+	s.Feature = feature
+	var (
+		sum               float64
+		valid, null, zero int
+	)
+	for r := 0; r < rows; r++ {
+		v := at(r)
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			null++
+			continue
+		}
+		if valid == 0 || v < s.Min {
+			s.Min = v
+		}
+		if valid == 0 || v > s.Max {
+			s.Max = v
+		}
+		if v == 0 {
+			zero++
+		}
+		sum += float64(v)
+		valid++
+	}
+	if rows == 0 {
+		return
+	}
+	s.NullRate = float64(null) / float64(rows)
+	s.ZeroRate = float64(zero) / float64(rows)
+	if valid == 0 {
+		return
+	}
+	s.Mean = sum / float64(valid)
+	s.Constant = s.Min == s.Max
+
+	values = values[:0]
+	for r := 0; r < rows; r += stride {
+		if v := at(r); !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0) {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	s.Quantiles = make([]float32, len(FeatureStatsQuantiles))
+	for i, q := range FeatureStatsQuantiles {
+		s.Quantiles[i] = values[int(q*float64(len(values)-1)+0.5)]
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFeatureStats(t *testing.T) {
+	Convey("feature distribution statistics", t, func() {
+		nan := float32(math.NaN())
+		sample := &TrainSample{
+			// the user feature 0..9 with a NaN, the item feature constant
+			X:     []float32{0, 1, 1, 1, 2, 1, 3, 1, nan, 1, 5, 1, 6, 1, 7, 1, 8, 1, 9, 1},
+			Y:     []float32{0, 0, 0, 0, 0, 1, 1, 1, 1, 1},
+			Rows:  10,
+			XCols: 2,
+			Info: SampleInfo{
+				UserProfileRange:  [2]int{0, 1},
+				UserBehaviorRange: [2]int{1, 1},
+				ItemFeatureRange:  [2]int{1, 1},
+				CtxFeatureRange:   [2]int{1, 2},
+			},
+		}
+		stats := NewFeatureStats(sample, 0)
+		So(stats.Rows, ShouldEqual, 10)
+		So(stats.Ranges, ShouldHaveLength, 2)
+		So(stats.Ranges[0].Name, ShouldEqual, "UserProfile")
+		So(stats.Ranges[1].Name, ShouldEqual, "ItemFeature")
+
+		user := stats.Ranges[0].Features[0]
+		So(user.Feature, ShouldEqual, 0)
+		So(user.Min, ShouldEqual, 0)
+		So(user.Max, ShouldEqual, 9)
+		So(user.Mean, ShouldEqual, 41.0/9)
+		So(user.NullRate, ShouldEqual, 0.1)
+		So(user.ZeroRate, ShouldEqual, 0.1)
+		So(user.Quantiles, ShouldHaveLength, len(FeatureStatsQuantiles))
+		So(user.Quantiles[2], ShouldEqual, 5)
+		So(user.Constant, ShouldBeFalse)
+
+		item := stats.Ranges[1].Features[0]
+		So(item.Feature, ShouldEqual, 1)
+		So(item.Constant, ShouldBeTrue)
+		So(item.NullRate, ShouldEqual, 0)
+
+		So(stats.Label.Mean, ShouldEqual, 0.5)
+
+		Convey("computed by GetSample", func() {
+			resetFeatureCache()
+			defer resetFeatureCache()
+			sample, err := GetSample(&idRecSys{}, context.Background())
+			So(err, ShouldBeNil)
+			stats := LastFeatureStats()
+			So(stats, ShouldNotBeNil)
+			So(stats.Rows, ShouldEqual, sample.Rows)
+			So(stats.Label.Mean, ShouldEqual, 0.5)
+		})
+	})
+}
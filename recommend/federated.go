@@ -0,0 +1,231 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// FedClientHeader is the header of the client id of a FedUpdate post, the
+// body is signed by the secret of the client in WebhookSignatureHeader
+const FedClientHeader = "X-Ctr-Client"
+
+// FedUpdate is posted by edge instances to the FedAggregator
+type FedUpdate struct {
+	ClientId string     `json:"clientId"`
+	Head     LinearHead `json:"head"`
+}
+
+// FedAggregator collects the LinearHead updates of edge Personalizers, and
+// averages them into a new global head every MinClients updates. Each global
+// head is registered to Registry as a new model version on top of Base.
+//
+// Individual updates are only kept until the round is aggregated. Every
+// update is clipped to ClipNorm and Gaussian noise of NoiseStd is added to
+// the average if set, to limit what could be learned about a single client.
+type FedAggregator struct {
+	Base     Predictor
+	Registry *ModelRegistry
+	// MinClients is the distinct clients needed to aggregate a round
+	MinClients int
+	// ClipNorm clips the L2 norm of [Bias, W...] of every update, 0 means no clip
+	ClipNorm float32
+	// NoiseStd is the stddev of the Gaussian noise added to the average
+	NoiseStd float64
+	// AutoActivate activates the new version after each round, or else it
+	// is activated by ModelRegistry.Activate after a review
+	AutoActivate bool
+	// ClientSecrets is the secret of every client allowed to post to Handler,
+	// the updates of the others are rejected
+	ClientSecrets map[string]string
+
+	sync.Mutex
+	round   int
+	pending map[string]LinearHead
+	global  LinearHead
+}
+
+func NewFedAggregator(base Predictor, registry *ModelRegistry, minClients int) *FedAggregator {
+	return &FedAggregator{
+		Base:          base,
+		Registry:      registry,
+		MinClients:    minClients,
+		ClientSecrets: make(map[string]string),
+		pending:       make(map[string]LinearHead),
+		global:        LinearHead{W: make([]float32, ItemEmbDim)},
+	}
+}
+
+// Submit adds the update of a client, the latest update of a client in a
+// round replaces the previous one. It returns the current global head.
+func (a *FedAggregator) Submit(update FedUpdate) (global LinearHead, err error) {
+	if len(update.Head.W) != ItemEmbDim {
+		err = fmt.Errorf("head dim mismatch: %d:%d", ItemEmbDim, len(update.Head.W))
+		return
+	}
+	if update.Head.Updates <= 0 {
+		err = fmt.Errorf("empty update from client %s", update.ClientId)
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	a.pending[update.ClientId] = a.clip(update.Head)
+	if len(a.pending) >= a.MinClients {
+		if err = a.aggregate(); err != nil {
+			return
+		}
+	}
+	return a.global, nil
+}
+
+// Round returns the count of aggregated rounds
+func (a *FedAggregator) Round() int {
+	a.Lock()
+	defer a.Unlock()
+	return a.round
+}
+
+func (a *FedAggregator) clip(head LinearHead) LinearHead {
+	head.W = append([]float32(nil), head.W...)
+	if a.ClipNorm <= 0 {
+		return head
+	}
+	norm := float64(head.Bias * head.Bias)
+	for _, w := range head.W {
+		norm += float64(w * w)
+	}
+	norm = math.Sqrt(norm)
+	if norm <= float64(a.ClipNorm) {
+		return head
+	}
+	scale := a.ClipNorm / float32(norm)
+	head.Bias *= scale
+	for i := range head.W {
+		head.W[i] *= scale
+	}
+	return head
+}
+
+func (a *FedAggregator) aggregate() (err error) {
+	global := LinearHead{W: make([]float32, ItemEmbDim)}
+	for _, head := range a.pending {
+		n := float32(head.Updates)
+		global.Bias += head.Bias * n
+		for i := range global.W {
+			global.W[i] += head.W[i] * n
+		}
+		global.Updates += head.Updates
+	}
+	total := float32(global.Updates)
+	global.Bias = global.Bias/total + float32(rand.NormFloat64()*a.NoiseStd)
+	for i := range global.W {
+		global.W[i] = global.W[i]/total + float32(rand.NormFloat64()*a.NoiseStd)
+	}
+
+	version := fmt.Sprintf("fed-%d", a.round+1)
+	if a.Registry != nil {
+		if err = a.Registry.Register(&headModel{Predictor: a.Base, head: global}, ModelMeta{
+			Version:     version,
+			SampleCount: global.Updates,
+		}); err != nil {
+			return
+		}
+		if a.AutoActivate {
+			if err = a.Registry.Activate(version); err != nil {
+				return
+			}
+		}
+	}
+	log.Infof("federated round %d aggregated from %d clients, %d updates",
+		a.round+1, len(a.pending), global.Updates)
+	a.round++
+	a.global = global
+	a.pending = make(map[string]LinearHead)
+	return
+}
+
+// headModel applies a global LinearHead on the scores of Predictor
+type headModel struct {
+	Predictor
+	head LinearHead
+}
+
+func (m *headModel) PostRank(_ context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+	h := userHead{LinearHead: m.head}
+	for i := range itemScores {
+		itemScores[i].Score = sigmoid32(h.logit(itemScores[i].Score, personalizeEmb(itemScores[i].ItemId)))
+	}
+	return itemScores, nil
+}
+
+// Handler is the gin handler accepting FedUpdate json signed by the client
+// of FedClientHeader and responding the global LinearHead, e.g.
+// engine.POST("/federated/update", agg.Handler())
+func (a *FedAggregator) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientId := c.GetHeader(FedClientHeader)
+		a.Lock()
+		secret := a.ClientSecrets[clientId]
+		a.Unlock()
+		if secret == "" {
+			c.JSON(401, gin.H{"error": "unknown client"})
+			return
+		}
+		body, ok := signedBody(c, secret)
+		if !ok {
+			return
+		}
+		var update FedUpdate
+		if err := json.Unmarshal(body, &update); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if update.ClientId != clientId {
+			c.JSON(401, gin.H{"error": "client id mismatch"})
+			return
+		}
+		global, err := a.Submit(update)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, global)
+	}
+}
+
+// FedHeadSync returns a HeadSync for Personalizer.StartSync posting the
+// updates signed by secret to the FedAggregator Handler at url.
+func FedHeadSync(url string, clientId string, secret string) HeadSync {
+	return func(ctx context.Context, update LinearHead) (global LinearHead, err error) {
+		body, err := json.Marshal(FedUpdate{ClientId: clientId, Head: update})
+		if err != nil {
+			return
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(FedClientHeader, clientId)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(secret, body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("federated sync unexpected status: %s", resp.Status)
+			return
+		}
+		err = json.NewDecoder(resp.Body).Decode(&global)
+		return
+	}
+}
@@ -0,0 +1,60 @@
+package recommend
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFedAggregator(t *testing.T) {
+	Convey("federated aggregation", t, func() {
+		gin.SetMode(gin.TestMode)
+		registry := NewModelRegistry()
+		agg := NewFedAggregator(idPredictor{}, registry, 2)
+		So(agg.AutoActivate, ShouldBeFalse)
+		agg.ClipNorm = 10
+		agg.AutoActivate = true
+		agg.ClientSecrets["a"], agg.ClientSecrets["b"] = "sa", "sb"
+		engine := gin.New()
+		engine.POST("/federated/update", agg.Handler())
+		srv := httptest.NewServer(engine)
+		defer srv.Close()
+
+		ctx := context.Background()
+		head := func(bias float32, updates int) LinearHead {
+			return LinearHead{Bias: bias, W: make([]float32, ItemEmbDim), Updates: updates}
+		}
+		// unknown client, the secret of another client
+		_, err := FedHeadSync(srv.URL+"/federated/update", "x", "sa")(ctx, head(1, 1))
+		So(err, ShouldNotBeNil)
+		_, err = FedHeadSync(srv.URL+"/federated/update", "a", "sb")(ctx, head(1, 1))
+		So(err, ShouldNotBeNil)
+
+		global, err := FedHeadSync(srv.URL+"/federated/update", "a", "sa")(ctx, head(1, 1))
+		So(err, ShouldBeNil)
+		So(global.Updates, ShouldEqual, 0)
+		So(agg.Round(), ShouldEqual, 0)
+
+		// clipped to 10 then weighted averaged: (10*3 + 1*1) / 4
+		global, err = FedHeadSync(srv.URL+"/federated/update", "b", "sb")(ctx, head(100, 3))
+		So(err, ShouldBeNil)
+		So(global.Updates, ShouldEqual, 4)
+		So(global.Bias, ShouldAlmostEqual, 7.75, 1e-5)
+		So(agg.Round(), ShouldEqual, 1)
+
+		model, meta, err := registry.Resolve("")
+		So(err, ShouldBeNil)
+		So(meta.Version, ShouldEqual, "fed-1")
+		resetFeatureCache()
+		scores, err := Rank(ctx, model, 1, []int{0})
+		So(err, ShouldBeNil)
+		// sigmoid(logit(~0) + 7.75)
+		So(scores[0].Score, ShouldBeGreaterThan, 0)
+
+		_, err = agg.Submit(FedUpdate{ClientId: "c", Head: LinearHead{Updates: 1}})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,162 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// HardNegatives is the hard negatives mined per positive by Train, 0
+	// disables the mining. Train fits a first model, scores the items the
+	// user of every positive has no sample with and adds the top scored as
+	// the negatives before fitting the final model on the enriched samples.
+	HardNegatives int
+	// HardNegativeCandidates is the items sampled to score per positive
+	HardNegativeCandidates = 20
+	// HardNegativeMinScore is the min score of a candidate to be a hard
+	// negative, the false positives of the first model
+	HardNegativeMinScore float32 = 0.5
+)
+
+type userItem struct {
+	userId, itemId int
+}
+
+// mineHardNegatives fits mlp on sample and appends the hard negatives of
+// the positives of sample to it, it returns the rows appended
+func mineHardNegatives(ctx context.Context, recSys RecSys, mlp Fitter, sample *TrainSample) (mined int, err error) {
+	if LabelObjective != ObjectiveBinary {
+		return 0, fmt.Errorf("hard negatives need the binary labels")
+	}
+	if len(sample.Keys) != sample.Rows {
+		return 0, fmt.Errorf("sample has no keys to mine hard negatives")
+	}
+	pred, err := fitSample(ctx, mlp, sample)
+	if err != nil {
+		return 0, fmt.Errorf("fit the first model error: %v", err)
+	}
+
+	var (
+		items      []int
+		interacted = make(map[userItem]bool)
+		itemSeen   = make(map[int]bool)
+	)
+	for _, key := range sample.Keys {
+		if !itemSeen[key.ItemId] {
+			itemSeen[key.ItemId] = true
+			items = append(items, key.ItemId)
+		}
+		interacted[userItem{key.UserId, key.ItemId}] = true
+	}
+
+	// the candidates of the positive k are cands[bounds[k]:bounds[k+1]]
+	var (
+		rnd    = newTrainRand(ctx)
+		cands  []SampleKey
+		x      []float32
+		bounds = []int{0}
+	)
+	for r, y := range sample.Y[:sample.Rows] {
+		if y < 0.5 {
+			continue
+		}
+		key := sample.Keys[r]
+		for _, item := range candidateItems(items, HardNegativeCandidates, rnd.Intn, func(item int) bool {
+			return !interacted[userItem{key.UserId, item}]
+		}) {
+			s := Sample{UserId: key.UserId, ItemId: item, Timestamp: key.Timestamp}
+			vec, _, _, err := GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, recSys, &s)
+			if err != nil {
+				log.Debugf("drop hard negative candidate: %v", err)
+				continue
+			}
+			if len(vec) != sample.XCols {
+				return 0, fmt.Errorf("hard negative width mismatch: %v:%v", sample.XCols, len(vec))
+			}
+			x = append(x, vec...)
+			cands = append(cands, SampleKey{UserId: s.UserId, ItemId: s.ItemId, Timestamp: s.Timestamp})
+		}
+		bounds = append(bounds, len(cands))
+	}
+	if len(cands) == 0 {
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	scores, err := predictColumn(pred, x, len(cands), sample.XCols)
+	if err != nil {
+		return 0, err
+	}
+	for k := 0; k+1 < len(bounds); k++ {
+		group := make([]int, 0, bounds[k+1]-bounds[k])
+		for c := bounds[k]; c < bounds[k+1]; c++ {
+			group = append(group, c)
+		}
+		sort.SliceStable(group, func(i, j int) bool { return scores[group[i]] > scores[group[j]] })
+		for n, c := range group {
+			if n >= HardNegatives || scores[c] < HardNegativeMinScore {
+				break
+			}
+			sample.appendRow(x[c*sample.XCols:(c+1)*sample.XCols], 0, cands[c])
+			mined++
+		}
+	}
+	log.Infof("mined %d hard negatives for %d samples", mined, sample.Rows-mined)
+	return
+}
+
+// candidateItems returns up to n of items ok, sampled by intn if more
+func candidateItems(items []int, n int, intn func(int) int, ok func(item int) bool) (cands []int) {
+	if n >= len(items) {
+		for _, item := range items {
+			if ok(item) {
+				cands = append(cands, item)
+			}
+		}
+		return
+	}
+	picked := make(map[int]bool, n)
+	for try := 0; try < 2*n && len(cands) < n; try++ {
+		item := items[intn(len(items))]
+		if !picked[item] && ok(item) {
+			picked[item] = true
+			cands = append(cands, item)
+		}
+	}
+	return
+}
+
+// appendRow appends the dense row x of label y and key to sample, the
+// labels of the other tasks are y too
+func (sample *TrainSample) appendRow(x []float32, y float32, key SampleKey) {
+	sample.X = append(sample.X, x...)
+	sample.Y = append(sample.Y, y)
+	for t := 0; t < sample.Tasks; t++ {
+		sample.Labels = append(sample.Labels, y)
+	}
+	if len(sample.Keys) == sample.Rows {
+		sample.Keys = append(sample.Keys, key)
+	}
+	sample.Rows++
+}
+
+// fitSample fits mlp on sample as a BatchFitter, a SparseFitter or a
+// Fitter by the way of the sample
+func fitSample(ctx context.Context, mlp Fitter, sample *TrainSample) (pred PredictAbstract, err error) {
+	if batchFitter, ok := mlp.(BatchFitter); ok {
+		bp := NewMemBatchProvider(sample, MiniBatchSize, ShuffleBatches, trainSeedOf(ctx))
+		if pred, err = batchFitter.FitBatches(bp); err == nil {
+			err = bp.Err()
+		}
+		return
+	}
+	if sparseFitter, ok := mlp.(SparseFitter); ok && sample.Sparse != nil {
+		return sparseFitter.FitSparse(sample)
+	}
+	return mlp.Fit(sample)
+}
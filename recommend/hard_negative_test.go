@@ -0,0 +1,73 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// hardRecSys generates the positive of the item u and the negative of the
+// item u+100 of the users u of [0, 20)
+type hardRecSys struct {
+	idPredictor
+}
+
+func (hardRecSys) SampleGenerator(context.Context) (<-chan Sample, error) {
+	ch := make(chan Sample)
+	go func() {
+		defer close(ch)
+		for u := 0; u < 20; u++ {
+			ch <- Sample{UserId: u, ItemId: u, Label: 1}
+			ch <- Sample{UserId: u, ItemId: u + 100}
+		}
+	}()
+	return ch, nil
+}
+
+// passFitter records the samples of every pass
+type passFitter struct {
+	passes []*TrainSample
+}
+
+func (f *passFitter) Fit(sample *TrainSample) (PredictAbstract, error) {
+	f.passes = append(f.passes, sample)
+	return idPredictor{}, nil
+}
+
+func TestHardNegatives(t *testing.T) {
+	Convey("hard negative mining", t, func() {
+		resetFeatureCache()
+		HardNegatives, HardNegativeCandidates = 1, 100
+		defer func() { HardNegatives, HardNegativeCandidates = 0, 20 }()
+
+		fitter := &passFitter{}
+		result, err := TrainWithResult(context.Background(), hardRecSys{}, fitter)
+		So(err, ShouldBeNil)
+		So(result.SampleCount, ShouldEqual, 40)
+		So(fitter.passes, ShouldHaveLength, 2)
+		final := fitter.passes[1]
+		So(final.Rows, ShouldEqual, 60)
+		So(final.Keys, ShouldHaveLength, 60)
+		// idPredictor scores by the item id, the top unseen item is 119,
+		// or 118 for the user 19
+		for r := 40; r < 60; r++ {
+			So(final.Y[r], ShouldEqual, 0)
+			key := final.Keys[r]
+			if key.UserId == 19 {
+				So(key.ItemId, ShouldEqual, 118)
+			} else {
+				So(key.ItemId, ShouldEqual, 119)
+			}
+		}
+
+		Convey("min score", func() {
+			HardNegativeMinScore = 1000
+			defer func() { HardNegativeMinScore = 0.5 }()
+			fitter := &passFitter{}
+			_, err := TrainWithResult(context.Background(), hardRecSys{}, fitter)
+			So(err, ShouldBeNil)
+			So(fitter.passes[1].Rows, ShouldEqual, 40)
+		})
+	})
+}
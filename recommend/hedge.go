@@ -0,0 +1,176 @@
+package recommend
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Hedging sends a second attempt of the user and item feature fetches of the
+// predict stage if the first one is slower than the Quantile latency, which
+// cuts the tail latency against the replicated feature stores. nil means
+// disabled.
+var Hedging *HedgePolicy
+
+const hedgeWindow = 1024
+
+type HedgePolicy struct {
+	// atomic counters first for the alignment
+	fetches, hedged, hedgeWins uint64
+
+	// Delay before the second attempt, 0 means the Quantile of the latency of
+	// the recent fetches, no hedging until MinSamples are observed then
+	Delay      time.Duration
+	Quantile   float64
+	MinSamples int
+	// Budget caps the hedged attempts to the ratio of the fetches
+	Budget float64
+
+	sync.Mutex
+	latencies map[string]*latencyWindow
+}
+
+func NewHedgePolicy(budget float64) *HedgePolicy {
+	return &HedgePolicy{
+		Quantile:   0.95,
+		MinSamples: 100,
+		Budget:     budget,
+		latencies:  make(map[string]*latencyWindow),
+	}
+}
+
+// HedgeStats of a HedgePolicy, HedgeWins are the hedged attempts finished
+// before the first ones
+type HedgeStats struct {
+	Fetches   uint64 `json:"fetches"`
+	Hedged    uint64 `json:"hedged"`
+	HedgeWins uint64 `json:"hedgeWins"`
+}
+
+func (h *HedgePolicy) Stats() HedgeStats {
+	return HedgeStats{
+		Fetches:   atomic.LoadUint64(&h.fetches),
+		Hedged:    atomic.LoadUint64(&h.hedged),
+		HedgeWins: atomic.LoadUint64(&h.hedgeWins),
+	}
+}
+
+// latencyWindow keeps the recent latencies and their quantile, which is
+// recomputed every 64 observations
+type latencyWindow struct {
+	samples  [hedgeWindow]time.Duration
+	count    int
+	quantile time.Duration
+}
+
+func (w *latencyWindow) observe(d time.Duration, q float64) {
+	w.samples[w.count%hedgeWindow] = d
+	w.count++
+	if w.count%64 != 0 {
+		return
+	}
+	n := w.count
+	if n > hedgeWindow {
+		n = hedgeWindow
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	w.quantile = sorted[int(q*float64(n-1))]
+}
+
+// delay returns the delay of the hedged attempt of name, ok is false if the
+// fetch should not be hedged
+func (h *HedgePolicy) delay(name string) (delay time.Duration, ok bool) {
+	if float64(atomic.LoadUint64(&h.hedged)) >= h.Budget*float64(atomic.LoadUint64(&h.fetches)) {
+		return
+	}
+	if h.Delay > 0 {
+		return h.Delay, true
+	}
+	h.Lock()
+	defer h.Unlock()
+	w := h.latencies[name]
+	if w == nil || w.count < h.MinSamples || w.quantile <= 0 {
+		return
+	}
+	return w.quantile, true
+}
+
+func (h *HedgePolicy) observe(name string, d time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	w := h.latencies[name]
+	if w == nil {
+		w = &latencyWindow{}
+		h.latencies[name] = w
+	}
+	w.observe(d, h.Quantile)
+}
+
+type hedgeResult struct {
+	feature Tensor
+	err     error
+	hedged  bool
+}
+
+// hedgedFetch calls fetch, and calls it again if the first call does not
+// return within the delay of Hedging. The first success is returned and the
+// other call is cancelled.
+func hedgedFetch(ctx context.Context, name string, fetch func(ctx context.Context) (Tensor, error)) (Tensor, error) {
+	h := Hedging
+	if h == nil || !inStage(ctx, PredictStage) {
+		return fetch(ctx)
+	}
+	atomic.AddUint64(&h.fetches, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		start   = time.Now()
+		results = make(chan hedgeResult, 2)
+		launch  = func(hedged bool) {
+			go func() {
+				feature, err := fetch(ctx)
+				results <- hedgeResult{feature: feature, err: err, hedged: hedged}
+			}()
+		}
+		pending = 1
+		hedge   <-chan time.Time
+	)
+	launch(false)
+	if delay, ok := h.delay(name); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+	var err error
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			// check the budget again as other fetches may hedge meanwhile
+			if _, ok := h.delay(name); ok {
+				atomic.AddUint64(&h.hedged, 1)
+				pending++
+				launch(true)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				if r.hedged {
+					atomic.AddUint64(&h.hedgeWins, 1)
+				} else {
+					h.observe(name, time.Since(start))
+				}
+				return r.feature, nil
+			}
+			err = r.err
+			if pending == 0 {
+				return nil, err
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// replicaPredictor fetches the item features from 2 replicas in turn, the
+// first replica is slow
+type replicaPredictor struct {
+	idPredictor
+	calls *int64
+}
+
+func (p replicaPredictor) GetItemFeature(ctx context.Context, itemId int) (Tensor, error) {
+	if atomic.AddInt64(p.calls, 1)%2 == 1 {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return Tensor{float32(itemId)}, nil
+}
+
+func TestHedgedFetch(t *testing.T) {
+	defer func(h *HedgePolicy) { Hedging = h }(Hedging)
+
+	Convey("hedged item feature fetch", t, func() {
+		resetFeatureCache()
+		Hedging = NewHedgePolicy(1)
+		Hedging.Delay = 10 * time.Millisecond
+		start := time.Now()
+		scores, err := Rank(context.Background(), replicaPredictor{calls: new(int64)}, 1, []int{1, 2})
+		So(err, ShouldBeNil)
+		So(time.Since(start), ShouldBeLessThan, 150*time.Millisecond)
+		So(scores, ShouldResemble, []ItemScore{{ItemId: 1, Score: 1}, {ItemId: 2, Score: 2}})
+		stats := Hedging.Stats()
+		So(stats.Fetches, ShouldEqual, 3) // user 1, item 1, item 2
+		So(stats.Hedged, ShouldEqual, 2)
+		So(stats.HedgeWins, ShouldEqual, 2)
+	})
+
+	Convey("hedging budget", t, func() {
+		resetFeatureCache()
+		Hedging = NewHedgePolicy(0)
+		Hedging.Delay = 10 * time.Millisecond
+		start := time.Now()
+		_, err := Rank(context.Background(), replicaPredictor{calls: new(int64)}, 1, []int{1})
+		So(err, ShouldBeNil)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+		So(Hedging.Stats().Hedged, ShouldEqual, 0)
+	})
+
+	Convey("hedge after the latency quantile", t, func() {
+		Hedging = NewHedgePolicy(1)
+		fast := func(context.Context) (Tensor, error) { return Tensor{1}, nil }
+		Hedging.fetches = 1000
+		for i := 1; i <= 128; i++ {
+			if i == 100 {
+				_, ok := Hedging.delay(cacheItem)
+				So(ok, ShouldBeFalse)
+			}
+			Hedging.observe(cacheItem, time.Duration(i)*time.Millisecond)
+		}
+		delay, ok := Hedging.delay(cacheItem)
+		So(ok, ShouldBeTrue)
+		So(delay, ShouldEqual, 121*time.Millisecond)
+
+		// not hedged out of the predict stage
+		_, err := hedgedFetch(context.Background(), cacheItem, fast)
+		So(err, ShouldBeNil)
+		So(Hedging.Stats().Fetches, ShouldEqual, 1000)
+	})
+
+	Convey("both attempts fail", t, func() {
+		Hedging = NewHedgePolicy(1)
+		Hedging.Delay = time.Millisecond
+		ctx := WithStage(context.Background(), PredictStage)
+		var calls int64
+		_, err := hedgedFetch(ctx, cacheUser, func(context.Context) (Tensor, error) {
+			time.Sleep(5 * time.Millisecond)
+			return nil, errors.New("down" + string(rune('0'+atomic.AddInt64(&calls, 1))))
+		})
+		So(err, ShouldNotBeNil)
+		So(calls, ShouldEqual, 2)
+	})
+}
+
+func TestLatencyWindow(t *testing.T) {
+	Convey("latency quantile", t, func() {
+		w := &latencyWindow{}
+		for i := 1; i <= 100; i++ {
+			w.observe(time.Duration(i)*time.Millisecond, 0.95)
+		}
+		// computed at 64 observations
+		So(w.quantile, ShouldEqual, 60*time.Millisecond)
+		for i := 101; i <= 2000; i++ {
+			w.observe(time.Duration(i%100+1)*time.Millisecond, 0.5)
+		}
+		So(w.quantile, ShouldBeBetween, 45*time.Millisecond, 55*time.Millisecond)
+	})
+}
@@ -0,0 +1,92 @@
+package recommend
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RecommendHistory records what was recommended to each user and when,
+// nil means disabled.
+var RecommendHistory RecHistoryStore
+
+const defaultHistoryPerUser = 1000
+
+type RecRecord struct {
+	ItemId    int     `json:"itemId"`
+	Score     float32 `json:"score"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+type RecHistoryStore interface {
+	// Record appends the recommended items of userId at ts
+	Record(ctx context.Context, userId int, items []ItemScore, ts int64) error
+	// History returns the records of userId newer than or equal to since,
+	// in time desc order. since <= 0 means no limit.
+	History(ctx context.Context, userId int, since int64) ([]RecRecord, error)
+}
+
+// RecordHistory records items to RecommendHistory if it is set
+func RecordHistory(ctx context.Context, userId int, items []ItemScore) error {
+	if RecommendHistory == nil || len(items) == 0 {
+		return nil
+	}
+	return RecommendHistory.Record(ctx, userId, items, time.Now().Unix())
+}
+
+// MemRecHistory is an in memory RecHistoryStore keeping the latest
+// MaxPerUser records for every user
+type MemRecHistory struct {
+	sync.RWMutex
+	MaxPerUser int
+	records    map[int][]RecRecord // map[userId][]RecRecord in time asc order
+}
+
+func NewMemRecHistory(maxPerUser int) *MemRecHistory {
+	if maxPerUser <= 0 {
+		maxPerUser = defaultHistoryPerUser
+	}
+	return &MemRecHistory{
+		MaxPerUser: maxPerUser,
+		records:    make(map[int][]RecRecord),
+	}
+}
+
+func (h *MemRecHistory) Record(_ context.Context, userId int, items []ItemScore, ts int64) error {
+	h.Lock()
+	defer h.Unlock()
+	records := h.records[userId]
+	for _, item := range items {
+		records = append(records, RecRecord{
+			ItemId:    item.ItemId,
+			Score:     item.Score,
+			Timestamp: ts,
+		})
+	}
+	if len(records) > h.MaxPerUser {
+		// copy to release the underlying array of dropped records
+		records = append([]RecRecord(nil), records[len(records)-h.MaxPerUser:]...)
+	}
+	h.records[userId] = records
+	return nil
+}
+
+func (h *MemRecHistory) History(_ context.Context, userId int, since int64) (result []RecRecord, err error) {
+	h.RLock()
+	defer h.RUnlock()
+	records := h.records[userId]
+	for i := len(records) - 1; i >= 0; i-- {
+		if since > 0 && records[i].Timestamp < since {
+			break
+		}
+		result = append(result, records[i])
+	}
+	return
+}
+
+// Delete all the records of userId
+func (h *MemRecHistory) Delete(userId int) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.records, userId)
+}
@@ -0,0 +1,32 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemRecHistory(t *testing.T) {
+	Convey("bounded per user history", t, func() {
+		ctx := context.Background()
+		h := NewMemRecHistory(3)
+		So(h.Record(ctx, 1, []ItemScore{{ItemId: 1}, {ItemId: 2}}, 10), ShouldBeNil)
+		So(h.Record(ctx, 1, []ItemScore{{ItemId: 3}, {ItemId: 4}}, 20), ShouldBeNil)
+		records, err := h.History(ctx, 1, 0)
+		So(err, ShouldBeNil)
+		So(records, ShouldResemble, []RecRecord{
+			{ItemId: 4, Timestamp: 20},
+			{ItemId: 3, Timestamp: 20},
+			{ItemId: 2, Timestamp: 10},
+		})
+
+		records, err = h.History(ctx, 1, 15)
+		So(err, ShouldBeNil)
+		So(records, ShouldHaveLength, 2)
+
+		records, err = h.History(ctx, 2, 0)
+		So(err, ShouldBeNil)
+		So(records, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,216 @@
+package recommend
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// UserIds and ItemIds map the external user and item ids of the recommend
+	// api, see RecApiRequest.UserKey and RecApiRequest.ItemKeyList. nil means
+	// the api takes the internal ids only.
+	UserIds IdMapper
+	ItemIds IdMapper
+)
+
+// IdMapper maps the external ids, e.g. strings or UUIDs, to the dense
+// internal ints used as the user and item ids of this package, so that the
+// embeddings, the caches and the indexes keep working on ints
+type IdMapper interface {
+	// Map returns the internal id of ext, a new one is assigned if missing
+	Map(ext string) (id int, err error)
+	// Internal returns the internal id of ext
+	Internal(ext string) (id int, ok bool)
+	// External returns the external id of id
+	External(id int) (ext string, ok bool)
+}
+
+// DenseIdMapper is an IdMapper assigning the internal ids 1, 2, 3... in the
+// order of Map. It is persisted as the external ids one per line, the line
+// number is the internal id.
+type DenseIdMapper struct {
+	sync.RWMutex
+	ids  map[string]int
+	exts []string
+}
+
+func NewDenseIdMapper() *DenseIdMapper {
+	return &DenseIdMapper{ids: make(map[string]int)}
+}
+
+func (m *DenseIdMapper) Map(ext string) (id int, err error) {
+	if id, ok := m.Internal(ext); ok {
+		return id, nil
+	}
+	if ext == "" || strings.ContainsAny(ext, "\r\n") {
+		return 0, fmt.Errorf("invalid external id %q", ext)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if id, ok := m.ids[ext]; ok {
+		return id, nil
+	}
+	m.exts = append(m.exts, ext)
+	id = len(m.exts)
+	m.ids[ext] = id
+	return
+}
+
+func (m *DenseIdMapper) Internal(ext string) (id int, ok bool) {
+	m.RLock()
+	defer m.RUnlock()
+	id, ok = m.ids[ext]
+	return
+}
+
+func (m *DenseIdMapper) External(id int) (ext string, ok bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if id < 1 || id > len(m.exts) {
+		return
+	}
+	return m.exts[id-1], true
+}
+
+func (m *DenseIdMapper) Len() int {
+	m.RLock()
+	defer m.RUnlock()
+	return len(m.exts)
+}
+
+// WriteTo writes the external ids one per line
+func (m *DenseIdMapper) WriteTo(w io.Writer) (n int64, err error) {
+	m.RLock()
+	defer m.RUnlock()
+	bw := bufio.NewWriter(w)
+	for _, ext := range m.exts {
+		nn, er := bw.WriteString(ext + "\n")
+		n += int64(nn)
+		if er != nil {
+			return n, er
+		}
+	}
+	return n, bw.Flush()
+}
+
+// ReadDenseIdMapper reads the DenseIdMapper written by WriteTo
+func ReadDenseIdMapper(r io.Reader) (m *DenseIdMapper, err error) {
+	m = NewDenseIdMapper()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		ext := scanner.Text()
+		if _, dup := m.ids[ext]; dup || ext == "" {
+			return nil, fmt.Errorf("bad external id %q at line %d", ext, len(m.exts)+1)
+		}
+		m.exts = append(m.exts, ext)
+		m.ids[ext] = len(m.exts)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// SaveDenseIdMapper saves m to path atomically
+func SaveDenseIdMapper(path string, m *DenseIdMapper) (err error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	if _, err = m.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadDenseIdMapper loads the DenseIdMapper saved to path
+func LoadDenseIdMapper(path string) (m *DenseIdMapper, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return ReadDenseIdMapper(f)
+}
+
+// MappedItemEmbedding is an ItemEmbedding mapping the external item ids of
+// the sequence of Items to the internal ids of Mapper, so the item embedding
+// is keyed by the internal ids as GetSampleVector looks up
+type MappedItemEmbedding struct {
+	Items  ItemEmbedding
+	Mapper IdMapper
+}
+
+func (m *MappedItemEmbedding) ItemSeqGenerator(ctx context.Context) (<-chan string, error) {
+	extCh, err := m.Items.ItemSeqGenerator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan string, 1000)
+	go func() {
+		defer close(ch)
+		for ext := range extCh {
+			id, err := m.Mapper.Map(ext)
+			if err != nil {
+				log.Errorf("map item %q error: %v", ext, err)
+				continue
+			}
+			select {
+			case ch <- strconv.Itoa(id):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// mapRequestIds maps the external ids of req to the internal ones
+func mapRequestIds(req *RecApiRequest) (err error) {
+	if req.UserKey != "" {
+		if UserIds == nil {
+			return fmt.Errorf("userKey is not supported without UserIds")
+		}
+		// an unknown user is a cold start as the user 0, the request must
+		// not grow UserIds
+		req.UserId, _ = UserIds.Internal(req.UserKey)
+	}
+	if len(req.ItemKeyList) != 0 {
+		if ItemIds == nil {
+			return fmt.Errorf("itemKeyList is not supported without ItemIds")
+		}
+		for _, key := range req.ItemKeyList {
+			id, ok := ItemIds.Internal(key)
+			if !ok {
+				return fmt.Errorf("unknown item %q", key)
+			}
+			req.ItemIdList = append(req.ItemIdList, id)
+		}
+	}
+	return
+}
+
+// externalItemKeys fills the ItemKey of the itemScores if ItemIds is set
+func externalItemKeys(itemScores []ItemScore) {
+	if ItemIds == nil {
+		return
+	}
+	for i := range itemScores {
+		itemScores[i].ItemKey, _ = ItemIds.External(itemScores[i].ItemId)
+	}
+}
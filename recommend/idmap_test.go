@@ -0,0 +1,111 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// stringItemSeq is an ItemEmbedding of the external item ids
+type stringItemSeq []string
+
+func (s stringItemSeq) ItemSeqGenerator(ctx context.Context) (<-chan string, error) {
+	ch := make(chan string, len(s))
+	for _, ext := range s {
+		ch <- ext
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestDenseIdMapper(t *testing.T) {
+	Convey("dense id mapper", t, func() {
+		m := NewDenseIdMapper()
+		a, err := m.Map("a7f3-uuid")
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, 1)
+		b, _ := m.Map("b")
+		So(b, ShouldEqual, 2)
+		again, _ := m.Map("a7f3-uuid")
+		So(again, ShouldEqual, a)
+		_, err = m.Map("bad\nid")
+		So(err, ShouldNotBeNil)
+
+		ext, ok := m.External(2)
+		So(ok, ShouldBeTrue)
+		So(ext, ShouldEqual, "b")
+		_, ok = m.External(3)
+		So(ok, ShouldBeFalse)
+		_, ok = m.Internal("c")
+		So(ok, ShouldBeFalse)
+
+		Convey("persistence", func() {
+			var buf bytes.Buffer
+			_, err := m.WriteTo(&buf)
+			So(err, ShouldBeNil)
+			loaded, err := ReadDenseIdMapper(&buf)
+			So(err, ShouldBeNil)
+			So(loaded.Len(), ShouldEqual, 2)
+			id, _ := loaded.Internal("b")
+			So(id, ShouldEqual, 2)
+
+			path := filepath.Join(t.TempDir(), "items.ids")
+			So(SaveDenseIdMapper(path, m), ShouldBeNil)
+			loaded, err = LoadDenseIdMapper(path)
+			So(err, ShouldBeNil)
+			ext, _ := loaded.External(1)
+			So(ext, ShouldEqual, "a7f3-uuid")
+
+			_, err = ReadDenseIdMapper(bytes.NewBufferString("a\nb\na\n"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("mapped item embedding", func() {
+			seq := &MappedItemEmbedding{Items: stringItemSeq{"b", "c", "a7f3-uuid"}, Mapper: m}
+			ch, err := seq.ItemSeqGenerator(context.Background())
+			So(err, ShouldBeNil)
+			var words []string
+			for w := range ch {
+				words = append(words, w)
+			}
+			So(words, ShouldResemble, []string{"2", "3", "1"})
+		})
+	})
+}
+
+func TestApiIdMapping(t *testing.T) {
+	defer func(u, i IdMapper) { UserIds, ItemIds = u, i }(UserIds, ItemIds)
+
+	Convey("api with external ids", t, func() {
+		resetFeatureCache()
+		ctx := context.Background()
+		_, code, err := serveRecRequest(ctx, idPredictor{}, RecApiRequest{UserKey: "u1", ItemIdList: []int{1}})
+		So(err, ShouldNotBeNil)
+		So(code, ShouldEqual, 400)
+
+		users, items := NewDenseIdMapper(), NewDenseIdMapper()
+		UserIds, ItemIds = users, items
+		users.Map("u0")
+		items.Map("item-x")
+		items.Map("item-y")
+		resp, code, err := serveRecRequest(ctx, idPredictor{}, RecApiRequest{UserKey: "u1", ItemKeyList: []string{"item-y", "item-x"}})
+		So(err, ShouldBeNil)
+		So(code, ShouldEqual, 200)
+		So(resp.ItemScoreList, ShouldHaveLength, 2)
+		So(resp.ItemScoreList[0].ItemKey, ShouldEqual, "item-y")
+		So(resp.ItemScoreList[0].ItemId, ShouldEqual, 2)
+		// the unknown user is a cold start, not mapped
+		_, ok := users.Internal("u1")
+		So(ok, ShouldBeFalse)
+		req := RecApiRequest{UserKey: "u0"}
+		So(mapRequestIds(&req), ShouldBeNil)
+		So(req.UserId, ShouldEqual, 1)
+
+		_, code, err = serveRecRequest(ctx, idPredictor{}, RecApiRequest{UserKey: "u1", ItemKeyList: []string{"item-z"}})
+		So(err, ShouldNotBeNil)
+		So(code, ShouldEqual, 400)
+	})
+}
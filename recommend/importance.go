@@ -0,0 +1,158 @@
+package recommend
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+var (
+	// ImportanceRows is the rows held out from Fit as the validation slice to
+	// compute the permutation FeatureImportance, 0 disables it.
+	ImportanceRows = 0
+	// ImportanceSeed is the seed to permute the features
+	ImportanceSeed int64 = 42
+)
+
+// RangeImportance is the permutation importance of a SampleInfo range
+type RangeImportance struct {
+	Name       string  `json:"name"`
+	Range      [2]int  `json:"range"`
+	Importance float32 `json:"importance"`
+}
+
+// featureRanges returns the named ranges of info, Importance is 0
+func featureRanges(info SampleInfo) []RangeImportance {
+	ranges := []RangeImportance{
+		{Name: "UserProfile", Range: info.UserProfileRange},
+		{Name: "UserBehavior", Range: info.UserBehaviorRange},
+		{Name: "ItemEmbedding", Range: info.ItemFeatureRange},
+		{Name: "ItemFeature", Range: info.CtxFeatureRange},
+	}
+	for _, ch := range info.BehaviorChannelRanges {
+		ranges = append(ranges, RangeImportance{Name: "Behavior:" + ch.Name, Range: ch.Range})
+	}
+	if info.RequestCtxRange[1] > info.RequestCtxRange[0] {
+		ranges = append(ranges, RangeImportance{Name: "RequestCtx", Range: info.RequestCtxRange})
+	}
+	if info.SparseRange[1] > info.SparseRange[0] {
+		ranges = append(ranges, RangeImportance{Name: "Sparse", Range: info.SparseRange})
+	}
+	return ranges
+}
+
+// FeatureImportance is the AUC drop on the validation slice when a feature
+// or a range of features is permuted among the rows. Features with near 0
+// or negative importance contribute nothing and could be pruned. For
+// ObjectiveRegression BaseAuc is the negative RMSE and the importance is
+// the RMSE increase.
+type FeatureImportance struct {
+	Rows       int               `json:"rows"`
+	BaseAuc    float32           `json:"baseAuc"`
+	PerFeature []float32         `json:"perFeature"`
+	PerRange   []RangeImportance `json:"perRange"`
+}
+
+// TrainResult is returned by TrainWithResult
+type TrainResult struct {
+	Model Predictor
+	// Version is the model version of WithModelVersion, or the start time of
+	// Train, recorded in ModelHistory
+	Version string
+	// Fitted is the PredictAbstract returned by the Fitter
+	Fitted PredictAbstract
+	// Schema is the FeatureSchema of the SchemaProvider trained with
+	Schema      *FeatureSchema
+	SampleInfo  SampleInfo
+	SampleCount int
+	// FeatureImportance is nil if ImportanceRows is 0 or the Fitter is a
+	// StreamFitter
+	FeatureImportance *FeatureImportance
+	// Eval is the EvalMetrics on the ImportanceRows held out, nil if none
+	Eval *EvalMetrics
+	// DriftBaseline is the distribution of the training rows to monitor the
+	// served ones against, nil if DriftBaselineRows is 0 or the Fitter is a
+	// StreamFitter
+	DriftBaseline *DriftBaseline
+}
+
+// splitValidation splits the last rows of sample as the validation slice
+func splitValidation(sample *TrainSample, rows int) (train, valid *TrainSample) {
+	if rows >= sample.Rows {
+		rows = sample.Rows / 2
+	}
+	split := sample.Rows - rows
+	train = &TrainSample{
+		X:     sample.X[:split*sample.XCols],
+		Y:     sample.Y[:split],
+		Rows:  split,
+		XCols: sample.XCols,
+		Info:  sample.Info,
+	}
+	valid = &TrainSample{
+		X:     sample.X[split*sample.XCols:],
+		Y:     sample.Y[split:],
+		Rows:  rows,
+		XCols: sample.XCols,
+		Info:  sample.Info,
+	}
+	if len(sample.Keys) == sample.Rows {
+		train.Keys, valid.Keys = sample.Keys[:split], sample.Keys[split:]
+	}
+	if sample.Tasks != 0 {
+		train.Tasks, train.Labels = sample.Tasks, sample.Labels[:split*sample.Tasks]
+		valid.Tasks, valid.Labels = sample.Tasks, sample.Labels[split*sample.Tasks:]
+	}
+	return
+}
+
+// PermutationImportance computes the FeatureImportance of pred on valid
+func PermutationImportance(pred PredictAbstract, valid *TrainSample, seed int64) (fi *FeatureImportance, err error) {
+	if valid.Rows < 2 {
+		err = fmt.Errorf("too few validation rows: %d", valid.Rows)
+		return
+	}
+	var (
+		r    = rand.New(rand.NewSource(seed))
+		x    = make([]float32, len(valid.X))
+		perm = make([]int, valid.Rows)
+	)
+	auc := func(cols [2]int) (a float32, er error) {
+		copy(x, valid.X)
+		if cols[1] > cols[0] {
+			for i, p := range r.Perm(valid.Rows) {
+				perm[i] = p
+			}
+			for i := 0; i < valid.Rows; i++ {
+				copy(x[i*valid.XCols+cols[0]:i*valid.XCols+cols[1]],
+					valid.X[perm[i]*valid.XCols+cols[0]:perm[i]*valid.XCols+cols[1]])
+			}
+		}
+		yPred, er := predictColumn(pred, x, valid.Rows, valid.XCols)
+		if er != nil {
+			return
+		}
+		return evalScore(yPred, valid.Y), nil
+	}
+
+	fi = &FeatureImportance{Rows: valid.Rows}
+	if fi.BaseAuc, err = auc([2]int{}); err != nil {
+		return nil, err
+	}
+	fi.PerFeature = make([]float32, valid.XCols)
+	for j := 0; j < valid.XCols; j++ {
+		var a float32
+		if a, err = auc([2]int{j, j + 1}); err != nil {
+			return nil, err
+		}
+		fi.PerFeature[j] = fi.BaseAuc - a
+	}
+	for _, ri := range featureRanges(valid.Info) {
+		var a float32
+		if a, err = auc(ri.Range); err != nil {
+			return nil, err
+		}
+		ri.Importance = fi.BaseAuc - a
+		fi.PerRange = append(fi.PerRange, ri)
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// idRecSys generates samples labeled by itemId >= 50
+type idRecSys struct {
+	idPredictor
+}
+
+func (idRecSys) SampleGenerator(context.Context) (<-chan Sample, error) {
+	ch := make(chan Sample)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 1000; i++ {
+			s := Sample{UserId: i % 7, ItemId: i % 100}
+			if s.ItemId >= 50 {
+				s.Label = 1
+			}
+			ch <- s
+		}
+	}()
+	return ch, nil
+}
+
+type idFitter struct {
+	rows int
+}
+
+func (f *idFitter) Fit(sample *TrainSample) (PredictAbstract, error) {
+	f.rows = sample.Rows
+	return idPredictor{}, nil
+}
+
+func TestFeatureImportance(t *testing.T) {
+	Convey("permutation feature importance", t, func() {
+		resetFeatureCache()
+		ImportanceRows = 200
+		defer func() { ImportanceRows = 0 }()
+		fitter := &idFitter{}
+		result, err := TrainWithResult(context.Background(), idRecSys{}, fitter)
+		So(err, ShouldBeNil)
+		So(result.SampleCount, ShouldEqual, 1000)
+		So(fitter.rows, ShouldEqual, 800)
+
+		fi := result.FeatureImportance
+		So(fi, ShouldNotBeNil)
+		So(fi.Rows, ShouldEqual, 200)
+		So(fi.BaseAuc, ShouldEqual, 1)
+		So(fi.PerFeature, ShouldHaveLength, result.SampleInfo.CtxFeatureRange[1])
+		So(fi.PerFeature[0], ShouldEqual, 0)
+		So(fi.PerFeature[result.SampleInfo.CtxFeatureRange[0]], ShouldBeGreaterThan, 0.3)
+		for _, ri := range fi.PerRange {
+			if ri.Name == "ItemFeature" {
+				So(ri.Importance, ShouldBeGreaterThan, 0.3)
+			} else {
+				So(ri.Importance, ShouldEqual, 0)
+			}
+		}
+	})
+}
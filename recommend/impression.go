@@ -0,0 +1,165 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Impressions records the items served by the recommend api for the
+// FrequencyCap, nil means disabled
+var Impressions ImpressionStore
+
+const defaultImpressionMaxAge = 7 * 24 * time.Hour
+
+// ImpressionStore keeps the items shown to the users and when, see
+// MemImpressionStore and RedisImpressionStore
+type ImpressionStore interface {
+	// RecordImpressions records the itemIds shown to userId at ts
+	RecordImpressions(ctx context.Context, userId int, itemIds []int, ts int64) error
+	// CountImpressions returns the times every one of itemIds is shown to
+	// userId at or after since
+	CountImpressions(ctx context.Context, userId int, itemIds []int, since int64) (counts []int, err error)
+}
+
+// RecordImpressions records the items to Impressions if it is set
+func RecordImpressions(ctx context.Context, userId int, items []ItemScore) error {
+	if Impressions == nil || len(items) == 0 {
+		return nil
+	}
+	itemIds := make([]int, len(items))
+	for i, item := range items {
+		itemIds[i] = item.ItemId
+	}
+	return Impressions.RecordImpressions(ctx, userId, itemIds, time.Now().Unix())
+}
+
+// FrequencyCap demotes the items shown to the user maxShown times or more
+// in the last window by multiplying their scores by demote, they are
+// dropped if demote is 0. The impressions are of store, or of Impressions
+// if nil. On the store error the items are kept as is.
+func FrequencyCap(store ImpressionStore, maxShown int, window time.Duration, demote float32) PostRanker {
+	return PostRankFunc(func(ctx context.Context, userId int, itemScores []ItemScore) ([]ItemScore, error) {
+		s := store
+		if s == nil {
+			s = Impressions
+		}
+		if s == nil || len(itemScores) == 0 {
+			return itemScores, nil
+		}
+		itemIds := make([]int, len(itemScores))
+		for i, is := range itemScores {
+			itemIds[i] = is.ItemId
+		}
+		counts, err := s.CountImpressions(ctx, userId, itemIds, time.Now().Add(-window).Unix())
+		if err == nil && len(counts) != len(itemIds) {
+			err = fmt.Errorf("%d counts of %d items", len(counts), len(itemIds))
+		}
+		if err != nil {
+			logOf(ctx).Warnf("count impressions of user %d error: %v", userId, err)
+			return itemScores, nil
+		}
+		result := itemScores[:0]
+		for i, is := range itemScores {
+			if counts[i] >= maxShown {
+				if demote == 0 {
+					continue
+				}
+				is.Score *= demote
+			}
+			result = append(result, is)
+		}
+		return result, nil
+	})
+}
+
+// MemImpressionStore is an in memory ImpressionStore keeping the
+// impressions of MaxAge, the users and items of no impression in MaxAge are
+// evicted every MaxAge/2 of the recorded time
+type MemImpressionStore struct {
+	sync.RWMutex
+	MaxAge      time.Duration
+	impressions map[int]map[int][]int64 // map[userId]map[itemId][]ts in time asc order
+	swept       int64                   // the ts of the last eviction
+}
+
+func NewMemImpressionStore(maxAge time.Duration) *MemImpressionStore {
+	if maxAge <= 0 {
+		maxAge = defaultImpressionMaxAge
+	}
+	return &MemImpressionStore{
+		MaxAge:      maxAge,
+		impressions: make(map[int]map[int][]int64),
+	}
+}
+
+func (s *MemImpressionStore) RecordImpressions(_ context.Context, userId int, itemIds []int, ts int64) error {
+	s.Lock()
+	defer s.Unlock()
+	maxAge := int64(s.MaxAge / time.Second)
+	expired := ts - maxAge
+	if s.swept == 0 {
+		s.swept = ts
+	} else if ts-s.swept >= maxAge/2 {
+		s.evict(expired)
+		s.swept = ts
+	}
+	items := s.impressions[userId]
+	if items == nil {
+		items = make(map[int][]int64)
+		s.impressions[userId] = items
+	}
+	for _, itemId := range itemIds {
+		tss := items[itemId]
+		var drop int
+		for drop < len(tss) && tss[drop] < expired {
+			drop++
+		}
+		tss = append(tss[drop:], ts)
+		if n := len(tss); n > 1 && tss[n-2] > ts {
+			// keep the time order of the out of order impressions
+			for i := n - 1; i > 0 && tss[i-1] > tss[i]; i-- {
+				tss[i-1], tss[i] = tss[i], tss[i-1]
+			}
+		}
+		items[itemId] = tss
+	}
+	return nil
+}
+
+func (s *MemImpressionStore) CountImpressions(_ context.Context, userId int, itemIds []int, since int64) (counts []int, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	counts = make([]int, len(itemIds))
+	items := s.impressions[userId]
+	for i, itemId := range itemIds {
+		for _, ts := range items[itemId] {
+			if ts >= since {
+				counts[i]++
+			}
+		}
+	}
+	return
+}
+
+// evict drops the impressions before expired and the users and items left
+// of none
+func (s *MemImpressionStore) evict(expired int64) {
+	for userId, items := range s.impressions {
+		for itemId, tss := range items {
+			var drop int
+			for drop < len(tss) && tss[drop] < expired {
+				drop++
+			}
+			if drop == len(tss) {
+				delete(items, itemId)
+			} else if drop != 0 {
+				items[itemId] = append(tss[:0], tss[drop:]...)
+			}
+		}
+		if len(items) == 0 {
+			delete(s.impressions, userId)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package recommend
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultImpressionKeyPrefix = "ctr:imp"
+	defaultRedisTimeout        = time.Second
+	defaultRedisPoolSize       = 8
+)
+
+// impressionNode tells the impressions recorded by this process from the
+// ones of the other nodes of the same second
+var impressionNode = func() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}()
+
+// RedisImpressionStore is an ImpressionStore of Redis, the impressions of
+// every user and item are a sorted set of the times keyed by
+// KeyPrefix:userId:itemId, expiring in MaxAge. It speaks the RESP protocol
+// itself to need no Redis client dependency.
+type RedisImpressionStore struct {
+	Addr     string
+	Password string
+	DB       int
+	// KeyPrefix of the sorted sets, default "ctr:imp"
+	KeyPrefix string
+	MaxAge    time.Duration
+	// Timeout of a round trip if the ctx has no deadline, default 1s
+	Timeout time.Duration
+
+	pool chan *redisConn
+	seq  uint64
+}
+
+func NewRedisImpressionStore(addr, password string, db int, maxAge time.Duration) *RedisImpressionStore {
+	if maxAge <= 0 {
+		maxAge = defaultImpressionMaxAge
+	}
+	return &RedisImpressionStore{
+		Addr:      addr,
+		Password:  password,
+		DB:        db,
+		KeyPrefix: defaultImpressionKeyPrefix,
+		MaxAge:    maxAge,
+		Timeout:   defaultRedisTimeout,
+		pool:      make(chan *redisConn, defaultRedisPoolSize),
+	}
+}
+
+func (s *RedisImpressionStore) key(userId, itemId int) string {
+	prefix := s.KeyPrefix
+	if prefix == "" {
+		prefix = defaultImpressionKeyPrefix
+	}
+	return prefix + ":" + strconv.Itoa(userId) + ":" + strconv.Itoa(itemId)
+}
+
+func (s *RedisImpressionStore) RecordImpressions(ctx context.Context, userId int, itemIds []int, ts int64) error {
+	if len(itemIds) == 0 {
+		return nil
+	}
+	maxAge := int64(s.MaxAge / time.Second)
+	if maxAge <= 0 {
+		maxAge = int64(defaultImpressionMaxAge / time.Second)
+	}
+	var (
+		score   = strconv.FormatInt(ts, 10)
+		expired = "(" + strconv.FormatInt(ts-maxAge, 10)
+		ttl     = strconv.FormatInt(maxAge, 10)
+		cmds    = make([][]string, 0, 3*len(itemIds))
+	)
+	for _, itemId := range itemIds {
+		key := s.key(userId, itemId)
+		// the member is unique for the impressions of the same second of
+		// all the nodes
+		member := score + ":" + impressionNode + ":" + strconv.FormatUint(atomic.AddUint64(&s.seq, 1), 10)
+		cmds = append(cmds,
+			[]string{"ZADD", key, score, member},
+			[]string{"ZREMRANGEBYSCORE", key, "-inf", expired},
+			[]string{"EXPIRE", key, ttl},
+		)
+	}
+	_, err := s.do(ctx, cmds)
+	return err
+}
+
+func (s *RedisImpressionStore) CountImpressions(ctx context.Context, userId int, itemIds []int, since int64) (counts []int, err error) {
+	if len(itemIds) == 0 {
+		return []int{}, nil
+	}
+	min := strconv.FormatInt(since, 10)
+	cmds := make([][]string, len(itemIds))
+	for i, itemId := range itemIds {
+		cmds[i] = []string{"ZCOUNT", s.key(userId, itemId), min, "+inf"}
+	}
+	replies, err := s.do(ctx, cmds)
+	if err != nil {
+		return
+	}
+	counts = make([]int, len(itemIds))
+	for i, reply := range replies {
+		n, ok := reply.(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected ZCOUNT reply %v", reply)
+		}
+		counts[i] = int(n)
+	}
+	return
+}
+
+// Close closes the idle connections
+func (s *RedisImpressionStore) Close() error {
+	for {
+		select {
+		case rc := <-s.pool:
+			rc.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// redisConn is a connection of the RESP protocol
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// redisError is an error reply of Redis, the connection is still usable
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do pipelines cmds in a round trip and returns their replies, an error
+// reply of any of them is returned as the error
+func (s *RedisImpressionStore) do(ctx context.Context, cmds [][]string) (replies []interface{}, err error) {
+	rc, err := s.conn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		var re redisError
+		if err != nil && !errors.As(err, &re) {
+			rc.Close()
+			return
+		}
+		s.release(rc)
+	}()
+	if err = rc.SetDeadline(s.deadline(ctx)); err != nil {
+		return
+	}
+	for _, cmd := range cmds {
+		rc.writeCommand(cmd)
+	}
+	if err = rc.w.Flush(); err != nil {
+		return
+	}
+	replies = make([]interface{}, len(cmds))
+	var replyErr error
+	for i := range cmds {
+		if replies[i], err = rc.readReply(); err != nil {
+			var re redisError
+			if !errors.As(err, &re) {
+				return nil, err
+			}
+			// read the rest replies to keep the connection usable
+			replyErr, err = err, nil
+		}
+	}
+	if replyErr != nil {
+		return nil, replyErr
+	}
+	return
+}
+
+func (s *RedisImpressionStore) deadline(ctx context.Context) time.Time {
+	if d, ok := ctx.Deadline(); ok {
+		return d
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultRedisTimeout
+	}
+	return time.Now().Add(timeout)
+}
+
+func (s *RedisImpressionStore) conn(ctx context.Context) (rc *redisConn, err error) {
+	select {
+	case rc = <-s.pool:
+		return
+	default:
+	}
+	dialer := net.Dialer{Deadline: s.deadline(ctx)}
+	c, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return
+	}
+	rc = &redisConn{Conn: c, r: bufio.NewReader(c), w: bufio.NewWriter(c)}
+	var setup [][]string
+	if s.Password != "" {
+		setup = append(setup, []string{"AUTH", s.Password})
+	}
+	if s.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.DB)})
+	}
+	if len(setup) == 0 {
+		return
+	}
+	if err = rc.SetDeadline(s.deadline(ctx)); err == nil {
+		for _, cmd := range setup {
+			rc.writeCommand(cmd)
+		}
+		err = rc.w.Flush()
+		for range setup {
+			if err != nil {
+				break
+			}
+			_, err = rc.readReply()
+		}
+	}
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return
+}
+
+func (s *RedisImpressionStore) release(rc *redisConn) {
+	if s.pool == nil {
+		rc.Close()
+		return
+	}
+	select {
+	case s.pool <- rc:
+	default:
+		rc.Close()
+	}
+}
+
+func (rc *redisConn) writeCommand(args []string) {
+	rc.w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		rc.w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		rc.w.WriteString(arg)
+		rc.w.WriteString("\r\n")
+	}
+}
+
+// readReply reads a reply, the simple string and the bulk string are
+// string, the integer is int64 and the array is []interface{}
+func (rc *redisConn) readReply() (reply interface{}, err error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		var n int
+		if n, err = strconv.Atoi(line[1:]); err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(rc.r, buf); err != nil {
+			return
+		}
+		return string(buf[:n]), nil
+	case '*':
+		var n int
+		if n, err = strconv.Atoi(line[1:]); err != nil || n < 0 {
+			return nil, err
+		}
+		var (
+			elems   = make([]interface{}, n)
+			elemErr error
+		)
+		for i := range elems {
+			if elems[i], err = rc.readReply(); err != nil {
+				var re redisError
+				if !errors.As(err, &re) {
+					return nil, err
+				}
+				elemErr, err = err, nil
+			}
+		}
+		return elems, elemErr
+	}
+	return nil, fmt.Errorf("unknown redis reply %q", line)
+}
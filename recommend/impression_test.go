@@ -0,0 +1,246 @@
+package recommend
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemImpressionStore(t *testing.T) {
+	Convey("count the impressions in the window", t, func() {
+		ctx := context.Background()
+		s := NewMemImpressionStore(100 * time.Second)
+		So(s.RecordImpressions(ctx, 1, []int{1, 2}, 1000), ShouldBeNil)
+		So(s.RecordImpressions(ctx, 1, []int{1}, 1050), ShouldBeNil)
+		So(s.RecordImpressions(ctx, 1, []int{1}, 1020), ShouldBeNil)
+		counts, err := s.CountImpressions(ctx, 1, []int{1, 2, 3}, 0)
+		So(err, ShouldBeNil)
+		So(counts, ShouldResemble, []int{3, 1, 0})
+		counts, err = s.CountImpressions(ctx, 1, []int{1, 2}, 1010)
+		So(err, ShouldBeNil)
+		So(counts, ShouldResemble, []int{2, 0})
+
+		// the impressions older than MaxAge are pruned
+		So(s.RecordImpressions(ctx, 1, []int{1}, 1110), ShouldBeNil)
+		counts, err = s.CountImpressions(ctx, 1, []int{1}, 0)
+		So(err, ShouldBeNil)
+		So(counts, ShouldResemble, []int{3})
+
+		counts, err = s.CountImpressions(ctx, 2, []int{1}, 0)
+		So(err, ShouldBeNil)
+		So(counts, ShouldResemble, []int{0})
+
+		// the stale users and items are evicted
+		So(s.impressions[1], ShouldHaveLength, 1)
+		So(s.RecordImpressions(ctx, 2, []int{1}, 1300), ShouldBeNil)
+		So(s.impressions, ShouldHaveLength, 1)
+		So(s.impressions[2], ShouldHaveLength, 1)
+	})
+}
+
+func TestFrequencyCap(t *testing.T) {
+	Convey("frequency cap", t, func() {
+		ctx := context.Background()
+		s := NewMemImpressionStore(0)
+		now := time.Now().Unix()
+		So(s.RecordImpressions(ctx, 1, []int{1, 2}, now), ShouldBeNil)
+		So(s.RecordImpressions(ctx, 1, []int{1}, now), ShouldBeNil)
+		So(s.RecordImpressions(ctx, 1, []int{3}, now-2*3600), ShouldBeNil)
+		So(s.RecordImpressions(ctx, 1, []int{3}, now-2*3600), ShouldBeNil)
+		items := func() []ItemScore {
+			return []ItemScore{{ItemId: 1, Score: 1}, {ItemId: 2, Score: 1}, {ItemId: 3, Score: 1}}
+		}
+
+		Convey("remove", func() {
+			got, err := FrequencyCap(s, 2, time.Hour, 0).PostRank(ctx, 1, items())
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, []ItemScore{{ItemId: 2, Score: 1}, {ItemId: 3, Score: 1}})
+		})
+
+		Convey("demote", func() {
+			got, err := FrequencyCap(s, 1, time.Hour, 0.5).PostRank(ctx, 1, items())
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, []ItemScore{{ItemId: 1, Score: 0.5}, {ItemId: 2, Score: 0.5}, {ItemId: 3, Score: 1}})
+		})
+
+		Convey("counts mismatch", func() {
+			got, err := FrequencyCap(shortImpressionStore{s}, 2, time.Hour, 0).PostRank(ctx, 1, items())
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, items())
+		})
+
+		Convey("default store", func() {
+			defer func() { Impressions = nil }()
+			got, err := FrequencyCap(nil, 2, 3*time.Hour, 0).PostRank(ctx, 1, items())
+			So(err, ShouldBeNil)
+			So(got, ShouldHaveLength, 3)
+
+			Impressions = s
+			got, err = FrequencyCap(nil, 2, 3*time.Hour, 0).PostRank(ctx, 1, items())
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, []ItemScore{{ItemId: 2, Score: 1}})
+
+			So(RecordImpressions(ctx, 1, []ItemScore{{ItemId: 2}}), ShouldBeNil)
+			got, err = FrequencyCap(nil, 2, 3*time.Hour, 0).PostRank(ctx, 1, items())
+			So(err, ShouldBeNil)
+			So(got, ShouldBeEmpty)
+		})
+	})
+}
+
+// shortImpressionStore returns a count less than the items
+type shortImpressionStore struct {
+	ImpressionStore
+}
+
+func (s shortImpressionStore) CountImpressions(ctx context.Context, userId int, itemIds []int, since int64) ([]int, error) {
+	counts, err := s.ImpressionStore.CountImpressions(ctx, userId, itemIds, since)
+	return counts[:len(counts)-1], err
+}
+
+// fakeRedis serves the sorted set commands of RedisImpressionStore
+type fakeRedis struct {
+	sync.Mutex
+	zsets    map[string]map[string]int64
+	commands []string
+}
+
+func (f *fakeRedis) serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(c)
+	}
+}
+
+func (f *fakeRedis) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ = r.ReadString('\n')
+			l, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			buf := make([]byte, l+2)
+			if _, err = io.ReadFull(r, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:l])
+		}
+		c.Write([]byte(f.exec(args)))
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.Lock()
+	defer f.Unlock()
+	f.commands = append(f.commands, args[0])
+	score := func(s string) int64 {
+		switch s {
+		case "-inf":
+			return -1 << 62
+		case "+inf":
+			return 1 << 62
+		}
+		if strings.HasPrefix(s, "(") {
+			v, _ := strconv.ParseInt(s[1:], 10, 64)
+			return v - 1
+		}
+		v, _ := strconv.ParseInt(s, 10, 64)
+		return v
+	}
+	switch args[0] {
+	case "AUTH":
+		if args[1] != "secret" {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "ZADD":
+		if f.zsets[args[1]] == nil {
+			f.zsets[args[1]] = make(map[string]int64)
+		}
+		f.zsets[args[1]][args[3]] = score(args[2])
+		return ":1\r\n"
+	case "ZREMRANGEBYSCORE":
+		var n int
+		for m, s := range f.zsets[args[1]] {
+			if s >= score(args[2]) && s <= score(args[3]) {
+				delete(f.zsets[args[1]], m)
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	case "EXPIRE":
+		return ":1\r\n"
+	case "ZCOUNT":
+		var n int
+		for _, s := range f.zsets[args[1]] {
+			if s >= score(args[2]) && s <= score(args[3]) {
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func TestRedisImpressionStore(t *testing.T) {
+	Convey("redis impression store", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		f := &fakeRedis{zsets: make(map[string]map[string]int64)}
+		go f.serve(l)
+
+		ctx := context.Background()
+		s := NewRedisImpressionStore(l.Addr().String(), "secret", 0, 100*time.Second)
+		defer s.Close()
+		So(s.RecordImpressions(ctx, 1, []int{1, 2}, 1000), ShouldBeNil)
+		So(s.RecordImpressions(ctx, 1, []int{1}, 1000), ShouldBeNil)
+		counts, err := s.CountImpressions(ctx, 1, []int{1, 2, 3}, 0)
+		So(err, ShouldBeNil)
+		So(counts, ShouldResemble, []int{2, 1, 0})
+
+		// another node of the same second
+		other := NewRedisImpressionStore(l.Addr().String(), "secret", 0, 100*time.Second)
+		defer other.Close()
+		node := impressionNode
+		impressionNode = "other"
+		So(other.RecordImpressions(ctx, 1, []int{2}, 1000), ShouldBeNil)
+		impressionNode = node
+		counts, err = s.CountImpressions(ctx, 1, []int{2}, 0)
+		So(err, ShouldBeNil)
+		So(counts, ShouldResemble, []int{2})
+
+		// the impressions older than MaxAge are removed
+		So(s.RecordImpressions(ctx, 1, []int{1}, 1101), ShouldBeNil)
+		counts, err = s.CountImpressions(ctx, 1, []int{1}, 0)
+		So(err, ShouldBeNil)
+		So(counts, ShouldResemble, []int{1})
+
+		// the connection of every store is reused
+		f.Lock()
+		So(f.commands[0], ShouldEqual, "AUTH")
+		So(strings.Count(strings.Join(f.commands, " "), "AUTH"), ShouldEqual, 2)
+		f.Unlock()
+
+		bad := NewRedisImpressionStore(l.Addr().String(), "wrong", 0, 0)
+		_, err = bad.CountImpressions(ctx, 1, []int{1}, 0)
+		So(err, ShouldNotBeNil)
+	})
+}
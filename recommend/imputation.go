@@ -0,0 +1,191 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+type ImputeStrategy int
+
+const (
+	// ImputeNone fails the sample of the missing feature as before
+	ImputeNone ImputeStrategy = iota
+	// ImputeZeros imputes the zero vector of the width seen in Train
+	ImputeZeros
+	// ImputeMean imputes the mean of the features seen in Train
+	ImputeMean
+	// ImputeSegmentMean imputes the mean of the segment of the id, or the
+	// global mean if the segment is not seen in Train
+	ImputeSegmentMean
+	// ImputeFunc imputes with Imputer.Func
+	ImputeFunc
+)
+
+var (
+	// UserImputer and ItemImputer impute the user and item features failed
+	// to fetch in predict, nil means ImputeNone. FeatureImputer of the recSys
+	// takes precedence.
+	UserImputer *Imputer
+	ItemImputer *Imputer
+)
+
+// FeatureImputer is implemented by the recSys to have its own Imputers
+// instead of UserImputer and ItemImputer, nil means ImputeNone
+type FeatureImputer interface {
+	Imputers() (user *Imputer, item *Imputer)
+}
+
+// Imputer imputes the missing features of a kind, user or item. The means
+// are computed from the features fetched by GetSampleVector in Train, so
+// the same Imputer should be used in Train and predict.
+type Imputer struct {
+	Strategy ImputeStrategy
+	// Segment returns the segment of the id for ImputeSegmentMean, e.g. the
+	// country of the user or the category of the item
+	Segment func(id int) string
+	// Func returns the imputed feature of the id for ImputeFunc
+	Func func(ctx context.Context, id int) (Tensor, error)
+
+	imputed uint64
+
+	sync.Mutex
+	mean     featureMean
+	segments map[string]*featureMean
+}
+
+type featureMean struct {
+	sum []float64
+	n   int
+}
+
+func (m *featureMean) add(feature Tensor) {
+	if m.sum == nil {
+		m.sum = make([]float64, len(feature))
+	} else if len(m.sum) != len(feature) {
+		return
+	}
+	for i, v := range feature {
+		m.sum[i] += float64(v)
+	}
+	m.n++
+}
+
+func (m *featureMean) value() Tensor {
+	if m == nil || m.n == 0 {
+		return nil
+	}
+	mean := make(Tensor, len(m.sum))
+	for i, s := range m.sum {
+		mean[i] = float32(s / float64(m.n))
+	}
+	return mean
+}
+
+// Imputed is the number of the features imputed
+func (imp *Imputer) Imputed() uint64 {
+	return atomic.LoadUint64(&imp.imputed)
+}
+
+// Reset forgets the features seen
+func (imp *Imputer) Reset() {
+	imp.Lock()
+	defer imp.Unlock()
+	imp.mean, imp.segments = featureMean{}, nil
+}
+
+func (imp *Imputer) observe(id int, feature Tensor) {
+	if imp.Strategy == ImputeNone || imp.Strategy == ImputeFunc {
+		return
+	}
+	imp.Lock()
+	defer imp.Unlock()
+	imp.mean.add(feature)
+	if imp.Strategy == ImputeSegmentMean && imp.Segment != nil {
+		if imp.segments == nil {
+			imp.segments = make(map[string]*featureMean)
+		}
+		seg := imp.Segment(id)
+		if imp.segments[seg] == nil {
+			imp.segments[seg] = &featureMean{}
+		}
+		imp.segments[seg].add(feature)
+	}
+}
+
+// impute returns the imputed feature of id, ok is false if there is none
+func (imp *Imputer) impute(ctx context.Context, id int) (feature Tensor, ok bool) {
+	switch imp.Strategy {
+	case ImputeZeros:
+		imp.Lock()
+		if imp.mean.n != 0 {
+			feature = make(Tensor, len(imp.mean.sum))
+		}
+		imp.Unlock()
+	case ImputeMean:
+		imp.Lock()
+		feature = imp.mean.value()
+		imp.Unlock()
+	case ImputeSegmentMean:
+		imp.Lock()
+		if imp.Segment != nil {
+			feature = imp.segments[imp.Segment(id)].value()
+		}
+		if feature == nil {
+			feature = imp.mean.value()
+		}
+		imp.Unlock()
+	case ImputeFunc:
+		if imp.Func != nil {
+			var err error
+			if feature, err = imp.Func(ctx, id); err != nil {
+				return nil, false
+			}
+		}
+	}
+	if feature == nil {
+		return
+	}
+	atomic.AddUint64(&imp.imputed, 1)
+	return feature, true
+}
+
+// imputerOf returns the Imputer of the kind, cacheUser or cacheItem
+func imputerOf(featureProvider interface{}, kind string) *Imputer {
+	user, item := UserImputer, ItemImputer
+	if fi, ok := featureProvider.(FeatureImputer); ok {
+		user, item = fi.Imputers()
+	}
+	if kind == cacheUser {
+		return user
+	}
+	return item
+}
+
+// observeFeature feeds the feature fetched in Train to the Imputer of kind
+func observeFeature(ctx context.Context, featureProvider interface{}, kind string, id int, feature Tensor) {
+	if !inStage(ctx, TrainStage) {
+		return
+	}
+	if imp := imputerOf(featureProvider, kind); imp != nil {
+		imp.observe(id, feature)
+	}
+}
+
+// imputeFeature returns the imputed feature of kind if fetching it failed
+// with err in predict, ok is false if err should fail the sample
+func imputeFeature(ctx context.Context, featureProvider interface{}, kind string, id int, err error) (feature Tensor, ok bool) {
+	if !inStage(ctx, PredictStage) || ctx.Err() != nil ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	imp := imputerOf(featureProvider, kind)
+	if imp == nil {
+		return
+	}
+	if feature, ok = imp.impute(ctx, id); ok {
+		atomic.AddUint64(metrics.imputed[kind], 1)
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// sparsePredictor is idPredictor missing the items >= 10
+type sparsePredictor struct {
+	idPredictor
+}
+
+func (p sparsePredictor) GetItemFeature(ctx context.Context, itemId int) (Tensor, error) {
+	if itemId >= 10 {
+		return nil, ErrMissingItem
+	}
+	return p.idPredictor.GetItemFeature(ctx, itemId)
+}
+
+func TestImputation(t *testing.T) {
+	defer func(u, i *Imputer) { UserImputer, ItemImputer = u, i }(UserImputer, ItemImputer)
+
+	observe := func(itemIds ...int) {
+		ctx := WithStage(context.Background(), TrainStage)
+		for _, itemId := range itemIds {
+			_, _, _, err := GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, sparsePredictor{}, &Sample{UserId: 1, ItemId: itemId})
+			So(err, ShouldBeNil)
+		}
+	}
+	predictCtx := WithStage(context.Background(), PredictStage)
+	itemFeature := func(itemId int) (Tensor, error) {
+		vec, _, _, err := GetSampleVector(predictCtx, UserFeatureCache, ItemFeatureCache, sparsePredictor{}, &Sample{UserId: 1, ItemId: itemId})
+		if err != nil {
+			return nil, err
+		}
+		return vec[len(vec)-1:], nil
+	}
+
+	Convey("imputation", t, func() {
+		resetFeatureCache()
+
+		Convey("none", func() {
+			ItemImputer = nil
+			_, err := itemFeature(11)
+			So(err, ShouldWrap, ErrMissingItem)
+		})
+
+		Convey("zeros", func() {
+			ItemImputer = &Imputer{Strategy: ImputeZeros}
+			_, err := itemFeature(11)
+			So(err, ShouldNotBeNil) // width not seen yet
+			observe(2)
+			f, err := itemFeature(11)
+			So(err, ShouldBeNil)
+			So(f, ShouldResemble, Tensor{0})
+			So(ItemImputer.Imputed(), ShouldEqual, 1)
+		})
+
+		Convey("mean", func() {
+			ItemImputer = &Imputer{Strategy: ImputeMean}
+			observe(2, 4, 6)
+			f, err := itemFeature(11)
+			So(err, ShouldBeNil)
+			So(f, ShouldResemble, Tensor{4})
+
+			Convey("not in train", func() {
+				ItemImputer.Reset()
+				_, err := itemFeature(12)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("segment mean", func() {
+			ItemImputer = &Imputer{Strategy: ImputeSegmentMean, Segment: func(id int) string {
+				return fmt.Sprint(id % 2)
+			}}
+			observe(2, 4, 5)
+			odd, _ := itemFeature(11)
+			even, _ := itemFeature(12)
+			So(odd, ShouldResemble, Tensor{5})
+			So(even, ShouldResemble, Tensor{3})
+			So(ItemImputer.Imputed(), ShouldEqual, 2)
+		})
+
+		Convey("func and the recSys imputers", func() {
+			ItemImputer = &Imputer{Strategy: ImputeFunc, Func: func(_ context.Context, id int) (Tensor, error) {
+				return Tensor{float32(-id)}, nil
+			}}
+			scores, err := Rank(context.Background(), sparsePredictor{}, 1, []int{3, 13})
+			So(err, ShouldBeNil)
+			So(scores, ShouldResemble, []ItemScore{{ItemId: 3, Score: 3}, {ItemId: 13, Score: -13}})
+
+			rs := imputingPredictor{sparsePredictor{}}
+			scores, err = Rank(context.Background(), rs, 1, []int{14})
+			So(err, ShouldBeNil)
+			So(scores, ShouldResemble, []ItemScore{{ItemId: 14, Score: 0.5}})
+		})
+	})
+}
+
+// imputingPredictor imputes the missing items with 0.5
+type imputingPredictor struct {
+	sparsePredictor
+}
+
+func (imputingPredictor) Imputers() (user *Imputer, item *Imputer) {
+	return nil, &Imputer{Strategy: ImputeFunc, Func: func(context.Context, int) (Tensor, error) {
+		return Tensor{0.5}, nil
+	}}
+}
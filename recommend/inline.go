@@ -0,0 +1,63 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+)
+
+const inlineItemsKey ctxKey = "inlineItems"
+
+// InlineItem is a candidate scored with the features in the request instead
+// of the ItemFeaturer and the caches, e.g. a draft or a third party item not
+// in the catalog yet. Feature must be as wide as the item features of the
+// catalog. Embedding is the item embedding of ItemEmbDim, zeros if empty.
+type InlineItem struct {
+	ItemId    int       `json:"itemId"`
+	Feature   Tensor    `json:"feature"`
+	Embedding []float32 `json:"embedding,omitempty"`
+}
+
+// WithInlineItems returns the ctx scoring items with their inline features in
+// Rank, the inline items take precedence over the catalog items of the same
+// id
+func WithInlineItems(ctx context.Context, items []InlineItem) context.Context {
+	inline := make(map[int]*InlineItem, len(items))
+	for i := range items {
+		inline[items[i].ItemId] = &items[i]
+	}
+	return context.WithValue(ctx, inlineItemsKey, inline)
+}
+
+func inlineItemOf(ctx context.Context, itemId int) (item *InlineItem, ok bool) {
+	inline, _ := ctx.Value(inlineItemsKey).(map[int]*InlineItem)
+	item, ok = inline[itemId]
+	return
+}
+
+// RankInline is Rank of the catalog items itemIds and the inline items
+func RankInline(ctx context.Context, recSys Predictor, userId int, itemIds []int, items []InlineItem) (itemScores []ItemScore, err error) {
+	if err = validateInlineItems(items); err != nil {
+		return
+	}
+	ids := make([]int, 0, len(itemIds)+len(items))
+	ids = append(ids, itemIds...)
+	for _, item := range items {
+		ids = append(ids, item.ItemId)
+	}
+	if len(items) != 0 {
+		ctx = WithInlineItems(ctx, items)
+	}
+	return Rank(ctx, recSys, userId, ids)
+}
+
+func validateInlineItems(items []InlineItem) error {
+	for _, item := range items {
+		if len(item.Feature) == 0 {
+			return fmt.Errorf("inline item %d has no feature", item.ItemId)
+		}
+		if len(item.Embedding) != 0 && len(item.Embedding) != ItemEmbDim {
+			return fmt.Errorf("inline item %d embedding dim %d != %d", item.ItemId, len(item.Embedding), ItemEmbDim)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// catalogPredictor is idPredictor failing the items not in the catalog 1-9
+type catalogPredictor struct {
+	idPredictor
+	fetched map[int]bool
+}
+
+func (p catalogPredictor) GetItemFeature(ctx context.Context, itemId int) (Tensor, error) {
+	p.fetched[itemId] = true
+	if itemId >= 10 {
+		return nil, ErrMissingItem
+	}
+	return p.idPredictor.GetItemFeature(ctx, itemId)
+}
+
+func TestRankInline(t *testing.T) {
+	defer itemEmbeddingMap.store(itemEmbeddingMap.load())
+
+	Convey("rank inline items", t, func() {
+		resetFeatureCache()
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": make([]float32, ItemEmbDim)})
+		p := catalogPredictor{fetched: make(map[int]bool)}
+		emb := make([]float32, ItemEmbDim)
+		emb[0] = 7
+		scores, err := RankInline(context.Background(), p, 1, []int{1, 2}, []InlineItem{
+			{ItemId: 100, Feature: Tensor{50}, Embedding: emb},
+			{ItemId: 2, Feature: Tensor{20}},
+		})
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{
+			{ItemId: 1, Score: 1}, {ItemId: 2, Score: 20}, {ItemId: 100, Score: 50}, {ItemId: 2, Score: 20},
+		})
+		So(p.fetched, ShouldResemble, map[int]bool{1: true})
+		So(ItemFeatureCache.Get("100"), ShouldBeNil)
+
+		// the embedding inline
+		ctx, trace := WithDebug(context.Background(), nil, nil)
+		_, err = RankInline(ctx, p, 1, nil, []InlineItem{{ItemId: 100, Feature: Tensor{50}, Embedding: emb}})
+		So(err, ShouldBeNil)
+		entry := trace.Entries[0]
+		So(entry.Vector[entry.Info.ItemFeatureRange[0]], ShouldEqual, 7)
+	})
+
+	Convey("invalid inline items", t, func() {
+		resetFeatureCache()
+		p := catalogPredictor{fetched: make(map[int]bool)}
+		_, err := RankInline(context.Background(), p, 1, nil, []InlineItem{{ItemId: 100}})
+		So(err, ShouldNotBeNil)
+		_, err = RankInline(context.Background(), p, 1, nil, []InlineItem{{ItemId: 100, Feature: Tensor{1}, Embedding: []float32{1}}})
+		So(err, ShouldNotBeNil)
+		// as wide as the catalog items
+		_, err = RankInline(context.Background(), p, 1, []int{1}, []InlineItem{{ItemId: 100, Feature: Tensor{1, 2}}})
+		So(err, ShouldNotBeNil)
+
+		_, code, err := serveRecRequest(context.Background(), p, RecApiRequest{UserId: 1, Items: []InlineItem{{ItemId: 100}}})
+		So(err, ShouldNotBeNil)
+		So(code, ShouldEqual, 400)
+		resp, code, err := serveRecRequest(context.Background(), p, RecApiRequest{UserId: 1, Items: []InlineItem{{ItemId: 100, Feature: Tensor{3}}}})
+		So(err, ShouldBeNil)
+		So(code, ShouldEqual, 200)
+		So(resp.ItemScoreList, ShouldResemble, []ItemScore{{ItemId: 100, Score: 3}})
+	})
+}
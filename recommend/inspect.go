@@ -0,0 +1,124 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// InspectTopK is the top items of the Rank output of InspectUser by default
+var InspectTopK = 10
+
+// UserInspection is what is recommended to a user and why, for the customer
+// support to debug a complaint of the user
+type UserInspection struct {
+	UserId int `json:"userId"`
+	// Profile is the user feature from the UserFeatureCache or the provider
+	Profile FeatureSegment `json:"profile"`
+	// Behavior is the recent items of the user with their features, nil if
+	// the provider is not a UserBehavior
+	Behavior []ItemOverView `json:"behavior"`
+	// TopK is the top of the Rank output with the Explanations of the scores
+	TopK         []ItemScore   `json:"topK"`
+	Explanations []Explanation `json:"explanations,omitempty"`
+}
+
+// InspectUser returns the UserInspection of userId with the top k of the
+// itemIds ranked, the items are retrieved if recSys is a Retriever and
+// itemIds is empty. k <= 0 means InspectTopK.
+func InspectUser(ctx context.Context, recSys Predictor, userId int, itemIds []int, k int) (ui *UserInspection, err error) {
+	if UserFeatureCache == nil || ItemFeatureCache == nil {
+		err = fmt.Errorf("feature cache not initialized")
+		return
+	}
+	if k <= 0 {
+		k = InspectTopK
+	}
+	ctx = WithStage(ctx, PredictStage)
+	var userNames, itemNames []string
+	if namer, ok := recSys.(FeatureNamer); ok {
+		userNames = namer.UserFeatureNames()
+		itemNames = namer.ItemFeatureNames()
+	} else if schema := featureSchemaOf(recSys); schema != nil {
+		userNames, itemNames = schema.fieldNames(schema.User), schema.fieldNames(schema.Item)
+	}
+
+	ui = &UserInspection{UserId: userId}
+	source := cacheSource(UserFeatureCache, strconv.Itoa(userId))
+	profile, err := fetchUserFeature(ctx, UserFeatureCache, recSys, &Sample{UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	ui.Profile = newFeatureSegment("UserProfile", [2]int{0, len(profile)}, source, userNames, profile)
+
+	if ub, ok := recSys.(UserBehavior); ok {
+		var itemSeq []int
+		if itemSeq, err = getUserBehavior(ctx, ub, userId, UserBehaviorLen, -1, time.Now().Unix()); err != nil {
+			return nil, fmt.Errorf("get behavior of user %d error: %v", userId, err)
+		}
+		ui.Behavior = make([]ItemOverView, 0, len(itemSeq))
+		for _, itemId := range itemSeq {
+			ui.Behavior = append(ui.Behavior, inspectItem(ctx, recSys, itemId, itemNames))
+		}
+	}
+
+	if len(itemIds) == 0 {
+		retriever, ok := recSys.(Retriever)
+		if !ok {
+			return nil, fmt.Errorf("itemIds is empty")
+		}
+		if itemIds, err = retriever.Retrieve(ctx, userId, RetrieveSize); err != nil {
+			return nil, err
+		}
+	}
+	scores, err := Rank(ctx, recSys, userId, itemIds)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	if len(scores) > k {
+		scores = scores[:k]
+	}
+	ui.TopK = scores
+	if len(scores) == 0 {
+		return
+	}
+	top := make([]int, len(scores))
+	for i, s := range scores {
+		top[i] = s.ItemId
+	}
+	// a Predictor scoring the items by itself, e.g. the RulesRanker, could
+	// not be explained by the feature groups
+	if ui.Explanations, err = RankExplain(ctx, recSys, userId, top); err != nil {
+		log.Warnf("explain the top items of user %d error: %v", userId, err)
+		ui.Explanations, err = nil, nil
+	}
+	return
+}
+
+// inspectItem returns the ItemOverView of the item feature of itemId named
+// by names, or by the indexes if the names mismatch
+func inspectItem(ctx context.Context, recSys Predictor, itemId int, names []string) (item ItemOverView) {
+	item.ItemId = itemId
+	feature, err := fetchItemFeature(ctx, ItemFeatureCache, recSys, &Sample{ItemId: itemId})
+	if err != nil {
+		log.Warnf("get feature of behavior item %d error: %v", itemId, err)
+		return
+	}
+	if len(names) != len(feature) {
+		names = nil
+	}
+	item.ItemFeatures = make(map[string]interface{}, len(feature))
+	for i, v := range feature {
+		name := strconv.Itoa(i)
+		if names != nil {
+			name = names[i]
+		}
+		item.ItemFeatures[name] = v
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// inspectPredictor is an idPredictor with the recent items 7, 8 of the users
+type inspectPredictor struct {
+	idPredictor
+}
+
+func (inspectPredictor) GetUserBehavior(context.Context, int, int64, int64, int64) ([]int, error) {
+	return []int{7, 8}, nil
+}
+
+func TestInspectUser(t *testing.T) {
+	Convey("inspect the recommendation of a user", t, func() {
+		resetFeatureCache()
+		ui, err := InspectUser(context.Background(), inspectPredictor{}, 3, []int{1, 5, 9, 2}, 2)
+		So(err, ShouldBeNil)
+		So(ui.UserId, ShouldEqual, 3)
+		So(ui.Profile.Source, ShouldEqual, SourceProvider)
+		So(ui.Profile.Values, ShouldResemble, []float32{3})
+
+		So(ui.Behavior, ShouldHaveLength, 2)
+		So(ui.Behavior[0].ItemId, ShouldEqual, 7)
+		So(ui.Behavior[0].ItemFeatures, ShouldResemble, map[string]interface{}{"0": float32(7)})
+
+		// idPredictor scores by the item id
+		So(ui.TopK, ShouldHaveLength, 2)
+		So(ui.TopK[0].ItemId, ShouldEqual, 9)
+		So(ui.TopK[1].ItemId, ShouldEqual, 5)
+		So(ui.Explanations, ShouldHaveLength, 2)
+		So(ui.Explanations[0].ItemId, ShouldEqual, 9)
+
+		Convey("profile from cache", func() {
+			ui, err := InspectUser(context.Background(), inspectPredictor{}, 3, []int{1}, 0)
+			So(err, ShouldBeNil)
+			So(ui.Profile.Source, ShouldEqual, SourceCache)
+			So(ui.TopK, ShouldHaveLength, 1)
+		})
+
+		Convey("no candidates", func() {
+			_, err := InspectUser(context.Background(), inspectPredictor{}, 3, nil, 0)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
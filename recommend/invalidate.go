@@ -0,0 +1,114 @@
+package recommend
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// InvalidationSecret enables the POST /service/invalidate and
+// /service/models/activate endpoints of the recommend api if not empty, the
+// bodies must be signed by it in WebhookSignatureHeader as the webhooks are
+var InvalidationSecret string
+
+// InvalidationEvent is a change of users and items, e.g. from a CDC stream
+// or a webhook of the catalog
+type InvalidationEvent struct {
+	UserIds []int `json:"userIds,omitempty"`
+	ItemIds []int `json:"itemIds,omitempty"`
+}
+
+// InvalidateUser drops the cached features and behavior of userId, they are
+// fetched again on the next request
+func InvalidateUser(userId int) (dropped bool) {
+	if UserBehaviorCache != nil {
+		dropped = UserBehaviorCache.DeletePrefix(behaviorCachePrefix(userId)) != 0
+	}
+	if UserFeatureCache != nil && UserFeatureCache.Delete(strconv.Itoa(userId)) {
+		dropped = true
+	}
+	return
+}
+
+// InvalidateItem drops the cached features of itemId, they are fetched
+// again on the next request
+func InvalidateItem(itemId int) bool {
+	if ItemFeatureCache == nil {
+		return false
+	}
+	return ItemFeatureCache.Delete(strconv.Itoa(itemId))
+}
+
+// Invalidate drops the cached features of the users and items of event,
+// dropped is the ones cached
+func Invalidate(event InvalidationEvent) (dropped int) {
+	for _, id := range event.UserIds {
+		if InvalidateUser(id) {
+			dropped++
+		}
+	}
+	for _, id := range event.ItemIds {
+		if InvalidateItem(id) {
+			dropped++
+		}
+	}
+	return
+}
+
+// RefreshUser fetches the features of userId again into UserFeatureCache
+func RefreshUser(ctx context.Context, featureProvider BasicFeatureProvider, userId int) (err error) {
+	initFeatureCaches()
+	InvalidateUser(userId)
+	_, err = fetchUserFeature(WithStage(ctx, PredictStage), UserFeatureCache, featureProvider, &Sample{UserId: userId})
+	return
+}
+
+// RefreshItem fetches the features of itemId again into ItemFeatureCache
+func RefreshItem(ctx context.Context, featureProvider BasicFeatureProvider, itemId int) (err error) {
+	initFeatureCaches()
+	InvalidateItem(itemId)
+	_, err = fetchItemFeature(WithStage(ctx, PredictStage), ItemFeatureCache, featureProvider, &Sample{ItemId: itemId})
+	return
+}
+
+// InvalidationHandler is the gin handler accepting the InvalidationEvent
+// json signed by secret, e.g.
+// engine.POST("/service/invalidate", InvalidationHandler(secret))
+func InvalidationHandler(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := signedBody(c, secret)
+		if !ok {
+			return
+		}
+		var event InvalidationEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		dropped := Invalidate(event)
+		log.Debugf("invalidated %d users and %d items, %d cached", len(event.UserIds), len(event.ItemIds), dropped)
+		c.JSON(200, gin.H{"dropped": dropped})
+	}
+}
+
+// signedBody returns the request body signed by secret in
+// WebhookSignatureHeader, ok is false if the error response is written
+func signedBody(c *gin.Context, secret string) (body []byte, ok bool) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	signature := strings.TrimPrefix(c.GetHeader(WebhookSignatureHeader), "sha256=")
+	if !hmac.Equal([]byte(signature), []byte(SignWebhook(secret, body))) {
+		c.JSON(401, gin.H{"error": "invalid signature"})
+		return
+	}
+	return body, true
+}
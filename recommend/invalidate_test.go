@@ -0,0 +1,65 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// versionedPredictor is idPredictor with the item features of Version
+type versionedPredictor struct {
+	idPredictor
+	Version float32
+}
+
+func (p *versionedPredictor) GetItemFeature(_ context.Context, itemId int) (Tensor, error) {
+	return Tensor{float32(itemId) + p.Version}, nil
+}
+
+func TestInvalidation(t *testing.T) {
+	Convey("invalidation", t, func() {
+		resetFeatureCache()
+		ctx := context.Background()
+		p := &versionedPredictor{}
+		So(WarmUp(ctx, p, []int{1}, []int{2, 3}), ShouldBeNil)
+
+		p.Version = 100
+		So(ItemFeatureCache.Get("2").Value(), ShouldResemble, Tensor{2})
+		So(InvalidateItem(2), ShouldBeTrue)
+		So(InvalidateItem(2), ShouldBeFalse)
+		So(ItemFeatureCache.Get("2"), ShouldBeNil)
+
+		So(RefreshItem(ctx, p, 3), ShouldBeNil)
+		So(ItemFeatureCache.Get("3").Value(), ShouldResemble, Tensor{103})
+
+		So(Invalidate(InvalidationEvent{UserIds: []int{1, 5}, ItemIds: []int{3}}), ShouldEqual, 2)
+		So(UserFeatureCache.Get("1"), ShouldBeNil)
+
+		Convey("http handler", func() {
+			gin.SetMode(gin.TestMode)
+			engine := gin.New()
+			engine.POST("/service/invalidate", InvalidationHandler("s3cret"))
+			So(RefreshItem(ctx, p, 3), ShouldBeNil)
+
+			body, _ := json.Marshal(InvalidationEvent{ItemIds: []int{3}})
+			post := func(signature string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "/service/invalidate", strings.NewReader(string(body)))
+				req.Header.Set(WebhookSignatureHeader, signature)
+				engine.ServeHTTP(w, req)
+				return w
+			}
+			So(post("sha256=bad").Code, ShouldEqual, 401)
+			So(ItemFeatureCache.Get("3") != nil, ShouldBeTrue)
+			w := post("sha256=" + SignWebhook("s3cret", body))
+			So(w.Code, ShouldEqual, 200)
+			So(w.Body.String(), ShouldEqual, `{"dropped":1}`)
+			So(ItemFeatureCache.Get("3"), ShouldBeNil)
+		})
+	})
+}
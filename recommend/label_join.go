@@ -0,0 +1,213 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	FeedbackClick      = "click"
+	FeedbackConversion = "conversion"
+
+	defaultAttributionWindow = 30 * time.Minute
+)
+
+// FeedbackEvent is a user action on an item after the impression, e.g. a
+// click or a conversion
+type FeedbackEvent struct {
+	// Timestamp is the unix milliseconds like PredictionEvent.Timestamp
+	Timestamp int64  `json:"ts"`
+	UserId    int    `json:"userId"`
+	ItemId    int    `json:"itemId"`
+	Type      string `json:"type"`
+}
+
+// LabelJoiner joins the impressions, e.g. of the PredictionLog, with the
+// feedback events following them in Window into the labeled Samples. It is
+// a Trainer, so a RecSys could embed it as the SampleGenerator. Both the
+// sources are expected in the time asc order, they are merged by the time
+// and an impression is emitted once the merged stream passes its Window.
+type LabelJoiner struct {
+	// Impressions opens the impression source
+	Impressions func(ctx context.Context) (<-chan PredictionEvent, error)
+	// Feedback opens the feedback source
+	Feedback func(ctx context.Context) (<-chan FeedbackEvent, error)
+	// Window is the attribution window of the feedback to the latest
+	// impression of the same user and item before it, default 30 minutes
+	Window time.Duration
+	// Events are the FeedbackEvent types of Sample.Label and then of
+	// Sample.Labels in order, default FeedbackClick only. For example
+	// {FeedbackClick, FeedbackConversion} labels the CTR and the CVR task.
+	Events []string
+	// FakeNegatives emits every impression at once as a negative and then a
+	// positive duplicate of it on the feedback in Window, for the continuous
+	// training without waiting for the delayed conversions. The model learns
+	// b = p/(1+p) then, see FakeNegativeCalibration. Only one of Events is
+	// supported, the duplicates of several events would bias the labels of
+	// the other tasks.
+	FakeNegatives bool
+}
+
+// joinedImpression is an impression waiting for the feedback
+type joinedImpression struct {
+	PredictionEvent
+	labels []float32
+}
+
+// SampleGenerator joins the sources opened with ctx, the Samples are in the
+// impression time order, or in the merged time order with FakeNegatives,
+// with the Timestamp of the impression in unix seconds
+func (j *LabelJoiner) SampleGenerator(ctx context.Context) (<-chan Sample, error) {
+	if j.Impressions == nil || j.Feedback == nil {
+		return nil, fmt.Errorf("label joiner without the impression or the feedback source")
+	}
+	if j.FakeNegatives && len(j.Events) > 1 {
+		return nil, fmt.Errorf("label joiner with fake negatives of %d events", len(j.Events))
+	}
+	impCh, err := j.Impressions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fbCh, err := j.Feedback(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		window = j.Window.Milliseconds()
+		events = j.Events
+		out    = make(chan Sample, 1000)
+	)
+	if window <= 0 {
+		window = defaultAttributionWindow.Milliseconds()
+	}
+	if len(events) == 0 {
+		events = []string{FeedbackClick}
+	}
+	labelIdx := make(map[string]int, len(events))
+	for i, e := range events {
+		labelIdx[e] = i
+	}
+
+	go func() {
+		defer close(out)
+		var (
+			pending   []*joinedImpression // in time asc order
+			byKey     = make(map[userItem][]*joinedImpression)
+			unmatched int
+		)
+		send := func(imp *joinedImpression) bool {
+			s := Sample{
+				UserId:    imp.UserId,
+				ItemId:    imp.ItemId,
+				Label:     imp.labels[0],
+				Timestamp: imp.Timestamp / 1000,
+			}
+			if len(imp.labels) > 1 {
+				s.Labels = append([]float32(nil), imp.labels[1:]...)
+			}
+			select {
+			case out <- s:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		// emit sends the pending impressions of the window passed by now,
+		// which are sent already with FakeNegatives
+		emit := func(now int64, all bool) bool {
+			var n int
+			for ; n < len(pending); n++ {
+				imp := pending[n]
+				if !all && imp.Timestamp+window >= now {
+					break
+				}
+				key := userItem{imp.UserId, imp.ItemId}
+				if imps := byKey[key]; len(imps) <= 1 {
+					delete(byKey, key)
+				} else {
+					byKey[key] = imps[1:]
+				}
+				if !j.FakeNegatives && !send(imp) {
+					return false
+				}
+			}
+			pending = pending[n:]
+			return true
+		}
+
+		var (
+			imp, impOk = recvImpression(ctx, impCh)
+			fb, fbOk   = recvFeedback(ctx, fbCh)
+		)
+		for impOk || fbOk {
+			// the impression goes first on the tie, for the feedback of the
+			// same millisecond
+			if impOk && (!fbOk || imp.Timestamp <= fb.Timestamp) {
+				if !emit(imp.Timestamp, false) {
+					return
+				}
+				ji := &joinedImpression{PredictionEvent: imp, labels: make([]float32, len(events))}
+				if j.FakeNegatives && !send(ji) {
+					return
+				}
+				pending = append(pending, ji)
+				key := userItem{imp.UserId, imp.ItemId}
+				byKey[key] = append(byKey[key], ji)
+				imp, impOk = recvImpression(ctx, impCh)
+				continue
+			}
+			if !emit(fb.Timestamp, false) {
+				return
+			}
+			if i, ok := labelIdx[fb.Type]; ok {
+				imps := byKey[userItem{fb.UserId, fb.ItemId}]
+				// the latest impression before the feedback in the window
+				matched := false
+				for k := len(imps) - 1; k >= 0; k-- {
+					if imps[k].Timestamp <= fb.Timestamp && fb.Timestamp-imps[k].Timestamp <= window {
+						matched = true
+						if imps[k].labels[i] == 0 {
+							imps[k].labels[i] = 1
+							// the positive duplicate of the fake negative
+							if j.FakeNegatives && !send(imps[k]) {
+								return
+							}
+						}
+						break
+					}
+				}
+				if !matched {
+					unmatched++
+				}
+			}
+			fb, fbOk = recvFeedback(ctx, fbCh)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		emit(0, true)
+		if unmatched != 0 {
+			log.Debugf("label joiner: %d feedback events without the impression", unmatched)
+		}
+	}()
+	return out, nil
+}
+
+func recvImpression(ctx context.Context, ch <-chan PredictionEvent) (e PredictionEvent, ok bool) {
+	select {
+	case e, ok = <-ch:
+	case <-ctx.Done():
+	}
+	return
+}
+
+func recvFeedback(ctx context.Context, ch <-chan FeedbackEvent) (e FeedbackEvent, ok bool) {
+	select {
+	case e, ok = <-ch:
+	case <-ctx.Done():
+	}
+	return
+}
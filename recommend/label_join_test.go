@@ -0,0 +1,125 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func impressionSource(events ...PredictionEvent) func(context.Context) (<-chan PredictionEvent, error) {
+	return func(context.Context) (<-chan PredictionEvent, error) {
+		ch := make(chan PredictionEvent, len(events))
+		for _, e := range events {
+			ch <- e
+		}
+		close(ch)
+		return ch, nil
+	}
+}
+
+func feedbackSource(events ...FeedbackEvent) func(context.Context) (<-chan FeedbackEvent, error) {
+	return func(context.Context) (<-chan FeedbackEvent, error) {
+		ch := make(chan FeedbackEvent, len(events))
+		for _, e := range events {
+			ch <- e
+		}
+		close(ch)
+		return ch, nil
+	}
+}
+
+func TestLabelJoiner(t *testing.T) {
+	Convey("join the impressions with the feedback", t, func() {
+		ctx := context.Background()
+		j := &LabelJoiner{
+			Impressions: impressionSource(
+				PredictionEvent{Timestamp: 1000, UserId: 1, ItemId: 1},
+				PredictionEvent{Timestamp: 1000, UserId: 1, ItemId: 2},
+				PredictionEvent{Timestamp: 2000, UserId: 2, ItemId: 1},
+				PredictionEvent{Timestamp: 5000, UserId: 1, ItemId: 1},
+				PredictionEvent{Timestamp: 9000, UserId: 2, ItemId: 2},
+			),
+			Feedback: feedbackSource(
+				FeedbackEvent{Timestamp: 1500, UserId: 1, ItemId: 2, Type: FeedbackClick},
+				// out of the window of the impression at 2000
+				FeedbackEvent{Timestamp: 4500, UserId: 2, ItemId: 1, Type: FeedbackClick},
+				// the latest impression of user 1 item 1 is at 5000
+				FeedbackEvent{Timestamp: 6000, UserId: 1, ItemId: 1, Type: FeedbackClick},
+				FeedbackEvent{Timestamp: 6500, UserId: 1, ItemId: 1, Type: FeedbackConversion},
+				// no impression
+				FeedbackEvent{Timestamp: 7000, UserId: 3, ItemId: 3, Type: FeedbackClick},
+			),
+			Window: 2 * time.Second,
+		}
+
+		Convey("click", func() {
+			sampleCh, err := j.SampleGenerator(ctx)
+			So(err, ShouldBeNil)
+			var samples []Sample
+			for s := range sampleCh {
+				samples = append(samples, s)
+			}
+			So(samples, ShouldResemble, []Sample{
+				{UserId: 1, ItemId: 1, Label: 0, Timestamp: 1},
+				{UserId: 1, ItemId: 2, Label: 1, Timestamp: 1},
+				{UserId: 2, ItemId: 1, Label: 0, Timestamp: 2},
+				{UserId: 1, ItemId: 1, Label: 1, Timestamp: 5},
+				{UserId: 2, ItemId: 2, Label: 0, Timestamp: 9},
+			})
+		})
+
+		Convey("click and conversion", func() {
+			j.Events = []string{FeedbackClick, FeedbackConversion}
+			sampleCh, err := j.SampleGenerator(ctx)
+			So(err, ShouldBeNil)
+			var samples []Sample
+			for s := range sampleCh {
+				samples = append(samples, s)
+			}
+			So(samples, ShouldHaveLength, 5)
+			So(samples[1].Labels, ShouldResemble, []float32{0})
+			So(samples[3].Label, ShouldEqual, 1)
+			So(samples[3].Labels, ShouldResemble, []float32{1})
+		})
+
+		Convey("fake negatives", func() {
+			j.FakeNegatives = true
+			sampleCh, err := j.SampleGenerator(ctx)
+			So(err, ShouldBeNil)
+			var samples []Sample
+			for s := range sampleCh {
+				samples = append(samples, s)
+			}
+			So(samples, ShouldResemble, []Sample{
+				{UserId: 1, ItemId: 1, Label: 0, Timestamp: 1},
+				{UserId: 1, ItemId: 2, Label: 0, Timestamp: 1},
+				{UserId: 1, ItemId: 2, Label: 1, Timestamp: 1},
+				{UserId: 2, ItemId: 1, Label: 0, Timestamp: 2},
+				{UserId: 1, ItemId: 1, Label: 0, Timestamp: 5},
+				{UserId: 1, ItemId: 1, Label: 1, Timestamp: 5},
+				{UserId: 2, ItemId: 2, Label: 0, Timestamp: 9},
+			})
+
+			// a click then a conversion would duplicate the click positive
+			j.Events = []string{FeedbackClick, FeedbackConversion}
+			_, err = j.SampleGenerator(ctx)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("canceled", func() {
+			ctx, cancel := context.WithCancel(ctx)
+			cancel()
+			sampleCh, err := j.SampleGenerator(ctx)
+			So(err, ShouldBeNil)
+			for range sampleCh {
+			}
+		})
+	})
+
+	Convey("without the sources", t, func() {
+		_, err := (&LabelJoiner{}).SampleGenerator(context.Background())
+		So(err, ShouldNotBeNil)
+	})
+}
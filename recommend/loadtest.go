@@ -0,0 +1,143 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LoadTestOptions of LoadTest. The requests are Requests in turn, or the
+// synthetic ones of Candidates random items in [0, SyntheticItems) for a
+// random user in [0, SyntheticUsers) if Requests is empty.
+type LoadTestOptions struct {
+	QPS      int
+	Duration time.Duration
+	// MaxInFlight is the max requests in flight, the requests over it are
+	// dropped and counted to show the saturation, <= 0 means 4 * QPS
+	MaxInFlight int
+
+	Requests       []RecApiRequest
+	SyntheticUsers int
+	SyntheticItems int
+	Candidates     int
+	Seed           int64
+}
+
+func DefaultLoadTestOptions(qps int) LoadTestOptions {
+	return LoadTestOptions{
+		QPS:            qps,
+		Duration:       30 * time.Second,
+		SyntheticUsers: 1000,
+		SyntheticItems: 1000,
+		Candidates:     100,
+		Seed:           1,
+	}
+}
+
+type LoadTestReport struct {
+	Sent    int `json:"sent"`
+	Errors  int `json:"errors"`
+	Dropped int `json:"dropped"`
+	// QPS is the requests finished per second
+	QPS       float64      `json:"qps"`
+	ErrorRate float64      `json:"errorRate"`
+	Latency   LatencyStats `json:"latency"`
+	// FirstError is kept to tell why the requests failed
+	FirstError string `json:"firstError,omitempty"`
+}
+
+// LoadRequests reads the requests of a request log written by RequestLogger
+// for LoadTestOptions.Requests
+func LoadRequests(r io.Reader) (requests []RecApiRequest, err error) {
+	err = ReadRequestLog(r, func(record RequestLogRecord) error {
+		requests = append(requests, record.Request)
+		return nil
+	})
+	return
+}
+
+// LoadTest sends the requests at opts.QPS to predict in process as the
+// recommend api does, until opts.Duration passes or ctx is done, and reports
+// the latency and the error rate. The load is open loop: a slow engine does
+// not slow down the requests but drops them over opts.MaxInFlight.
+func LoadTest(ctx context.Context, predict Predictor, opts LoadTestOptions) (report LoadTestReport, err error) {
+	if opts.QPS <= 0 {
+		return report, fmt.Errorf("invalid qps %d", opts.QPS)
+	}
+	if len(opts.Requests) == 0 && (opts.SyntheticUsers <= 0 || opts.SyntheticItems <= 0 || opts.Candidates <= 0) {
+		return report, fmt.Errorf("no requests for load test")
+	}
+	maxInFlight := opts.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = 4 * opts.QPS
+	}
+	var (
+		rnd      = rand.New(rand.NewSource(opts.Seed))
+		inFlight = make(chan struct{}, maxInFlight)
+		ticker   = time.NewTicker(time.Second / time.Duration(opts.QPS))
+		timer    = time.NewTimer(opts.Duration)
+		start    = time.Now()
+
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		latencies []time.Duration
+	)
+	defer ticker.Stop()
+	defer timer.Stop()
+	next := func(i int) RecApiRequest {
+		if len(opts.Requests) != 0 {
+			return opts.Requests[i%len(opts.Requests)]
+		}
+		req := RecApiRequest{UserId: rnd.Intn(opts.SyntheticUsers), ItemIdList: make([]int, opts.Candidates)}
+		for j := range req.ItemIdList {
+			req.ItemIdList[j] = rnd.Intn(opts.SyntheticItems)
+		}
+		return req
+	}
+
+loop:
+	for i := 0; ; i++ {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-timer.C:
+			break loop
+		case <-ticker.C:
+		}
+		report.Sent++
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			report.Dropped++
+			continue
+		}
+		wg.Add(1)
+		go func(req RecApiRequest) {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			reqStart := time.Now()
+			_, _, err := serveRecRequest(ctx, predict, req)
+			latency := time.Since(reqStart)
+			mu.Lock()
+			defer mu.Unlock()
+			latencies = append(latencies, latency)
+			if err != nil {
+				report.Errors++
+				if report.FirstError == "" {
+					report.FirstError = err.Error()
+				}
+			}
+		}(next(i))
+	}
+	wg.Wait()
+
+	report.Latency = newLatencyStats(latencies)
+	report.QPS = float64(len(latencies)) / time.Since(start).Seconds()
+	if len(latencies) != 0 {
+		report.ErrorRate = float64(report.Errors) / float64(len(latencies))
+	}
+	return
+}
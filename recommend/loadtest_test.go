@@ -0,0 +1,74 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// sleepPredictor predicts slowly
+type sleepPredictor struct {
+	idPredictor
+	sleep time.Duration
+}
+
+func (p sleepPredictor) Predict(X tensor.Tensor) tensor.Tensor {
+	time.Sleep(p.sleep)
+	return p.idPredictor.Predict(X)
+}
+
+func TestLoadTest(t *testing.T) {
+	Convey("load test with synthetic requests", t, func() {
+		resetFeatureCache()
+		opts := DefaultLoadTestOptions(200)
+		opts.Duration = 200 * time.Millisecond
+		opts.Candidates = 10
+		report, err := LoadTest(context.Background(), idPredictor{}, opts)
+		So(err, ShouldBeNil)
+		So(report.Sent, ShouldBeBetweenOrEqual, 20, 41)
+		So(report.Errors, ShouldEqual, 0)
+		So(report.Dropped, ShouldEqual, 0)
+		So(report.QPS, ShouldBeGreaterThan, 0)
+		So(report.Latency.P99, ShouldBeGreaterThan, 0)
+		So(report.Latency.P99, ShouldBeGreaterThanOrEqualTo, report.Latency.P50)
+	})
+
+	Convey("saturated engine drops requests", t, func() {
+		opts := DefaultLoadTestOptions(100)
+		opts.Duration = 200 * time.Millisecond
+		opts.MaxInFlight = 1
+		opts.Candidates = 2
+		report, err := LoadTest(context.Background(), sleepPredictor{sleep: 50 * time.Millisecond}, opts)
+		So(err, ShouldBeNil)
+		So(report.Dropped, ShouldBeGreaterThan, 0)
+		So(report.Latency.P50, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+	})
+
+	Convey("load test with logged requests", t, func() {
+		var buf bytes.Buffer
+		logger := NewRequestLogger(&buf)
+		logger.LogRequest(time.Now(), RecApiRequest{UserId: 1, ItemIdList: []int{1, 2}}, RecApiResponse{}, nil)
+		logger.LogRequest(time.Now(), RecApiRequest{UserId: 2}, RecApiResponse{}, nil)
+		requests, err := LoadRequests(&buf)
+		So(err, ShouldBeNil)
+		So(requests, ShouldHaveLength, 2)
+
+		opts := LoadTestOptions{QPS: 100, Duration: 100 * time.Millisecond, Requests: requests}
+		report, err := LoadTest(context.Background(), idPredictor{}, opts)
+		So(err, ShouldBeNil)
+		So(report.Errors, ShouldBeGreaterThan, 0)
+		So(report.ErrorRate, ShouldBeBetween, 0.3, 0.7)
+		So(report.FirstError, ShouldEqual, "itemIdList is empty")
+	})
+
+	Convey("invalid options", t, func() {
+		_, err := LoadTest(context.Background(), idPredictor{}, LoadTestOptions{QPS: 10})
+		So(err, ShouldNotBeNil)
+		_, err = LoadTest(context.Background(), idPredictor{}, DefaultLoadTestOptions(0))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,114 @@
+package recommend
+
+import (
+	"fmt"
+	"math"
+)
+
+// Loss is a training loss of the predicted probability or value p of the
+// label y. The Fitters implementing LossFitter train by TrainLoss, the
+// graph models translate the built-in ones by model.Cost32.
+type Loss interface {
+	Name() string
+	Loss(p, y float32) float32
+}
+
+// LossFitter is a Fitter training by the Loss set before Fit
+type LossFitter interface {
+	SetLoss(loss Loss)
+}
+
+// TrainLoss is set to the Fitter by Train, which must be a LossFitter then.
+// nil means the default loss of the Fitter for LabelObjective.
+var TrainLoss Loss
+
+const lossEps = 1e-7
+
+func clampProb(p float32) float64 {
+	return math.Min(math.Max(float64(p), lossEps), 1-lossEps)
+}
+
+// LogLoss is the binary cross entropy
+type LogLoss struct{}
+
+func (LogLoss) Name() string { return "logloss" }
+
+func (LogLoss) Loss(p, y float32) float32 {
+	q := clampProb(p)
+	return float32(-float64(y)*math.Log(q) - float64(1-y)*math.Log(1-q))
+}
+
+// HingeLoss is max(0, 1 - t*s) of the label t in {-1, 1} and the margin
+// s = 2p - 1 of the probability p
+type HingeLoss struct{}
+
+func (HingeLoss) Name() string { return "hinge" }
+
+func (HingeLoss) Loss(p, y float32) float32 {
+	t, s := 2*y-1, 2*p-1
+	return float32(math.Max(0, float64(1-t*s)))
+}
+
+// FocalLoss is the log loss down-weighting the easy samples by
+// (1 - pt)^Gamma and balancing the positives by Alpha, which helps the
+// heavily imbalanced positive rates of the recommendation logs. Gamma 0 and
+// Alpha 0.5 is half the LogLoss.
+type FocalLoss struct {
+	Gamma float32
+	Alpha float32
+}
+
+// NewFocalLoss returns the FocalLoss of the paper defaults, Gamma 2 and
+// Alpha 0.25
+func NewFocalLoss() FocalLoss {
+	return FocalLoss{Gamma: 2, Alpha: 0.25}
+}
+
+func (f FocalLoss) Name() string { return fmt.Sprintf("focal(gamma=%g,alpha=%g)", f.Gamma, f.Alpha) }
+
+func (f FocalLoss) Loss(p, y float32) float32 {
+	q, gamma, alpha := clampProb(p), float64(f.Gamma), float64(f.Alpha)
+	pos := -alpha * math.Pow(1-q, gamma) * math.Log(q)
+	neg := -(1 - alpha) * math.Pow(q, gamma) * math.Log(1-q)
+	return float32(float64(y)*pos + float64(1-y)*neg)
+}
+
+// HuberLoss is the squared error within Delta and the absolute error
+// beyond, for the regression labels with outliers, e.g. the watch time
+type HuberLoss struct {
+	Delta float32
+}
+
+func (h HuberLoss) Name() string { return fmt.Sprintf("huber(delta=%g)", h.Delta) }
+
+func (h HuberLoss) Loss(p, y float32) float32 {
+	d := float32(math.Abs(float64(p - y)))
+	if d <= h.Delta {
+		return d * d / 2
+	}
+	return h.Delta * (d - h.Delta/2)
+}
+
+// MeanLoss is the mean loss of yPred
+func MeanLoss(loss Loss, yPred, y []float32) (mean float64) {
+	if len(yPred) == 0 {
+		return
+	}
+	for i, p := range yPred {
+		mean += float64(loss.Loss(p, y[i]))
+	}
+	return mean / float64(len(yPred))
+}
+
+// setTrainLoss sets TrainLoss to fitter if not nil
+func setTrainLoss(fitter interface{}) error {
+	if TrainLoss == nil {
+		return nil
+	}
+	lf, ok := fitter.(LossFitter)
+	if !ok {
+		return fmt.Errorf("fitter %T does not support the loss %s", fitter, TrainLoss.Name())
+	}
+	lf.SetLoss(TrainLoss)
+	return nil
+}
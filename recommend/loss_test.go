@@ -0,0 +1,64 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type lossFitter struct {
+	idFitter
+	loss Loss
+}
+
+func (f *lossFitter) SetLoss(loss Loss) {
+	f.loss = loss
+}
+
+func TestLoss(t *testing.T) {
+	Convey("loss values", t, func() {
+		So(LogLoss{}.Loss(0.9, 1), ShouldAlmostEqual, 0.10536, 1e-4)
+		So(LogLoss{}.Loss(0, 0), ShouldAlmostEqual, 0, 1e-6)
+
+		// the confident right margins cost nothing
+		So(HingeLoss{}.Loss(1, 1), ShouldEqual, 0)
+		So(HingeLoss{}.Loss(0, 0), ShouldEqual, 0)
+		So(HingeLoss{}.Loss(0.5, 1), ShouldEqual, 1)
+		So(HingeLoss{}.Loss(1, 0), ShouldEqual, 2)
+
+		// the easy samples are down-weighted much more than the hard ones
+		focal := NewFocalLoss()
+		easy := focal.Loss(0.9, 1) / LogLoss{}.Loss(0.9, 1)
+		hard := focal.Loss(0.1, 1) / LogLoss{}.Loss(0.1, 1)
+		So(easy, ShouldBeLessThan, hard/10)
+		So(FocalLoss{Gamma: 0, Alpha: 0.5}.Loss(0.3, 0), ShouldAlmostEqual, LogLoss{}.Loss(0.3, 0)/2, 1e-6)
+
+		// quadratic within delta, linear beyond
+		huber := HuberLoss{Delta: 1}
+		So(huber.Loss(0.5, 0), ShouldAlmostEqual, 0.125, 1e-6)
+		So(huber.Loss(3, 0), ShouldAlmostEqual, 2.5, 1e-6)
+		So(huber.Loss(5, 0)-huber.Loss(4, 0), ShouldAlmostEqual, 1, 1e-6)
+
+		So(MeanLoss(HingeLoss{}, []float32{1, 0.5}, []float32{1, 1}), ShouldAlmostEqual, 0.5, 1e-6)
+		So(MeanLoss(HingeLoss{}, nil, nil), ShouldEqual, 0)
+	})
+
+	Convey("train loss is set to the fitter", t, func() {
+		resetFeatureCache()
+		TrainLoss = NewFocalLoss()
+		defer func() { TrainLoss = nil }()
+
+		Convey("loss fitter", func() {
+			fitter := &lossFitter{}
+			_, err := TrainWithResult(context.Background(), idRecSys{}, fitter)
+			So(err, ShouldBeNil)
+			So(fitter.loss, ShouldResemble, NewFocalLoss())
+		})
+
+		Convey("fitter without loss support", func() {
+			_, err := TrainWithResult(context.Background(), idRecSys{}, &idFitter{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,324 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	cacheUser         = "user"
+	cacheItem         = "item"
+	cacheUserBehavior = "user_behavior"
+
+	// MetricsContentType is the Prometheus text exposition format
+	MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// MetricsBuckets are the upper bounds in seconds of the latency histograms
+	MetricsBuckets = []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+	metricsCaches = []string{cacheUser, cacheItem, cacheUserBehavior}
+	metrics       = newMetricsCollector()
+)
+
+// MetricsCollector collects the serving and training metrics of this package.
+// It is a prometheus.Collector to register with the registry of the user,
+// and an http.Handler writing them in the Prometheus text exposition format,
+// so it could also be scraped directly.
+type MetricsCollector struct {
+	// 64-bit atomic fields first for the alignment on 32-bit platforms
+	batchPredictRows   uint64
+	trainSamples       uint64
+	trainSamplesPerSec uint64 // float64 bits
+
+	batchPredictSeconds *histogram
+	sampleVectorSeconds *histogram
+	providerSeconds     map[string]*histogram
+	cacheHits           map[string]*uint64
+	cacheMisses         map[string]*uint64
+	cacheEvictions      map[string]*uint64
+	imputed             map[string]*uint64
+	pipelineSeconds     map[string]*histogram
+	pipelineCandidates  map[string]*uint64
+
+	// registry of only this collector for WriteTo
+	registry *prometheus.Registry
+}
+
+// Collector returns the MetricsCollector of this package
+func Collector() *MetricsCollector {
+	return metrics
+}
+
+func newMetricsCollector() *MetricsCollector {
+	m := &MetricsCollector{
+		batchPredictSeconds: newHistogram(MetricsBuckets),
+		sampleVectorSeconds: newHistogram(MetricsBuckets),
+		providerSeconds:     make(map[string]*histogram),
+		cacheHits:           make(map[string]*uint64),
+		cacheMisses:         make(map[string]*uint64),
+		cacheEvictions:      make(map[string]*uint64),
+		imputed:             map[string]*uint64{cacheUser: new(uint64), cacheItem: new(uint64)},
+		pipelineSeconds:     make(map[string]*histogram),
+		pipelineCandidates:  make(map[string]*uint64),
+	}
+	for _, stage := range pipelineStages {
+		m.pipelineSeconds[stage] = newHistogram(MetricsBuckets)
+		m.pipelineCandidates[stage] = new(uint64)
+	}
+	for _, c := range metricsCaches {
+		m.providerSeconds[c] = newHistogram(MetricsBuckets)
+		m.cacheHits[c] = new(uint64)
+		m.cacheMisses[c] = new(uint64)
+		m.cacheEvictions[c] = new(uint64)
+	}
+	m.registry = prometheus.NewRegistry()
+	m.registry.MustRegister(m)
+	return m
+}
+
+type histogram struct {
+	sync.Mutex
+	bounds []float64
+	counts []uint64 // not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	h.Lock()
+	defer h.Unlock()
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// meanAndQuantile returns the mean and the upper bound of the bucket of the
+// q quantile, the last bound if it is beyond
+func (h *histogram) meanAndQuantile(q float64) (mean, quantile float64) {
+	h.Lock()
+	defer h.Unlock()
+	if h.count == 0 {
+		return
+	}
+	mean = h.sum / float64(h.count)
+	rank, cum := uint64(q*float64(h.count)), uint64(0)
+	quantile = h.bounds[len(h.bounds)-1]
+	for i, c := range h.counts {
+		if cum += c; cum > rank {
+			return mean, h.bounds[i]
+		}
+	}
+	return
+}
+
+// metric returns the const histogram of h of desc
+func (h *histogram) metric(desc *prometheus.Desc, labels ...string) prometheus.Metric {
+	h.Lock()
+	defer h.Unlock()
+	var (
+		buckets = make(map[float64]uint64, len(h.bounds))
+		cum     uint64
+	)
+	for i, b := range h.bounds {
+		cum += h.counts[i]
+		buckets[b] = cum
+	}
+	return prometheus.MustNewConstHistogram(desc, h.count, h.sum, buckets, labels...)
+}
+
+func (h *histogram) since(start time.Time) {
+	h.observe(time.Since(start).Seconds())
+}
+
+// fetchCache is ccache.Fetch counting the hit and miss of cache named name,
+// the value fetched is only cached if the admission policy of name admits
+// it. The entries expired within StaleWhileRevalidate are served as hits
+// and refreshed in the background.
+func fetchCache(ctx context.Context, cache *ccache.Cache, name string, key string, duration time.Duration,
+	fetch func(ctx context.Context) (interface{}, error)) (value interface{}, err error) {
+	if value, ok := serveStale(ctx, cache, name, key, duration, fetch); ok {
+		atomic.AddUint64(metrics.cacheHits[name], 1)
+		return value, nil
+	}
+	if admission := admissionOf(name); admission != nil {
+		admission.Record(key)
+		if item := cache.Get(key); item != nil && !item.Expired() {
+			atomic.AddUint64(metrics.cacheHits[name], 1)
+			return item.Value(), nil
+		}
+		atomic.AddUint64(metrics.cacheMisses[name], 1)
+		start := time.Now()
+		value, err = fetch(ctx)
+		metrics.providerSeconds[name].since(start)
+		if err == nil && admission.Admit(cache, key) {
+			cache.Set(key, value, duration)
+		}
+		return
+	}
+	miss := false
+	item, err := cache.Fetch(key, duration, func() (interface{}, error) {
+		miss = true
+		defer metrics.providerSeconds[name].since(time.Now())
+		return fetch(ctx)
+	})
+	if miss {
+		atomic.AddUint64(metrics.cacheMisses[name], 1)
+	} else if err == nil {
+		atomic.AddUint64(metrics.cacheHits[name], 1)
+	}
+	if err != nil {
+		return
+	}
+	return item.Value(), nil
+}
+
+func (m *MetricsCollector) setTrainThroughput(samples uint64, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	atomic.StoreUint64(&m.trainSamplesPerSec, math.Float64bits(float64(samples)/d.Seconds()))
+}
+
+// WriteTo writes all the metrics in the Prometheus text exposition format
+func (m *MetricsCollector) WriteTo(w io.Writer) (n int64, err error) {
+	mfs, err := m.registry.Gather()
+	if err != nil {
+		return
+	}
+	var bw bytes.Buffer
+	enc := expfmt.NewEncoder(&bw, expfmt.FmtText)
+	for _, mf := range mfs {
+		if err = enc.Encode(mf); err != nil {
+			return
+		}
+	}
+	return bw.WriteTo(w)
+}
+
+func (m *MetricsCollector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", MetricsContentType)
+	m.WriteTo(w)
+}
+
+var (
+	batchPredictSecondsDesc = newMetricDesc("ctr_batch_predict_seconds", "Latency of BatchPredict.")
+	batchPredictRowsDesc    = newMetricDesc("ctr_batch_predict_rows_total", "Rows predicted by BatchPredict.")
+	sampleVectorSecondsDesc = newMetricDesc("ctr_sample_vector_seconds", "Latency of GetSampleVector.")
+	providerSecondsDesc     = newMetricDesc("ctr_feature_provider_seconds", "Latency of the feature provider on cache miss.", "feature")
+	cacheRequestsDesc       = newMetricDesc("ctr_cache_requests_total", "Feature cache lookups by result.", "cache", "result")
+	cacheEvictionsDesc      = newMetricDesc("ctr_cache_evictions_total", "Feature cache items evicted.", "cache")
+	cacheItemsDesc          = newMetricDesc("ctr_cache_items", "Feature cache items.", "cache")
+	imputedDesc             = newMetricDesc("ctr_imputed_features_total", "Features imputed in predict by the Imputers.", "feature")
+	pipelineSecondsDesc     = newMetricDesc("ctr_pipeline_stage_seconds", "Latency of the Pipeline stages.", "stage")
+	pipelineCandidatesDesc  = newMetricDesc("ctr_pipeline_candidates_total", "Candidates passed on by the Pipeline stages.", "stage")
+	trainSamplesDesc        = newMetricDesc("ctr_train_samples_total", "Training samples assembled.")
+	trainSamplesPerSecDesc  = newMetricDesc("ctr_train_samples_per_second", "Sample throughput of the last training.")
+	quotaRequestsDesc       = newMetricDesc("ctr_quota_requests_total", "Recommend api requests by tenant, surface and quota result.", "tenant", "surface", "result")
+	breakerStateDesc        = newMetricDesc("ctr_breaker_state", "Feature provider circuit breaker state, 0 closed, 1 open, 2 half-open.", "feature")
+	breakerRejectedDesc     = newMetricDesc("ctr_breaker_rejected_total", "Feature fetches rejected by the open circuit breaker.", "feature")
+	breakerRetriesDesc      = newMetricDesc("ctr_breaker_retries_total", "Feature fetches retried after a provider failure.", "feature")
+	predictionsDroppedDesc  = newMetricDesc("ctr_prediction_log_dropped_total", "Predictions dropped of the full PredictionLog queue.")
+	postProcessSecondsDesc  = newMetricDesc("ctr_post_processor_seconds", "Latency of the score post-processors by name.", "name")
+	postProcessErrorsDesc   = newMetricDesc("ctr_post_processor_errors_total", "Errors of the score post-processors by name.", "name")
+
+	metricDescs = []*prometheus.Desc{
+		batchPredictSecondsDesc, batchPredictRowsDesc, sampleVectorSecondsDesc, providerSecondsDesc,
+		cacheRequestsDesc, cacheEvictionsDesc, cacheItemsDesc, imputedDesc,
+		pipelineSecondsDesc, pipelineCandidatesDesc, trainSamplesDesc, trainSamplesPerSecDesc,
+		quotaRequestsDesc, breakerStateDesc, breakerRejectedDesc, breakerRetriesDesc,
+		predictionsDroppedDesc, postProcessSecondsDesc, postProcessErrorsDesc,
+	}
+)
+
+func newMetricDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, labels, nil)
+}
+
+// Describe implements prometheus.Collector
+func (m *MetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range metricDescs {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector, the metrics of Quotas,
+// ProviderBreaker, PredictionLog and PostProcessors are collected only if
+// they are set
+func (m *MetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	counter := func(desc *prometheus.Desc, v uint64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(v), labels...)
+	}
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+	}
+
+	ch <- m.batchPredictSeconds.metric(batchPredictSecondsDesc)
+	counter(batchPredictRowsDesc, atomic.LoadUint64(&m.batchPredictRows))
+	ch <- m.sampleVectorSeconds.metric(sampleVectorSecondsDesc)
+	for _, c := range metricsCaches {
+		ch <- m.providerSeconds[c].metric(providerSecondsDesc, c)
+		counter(cacheRequestsDesc, atomic.LoadUint64(m.cacheHits[c]), c, "hit")
+		counter(cacheRequestsDesc, atomic.LoadUint64(m.cacheMisses[c]), c, "miss")
+		counter(cacheEvictionsDesc, m.evictions(c), c)
+		size := 0
+		if cache := cacheOf(c); cache != nil {
+			size = cache.ItemCount()
+		}
+		gauge(cacheItemsDesc, float64(size), c)
+	}
+	for _, c := range []string{cacheUser, cacheItem} {
+		counter(imputedDesc, atomic.LoadUint64(m.imputed[c]), c)
+	}
+	for _, stage := range pipelineStages {
+		ch <- m.pipelineSeconds[stage].metric(pipelineSecondsDesc, stage)
+		counter(pipelineCandidatesDesc, atomic.LoadUint64(m.pipelineCandidates[stage]), stage)
+	}
+	counter(trainSamplesDesc, atomic.LoadUint64(&m.trainSamples))
+	gauge(trainSamplesPerSecDesc, math.Float64frombits(atomic.LoadUint64(&m.trainSamplesPerSec)))
+
+	if quotas := Quotas; quotas != nil {
+		quotas.eachCount(func(tenant, surface string, allowed, rejected uint64) {
+			counter(quotaRequestsDesc, allowed, tenant, surface, "allowed")
+			counter(quotaRequestsDesc, rejected, tenant, surface, "rejected")
+		})
+	}
+	if breaker := ProviderBreaker; breaker != nil {
+		stats := breaker.Stats()
+		for _, c := range []string{cacheUser, cacheItem} {
+			gauge(breakerStateDesc, float64(breaker.State(c)), c)
+			counter(breakerRejectedDesc, stats[c].Rejected, c)
+			counter(breakerRetriesDesc, stats[c].Retries, c)
+		}
+	}
+	if PredictionLog != nil {
+		counter(predictionsDroppedDesc, atomic.LoadUint64(&predictionsDropped))
+	}
+	if pp := PostProcessors; pp != nil {
+		pp.each(func(name string, p *postProcessor) {
+			ch <- p.seconds.metric(postProcessSecondsDesc, name)
+			counter(postProcessErrorsDesc, atomic.LoadUint64(&p.errors), name)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("prometheus metrics", t, func() {
+		resetFeatureCache()
+		var (
+			ctx       = context.Background()
+			rows      = atomic.LoadUint64(&metrics.batchPredictRows)
+			itemHits  = atomic.LoadUint64(metrics.cacheHits[cacheItem])
+			itemMiss  = atomic.LoadUint64(metrics.cacheMisses[cacheItem])
+			userHits  = atomic.LoadUint64(metrics.cacheHits[cacheUser])
+			predicted = metrics.batchPredictSeconds.count
+		)
+		_, err := Rank(ctx, idPredictor{}, 1, []int{1, 2, 3})
+		So(err, ShouldBeNil)
+		_, err = Rank(ctx, idPredictor{}, 1, []int{1, 2})
+		So(err, ShouldBeNil)
+
+		So(atomic.LoadUint64(&metrics.batchPredictRows)-rows, ShouldEqual, 5)
+		So(atomic.LoadUint64(metrics.cacheMisses[cacheItem])-itemMiss, ShouldEqual, 3)
+		So(atomic.LoadUint64(metrics.cacheHits[cacheItem])-itemHits, ShouldEqual, 2)
+		So(atomic.LoadUint64(metrics.cacheHits[cacheUser])-userHits, ShouldEqual, 4)
+		So(metrics.batchPredictSeconds.count-predicted, ShouldEqual, 2)
+
+		var buf bytes.Buffer
+		n, err := Collector().WriteTo(&buf)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, buf.Len())
+		out := buf.String()
+		So(out, ShouldContainSubstring, "# TYPE ctr_batch_predict_seconds histogram\n")
+		So(out, ShouldContainSubstring, `ctr_feature_provider_seconds_bucket{feature="item",le="+Inf"}`)
+		So(out, ShouldContainSubstring, `ctr_cache_requests_total{cache="item",result="miss"}`)
+		So(out, ShouldContainSubstring, `ctr_imputed_features_total{feature="user"}`)
+		So(out, ShouldContainSubstring, "ctr_train_samples_per_second ")
+
+		w := httptest.NewRecorder()
+		Collector().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		So(w.Header().Get("Content-Type"), ShouldEqual, MetricsContentType)
+		So(strings.Count(w.Body.String(), "# TYPE"), ShouldEqual, 12)
+
+		// registered with the registry of the user
+		reg := prometheus.NewPedanticRegistry()
+		So(reg.Register(Collector()), ShouldBeNil)
+		mfs, err := reg.Gather()
+		So(err, ShouldBeNil)
+		So(mfs, ShouldHaveLength, 12)
+		So(mfs[0].GetName(), ShouldEqual, "ctr_batch_predict_rows_total")
+	})
+}
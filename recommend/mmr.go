@@ -0,0 +1,64 @@
+package recommend
+
+import (
+	"github.com/auxten/go-ctr/utils"
+)
+
+// ReRankMMR reorders itemScores by Maximal Marginal Relevance and returns
+// the top k of them, k <= 0 means all.
+//
+//	mmr(i) = lambda * score(i) - (1 - lambda) * max(sim(i, j) for j selected)
+//
+// sim is the cosine similarity of item embeddings, items
+// without embedding are treated as dissimilar to all others.
+// lambda = 1 is pure relevance, lambda = 0 is pure diversity.
+func ReRankMMR(itemScores []ItemScore, lambda float32, k int) (result []ItemScore) {
+	if k <= 0 || k > len(itemScores) {
+		k = len(itemScores)
+	}
+	var (
+		embs     = make([][]float32, len(itemScores))
+		maxSim   = make([]float32, len(itemScores))
+		selected = make([]bool, len(itemScores))
+	)
+	for i, is := range itemScores {
+		embs[i], _ = getItemEmbedding(is.ItemId)
+		maxSim[i] = -1
+	}
+
+	result = make([]ItemScore, 0, k)
+	for len(result) < k {
+		var (
+			best    = -1
+			bestMmr float32
+		)
+		for i, is := range itemScores {
+			if selected[i] {
+				continue
+			}
+			var penalty float32
+			if maxSim[i] > 0 {
+				penalty = maxSim[i]
+			}
+			mmr := lambda*is.Score - (1-lambda)*penalty
+			if best == -1 || mmr > bestMmr {
+				best, bestMmr = i, mmr
+			}
+		}
+		selected[best] = true
+		result = append(result, itemScores[best])
+		// update the max similarity to the selected items
+		if embs[best] == nil {
+			continue
+		}
+		for i := range itemScores {
+			if selected[i] || embs[i] == nil {
+				continue
+			}
+			if sim := utils.Cosine32(embs[i], embs[best]); sim > maxSim[i] {
+				maxSim[i] = sim
+			}
+		}
+	}
+	return
+}
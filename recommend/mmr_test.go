@@ -0,0 +1,29 @@
+package recommend
+
+import (
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReRankMMR(t *testing.T) {
+	Convey("mmr re-rank", t, func() {
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{
+			"1": {1, 0},
+			"2": {0.99, 0.01},
+			"3": {0, 1},
+		})
+		defer itemEmbeddingMap.store(nil)
+		scores := []ItemScore{
+			{ItemId: 1, Score: 0.9},
+			{ItemId: 2, Score: 0.85},
+			{ItemId: 3, Score: 0.5},
+			{ItemId: 4, Score: 0.1},
+		}
+		So(scoredIds(ReRankMMR(scores, 1, 0)), ShouldResemble, []int{1, 2, 3, 4})
+		// 2 is near duplicate of 1
+		So(scoredIds(ReRankMMR(scores, 0.5, 3)), ShouldResemble, []int{1, 3, 4})
+		So(scoredIds(ReRankMMR(scores, 0.7, 0)), ShouldResemble, []int{1, 3, 2, 4})
+	})
+}
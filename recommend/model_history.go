@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ModelHistory records the ModelRecord of every successful Train for the
+// dashboard to plot the metrics over the trainings, nil disables it
+var ModelHistory ModelHistoryStore
+
+const (
+	modelVersionKey ctxKey = "modelVersion"
+
+	defaultModelHistorySize = 1000
+)
+
+// ModelRecord is the result of a Train of a model version, Eval is nil if
+// ImportanceRows is 0 or the Fitter is a StreamFitter
+type ModelRecord struct {
+	Version     string       `json:"version"`
+	TrainedAt   int64        `json:"trainedAt"`
+	SampleCount int          `json:"sampleCount"`
+	Duration    float64      `json:"duration"` // in seconds
+	Eval        *EvalMetrics `json:"eval,omitempty"`
+}
+
+// ModelHistoryOverview is the dashboard method of the model history, the
+// ModelHistoryStore and optionally the Predictor of StartHttpApi
+type ModelHistoryOverview interface {
+	// GetModelHistory returns the ModelRecords in time asc order
+	GetModelHistory(ctx context.Context) ([]ModelRecord, error)
+}
+
+type ModelHistoryStore interface {
+	ModelHistoryOverview
+	// Record appends rec to the history
+	Record(ctx context.Context, rec ModelRecord) error
+}
+
+// WithModelVersion returns the ctx of Train recording the model as version,
+// TrainResult.Version is the start time of Train otherwise. In the ctx of
+// Rank it is the Version of the PredictionEvents.
+func WithModelVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, modelVersionKey, version)
+}
+
+// modelVersionOf returns the version of WithModelVersion, or of start
+func modelVersionOf(ctx context.Context, start time.Time) string {
+	if version, ok := ctx.Value(modelVersionKey).(string); ok && version != "" {
+		return version
+	}
+	return start.Format("20060102-150405")
+}
+
+// recordModel records the ModelRecord of result to ModelHistory if set
+func recordModel(ctx context.Context, result *TrainResult, start time.Time) {
+	if ModelHistory == nil || result == nil {
+		return
+	}
+	rec := ModelRecord{
+		Version:     result.Version,
+		TrainedAt:   start.Unix(),
+		SampleCount: result.SampleCount,
+		Duration:    time.Since(start).Seconds(),
+		Eval:        result.Eval,
+	}
+	if err := ModelHistory.Record(ctx, rec); err != nil {
+		log.Errorf("record model history error: %v", err)
+	}
+}
+
+// MemModelHistory is an in memory ModelHistoryStore keeping the latest
+// MaxRecords records
+type MemModelHistory struct {
+	sync.RWMutex
+	MaxRecords int
+	records    []ModelRecord
+}
+
+func NewMemModelHistory(maxRecords int) *MemModelHistory {
+	if maxRecords <= 0 {
+		maxRecords = defaultModelHistorySize
+	}
+	return &MemModelHistory{MaxRecords: maxRecords}
+}
+
+func (h *MemModelHistory) Record(_ context.Context, rec ModelRecord) error {
+	h.Lock()
+	defer h.Unlock()
+	h.records = append(h.records, rec)
+	if len(h.records) > h.MaxRecords {
+		// copy to release the underlying array of dropped records
+		h.records = append([]ModelRecord(nil), h.records[len(h.records)-h.MaxRecords:]...)
+	}
+	return nil
+}
+
+func (h *MemModelHistory) GetModelHistory(_ context.Context) ([]ModelRecord, error) {
+	h.RLock()
+	defer h.RUnlock()
+	return append([]ModelRecord(nil), h.records...), nil
+}
@@ -0,0 +1,47 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestModelHistory(t *testing.T) {
+	Convey("model metrics history", t, func() {
+		ctx := context.Background()
+		h := NewMemModelHistory(2)
+		for _, version := range []string{"v1", "v2", "v3"} {
+			So(h.Record(ctx, ModelRecord{Version: version}), ShouldBeNil)
+		}
+		records, err := h.GetModelHistory(ctx)
+		So(err, ShouldBeNil)
+		So(records, ShouldHaveLength, 2)
+		So(records[0].Version, ShouldEqual, "v2")
+		So(records[1].Version, ShouldEqual, "v3")
+	})
+
+	Convey("recorded by Train", t, func() {
+		resetFeatureCache()
+		defer func(rows int) {
+			ModelHistory, ImportanceRows = nil, rows
+		}(ImportanceRows)
+		ModelHistory, ImportanceRows = NewMemModelHistory(0), 200
+		ctx := WithModelVersion(context.Background(), "v1")
+		result, err := TrainWithResult(ctx, idRecSys{}, &idFitter{})
+		So(err, ShouldBeNil)
+		So(result.Version, ShouldEqual, "v1")
+		_, err = TrainWithResult(context.Background(), idRecSys{}, &idFitter{})
+		So(err, ShouldBeNil)
+
+		records, err := ModelHistory.GetModelHistory(context.Background())
+		So(err, ShouldBeNil)
+		So(records, ShouldHaveLength, 2)
+		So(records[0].Version, ShouldEqual, "v1")
+		So(records[0].SampleCount, ShouldEqual, 1000)
+		So(records[0].Eval, ShouldNotBeNil)
+		So(records[0].Eval.Rows, ShouldEqual, 200)
+		So(records[1].Version, ShouldNotBeEmpty)
+		So(records[1].TrainedAt, ShouldBeGreaterThanOrEqualTo, records[0].TrainedAt)
+	})
+}
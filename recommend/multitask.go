@@ -0,0 +1,57 @@
+package recommend
+
+import (
+	"fmt"
+
+	"gorgonia.org/tensor"
+)
+
+// ScoreFormula combines the scores of the tasks of a multi-task model into
+// the score ranked by, e.g. ProductScore for pCTR * pCVR. The Predict of a
+// multi-task model returns the combined score in the first column and the
+// task scores in the next ones, which Rank returns as ItemScore.Tasks.
+type ScoreFormula func(tasks []float32) float32
+
+// ProductScore is the product of the task scores, the pCTCVR of the click
+// and conversion tasks
+func ProductScore(tasks []float32) float32 {
+	score := float32(1)
+	for _, s := range tasks {
+		score *= s
+	}
+	return score
+}
+
+// WeightedScore returns the ScoreFormula of the weighted sum of the task
+// scores, the tasks without a weight are ignored
+func WeightedScore(weights ...float32) ScoreFormula {
+	return func(tasks []float32) (score float32) {
+		for i, s := range tasks {
+			if i < len(weights) {
+				score += weights[i] * s
+			}
+		}
+		return
+	}
+}
+
+// fillTaskScores sets the Tasks of itemScores from the columns after the
+// first of y if any
+func fillTaskScores(y tensor.Tensor, itemScores []ItemScore) (err error) {
+	shape := y.Shape()
+	if len(shape) != 2 || shape[1] < 2 {
+		return
+	}
+	for i := range itemScores {
+		tasks := make([]float32, shape[1]-1)
+		for t := range tasks {
+			var v interface{}
+			if v, err = y.At(i, t+1); err != nil {
+				return fmt.Errorf("get task %d score of line:%d error: %v", t, i, err)
+			}
+			tasks[t] = v.(float32)
+		}
+		itemScores[i].Tasks = tasks
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// conversionRecSys is idRecSys with the conversion label of the even items
+type conversionRecSys struct {
+	idRecSys
+}
+
+func (conversionRecSys) SampleGenerator(ctx context.Context) (<-chan Sample, error) {
+	ch := make(chan Sample)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 100; i++ {
+			s := Sample{UserId: i % 7, ItemId: i}
+			if i >= 50 {
+				s.Label = 1
+			}
+			s.Labels = []float32{s.Label * float32(1-i%2)}
+			ch <- s
+		}
+	}()
+	return ch, nil
+}
+
+// taskPredictor scores the item id / 100 as pCTR and 0.5 as pCVR
+type taskPredictor struct {
+	idPredictor
+}
+
+func (taskPredictor) Predict(X tensor.Tensor) tensor.Tensor {
+	rows, cols := X.Shape()[0], X.Shape()[1]
+	data := X.Data().([]float32)
+	y := make([]float32, rows*3)
+	for i := 0; i < rows; i++ {
+		tasks := y[i*3+1 : i*3+3]
+		tasks[0], tasks[1] = data[(i+1)*cols-1]/100, 0.5
+		y[i*3] = ProductScore(tasks)
+	}
+	return tensor.New(tensor.WithShape(rows, 3), tensor.WithBacking(y))
+}
+
+func TestMultiTask(t *testing.T) {
+	Convey("multi-task labels", t, func() {
+		resetFeatureCache()
+		sample, err := GetSample(conversionRecSys{}, context.Background())
+		So(err, ShouldBeNil)
+		So(sample.Tasks, ShouldEqual, 2)
+		So(sample.Labels, ShouldHaveLength, 2*sample.Rows)
+		for i := 0; i < sample.Rows; i++ {
+			So(sample.Labels[2*i], ShouldEqual, sample.Y[i])
+			So(sample.Labels[2*i+1], ShouldBeLessThanOrEqualTo, sample.Y[i])
+		}
+
+		train, valid := splitValidation(sample, 20)
+		So(train.Labels, ShouldHaveLength, 2*train.Rows)
+		So(valid.Labels, ShouldHaveLength, 2*valid.Rows)
+	})
+
+	Convey("task scores", t, func() {
+		resetFeatureCache()
+		scores, err := Rank(context.Background(), taskPredictor{}, 1, []int{40, 80})
+		So(err, ShouldBeNil)
+		So(scores[0].Tasks, ShouldResemble, []float32{0.4, 0.5})
+		So(scores[0].Score, ShouldAlmostEqual, 0.2, 1e-6)
+		So(scores[1].Tasks, ShouldResemble, []float32{0.8, 0.5})
+
+		scores, err = Rank(context.Background(), idPredictor{}, 1, []int{40})
+		So(err, ShouldBeNil)
+		So(scores[0].Tasks, ShouldBeNil)
+		So(WeightedScore(2, 1)([]float32{0.4, 0.5}), ShouldAlmostEqual, 1.3, 1e-6)
+	})
+}
@@ -0,0 +1,70 @@
+package recommend
+
+import (
+	"context"
+
+	"github.com/auxten/go-ctr/feature/embedding/node2vec"
+	log "github.com/sirupsen/logrus"
+)
+
+// ItemSession is implemented by the recSys providing the item sessions, e.g.
+// the items viewed by a user within 30 minutes. If implemented, Train learns
+// the item embedding from the node2vec walks on the item co-occurrence graph
+// of the sessions instead of ItemSeqGenerator, which handles the short
+// sessions better.
+type ItemSession interface {
+	ItemSessionGenerator(context.Context) (<-chan []string, error)
+}
+
+// Node2VecOptions is used by Train if the recSys implements ItemSession
+var Node2VecOptions = node2vec.DefaultOptions()
+
+// Node2VecItemEmbedding is an ItemEmbedding generating the node2vec walks on
+// the item co-occurrence graph of Sessions
+type Node2VecItemEmbedding struct {
+	Sessions ItemSession
+	Options  node2vec.Options
+}
+
+func (n *Node2VecItemEmbedding) ItemSeqGenerator(ctx context.Context) (<-chan string, error) {
+	sessions, err := n.Sessions.ItemSessionGenerator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	graph := node2vec.NewGraph()
+	for session := range sessions {
+		graph.AddSession(session, n.Options.Window)
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	log.Debugf("item co-occurrence graph of %d items built", graph.Len())
+
+	ch := make(chan string, 1000)
+	go func() {
+		defer close(ch)
+		err := graph.Walk(ctx, n.Options, func(walk []string) error {
+			for _, item := range walk {
+				select {
+				case ch <- item:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("node2vec walk error: %v", err)
+		}
+	}()
+	return ch, nil
+}
+
+// itemEmbeddingOfRecSys returns the ItemEmbedding used by Train
+func itemEmbeddingOfRecSys(recSys RecSys) (itemEbd ItemEmbedding, ok bool) {
+	if sessions, isSession := recSys.(ItemSession); isSession {
+		return &Node2VecItemEmbedding{Sessions: sessions, Options: Node2VecOptions}, true
+	}
+	itemEbd, ok = recSys.(ItemEmbedding)
+	return
+}
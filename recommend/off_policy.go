@@ -0,0 +1,141 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// OffPolicyWeightClip clips the importance weights of EvaluateOffPolicy to
+// bound the variance of the rare actions, 0 means no clipping
+var OffPolicyWeightClip float64
+
+// LoggedRecord is an action of the logging policy and its reward, e.g. the
+// item shown of the candidates ranked with an ExplorationPolicy and whether
+// it is clicked
+type LoggedRecord struct {
+	// UserId and ItemIds are the context, the candidates ranked
+	UserId  int   `json:"userId"`
+	ItemIds []int `json:"itemIds"`
+	// Action is the item shown of the Propensity of the logging policy
+	Action     int     `json:"action"`
+	Propensity float64 `json:"propensity"`
+	Reward     float64 `json:"reward"`
+	// Timestamp is the unix milliseconds of the action like
+	// PredictionEvent.Timestamp, the candidates are scored as of it, 0 means
+	// now
+	Timestamp int64 `json:"ts,omitempty"`
+}
+
+// OffPolicyEstimate is the estimated reward per record of a new policy on
+// the records of the logging policy
+type OffPolicyEstimate struct {
+	Records int `json:"records"`
+	// Skipped are the records of no positive Propensity or failed to rank
+	Skipped int `json:"skipped"`
+	// LoggedReward is the mean reward of the logging policy
+	LoggedReward float64 `json:"loggedReward"`
+	IPS          float64 `json:"ips"`
+	SNIPS        float64 `json:"snips"`
+	// EffectiveSize is (sum w)^2 / sum w^2 of the importance weights w, the
+	// estimate is unreliable if it is much less than Records
+	EffectiveSize float64 `json:"effectiveSize"`
+	MaxWeight     float64 `json:"maxWeight"`
+}
+
+// EvaluateOffPolicy estimates the reward of recSys as the policy choosing
+// the item of the records by the IPS and the SNIPS estimators, so model
+// candidates could be compared without an A/B test. The policy is the top
+// scored item of the model if temperature is 0, or else the softmax of the
+// scores of temperature. The candidates are scored as is, the seen filter,
+// the exploration and the post-processing of Rank are not applied and
+// nothing is logged to PredictionLog. The records must be logged by a
+// stochastic policy, e.g. of an ExplorationPolicy, the actions of
+// propensity 1 tell nothing of the other items.
+func EvaluateOffPolicy(ctx context.Context, recSys Predictor, records []LoggedRecord, temperature float64) (est *OffPolicyEstimate, err error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no logged record to evaluate")
+	}
+	est = &OffPolicyEstimate{}
+	var sumW, sumW2, sumWR, sumR float64
+	for _, rec := range records {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if rec.Propensity <= 0 || len(rec.ItemIds) == 0 {
+			est.Skipped++
+			continue
+		}
+		prob, er := policyProb(ctx, recSys, rec, temperature)
+		if er != nil {
+			logOf(ctx).Warnf("skip the logged record of user %d: %v", rec.UserId, er)
+			est.Skipped++
+			continue
+		}
+		w := prob / rec.Propensity
+		if OffPolicyWeightClip > 0 && w > OffPolicyWeightClip {
+			w = OffPolicyWeightClip
+		}
+		est.Records++
+		est.MaxWeight = math.Max(est.MaxWeight, w)
+		sumW += w
+		sumW2 += w * w
+		sumWR += w * rec.Reward
+		sumR += rec.Reward
+	}
+	if est.Records == 0 {
+		return nil, fmt.Errorf("all the %d logged records skipped", len(records))
+	}
+	n := float64(est.Records)
+	est.LoggedReward = sumR / n
+	est.IPS = sumWR / n
+	if sumW > 0 {
+		est.SNIPS = sumWR / sumW
+		est.EffectiveSize = sumW * sumW / sumW2
+	}
+	return
+}
+
+// policyProb returns the probability of recSys choosing rec.Action
+func policyProb(ctx context.Context, recSys Predictor, rec LoggedRecord, temperature float64) (prob float64, err error) {
+	if ctx, recSys, err = servingModel(ctx, recSys); err != nil {
+		return
+	}
+	ts := rec.Timestamp / 1000
+	if rec.Timestamp == 0 {
+		ts = time.Now().Unix()
+	}
+	itemScores, err := scoreChunk(ctx, recSys, rec.UserId, rec.ItemIds, ts)
+	if err != nil {
+		return
+	}
+	if temperature <= 0 {
+		top := itemScores[0]
+		for _, is := range itemScores[1:] {
+			if is.Score > top.Score {
+				top = is
+			}
+		}
+		if top.ItemId == rec.Action {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	var (
+		maxScore = math.Inf(-1)
+		sum      float64
+		action   float64
+	)
+	for _, is := range itemScores {
+		maxScore = math.Max(maxScore, float64(is.Score))
+	}
+	for _, is := range itemScores {
+		e := math.Exp((float64(is.Score) - maxScore) / temperature)
+		sum += e
+		if is.ItemId == rec.Action {
+			action = e
+		}
+	}
+	return action / sum, nil
+}
@@ -0,0 +1,97 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// hourPredictor scores 1 the item of the id of the hour of the sample, 0
+// the others
+type hourPredictor struct {
+	idPredictor
+}
+
+func (hourPredictor) GetCtxFeature(_ context.Context, sample *Sample) (Tensor, error) {
+	if int64(sample.ItemId) == sample.Timestamp/3600%24 {
+		return Tensor{1}, nil
+	}
+	return Tensor{0}, nil
+}
+
+func TestEvaluateOffPolicy(t *testing.T) {
+	Convey("estimate the reward of a new policy", t, func() {
+		resetFeatureCache()
+		defer func() { OffPolicyWeightClip = 0 }()
+		ctx := context.Background()
+		candidates := []int{1, 2, 3}
+		// the uniform logging policy, idPredictor always chooses the item 3
+		records := []LoggedRecord{
+			{UserId: 1, ItemIds: candidates, Action: 3, Propensity: 1. / 3, Reward: 1},
+			{UserId: 1, ItemIds: candidates, Action: 1, Propensity: 1. / 3, Reward: 0},
+			{UserId: 2, ItemIds: candidates, Action: 2, Propensity: 1. / 3, Reward: 1},
+			{UserId: 2, ItemIds: candidates, Action: 3, Propensity: 1. / 3, Reward: 0},
+			{UserId: 3, ItemIds: candidates, Action: 3, Propensity: 0, Reward: 1},
+		}
+
+		est, err := EvaluateOffPolicy(ctx, idPredictor{}, records, 0)
+		So(err, ShouldBeNil)
+		So(est.Records, ShouldEqual, 4)
+		So(est.Skipped, ShouldEqual, 1)
+		So(est.LoggedReward, ShouldAlmostEqual, 0.5)
+		So(est.IPS, ShouldAlmostEqual, 0.75)
+		So(est.SNIPS, ShouldAlmostEqual, 0.5)
+		So(est.EffectiveSize, ShouldAlmostEqual, 2)
+		So(est.MaxWeight, ShouldAlmostEqual, 3)
+
+		OffPolicyWeightClip = 2
+		est, err = EvaluateOffPolicy(ctx, idPredictor{}, records, 0)
+		So(err, ShouldBeNil)
+		So(est.IPS, ShouldAlmostEqual, 0.5)
+		So(est.MaxWeight, ShouldAlmostEqual, 2)
+		OffPolicyWeightClip = 0
+
+		// the softmax of a high temperature is about the logging policy
+		est, err = EvaluateOffPolicy(ctx, idPredictor{}, records, 1e6)
+		So(err, ShouldBeNil)
+		So(est.IPS, ShouldAlmostEqual, est.LoggedReward, 1e-3)
+		So(est.SNIPS, ShouldAlmostEqual, est.LoggedReward, 1e-3)
+
+		// the model scores only, neither post-processed nor logged
+		defer func(pp *PostProcessorRegistry) { PostProcessors = pp }(PostProcessors)
+		PostProcessors = NewPostProcessorRegistry()
+		So(PostProcessors.Register("boost", Boost(map[int]float32{1: 10})), ShouldBeNil)
+		So(PostProcessors.SetProfile("", "boost"), ShouldBeNil)
+		producer := &memKafkaProducer{}
+		PredictionLog = NewKafkaPredictionSink(producer, "predictions")
+		defer func() { PredictionLog = nil }()
+		est, err = EvaluateOffPolicy(ctx, idPredictor{}, records, 0)
+		So(err, ShouldBeNil)
+		So(est.IPS, ShouldAlmostEqual, 0.75)
+		FlushPredictionLog()
+		So(producer.values, ShouldBeEmpty)
+
+		_, err = EvaluateOffPolicy(ctx, idPredictor{}, nil, 0)
+		So(err, ShouldNotBeNil)
+		_, err = EvaluateOffPolicy(ctx, idPredictor{}, records[4:], 0)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("score as of the logged time", t, func() {
+		defer func(w int) { CtxFeatureWidth = w }(CtxFeatureWidth)
+		resetFeatureCache()
+		CtxFeatureWidth = 1
+		hour := int64(time.Now().UTC().Hour())
+		// the item of the hour 2 hours after now is chosen then
+		action := int((hour + 2) % 24)
+		records := []LoggedRecord{{
+			UserId: 1, ItemIds: []int{30, action}, Action: action, Propensity: 0.5, Reward: 1,
+			Timestamp: int64(action) * 3600 * 1000,
+		}}
+		est, err := EvaluateOffPolicy(context.Background(), hourPredictor{}, records, 0)
+		So(err, ShouldBeNil)
+		So(est.IPS, ShouldAlmostEqual, 2)
+	})
+}
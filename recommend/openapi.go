@@ -0,0 +1,231 @@
+package recommend
+
+import (
+	"reflect"
+	"strings"
+)
+
+// OpenAPIVersion is the version of the api in the OpenAPI document
+var OpenAPIVersion = "1.0.0"
+
+type apiOperation struct {
+	method   string
+	path     string
+	summary  string
+	params   []string // required query params
+	optional []string // optional query params
+	request  interface{}
+	response interface{}
+	edge     bool // available in the edge profile
+}
+
+// OpenAPISpec returns the OpenAPI 3 document of the http api started by
+// StartHttpApi with rankPath, schemas are derived from the Go types.
+// Only the api subset is documented in the edge profile.
+func OpenAPISpec(rankPath string) map[string]interface{} {
+	var (
+		schemas = make(map[string]interface{})
+		paths   = make(map[string]interface{})
+	)
+	ops := []apiOperation{
+		{method: "post", path: rankPath, summary: "rank the items for the user",
+			request: RecApiRequest{}, response: RecApiResponse{}, edge: true},
+		{method: "get", path: "/service/useritems", summary: "users feature overview",
+			optional: []string{"page", "size"}, response: UserItemOverviewResult{}},
+		{method: "get", path: "/service/items", summary: "items feature overview",
+			optional: []string{"page", "size"}, response: ItemOverviewResult{}},
+		{method: "get", path: "/service/overview", summary: "dashboard overview",
+			response: DashboardOverviewResult{}},
+		{method: "get", path: "/service/featurestats", summary: "feature distribution of the last samples",
+			response: FeatureStats{}},
+		{method: "get", path: "/service/modelhistory", summary: "metrics of the trained model versions",
+			response: []ModelRecord{}},
+		{method: "get", path: "/service/history", summary: "recommend history of the user",
+			params: []string{"user"}, optional: []string{"since"}, response: struct {
+				UserId  int         `json:"userId"`
+				Records []RecRecord `json:"records"`
+			}{}},
+		{method: "get", path: "/service/similar", summary: "items similar to the item by the item embedding",
+			params: []string{"item"}, optional: []string{"k"}, response: []ItemScore{}},
+		{method: "get", path: "/service/models", summary: "model versions in registry",
+			response: []ModelMeta{}, edge: true},
+		{method: "post", path: "/service/models/activate", summary: "activate the model version",
+			request: ModelActivation{}, response: []ModelMeta{}},
+		{method: "get", path: "/debug/sample", summary: "feature breakdown of the sample",
+			params: []string{"user", "item"}, response: SampleDebug{}},
+		{method: "get", path: "/debug/explain", summary: "feature group contributions of the scores",
+			params: []string{"user", "items"}, response: []Explanation{}},
+		{method: "get", path: "/debug/user", summary: "profile, behavior and top ranked items of the user",
+			params: []string{"user"}, optional: []string{"items", "k"}, response: UserInspection{}},
+		{method: "get", path: "/debug/similarusers", summary: "users similar to the user by the user embedding",
+			params: []string{"user"}, optional: []string{"k"}, response: []UserScore{}},
+	}
+
+	for _, op := range ops {
+		if IsEdgeProfile() && !op.edge {
+			continue
+		}
+		operation := map[string]interface{}{
+			"summary": op.summary,
+			"responses": map[string]interface{}{
+				"200": jsonContent("OK", schemaOf(reflect.TypeOf(op.response), schemas)),
+				"default": jsonContent("error", map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+				}),
+			},
+		}
+		var params []interface{}
+		for _, p := range op.params {
+			params = append(params, queryParam(p, true))
+		}
+		for _, p := range op.optional {
+			params = append(params, queryParam(p, false))
+		}
+		if len(params) != 0 {
+			operation["parameters"] = params
+		}
+		if op.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": schemaOf(reflect.TypeOf(op.request), schemas),
+					},
+				},
+			}
+		}
+		item, _ := paths[op.path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[op.path] = item
+		}
+		item[op.method] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "go-ctr recommend api",
+			"version": OpenAPIVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+func jsonContent(desc string, schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": desc,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+func queryParam(name string, required bool) map[string]interface{} {
+	typ := "integer"
+	if name == "version" || name == "items" {
+		typ = "string"
+	}
+	return map[string]interface{}{
+		"name":     name,
+		"in":       "query",
+		"required": required,
+		"schema":   map[string]interface{}{"type": typ},
+	}
+}
+
+// schemaOf returns the json schema of t, named structs are added to schemas
+// and referenced by $ref
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Array:
+		return map[string]interface{}{
+			"type":     "array",
+			"items":    schemaOf(t.Elem(), schemas),
+			"minItems": t.Len(),
+			"maxItems": t.Len(),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaOf(t.Elem(), schemas),
+		}
+	case reflect.Struct:
+		if t.Name() != "" {
+			ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+			if _, ok := schemas[t.Name()]; ok {
+				return ref
+			}
+			// placeholder for recursive types
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+			return ref
+		}
+		return structSchema(t, schemas)
+	default:
+		// interface{} and others, any type
+		return map[string]interface{}{}
+	}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	var (
+		properties = make(map[string]interface{})
+		required   []string
+	)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name, omitEmpty := f.Name, false
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					omitEmpty = true
+				}
+			}
+		}
+		properties[name] = schemaOf(f.Type, schemas)
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,34 @@
+package recommend
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	Convey("openapi spec from go types", t, func() {
+		spec := OpenAPISpec("/api/v1/recommend")
+		// must be json serializable
+		_, err := json.Marshal(spec)
+		So(err, ShouldBeNil)
+
+		paths := spec["paths"].(map[string]interface{})
+		So(paths, ShouldContainKey, "/api/v1/recommend")
+		So(paths, ShouldContainKey, "/debug/sample")
+
+		schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		req := schemas["RecApiRequest"].(map[string]interface{})
+		So(req["properties"], ShouldContainKey, "itemIdList")
+		So(req["required"], ShouldResemble, []string{"userId", "itemIdList"})
+		So(schemas, ShouldContainKey, "ItemScore")
+		info := schemas["SampleInfo"].(map[string]interface{})["properties"].(map[string]interface{})
+		So(info["UserProfileRange"], ShouldResemble, map[string]interface{}{
+			"type":     "array",
+			"items":    map[string]interface{}{"type": "integer", "format": "int32"},
+			"minItems": 2,
+			"maxItems": 2,
+		})
+	})
+}
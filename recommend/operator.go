@@ -0,0 +1,197 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CandidateEvent is the input of RankOperator, Offset is the position of the
+// event in the source, e.g. the Kafka partition offset
+type CandidateEvent struct {
+	Offset    int64 `json:"offset"`
+	UserId    int   `json:"userId"`
+	ItemIds   []int `json:"itemIds"`
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+// ScoredEvent is the output of RankOperator. Error is set if the candidates
+// could not be ranked after all the retries, the event is still emitted so
+// that the stream is not blocked.
+type ScoredEvent struct {
+	Offset     int64       `json:"offset"`
+	UserId     int         `json:"userId"`
+	ItemScores []ItemScore `json:"itemScores"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// EventSource is a replayable source of CandidateEvent, e.g. a Kafka consumer
+// of one partition. Next returns io.EOF when the source is drained. After a
+// restart the source should resume from the offset after the last committed.
+type EventSource interface {
+	Next(ctx context.Context) (CandidateEvent, error)
+	Commit(ctx context.Context, offset int64) error
+}
+
+// EventSink receives the ScoredEvent, e.g. a Kafka producer
+type EventSink interface {
+	Emit(ctx context.Context, event ScoredEvent) error
+}
+
+// RankOperator scores the candidate events with Predictor concurrently, and
+// emits them in the input order.
+type RankOperator struct {
+	Predictor Predictor
+	// Workers is the events ranked concurrently
+	Workers int
+	// Retries of Rank on error before emitting the event with Error
+	Retries      int
+	RetryBackoff time.Duration
+}
+
+func NewRankOperator(predictor Predictor) *RankOperator {
+	return &RankOperator{
+		Predictor:    predictor,
+		Workers:      4,
+		Retries:      2,
+		RetryBackoff: 100 * time.Millisecond,
+	}
+}
+
+func (op *RankOperator) rank(ctx context.Context, event CandidateEvent) (scored ScoredEvent) {
+	scored = ScoredEvent{Offset: event.Offset, UserId: event.UserId}
+	var err error
+	for i := 0; i <= op.Retries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				scored.Error = ctx.Err().Error()
+				return
+			case <-time.After(op.RetryBackoff * time.Duration(i)):
+			}
+		}
+		if scored.ItemScores, err = Rank(ctx, op.Predictor, event.UserId, event.ItemIds); err == nil {
+			return
+		}
+		log.Errorf("rank event at offset %d error: %v", event.Offset, err)
+	}
+	scored.Error = err.Error()
+	return
+}
+
+// Run ranks the events from in until in is closed or ctx is done. The
+// returned channel is closed after all the events accepted are emitted.
+func (op *RankOperator) Run(ctx context.Context, in <-chan CandidateEvent) <-chan ScoredEvent {
+	workers := op.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	var (
+		out = make(chan ScoredEvent, workers)
+		// pending keeps the results in the input order, its capacity bounds
+		// the events in flight
+		pending = make(chan chan ScoredEvent, workers)
+		ranking sync.WaitGroup
+	)
+	go func() {
+		defer close(pending)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-in:
+				if !ok {
+					return
+				}
+				result := make(chan ScoredEvent, 1)
+				select {
+				case pending <- result:
+				case <-ctx.Done():
+					return
+				}
+				ranking.Add(1)
+				go func() {
+					defer ranking.Done()
+					result <- op.rank(ctx, event)
+				}()
+			}
+		}
+	}()
+	go func() {
+		defer func() {
+			// out is closed after all the ranking of the events returned,
+			// the feeding above is over when pending is closed
+			for range pending {
+			}
+			ranking.Wait()
+			close(out)
+		}()
+		for result := range pending {
+			select {
+			case out <- <-result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// RunSource ranks the events from source and emits them to sink until the
+// source returns io.EOF, an error occurs or ctx is done. The offset of an
+// event is committed only after it and all the events before it are
+// emitted, so every event is emitted at least once across restarts.
+func (op *RankOperator) RunSource(ctx context.Context, source EventSource, sink EventSink) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		in      = make(chan CandidateEvent)
+		readErr = make(chan error, 1)
+	)
+	go func() {
+		defer close(in)
+		for {
+			event, er := source.Next(ctx)
+			if er != nil {
+				if !errors.Is(er, io.EOF) {
+					readErr <- er
+				}
+				return
+			}
+			select {
+			case in <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	out := op.Run(ctx, in)
+	defer func() {
+		// return after the events in flight are ranked
+		cancel()
+		for range out {
+		}
+	}()
+	for scored := range out {
+		if err = sink.Emit(ctx, scored); err != nil {
+			log.Errorf("emit event at offset %d error: %v", scored.Offset, err)
+			return
+		}
+		if err = source.Commit(ctx, scored.Offset); err != nil {
+			log.Errorf("commit offset %d error: %v", scored.Offset, err)
+			return
+		}
+	}
+	select {
+	case err = <-readErr:
+		return
+	default:
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,108 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type sliceSource struct {
+	sync.Mutex
+	events    []CandidateEvent
+	next      int
+	committed int64
+}
+
+func (s *sliceSource) Next(ctx context.Context) (CandidateEvent, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.next == len(s.events) {
+		return CandidateEvent{}, io.EOF
+	}
+	s.next++
+	return s.events[s.next-1], nil
+}
+
+func (s *sliceSource) Commit(_ context.Context, offset int64) error {
+	s.Lock()
+	defer s.Unlock()
+	s.committed = offset
+	return nil
+}
+
+type sliceSink struct {
+	events  []ScoredEvent
+	failAt  int64
+	failErr error
+}
+
+func (s *sliceSink) Emit(_ context.Context, event ScoredEvent) error {
+	if s.failErr != nil && event.Offset == s.failAt {
+		return s.failErr
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+// slowPredictor delays the predict of lower item ids more to shuffle the
+// completion order
+type slowPredictor struct {
+	idPredictor
+}
+
+func (slowPredictor) GetItemFeature(_ context.Context, itemId int) (Tensor, error) {
+	time.Sleep(time.Duration(10-itemId%10) * time.Millisecond)
+	return Tensor{float32(itemId)}, nil
+}
+
+func TestRankOperator(t *testing.T) {
+	Convey("stream rank operator", t, func() {
+		resetFeatureCache()
+		source := &sliceSource{committed: -1}
+		for i := 0; i < 20; i++ {
+			source.events = append(source.events, CandidateEvent{
+				Offset: int64(i), UserId: 1, ItemIds: []int{i, i + 100},
+			})
+		}
+		op := NewRankOperator(slowPredictor{})
+		op.Workers = 8
+
+		Convey("in order and committed", func() {
+			sink := &sliceSink{}
+			So(op.RunSource(context.Background(), source, sink), ShouldBeNil)
+			So(sink.events, ShouldHaveLength, 20)
+			for i, e := range sink.events {
+				So(e.Offset, ShouldEqual, i)
+				So(scoredIds(e.ItemScores), ShouldResemble, []int{i, i + 100})
+			}
+			So(source.committed, ShouldEqual, 19)
+		})
+
+		Convey("emit failure stops before commit", func() {
+			sink := &sliceSink{failAt: 5, failErr: errors.New("broker down")}
+			So(op.RunSource(context.Background(), source, sink), ShouldNotBeNil)
+			So(sink.events, ShouldHaveLength, 5)
+			So(source.committed, ShouldEqual, 4)
+		})
+
+		Convey("rank error emitted after retries", func() {
+			op := NewRankOperator(failItemPredictor{})
+			op.RetryBackoff = time.Millisecond
+			in := make(chan CandidateEvent, 1)
+			in <- CandidateEvent{Offset: 7, UserId: 1, ItemIds: []int{1}}
+			close(in)
+			var out []ScoredEvent
+			for e := range op.Run(context.Background(), in) {
+				out = append(out, e)
+			}
+			So(out, ShouldHaveLength, 1)
+			So(out[0].Offset, ShouldEqual, 7)
+			So(out[0].Error, ShouldNotBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,206 @@
+package recommend
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// OverviewTopCategories is the categories counted in the item overview
+	OverviewTopCategories = 10
+	// LabelBalanceSamples bounds the samples of SampleGenerator read for the
+	// label balance of the dashboard overview, 0 disables it
+	LabelBalanceSamples = 100000
+	// LabelBalanceBucket is the time bucket of the label balance
+	LabelBalanceBucket = 24 * time.Hour
+	// LabelBalanceTTL is the time the label balance of the overview is
+	// cached, so the dashboard does not read the samples on every request
+	LabelBalanceTTL = 10 * time.Minute
+
+	labelBalances struct {
+		sync.Mutex
+		buckets []LabelBucket
+		at      time.Time
+	}
+)
+
+// OverviewAggregations are computed by the engine over a page of the users
+// or items of FeatureOverview, so the dashboard shows the data health
+// without the provider computing it
+type OverviewAggregations struct {
+	// NullRates is the ratio of the nil or absent values of every feature
+	NullRates map[string]float64 `json:"null_rates"`
+	// TopCategories of the items by ItemCategorizer
+	TopCategories []CategoryCount `json:"top_categories,omitempty"`
+	// BehaviorLengths is the histogram of the user behavior lengths by
+	// UserBehavior, the index is the length up to UserBehaviorLen
+	BehaviorLengths []int `json:"behavior_lengths,omitempty"`
+}
+
+type CategoryCount struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// LabelBucket is the label balance of the samples of a time bucket
+type LabelBucket struct {
+	// Start is the unix time of the bucket, 0 for the samples without
+	// Timestamp
+	Start        int64   `json:"start"`
+	Samples      int     `json:"samples"`
+	Positive     int     `json:"positive"`
+	PositiveRate float64 `json:"positive_rate"`
+}
+
+// nullRates returns the null rate of every key of features
+func nullRates(features []map[string]interface{}) map[string]float64 {
+	nulls := make(map[string]int)
+	if len(features) == 0 {
+		return map[string]float64{}
+	}
+	for _, f := range features {
+		for key := range f {
+			if _, ok := nulls[key]; !ok {
+				nulls[key] = 0
+			}
+		}
+	}
+	for _, f := range features {
+		for key := range nulls {
+			if f[key] == nil {
+				nulls[key]++
+			}
+		}
+	}
+	rates := make(map[string]float64, len(nulls))
+	for key, n := range nulls {
+		rates[key] = float64(n) / float64(len(features))
+	}
+	return rates
+}
+
+// aggregateUsers aggregates the users of res
+func aggregateUsers(ctx context.Context, featureProvider interface{}, res *UserItemOverviewResult) {
+	agg := &OverviewAggregations{}
+	features := make([]map[string]interface{}, len(res.Users))
+	for i, u := range res.Users {
+		features[i] = u.UserFeatures
+	}
+	agg.NullRates = nullRates(features)
+
+	if ub, ok := featureProvider.(UserBehavior); ok && len(res.Users) != 0 {
+		agg.BehaviorLengths = make([]int, UserBehaviorLen+1)
+		now := time.Now().Unix()
+		for _, u := range res.Users {
+			itemSeq, err := ub.GetUserBehavior(ctx, u.UserId, UserBehaviorLen, -1, now)
+			if err != nil {
+				log.Warnf("get behavior of user %d for overview error: %v", u.UserId, err)
+				continue
+			}
+			n := len(itemSeq)
+			if n > UserBehaviorLen {
+				n = UserBehaviorLen
+			}
+			agg.BehaviorLengths[n]++
+		}
+	}
+	res.Aggregations = agg
+}
+
+// aggregateItems aggregates the items of res
+func aggregateItems(ctx context.Context, featureProvider interface{}, res *ItemOverviewResult) {
+	agg := &OverviewAggregations{}
+	features := make([]map[string]interface{}, len(res.Items))
+	for i, item := range res.Items {
+		features[i] = item.ItemFeatures
+	}
+	agg.NullRates = nullRates(features)
+
+	if categorizer, ok := featureProvider.(ItemCategorizer); ok {
+		counts := make(map[string]int)
+		for _, item := range res.Items {
+			category, err := categorizer.GetItemCategory(ctx, item.ItemId)
+			if err != nil {
+				log.Warnf("get category of item %d for overview error: %v", item.ItemId, err)
+				continue
+			}
+			counts[category]++
+		}
+		for category, count := range counts {
+			agg.TopCategories = append(agg.TopCategories, CategoryCount{Category: category, Count: count})
+		}
+		sort.Slice(agg.TopCategories, func(i, j int) bool {
+			a, b := agg.TopCategories[i], agg.TopCategories[j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Category < b.Category
+		})
+		if len(agg.TopCategories) > OverviewTopCategories {
+			agg.TopCategories = agg.TopCategories[:OverviewTopCategories]
+		}
+	}
+	res.Aggregations = agg
+}
+
+// cachedLabelBalance is labelBalance cached for LabelBalanceTTL, the
+// concurrent requests wait for the one reading the samples
+func cachedLabelBalance(ctx context.Context, featureProvider interface{}) (buckets []LabelBucket, err error) {
+	labelBalances.Lock()
+	defer labelBalances.Unlock()
+	if !labelBalances.at.IsZero() && time.Since(labelBalances.at) < LabelBalanceTTL {
+		return labelBalances.buckets, nil
+	}
+	if buckets, err = labelBalance(ctx, featureProvider); err != nil {
+		return
+	}
+	labelBalances.buckets, labelBalances.at = buckets, time.Now()
+	return
+}
+
+// labelBalance returns the label balance over time of the first
+// LabelBalanceSamples samples of the SampleGenerator of featureProvider
+func labelBalance(ctx context.Context, featureProvider interface{}) (buckets []LabelBucket, err error) {
+	trainer, ok := featureProvider.(Trainer)
+	if !ok || LabelBalanceSamples <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(WithStage(ctx, TrainStage))
+	defer cancel()
+	sampleCh, err := trainer.SampleGenerator(ctx)
+	if err != nil {
+		return
+	}
+	bucketSecs := int64(LabelBalanceBucket / time.Second)
+	if bucketSecs <= 0 {
+		bucketSecs = 1
+	}
+	byStart := make(map[int64]*LabelBucket)
+	samples := 0
+	for s := range sampleCh {
+		if samples >= LabelBalanceSamples {
+			break
+		}
+		samples++
+		start := s.Timestamp - s.Timestamp%bucketSecs
+		b, ok := byStart[start]
+		if !ok {
+			b = &LabelBucket{Start: start}
+			byStart[start] = b
+		}
+		b.Samples++
+		if s.Label > 0.5 {
+			b.Positive++
+		}
+	}
+	for _, b := range byStart {
+		b.PositiveRate = float64(b.Positive) / float64(b.Samples)
+		buckets = append(buckets, *b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start < buckets[j].Start })
+	return
+}
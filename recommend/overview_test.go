@@ -0,0 +1,76 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// timedRecSys is idRecSys with the samples of 2 days, all the positives on
+// the second day
+type timedRecSys struct {
+	idRecSys
+}
+
+func (timedRecSys) SampleGenerator(context.Context) (<-chan Sample, error) {
+	ch := make(chan Sample, 4)
+	ch <- Sample{Timestamp: 86400 + 10}
+	ch <- Sample{Timestamp: 86400 + 20}
+	ch <- Sample{Timestamp: 2*86400 + 10, Label: 1}
+	ch <- Sample{Timestamp: 2*86400 + 20}
+	close(ch)
+	return ch, nil
+}
+
+func TestOverviewAggregations(t *testing.T) {
+	Convey("overview aggregations", t, func() {
+		ctx := context.Background()
+
+		Convey("users", func() {
+			res := UserItemOverviewResult{Users: []UserItemOverview{
+				{UserId: 1, UserFeatures: map[string]interface{}{"age": 30, "city": nil}},
+				{UserId: 2, UserFeatures: map[string]interface{}{"age": 40}},
+			}}
+			aggregateUsers(ctx, &behaviorRecSys{}, &res)
+			So(res.Aggregations.NullRates, ShouldResemble, map[string]float64{"age": 0, "city": 1})
+			So(res.Aggregations.BehaviorLengths, ShouldHaveLength, UserBehaviorLen+1)
+			So(res.Aggregations.BehaviorLengths[3], ShouldEqual, 2)
+		})
+
+		Convey("items", func() {
+			OverviewTopCategories = 1
+			defer func() { OverviewTopCategories = 10 }()
+			res := ItemOverviewResult{Items: []ItemOverView{{ItemId: 1}, {ItemId: 3}, {ItemId: 4}}}
+			aggregateItems(ctx, idPredictor{}, &res)
+			So(res.Aggregations.NullRates, ShouldBeEmpty)
+			So(res.Aggregations.TopCategories, ShouldResemble, []CategoryCount{{Category: "1", Count: 2}})
+		})
+
+		Convey("label balance", func() {
+			buckets, err := labelBalance(ctx, timedRecSys{})
+			So(err, ShouldBeNil)
+			So(buckets, ShouldResemble, []LabelBucket{
+				{Start: 86400, Samples: 2},
+				{Start: 2 * 86400, Samples: 2, Positive: 1, PositiveRate: 0.5},
+			})
+			buckets, err = labelBalance(ctx, idPredictor{})
+			So(err, ShouldBeNil)
+			So(buckets, ShouldBeNil)
+
+			// cached for the overview requests
+			defer func() { labelBalances.at = time.Time{} }()
+			buckets, err = cachedLabelBalance(ctx, timedRecSys{})
+			So(err, ShouldBeNil)
+			So(buckets, ShouldHaveLength, 2)
+			buckets, err = cachedLabelBalance(ctx, idPredictor{})
+			So(err, ShouldBeNil)
+			So(buckets, ShouldHaveLength, 2)
+			labelBalances.at = time.Now().Add(-LabelBalanceTTL)
+			buckets, err = cachedLabelBalance(ctx, idPredictor{})
+			So(err, ShouldBeNil)
+			So(buckets, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,223 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// LinearHead is a tiny per user adaptation on top of the model score:
+//
+//	score' = sigmoid(logit(score) + Bias + W · itemEmbedding)
+type LinearHead struct {
+	Bias float32   `json:"bias"`
+	W    []float32 `json:"w"`
+	// Updates is the feedback count trained into the head
+	Updates int `json:"updates"`
+}
+
+// HeadSync is called periodically by Personalizer.StartSync with the update
+// averaged on device, it should return the global head averaged from all
+// devices, e.g. by posting the update to a federated aggregation server.
+type HeadSync func(ctx context.Context, update LinearHead) (global LinearHead, err error)
+
+// Personalizer adapts the scores for each user with a LinearHead trained by
+// the on-device feedback, no training cluster involved. Use it as a
+// PostRanker after the model scoring.
+type Personalizer struct {
+	LearningRate float32
+	L2           float32
+	// MergeAlpha is the weight of the global head when merging
+	MergeAlpha float32
+
+	heads *ccache.Cache // map[userId]*userHead
+
+	sync.RWMutex
+	global LinearHead // init of new users
+}
+
+type userHead struct {
+	sync.Mutex
+	LinearHead
+	exported int // Updates already exported
+}
+
+func NewPersonalizer(maxUsers int) *Personalizer {
+	return &Personalizer{
+		LearningRate: 0.05,
+		L2:           1e-4,
+		MergeAlpha:   0.5,
+		heads: ccache.New(
+			ccache.Configure().MaxSize(int64(maxUsers)).ItemsToPrune(uint32(maxUsers/100 + 1)),
+		),
+		global: LinearHead{W: make([]float32, ItemEmbDim)},
+	}
+}
+
+func (p *Personalizer) head(userId int, create bool) *userHead {
+	key := strconv.Itoa(userId)
+	if !create {
+		if item := p.heads.Get(key); item != nil {
+			return item.Value().(*userHead)
+		}
+		return nil
+	}
+	item, _ := p.heads.Fetch(key, time.Hour*24*30, func() (interface{}, error) {
+		p.RLock()
+		defer p.RUnlock()
+		h := &userHead{LinearHead: p.global}
+		h.W = append([]float32(nil), p.global.W...)
+		h.Updates = 0
+		return h, nil
+	})
+	return item.Value().(*userHead)
+}
+
+func personalizeEmb(itemId int) []float32 {
+	if emb, ok := getItemEmbedding(itemId); ok {
+		return emb
+	}
+	return nil
+}
+
+func (h *userHead) logit(baseScore float32, emb []float32) float32 {
+	z := logit32(baseScore) + h.Bias
+	for i := 0; i < len(emb) && i < len(h.W); i++ {
+		z += h.W[i] * emb[i]
+	}
+	return z
+}
+
+func logit32(p float32) float32 {
+	const eps = 1e-6
+	if p < eps {
+		p = eps
+	} else if p > 1-eps {
+		p = 1 - eps
+	}
+	return float32(math.Log(float64(p / (1 - p))))
+}
+
+func sigmoid32(z float32) float32 {
+	return float32(1 / (1 + math.Exp(-float64(z))))
+}
+
+// Feedback trains the head of userId with one SGD step, baseScore is the
+// model score of itemId before personalization, label is 1 for positive.
+func (p *Personalizer) Feedback(userId, itemId int, baseScore, label float32) {
+	var (
+		h   = p.head(userId, true)
+		emb = personalizeEmb(itemId)
+	)
+	h.Lock()
+	defer h.Unlock()
+	grad := sigmoid32(h.logit(baseScore, emb)) - label
+	h.Bias -= p.LearningRate * grad
+	for i := 0; i < len(emb) && i < len(h.W); i++ {
+		h.W[i] -= p.LearningRate * (grad*emb[i] + p.L2*h.W[i])
+	}
+	h.Updates++
+}
+
+// PostRank adjusts the scores with the head of userId, users without any
+// feedback keep the model scores.
+func (p *Personalizer) PostRank(_ context.Context, userId int, itemScores []ItemScore) ([]ItemScore, error) {
+	h := p.head(userId, false)
+	if h == nil {
+		return itemScores, nil
+	}
+	h.Lock()
+	defer h.Unlock()
+	for i := range itemScores {
+		itemScores[i].Score = sigmoid32(h.logit(itemScores[i].Score, personalizeEmb(itemScores[i].ItemId)))
+	}
+	return itemScores, nil
+}
+
+// Export returns the average of the user heads weighted by the feedback
+// count since the last Export, Updates of it is the total count.
+func (p *Personalizer) Export() (update LinearHead) {
+	update.W = make([]float32, ItemEmbDim)
+	p.heads.ForEachFunc(func(_ string, item *ccache.Item) bool {
+		h := item.Value().(*userHead)
+		h.Lock()
+		defer h.Unlock()
+		n := h.Updates - h.exported
+		if n <= 0 {
+			return true
+		}
+		h.exported = h.Updates
+		update.Bias += h.Bias * float32(n)
+		for i := range update.W {
+			update.W[i] += h.W[i] * float32(n)
+		}
+		update.Updates += n
+		return true
+	})
+	if update.Updates != 0 {
+		update.Bias /= float32(update.Updates)
+		for i := range update.W {
+			update.W[i] /= float32(update.Updates)
+		}
+	}
+	return
+}
+
+// Merge blends the global head into every user head by MergeAlpha, new users
+// start from the global head.
+func (p *Personalizer) Merge(global LinearHead) {
+	if len(global.W) != ItemEmbDim {
+		log.Errorf("global head dim mismatch: %d:%d", ItemEmbDim, len(global.W))
+		return
+	}
+	p.Lock()
+	p.global = LinearHead{Bias: global.Bias, W: append([]float32(nil), global.W...)}
+	p.Unlock()
+
+	a := p.MergeAlpha
+	p.heads.ForEachFunc(func(_ string, item *ccache.Item) bool {
+		h := item.Value().(*userHead)
+		h.Lock()
+		defer h.Unlock()
+		h.Bias = (1-a)*h.Bias + a*global.Bias
+		for i := range h.W {
+			h.W[i] = (1-a)*h.W[i] + a*global.W[i]
+		}
+		return true
+	})
+}
+
+// StartSync exports the local update and merges the global head returned by
+// headSync every interval until ctx is done.
+func (p *Personalizer) StartSync(ctx context.Context, interval time.Duration, headSync HeadSync) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				update := p.Export()
+				if update.Updates == 0 {
+					continue
+				}
+				global, err := headSync(ctx, update)
+				if err != nil {
+					log.Errorf("personalization sync error: %v", err)
+					continue
+				}
+				if global.Updates == 0 {
+					// no global head aggregated yet
+					continue
+				}
+				p.Merge(global)
+			}
+		}
+	}()
+}
@@ -0,0 +1,49 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPersonalizer(t *testing.T) {
+	Convey("on-device personalization", t, func() {
+		emb := func(v float32) []float32 {
+			e := make([]float32, ItemEmbDim)
+			e[0] = v
+			return e
+		}
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": emb(1), "2": emb(-1)})
+		defer itemEmbeddingMap.store(nil)
+
+		ctx := context.Background()
+		p := NewPersonalizer(100)
+		scores, err := p.PostRank(ctx, 7, []ItemScore{{ItemId: 1, Score: 0.5}})
+		So(err, ShouldBeNil)
+		So(scores[0].Score, ShouldEqual, 0.5)
+
+		// user 7 likes item 1 and dislikes item 2
+		for i := 0; i < 100; i++ {
+			p.Feedback(7, 1, 0.5, 1)
+			p.Feedback(7, 2, 0.5, 0)
+		}
+		scores, err = p.PostRank(ctx, 7, []ItemScore{{ItemId: 1, Score: 0.5}, {ItemId: 2, Score: 0.5}})
+		So(err, ShouldBeNil)
+		So(scores[0].Score, ShouldBeGreaterThan, 0.7)
+		So(scores[1].Score, ShouldBeLessThan, 0.3)
+		liked := scores[0].Score
+
+		update := p.Export()
+		So(update.Updates, ShouldEqual, 200)
+		So(update.W[0], ShouldBeGreaterThan, 0)
+		// nothing new
+		So(p.Export().Updates, ShouldEqual, 0)
+
+		p.Merge(LinearHead{W: make([]float32, ItemEmbDim)})
+		scores, _ = p.PostRank(ctx, 7, []ItemScore{{ItemId: 1, Score: 0.5}})
+		// pulled half way to the zero global head
+		So(scores[0].Score, ShouldBeBetween, 0.5, liked)
+	})
+}
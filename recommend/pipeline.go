@@ -0,0 +1,129 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// the stages of a Pipeline in order, the labels of its metrics
+const (
+	PipelineRecall  = "recall"
+	PipelinePreRank = "prerank"
+	PipelineRank    = "rank"
+	PipelineReRank  = "rerank"
+)
+
+var pipelineStages = []string{PipelineRecall, PipelinePreRank, PipelineRank, PipelineReRank}
+
+// Pipeline chains the stages of a recommendation, every stage scores the
+// candidates of the previous one and passes the top of its budget on:
+//
+//	Recall -> PreRank -> Rank -> ReRankers
+//
+// The latency and the candidates out of every stage are in the metrics
+// ctr_pipeline_stage_seconds and ctr_pipeline_candidates_total.
+type Pipeline struct {
+	// Recall generates RecallSize candidates of the user
+	Recall     Retriever
+	RecallSize int
+	// PreRank is a lightweight model, e.g. a linear one or a TwoTower,
+	// truncating the candidates to the top PreRankSize by RankTopK, optional
+	PreRank     Predictor
+	PreRankSize int
+	// Rank is the full model, the top RankSize are re-ranked, 0 means all
+	Rank     Predictor
+	RankSize int
+	// ReRankers reorder the ranked items in order, e.g. ReRankMMR or the
+	// business rules, the top Size of them are returned, 0 means all
+	ReRankers []PostRanker
+	Size      int
+}
+
+// RetrieverFunc is an adapter to use a func as a Retriever
+type RetrieverFunc func(ctx context.Context, userId int, n int) ([]int, error)
+
+func (f RetrieverFunc) Retrieve(ctx context.Context, userId int, n int) ([]int, error) {
+	return f(ctx, userId, n)
+}
+
+// Recommend runs the stages of p for userId
+func (p *Pipeline) Recommend(ctx context.Context, userId int) (itemScores []ItemScore, err error) {
+	if p.Recall == nil || p.Rank == nil {
+		return nil, fmt.Errorf("pipeline without the recall or the rank stage")
+	}
+	ctx, span := startSpan(ctx, "Pipeline")
+	span.SetAttribute("user.id", userId)
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	itemIds, err := p.Recall.Retrieve(ctx, userId, p.RecallSize)
+	if err != nil {
+		logOf(ctx).Errorf("pipeline recall error: %v", err)
+		return
+	}
+	if p.RecallSize > 0 && len(itemIds) > p.RecallSize {
+		itemIds = itemIds[:p.RecallSize]
+	}
+	metrics.observeStage(PipelineRecall, start, len(itemIds))
+	if len(itemIds) == 0 {
+		return []ItemScore{}, nil
+	}
+
+	if p.PreRank != nil {
+		start = time.Now()
+		if p.PreRankSize > 0 {
+			itemScores, err = RankTopK(ctx, p.PreRank, userId, itemIds, p.PreRankSize)
+		} else {
+			itemScores, err = Rank(ctx, p.PreRank, userId, itemIds)
+		}
+		if err != nil {
+			logOf(ctx).Errorf("pipeline pre-rank error: %v", err)
+			return
+		}
+		// a new slice, itemIds may be kept by the Retriever
+		itemIds = make([]int, len(itemScores))
+		for i, is := range itemScores {
+			itemIds[i] = is.ItemId
+		}
+		metrics.observeStage(PipelinePreRank, start, len(itemIds))
+	}
+
+	start = time.Now()
+	if itemScores, err = Rank(ctx, p.Rank, userId, itemIds); err != nil {
+		logOf(ctx).Errorf("pipeline rank error: %v", err)
+		return
+	}
+	itemScores = topItemScores(itemScores, p.RankSize)
+	metrics.observeStage(PipelineRank, start, len(itemScores))
+
+	start = time.Now()
+	for _, rr := range p.ReRankers {
+		if itemScores, err = rr.PostRank(ctx, userId, itemScores); err != nil {
+			logOf(ctx).Errorf("pipeline re-rank error: %v", err)
+			return
+		}
+	}
+	if p.Size > 0 && len(itemScores) > p.Size {
+		itemScores = itemScores[:p.Size]
+	}
+	metrics.observeStage(PipelineReRank, start, len(itemScores))
+	return
+}
+
+// topItemScores returns the top n of itemScores by the score, all sorted if
+// n <= 0
+func topItemScores(itemScores []ItemScore, n int) []ItemScore {
+	sort.SliceStable(itemScores, func(i, j int) bool { return itemScores[i].Score > itemScores[j].Score })
+	if n > 0 && len(itemScores) > n {
+		itemScores = itemScores[:n]
+	}
+	return itemScores
+}
+
+func (m *MetricsCollector) observeStage(stage string, start time.Time, candidates int) {
+	m.pipelineSeconds[stage].since(start)
+	atomic.AddUint64(m.pipelineCandidates[stage], uint64(candidates))
+}
@@ -0,0 +1,76 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// negPredictor scores the items by the negative item id
+type negPredictor struct {
+	idPredictor
+}
+
+func (negPredictor) Predict(X tensor.Tensor) tensor.Tensor {
+	y := idPredictor{}.Predict(X)
+	for i, v := range y.Data().([]float32) {
+		y.Data().([]float32)[i] = -v
+	}
+	return y
+}
+
+func TestPipeline(t *testing.T) {
+	Convey("recall, pre-rank, rank and re-rank", t, func() {
+		resetFeatureCache()
+		recall := RetrieverFunc(func(_ context.Context, _ int, n int) (itemIds []int, err error) {
+			for i := 1; i <= 30; i++ {
+				itemIds = append(itemIds, i)
+			}
+			return
+		})
+		p := &Pipeline{
+			Recall:      recall,
+			RecallSize:  20,
+			PreRank:     negPredictor{},
+			PreRankSize: 10,
+			Rank:        idPredictor{},
+			RankSize:    5,
+			ReRankers:   []PostRanker{Blocklist(9)},
+			Size:        3,
+		}
+		// the pre-rank keeps 1..10 of the 20 recalled, the rank 10..6
+		itemScores, err := p.Recommend(context.Background(), 1)
+		So(err, ShouldBeNil)
+		So(scoredIds(itemScores), ShouldResemble, []int{10, 8, 7})
+
+		var buf bytes.Buffer
+		_, err = Collector().WriteTo(&buf)
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, `ctr_pipeline_stage_seconds_count{stage="prerank"}`)
+		So(buf.String(), ShouldContainSubstring, `ctr_pipeline_candidates_total{stage="recall"}`)
+
+		Convey("without pre-rank", func() {
+			p.PreRank = nil
+			itemScores, err := p.Recommend(context.Background(), 1)
+			So(err, ShouldBeNil)
+			So(scoredIds(itemScores), ShouldResemble, []int{20, 19, 18})
+		})
+
+		Convey("the recalled ids are not modified", func() {
+			cached := []int{12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1}
+			p.Recall = RetrieverFunc(func(context.Context, int, int) ([]int, error) { return cached, nil })
+			_, err := p.Recommend(context.Background(), 1)
+			So(err, ShouldBeNil)
+			So(cached, ShouldResemble, []int{12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1})
+		})
+
+		Convey("without rank", func() {
+			p.Rank = nil
+			_, err := p.Recommend(context.Background(), 1)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// PostProcessors are applied by Rank after the PostRanker of the
+	// Predictor, by the profile of the surface of the request, see
+	// RequestMeta. nil means none.
+	PostProcessors *PostProcessorRegistry
+
+	ErrUnknownPostProcessor = errors.New("unknown post-processor")
+)
+
+// PostProcessorRegistry keeps the score post-processors registered by name
+// by the host application, e.g. the normalizers, the calibrators and the
+// boosters, and the profiles of the surfaces referencing them in order
+type PostProcessorRegistry struct {
+	sync.RWMutex
+	processors map[string]*postProcessor
+	// profiles are the post-processor names of every surface in order, the
+	// profile of "" is of the surfaces without one
+	profiles map[string][]string
+}
+
+type postProcessor struct {
+	PostRanker
+	errors  uint64
+	seconds *histogram
+}
+
+func NewPostProcessorRegistry() *PostProcessorRegistry {
+	return &PostProcessorRegistry{
+		processors: make(map[string]*postProcessor),
+		profiles:   make(map[string][]string),
+	}
+}
+
+// Register registers postRanker as name, a name can only be registered once
+func (r *PostProcessorRegistry) Register(name string, postRanker PostRanker) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.processors[name]; ok {
+		return fmt.Errorf("post-processor %q already registered", name)
+	}
+	r.processors[name] = &postProcessor{PostRanker: postRanker, seconds: newHistogram(MetricsBuckets)}
+	return nil
+}
+
+// SetProfile sets the post-processors of surface applied in order, surface
+// "" sets the default profile, no names removes the profile
+func (r *PostProcessorRegistry) SetProfile(surface string, names ...string) error {
+	r.Lock()
+	defer r.Unlock()
+	for _, name := range names {
+		if _, ok := r.processors[name]; !ok {
+			return fmt.Errorf("%w: %q of surface %q", ErrUnknownPostProcessor, name, surface)
+		}
+	}
+	if len(names) == 0 {
+		delete(r.profiles, surface)
+		return nil
+	}
+	r.profiles[surface] = append([]string(nil), names...)
+	return nil
+}
+
+// Profile returns the post-processor names applied to surface
+func (r *PostProcessorRegistry) Profile(surface string) []string {
+	r.RLock()
+	defer r.RUnlock()
+	names, ok := r.profiles[surface]
+	if !ok {
+		names = r.profiles[""]
+	}
+	return append([]string(nil), names...)
+}
+
+// PostRank applies the post-processors of the profile of the surface of ctx
+// in order, the error of a post-processor fails the chain
+func (r *PostProcessorRegistry) PostRank(ctx context.Context, userId int, itemScores []ItemScore) (result []ItemScore, err error) {
+	result = itemScores
+	for _, name := range r.Profile(RequestMetaOf(ctx).Surface) {
+		r.RLock()
+		p := r.processors[name]
+		r.RUnlock()
+		start := time.Now()
+		result, err = p.PostRank(ctx, userId, result)
+		p.seconds.since(start)
+		if err != nil {
+			atomic.AddUint64(&p.errors, 1)
+			return nil, fmt.Errorf("post-processor %q: %w", name, err)
+		}
+	}
+	return
+}
+
+// each calls fn with the post-processors sorted by name
+func (r *PostProcessorRegistry) each(fn func(name string, p *postProcessor)) {
+	r.RLock()
+	defer r.RUnlock()
+	names := make([]string, 0, len(r.processors))
+	for name := range r.processors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fn(name, r.processors[name])
+	}
+}
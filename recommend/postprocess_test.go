@@ -0,0 +1,56 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPostProcessors(t *testing.T) {
+	defer func(pp *PostProcessorRegistry) { PostProcessors = pp }(PostProcessors)
+
+	Convey("post-processor registry", t, func() {
+		resetFeatureCache()
+		PostProcessors = NewPostProcessorRegistry()
+		So(PostProcessors.Register("minmax", MinMaxNormalize()), ShouldBeNil)
+		So(PostProcessors.Register("boost", Boost(map[int]float32{1: 3})), ShouldBeNil)
+		So(PostProcessors.Register("fail", PostRankFunc(func(context.Context, int, []ItemScore) ([]ItemScore, error) {
+			return nil, errors.New("calibration unavailable")
+		})), ShouldBeNil)
+		So(PostProcessors.Register("boost", Blocklist()), ShouldNotBeNil)
+		So(errors.Is(PostProcessors.SetProfile("home", "minmax", "nope"), ErrUnknownPostProcessor), ShouldBeTrue)
+
+		So(PostProcessors.SetProfile("", "minmax"), ShouldBeNil)
+		So(PostProcessors.SetProfile("home", "minmax", "boost"), ShouldBeNil)
+		So(PostProcessors.SetProfile("cart", "fail"), ShouldBeNil)
+		So(PostProcessors.Profile("search"), ShouldResemble, []string{"minmax"})
+
+		rank := func(surface string) ([]ItemScore, error) {
+			ctx := WithRequestMeta(context.Background(), RequestMeta{Surface: surface})
+			return Rank(ctx, idPredictor{}, 1, []int{1, 3, 5})
+		}
+		scores, err := rank("search")
+		So(err, ShouldBeNil)
+		So(scores[0].Score, ShouldEqual, 0)
+		So(scores[2].Score, ShouldEqual, 1)
+
+		// in order: normalized then boosted
+		scores, err = rank("home")
+		So(err, ShouldBeNil)
+		So(scores[0].Score, ShouldEqual, 0)
+		So(scores[1].Score, ShouldEqual, 0.5)
+
+		_, err = rank("cart")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, `post-processor "fail": calibration unavailable`)
+
+		var buf bytes.Buffer
+		_, err = Collector().WriteTo(&buf)
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, `ctr_post_processor_seconds_count{name="minmax"} 2`)
+		So(buf.String(), ShouldContainSubstring, `ctr_post_processor_errors_total{name="fail"} 1`)
+	})
+}
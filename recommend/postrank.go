@@ -0,0 +1,80 @@
+package recommend
+
+import (
+	"context"
+)
+
+// PostRankFunc is an adapter to use a func as a PostRanker
+type PostRankFunc func(ctx context.Context, userId int, itemScores []ItemScore) ([]ItemScore, error)
+
+func (f PostRankFunc) PostRank(ctx context.Context, userId int, itemScores []ItemScore) ([]ItemScore, error) {
+	return f(ctx, userId, itemScores)
+}
+
+// ChainPostRankers returns a PostRanker invoking postRankers in order
+func ChainPostRankers(postRankers ...PostRanker) PostRanker {
+	return PostRankFunc(func(ctx context.Context, userId int, itemScores []ItemScore) (result []ItemScore, err error) {
+		result = itemScores
+		for _, pr := range postRankers {
+			if result, err = pr.PostRank(ctx, userId, result); err != nil {
+				return
+			}
+		}
+		return
+	})
+}
+
+// Blocklist drops the itemIds from the result
+func Blocklist(itemIds ...int) PostRanker {
+	blocked := make(map[int]bool, len(itemIds))
+	for _, id := range itemIds {
+		blocked[id] = true
+	}
+	return PostRankFunc(func(_ context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+		result := itemScores[:0]
+		for _, is := range itemScores {
+			if !blocked[is.ItemId] {
+				result = append(result, is)
+			}
+		}
+		return result, nil
+	})
+}
+
+// Boost multiplies the scores of the items in boosts by the factor
+func Boost(boosts map[int]float32) PostRanker {
+	return PostRankFunc(func(_ context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+		for i := range itemScores {
+			if factor, ok := boosts[itemScores[i].ItemId]; ok {
+				itemScores[i].Score *= factor
+			}
+		}
+		return itemScores, nil
+	})
+}
+
+// MinMaxNormalize rescales the scores to [0, 1], equal scores become 1
+func MinMaxNormalize() PostRanker {
+	return PostRankFunc(func(_ context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+		if len(itemScores) == 0 {
+			return itemScores, nil
+		}
+		lo, hi := itemScores[0].Score, itemScores[0].Score
+		for _, is := range itemScores {
+			if is.Score < lo {
+				lo = is.Score
+			}
+			if is.Score > hi {
+				hi = is.Score
+			}
+		}
+		for i := range itemScores {
+			if hi > lo {
+				itemScores[i].Score = (itemScores[i].Score - lo) / (hi - lo)
+			} else {
+				itemScores[i].Score = 1
+			}
+		}
+		return itemScores, nil
+	})
+}
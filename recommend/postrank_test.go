@@ -0,0 +1,31 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type postRankPredictor struct {
+	idPredictor
+	PostRanker
+}
+
+func TestPostRank(t *testing.T) {
+	Convey("post rank in Rank", t, func() {
+		resetFeatureCache()
+		recSys := postRankPredictor{
+			PostRanker: ChainPostRankers(
+				Blocklist(2),
+				Boost(map[int]float32{1: 10}),
+			),
+		}
+		scores, err := Rank(context.Background(), recSys, 1, []int{1, 2, 3})
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{
+			{ItemId: 1, Score: 10},
+			{ItemId: 3, Score: 3},
+		})
+	})
+}
@@ -0,0 +1,326 @@
+package recommend
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const featureHashesKey ctxKey = "featureHashes"
+
+// PredictionLog receives the scores served by Rank for the closed-loop
+// training and the offline replay, nil disables it. Rank queues the events
+// for a background writer, see FlushPredictionLog.
+var PredictionLog PredictionSink
+
+var (
+	// PredictionLogQueueSize bounds the Rank calls of the events queued for
+	// the writer of PredictionLog, the events of a full queue are dropped and
+	// counted in ctr_prediction_log_dropped_total
+	PredictionLogQueueSize = 1024
+	// PredictionLogBatchSize is the max events the writer passes to a
+	// LogPredictions call
+	PredictionLogBatchSize = 512
+)
+
+var (
+	predictionQueue     chan predictionBatch
+	predictionQueueOnce sync.Once
+	predictionsDropped  uint64
+)
+
+// predictionBatch is the events of a Rank call to sink, or a flush request
+// if flushed is not nil
+type predictionBatch struct {
+	sink    PredictionSink
+	events  []PredictionEvent
+	flushed chan struct{}
+}
+
+// predictionFlusher is a PredictionSink buffering the events, e.g. the
+// FilePredictionSink, flushed by the writer when the queue is empty
+type predictionFlusher interface {
+	Flush() error
+}
+
+// PredictionEvent is a score of an item served to a user
+type PredictionEvent struct {
+	// Timestamp is the unix milliseconds the item is ranked
+	Timestamp int64  `json:"ts"`
+	RequestId string `json:"requestId,omitempty"`
+	UserId    int    `json:"userId"`
+	ItemId    int    `json:"itemId"`
+	// Score is the served score after the exploration and the
+	// post-processing, RawScore is of the model
+	Score    float32 `json:"score"`
+	RawScore float32 `json:"rawScore"`
+	// Version is the model version of WithModelVersion, e.g. the version
+	// resolved by the ModelRegistry
+	Version string `json:"version,omitempty"`
+	// FeatureHash is the hash of the sample vector predicted, to tell the
+	// feature changes on replay, 0 if the Predictor is an ItemScorer
+	FeatureHash uint64 `json:"featureHash,omitempty"`
+}
+
+// PredictionSink writes the PredictionEvents, e.g. FilePredictionSink or
+// KafkaPredictionSink
+type PredictionSink interface {
+	LogPredictions(ctx context.Context, events []PredictionEvent) error
+}
+
+// FilePredictionSink writes the PredictionEvents as JSON lines buffered
+// until Flush, it is safe for concurrent use
+type FilePredictionSink struct {
+	sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewFilePredictionSink(w io.Writer) *FilePredictionSink {
+	bw := bufio.NewWriter(w)
+	return &FilePredictionSink{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (s *FilePredictionSink) LogPredictions(_ context.Context, events []PredictionEvent) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, e := range events {
+		if err = s.enc.Encode(e); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Flush writes the buffered events to the underlying writer
+func (s *FilePredictionSink) Flush() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.w.Flush()
+}
+
+// KafkaProducer produces a message to a Kafka topic, the adapter of the
+// Kafka client of choice, e.g. a sarama.SyncProducer
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key, value []byte) error
+}
+
+// KafkaMessage is a message of KafkaBatchProducer
+type KafkaMessage struct {
+	Key   []byte
+	Value []byte
+}
+
+// KafkaBatchProducer produces the messages to a Kafka topic in a request,
+// KafkaPredictionSink prefers it to Produce if the producer implements it
+type KafkaBatchProducer interface {
+	ProduceBatch(ctx context.Context, topic string, messages []KafkaMessage) error
+}
+
+// KafkaPredictionSink produces every PredictionEvent as a JSON message to
+// Topic keyed by the userId, so the events of a user are in order in a
+// partition
+type KafkaPredictionSink struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+func NewKafkaPredictionSink(producer KafkaProducer, topic string) *KafkaPredictionSink {
+	return &KafkaPredictionSink{Producer: producer, Topic: topic}
+}
+
+func (s *KafkaPredictionSink) LogPredictions(ctx context.Context, events []PredictionEvent) (err error) {
+	messages := make([]KafkaMessage, len(events))
+	for i, e := range events {
+		messages[i].Key = []byte(strconv.Itoa(e.UserId))
+		if messages[i].Value, err = json.Marshal(e); err != nil {
+			return
+		}
+	}
+	if batch, ok := s.Producer.(KafkaBatchProducer); ok {
+		return batch.ProduceBatch(ctx, s.Topic, messages)
+	}
+	for _, m := range messages {
+		if err = s.Producer.Produce(ctx, s.Topic, m.Key, m.Value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ReadPredictionLog calls fn with the events of the JSON lines in r written
+// by FilePredictionSink in order until fn returns an error
+func ReadPredictionLog(r io.Reader, fn func(PredictionEvent) error) (err error) {
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var e PredictionEvent
+		if err = dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("prediction log line %d: %w", line, err)
+		}
+		if err = fn(e); err != nil {
+			return
+		}
+	}
+}
+
+// featureHashes collects the FeatureHash of the items predicted by
+// BatchPredict in the ctx of Rank
+type featureHashes struct {
+	sync.Mutex
+	hashes map[int]uint64 // map[itemId]hash
+}
+
+func withFeatureHashes(ctx context.Context) (context.Context, *featureHashes) {
+	fh := &featureHashes{hashes: make(map[int]uint64)}
+	return context.WithValue(ctx, featureHashesKey, fh), fh
+}
+
+func featureHashesOf(ctx context.Context) *featureHashes {
+	fh, _ := ctx.Value(featureHashesKey).(*featureHashes)
+	return fh
+}
+
+func (fh *featureHashes) add(itemId int, x []float32) {
+	h := fnv.New64a()
+	var buf [4]byte
+	for _, v := range x {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+		h.Write(buf[:])
+	}
+	fh.Lock()
+	fh.hashes[itemId] = h.Sum64()
+	fh.Unlock()
+}
+
+// rawScores returns the scores of the model by itemId before the
+// post-processing of itemScores in place
+func rawScores(itemScores []ItemScore) map[int]float32 {
+	raw := make(map[int]float32, len(itemScores))
+	for _, is := range itemScores {
+		raw[is.ItemId] = is.Score
+	}
+	return raw
+}
+
+// logPredictions queues itemScores served to userId for PredictionLog, raw
+// is the scores of rawScores
+func logPredictions(ctx context.Context, userId int, itemScores []ItemScore, raw map[int]float32, fh *featureHashes) {
+	sink := PredictionLog
+	if sink == nil || len(itemScores) == 0 {
+		return
+	}
+	var (
+		ts         = time.Now().UnixMilli()
+		requestId  = RequestMetaOf(ctx).RequestId
+		version, _ = ctx.Value(modelVersionKey).(string)
+		events     = make([]PredictionEvent, len(itemScores))
+	)
+	for i, is := range itemScores {
+		events[i] = PredictionEvent{
+			Timestamp: ts,
+			RequestId: requestId,
+			UserId:    userId,
+			ItemId:    is.ItemId,
+			Score:     is.Score,
+			RawScore:  raw[is.ItemId],
+			Version:   version,
+		}
+	}
+	if fh != nil {
+		fh.Lock()
+		for i := range events {
+			events[i].FeatureHash = fh.hashes[events[i].ItemId]
+		}
+		fh.Unlock()
+	}
+	startPredictionWriter()
+	select {
+	case predictionQueue <- predictionBatch{sink: sink, events: events}:
+	default:
+		atomic.AddUint64(&predictionsDropped, uint64(len(events)))
+	}
+}
+
+// FlushPredictionLog waits for the events queued before to be written and
+// flushed, e.g. before the shutdown
+func FlushPredictionLog() {
+	startPredictionWriter()
+	flushed := make(chan struct{})
+	predictionQueue <- predictionBatch{flushed: flushed}
+	<-flushed
+}
+
+func startPredictionWriter() {
+	predictionQueueOnce.Do(func() {
+		size := PredictionLogQueueSize
+		if size <= 0 {
+			size = 1
+		}
+		predictionQueue = make(chan predictionBatch, size)
+		go writePredictions(predictionQueue)
+	})
+}
+
+// writePredictions writes the events of queue in order, the consecutive
+// ones of the same sink in batches of PredictionLogBatchSize. The sinks are
+// flushed whenever queue is empty.
+func writePredictions(queue chan predictionBatch) {
+	var (
+		sink      PredictionSink
+		pending   []PredictionEvent
+		unflushed = make(map[predictionFlusher]bool)
+	)
+	write := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if err := sink.LogPredictions(context.Background(), pending); err != nil {
+			log.Errorf("log %d predictions error: %v", len(pending), err)
+		}
+		if f, ok := sink.(predictionFlusher); ok {
+			unflushed[f] = true
+		}
+		pending = pending[:0]
+	}
+	flush := func() {
+		write()
+		for f := range unflushed {
+			if err := f.Flush(); err != nil {
+				log.Errorf("flush predictions error: %v", err)
+			}
+			delete(unflushed, f)
+		}
+	}
+	handle := func(b predictionBatch) {
+		if b.flushed != nil {
+			flush()
+			close(b.flushed)
+			return
+		}
+		if b.sink != sink || len(pending)+len(b.events) > PredictionLogBatchSize {
+			write()
+			sink = b.sink
+		}
+		pending = append(pending, b.events...)
+	}
+	for {
+		handle(<-queue)
+		for len(queue) != 0 {
+			handle(<-queue)
+		}
+		flush()
+	}
+}
@@ -0,0 +1,142 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type memKafkaProducer struct {
+	topics []string
+	keys   []string
+	values [][]byte
+}
+
+func (p *memKafkaProducer) Produce(_ context.Context, topic string, key, value []byte) error {
+	p.topics = append(p.topics, topic)
+	p.keys = append(p.keys, string(key))
+	p.values = append(p.values, value)
+	return nil
+}
+
+// memKafkaBatchProducer produces in batches only
+type memKafkaBatchProducer struct {
+	memKafkaProducer
+	batches int
+}
+
+func (p *memKafkaBatchProducer) Produce(context.Context, string, []byte, []byte) error {
+	return errors.New("produce in batches")
+}
+
+func (p *memKafkaBatchProducer) ProduceBatch(ctx context.Context, topic string, messages []KafkaMessage) error {
+	p.batches++
+	for _, m := range messages {
+		_ = p.memKafkaProducer.Produce(ctx, topic, m.Key, m.Value)
+	}
+	return nil
+}
+
+// blockingPredictionSink blocks the writer until closed
+type blockingPredictionSink chan struct{}
+
+func (s blockingPredictionSink) LogPredictions(context.Context, []PredictionEvent) error {
+	<-s
+	return nil
+}
+
+func TestPredictionLog(t *testing.T) {
+	Convey("log the predictions of Rank", t, func() {
+		resetFeatureCache()
+		defer func() { PredictionLog = nil }()
+		var buf bytes.Buffer
+		PredictionLog = NewFilePredictionSink(&buf)
+		ctx := WithRequestMeta(WithModelVersion(context.Background(), "v1"), RequestMeta{RequestId: "r1"})
+
+		itemScores, err := Rank(ctx, idPredictor{}, 1, []int{3, 5})
+		So(err, ShouldBeNil)
+		So(itemScores, ShouldHaveLength, 2)
+		FlushPredictionLog()
+		var events []PredictionEvent
+		So(ReadPredictionLog(&buf, func(e PredictionEvent) error {
+			events = append(events, e)
+			return nil
+		}), ShouldBeNil)
+		So(events, ShouldHaveLength, 2)
+		for i, e := range events {
+			So(e.UserId, ShouldEqual, 1)
+			So(e.ItemId, ShouldEqual, itemScores[i].ItemId)
+			So(e.Score, ShouldEqual, itemScores[i].Score)
+			So(e.Version, ShouldEqual, "v1")
+			So(e.RequestId, ShouldEqual, "r1")
+			So(e.Timestamp, ShouldBeGreaterThan, 0)
+			So(e.FeatureHash, ShouldNotEqual, 0)
+		}
+		So(events[0].FeatureHash, ShouldNotEqual, events[1].FeatureHash)
+
+		// the same features of the same hash
+		_, err = Rank(ctx, idPredictor{}, 1, []int{3})
+		So(err, ShouldBeNil)
+		FlushPredictionLog()
+		var again PredictionEvent
+		So(json.Unmarshal(buf.Bytes(), &again), ShouldBeNil)
+		for _, e := range events {
+			if e.ItemId == 3 {
+				So(again.FeatureHash, ShouldEqual, e.FeatureHash)
+			}
+		}
+
+		Convey("to kafka", func() {
+			producer := &memKafkaProducer{}
+			PredictionLog = NewKafkaPredictionSink(producer, "predictions")
+			_, err := Rank(ctx, idPredictor{}, 7, []int{3, 5})
+			So(err, ShouldBeNil)
+			FlushPredictionLog()
+			So(producer.topics, ShouldResemble, []string{"predictions", "predictions"})
+			So(producer.keys, ShouldResemble, []string{"7", "7"})
+			var e PredictionEvent
+			So(json.Unmarshal(producer.values[0], &e), ShouldBeNil)
+			So(e.UserId, ShouldEqual, 7)
+		})
+
+		Convey("in batches", func() {
+			producer := &memKafkaBatchProducer{}
+			PredictionLog = NewKafkaPredictionSink(producer, "predictions")
+			for userId := 1; userId <= 3; userId++ {
+				_, err := Rank(ctx, idPredictor{}, userId, []int{3, 5})
+				So(err, ShouldBeNil)
+			}
+			FlushPredictionLog()
+			So(producer.batches, ShouldBeBetweenOrEqual, 1, 3)
+			So(producer.keys, ShouldResemble, []string{"1", "1", "2", "2", "3", "3"})
+			So(producer.Produce(ctx, "predictions", nil, nil), ShouldNotBeNil)
+		})
+
+		Convey("drop on the full queue", func() {
+			dropped := atomic.LoadUint64(&predictionsDropped)
+			blocked := make(blockingPredictionSink)
+			PredictionLog = blocked
+			startPredictionWriter()
+			// the writer holds one of them at most
+			for i := 0; i < cap(predictionQueue)+10; i++ {
+				logPredictions(ctx, 1, []ItemScore{{ItemId: 3}}, nil, nil)
+			}
+			close(blocked)
+			FlushPredictionLog()
+			So(atomic.LoadUint64(&predictionsDropped)-dropped, ShouldBeGreaterThanOrEqualTo, 9)
+		})
+	})
+
+	Convey("read the prediction log", t, func() {
+		err := ReadPredictionLog(strings.NewReader(`{"userId":1}`+"\nnot json\n"), func(PredictionEvent) error { return nil })
+		So(err, ShouldNotBeNil)
+		stop := errors.New("stop")
+		So(ReadPredictionLog(strings.NewReader(`{"userId":1}`), func(PredictionEvent) error { return stop }), ShouldEqual, stop)
+	})
+}
@@ -0,0 +1,185 @@
+package recommend
+
+import (
+	"context"
+	"io"
+	"math"
+	"sort"
+)
+
+// ScoreShift is the statistics of the replayed minus the logged raw scores
+type ScoreShift struct {
+	Mean    float64 `json:"mean"`
+	MeanAbs float64 `json:"meanAbs"`
+	P50Abs  float64 `json:"p50Abs"`
+	P99Abs  float64 `json:"p99Abs"`
+	MaxAbs  float64 `json:"maxAbs"`
+}
+
+// PredictionReplayReport compares the scores of a candidate model with the
+// ones of the production logged in the PredictionLog
+type PredictionReplayReport struct {
+	Requests    int `json:"requests"`
+	Predictions int `json:"predictions"`
+	// Errors are the requests failed to score by the candidate
+	Errors int `json:"errors"`
+	// FeatureMismatches are the predictions of a FeatureHash different from
+	// the logged one, the features are not as-of the log then
+	FeatureMismatches int `json:"featureMismatches"`
+	// Spearman is the mean rank correlation of the scores of the requests of
+	// more than one item of distinct scores
+	Spearman float64 `json:"spearman"`
+	// TopMatches are the requests of the same top scored item
+	TopMatches int        `json:"topMatches"`
+	ScoreShift ScoreShift `json:"scoreShift"`
+}
+
+// ReplayPredictions re-scores the predictions logged in r, e.g. by
+// FilePredictionSink, with candidate as of the logged time: the user
+// behaviors are looked up before the timestamp of the prediction. The other
+// features are the current ones of the providers, the FeatureMismatches tell
+// how many changed. The scores are compared with the logged RawScore, the
+// exploration and the post-processing of the served Score are not replayed. The predictions of a Rank call are a request, which
+// must be consecutive in r.
+func ReplayPredictions(ctx context.Context, candidate Predictor, r io.Reader) (report PredictionReplayReport, err error) {
+	var (
+		group     []PredictionEvent
+		shifts    []float64
+		sumShift  float64
+		spearmans int
+	)
+	replay := func() {
+		if len(group) == 0 {
+			return
+		}
+		report.Requests++
+		report.Predictions += len(group)
+		itemIds := make([]int, len(group))
+		for i, e := range group {
+			itemIds[i] = e.ItemId
+		}
+		hctx, hashes := withFeatureHashes(ctx)
+		itemScores, er := scoreChunk(hctx, candidate, group[0].UserId, itemIds, group[0].Timestamp/1000)
+		if er != nil {
+			logOf(ctx).Warnf("replay predictions of user %d error: %v", group[0].UserId, er)
+			report.Errors++
+			return
+		}
+		logged := make([]float32, len(group))
+		replayed := make([]float32, len(group))
+		for i, e := range group {
+			logged[i], replayed[i] = e.RawScore, itemScores[i].Score
+			shift := float64(replayed[i] - logged[i])
+			sumShift += shift
+			shifts = append(shifts, math.Abs(shift))
+			if hash, ok := hashes.hashes[e.ItemId]; ok && e.FeatureHash != 0 && hash != e.FeatureHash {
+				report.FeatureMismatches++
+			}
+		}
+		if argMax(logged) == argMax(replayed) {
+			report.TopMatches++
+		}
+		if rho, ok := spearman(logged, replayed); ok {
+			report.Spearman += rho
+			spearmans++
+		}
+	}
+
+	err = ReadPredictionLog(r, func(e PredictionEvent) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(group) != 0 && (e.RequestId != group[0].RequestId ||
+			e.UserId != group[0].UserId || e.Timestamp != group[0].Timestamp) {
+			replay()
+			group = group[:0]
+		}
+		group = append(group, e)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	replay()
+
+	if spearmans != 0 {
+		report.Spearman /= float64(spearmans)
+	}
+	if len(shifts) != 0 {
+		sort.Float64s(shifts)
+		var sumAbs float64
+		for _, s := range shifts {
+			sumAbs += s
+		}
+		quantile := func(q float64) float64 {
+			return shifts[int(math.Ceil(q*float64(len(shifts))))-1]
+		}
+		report.ScoreShift = ScoreShift{
+			Mean:    sumShift / float64(len(shifts)),
+			MeanAbs: sumAbs / float64(len(shifts)),
+			P50Abs:  quantile(0.5),
+			P99Abs:  quantile(0.99),
+			MaxAbs:  shifts[len(shifts)-1],
+		}
+	}
+	return
+}
+
+func argMax(scores []float32) (idx int) {
+	for i, s := range scores {
+		if s > scores[idx] {
+			idx = i
+		}
+	}
+	return
+}
+
+// spearman returns the Spearman rank correlation of a and b, the ties of
+// the average rank, ok is false if any of them is constant
+func spearman(a, b []float32) (rho float64, ok bool) {
+	if len(a) < 2 {
+		return
+	}
+	ra, rb := ranks(a), ranks(b)
+	var meanA, meanB float64
+	for i := range ra {
+		meanA += ra[i]
+		meanB += rb[i]
+	}
+	meanA /= float64(len(ra))
+	meanB /= float64(len(rb))
+	var cov, varA, varB float64
+	for i := range ra {
+		da, db := ra[i]-meanA, rb[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return
+	}
+	return cov / math.Sqrt(varA*varB), true
+}
+
+// ranks returns the 1-based rank of every score asc, the average rank of
+// the ties
+func ranks(scores []float32) []float64 {
+	idx := make([]int, len(scores))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return scores[idx[i]] < scores[idx[j]] })
+	r := make([]float64, len(scores))
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && scores[idx[j+1]] == scores[idx[i]] {
+			j++
+		}
+		avg := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			r[idx[k]] = avg
+		}
+		i = j + 1
+	}
+	return r
+}
@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// shiftedItemPredictor is an idPredictor of the item features changed
+type shiftedItemPredictor struct {
+	idPredictor
+}
+
+func (shiftedItemPredictor) GetItemFeature(_ context.Context, itemId int) (Tensor, error) {
+	return Tensor{float32(itemId + 1)}, nil
+}
+
+func TestReplayPredictions(t *testing.T) {
+	Convey("replay the prediction log", t, func() {
+		resetFeatureCache()
+		defer func() { PredictionLog = nil }()
+		var buf bytes.Buffer
+		PredictionLog = NewFilePredictionSink(&buf)
+		ctx := context.Background()
+		_, err := Rank(WithRequestMeta(ctx, RequestMeta{RequestId: "r1"}), idPredictor{}, 1, []int{3, 1, 2})
+		So(err, ShouldBeNil)
+		_, err = Rank(WithRequestMeta(ctx, RequestMeta{RequestId: "r2"}), idPredictor{}, 2, []int{5, 9})
+		So(err, ShouldBeNil)
+		FlushPredictionLog()
+		PredictionLog = nil
+		log := buf.Bytes()
+
+		Convey("the same model", func() {
+			report, err := ReplayPredictions(ctx, idPredictor{}, bytes.NewReader(log))
+			So(err, ShouldBeNil)
+			So(report.Requests, ShouldEqual, 2)
+			So(report.Predictions, ShouldEqual, 5)
+			So(report.Errors, ShouldEqual, 0)
+			So(report.FeatureMismatches, ShouldEqual, 0)
+			So(report.TopMatches, ShouldEqual, 2)
+			So(report.Spearman, ShouldAlmostEqual, 1)
+			So(report.ScoreShift, ShouldResemble, ScoreShift{})
+		})
+
+		Convey("the reversed scores", func() {
+			report, err := ReplayPredictions(ctx, scaledPredictor{scale: -1}, bytes.NewReader(log))
+			So(err, ShouldBeNil)
+			So(report.TopMatches, ShouldEqual, 0)
+			So(report.Spearman, ShouldAlmostEqual, -1)
+			So(report.ScoreShift.Mean, ShouldBeLessThan, 0)
+			So(report.ScoreShift.MaxAbs, ShouldAlmostEqual, 18)
+		})
+
+		Convey("the features changed", func() {
+			resetFeatureCache()
+			report, err := ReplayPredictions(ctx, shiftedItemPredictor{}, bytes.NewReader(log))
+			So(err, ShouldBeNil)
+			So(report.FeatureMismatches, ShouldEqual, 5)
+			So(report.Spearman, ShouldAlmostEqual, 1)
+			So(report.ScoreShift.Mean, ShouldAlmostEqual, 1)
+			So(report.ScoreShift.P50Abs, ShouldAlmostEqual, 1)
+		})
+	})
+
+	Convey("replay the raw scores of the post-processed", t, func() {
+		resetFeatureCache()
+		defer func(pp *PostProcessorRegistry) { PostProcessors = pp }(PostProcessors)
+		PostProcessors = NewPostProcessorRegistry()
+		So(PostProcessors.Register("minmax", MinMaxNormalize()), ShouldBeNil)
+		So(PostProcessors.SetProfile("", "minmax"), ShouldBeNil)
+		defer func() { PredictionLog = nil }()
+		var buf bytes.Buffer
+		PredictionLog = NewFilePredictionSink(&buf)
+		ctx := context.Background()
+		_, err := Rank(WithRequestMeta(ctx, RequestMeta{RequestId: "r1"}), idPredictor{}, 1, []int{3, 1, 2})
+		So(err, ShouldBeNil)
+		FlushPredictionLog()
+		PredictionLog = nil
+		var events []PredictionEvent
+		So(ReadPredictionLog(bytes.NewReader(buf.Bytes()), func(e PredictionEvent) error {
+			events = append(events, e)
+			return nil
+		}), ShouldBeNil)
+		So(events, ShouldHaveLength, 3)
+		So(events[0].Score, ShouldEqual, 1)
+		So(events[0].RawScore, ShouldEqual, 3)
+
+		report, err := ReplayPredictions(ctx, idPredictor{}, bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+		So(report.ScoreShift, ShouldResemble, ScoreShift{})
+	})
+
+	Convey("spearman rank correlation", t, func() {
+		rho, ok := spearman([]float32{1, 2, 3, 4}, []float32{10, 20, 30, 40})
+		So(ok, ShouldBeTrue)
+		So(rho, ShouldAlmostEqual, 1)
+		rho, ok = spearman([]float32{1, 2, 3}, []float32{1, 3, 2})
+		So(ok, ShouldBeTrue)
+		So(rho, ShouldAlmostEqual, 0.5)
+		So(ranks([]float32{3, 1, 3, 2}), ShouldResemble, []float64{3.5, 1, 3.5, 2})
+		_, ok = spearman([]float32{1, 1}, []float32{1, 2})
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,136 @@
+package recommend
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ProgressSample is the stage of GetSample
+	ProgressSample = "sample"
+	// ProgressFit is the stage of the Fitter
+	ProgressFit = "fit"
+)
+
+var (
+	// ProgressCallbacks are called on every ReportProgress
+	ProgressCallbacks []ProgressCallback
+	// ProgressLogInterval throttles the progress logs
+	ProgressLogInterval = 5 * time.Second
+)
+
+// Progress is the training progress reported by GetSample and the Fitters
+// per batch or epoch. Epoch is the current one from 1 and Batch the batches
+// done of it, Epochs and Batches are the totals if known, ETA in seconds is
+// 0 if unknown.
+type Progress struct {
+	Stage   string  `json:"stage"`
+	Epoch   int     `json:"epoch,omitempty"`
+	Epochs  int     `json:"epochs,omitempty"`
+	Batch   int     `json:"batch,omitempty"`
+	Batches int     `json:"batches,omitempty"`
+	Samples int     `json:"samples"`
+	Loss    float64 `json:"loss,omitempty"`
+	// Valid is the EvalMetrics of Model on the validation rows of Train
+	Valid *EvalMetrics `json:"valid,omitempty"`
+	// Model is the model at the end of an epoch to evaluate, optional
+	Model PredictAbstract `json:"-"`
+
+	SamplesPerSec float64 `json:"samplesPerSec"`
+	Elapsed       float64 `json:"elapsed"`
+	ETA           float64 `json:"eta"`
+}
+
+type ProgressCallback func(p *Progress)
+
+var progress struct {
+	sync.Mutex
+	stage   string
+	start   time.Time
+	logged  time.Time
+	valid   *TrainSample
+	current *Progress
+}
+
+// StartProgress starts the timing of stage, ReportProgress of a new stage
+// starts it too
+func StartProgress(stage string) {
+	progress.Lock()
+	defer progress.Unlock()
+	progress.stage, progress.start = stage, time.Now()
+}
+
+// setProgressValidation sets the validation rows to evaluate the epoch
+// models on, nil disables it
+func setProgressValidation(valid *TrainSample) {
+	progress.Lock()
+	defer progress.Unlock()
+	progress.valid = valid
+}
+
+// LastProgress returns the last Progress reported, nil if none
+func LastProgress() *Progress {
+	progress.Lock()
+	defer progress.Unlock()
+	if progress.current == nil {
+		return nil
+	}
+	p := *progress.current
+	return &p
+}
+
+// ReportProgress fills the rates and ETA of p, logs it and calls the
+// ProgressCallbacks
+func ReportProgress(p Progress) {
+	progress.Lock()
+	now := time.Now()
+	if p.Stage != progress.stage {
+		progress.stage, progress.start = p.Stage, now
+	}
+	valid := progress.valid
+	p.Elapsed = now.Sub(progress.start).Seconds()
+	if p.Elapsed > 0 {
+		p.SamplesPerSec = float64(p.Samples) / p.Elapsed
+	}
+	if done := progressDone(&p); done > 0 && done < 1 {
+		p.ETA = p.Elapsed * (1 - done) / done
+	}
+	logIt := now.Sub(progress.logged) >= ProgressLogInterval
+	if logIt {
+		progress.logged = now
+	}
+	progress.Unlock()
+
+	if p.Model != nil && valid != nil && (p.Batches == 0 || p.Batch == p.Batches) {
+		var err error
+		if p.Valid, err = Evaluate(p.Model, valid); err != nil {
+			log.Warnf("evaluate %s epoch %d error: %v", p.Stage, p.Epoch, err)
+		}
+	}
+	if logIt {
+		log.Infof("%s epoch %d/%d batch %d/%d: %d samples, loss %.5g, %.0f samples/s, eta %s",
+			p.Stage, p.Epoch, p.Epochs, p.Batch, p.Batches, p.Samples, p.Loss, p.SamplesPerSec,
+			time.Duration(p.ETA*float64(time.Second)).Round(time.Second))
+	}
+
+	progress.Lock()
+	progress.current = &p
+	progress.Unlock()
+	for _, cb := range ProgressCallbacks {
+		cb(&p)
+	}
+}
+
+// progressDone returns the ratio of p done, 0 if unknown
+func progressDone(p *Progress) float64 {
+	if p.Epochs <= 0 || p.Epoch <= 0 {
+		return 0
+	}
+	if p.Batches <= 0 {
+		return float64(p.Epoch) / float64(p.Epochs)
+	}
+	return (float64(p.Epoch-1)*float64(p.Batches) + float64(p.Batch)) /
+		(float64(p.Epochs) * float64(p.Batches))
+}
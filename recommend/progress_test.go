@@ -0,0 +1,68 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type progressFitter struct{}
+
+func (progressFitter) Fit(sample *TrainSample) (PredictAbstract, error) {
+	for epoch := 1; epoch <= 2; epoch++ {
+		for b := 1; b <= 4; b++ {
+			p := Progress{Stage: ProgressFit, Epoch: epoch, Epochs: 2, Batch: b, Batches: 4,
+				Samples: ((epoch-1)*4 + b) * sample.Rows / 4, Loss: 1 / float64(epoch)}
+			if b == 4 {
+				p.Model = idPredictor{}
+			}
+			ReportProgress(p)
+		}
+	}
+	return idPredictor{}, nil
+}
+
+func TestProgress(t *testing.T) {
+	Convey("training progress", t, func() {
+		resetFeatureCache()
+		defer func(rows int) {
+			ProgressCallbacks, ImportanceRows = nil, rows
+		}(ImportanceRows)
+		ImportanceRows = 100
+		var reports []Progress
+		ProgressCallbacks = []ProgressCallback{func(p *Progress) { reports = append(reports, *p) }}
+
+		_, err := TrainWithResult(context.Background(), idRecSys{}, progressFitter{})
+		So(err, ShouldBeNil)
+
+		var sample, fit []Progress
+		for _, p := range reports {
+			if p.Stage == ProgressSample {
+				sample = append(sample, p)
+			} else {
+				fit = append(fit, p)
+			}
+		}
+		So(sample, ShouldNotBeEmpty)
+		So(sample[len(sample)-1].Samples, ShouldEqual, 1000)
+		So(fit, ShouldHaveLength, 8)
+		So(fit[0].Valid, ShouldBeNil)
+		So(fit[3].Valid, ShouldNotBeNil)
+		So(fit[3].Valid.AUC, ShouldEqual, 1)
+		So(fit[3].Valid.Rows, ShouldEqual, 100)
+		for _, p := range fit[:7] {
+			So(p.ETA, ShouldBeGreaterThanOrEqualTo, 0)
+		}
+		So(fit[7].ETA, ShouldEqual, 0)
+		So(fit[7].Samples, ShouldEqual, 1800)
+		So(LastProgress().Epoch, ShouldEqual, 2)
+	})
+
+	Convey("progress done", t, func() {
+		So(progressDone(&Progress{Epoch: 1, Epochs: 2, Batch: 2, Batches: 4}), ShouldEqual, 0.25)
+		So(progressDone(&Progress{Epoch: 2, Epochs: 2, Batch: 4, Batches: 4}), ShouldEqual, 1)
+		So(progressDone(&Progress{Epoch: 1, Epochs: 4}), ShouldEqual, 0.25)
+		So(progressDone(&Progress{Samples: 10}), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,293 @@
+package recommend
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	ProjectionPCA  = "pca"
+	ProjectionTSNE = "tsne"
+)
+
+var (
+	// TSNEMaxItems bounds the items projected by t-SNE, which is quadratic of
+	// the items, evenly spaced in the item id order
+	TSNEMaxItems = 2000
+	// TSNEPerplexity is the effective neighbors of every item of t-SNE
+	TSNEPerplexity = 30.0
+	// TSNEIterations is the gradient descent iterations of t-SNE
+	TSNEIterations = 500
+)
+
+// ExportEmbeddingProjection projects the item embedding of the last Train to
+// 2D by method, ProjectionPCA or ProjectionTSNE, and writes a TSV of the
+// item id, the coordinates, the item key of ItemIds if set and the norm of
+// the vector with a header, which the TensorBoard projector loads as the
+// vectors with the metadata, to eyeball the embedding quality
+func ExportEmbeddingProjection(w io.Writer, method string) (err error) {
+	embMap := itemEmbeddingMap.load()
+	if len(embMap) == 0 {
+		return fmt.Errorf("no item embedding trained")
+	}
+	return writeEmbeddingProjection(w, embMap, method)
+}
+
+func writeEmbeddingProjection(w io.Writer, emb word2vec.EmbeddingMap32, method string) (err error) {
+	ids := make([]string, 0, len(emb))
+	for id := range emb {
+		ids = append(ids, id)
+	}
+	sortItemIds(ids)
+
+	var coords *mat.Dense
+	switch method {
+	case ProjectionPCA:
+		coords, err = projectPCA(emb, ids)
+	case ProjectionTSNE:
+		if len(ids) > TSNEMaxItems {
+			stride := float64(len(ids)) / float64(TSNEMaxItems)
+			sampled := make([]string, TSNEMaxItems)
+			for i := range sampled {
+				sampled[i] = ids[int(float64(i)*stride)]
+			}
+			ids = sampled
+		}
+		coords, err = projectTSNE(emb, ids)
+	default:
+		return fmt.Errorf("unknown projection method %q", method)
+	}
+	if err != nil {
+		return
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "itemId\tx\ty\tkey\tnorm")
+	for i, id := range ids {
+		var key string
+		if itemId, er := strconv.Atoi(id); er == nil && ItemIds != nil {
+			key, _ = ItemIds.External(itemId)
+		}
+		var norm float64
+		for _, v := range emb[id] {
+			norm += float64(v) * float64(v)
+		}
+		fmt.Fprintf(bw, "%s\t%g\t%g\t%s\t%g\n", id, coords.At(i, 0), coords.At(i, 1), key, math.Sqrt(norm))
+	}
+	return bw.Flush()
+}
+
+// sortItemIds sorts the item ids numerically, the non numeric ones last
+func sortItemIds(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		a, errA := strconv.Atoi(ids[i])
+		b, errB := strconv.Atoi(ids[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		if (errA == nil) != (errB == nil) {
+			return errA == nil
+		}
+		return ids[i] < ids[j]
+	})
+}
+
+// embeddingMatrix returns the centered vectors of ids in rows
+func embeddingMatrix(emb word2vec.EmbeddingMap32, ids []string) (x *mat.Dense, err error) {
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("%d items to project", len(ids))
+	}
+	dim := len(emb[ids[0]])
+	x = mat.NewDense(len(ids), dim, nil)
+	mean := make([]float64, dim)
+	for i, id := range ids {
+		if len(emb[id]) != dim {
+			return nil, fmt.Errorf("item %s dim %d != %d", id, len(emb[id]), dim)
+		}
+		row := x.RawRowView(i)
+		for j, v := range emb[id] {
+			row[j] = float64(v)
+		}
+		floats.Add(mean, row)
+	}
+	floats.Scale(1/float64(len(ids)), mean)
+	for i := range ids {
+		floats.Sub(x.RawRowView(i), mean)
+	}
+	return
+}
+
+// projectPCA returns the coordinates of ids on the 2 principal components
+func projectPCA(emb word2vec.EmbeddingMap32, ids []string) (coords *mat.Dense, err error) {
+	x, err := embeddingMatrix(emb, ids)
+	if err != nil {
+		return
+	}
+	var svd mat.SVD
+	if !svd.Factorize(x, mat.SVDThin) {
+		return nil, fmt.Errorf("svd of the %d items failed", len(ids))
+	}
+	var v mat.Dense
+	svd.VTo(&v)
+	r, c := v.Dims()
+	coords = mat.NewDense(len(ids), 2, nil)
+	if c < 2 {
+		// 1 dim embedding, y is 0
+		coords.Slice(0, len(ids), 0, 1).(*mat.Dense).Mul(x, &v)
+		return
+	}
+	coords.Mul(x, v.Slice(0, r, 0, 2))
+	return
+}
+
+// projectTSNE returns the exact t-SNE coordinates of ids, initialized by
+// the PCA ones so that it is deterministic
+func projectTSNE(emb word2vec.EmbeddingMap32, ids []string) (y *mat.Dense, err error) {
+	x, err := embeddingMatrix(emb, ids)
+	if err != nil {
+		return
+	}
+	n := len(ids)
+	p := tsneAffinities(x, math.Min(TSNEPerplexity, float64(n-1)/3))
+
+	if y, err = projectPCA(emb, ids); err != nil {
+		return
+	}
+	// scale the init to the std of 1e-4
+	var std float64
+	for _, v := range y.RawMatrix().Data {
+		std += v * v
+	}
+	if std = math.Sqrt(std / float64(2*n)); std > 0 {
+		y.Scale(1e-4/std, y)
+	}
+
+	const (
+		learnRate         = 200.0
+		exaggeration      = 12.0
+		exaggerationIters = 100
+		momentumSwitch    = 250
+		minGain           = 0.01
+	)
+	var (
+		grad   = make([]float64, 2*n)
+		update = make([]float64, 2*n)
+		gains  = make([]float64, 2*n)
+		num    = make([]float64, n*n)
+		yd     = y.RawMatrix().Data
+	)
+	for i := range gains {
+		gains[i] = 1
+	}
+	for iter := 0; iter < TSNEIterations; iter++ {
+		exag, momentum := 1.0, 0.8
+		if iter < exaggerationIters {
+			exag = exaggeration
+		}
+		if iter < momentumSwitch {
+			momentum = 0.5
+		}
+		// the student-t kernel of the low dimensional distances
+		var sumNum float64
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				dx, dy := yd[2*i]-yd[2*j], yd[2*i+1]-yd[2*j+1]
+				q := 1 / (1 + dx*dx + dy*dy)
+				num[i*n+j], num[j*n+i] = q, q
+				sumNum += 2 * q
+			}
+		}
+		for i := range grad {
+			grad[i] = 0
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if i == j {
+					continue
+				}
+				q := math.Max(num[i*n+j]/sumNum, 1e-12)
+				m := 4 * (exag*p[i*n+j] - q) * num[i*n+j]
+				grad[2*i] += m * (yd[2*i] - yd[2*j])
+				grad[2*i+1] += m * (yd[2*i+1] - yd[2*j+1])
+			}
+		}
+		for i := range yd {
+			if (grad[i] > 0) != (update[i] > 0) {
+				gains[i] += 0.2
+			} else {
+				gains[i] = math.Max(gains[i]*0.8, minGain)
+			}
+			update[i] = momentum*update[i] - learnRate*gains[i]*grad[i]
+			yd[i] += update[i]
+		}
+	}
+	return
+}
+
+// tsneAffinities returns the symmetric joint probabilities of the rows of
+// x, the conditional ones of every row are of the perplexity
+func tsneAffinities(x *mat.Dense, perplexity float64) (p []float64) {
+	n, _ := x.Dims()
+	dist := make([]float64, n*n)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			d := floats.Distance(x.RawRowView(i), x.RawRowView(j), 2)
+			dist[i*n+j], dist[j*n+i] = d*d, d*d
+		}
+	}
+
+	p = make([]float64, n*n)
+	logPerp := math.Log(perplexity)
+	for i := 0; i < n; i++ {
+		row := p[i*n : (i+1)*n]
+		// binary search the precision beta of the gaussian of the row
+		beta, lo, hi := 1.0, 0.0, math.Inf(1)
+		for try := 0; try < 50; try++ {
+			var sum, sumDP float64
+			for j := 0; j < n; j++ {
+				if j == i {
+					row[j] = 0
+					continue
+				}
+				row[j] = math.Exp(-beta * dist[i*n+j])
+				sum += row[j]
+				sumDP += row[j] * dist[i*n+j]
+			}
+			if sum == 0 {
+				sum = 1e-12
+			}
+			entropy := math.Log(sum) + beta*sumDP/sum
+			floats.Scale(1/sum, row)
+			diff := entropy - logPerp
+			if math.Abs(diff) < 1e-5 {
+				break
+			}
+			if diff > 0 {
+				lo = beta
+				if math.IsInf(hi, 1) {
+					beta *= 2
+				} else {
+					beta = (beta + hi) / 2
+				}
+			} else {
+				hi = beta
+				beta = (beta + lo) / 2
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			v := math.Max((p[i*n+j]+p[j*n+i])/float64(2*n), 1e-12)
+			p[i*n+j], p[j*n+i] = v, v
+		}
+	}
+	return
+}
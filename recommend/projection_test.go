@@ -0,0 +1,58 @@
+package recommend
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExportEmbeddingProjection(t *testing.T) {
+	Convey("project item embedding to 2D", t, func() {
+		defer itemEmbeddingMap.store(itemEmbeddingMap.load())
+		// two clusters of 10 items, around +1 and -1 of every dim
+		rnd := rand.New(rand.NewSource(1))
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{})
+		for i := 0; i < 20; i++ {
+			center := float32(1)
+			if i >= 10 {
+				center = -1
+			}
+			vec := make([]float32, 8)
+			for j := range vec {
+				vec[j] = center + float32(rnd.NormFloat64()*0.1)
+			}
+			itemEmbeddingMap.load()[strconv.Itoa(i)] = vec
+		}
+
+		for _, method := range []string{ProjectionPCA, ProjectionTSNE} {
+			var buf bytes.Buffer
+			So(ExportEmbeddingProjection(&buf, method), ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			So(lines, ShouldHaveLength, 21)
+			So(lines[0], ShouldEqual, "itemId\tx\ty\tkey\tnorm")
+
+			// the clusters are apart on x of the first principal component,
+			// which initializes t-SNE too
+			var xs []float64
+			for i, line := range lines[1:] {
+				fields := strings.Split(line, "\t")
+				So(fields, ShouldHaveLength, 5)
+				So(fields[0], ShouldEqual, strconv.Itoa(i))
+				x, err := strconv.ParseFloat(fields[1], 64)
+				So(err, ShouldBeNil)
+				xs = append(xs, x)
+			}
+			for i := 1; i < 10; i++ {
+				So(xs[i]*xs[0], ShouldBeGreaterThan, 0)
+				So(xs[10+i]*xs[0], ShouldBeLessThan, 0)
+			}
+		}
+
+		So(ExportEmbeddingProjection(&bytes.Buffer{}, "umap"), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,227 @@
+package recommend
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// TenantHeader is the http header of the recommend api carrying the API
+	// key or the tenant the quota is enforced by
+	TenantHeader = "X-Api-Key"
+	// SurfaceHeader is the http header of the recommend api carrying the
+	// surface of the tenant, e.g. "home" or "cart"
+	SurfaceHeader = "X-Surface"
+)
+
+var (
+	// Quotas is enforced by the recommend api, the requests over the quota
+	// are rejected with 429. nil means no quota.
+	Quotas *QuotaManager
+
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// Quota of a tenant or a surface of it
+type Quota struct {
+	// QPS <= 0 means no limit
+	QPS float64
+	// Burst is the requests allowed at once, <= 0 means max(1, QPS)
+	Burst int
+	// MaxBatch is the max items of a request, <= 0 means no limit
+	MaxBatch int
+}
+
+// QuotaManager enforces the quotas of the tenants and their surfaces. A
+// request must be allowed by the quota of its surface if set, and by the
+// quota of its tenant. The tenants without any quota set share the Default
+// one, and are counted as the tenant "" like the surfaces without a quota,
+// so the client supplied headers do not grow the buckets and the metrics.
+type QuotaManager struct {
+	Default Quota
+
+	sync.Mutex
+	tenants map[string]bool
+	quotas  map[quotaKey]Quota
+	buckets map[quotaKey]*tokenBucket
+	counts  map[quotaKey]*quotaCount
+}
+
+type quotaKey struct {
+	tenant, surface string
+}
+
+type quotaCount struct {
+	allowed, rejected uint64
+}
+
+func NewQuotaManager(def Quota) *QuotaManager {
+	return &QuotaManager{
+		Default: def,
+		tenants: make(map[string]bool),
+		quotas:  make(map[quotaKey]Quota),
+		buckets: make(map[quotaKey]*tokenBucket),
+		counts:  make(map[quotaKey]*quotaCount),
+	}
+}
+
+// SetQuota sets the quota of the surface of tenant, surface "" sets the
+// quota of the tenant
+func (q *QuotaManager) SetQuota(tenant, surface string, quota Quota) {
+	q.Lock()
+	defer q.Unlock()
+	key := quotaKey{tenant, surface}
+	q.tenants[tenant] = true
+	q.quotas[key] = quota
+	delete(q.buckets, key)
+}
+
+// Allow takes a request of batch items of the surface of tenant, the error
+// wraps ErrQuotaExceeded if rejected
+func (q *QuotaManager) Allow(tenant, surface string, batch int) (err error) {
+	q.Lock()
+	defer q.Unlock()
+	if !q.tenants[tenant] {
+		tenant = ""
+	}
+	if _, ok := q.quotas[quotaKey{tenant, surface}]; !ok {
+		surface = ""
+	}
+	var (
+		now  = time.Now()
+		keys = []quotaKey{{tenant, ""}}
+	)
+	if surface != "" {
+		keys = append(keys, quotaKey{tenant, surface})
+	}
+	for _, key := range keys {
+		quota, ok := q.quotas[key]
+		if !ok {
+			quota = q.Default
+		}
+		if quota.MaxBatch > 0 && batch > quota.MaxBatch {
+			err = fmt.Errorf("%w: batch size %d over %d of %s", ErrQuotaExceeded, batch, quota.MaxBatch, key)
+			break
+		}
+	}
+	// take the tokens only if all the quotas allow
+	if err == nil {
+		for _, key := range keys {
+			if !q.bucketOf(key, now).ready(now) {
+				err = fmt.Errorf("%w: qps of %s", ErrQuotaExceeded, key)
+				break
+			}
+		}
+	}
+	if err == nil {
+		for _, key := range keys {
+			q.bucketOf(key, now).take()
+		}
+	}
+
+	count := q.counts[quotaKey{tenant, surface}]
+	if count == nil {
+		count = &quotaCount{}
+		q.counts[quotaKey{tenant, surface}] = count
+	}
+	if err != nil {
+		count.rejected++
+	} else {
+		count.allowed++
+	}
+	return
+}
+
+// bucketOf returns the token bucket of key, nil if no qps limit
+func (q *QuotaManager) bucketOf(key quotaKey, now time.Time) *tokenBucket {
+	if b, ok := q.buckets[key]; ok {
+		return b
+	}
+	quota, ok := q.quotas[key]
+	if !ok {
+		quota = q.Default
+	}
+	var b *tokenBucket
+	if quota.QPS > 0 {
+		b = newTokenBucket(quota.QPS, quota.Burst, now)
+	}
+	q.buckets[key] = b
+	return b
+}
+
+// eachCount calls fn with the requests counted by tenant and surface in
+// order
+func (q *QuotaManager) eachCount(fn func(tenant, surface string, allowed, rejected uint64)) {
+	q.Lock()
+	defer q.Unlock()
+	keys := make([]quotaKey, 0, len(q.counts))
+	for key := range q.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tenant != keys[j].tenant {
+			return keys[i].tenant < keys[j].tenant
+		}
+		return keys[i].surface < keys[j].surface
+	})
+	for _, key := range keys {
+		count := q.counts[key]
+		fn(key.tenant, key.surface, count.allowed, count.rejected)
+	}
+}
+
+func (k quotaKey) String() string {
+	if k.surface == "" {
+		return fmt.Sprintf("tenant %q", k.tenant)
+	}
+	return fmt.Sprintf("tenant %q surface %q", k.tenant, k.surface)
+}
+
+// tokenBucket refills rate tokens per second up to burst, nil allows all
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	b := float64(burst)
+	if burst <= 0 {
+		b = rate
+		if b < 1 {
+			b = 1
+		}
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: now}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if !b.ready(now) {
+		return false
+	}
+	b.take()
+	return true
+}
+
+// ready refills the tokens by now and returns true if a token is left
+func (b *tokenBucket) ready(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	return b.tokens >= 1
+}
+
+func (b *tokenBucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
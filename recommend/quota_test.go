@@ -0,0 +1,85 @@
+package recommend
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuota(t *testing.T) {
+	Convey("tenant and surface quotas", t, func() {
+		q := NewQuotaManager(Quota{QPS: 1, Burst: 2})
+		q.SetQuota("big", "", Quota{MaxBatch: 100})
+		q.SetQuota("big", "cart", Quota{QPS: 1, Burst: 1, MaxBatch: 10})
+
+		// the unknown tenants share the default quota
+		So(q.Allow("small", "", 10), ShouldBeNil)
+		So(q.Allow("small", "home", 10), ShouldBeNil)
+		err := q.Allow("small", "", 10)
+		So(errors.Is(err, ErrQuotaExceeded), ShouldBeTrue)
+		So(errors.Is(q.Allow("other", "", 10), ErrQuotaExceeded), ShouldBeTrue)
+
+		// no qps limit of big but the cart surface
+		for i := 0; i < 10; i++ {
+			So(q.Allow("big", "home", 100), ShouldBeNil)
+		}
+		So(errors.Is(q.Allow("big", "", 101), ErrQuotaExceeded), ShouldBeTrue)
+		So(errors.Is(q.Allow("big", "cart", 11), ErrQuotaExceeded), ShouldBeTrue)
+		So(q.Allow("big", "cart", 10), ShouldBeNil)
+		So(errors.Is(q.Allow("big", "cart", 10), ErrQuotaExceeded), ShouldBeTrue)
+
+		counts := make(map[quotaKey]quotaCount)
+		q.eachCount(func(tenant, surface string, allowed, rejected uint64) {
+			counts[quotaKey{tenant, surface}] = quotaCount{allowed, rejected}
+		})
+		So(counts, ShouldResemble, map[quotaKey]quotaCount{
+			{"", ""}:        {allowed: 2, rejected: 2},
+			{"big", ""}:     {allowed: 10, rejected: 1},
+			{"big", "cart"}: {allowed: 1, rejected: 2},
+		})
+
+		defer func() { Quotas = nil }()
+		Quotas = q
+		var bw bytes.Buffer
+		_, err = Collector().WriteTo(&bw)
+		So(err, ShouldBeNil)
+		So(bw.String(), ShouldContainSubstring, `ctr_quota_requests_total{result="rejected",surface="cart",tenant="big"} 2`)
+
+		// the tenant token is not taken by the request rejected by the surface
+		q.SetQuota("mid", "", Quota{QPS: 1, Burst: 2})
+		q.SetQuota("mid", "cart", Quota{QPS: 1, Burst: 1})
+		So(q.Allow("mid", "cart", 1), ShouldBeNil)
+		So(errors.Is(q.Allow("mid", "cart", 1), ErrQuotaExceeded), ShouldBeTrue)
+		So(q.Allow("mid", "", 1), ShouldBeNil)
+
+		// the batch of a request is all its candidates
+		req := RecApiRequest{
+			ItemIdList:  []int{1, 2},
+			ItemKeyList: []string{"a", "b", "c"},
+			Items:       []InlineItem{{ItemId: 9, Feature: Tensor{1}}},
+		}
+		So(req.candidates(), ShouldEqual, 6)
+		q.SetQuota("keys", "", Quota{MaxBatch: 5})
+		So(errors.Is(q.Allow("keys", "", req.candidates()), ErrQuotaExceeded), ShouldBeTrue)
+	})
+
+	Convey("token bucket", t, func() {
+		now := time.Now()
+		b := newTokenBucket(10, 0, now)
+		for i := 0; i < 10; i++ {
+			So(b.allow(now), ShouldBeTrue)
+		}
+		So(b.allow(now), ShouldBeFalse)
+		So(b.allow(now.Add(100*time.Millisecond)), ShouldBeTrue)
+		So(b.allow(now.Add(100*time.Millisecond)), ShouldBeFalse)
+		// refilled up to burst only
+		So(b.allow(now.Add(time.Hour)), ShouldBeTrue)
+		So(b.tokens, ShouldEqual, 9)
+
+		var unlimited *tokenBucket
+		So(unlimited.allow(now), ShouldBeTrue)
+	})
+}
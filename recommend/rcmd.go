@@ -2,9 +2,12 @@ package recommend
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/auxten/go-ctr/feature/embedding"
@@ -18,7 +21,6 @@ import (
 
 const (
 	SampleAssembler       = 16
-	StageKey              = "stage"
 	ItemEmbDim            = 16
 	ItemEmbWindow         = 5
 	UserBehaviorLen       = 10
@@ -29,7 +31,7 @@ const (
 
 var (
 	itemEmbeddingModel model.Model
-	itemEmbeddingMap   word2vec.EmbeddingMap32
+	itemEmbeddingMap   embeddingMap
 	//TODO: maybe a switch to control whether to reuse training cache when predict
 	UserFeatureCache  *ccache.Cache
 	ItemFeatureCache  *ccache.Cache
@@ -37,9 +39,22 @@ var (
 
 	// DefaultUserFeature and DefaultItemFeature are backup if not nil
 	//when user or item missing in database, use this to fill
+	// see UserImputer and ItemImputer for the imputation strategies
 	DefaultUserFeature []float32
 	DefaultItemFeature []float32
 
+	// ItemEmbeddingOptions configures the item embedding model trained by
+	// Train, e.g. embedding.GloVe or more Iter for dense catalogs, fewer
+	// MinCount for sparse ones. Dim is always ItemEmbDim.
+	ItemEmbeddingOptions = embedding.DefaultOptions(ItemEmbWindow, ItemEmbDim, 1)
+
+	// ItemEmbeddingFile is loaded by Train as the item embedding instead of
+	// training the item2vec model if it exists, else the trained embedding is
+	// saved to it. The format is chosen by the extension: ".json", ".bin" for
+	// the word2vec binary format, otherwise text.
+	ItemEmbeddingFile string
+
+	// Deprecated: DebugUserId and DebugItemId are racy, use WithDebug
 	DebugUserId int
 	DebugItemId int
 )
@@ -60,13 +75,37 @@ type TrainSample struct {
 	XCols int
 
 	Info SampleInfo
+	// Dropped is the samples dropped by GetSample for errors
+	Dropped DropStats
+	// Sparse is the sparse features of every row if SparseFeatureDim > 0, X
+	// has the dense features only then, see Densify
+	Sparse []SparseTensor
+	// Tasks is the labels of every row if the samples have Labels, Labels
+	// are Rows*Tasks then, the first of every row is Y
+	Tasks  int
+	Labels []float32
+	// Keys is the SampleKey of every row to split the rows by the user or the
+	// time, nil if unknown, e.g. the TrainSample of a checkpoint
+	Keys []SampleKey
+}
+
+// SampleKey is the Sample a TrainSample row is assembled from
+type SampleKey struct {
+	UserId    int
+	ItemId    int
+	Timestamp int64
 }
 
 type sampleVec struct {
 	vec    []float32
+	sparse SparseTensor
 	label  float32
+	labels []float32
+	key    SampleKey
+	seq    int
 	iWidth int
 	uWidth int
+	err    error // only in Strict mode
 }
 
 type RecSys interface {
@@ -134,6 +173,14 @@ type SampleInfo struct {
 	UserBehaviorRange [2]int // [start, end)
 	ItemFeatureRange  [2]int // [start, end)
 	CtxFeatureRange   [2]int // [start, end)
+	// BehaviorChannelRanges follow CtxFeatureRange, one per BehaviorChannels
+	BehaviorChannelRanges []BehaviorChannelRange
+	// RequestCtxRange is the context features of CtxFeatureWidth and the
+	// CyclicalTimeEncoding at the end
+	RequestCtxRange [2]int // [start, end)
+	// SparseRange is the sparse features of SparseFeatureDim at the end of
+	// the densified vector, see TrainSample.Densify
+	SparseRange [2]int // [start, end)
 }
 
 type UserItemOverview struct {
@@ -148,10 +195,13 @@ type ItemOverView struct {
 
 type UserItemOverviewResult struct {
 	Users []UserItemOverview `json:"users"`
+	// Aggregations are computed by the engine, see OverviewAggregations
+	Aggregations *OverviewAggregations `json:"aggregations,omitempty"`
 }
 
 type ItemOverviewResult struct {
-	Items []ItemOverView `json:"items"`
+	Items        []ItemOverView        `json:"items"`
+	Aggregations *OverviewAggregations `json:"aggregations,omitempty"`
 }
 
 type DashboardOverviewResult struct {
@@ -160,6 +210,10 @@ type DashboardOverviewResult struct {
 	TotalPositive int `json:"total_positive"`
 	ValidPositive int `json:"valid_positive"`
 	ValidNegative int `json:"valid_negative"`
+	// LabelBalance is computed by the engine, see LabelBalanceSamples
+	LabelBalance []LabelBucket `json:"label_balance,omitempty"`
+	// Training is the LastProgress of the training if any
+	Training *Progress `json:"training,omitempty"`
 }
 
 type FeatureOverview interface {
@@ -177,6 +231,13 @@ type PreRanker interface {
 	PreRank(context.Context) error
 }
 
+// PostRanker is invoked at the end of Rank to apply the business rules like
+// boosts, blocklists, category caps and stock filters. It may drop or reorder
+// the items.
+type PostRanker interface {
+	PostRank(ctx context.Context, userId int, itemScores []ItemScore) ([]ItemScore, error)
+}
+
 type PreTrainer interface {
 	PreTrain(context.Context) error
 }
@@ -184,6 +245,17 @@ type PreTrainer interface {
 type ItemScore struct {
 	ItemId int     `json:"itemId"`
 	Score  float32 `json:"score"`
+	// ItemKey is the external id of the item if ItemIds is set
+	ItemKey string `json:"itemKey,omitempty"`
+	// Variant is the Experiment variant scored the item
+	Variant string `json:"variant,omitempty"`
+	// Explored is true if the score is adjusted by the ExplorationPolicy
+	Explored bool `json:"explored,omitempty"`
+	// Sponsored is true if the item is mixed in by the SponsoredBlender
+	Sponsored bool `json:"sponsored,omitempty"`
+	// Tasks are the scores of every task of a multi-task model, Score is
+	// the combined one then
+	Tasks []float32 `json:"tasks,omitempty"`
 }
 
 type Sample struct {
@@ -191,119 +263,372 @@ type Sample struct {
 	ItemId    int     `json:"itemId"`
 	Label     float32 `json:"label"`
 	Timestamp int64   `json:"timestamp"`
+	// Labels are the labels of the next tasks for the multi-task models,
+	// e.g. the conversion after the click of Label, see TrainSample.Tasks
+	Labels []float32 `json:"labels,omitempty"`
 }
 
 func Train(ctx context.Context, recSys RecSys, mlp Fitter) (model Predictor, err error) {
-	ctx = context.WithValue(ctx, StageKey, TrainStage)
+	result, err := TrainWithResult(ctx, recSys, mlp)
+	if err != nil {
+		return
+	}
+	return result.Model, nil
+}
 
-	if preTrain, ok := recSys.(PreTrainer); ok {
-		err = preTrain.PreTrain(ctx)
-		if err != nil {
-			log.Errorf("pre train error: %v", err)
+// TrainWithResult is Train returning the TrainResult with the sample stats
+// and FeatureImportance if ImportanceRows is set.
+func TrainWithResult(ctx context.Context, recSys RecSys, mlp Fitter) (result *TrainResult, err error) {
+	var ckpt *Checkpoint
+	if CheckpointDir != "" {
+		if ckpt, err = OpenCheckpoint(CheckpointDir); err != nil {
+			log.Errorf("open checkpoint error: %v", err)
+			return
+		}
+		// a fresh training, do not load anything from the previous one
+		if err = ckpt.Reset(); err != nil {
+			log.Errorf("reset checkpoint error: %v", err)
 			return
 		}
 	}
+	return train(ctx, recSys, mlp, ckpt)
+}
 
-	if itemEbd, ok := recSys.(ItemEmbedding); ok {
-		itemEmbeddingModel, err = GetItemEmbeddingModelFromUb(ctx, itemEbd)
-		if err != nil {
-			log.Errorf("get item embedding model error: %v", err)
-			return
+func train(ctx context.Context, recSys RecSys, mlp Fitter, ckpt *Checkpoint) (result *TrainResult, err error) {
+	if IsEdgeProfile() {
+		return nil, ErrEdgeProfile
+	}
+	if err = setTrainLoss(mlp); err != nil {
+		log.Errorf("set train loss error: %v", err)
+		return
+	}
+	setTrainSeed(ctx, mlp)
+	ctx = WithStage(ctx, TrainStage)
+
+	var (
+		start       = time.Now()
+		sampleCount int
+		assembled   = atomic.LoadUint64(&metrics.trainSamples)
+	)
+	Notify(EventTrainStarted, nil)
+	defer func() {
+		metrics.setTrainThroughput(atomic.LoadUint64(&metrics.trainSamples)-assembled, time.Since(start))
+		data := map[string]interface{}{
+			"duration": time.Since(start).Seconds(),
+			"samples":  sampleCount,
 		}
-		itemEmbeddingMap, err = itemEmbeddingModel.GenEmbeddingMap32()
 		if err != nil {
-			log.Errorf("get item embedding map error: %v", err)
-			return
+			data["error"] = err.Error()
+		} else {
+			recordModel(ctx, result, start)
 		}
+		Notify(EventTrainFinished, data)
+	}()
+
+	for _, w := range Capabilities(recSys).Warnings {
+		log.Warnf("recSys capability: %s", w)
 	}
 
-	trainSample, err := GetSample(recSys, ctx)
-	if err != nil {
-		log.Errorf("get train sample error: %v", err)
+	if err = preTrain(ctx, recSys, ckpt); err != nil {
 		return
 	}
 
-	// start training
-	log.Infof("\nstart training with %d x %d samples\n", trainSample.Rows, trainSample.XCols)
-
-	pred, err := mlp.Fit(trainSample)
-	if err != nil {
-		log.Errorf("fit error: %v", err)
+	var pred PredictAbstract
+	res := &TrainResult{Version: modelVersionOf(ctx, start)}
+	if HardNegatives > 0 && ckpt != nil {
+		err = fmt.Errorf("hard negative mining is not supported with checkpoint")
+		log.Errorf("train error: %v", err)
 		return
 	}
-	type modelImpl struct {
-		UserFeaturer
-		ItemFeaturer
-		PredictAbstract
+	if streamFitter, ok := mlp.(StreamFitter); ok {
+		if DistillTeacher != nil || HardNegatives > 0 {
+			err = fmt.Errorf("distillation and hard negatives are not supported by the stream fitter %T", mlp)
+			log.Errorf("train error: %v", err)
+			return
+		}
+		pred, res.SampleInfo, err = fitStream(ctx, recSys, streamFitter, ckpt)
+		if err != nil {
+			return
+		}
+	} else {
+		var trainSample *TrainSample
+		if ckpt != nil && ckpt.Meta.SampleDone {
+			trainSample, err = ckpt.LoadSample()
+		} else {
+			trainSample, err = GetSample(recSys, ctx)
+		}
+		if err != nil {
+			log.Errorf("get train sample error: %v", err)
+			return
+		}
+		// only a SparseFitter without checkpoint, batches, importance,
+		// distillation and hard negatives takes the sparse features apart
+		_, ok := mlp.(SparseFitter)
+		if _, batch := mlp.(BatchFitter); !ok || batch || ckpt != nil || ImportanceRows > 0 ||
+			DistillTeacher != nil || HardNegatives > 0 {
+			trainSample.Densify()
+		}
+		if ckpt != nil && !ckpt.Meta.SampleDone {
+			if err = ckpt.SaveSample(trainSample); err != nil {
+				log.Errorf("save checkpoint sample error: %v", err)
+				return
+			}
+		}
+
+		// start training
+		sampleCount = trainSample.Rows
+		res.SampleCount = trainSample.Rows
+		res.SampleInfo = trainSample.Info
+		var validSample *TrainSample
+		if ImportanceRows > 0 {
+			trainSample, validSample = splitValidation(trainSample, ImportanceRows)
+		}
+		if DriftBaselineRows > 0 {
+			res.DriftBaseline = NewDriftBaseline(trainSample, DriftBaselineRows)
+		}
+		if HardNegatives > 0 {
+			if _, err = mineHardNegatives(ctx, recSys, mlp, trainSample); err != nil {
+				log.Errorf("mine hard negatives error: %v", err)
+				return
+			}
+		}
+		// the validation keeps the observed labels
+		if DistillTeacher != nil {
+			if err = distillSample(DistillTeacher, trainSample); err != nil {
+				log.Errorf("distill error: %v", err)
+				return
+			}
+		}
+		log.Infof("\nstart training with %d x %d samples\n", trainSample.Rows, trainSample.XCols)
+		StartProgress(ProgressFit)
+		setProgressValidation(validSample)
+		defer setProgressValidation(nil)
+
+		if ckptFitter, ok := mlp.(CheckpointFitter); ok && ckpt != nil {
+			pred, err = ckptFitter.FitCheckpoint(trainSample, ckpt)
+		} else {
+			pred, err = fitSample(ctx, mlp, trainSample)
+		}
+		if err != nil {
+			log.Errorf("fit error: %v", err)
+			return
+		}
+		if validSample != nil {
+			if res.FeatureImportance, err = PermutationImportance(pred, validSample, ImportanceSeed); err != nil {
+				log.Errorf("feature importance error: %v", err)
+				return
+			}
+			if res.Eval, err = Evaluate(pred, validSample); err != nil {
+				log.Errorf("evaluate error: %v", err)
+				return
+			}
+		}
 	}
-	model = &modelImpl{
+	res.Fitted = pred
+	res.Schema = featureSchemaOf(recSys)
+	res.Model = &modelImpl{
 		UserFeaturer:    recSys,
 		ItemFeaturer:    recSys,
 		PredictAbstract: pred,
+		schema:          res.Schema,
 	}
 
+	return res, nil
+}
+
+// preTrain runs the PreTrainer of recSys and trains the embeddings before
+// GetSample, the item embedding is loaded from ckpt if done
+func preTrain(ctx context.Context, recSys RecSys, ckpt *Checkpoint) (err error) {
+	if pre, ok := recSys.(PreTrainer); ok {
+		err = pre.PreTrain(ctx)
+		if err != nil {
+			log.Errorf("pre train error: %v", err)
+			return
+		}
+	}
+
+	if itemEbd, ok := itemEmbeddingOfRecSys(recSys); ok {
+		var embMap word2vec.EmbeddingMap32
+		if ckpt != nil && ckpt.Meta.EmbeddingDone {
+			if embMap, err = ckpt.LoadEmbedding(); err != nil {
+				log.Errorf("load checkpoint item embedding error: %v", err)
+				return
+			}
+		} else {
+			if embMap, err = loadOrTrainItemEmbedding(ctx, itemEbd); err != nil {
+				return
+			}
+			if ckpt != nil {
+				if err = ckpt.SaveEmbedding(embMap); err != nil {
+					log.Errorf("save checkpoint item embedding error: %v", err)
+					return
+				}
+			}
+		}
+		itemEmbeddingMap.store(embMap)
+	}
+
+	if userEbd, ok := recSys.(UserEmbedding); ok {
+		var embMap word2vec.EmbeddingMap32
+		if embMap, err = trainUserEmbedding(ctx, userEbd); err != nil {
+			return
+		}
+		userEmbeddingMap.store(embMap)
+	}
 	return
 }
 
+// modelImpl is the Predictor of a trained model, schema is the
+// FeatureSchema it is trained with
+type modelImpl struct {
+	UserFeaturer
+	ItemFeaturer
+	PredictAbstract
+	schema *FeatureSchema
+}
+
+// sparseModelOf returns the SparsePredictAbstract of recSys if any and
+// SparseFeatureDim > 0
+func sparseModelOf(recSys Predictor) SparsePredictAbstract {
+	if SparseFeatureDim <= 0 {
+		return nil
+	}
+	if m, ok := recSys.(*modelImpl); ok {
+		sparseModel, _ := m.PredictAbstract.(SparsePredictAbstract)
+		return sparseModel
+	}
+	sparseModel, _ := recSys.(SparsePredictAbstract)
+	return sparseModel
+}
+
+// GetSparseFeature forwards to the feature provider so the trained model
+// gets the sparse features it is trained with
+func (m *modelImpl) GetSparseFeature(ctx context.Context, sample *Sample) (SparseTensor, error) {
+	if sf, ok := m.UserFeaturer.(SparseFeaturer); ok {
+		return sf.GetSparseFeature(ctx, sample)
+	}
+	return SparseTensor{Dim: SparseFeatureDim}, nil
+}
+
+func (m *modelImpl) checkSchema() error {
+	return checkSchema(m.schema, m.UserFeaturer)
+}
+
 func Rank(ctx context.Context, recSys Predictor, userId int, itemIds []int) (itemScores []ItemScore, err error) {
-	sampleKeys := make([]Sample, len(itemIds))
-	for i, itemId := range itemIds {
-		sampleKeys[i] = Sample{
-			UserId:    userId,
-			ItemId:    itemId,
-			Timestamp: time.Now().Unix(),
-		}
+	ctx, span := startSpan(ctx, "Rank")
+	span.SetAttribute("user.id", userId)
+	span.SetAttribute("items", len(itemIds))
+	defer func() { endSpan(span, err) }()
+
+	if ctx, recSys, err = servingModel(ctx, recSys); err != nil {
+		return
 	}
-	y, err := BatchPredict(ctx, recSys, sampleKeys)
-	if err != nil {
+	if itemIds, err = filterSeen(ctx, recSys, userId, itemIds); err != nil {
 		return
 	}
-	itemScores = make([]ItemScore, len(itemIds))
-	var score interface{}
-	for i, itemId := range itemIds {
-		if score, err = y.At(i, 0); err != nil {
+	if len(itemIds) == 0 {
+		return []ItemScore{}, nil
+	}
+	var (
+		hashes *featureHashes
+		raw    map[int]float32
+	)
+	if PredictionLog != nil {
+		ctx, hashes = withFeatureHashes(ctx)
+	}
+	if itemScores, err = scoreChunk(ctx, recSys, userId, itemIds, time.Now().Unix()); err != nil {
+		return
+	}
+	if PredictionLog != nil {
+		raw = rawScores(itemScores)
+	}
+	if policy := explorationOf(ctx); policy != nil {
+		policy.Explore(ctx, userId, itemScores)
+	}
+	if postRanker, ok := recSys.(PostRanker); ok {
+		if itemScores, err = postRanker.PostRank(ctx, userId, itemScores); err != nil {
+			logOf(ctx).Errorf("post rank error: %v", err)
 			itemScores = nil
 			return
 		}
-		itemScores[i] = ItemScore{
-			ItemId: itemId,
-			Score:  score.(float32),
+	}
+	if pp := PostProcessors; pp != nil {
+		if itemScores, err = pp.PostRank(ctx, userId, itemScores); err != nil {
+			logOf(ctx).Errorf("post process error: %v", err)
+			return
 		}
 	}
-
+	logPredictions(ctx, userId, itemScores, raw, hashes)
 	return
 }
 
 func BatchPredict(ctx context.Context, recSys Predictor, sampleKeys []Sample) (y tensor.Tensor, err error) {
-	ctx = context.WithValue(ctx, StageKey, PredictStage)
+	defer metrics.batchPredictSeconds.since(time.Now())
+	ctx = WithStage(ctx, PredictStage)
+	ctx, span := startSpan(ctx, "BatchPredict")
+	span.SetAttribute("rows", len(sampleKeys))
+	defer func() { endSpan(span, err) }()
+	if len(sampleKeys) == 0 {
+		return nil, fmt.Errorf("batch predict without sample")
+	}
+	if ctx, recSys, err = servingModel(ctx, recSys); err != nil {
+		return
+	}
+	if model, ok := recSys.(interface{ checkSchema() error }); ok {
+		if err = model.checkSchema(); err != nil {
+			logOf(ctx).Errorf("batch predict error: %v", err)
+			return
+		}
+	}
 	if preRanker, ok := recSys.(PreRanker); ok {
 		err = preRanker.PreRank(ctx)
 		if err != nil {
-			log.Errorf("pre rank error: %v", err)
+			logOf(ctx).Errorf("pre rank error: %v", err)
 			return
 		}
 	}
 
 	var (
-		xData      []float32
-		xWidth     int
-		zeroSliceX []float32
-		debugIds   = make([]int, 0)
+		xData        []float32
+		xWidth       int
+		zeroSliceX   []float32
+		debugIds     = make([]int, 0)
+		trace        = debugTraceOf(ctx)
+		traceEntries = make(map[int]DebugEntry)
+		info         SampleInfo
+		sparseModel  = sparseModelOf(recSys)
+		sparse       []SparseTensor
+		hashes       = featureHashesOf(ctx)
 	)
 
+	ctx = withBulkFeatures(ctx, fetchBulk(ctx, recSys, sampleKeys))
+	if ItemFetchTimeout > 0 {
+		ctx = context.WithValue(ctx, itemFetchKey, prefetchItems(ctx, ItemFeatureCache, recSys, sampleKeys))
+	}
 	for i, sKey := range sampleKeys {
 		var (
-			xSlice []float32
+			xSlice         []float32
+			sp             SparseTensor
+			uWidth, iWidth int
+			sampleErr      error
 		)
-		xSlice, _, _, err = GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, recSys, &sKey)
+		xSlice, sp, uWidth, iWidth, err = getSampleVector(ctx, UserFeatureCache, ItemFeatureCache, recSys, &sKey)
+		if err == nil && sparseModel == nil && SparseFeatureDim > 0 {
+			xSlice = sp.AppendDense(xSlice)
+		}
 		if err != nil {
-			if i == 0 {
-				log.Errorf("get sample vector error: %v", err)
+			if i == 0 || Strict {
+				logOf(ctx).Errorf("get sample vector error: %v", err)
 				return
 			} else {
+				logOf(ctx).Warnf("predict with zero vector: %v", err)
+				sampleErr, err = err, nil
 				zeroSliceX = make([]float32, xWidth)
 				xSlice = zeroSliceX
+				sp = SparseTensor{Dim: SparseFeatureDim}
 			}
+		} else if i == 0 {
+			info = newSampleInfo(uWidth, iWidth)
 		}
 		if i == 0 {
 			xWidth = len(xSlice)
@@ -311,10 +636,30 @@ func BatchPredict(ctx context.Context, recSys Predictor, sampleKeys []Sample) (y
 		}
 
 		if len(xSlice) != xWidth {
-			log.Errorf("x slice length %d != x col %d", len(xSlice), xWidth)
+			err = fmt.Errorf("x slice length %d != x col %d", len(xSlice), xWidth)
+			logOf(ctx).Errorf("%v", err)
 			return
 		}
 		copy(xData[i*xWidth:], xSlice)
+		if hashes != nil {
+			hashes.add(sKey.ItemId, xSlice)
+		}
+		if sparseModel != nil {
+			sparse = append(sparse, sp)
+		}
+
+		if trace != nil && trace.match(&sKey) {
+			entry := DebugEntry{
+				UserId: sKey.UserId,
+				ItemId: sKey.ItemId,
+				Info:   info,
+				Vector: append([]float32(nil), xSlice...),
+			}
+			if sampleErr != nil {
+				entry.Error = sampleErr.Error()
+			}
+			traceEntries[i] = entry
+		}
 
 		if DebugItemId == sKey.ItemId &&
 			(DebugUserId == 0 || DebugUserId == sKey.UserId) {
@@ -323,16 +668,43 @@ func BatchPredict(ctx context.Context, recSys Predictor, sampleKeys []Sample) (y
 		}
 	}
 	xDense := tensor.NewDense(tensor.Float32, tensor.Shape{len(sampleKeys), xWidth}, tensor.WithBacking(xData))
+	if drift := ServingDrift; drift != nil {
+		drift.Observe(xData, len(sampleKeys), xWidth)
+	}
 
-	y = recSys.Predict(xDense)
+	_, predictSpan := startSpan(ctx, "Predict")
+	if sparseModel != nil {
+		y = sparseModel.PredictSparse(xDense, sparse)
+	} else {
+		y = recSys.Predict(xDense)
+	}
+	predictSpan.End()
+	atomic.AddUint64(&metrics.batchPredictRows, uint64(len(sampleKeys)))
 	for _, i := range debugIds {
 		score, er := y.At(i, 0)
 		if er != nil {
-			log.Errorf("get score of line:%d error: %v", i, er)
+			logOf(ctx).Errorf("get score of line:%d error: %v", i, er)
 			return
 		}
 		log.Infof("user %d: item %d: score %v", sampleKeys[i].UserId, sampleKeys[i].ItemId, score)
 	}
+	if len(traceEntries) != 0 {
+		entries := make([]DebugEntry, 0, len(traceEntries))
+		for i := range sampleKeys {
+			entry, ok := traceEntries[i]
+			if !ok {
+				continue
+			}
+			score, er := y.At(i, 0)
+			if er != nil {
+				logOf(ctx).Errorf("get score of line:%d error: %v", i, er)
+				return nil, er
+			}
+			entry.Score = score.(float32)
+			entries = append(entries, entry)
+		}
+		trace.add(entries...)
+	}
 	return
 }
 
@@ -341,85 +713,41 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 		userFeatureWidth int
 		itemFeatureWidth int
 	)
-	if UserFeatureCache == nil {
-		UserFeatureCache = ccache.New(
-			ccache.Configure().MaxSize(userFeatureCacheSize).ItemsToPrune(userFeatureCacheSize / 100),
-		)
-	}
-	if ItemFeatureCache == nil {
-		ItemFeatureCache = ccache.New(
-			ccache.Configure().MaxSize(itemFeatureCacheSize).ItemsToPrune(itemFeatureCacheSize / 100),
-		)
-	}
-
-	//defer func() {
-	//	UserFeatureCache.Clear()
-	//	ItemFeatureCache.Clear()
-	//	UserBehaviorCache.Clear()
-	//}()
-
-	sampleGen, ok := recSys.(Trainer)
-	if !ok {
-		panic("sample generator not implemented")
-	}
-	sampleCh, err := sampleGen.SampleGenerator(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var drops dropCounter
+	sampleVecCh, err := startSampleAssembler(ctx, recSys, &drops)
 	if err != nil {
-		panic(err)
-	}
-
-	var (
-		sampleVecCh = make(chan *sampleVec, 1000)
-		sampleVecWg sync.WaitGroup
-	)
-
-	for c := 0; c < SampleAssembler; c++ {
-		sampleVecWg.Add(1)
-		go func() {
-			for s := range sampleCh {
-				var (
-					err  error
-					sVec sampleVec
-				)
-				sVec.vec, sVec.uWidth, sVec.iWidth, err = GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, recSys, &s)
-				if err != nil {
-					log.Debugf("get sample vector error: %v", err)
-					continue
-				}
-				sVec.label = s.Label
-				sampleVecCh <- &sVec
-			}
-			sampleVecWg.Done()
-		}()
+		return
 	}
-	go func() {
-		sampleVecWg.Wait()
-		close(sampleVecCh)
+	defer func() {
+		// cancel the assembler on early return and wait for its workers,
+		// sampleVecCh is closed after them
+		cancel()
+		for range sampleVecCh {
+		}
 	}()
 
 	sample = &TrainSample{}
+	var (
+		seq    []int
+		seeded = trainSeedOf(ctx) != 0
+	)
+	StartProgress(ProgressSample)
 	for sv := range sampleVecCh {
+		if sv.err != nil {
+			return nil, sv.err
+		}
 		if userFeatureWidth == 0 {
 			userFeatureWidth = sv.uWidth
-			sample.Info.UserProfileRange[0] = 0
-			sample.Info.UserProfileRange[1] = userFeatureWidth
-			sample.Info.UserBehaviorRange[0] = sample.Info.UserProfileRange[1]
-			sample.Info.UserBehaviorRange[1] = sample.Info.UserProfileRange[1] + ItemEmbDim*UserBehaviorLen
-			// item feature here is only embeddings
-			sample.Info.ItemFeatureRange[0] = sample.Info.UserBehaviorRange[1]
-			sample.Info.ItemFeatureRange[1] = sample.Info.UserBehaviorRange[1] + ItemEmbDim
+			itemFeatureWidth = sv.iWidth
+			sample.Info = newSampleInfo(userFeatureWidth, itemFeatureWidth)
 		}
 		if sv.uWidth != userFeatureWidth {
 			err = fmt.Errorf("user feature length mismatch: %v:%v",
 				userFeatureWidth, sv.uWidth)
 			return
 		}
-
-		if itemFeatureWidth == 0 {
-			itemFeatureWidth = sv.iWidth
-			// non embedding item feature is treated as ctx feature
-			sample.Info.CtxFeatureRange[0] = sample.Info.ItemFeatureRange[1]
-			sample.Info.CtxFeatureRange[1] = sample.Info.ItemFeatureRange[1] + itemFeatureWidth
-		}
 		if sv.iWidth != itemFeatureWidth {
 			err = fmt.Errorf("item feature length mismatch: %v:%v",
 				itemFeatureWidth, sv.iWidth)
@@ -436,15 +764,39 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 		}
 
 		sample.X = append(sample.X, sv.vec...)
+		if SparseFeatureDim > 0 {
+			sample.Sparse = append(sample.Sparse, sv.sparse)
+		}
 		sample.Y = append(sample.Y, sv.label)
+		sample.Keys = append(sample.Keys, sv.key)
+		if sample.Rows == 0 && len(sv.labels) != 0 {
+			sample.Tasks = 1 + len(sv.labels)
+		}
+		if sample.Tasks != 0 {
+			if len(sv.labels) != sample.Tasks-1 {
+				err = fmt.Errorf("sample labels mismatch: %v:%v", sample.Tasks-1, len(sv.labels))
+				return
+			}
+			sample.Labels = append(append(sample.Labels, sv.label), sv.labels...)
+		}
+		if seeded {
+			seq = append(seq, sv.seq)
+		}
 		sample.Rows++
 		if sample.Rows%1000 == 0 {
-			log.Infof("sample size: %d, uc: %d, ic: %d", sample.Rows,
-				UserFeatureCache.ItemCount(),
-				ItemFeatureCache.ItemCount(),
-			)
+			ReportProgress(Progress{Stage: ProgressSample, Samples: sample.Rows})
 		}
 	}
+	ReportProgress(Progress{Stage: ProgressSample, Samples: sample.Rows})
+
+	// the assembler stops early if ctx is done
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	sample.Dropped = drops.stats()
+	if sample.Dropped.Total() != 0 {
+		log.Warnf("%d samples dropped: %+v", sample.Dropped.Total(), sample.Dropped)
+	}
 
 	//check x and y dimension
 	if sample.Rows != len(sample.Y) {
@@ -455,83 +807,439 @@ func GetSample(recSys RecSys, ctx context.Context) (sample *TrainSample, err err
 		err = fmt.Errorf("sample x size not match: %v:%v", sample.Rows*sample.XCols, len(sample.X))
 		return
 	}
+	if seeded {
+		sample = sortBySeq(sample, seq)
+	}
+	if FeatureStatsRows > 0 {
+		setLastFeatureStats(NewFeatureStats(sample, FeatureStatsRows))
+	}
 
 	return
 }
 
+// newSampleInfo returns the layout of the vector assembled by GetSampleVector
+// for the given user and item feature widths.
+func newSampleInfo(userFeatureWidth, itemFeatureWidth int) (info SampleInfo) {
+	info.UserProfileRange[0] = 0
+	info.UserProfileRange[1] = userFeatureWidth
+	info.UserBehaviorRange[0] = info.UserProfileRange[1]
+	info.UserBehaviorRange[1] = info.UserProfileRange[1] + userBehaviorWidth()
+	// item feature here is only embeddings
+	info.ItemFeatureRange[0] = info.UserBehaviorRange[1]
+	info.ItemFeatureRange[1] = info.UserBehaviorRange[1] + ItemEmbDim
+	// non embedding item feature is treated as ctx feature
+	info.CtxFeatureRange[0] = info.ItemFeatureRange[1]
+	info.CtxFeatureRange[1] = info.ItemFeatureRange[1] + itemFeatureWidth
+	start := info.CtxFeatureRange[1]
+	for _, name := range BehaviorChannels {
+		rng := BehaviorChannelRange{Name: name, Range: [2]int{start, start + ItemEmbDim*UserBehaviorLen}}
+		info.BehaviorChannelRanges = append(info.BehaviorChannelRanges, rng)
+		start = rng.Range[1]
+	}
+	info.RequestCtxRange = [2]int{start, start + ctxFeatureWidth()}
+	info.SparseRange = [2]int{info.RequestCtxRange[1], info.RequestCtxRange[1] + SparseFeatureDim}
+	return
+}
+
+// startSampleAssembler starts SampleAssembler goroutines turning the samples
+// from recSys.SampleGenerator into vectors. The returned channel is closed
+// when all the samples are consumed or ctx is done. The samples failed are
+// counted in drops, or sent with the error in Strict mode.
+func startSampleAssembler(ctx context.Context, recSys RecSys, drops *dropCounter) (sampleVecCh <-chan *sampleVec, err error) {
+	initFeatureCaches()
+
+	//defer func() {
+	//	UserFeatureCache.Clear()
+	//	ItemFeatureCache.Clear()
+	//	UserBehaviorCache.Clear()
+	//}()
+
+	sampleGen, ok := recSys.(Trainer)
+	if !ok {
+		panic("sample generator not implemented")
+	}
+	sampleCh, err := sampleGen.SampleGenerator(ctx)
+	if err != nil {
+		panic(err)
+	}
+	samples := bulkSamples(ctx, recSys, dedupShuffle(ctx, sampleCh, drops))
+
+	var (
+		vecCh       = make(chan *sampleVec, 1000)
+		sampleVecWg sync.WaitGroup
+	)
+
+	for c := 0; c < SampleAssembler; c++ {
+		sampleVecWg.Add(1)
+		go func() {
+			defer sampleVecWg.Done()
+			send := func(sv *sampleVec) bool {
+				select {
+				case vecCh <- sv:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+			for {
+				var (
+					bs bulkSample
+					ok bool
+				)
+				select {
+				case <-ctx.Done():
+					return
+				case bs, ok = <-samples:
+					if !ok {
+						return
+					}
+				}
+				var (
+					err  error
+					sVec sampleVec
+					s    = bs.Sample
+				)
+				sVec.vec, sVec.sparse, sVec.uWidth, sVec.iWidth, err = getSampleVector(withBulkFeatures(ctx, bs.bulk),
+					UserFeatureCache, ItemFeatureCache, recSys, &s)
+				if err != nil {
+					if Strict {
+						if !send(&sampleVec{err: err}) {
+							return
+						}
+						continue
+					}
+					log.Debugf("drop sample: %v", err)
+					drops.add(err)
+					continue
+				}
+				sVec.label, sVec.labels = s.Label, s.Labels
+				sVec.key = SampleKey{UserId: s.UserId, ItemId: s.ItemId, Timestamp: s.Timestamp}
+				sVec.seq = bs.seq
+				atomic.AddUint64(&metrics.trainSamples, 1)
+				if !send(&sVec) {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		sampleVecWg.Wait()
+		close(vecCh)
+	}()
+
+	return vecCh, nil
+}
+
+// initFeatureCaches creates UserFeatureCache and ItemFeatureCache if nil
+func initFeatureCaches() {
+	if UserFeatureCache == nil {
+		UserFeatureCache = ccache.New(
+			ccache.Configure().MaxSize(userFeatureCacheSize).ItemsToPrune(userFeatureCacheSize / 100),
+		)
+	}
+	if ItemFeatureCache == nil {
+		ItemFeatureCache = ccache.New(
+			ccache.Configure().MaxSize(itemFeatureCacheSize).ItemsToPrune(itemFeatureCacheSize / 100),
+		)
+	}
+	if UserBehaviorCache == nil {
+		UserBehaviorCache = ccache.New(
+			ccache.Configure().MaxSize(userBehaviorCacheSize).ItemsToPrune(userBehaviorCacheSize / 100),
+		)
+	}
+}
+
+// GetSampleVector returns the sample vector of sampleKey, the sparse
+// features of SparseFeaturer are densified at the end
 func GetSampleVector(ctx context.Context,
 	userFeatureCache *ccache.Cache, itemFeatureCache *ccache.Cache,
 	featureProvider BasicFeatureProvider, sampleKey *Sample,
 ) (vec []float32, userFeatureWidth int, itemFeatureWidth int, err error) {
-	var (
-		zeroItemEmb       [ItemEmbDim]float32
-		zeroUserBehaviors [ItemEmbDim * UserBehaviorLen]float32
+	var sparse SparseTensor
+	vec, sparse, userFeatureWidth, itemFeatureWidth, err = getSampleVector(ctx, userFeatureCache, itemFeatureCache, featureProvider, sampleKey)
+	if err == nil && SparseFeatureDim > 0 {
+		vec = sparse.AppendDense(vec)
+	}
+	return
+}
 
-		user, item *ccache.Item
-	)
-	userIdStr := strconv.Itoa(sampleKey.UserId)
-	user, err = userFeatureCache.Fetch(userIdStr, time.Hour*24, func() (ci interface{}, err error) {
-		ci, err = featureProvider.GetUserFeature(ctx, sampleKey.UserId)
-		return
+// fetchUserFeature fetches the user feature of sampleKey through cache
+func fetchUserFeature(ctx context.Context, cache *ccache.Cache, featureProvider BasicFeatureProvider,
+	sampleKey *Sample) (feature Tensor, err error) {
+	value, err := fetchCache(ctx, cache, cacheUser, strconv.Itoa(sampleKey.UserId), time.Hour*24, func(ctx context.Context) (ci interface{}, err error) {
+		ctx, span := startSpan(ctx, "GetUserFeature")
+		defer func() { endSpan(span, err) }()
+		var feature Tensor
+		if feature, err = bulkOrFetch(ctx, cacheUser, sampleKey.UserId, func(ctx context.Context) (Tensor, error) {
+			return featureProvider.GetUserFeature(ctx, sampleKey.UserId)
+		}); err != nil {
+			err = newSampleError(sampleKey, ErrMissingUser, err)
+			return
+		}
+		observeFeature(ctx, featureProvider, cacheUser, sampleKey.UserId, feature)
+		return feature, nil
 	})
 	if err != nil {
 		return
 	}
-	userFeature := user.Value().(Tensor)
+	return value.(Tensor), nil
+}
+
+// getSampleVector returns the dense sample vector and the sparse features
+// of sampleKey apart
+func getSampleVector(ctx context.Context,
+	userFeatureCache *ccache.Cache, itemFeatureCache *ccache.Cache,
+	featureProvider BasicFeatureProvider, sampleKey *Sample,
+) (vec []float32, sparse SparseTensor, userFeatureWidth int, itemFeatureWidth int, err error) {
+	var (
+		zeroItemEmb [ItemEmbDim]float32
+		item        Tensor
+	)
+	defer metrics.sampleVectorSeconds.since(time.Now())
+	ctx, span := startSpan(ctx, "GetSampleVector")
+	span.SetAttribute("user.id", sampleKey.UserId)
+	span.SetAttribute("item.id", sampleKey.ItemId)
+	defer func() { endSpan(span, err) }()
+
+	userFeature, err := fetchUserFeature(ctx, userFeatureCache, featureProvider, sampleKey)
+	if errors.Is(err, ErrCircuitOpen) && DefaultUserFeature != nil {
+		userFeature, err = DefaultUserFeature, nil
+	} else if err != nil {
+		var ok bool
+		if userFeature, ok = imputeFeature(ctx, featureProvider, cacheUser, sampleKey.UserId, err); !ok {
+			return
+		}
+		err = nil
+	}
 	userFeatureWidth = len(userFeature)
 
-	itemIdStr := strconv.Itoa(sampleKey.ItemId)
-	item, err = itemFeatureCache.Fetch(itemIdStr, time.Hour*24, func() (ci interface{}, err error) {
-		ci, err = featureProvider.GetItemFeature(ctx, sampleKey.ItemId)
-		return
-	})
-	if err != nil {
-		return
+	var itemFeature Tensor
+	inline, isInline := inlineItemOf(ctx, sampleKey.ItemId)
+	if isInline {
+		itemFeature = inline.Feature
+	} else if SharedItemFeatures != nil {
+		itemFeature, _ = SharedItemFeatures.Get(sampleKey.ItemId)
+	}
+	if itemFeature == nil {
+		if fetches := itemFetchesOf(ctx); fetches != nil {
+			item, err = fetches.wait(ctx, itemFeatureCache, featureProvider, sampleKey)
+		} else {
+			item, err = fetchItemFeature(ctx, itemFeatureCache, featureProvider, sampleKey)
+		}
+		if (errors.Is(err, ErrFetchTimeout) || errors.Is(err, ErrCircuitOpen)) && DefaultItemFeature != nil {
+			log.Warnf("predict with default item feature: %v", err)
+			itemFeature, err = DefaultItemFeature, nil
+		} else if err != nil {
+			var ok bool
+			if itemFeature, ok = imputeFeature(ctx, featureProvider, cacheItem, sampleKey.ItemId, err); !ok {
+				return
+			}
+			err = nil
+		} else {
+			itemFeature = item
+		}
 	}
-	itemFeature := item.Value().(Tensor)
 	itemFeatureWidth = len(itemFeature)
 
-	// if ItemEmbedding interface is implemented, use item embedding,
-	// 	else use zero embedding.
+	// if ItemEmbedding interface is implemented, use item embedding, or the
+	// content embedding of ItemContentEmbedder, else use zero embedding.
 	var (
 		itemEmb       = zeroItemEmb[:]
-		userBehaviors = zeroUserBehaviors[:]
+		userBehaviors = make([]float32, userBehaviorWidth())
 		ok            bool
 	)
-	if len(itemEmbeddingMap) != 0 {
-		if itemEmb, ok = itemEmbeddingMap.Get(strconv.Itoa(sampleKey.ItemId)); !ok {
+	if hasItemEmbedding() {
+		if isInline {
+			if len(inline.Embedding) == ItemEmbDim {
+				itemEmb = inline.Embedding
+			}
+		} else if itemEmb, ok = itemEmbeddingOf(ctx, itemFeatureCache, featureProvider, sampleKey.ItemId); !ok {
 			itemEmb = zeroItemEmb[:]
 			log.Debugf("item embedding not found: %d, using zeros", sampleKey.ItemId)
 		}
-		// if ItemEmbedding and UserBehavior interface are both implemented,
-		// use itemSeq embeddings got from GetUserBehavior as user behavior,
-		//	else use zero embedding.
-		if recSysUb, ok := featureProvider.(UserBehavior); ok {
+		// if ItemEmbedding and SessionBehavior, TimedUserBehavior or
+		// UserBehavior interface are both implemented, use itemSeq embeddings
+		// got from them as user behavior, else use zero embedding.
+		behaviorTs := behaviorMaxTs(ctx, sampleKey.Timestamp)
+		if recSysSb, ok := featureProvider.(SessionBehavior); ok {
+			userBehaviors, err = getSessionBehavior(ctx, recSysSb, itemFeatureCache, featureProvider, sampleKey.UserId, behaviorTs)
+			if err != nil {
+				err = newSampleError(sampleKey, ErrMissingUser, fmt.Errorf("get user sessions error: %w", err))
+				return
+			}
+		} else if recSysTb, ok := featureProvider.(TimedUserBehavior); ok {
+			userBehaviors, err = getTimedBehavior(ctx, recSysTb, itemFeatureCache, featureProvider, sampleKey.UserId, behaviorTs)
+			if err != nil {
+				err = newSampleError(sampleKey, ErrMissingUser, fmt.Errorf("get user behavior error: %w", err))
+				return
+			}
+		} else if recSysUb, ok := featureProvider.(UserBehavior); ok {
 			getUbfunc := func(userId int, maxLen int64, maxPk int64, maxTs int64) (ubTensor Tensor, err error) {
-				itemSeq, err := recSysUb.GetUserBehavior(
-					ctx, userId, maxLen, maxPk, maxTs)
+				itemSeq, err := getUserBehavior(ctx, recSysUb, userId, maxLen, maxPk, maxTs)
 				if err != nil {
 					return
 				}
 				//query items embedding, fill them into user behavior
-				ubTensor = make(Tensor, ItemEmbDim*UserBehaviorLen)
+				ubTensor = make(Tensor, userBehaviorWidth())
 				for i, itemId := range itemSeq {
-					if itemEmb, ok := itemEmbeddingMap.Get(strconv.Itoa(itemId)); ok {
+					if i == UserBehaviorLen {
+						break
+					}
+					if itemEmb, ok := itemEmbeddingOf(ctx, itemFeatureCache, featureProvider, itemId); ok {
 						copy(ubTensor[i*ItemEmbDim:], itemEmb)
 					}
 				}
 				return
 			}
-			userBehaviors, err = getUbfunc(sampleKey.UserId, UserBehaviorLen, -1, sampleKey.Timestamp)
+			userBehaviors, err = getUbfunc(sampleKey.UserId, UserBehaviorLen, -1, behaviorTs)
+			if err != nil {
+				err = newSampleError(sampleKey, ErrMissingUser, fmt.Errorf("get user behavior error: %w", err))
+				return
+			}
+		}
+	}
+
+	var behaviorChannels []float32
+	if len(BehaviorChannels) != 0 {
+		behaviorChannels = make([]float32, behaviorChannelsWidth())
+		if recSysMb, ok := featureProvider.(MultiBehavior); ok && hasItemEmbedding() {
+			behaviorChannels, err = getBehaviorChannels(ctx, recSysMb, itemFeatureCache, featureProvider, sampleKey.UserId, behaviorMaxTs(ctx, sampleKey.Timestamp))
 			if err != nil {
-				err = fmt.Errorf("get user behavior error: %v", err)
+				err = newSampleError(sampleKey, ErrMissingUser, fmt.Errorf("get user behaviors error: %w", err))
 				return
 			}
 		}
 	}
 
-	vec = utils.ConcatSlice32(userFeature, userBehaviors, itemEmb, itemFeature)
+	ctxFeature, err := getCtxFeature(ctx, featureProvider, sampleKey)
+	if err != nil {
+		return
+	}
+	if err = validateSample(ctx, featureProvider, sampleKey, userFeature, itemFeature, ctxFeature); err != nil {
+		return
+	}
+	if sparse, err = getSparseFeature(ctx, featureProvider, sampleKey); err != nil {
+		return
+	}
+
+	if AppendUserEmbedding {
+		userFeature = utils.ConcatSlice32(userFeature, userEmbeddingOf(sampleKey.UserId, userBehaviors[:ItemEmbDim*UserBehaviorLen]))
+		userFeatureWidth = len(userFeature)
+	}
+
+	vec = utils.ConcatSlice32(userFeature, userBehaviors, itemEmb, itemFeature, behaviorChannels, ctxFeature)
+
+	return
+}
+
+// loadOrTrainItemEmbedding loads ItemEmbeddingFile if it exists, else trains
+// the item2vec model and saves the embedding to ItemEmbeddingFile if set
+func loadOrTrainItemEmbedding(ctx context.Context, itemEbd ItemEmbedding) (embMap word2vec.EmbeddingMap32, err error) {
+	if ItemEmbeddingFile != "" {
+		if embMap, err = word2vec.LoadEmbeddingMap32(ItemEmbeddingFile); err == nil {
+			log.Infof("loaded %d item embeddings from %s", len(embMap), ItemEmbeddingFile)
+			itemEmbeddingModel = nil
+			return
+		} else if !os.IsNotExist(err) {
+			log.Errorf("load item embedding %s error: %v", ItemEmbeddingFile, err)
+			return
+		}
+	}
+	itemEmbeddingModel, err = GetItemEmbeddingModelFromUb(ctx, itemEbd)
+	if err != nil {
+		log.Errorf("get item embedding model error: %v", err)
+		return
+	}
+	embMap, err = itemEmbeddingModel.GenEmbeddingMap32()
+	if err != nil {
+		log.Errorf("get item embedding map error: %v", err)
+		return
+	}
+	if ItemEmbeddingFile != "" {
+		if err = word2vec.SaveEmbeddingMap32(ItemEmbeddingFile, embMap); err != nil {
+			log.Errorf("save item embedding %s error: %v", ItemEmbeddingFile, err)
+			return
+		}
+	}
+	return
+}
+
+// SaveItemEmbedding saves the item embedding of the last Train to path, the
+// format is chosen by the extension as word2vec.SaveEmbeddingMap32
+func SaveItemEmbedding(path string) error {
+	embMap := itemEmbeddingMap.load()
+	if embMap == nil {
+		return fmt.Errorf("no item embedding trained")
+	}
+	return word2vec.SaveEmbeddingMap32(path, embMap)
+}
+
+// UpdateItemEmbedding folds the new items in the sequence of iSeq into the
+// item embedding of the last Train without a full retrain, so that they are
+// not ranked with zero embeddings until the next Train. The embedding in use
+// is replaced after the fold in succeeds. freeze keeps the vectors of the
+// existing items unchanged.
+func UpdateItemEmbedding(ctx context.Context, iSeq ItemEmbedding, freeze bool) (added int, err error) {
+	current := itemEmbeddingMap.load()
+	if len(current) == 0 {
+		return 0, fmt.Errorf("no item embedding trained")
+	}
+	itemSeq, err := iSeq.ItemSeqGenerator(ctx)
+	if err != nil {
+		log.Errorf("get item seq error: %v", err)
+		return
+	}
+	embMap := make(word2vec.EmbeddingMap32, len(current))
+	for item, vec := range current {
+		if !freeze {
+			vec = append([]float32(nil), vec...)
+		}
+		embMap[item] = vec
+	}
+	opts := word2vec.DefaultFoldInOptions()
+	opts.Window, opts.Freeze = ItemEmbeddingOptions.Window, freeze
+	newItems, err := embMap.FoldIn(ctx, itemSeq, opts)
+	if err != nil {
+		log.Errorf("fold in item embedding error: %v", err)
+		return
+	}
+	itemEmbeddingMap.store(embMap)
+	return len(newItems), nil
+}
+
+// embeddingMap holds the embedding trained or loaded, which is replaced as a
+// whole by Train and the loaders while the serving requests read it
+type embeddingMap struct {
+	sync.RWMutex
+	m word2vec.EmbeddingMap32
+}
+
+func (e *embeddingMap) load() word2vec.EmbeddingMap32 {
+	e.RLock()
+	defer e.RUnlock()
+	return e.m
+}
+
+func (e *embeddingMap) store(m word2vec.EmbeddingMap32) {
+	e.Lock()
+	e.m = m
+	e.Unlock()
+}
+
+// storeIfEmpty stores m only if no embedding is held, returns true if stored
+func (e *embeddingMap) storeIfEmpty(m word2vec.EmbeddingMap32) bool {
+	e.Lock()
+	defer e.Unlock()
+	if len(e.m) != 0 {
+		return false
+	}
+	e.m = m
+	return true
+}
 
+// Get is word2vec.EmbeddingMap32.Get of the embedding held
+func (e *embeddingMap) Get(word string) (emb []float32, ok bool) {
+	emb, ok = e.load()[word]
 	return
 }
 
@@ -540,6 +1248,6 @@ func GetItemEmbeddingModelFromUb(ctx context.Context, iSeq ItemEmbedding) (mod m
 	if err != nil {
 		return
 	}
-	mod, err = embedding.TrainEmbedding(itemSeq, ItemEmbWindow, ItemEmbDim, 1)
+	mod, err = embedding.TrainEmbeddingWithOptions(ctx, itemSeq, itemEmbeddingOptions(ctx))
 	return
 }
@@ -0,0 +1,222 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorgonia.org/tensor"
+)
+
+// ModelMeta describes a trained model version
+type ModelMeta struct {
+	Version     string     `json:"version"`
+	TrainedAt   int64      `json:"trainedAt"`
+	SampleCount int        `json:"sampleCount"`
+	Info        SampleInfo `json:"sampleInfo"`
+	Active      bool       `json:"active"`
+}
+
+type versionedModel struct {
+	Predictor
+	meta ModelMeta
+}
+
+// ModelRegistry keeps multiple versions of trained Predictors, one of them is
+// active. ModelRegistry is a Predictor itself serving with the active version,
+// so it could be passed to StartHttpApi directly, requests with a version are
+// pinned to that version.
+type ModelRegistry struct {
+	sync.RWMutex
+	models map[string]*versionedModel
+	active atomic.Value // *versionedModel
+}
+
+func NewModelRegistry() *ModelRegistry {
+	return &ModelRegistry{
+		models: make(map[string]*versionedModel),
+	}
+}
+
+// Register adds model as meta.Version, the first registered version is
+// activated automatically.
+func (r *ModelRegistry) Register(model Predictor, meta ModelMeta) (err error) {
+	if meta.Version == "" {
+		return fmt.Errorf("empty model version")
+	}
+	if meta.TrainedAt == 0 {
+		meta.TrainedAt = time.Now().Unix()
+	}
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.models[meta.Version]; ok {
+		return fmt.Errorf("model version %s already registered", meta.Version)
+	}
+	vm := &versionedModel{Predictor: model, meta: meta}
+	r.models[meta.Version] = vm
+	if r.active.Load() == nil {
+		r.active.Store(vm)
+	}
+	return
+}
+
+// Activate atomically switches the active version, requests already
+// resolved keep using the previous one.
+func (r *ModelRegistry) Activate(version string) (err error) {
+	r.Lock()
+	defer r.Unlock()
+	vm, ok := r.models[version]
+	if !ok {
+		return fmt.Errorf("model version %s not found", version)
+	}
+	r.active.Store(vm)
+	Notify(EventModelPromoted, map[string]interface{}{
+		"version":     vm.meta.Version,
+		"trainedAt":   vm.meta.TrainedAt,
+		"sampleCount": vm.meta.SampleCount,
+	})
+	return
+}
+
+// Remove a version, the active version could not be removed
+func (r *ModelRegistry) Remove(version string) (err error) {
+	r.Lock()
+	defer r.Unlock()
+	if vm := r.activeModel(); vm != nil && vm.meta.Version == version {
+		return fmt.Errorf("can not remove active model version %s", version)
+	}
+	delete(r.models, version)
+	return
+}
+
+// Resolve returns the model of version, empty version means the active one
+func (r *ModelRegistry) Resolve(version string) (model Predictor, meta ModelMeta, err error) {
+	var vm *versionedModel
+	if version == "" {
+		vm = r.activeModel()
+	} else {
+		r.RLock()
+		vm = r.models[version]
+		r.RUnlock()
+	}
+	if vm == nil {
+		err = fmt.Errorf("model version %q not found", version)
+		return
+	}
+	meta = vm.meta
+	meta.Active = vm == r.activeModel()
+	return vm.Predictor, meta, nil
+}
+
+// Versions returns the meta of all versions ordered by TrainedAt desc
+func (r *ModelRegistry) Versions() (metas []ModelMeta) {
+	active := r.activeModel()
+	r.RLock()
+	defer r.RUnlock()
+	for _, vm := range r.models {
+		meta := vm.meta
+		meta.Active = vm == active
+		metas = append(metas, meta)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].TrainedAt != metas[j].TrainedAt {
+			return metas[i].TrainedAt > metas[j].TrainedAt
+		}
+		return metas[i].Version > metas[j].Version
+	})
+	return
+}
+
+func (r *ModelRegistry) activeModel() *versionedModel {
+	vm, _ := r.active.Load().(*versionedModel)
+	return vm
+}
+
+// servingModel returns the active model if recSys is a ModelRegistry, the
+// optional interfaces of the model, e.g. PostRanker and ItemScorer, are
+// hidden by the registry otherwise. ctx is of the version of the model if
+// not set.
+func servingModel(ctx context.Context, recSys Predictor) (context.Context, Predictor, error) {
+	registry, ok := recSys.(*ModelRegistry)
+	if !ok {
+		return ctx, recSys, nil
+	}
+	model, meta, err := registry.Resolve("")
+	if err != nil {
+		return ctx, nil, err
+	}
+	if version, _ := ctx.Value(modelVersionKey).(string); version == "" {
+		ctx = WithModelVersion(ctx, meta.Version)
+	}
+	return ctx, model, nil
+}
+
+func (r *ModelRegistry) GetUserFeature(ctx context.Context, userId int) (Tensor, error) {
+	model, _, err := r.Resolve("")
+	if err != nil {
+		return nil, err
+	}
+	return model.GetUserFeature(ctx, userId)
+}
+
+func (r *ModelRegistry) GetItemFeature(ctx context.Context, itemId int) (Tensor, error) {
+	model, _, err := r.Resolve("")
+	if err != nil {
+		return nil, err
+	}
+	return model.GetItemFeature(ctx, itemId)
+}
+
+// Predict with the active model, nil if there is none
+func (r *ModelRegistry) Predict(X tensor.Tensor) tensor.Tensor {
+	vm := r.activeModel()
+	if vm == nil {
+		return nil
+	}
+	return vm.Predictor.Predict(X)
+}
+
+// ActivationWindow is the max difference of ModelActivation.Timestamp to
+// now, so a captured activation could not be replayed later to roll the
+// model back
+var ActivationWindow = 5 * time.Minute
+
+// ModelActivation is the body of POST /service/models/activate
+type ModelActivation struct {
+	Version string `json:"version"`
+	// Timestamp is the unix seconds the activation is signed
+	Timestamp int64 `json:"timestamp"`
+}
+
+// ActivationHandler is the gin handler activating the version of the
+// ModelActivation json signed by secret as the InvalidationHandler, e.g.
+// engine.POST("/service/models/activate", ActivationHandler(registry, secret)).
+// The activations of the Timestamp out of ActivationWindow are rejected.
+func ActivationHandler(registry *ModelRegistry, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := signedBody(c, secret)
+		if !ok {
+			return
+		}
+		var activation ModelActivation
+		if err := json.Unmarshal(body, &activation); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		skew := time.Since(time.Unix(activation.Timestamp, 0))
+		if skew > ActivationWindow || skew < -ActivationWindow {
+			c.JSON(401, gin.H{"error": "activation timestamp out of window"})
+			return
+		}
+		if err := registry.Activate(activation.Version); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, registry.Versions())
+	}
+}
@@ -0,0 +1,97 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestModelRegistry(t *testing.T) {
+	Convey("model registry", t, func() {
+		r := NewModelRegistry()
+		_, _, err := r.Resolve("")
+		So(err, ShouldNotBeNil)
+
+		So(r.Register(idPredictor{}, ModelMeta{Version: "v1", TrainedAt: 1}), ShouldBeNil)
+		So(r.Register(idPredictor{}, ModelMeta{Version: "v2", TrainedAt: 2, SampleCount: 10}), ShouldBeNil)
+		So(r.Register(idPredictor{}, ModelMeta{Version: "v2"}), ShouldNotBeNil)
+
+		_, meta, err := r.Resolve("")
+		So(err, ShouldBeNil)
+		So(meta.Version, ShouldEqual, "v1")
+		So(meta.Active, ShouldBeTrue)
+
+		So(r.Activate("v3"), ShouldNotBeNil)
+		So(r.Activate("v2"), ShouldBeNil)
+		_, meta, err = r.Resolve("")
+		So(err, ShouldBeNil)
+		So(meta.Version, ShouldEqual, "v2")
+		So(meta.SampleCount, ShouldEqual, 10)
+
+		// pinned
+		_, meta, err = r.Resolve("v1")
+		So(err, ShouldBeNil)
+		So(meta.Version, ShouldEqual, "v1")
+		So(meta.Active, ShouldBeFalse)
+
+		So(r.Remove("v2"), ShouldNotBeNil)
+		So(r.Remove("v1"), ShouldBeNil)
+		versions := r.Versions()
+		So(versions, ShouldHaveLength, 1)
+		So(versions[0].Version, ShouldEqual, "v2")
+	})
+
+	Convey("rank with the active model", t, func() {
+		resetFeatureCache()
+		ctx := context.Background()
+		r := NewModelRegistry()
+		_, err := Rank(ctx, r, 1, []int{3, 5})
+		So(err, ShouldNotBeNil)
+		_, err = r.GetUserFeature(ctx, 1)
+		So(err, ShouldNotBeNil)
+		So(r.Predict(nil), ShouldBeNil)
+
+		// the PostRanker of the active model
+		So(r.Register(reversedPredictor{}, ModelMeta{Version: "v1"}), ShouldBeNil)
+		itemScores, err := Rank(ctx, r, 1, []int{3, 5})
+		So(err, ShouldBeNil)
+		So(scoredIds(itemScores), ShouldResemble, []int{5, 3})
+	})
+
+	Convey("signed activation", t, func() {
+		r := NewModelRegistry()
+		So(r.Register(idPredictor{}, ModelMeta{Version: "v1", TrainedAt: 1}), ShouldBeNil)
+		So(r.Register(idPredictor{}, ModelMeta{Version: "v2", TrainedAt: 2}), ShouldBeNil)
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		engine.POST("/service/models/activate", ActivationHandler(r, "s3cret"))
+		body, _ := json.Marshal(ModelActivation{Version: "v2", Timestamp: time.Now().Unix()})
+		post := func(signature string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/service/models/activate", strings.NewReader(string(body)))
+			req.Header.Set(WebhookSignatureHeader, signature)
+			engine.ServeHTTP(w, req)
+			return w
+		}
+		So(post("sha256=bad").Code, ShouldEqual, 401)
+		_, meta, _ := r.Resolve("")
+		So(meta.Version, ShouldEqual, "v1")
+		So(post("sha256="+SignWebhook("s3cret", body)).Code, ShouldEqual, 200)
+		_, meta, _ = r.Resolve("")
+		So(meta.Version, ShouldEqual, "v2")
+
+		// a replay of an old activation
+		body, _ = json.Marshal(ModelActivation{Version: "v1", Timestamp: time.Now().Add(-time.Hour).Unix()})
+		So(post("sha256="+SignWebhook("s3cret", body)).Code, ShouldEqual, 401)
+		body, _ = json.Marshal(ModelActivation{Version: "v1"})
+		So(post("sha256="+SignWebhook("s3cret", body)).Code, ShouldEqual, 401)
+		_, meta, _ = r.Resolve("")
+		So(meta.Version, ShouldEqual, "v2")
+	})
+}
@@ -0,0 +1,216 @@
+package recommend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RequestLog logs the requests of the recommend api if not nil, the log can
+// be replayed against another model or engine build by Replay
+var RequestLog *RequestLogger
+
+// RequestLogRecord is one line of the request log
+type RequestLogRecord struct {
+	// Timestamp is the unix milliseconds the request arrived
+	Timestamp int64         `json:"ts"`
+	Request   RecApiRequest `json:"req"`
+	// ItemScores is the response, the DebugTrace is not logged
+	ItemScores []ItemScore `json:"resp,omitempty"`
+	Version    string      `json:"ver,omitempty"`
+	// LatencyUs is the serving latency in microseconds
+	LatencyUs int64  `json:"lat"`
+	Error     string `json:"err,omitempty"`
+}
+
+// RequestLogger writes RequestLogRecord as JSON lines, it is safe for
+// concurrent use
+type RequestLogger struct {
+	sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewRequestLogger(w io.Writer) *RequestLogger {
+	bw := bufio.NewWriter(w)
+	return &RequestLogger{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (l *RequestLogger) Log(record RequestLogRecord) (err error) {
+	l.Lock()
+	defer l.Unlock()
+	if err = l.enc.Encode(record); err != nil {
+		return
+	}
+	return l.w.Flush()
+}
+
+// LogRequest logs req served from start
+func (l *RequestLogger) LogRequest(start time.Time, req RecApiRequest, resp RecApiResponse, err error) {
+	record := RequestLogRecord{
+		Timestamp:  start.UnixMilli(),
+		Request:    req,
+		ItemScores: resp.ItemScoreList,
+		Version:    resp.Version,
+		LatencyUs:  time.Since(start).Microseconds(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if er := l.Log(record); er != nil {
+		log.Errorf("log request of user %d error: %v", req.UserId, er)
+	}
+}
+
+// ReadRequestLog calls fn with the records in r in order until fn returns
+// an error
+func ReadRequestLog(r io.Reader, fn func(RequestLogRecord) error) (err error) {
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var record RequestLogRecord
+		if err = dec.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("bad request log record %d: %v", line, err)
+		}
+		if err = fn(record); err != nil {
+			return
+		}
+	}
+}
+
+// ReplayDiff is a logged request answered differently by the replay
+type ReplayDiff struct {
+	Line   int `json:"line"`
+	UserId int `json:"userId"`
+	// OrderChanged is true if the items are ranked in different order
+	OrderChanged bool    `json:"orderChanged"`
+	MaxScoreDiff float32 `json:"maxScoreDiff"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// LatencyStats of the logged or the replayed requests
+type LatencyStats struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+func newLatencyStats(latencies []time.Duration) (stats LatencyStats) {
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	quantile := func(q float64) time.Duration {
+		return latencies[int(math.Ceil(q*float64(len(latencies))))-1]
+	}
+	return LatencyStats{
+		Mean: sum / time.Duration(len(latencies)),
+		P50:  quantile(0.5),
+		P99:  quantile(0.99),
+		Max:  latencies[len(latencies)-1],
+	}
+}
+
+type ReplayReport struct {
+	Requests int `json:"requests"`
+	// Skipped are the requests failed when logged
+	Skipped int `json:"skipped"`
+	// Errors are the requests failed by the replay only
+	Errors        int          `json:"errors"`
+	Mismatches    int          `json:"mismatches"`
+	MaxScoreDiff  float32      `json:"maxScoreDiff"`
+	LoggedLatency LatencyStats `json:"loggedLatency"`
+	ReplayLatency LatencyStats `json:"replayLatency"`
+	// Diffs are the first MaxReplayDiffs mismatches
+	Diffs []ReplayDiff `json:"diffs"`
+}
+
+// MaxReplayDiffs is the max ReplayDiff kept in ReplayReport
+var MaxReplayDiffs = 100
+
+// Replay re-runs the requests logged in r against predict sequentially as
+// the recommend api does, and compares the outputs and the latency with the
+// log. A request is a mismatch if the order of the items changed or any score
+// differs by more than tolerance. Exploration is disabled to make the outputs
+// comparable.
+func Replay(ctx context.Context, predict Predictor, r io.Reader, tolerance float32) (report ReplayReport, err error) {
+	var logged, replayed []time.Duration
+	line := 0
+	err = ReadRequestLog(r, func(record RequestLogRecord) error {
+		line++
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if record.Error != "" {
+			report.Skipped++
+			return nil
+		}
+		report.Requests++
+		req := record.Request
+		req.Epsilon, req.Debug = 0, false
+		start := time.Now()
+		resp, _, err := serveRecRequest(ctx, predict, req)
+		replayed = append(replayed, time.Since(start))
+		logged = append(logged, time.Duration(record.LatencyUs)*time.Microsecond)
+
+		diff := ReplayDiff{Line: line, UserId: req.UserId}
+		if err != nil {
+			report.Errors++
+			diff.Error = err.Error()
+		} else {
+			diff.OrderChanged, diff.MaxScoreDiff = compareItemScores(record.ItemScores, resp.ItemScoreList)
+			if diff.MaxScoreDiff > report.MaxScoreDiff {
+				report.MaxScoreDiff = diff.MaxScoreDiff
+			}
+			if !diff.OrderChanged && diff.MaxScoreDiff <= tolerance {
+				return nil
+			}
+		}
+		report.Mismatches++
+		if len(report.Diffs) < MaxReplayDiffs {
+			report.Diffs = append(report.Diffs, diff)
+		}
+		return nil
+	})
+	report.LoggedLatency = newLatencyStats(logged)
+	report.ReplayLatency = newLatencyStats(replayed)
+	return
+}
+
+// compareItemScores returns whether the items or their order differ and the
+// max score difference of the items in both
+func compareItemScores(logged, replayed []ItemScore) (orderChanged bool, maxDiff float32) {
+	orderChanged = len(logged) != len(replayed)
+	scores := make(map[int]float32, len(replayed))
+	for i, is := range replayed {
+		scores[is.ItemId] = is.Score
+		if i < len(logged) && logged[i].ItemId != is.ItemId {
+			orderChanged = true
+		}
+	}
+	for _, is := range logged {
+		score, ok := scores[is.ItemId]
+		if !ok {
+			orderChanged = true
+			continue
+		}
+		if d := float32(math.Abs(float64(score - is.Score))); d > maxDiff {
+			maxDiff = d
+		}
+	}
+	return
+}
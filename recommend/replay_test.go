@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// scaledPredictor scores the items by item id * scale
+type scaledPredictor struct {
+	idPredictor
+	scale float32
+}
+
+func (p scaledPredictor) Predict(X tensor.Tensor) tensor.Tensor {
+	y := p.idPredictor.Predict(X)
+	for i, v := range y.Data().([]float32) {
+		y.Data().([]float32)[i] = v * p.scale
+	}
+	return y
+}
+
+// reversedPredictor ranks the items in the reverse order of the candidates
+type reversedPredictor struct {
+	idPredictor
+}
+
+func (reversedPredictor) PostRank(_ context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+	for i, j := 0, len(itemScores)-1; i < j; i, j = i+1, j-1 {
+		itemScores[i], itemScores[j] = itemScores[j], itemScores[i]
+	}
+	return itemScores, nil
+}
+
+func TestReplay(t *testing.T) {
+	resetFeatureCache()
+	ctx := context.Background()
+	var buf bytes.Buffer
+	logger := NewRequestLogger(&buf)
+	requests := []RecApiRequest{
+		{UserId: 1, ItemIdList: []int{3, 1, 2}},
+		{UserId: 2, ItemIdList: []int{5, 9}},
+		{UserId: 3},
+	}
+	for _, req := range requests {
+		start := time.Now()
+		resp, _, err := serveRecRequest(ctx, idPredictor{}, req)
+		logger.LogRequest(start, req, resp, err)
+	}
+
+	Convey("request log records", t, func() {
+		var records []RequestLogRecord
+		So(ReadRequestLog(bytes.NewReader(buf.Bytes()), func(record RequestLogRecord) error {
+			records = append(records, record)
+			return nil
+		}), ShouldBeNil)
+		So(records, ShouldHaveLength, 3)
+		So(records[0].Request, ShouldResemble, requests[0])
+		So(scoredIds(records[0].ItemScores), ShouldResemble, []int{3, 1, 2})
+		So(records[0].Timestamp, ShouldBeGreaterThan, 0)
+		So(records[2].Error, ShouldEqual, "itemIdList is empty")
+
+		err := ReadRequestLog(strings.NewReader(`{"ts":1}`+"\nnot json\n"), func(RequestLogRecord) error { return nil })
+		So(err, ShouldNotBeNil)
+		stop := errors.New("stop")
+		So(ReadRequestLog(bytes.NewReader(buf.Bytes()), func(RequestLogRecord) error { return stop }), ShouldEqual, stop)
+	})
+
+	Convey("replay against the same model", t, func() {
+		report, err := Replay(ctx, idPredictor{}, bytes.NewReader(buf.Bytes()), 0)
+		So(err, ShouldBeNil)
+		So(report.Requests, ShouldEqual, 2)
+		So(report.Skipped, ShouldEqual, 1)
+		So(report.Mismatches, ShouldEqual, 0)
+		So(report.Diffs, ShouldBeEmpty)
+		So(report.ReplayLatency.Max, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("replay against a changed model", t, func() {
+		report, err := Replay(ctx, scaledPredictor{scale: 0.5}, bytes.NewReader(buf.Bytes()), 0)
+		So(err, ShouldBeNil)
+		So(report.Mismatches, ShouldEqual, 2)
+		So(report.MaxScoreDiff, ShouldEqual, 4.5)
+		So(report.Diffs[0].OrderChanged, ShouldBeFalse)
+		So(report.Diffs[0].MaxScoreDiff, ShouldEqual, 1.5)
+
+		report, err = Replay(ctx, reversedPredictor{}, bytes.NewReader(buf.Bytes()), 100)
+		So(err, ShouldBeNil)
+		So(report.Mismatches, ShouldEqual, 2)
+		So(report.Diffs[1].OrderChanged, ShouldBeTrue)
+	})
+
+	Convey("compare item scores", t, func() {
+		changed, diff := compareItemScores(
+			[]ItemScore{{ItemId: 1, Score: 1}, {ItemId: 2, Score: 0.5}},
+			[]ItemScore{{ItemId: 1, Score: 1}})
+		So(changed, ShouldBeTrue)
+		So(diff, ShouldEqual, 0)
+	})
+}
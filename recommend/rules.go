@@ -0,0 +1,247 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gorgonia.org/tensor"
+)
+
+// RetrieveSize is the candidates the recommend api retrieves by the
+// Retriever of the Predictor if the request has no items
+var RetrieveSize = 100
+
+// ItemScorer is implemented by the Predictors scoring the items without the
+// sample vectors, e.g. RulesRanker. Rank scores by it instead of
+// BatchPredict, the exploration and the post-rankers still apply.
+type ItemScorer interface {
+	ScoreItems(ctx context.Context, userId int, itemIds []int) ([]float32, error)
+}
+
+// Retriever is implemented by the Predictors retrieving the candidate items
+// of a user, the recommend api ranks them if the request has no items
+type Retriever interface {
+	Retrieve(ctx context.Context, userId int, n int) ([]int, error)
+}
+
+// RulesRanker is a Predictor without a trained model for launching before
+// the training data is there: the items are retrieved and scored by the
+// heuristics of the popularity, the recency and the co-visitation with the
+// recent items of the user. It serves the same api, so it could be swapped
+// by the learned model later, e.g. as a version of the ModelRegistry.
+type RulesRanker struct {
+	PopularityWeight float32
+	RecencyWeight    float32
+	CoVisitWeight    float32
+	// RecencyHalfLife is the age halving the recency score of an item, the
+	// age is since its last interaction
+	RecencyHalfLife time.Duration
+	// RecentItems is the recent items of a user co-visited with the next one
+	RecentItems int
+	// Behavior provides the recent items of the users in ScoreItems and
+	// Retrieve if not nil, else the ones observed are used
+	Behavior UserBehavior
+
+	sync.RWMutex
+	popularity map[int]float64
+	lastSeen   map[int]int64
+	coVisit    map[int]map[int]float64
+	recent     map[int][]int
+	popular    []int // by popularity desc, nil if dirty
+}
+
+func NewRulesRanker() *RulesRanker {
+	return &RulesRanker{
+		PopularityWeight: 1,
+		RecencyWeight:    0.5,
+		CoVisitWeight:    1,
+		RecencyHalfLife:  7 * 24 * time.Hour,
+		RecentItems:      5,
+		popularity:       make(map[int]float64),
+		lastSeen:         make(map[int]int64),
+		coVisit:          make(map[int]map[int]float64),
+		recent:           make(map[int][]int),
+	}
+}
+
+// Observe records a positive interaction of userId with itemId at ts in unix
+// seconds, e.g. a click from the event stream
+func (r *RulesRanker) Observe(userId, itemId int, ts int64) {
+	r.Lock()
+	defer r.Unlock()
+	r.popularity[itemId]++
+	if ts > r.lastSeen[itemId] {
+		r.lastSeen[itemId] = ts
+	}
+	recent := r.recent[userId]
+	for _, prev := range recent {
+		if prev == itemId {
+			continue
+		}
+		r.addCoVisit(prev, itemId)
+		r.addCoVisit(itemId, prev)
+	}
+	recent = append(recent, itemId)
+	if len(recent) > r.RecentItems {
+		recent = recent[len(recent)-r.RecentItems:]
+	}
+	r.recent[userId] = recent
+	r.popular = nil
+}
+
+func (r *RulesRanker) addCoVisit(a, b int) {
+	m := r.coVisit[a]
+	if m == nil {
+		m = make(map[int]float64)
+		r.coVisit[a] = m
+	}
+	m[b]++
+}
+
+// ObserveSamples observes the positive samples of trainer
+func (r *RulesRanker) ObserveSamples(ctx context.Context, trainer Trainer) (err error) {
+	sampleCh, err := trainer.SampleGenerator(WithStage(ctx, TrainStage))
+	if err != nil {
+		return
+	}
+	for s := range sampleCh {
+		if s.Label > 0.5 {
+			r.Observe(s.UserId, s.ItemId, s.Timestamp)
+		}
+	}
+	return ctx.Err()
+}
+
+// recentOf returns the recent items of userId
+func (r *RulesRanker) recentOf(ctx context.Context, userId int) ([]int, error) {
+	if r.Behavior != nil {
+		return r.Behavior.GetUserBehavior(ctx, userId, int64(r.RecentItems), -1, time.Now().Unix())
+	}
+	r.RLock()
+	defer r.RUnlock()
+	return append([]int(nil), r.recent[userId]...), nil
+}
+
+// ScoreItems scores itemIds by the weighted sum of the popularity, the
+// recency and the co-visitation, each normalized to [0, 1]
+func (r *RulesRanker) ScoreItems(ctx context.Context, userId int, itemIds []int) (scores []float32, err error) {
+	recent, err := r.recentOf(ctx, userId)
+	if err != nil {
+		return
+	}
+	now := time.Now().Unix()
+	r.RLock()
+	defer r.RUnlock()
+	var maxPop float64
+	for _, p := range r.popularity {
+		maxPop = math.Max(maxPop, p)
+	}
+	coVisits := make([]float64, len(itemIds))
+	var maxCoVisit float64
+	for i, itemId := range itemIds {
+		for _, prev := range recent {
+			coVisits[i] += r.coVisit[prev][itemId]
+		}
+		maxCoVisit = math.Max(maxCoVisit, coVisits[i])
+	}
+
+	scores = make([]float32, len(itemIds))
+	for i, itemId := range itemIds {
+		var popularity, recency, coVisit float64
+		if maxPop > 0 {
+			popularity = math.Log1p(r.popularity[itemId]) / math.Log1p(maxPop)
+		}
+		if seen, ok := r.lastSeen[itemId]; ok && r.RecencyHalfLife > 0 {
+			age := math.Max(0, float64(now-seen))
+			recency = math.Exp2(-age / r.RecencyHalfLife.Seconds())
+		}
+		if maxCoVisit > 0 {
+			coVisit = coVisits[i] / maxCoVisit
+		}
+		scores[i] = r.PopularityWeight*float32(popularity) + r.RecencyWeight*float32(recency) +
+			r.CoVisitWeight*float32(coVisit)
+	}
+	return
+}
+
+// Retrieve returns up to n items co-visited with the recent items of userId
+// first, then the popular ones
+func (r *RulesRanker) Retrieve(ctx context.Context, userId int, n int) (itemIds []int, err error) {
+	recent, err := r.recentOf(ctx, userId)
+	if err != nil {
+		return
+	}
+	seen := make(map[int]bool)
+	add := func(ids []int) {
+		for _, id := range ids {
+			if len(itemIds) >= n {
+				return
+			}
+			if !seen[id] {
+				seen[id] = true
+				itemIds = append(itemIds, id)
+			}
+		}
+	}
+
+	r.RLock()
+	coVisited := make(map[int]float64)
+	for _, prev := range recent {
+		for id, w := range r.coVisit[prev] {
+			coVisited[id] += w
+		}
+	}
+	r.RUnlock()
+	ids := make([]int, 0, len(coVisited))
+	for id := range coVisited {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if coVisited[ids[i]] != coVisited[ids[j]] {
+			return coVisited[ids[i]] > coVisited[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	add(ids)
+	add(r.popularItems())
+	return
+}
+
+// popularItems returns the items by popularity desc
+func (r *RulesRanker) popularItems() []int {
+	r.Lock()
+	defer r.Unlock()
+	if r.popular == nil {
+		r.popular = make([]int, 0, len(r.popularity))
+		for id := range r.popularity {
+			r.popular = append(r.popular, id)
+		}
+		sort.Slice(r.popular, func(i, j int) bool {
+			a, b := r.popular[i], r.popular[j]
+			if r.popularity[a] != r.popularity[b] {
+				return r.popularity[a] > r.popularity[b]
+			}
+			return a < b
+		})
+	}
+	return r.popular
+}
+
+// GetUserFeature, GetItemFeature and Predict make RulesRanker a Predictor,
+// Rank scores by ScoreItems without them
+
+func (r *RulesRanker) GetUserFeature(context.Context, int) (Tensor, error) {
+	return Tensor{}, nil
+}
+
+func (r *RulesRanker) GetItemFeature(context.Context, int) (Tensor, error) {
+	return Tensor{}, nil
+}
+
+func (r *RulesRanker) Predict(X tensor.Tensor) tensor.Tensor {
+	rows := X.Shape()[0]
+	return tensor.New(tensor.WithShape(rows, 1), tensor.WithBacking(make([]float32, rows)))
+}
@@ -0,0 +1,61 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRulesRanker(t *testing.T) {
+	Convey("rules only ranker", t, func() {
+		ctx := context.Background()
+		r := NewRulesRanker()
+		now := time.Now().Unix()
+		// item 1 is the most popular, 3 is co-visited with 2
+		for u := 0; u < 5; u++ {
+			r.Observe(u, 1, now-int64(30*24*3600))
+		}
+		r.Observe(10, 2, now)
+		r.Observe(10, 3, now)
+		r.Observe(11, 2, now)
+
+		Convey("score", func() {
+			scores, err := r.ScoreItems(ctx, 11, []int{1, 3, 4})
+			So(err, ShouldBeNil)
+			// co-visited 3 beats the stale popular 1, 4 is unknown
+			So(scores[1], ShouldBeGreaterThan, scores[0])
+			So(scores[0], ShouldBeGreaterThan, scores[2])
+			So(scores[2], ShouldEqual, 0)
+		})
+
+		Convey("retrieve", func() {
+			ids, err := r.Retrieve(ctx, 11, 3)
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []int{3, 1, 2})
+			ids, err = r.Retrieve(ctx, 99, 10)
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []int{1, 2, 3})
+		})
+
+		Convey("same api without a trained model", func() {
+			resp, code, err := serveRecRequest(ctx, r, RecApiRequest{UserId: 11})
+			So(err, ShouldBeNil)
+			So(code, ShouldEqual, 200)
+			So(scoredIds(resp.ItemScoreList), ShouldResemble, []int{3, 1, 2})
+
+			_, code, err = serveRecRequest(ctx, idPredictor{}, RecApiRequest{UserId: 11})
+			So(err, ShouldNotBeNil)
+			So(code, ShouldEqual, 400)
+		})
+
+		Convey("observe samples", func() {
+			r := NewRulesRanker()
+			So(r.ObserveSamples(ctx, idRecSys{}), ShouldBeNil)
+			ids, err := r.Retrieve(ctx, 1000, 1)
+			So(err, ShouldBeNil)
+			So(ids[0], ShouldBeGreaterThanOrEqualTo, 50)
+		})
+	})
+}
@@ -0,0 +1,194 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type FieldType string
+
+const (
+	FieldNumeric FieldType = "numeric"
+	// FieldCategorical is an integral index, Max is the cardinality - 1
+	FieldCategorical FieldType = "categorical"
+	// FieldBinary is 0 or 1
+	FieldBinary FieldType = "binary"
+)
+
+var (
+	// ErrSchemaViolation is wrapped by the sample errors of the features not
+	// conforming to the FeatureSchema in Train
+	ErrSchemaViolation = errors.New("feature schema violation")
+	// ErrSchemaMismatch is returned by BatchPredict if the FeatureSchema the
+	// model is trained with mismatches the one of the feature provider
+	ErrSchemaMismatch = errors.New("feature schema mismatch")
+)
+
+// FeatureField describes a column of the user, item or context features
+type FeatureField struct {
+	Name string    `json:"name"`
+	Type FieldType `json:"type"`
+	// Min and Max bound the value if Min < Max
+	Min float32 `json:"min,omitempty"`
+	Max float32 `json:"max,omitempty"`
+	// Group is the free form group of the field, e.g. "demographics"
+	Group string `json:"group,omitempty"`
+}
+
+func (f FeatureField) String() string {
+	s := fmt.Sprintf("%s %s", f.Name, f.Type)
+	if f.Min < f.Max {
+		s += fmt.Sprintf(" [%v, %v]", f.Min, f.Max)
+	}
+	if f.Group != "" {
+		s += " (" + f.Group + ")"
+	}
+	return s
+}
+
+// check returns an error if v does not conform to f
+func (f FeatureField) check(v float32) error {
+	if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+		return fmt.Errorf("%s is %v", f.Name, v)
+	}
+	switch f.Type {
+	case FieldBinary:
+		if v != 0 && v != 1 {
+			return fmt.Errorf("binary %s is %v", f.Name, v)
+		}
+	case FieldCategorical:
+		if v != float32(math.Trunc(float64(v))) {
+			return fmt.Errorf("categorical %s is %v", f.Name, v)
+		}
+	}
+	if f.Min < f.Max && (v < f.Min || v > f.Max) {
+		return fmt.Errorf("%s %v out of [%v, %v]", f.Name, v, f.Min, f.Max)
+	}
+	return nil
+}
+
+// FeatureSchema describes the fields of the user and item features and the
+// context features of CtxFeaturer in order
+type FeatureSchema struct {
+	User []FeatureField `json:"user"`
+	Item []FeatureField `json:"item"`
+	Ctx  []FeatureField `json:"ctx,omitempty"`
+}
+
+// SchemaProvider is implemented by the feature provider registering its
+// FeatureSchema. The samples of Train not conforming to it are dropped as
+// ErrProvider errors, the model trained keeps it and BatchPredict refuses to
+// score with a provider of a different one.
+type SchemaProvider interface {
+	FeatureSchema() *FeatureSchema
+}
+
+func featureSchemaOf(featureProvider interface{}) *FeatureSchema {
+	if sp, ok := featureProvider.(SchemaProvider); ok {
+		return sp.FeatureSchema()
+	}
+	return nil
+}
+
+func (s *FeatureSchema) fieldNames(fields []FeatureField) (names []string) {
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	return
+}
+
+func (s *FeatureSchema) groups() [3]struct {
+	name   string
+	fields []FeatureField
+} {
+	return [3]struct {
+		name   string
+		fields []FeatureField
+	}{{"user", s.User}, {"item", s.Item}, {"ctx", s.Ctx}}
+}
+
+// Diff returns the differences of the provided schema from s, nil if equal
+func (s *FeatureSchema) Diff(provided *FeatureSchema) (diff []string) {
+	if s == nil || provided == nil {
+		if s != provided {
+			diff = append(diff, fmt.Sprintf("schema trained %v, provided %v", s != nil, provided != nil))
+		}
+		return
+	}
+	trained, other := s.groups(), provided.groups()
+	for g := range trained {
+		name, a, b := trained[g].name, trained[g].fields, other[g].fields
+		if len(a) != len(b) {
+			diff = append(diff, fmt.Sprintf("%s: %d fields trained, %d provided", name, len(a), len(b)))
+		}
+		for i := 0; i < len(a) || i < len(b); i++ {
+			switch {
+			case i >= len(a):
+				diff = append(diff, fmt.Sprintf("%s[%d]: + %s", name, i, b[i]))
+			case i >= len(b):
+				diff = append(diff, fmt.Sprintf("%s[%d]: - %s", name, i, a[i]))
+			case a[i] != b[i]:
+				diff = append(diff, fmt.Sprintf("%s[%d]: %s -> %s", name, i, a[i], b[i]))
+			}
+		}
+	}
+	return
+}
+
+// validateFields checks the width and the values of the features of a group
+func validateFields(group string, fields []FeatureField, feature Tensor) error {
+	if len(feature) != len(fields) {
+		return fmt.Errorf("%w: %s feature width %d != %d fields", ErrSchemaViolation, group, len(feature), len(fields))
+	}
+	for i, v := range feature {
+		if err := fields[i].check(v); err != nil {
+			return fmt.Errorf("%w: %s[%d] %v", ErrSchemaViolation, group, i, err)
+		}
+	}
+	return nil
+}
+
+// validateSample validates the features of sampleKey fetched in Train
+// against the FeatureSchema of featureProvider if any
+func validateSample(ctx context.Context, featureProvider interface{}, sampleKey *Sample,
+	userFeature, itemFeature, ctxFeature Tensor) (err error) {
+	if !inStage(ctx, TrainStage) {
+		return
+	}
+	schema := featureSchemaOf(featureProvider)
+	if schema == nil {
+		return
+	}
+	if err = validateFields("user", schema.User, userFeature); err != nil {
+		return newSampleError(sampleKey, ErrMissingUser, err)
+	}
+	if err = validateFields("item", schema.Item, itemFeature); err != nil {
+		return newSampleError(sampleKey, ErrMissingItem, err)
+	}
+	if len(schema.Ctx) != 0 {
+		// the CyclicalTimeEncoding follows the request context features
+		if len(ctxFeature) > CtxFeatureWidth {
+			ctxFeature = ctxFeature[:CtxFeatureWidth]
+		}
+		if err = validateFields("ctx", schema.Ctx, ctxFeature); err != nil {
+			return newSampleError(sampleKey, ErrProvider, err)
+		}
+	}
+	return
+}
+
+// checkSchema returns ErrSchemaMismatch with the diff if the schema the
+// model is trained with mismatches the one of featureProvider, the models
+// trained without a schema are not checked
+func checkSchema(trained *FeatureSchema, featureProvider interface{}) error {
+	if trained == nil {
+		return nil
+	}
+	if diff := trained.Diff(featureSchemaOf(featureProvider)); len(diff) != 0 {
+		return fmt.Errorf("%w: %s", ErrSchemaMismatch, strings.Join(diff, "; "))
+	}
+	return nil
+}
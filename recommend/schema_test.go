@@ -0,0 +1,83 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// schemaPredictor is idPredictor with the users of age 0-100 and the items
+// of category 0-9
+type schemaPredictor struct {
+	idPredictor
+	schema *FeatureSchema
+}
+
+func (p schemaPredictor) FeatureSchema() *FeatureSchema {
+	return p.schema
+}
+
+func testSchema() *FeatureSchema {
+	return &FeatureSchema{
+		User: []FeatureField{{Name: "age", Type: FieldNumeric, Min: 0, Max: 100, Group: "demographics"}},
+		Item: []FeatureField{{Name: "category", Type: FieldCategorical, Min: 0, Max: 9}},
+	}
+}
+
+func TestFeatureSchema(t *testing.T) {
+	Convey("feature schema", t, func() {
+		resetFeatureCache()
+		p := schemaPredictor{schema: testSchema()}
+
+		Convey("validate in train", func() {
+			ctx := WithStage(context.Background(), TrainStage)
+			_, _, _, err := GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, p, &Sample{UserId: 30, ItemId: 3})
+			So(err, ShouldBeNil)
+			_, _, _, err = GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, p, &Sample{UserId: 30, ItemId: 12})
+			So(errors.Is(err, ErrSchemaViolation), ShouldBeTrue)
+			So(errors.Is(err, ErrProvider), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "category 12 out of [0, 9]")
+			_, _, _, err = GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, p, &Sample{UserId: 130, ItemId: 3})
+			So(errors.Is(err, ErrSchemaViolation), ShouldBeTrue)
+
+			// not validated in predict
+			_, _, _, err = GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache, p, &Sample{UserId: 30, ItemId: 12})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("field checks", func() {
+			So(FeatureField{Name: "b", Type: FieldBinary}.check(0.5), ShouldNotBeNil)
+			So(FeatureField{Name: "b", Type: FieldBinary}.check(1), ShouldBeNil)
+			So(FeatureField{Name: "c", Type: FieldCategorical}.check(1.5), ShouldNotBeNil)
+			So(FeatureField{Name: "n", Type: FieldNumeric}.check(-1e9), ShouldBeNil)
+		})
+
+		Convey("diff", func() {
+			provided := testSchema()
+			So(testSchema().Diff(provided), ShouldBeEmpty)
+			provided.Item[0].Max = 19
+			provided.User = append(provided.User, FeatureField{Name: "gender", Type: FieldBinary})
+			So(testSchema().Diff(provided), ShouldResemble, []string{
+				"user: 1 fields trained, 2 provided",
+				"user[1]: + gender binary",
+				"item[0]: category categorical [0, 9] -> category categorical [0, 19]",
+			})
+		})
+
+		Convey("batch predict refuses the mismatched provider", func() {
+			model := &modelImpl{UserFeaturer: p, ItemFeaturer: p, PredictAbstract: p, schema: testSchema()}
+			_, err := Rank(context.Background(), model, 30, []int{3})
+			So(err, ShouldBeNil)
+
+			changed := testSchema()
+			changed.User[0].Name = "age_years"
+			p.schema = changed
+			model.UserFeaturer, model.ItemFeaturer = p, p
+			_, err = Rank(context.Background(), model, 30, []int{3})
+			So(errors.Is(err, ErrSchemaMismatch), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "user[0]: age numeric [0, 100] (demographics) -> age_years")
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package recommend
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding"
+)
+
+const trainSeedKey ctxKey = "trainSeed"
+
+// WithTrainSeed returns the ctx of a training seeded by seed, e.g.
+//
+//	model, err := Train(WithTrainSeed(ctx, 7), recSys, fitter)
+//
+// Two trainings of the same seed on the same samples produce the same
+// model: it seeds the item and user embeddings, the batch shuffling, the
+// SeedFitters and math/rand for the models initialized by it, e.g. the
+// gorgonia ones, and keeps the samples in the order of the SampleGenerator.
+// The embeddings train on a single goroutine then. 0 leaves them unseeded.
+func WithTrainSeed(ctx context.Context, seed int64) context.Context {
+	return context.WithValue(ctx, trainSeedKey, seed)
+}
+
+// trainSeedOf returns the seed of WithTrainSeed, 0 if not seeded
+func trainSeedOf(ctx context.Context) int64 {
+	seed, _ := ctx.Value(trainSeedKey).(int64)
+	return seed
+}
+
+// SeedFitter is a Fitter of its own randomness, e.g. the weight init or the
+// subsampling, seeded by WithTrainSeed
+type SeedFitter interface {
+	SetSeed(seed int64)
+}
+
+// setTrainSeed seeds math/rand and fitter, may be nil, by the seed of ctx
+// if any
+func setTrainSeed(ctx context.Context, fitter interface{}) {
+	seed := trainSeedOf(ctx)
+	if seed == 0 {
+		return
+	}
+	rand.Seed(seed)
+	if sf, ok := fitter.(SeedFitter); ok {
+		sf.SetSeed(seed)
+	}
+}
+
+// newSeedRand returns the rand.Rand of seed, or of the time if 0
+func newSeedRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// newTrainRand returns the rand.Rand of the seed of ctx, or of the time if
+// not seeded
+func newTrainRand(ctx context.Context) *rand.Rand {
+	return newSeedRand(trainSeedOf(ctx))
+}
+
+// itemEmbeddingOptions returns ItemEmbeddingOptions of ItemEmbDim, seeded by
+// the seed of ctx if it sets no Seed
+func itemEmbeddingOptions(ctx context.Context) embedding.Options {
+	opts := ItemEmbeddingOptions
+	opts.Dim = ItemEmbDim
+	if opts.Seed == 0 {
+		opts.Seed = trainSeedOf(ctx)
+	}
+	return opts
+}
+
+// sortBySeq reorders the rows of sample by seq, the order of the
+// SampleGenerator, which the SampleAssembler goroutines shuffle
+func sortBySeq(sample *TrainSample, seq []int) *TrainSample {
+	rows := make([]int, len(seq))
+	for i := range rows {
+		rows[i] = i
+	}
+	sort.Slice(rows, func(i, j int) bool { return seq[rows[i]] < seq[rows[j]] })
+	sorted := sample.subset(rows)
+	sorted.Dropped = sample.Dropped
+	return sorted
+}
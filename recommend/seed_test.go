@@ -0,0 +1,57 @@
+package recommend
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// seedFitter records the seed, the rows and a draw of math/rand
+type seedFitter struct {
+	seed int64
+	keys []SampleKey
+	draw int64
+}
+
+func (f *seedFitter) SetSeed(seed int64) {
+	f.seed = seed
+}
+
+func (f *seedFitter) Fit(sample *TrainSample) (PredictAbstract, error) {
+	f.keys, f.draw = sample.Keys, rand.Int63()
+	return idPredictor{}, nil
+}
+
+func TestTrainSeed(t *testing.T) {
+	Convey("seeded training", t, func() {
+		resetFeatureCache()
+		ctx := WithTrainSeed(context.Background(), 7)
+
+		var fitters []*seedFitter
+		for run := 0; run < 2; run++ {
+			fitter := &seedFitter{}
+			_, err := Train(ctx, idRecSys{}, fitter)
+			So(err, ShouldBeNil)
+			fitters = append(fitters, fitter)
+		}
+		So(fitters[0].seed, ShouldEqual, 7)
+		So(fitters[0].draw, ShouldEqual, fitters[1].draw)
+		So(fitters[0].keys, ShouldHaveLength, 1000)
+		for i, key := range fitters[0].keys {
+			So(key.ItemId, ShouldEqual, i%100)
+		}
+		So(fitters[1].keys, ShouldResemble, fitters[0].keys)
+
+		Convey("shuffles the batches the same", func() {
+			sample := &TrainSample{Rows: 100, XCols: 1, X: make([]float32, 100), Y: make([]float32, 100)}
+			var orders [][]int
+			for run := 0; run < 2; run++ {
+				orders = append(orders, NewMemBatchProvider(sample, 10, true, trainSeedOf(ctx)).index)
+			}
+			So(orders[0], ShouldNotBeEmpty)
+			So(orders[1], ShouldResemble, orders[0])
+		})
+	})
+}
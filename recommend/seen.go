@@ -0,0 +1,126 @@
+package recommend
+
+import (
+	"context"
+	"time"
+)
+
+// SeenFilterKey is the ctx key of the per request SeenFilter
+const SeenFilterKey ctxKey = "seenFilter"
+
+// SeenItems is the default SeenFilter applied in Rank, nil ranks the items
+// the user interacted with too. It could be overridden per request by
+// WithSeenFilter.
+var SeenItems *SeenFilter
+
+// SeenFilter drops the items in the recent behavior of the user from the
+// candidates of Rank and RankTopK before scoring, e.g. the items already
+// purchased
+type SeenFilter struct {
+	// Len is the recent items of every behavior sequence checked, 0 means
+	// UserBehaviorLen
+	Len int
+	// Window is the max age of the interactions dropped, 0 means no limit.
+	// Only a TimedUserBehavior has the time, it is ignored otherwise.
+	Window time.Duration
+	// Channels are the MultiBehavior types dropped, e.g. "purchase", empty
+	// means the sequence of the TimedUserBehavior or UserBehavior
+	Channels []string
+}
+
+type seenFilterValue struct {
+	*SeenFilter
+}
+
+// WithSeenFilter returns a ctx making Rank use filter, nil filter keeps the
+// seen items for the request even if SeenItems is set
+func WithSeenFilter(ctx context.Context, filter *SeenFilter) context.Context {
+	return context.WithValue(ctx, SeenFilterKey, seenFilterValue{filter})
+}
+
+func seenFilterOf(ctx context.Context) *SeenFilter {
+	if v, ok := ctx.Value(SeenFilterKey).(seenFilterValue); ok {
+		return v.SeenFilter
+	}
+	return SeenItems
+}
+
+// filterSeen returns the itemIds not seen by userId by the SeenFilter of
+// ctx, itemIds itself if none is dropped
+func filterSeen(ctx context.Context, recSys interface{}, userId int, itemIds []int) (unseen []int, err error) {
+	filter := seenFilterOf(ctx)
+	if filter == nil || len(itemIds) == 0 {
+		return itemIds, nil
+	}
+	seen, err := filter.seen(ctx, recSys, userId)
+	if err != nil {
+		logOf(ctx).Errorf("get seen items of user %d error: %v", userId, err)
+		return
+	}
+	if len(seen) == 0 {
+		return itemIds, nil
+	}
+	unseen = make([]int, 0, len(itemIds))
+	for _, itemId := range itemIds {
+		if !seen[itemId] {
+			unseen = append(unseen, itemId)
+		}
+	}
+	return
+}
+
+// seen returns the items in the recent behavior of userId
+func (f *SeenFilter) seen(ctx context.Context, recSys interface{}, userId int) (seen map[int]bool, err error) {
+	var (
+		maxLen = int64(f.Len)
+		now    = time.Now()
+	)
+	if maxLen <= 0 {
+		maxLen = int64(UserBehaviorLen)
+	}
+	seen = make(map[int]bool)
+	if len(f.Channels) != 0 {
+		mb, ok := recSys.(MultiBehavior)
+		if !ok {
+			return
+		}
+		var channels map[string][]int
+		if channels, err = mb.GetUserBehaviors(ctx, userId, maxLen, -1, now.Unix()); err != nil {
+			return
+		}
+		for _, name := range f.Channels {
+			for _, itemId := range channels[name] {
+				seen[itemId] = true
+			}
+		}
+		return
+	}
+	if tb, ok := recSys.(TimedUserBehavior); ok {
+		var events []BehaviorEvent
+		if events, err = tb.GetUserBehaviorEvents(ctx, userId, maxLen, -1, now.Unix()); err != nil {
+			return
+		}
+		for _, e := range events {
+			if f.Window <= 0 || e.Timestamp >= now.Add(-f.Window).Unix() {
+				seen[e.ItemId] = true
+			}
+		}
+		return
+	}
+	if ub, ok := recSys.(UserBehavior); ok {
+		var itemSeq []int
+		// the UserBehaviorCache keeps the sequences of UserBehaviorLen
+		if maxLen == int64(UserBehaviorLen) {
+			itemSeq, err = getUserBehavior(ctx, ub, userId, maxLen, -1, now.Unix())
+		} else {
+			itemSeq, err = ub.GetUserBehavior(ctx, userId, maxLen, -1, now.Unix())
+		}
+		if err != nil {
+			return
+		}
+		for _, itemId := range itemSeq {
+			seen[itemId] = true
+		}
+	}
+	return
+}
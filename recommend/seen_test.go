@@ -0,0 +1,78 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// seenPredictor is an idPredictor of the user bought the item 3 an hour
+// ago and the item 4 a week ago, and clicked the item 5
+type seenPredictor struct {
+	idPredictor
+}
+
+func (seenPredictor) GetUserBehaviorEvents(context.Context, int, int64, int64, int64) ([]BehaviorEvent, error) {
+	now := time.Now().Unix()
+	return []BehaviorEvent{{ItemId: 4, Timestamp: now - 7*86400}, {ItemId: 3, Timestamp: now - 3600}}, nil
+}
+
+func (seenPredictor) GetUserBehaviors(context.Context, int, int64, int64, int64) (map[string][]int, error) {
+	return map[string][]int{"purchase": {3, 4}, "click": {5}}, nil
+}
+
+func TestSeenFilter(t *testing.T) {
+	Convey("filter the seen items", t, func() {
+		resetFeatureCache()
+		defer func() { SeenItems = nil }()
+		ctx := context.Background()
+		itemIds := []int{1, 3, 4, 5, 7, 8}
+
+		itemScores, err := Rank(ctx, inspectPredictor{}, 1, itemIds)
+		So(err, ShouldBeNil)
+		So(itemScores, ShouldHaveLength, 6)
+
+		SeenItems = &SeenFilter{}
+		itemScores, err = Rank(ctx, inspectPredictor{}, 1, itemIds)
+		So(err, ShouldBeNil)
+		So(scoredIds(itemScores), ShouldResemble, []int{1, 3, 4, 5})
+
+		itemScores, err = RankTopK(ctx, inspectPredictor{}, 1, itemIds, 2)
+		So(err, ShouldBeNil)
+		So(scoredIds(itemScores), ShouldResemble, []int{5, 4})
+
+		// overridden per request
+		itemScores, err = Rank(WithSeenFilter(ctx, nil), inspectPredictor{}, 1, itemIds)
+		So(err, ShouldBeNil)
+		So(itemScores, ShouldHaveLength, 6)
+
+		Convey("all the candidates seen", func() {
+			SeenItems = &SeenFilter{}
+			itemScores, err := Rank(ctx, inspectPredictor{}, 1, []int{7, 8})
+			So(err, ShouldBeNil)
+			So(itemScores, ShouldNotBeNil)
+			So(itemScores, ShouldBeEmpty)
+			itemScores, err = RankTopK(ctx, inspectPredictor{}, 1, []int{7, 8}, 2)
+			So(err, ShouldBeNil)
+			So(itemScores, ShouldBeEmpty)
+			_, err = BatchPredict(ctx, inspectPredictor{}, nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("in the window", func() {
+			SeenItems = &SeenFilter{Window: 24 * time.Hour}
+			itemScores, err := Rank(ctx, seenPredictor{}, 1, itemIds)
+			So(err, ShouldBeNil)
+			So(scoredIds(itemScores), ShouldResemble, []int{1, 4, 5, 7, 8})
+		})
+
+		Convey("of the behavior types", func() {
+			SeenItems = &SeenFilter{Channels: []string{"purchase"}}
+			itemScores, err := Rank(ctx, seenPredictor{}, 1, itemIds)
+			So(err, ShouldBeNil)
+			So(scoredIds(itemScores), ShouldResemble, []int{1, 5, 7, 8})
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package recommend
+
+import (
+	"context"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+)
+
+// SessionBehavior is UserBehavior grouped into sessions, e.g. split by 30
+// minutes of inactivity. sessions are ordered by time desc, sessions[0] is
+// the current one, and the items in a session are ordered by time desc too.
+// The limits are the same as UserBehavior, maxLen limits the total items.
+// If implemented, it is used instead of UserBehavior and the items of the
+// older sessions are weighted lower in the UserBehaviorRange, see
+// SessionDecay.
+type SessionBehavior interface {
+	GetUserSessions(ctx context.Context, userId int,
+		maxLen int64, maxPk int64, maxTs int64) (sessions [][]int, err error)
+}
+
+// SessionDecay is the weight ratio of the item embeddings of a session to the
+// next newer one in the UserBehaviorRange, the current session has weight 1
+var SessionDecay float32 = 0.5
+
+// getSessionBehavior fills the embeddings of the items of the sessions of
+// userId weighted by SessionDecay into the user behavior tensor
+func getSessionBehavior(ctx context.Context, recSysSb SessionBehavior, itemFeatureCache *ccache.Cache,
+	featureProvider BasicFeatureProvider, userId int, maxTs int64) (ubTensor Tensor, err error) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "GetUserSessions")
+	sessions, err := recSysSb.GetUserSessions(ctx, userId, UserBehaviorLen, -1, maxTs)
+	endSpan(span, err)
+	metrics.providerSeconds[cacheUserBehavior].since(start)
+	if err != nil {
+		return
+	}
+	var (
+		i      int
+		weight float32 = 1
+	)
+	ubTensor = make(Tensor, userBehaviorWidth())
+	for _, session := range sessions {
+		for _, itemId := range session {
+			if i == UserBehaviorLen {
+				return
+			}
+			if itemEmb, ok := itemEmbeddingOf(ctx, itemFeatureCache, featureProvider, itemId); ok {
+				for j, v := range itemEmb {
+					ubTensor[i*ItemEmbDim+j] = v * weight
+				}
+			}
+			i++
+		}
+		weight *= SessionDecay
+	}
+	return
+}
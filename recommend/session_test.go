@@ -0,0 +1,51 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// sessionPredictor has the sessions [1 2] [3] [4 ...] of every user
+type sessionPredictor struct {
+	idPredictor
+}
+
+func (sessionPredictor) GetUserSessions(_ context.Context, _ int, maxLen, _, _ int64) ([][]int, error) {
+	long := make([]int, maxLen)
+	for i := range long {
+		long[i] = 4
+	}
+	return [][]int{{1, 2}, {3}, long}, nil
+}
+
+func (sessionPredictor) GetUserBehavior(context.Context, int, int64, int64, int64) ([]int, error) {
+	panic("GetUserBehavior called")
+}
+
+func TestSessionBehavior(t *testing.T) {
+	defer itemEmbeddingMap.store(itemEmbeddingMap.load())
+
+	Convey("session recency in user behavior", t, func() {
+		resetFeatureCache()
+		ones := make([]float32, ItemEmbDim)
+		for i := range ones {
+			ones[i] = 1
+		}
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": ones, "2": ones, "3": ones, "4": ones})
+
+		vec, uWidth, _, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache, sessionPredictor{}, &Sample{UserId: 1, ItemId: 2})
+		So(err, ShouldBeNil)
+		info := newSampleInfo(uWidth, 1)
+		ub := vec[info.UserBehaviorRange[0]:info.UserBehaviorRange[1]]
+		So(ub[0], ShouldEqual, 1)
+		So(ub[ItemEmbDim], ShouldEqual, 1)
+		So(ub[2*ItemEmbDim], ShouldEqual, 0.5)
+		So(ub[3*ItemEmbDim], ShouldEqual, 0.25)
+		// truncated to UserBehaviorLen
+		So(ub[len(ub)-1], ShouldEqual, 0.25)
+		So(vec[info.ItemFeatureRange[0]], ShouldEqual, 1)
+	})
+}
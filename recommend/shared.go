@@ -0,0 +1,209 @@
+package recommend
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/auxten/go-ctr/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// SharedItemFeatures is looked up before ItemFeatureCache and
+	// GetItemFeature if not nil, see OpenSharedTable
+	SharedItemFeatures *SharedTable
+	// SharedItemEmbedding is looked up before the item embedding trained if
+	// not nil, see ExportSharedEmbedding
+	SharedItemEmbedding *SharedTable
+)
+
+const (
+	sharedTableMagic   = "CTRS"
+	sharedTableVersion = 1
+	sharedHeaderSize   = 16
+)
+
+// SharedTable is a read only id to vector table mmapped from a file, so N
+// serving processes on one host share a single copy in the page cache.
+//
+// Layout, all little-endian:
+//
+//	magic "CTRS" | version uint32 | width uint32 | count uint32 |
+//	ids int64 * count in asc order | values float32 * count * width
+type SharedTable struct {
+	width  int
+	ids    []byte // int64 * count
+	values []float32
+	count  int
+	unmmap func() error
+}
+
+// WriteSharedTable writes vectors of the same width to path, the file is
+// replaced atomically so the processes could reopen it at any time.
+func WriteSharedTable(path string, width int, vectors map[int][]float32) (err error) {
+	ids := make([]int, 0, len(vectors))
+	for id, vec := range vectors {
+		if len(vec) != width {
+			return fmt.Errorf("vector width of id %d mismatch: %d:%d", id, width, len(vec))
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	w := bufio.NewWriter(f)
+	header := [sharedHeaderSize]byte{}
+	copy(header[:], sharedTableMagic)
+	binary.LittleEndian.PutUint32(header[4:], sharedTableVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(width))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(ids)))
+	if _, err = w.Write(header[:]); err != nil {
+		return
+	}
+	for _, id := range ids {
+		if err = binary.Write(w, binary.LittleEndian, int64(id)); err != nil {
+			return
+		}
+	}
+	for _, id := range ids {
+		if err = binary.Write(w, binary.LittleEndian, vectors[id]); err != nil {
+			return
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// OpenSharedTable mmaps the table written by WriteSharedTable
+func OpenSharedTable(path string) (t *SharedTable, err error) {
+	data, unmmap, err := utils.MmapFile(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			unmmap()
+		}
+	}()
+	if len(data) < sharedHeaderSize || string(data[:4]) != sharedTableMagic {
+		return nil, fmt.Errorf("not a shared table: %s", path)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != sharedTableVersion {
+		return nil, fmt.Errorf("unsupported shared table version: %d", v)
+	}
+	t = &SharedTable{
+		width:  int(binary.LittleEndian.Uint32(data[8:])),
+		count:  int(binary.LittleEndian.Uint32(data[12:])),
+		unmmap: unmmap,
+	}
+	idsEnd := sharedHeaderSize + t.count*8
+	if len(data) != idsEnd+t.count*t.width*4 {
+		return nil, fmt.Errorf("shared table size mismatch: %s", path)
+	}
+	t.ids = data[sharedHeaderSize:idsEnd]
+	t.values = utils.Float32sFromBytes(data[idsEnd:])
+	return
+}
+
+func (t *SharedTable) id(i int) int {
+	return int(int64(binary.LittleEndian.Uint64(t.ids[i*8:])))
+}
+
+// Get returns the vector of id, it must not be modified
+func (t *SharedTable) Get(id int) (vec Tensor, ok bool) {
+	i := sort.Search(t.count, func(i int) bool { return t.id(i) >= id })
+	if i == t.count || t.id(i) != id {
+		return nil, false
+	}
+	return t.values[i*t.width : (i+1)*t.width : (i+1)*t.width], true
+}
+
+func (t *SharedTable) Len() int {
+	return t.count
+}
+
+func (t *SharedTable) Width() int {
+	return t.width
+}
+
+// Close unmaps the table, vectors got from it must not be used after
+func (t *SharedTable) Close() error {
+	if t.unmmap == nil {
+		return nil
+	}
+	unmmap := t.unmmap
+	t.unmmap = nil
+	return unmmap()
+}
+
+// ExportSharedItemFeatures writes the features of itemIds got from
+// featurer to path as a SharedTable
+func ExportSharedItemFeatures(ctx context.Context, path string, featurer ItemFeaturer, itemIds []int) (err error) {
+	ctx = WithStage(ctx, PredictStage)
+	var (
+		vectors = make(map[int][]float32, len(itemIds))
+		width   int
+	)
+	for i, itemId := range itemIds {
+		var feature Tensor
+		if feature, err = featurer.GetItemFeature(ctx, itemId); err != nil {
+			log.Errorf("get item %d feature error: %v", itemId, err)
+			return
+		}
+		if i == 0 {
+			width = len(feature)
+		}
+		vectors[itemId] = feature
+	}
+	return WriteSharedTable(path, width, vectors)
+}
+
+// ExportSharedEmbedding writes the item embedding trained to path as a
+// SharedTable, items with non integer ids are skipped
+func ExportSharedEmbedding(path string) (err error) {
+	embMap := itemEmbeddingMap.load()
+	vectors := make(map[int][]float32, len(embMap))
+	for key, emb := range embMap {
+		itemId, er := strconv.Atoi(key)
+		if er != nil {
+			continue
+		}
+		vectors[itemId] = emb
+	}
+	return WriteSharedTable(path, ItemEmbDim, vectors)
+}
+
+// hasItemEmbedding returns true if any item embedding is available
+func hasItemEmbedding() bool {
+	return len(itemEmbeddingMap.load()) != 0 || (SharedItemEmbedding != nil && SharedItemEmbedding.Len() != 0)
+}
+
+// getItemEmbedding looks up SharedItemEmbedding then the embedding trained
+func getItemEmbedding(itemId int) (emb []float32, ok bool) {
+	if SharedItemEmbedding != nil {
+		if emb, ok = SharedItemEmbedding.Get(itemId); ok {
+			return
+		}
+	}
+	return itemEmbeddingMap.Get(strconv.Itoa(itemId))
+}
@@ -0,0 +1,55 @@
+package recommend
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSharedTable(t *testing.T) {
+	Convey("shared mmap feature table", t, func() {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "items.ctrs")
+		So(WriteSharedTable(path, 2, map[int][]float32{1: {1, 2}, 2: {1}}), ShouldNotBeNil)
+
+		ctx := context.Background()
+		// idPredictor item feature is [itemId]
+		So(ExportSharedItemFeatures(ctx, path, idPredictor{}, []int{30, 10, 20}), ShouldBeNil)
+		table, err := OpenSharedTable(path)
+		So(err, ShouldBeNil)
+		defer table.Close()
+		So(table.Len(), ShouldEqual, 3)
+		So(table.Width(), ShouldEqual, 1)
+		vec, ok := table.Get(20)
+		So(ok, ShouldBeTrue)
+		So(vec, ShouldResemble, Tensor{20})
+		_, ok = table.Get(15)
+		So(ok, ShouldBeFalse)
+
+		// shared features are served before the provider
+		So(WriteSharedTable(path, 1, map[int][]float32{3: {100}}), ShouldBeNil)
+		SharedItemFeatures, err = OpenSharedTable(path)
+		So(err, ShouldBeNil)
+		defer func() {
+			SharedItemFeatures.Close()
+			SharedItemFeatures = nil
+		}()
+		resetFeatureCache()
+		scores, err := Rank(ctx, idPredictor{}, 1, []int{3, 4})
+		So(err, ShouldBeNil)
+		So(scores[0].Score, ShouldEqual, 100)
+		So(scores[1].Score, ShouldEqual, 4)
+
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"5": make([]float32, ItemEmbDim), "x": make([]float32, ItemEmbDim)})
+		defer itemEmbeddingMap.store(nil)
+		embPath := filepath.Join(dir, "emb.ctrs")
+		So(ExportSharedEmbedding(embPath), ShouldBeNil)
+		embTable, err := OpenSharedTable(embPath)
+		So(err, ShouldBeNil)
+		defer embTable.Close()
+		So(embTable.Len(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,292 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+)
+
+var (
+	// ItemIndex searches the similar items of SimilarItems if set, e.g. an
+	// index of an ANN library built on the item embedding, nil searches the
+	// item embedding of the last Train
+	ItemIndex NeighborIndex
+	// SimilarBruteForceMax is the max embeddings searched by brute force,
+	// the larger ones are searched by an LSHIndex built on the first search
+	SimilarBruteForceMax = 20000
+	// LSHBits and LSHTables are the hyperplanes of a hash and the hash
+	// tables of the LSHIndex, more tables are more recall and memory
+	LSHBits   = 12
+	LSHTables = 8
+	// LSHSeed seeds the hyperplanes of the LSHIndex, 0 for random ones
+	LSHSeed int64
+)
+
+// NeighborIndex is a nearest neighbor index of the embeddings of the ids
+type NeighborIndex interface {
+	// Search returns up to k ids of the largest cosine to vec in desc order
+	// and the cosines, exclude is not returned
+	Search(vec []float32, k int, exclude int) (ids []int, scores []float32, err error)
+}
+
+// VectorIndex is a NeighborIndex keeping the embeddings of the ids, the
+// query of an id is its own embedding then
+type VectorIndex interface {
+	NeighborIndex
+	Vector(id int) (vec []float32, ok bool)
+}
+
+// SimilarItems returns the k items of the largest cosine of the item
+// embedding to itemId, the Score is the cosine
+func SimilarItems(ctx context.Context, itemId int, k int) (itemScores []ItemScore, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid k: %d", k)
+	}
+	vec, ok := getItemEmbedding(itemId)
+	if !ok {
+		return nil, fmt.Errorf("item %d has no embedding", itemId)
+	}
+	index := ItemIndex
+	if index == nil {
+		embMap := itemEmbeddingMap.load()
+		if len(embMap) == 0 {
+			return nil, fmt.Errorf("no item embedding trained")
+		}
+		if index, err = itemNeighbors.of(embMap, strconv.Atoi); err != nil {
+			return
+		}
+	}
+	ids, scores, err := index.Search(vec, k, itemId)
+	if err != nil {
+		return
+	}
+	itemScores = make([]ItemScore, len(ids))
+	for i, id := range ids {
+		itemScores[i] = ItemScore{ItemId: id, Score: scores[i]}
+	}
+	externalItemKeys(itemScores)
+	return
+}
+
+var itemNeighbors neighborsCache
+
+// neighborsCache keeps the NeighborIndex of the last embedding map searched,
+// a new map of Train or UpdateItemEmbedding rebuilds it
+type neighborsCache struct {
+	sync.Mutex
+	mapPtr uintptr
+	size   int
+	index  NeighborIndex
+}
+
+// of returns the NeighborIndex of emb, the words are parsed to the ids by
+// parse, the ones failed are skipped
+func (c *neighborsCache) of(emb word2vec.EmbeddingMap32, parse func(word string) (int, error)) (index NeighborIndex, err error) {
+	c.Lock()
+	defer c.Unlock()
+	ptr := reflect.ValueOf(emb).Pointer()
+	if c.index != nil && c.mapPtr == ptr && c.size == len(emb) {
+		return c.index, nil
+	}
+	bf := &BruteForceIndex{}
+	for word, vec := range emb {
+		id, er := parse(word)
+		if er != nil {
+			continue
+		}
+		bf.Add(id, vec)
+	}
+	if len(bf.ids) == 0 {
+		return nil, fmt.Errorf("no embedding of the ids")
+	}
+	index = bf
+	if len(bf.ids) > SimilarBruteForceMax {
+		index = NewLSHIndex(bf, LSHBits, LSHTables, LSHSeed)
+	}
+	c.mapPtr, c.size, c.index = ptr, len(emb), index
+	return
+}
+
+// BruteForceIndex is the exact NeighborIndex comparing all the embeddings
+type BruteForceIndex struct {
+	ids  []int
+	vecs [][]float32 // L2 normalized
+	rows map[int]int // map[id]row
+}
+
+// Add the embedding vec of id
+func (b *BruteForceIndex) Add(id int, vec []float32) {
+	if b.rows == nil {
+		b.rows = make(map[int]int)
+	}
+	b.rows[id] = len(b.ids)
+	b.ids = append(b.ids, id)
+	b.vecs = append(b.vecs, normalized(vec))
+}
+
+// Vector returns the normalized embedding of id
+func (b *BruteForceIndex) Vector(id int) (vec []float32, ok bool) {
+	r, ok := b.rows[id]
+	if !ok {
+		return
+	}
+	return b.vecs[r], true
+}
+
+func (b *BruteForceIndex) Search(vec []float32, k int, exclude int) (ids []int, scores []float32, err error) {
+	all := make([]int, len(b.ids))
+	for i := range all {
+		all[i] = i
+	}
+	ids, scores = b.top(normalized(vec), all, k, exclude)
+	return
+}
+
+// top returns the k of the rows of the largest dot to the normalized q
+func (b *BruteForceIndex) top(q []float32, rows []int, k int, exclude int) (ids []int, scores []float32) {
+	type scored struct {
+		row   int
+		score float32
+	}
+	candidates := make([]scored, 0, len(rows))
+	for _, r := range rows {
+		if b.ids[r] == exclude || len(b.vecs[r]) != len(q) {
+			continue
+		}
+		var dot float32
+		for i, v := range b.vecs[r] {
+			dot += v * q[i]
+		}
+		candidates = append(candidates, scored{r, dot})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return b.ids[candidates[i].row] < b.ids[candidates[j].row]
+	})
+	if k < len(candidates) {
+		candidates = candidates[:k]
+	}
+	for _, c := range candidates {
+		ids = append(ids, b.ids[c.row])
+		scores = append(scores, c.score)
+	}
+	return
+}
+
+// LSHIndex is the approximate NeighborIndex of the random hyperplane LSH of
+// the cosine: the rows of the same hash in any table and their neighbors of
+// 1 bit flipped are compared exactly, all the rows if they are less than k
+type LSHIndex struct {
+	base   *BruteForceIndex
+	planes [][][]float32 // [table][bit][dim]
+	tables []map[uint64][]int
+}
+
+// NewLSHIndex returns the LSHIndex of the embeddings of base, the
+// hyperplanes are random of seed, or of the time if 0
+func NewLSHIndex(base *BruteForceIndex, bits, tables int, seed int64) *LSHIndex {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	var (
+		rnd = rand.New(rand.NewSource(seed))
+		dim int
+		idx = &LSHIndex{base: base}
+	)
+	if len(base.vecs) != 0 {
+		dim = len(base.vecs[0])
+	}
+	for t := 0; t < tables; t++ {
+		planes := make([][]float32, bits)
+		for b := range planes {
+			planes[b] = make([]float32, dim)
+			for d := range planes[b] {
+				planes[b][d] = float32(rnd.NormFloat64())
+			}
+		}
+		table := make(map[uint64][]int)
+		for r, vec := range base.vecs {
+			h := lshHash(planes, vec)
+			table[h] = append(table[h], r)
+		}
+		idx.planes = append(idx.planes, planes)
+		idx.tables = append(idx.tables, table)
+	}
+	return idx
+}
+
+// Vector returns the normalized embedding of id
+func (l *LSHIndex) Vector(id int) ([]float32, bool) {
+	return l.base.Vector(id)
+}
+
+func (l *LSHIndex) Search(vec []float32, k int, exclude int) (ids []int, scores []float32, err error) {
+	q := normalized(vec)
+	var (
+		seen = make(map[int]bool)
+		rows []int
+	)
+	for t, planes := range l.planes {
+		h := lshHash(planes, q)
+		for flip := -1; flip < len(planes); flip++ {
+			probe := h
+			if flip >= 0 {
+				probe ^= 1 << uint(flip)
+			}
+			for _, r := range l.tables[t][probe] {
+				if !seen[r] {
+					seen[r] = true
+					rows = append(rows, r)
+				}
+			}
+		}
+	}
+	if len(rows) <= k {
+		return l.base.Search(vec, k, exclude)
+	}
+	ids, scores = l.base.top(q, rows, k, exclude)
+	return
+}
+
+func lshHash(planes [][]float32, vec []float32) (h uint64) {
+	for b, plane := range planes {
+		var dot float32
+		for i := 0; i < len(plane) && i < len(vec); i++ {
+			dot += plane[i] * vec[i]
+		}
+		if dot >= 0 {
+			h |= 1 << uint(b)
+		}
+	}
+	return
+}
+
+// normalized returns the L2 normalized copy of vec, zeros if vec is
+func normalized(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	out := make([]float32, len(vec))
+	if norm == 0 {
+		return out
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i, v := range vec {
+		out[i] = v * scale
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package recommend
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSimilarItems(t *testing.T) {
+	Convey("similar items by item embedding", t, func() {
+		defer func(emb word2vec.EmbeddingMap32, max int) {
+			itemEmbeddingMap.store(emb)
+			SimilarBruteForceMax = max
+		}(itemEmbeddingMap.load(), SimilarBruteForceMax)
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{
+			"1": {1, 0, 0},
+			"2": {0.9, 0.1, 0},
+			"3": {0, 1, 0},
+			"4": {-1, 0, 0},
+			"5": {2, 0.5, 0},
+		})
+		ctx := context.Background()
+		scores, err := SimilarItems(ctx, 1, 2)
+		So(err, ShouldBeNil)
+		So(scores, ShouldHaveLength, 2)
+		So(scores[0].ItemId, ShouldEqual, 2)
+		So(scores[1].ItemId, ShouldEqual, 5)
+		So(scores[0].Score, ShouldBeGreaterThan, scores[1].Score)
+
+		scores, err = SimilarItems(ctx, 1, 10)
+		So(err, ShouldBeNil)
+		So(scores, ShouldHaveLength, 4)
+		So(scores[3].ItemId, ShouldEqual, 4)
+		So(scores[3].Score, ShouldAlmostEqual, -1, 1e-6)
+
+		_, err = SimilarItems(ctx, 9, 2)
+		So(err, ShouldNotBeNil)
+		_, err = SimilarItems(ctx, 1, -1)
+		So(err, ShouldNotBeNil)
+
+		Convey("by the LSH index of a large catalog", func() {
+			SimilarBruteForceMax = 100
+			rnd := rand.New(rand.NewSource(1))
+			itemEmbeddingMap.store(word2vec.EmbeddingMap32{})
+			for i := 0; i < 1000; i++ {
+				vec := make([]float32, 16)
+				for j := range vec {
+					vec[j] = float32(rnd.NormFloat64())
+				}
+				itemEmbeddingMap.load()[strconv.Itoa(i)] = vec
+			}
+			// a near copy of item 0
+			near := append([]float32(nil), itemEmbeddingMap.load()["0"]...)
+			near[0] += 0.01
+			itemEmbeddingMap.load()["1000"] = near
+
+			index, err := itemNeighbors.of(itemEmbeddingMap.load(), strconv.Atoi)
+			So(err, ShouldBeNil)
+			So(index, ShouldHaveSameTypeAs, &LSHIndex{})
+			scores, err := SimilarItems(ctx, 0, 5)
+			So(err, ShouldBeNil)
+			So(scores, ShouldHaveLength, 5)
+			So(scores[0].ItemId, ShouldEqual, 1000)
+		})
+	})
+}
@@ -0,0 +1,152 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// UserIndex searches the similar users of SimilarUsers if set, see
+// NewUserIndex, nil searches the user2vec embedding of the last Train
+var UserIndex NeighborIndex
+
+var userNeighbors neighborsCache
+
+// UserScore is a user of the Score to another one
+type UserScore struct {
+	UserId int     `json:"userId"`
+	Score  float32 `json:"score"`
+	// UserKey is the external id of the user if UserIds is set
+	UserKey string `json:"userKey,omitempty"`
+}
+
+// UserTower embeds the user of a sample vector, e.g. the twotower.TwoTower
+type UserTower interface {
+	UserEmbedding(x []float32) []float32
+}
+
+// SimilarUsers returns the k users of the largest cosine of the user
+// embedding to userId, for the look-alike audience expansion or to check
+// whether the users of the similar behaviors are embedded nearby. The
+// embedding is of UserIndex if set, or else the user2vec of Train.
+func SimilarUsers(ctx context.Context, userId int, k int) (userScores []UserScore, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid k: %d", k)
+	}
+	var (
+		index = UserIndex
+		vec   []float32
+		ok    bool
+	)
+	if index == nil {
+		embMap := userEmbeddingMap.load()
+		if len(embMap) == 0 {
+			return nil, fmt.Errorf("no user embedding, implement UserEmbedding or set UserIndex")
+		}
+		if index, err = userNeighbors.of(embMap, parseUserWord); err != nil {
+			return
+		}
+	}
+	if vi, isVi := index.(VectorIndex); isVi {
+		vec, ok = vi.Vector(userId)
+	}
+	if !ok {
+		vec, ok = GetUserEmbedding(userId)
+	}
+	if !ok {
+		return nil, fmt.Errorf("user %d has no embedding", userId)
+	}
+	ids, scores, err := index.Search(vec, k, userId)
+	if err != nil {
+		return
+	}
+	userScores = make([]UserScore, len(ids))
+	for i, id := range ids {
+		userScores[i] = UserScore{UserId: id, Score: scores[i]}
+		if UserIds != nil {
+			userScores[i].UserKey, _ = UserIds.External(id)
+		}
+	}
+	return
+}
+
+func parseUserWord(word string) (int, error) {
+	if !strings.HasPrefix(word, userWordPrefix) {
+		return 0, fmt.Errorf("not a user word: %s", word)
+	}
+	return strconv.Atoi(word[len(userWordPrefix):])
+}
+
+// NewUserIndex returns the index of the embeddings of userIds for UserIndex.
+// With tower the embedding is of the sample vector of the user and
+// probeItem, which the user tower ignores, or else it is the user2vec
+// embedding or the average of the embeddings of the behavior items. The
+// users without the embedding are skipped.
+func NewUserIndex(ctx context.Context, recSys Predictor, userIds []int, tower UserTower, probeItem int) (index VectorIndex, err error) {
+	if UserFeatureCache == nil || ItemFeatureCache == nil {
+		return nil, fmt.Errorf("feature cache not initialized")
+	}
+	ctx = WithStage(ctx, PredictStage)
+	var (
+		bf    = &BruteForceIndex{}
+		ub, _ = recSys.(UserBehavior)
+		now   = time.Now().Unix()
+	)
+	for _, userId := range userIds {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var vec []float32
+		if tower != nil {
+			s := Sample{UserId: userId, ItemId: probeItem, Timestamp: now}
+			x, _, _, er := GetSampleVector(ctx, UserFeatureCache, ItemFeatureCache, recSys, &s)
+			if er != nil {
+				log.Debugf("skip user %d of the user index: %v", userId, er)
+				continue
+			}
+			vec = tower.UserEmbedding(x)
+		} else {
+			var behaviors []float32
+			if ub != nil {
+				itemSeq, er := getUserBehavior(ctx, ub, userId, UserBehaviorLen, -1, now)
+				if er != nil {
+					log.Debugf("skip user %d of the user index: %v", userId, er)
+					continue
+				}
+				for _, itemId := range itemSeq {
+					if emb, ok := getItemEmbedding(itemId); ok && len(emb) == ItemEmbDim {
+						behaviors = append(behaviors, emb...)
+					}
+				}
+			}
+			vec = userEmbeddingOf(userId, behaviors)
+		}
+		if isZero(vec) {
+			continue
+		}
+		bf.Add(userId, vec)
+	}
+	if len(bf.ids) == 0 {
+		return nil, fmt.Errorf("none of the %d users has an embedding", len(userIds))
+	}
+	if len(bf.ids) > SimilarBruteForceMax {
+		return NewLSHIndex(bf, LSHBits, LSHTables, LSHSeed), nil
+	}
+	return bf, nil
+}
+
+func isZero(vec []float32) bool {
+	for _, v := range vec {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// parityPredictor is an idPredictor of the odd users behaving on the item 1
+// and the even users on the item 2
+type parityPredictor struct {
+	idPredictor
+}
+
+func (parityPredictor) GetUserBehavior(_ context.Context, userId int, _, _, _ int64) ([]int, error) {
+	return []int{userId%2 + 1}, nil
+}
+
+// profileTower embeds a user by the user feature and a bias
+type profileTower struct{}
+
+func (profileTower) UserEmbedding(x []float32) []float32 {
+	return []float32{x[0], 1}
+}
+
+func TestSimilarUsers(t *testing.T) {
+	Convey("similar users", t, func() {
+		defer func(itemEmb, userEmb word2vec.EmbeddingMap32) {
+			itemEmbeddingMap.store(itemEmb)
+			userEmbeddingMap.store(userEmb)
+			UserIndex = nil
+		}(itemEmbeddingMap.load(), userEmbeddingMap.load())
+		ctx := context.Background()
+
+		Convey("by user2vec", func() {
+			userEmbeddingMap.store(word2vec.EmbeddingMap32{
+				userWord(1): {1, 0},
+				userWord(2): {0, 1},
+				userWord(3): {1, 0.1},
+				"7":         {1, 0},
+			})
+			scores, err := SimilarUsers(ctx, 1, 5)
+			So(err, ShouldBeNil)
+			So(scores, ShouldHaveLength, 2)
+			So(scores[0].UserId, ShouldEqual, 3)
+			So(scores[1].UserId, ShouldEqual, 2)
+
+			_, err = SimilarUsers(ctx, 1, 0)
+			So(err, ShouldNotBeNil)
+			_, err = SimilarUsers(ctx, 4, 5)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("by averaged behavior embeddings", func() {
+			resetFeatureCache()
+			userEmbeddingMap.store(nil)
+			one, two := make([]float32, ItemEmbDim), make([]float32, ItemEmbDim)
+			one[0], two[1] = 1, 1
+			itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": one, "2": two})
+			_, err := SimilarUsers(ctx, 1, 5)
+			So(err, ShouldNotBeNil)
+
+			index, err := NewUserIndex(ctx, parityPredictor{}, []int{1, 2, 3, 4, 5}, nil, 0)
+			So(err, ShouldBeNil)
+			UserIndex = index
+			scores, err := SimilarUsers(ctx, 2, 2)
+			So(err, ShouldBeNil)
+			So(scores, ShouldHaveLength, 2)
+			So(scores[0].UserId, ShouldEqual, 4)
+			So(scores[0].Score, ShouldAlmostEqual, 1, 1e-6)
+			So(scores[1].Score, ShouldAlmostEqual, 0, 1e-6)
+		})
+
+		Convey("by the user tower", func() {
+			resetFeatureCache()
+			index, err := NewUserIndex(ctx, idPredictor{}, []int{1, 2, 10}, profileTower{}, 1)
+			So(err, ShouldBeNil)
+			UserIndex = index
+			// (1, 1) is nearer to (2, 1) than to (10, 1)
+			scores, err := SimilarUsers(ctx, 1, 1)
+			So(err, ShouldBeNil)
+			So(scores, ShouldHaveLength, 1)
+			So(scores[0].UserId, ShouldEqual, 2)
+		})
+	})
+}
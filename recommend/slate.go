@@ -0,0 +1,160 @@
+package recommend
+
+import (
+	"context"
+)
+
+// SlateConstraint limits the count of the items matched by Match in the slate
+// to [Min, Max], Max <= 0 means no limit. A hard constraint is never violated
+// unless there are not enough candidates to meet it, a Soft one costs Penalty
+// on the score for each item over Max and rewards Penalty for each item below
+// Min.
+type SlateConstraint struct {
+	Name    string
+	Match   func(is ItemScore) bool
+	Min     int
+	Max     int
+	Soft    bool
+	Penalty float32
+}
+
+// CategoryMix constrains the count of items in category
+func CategoryMix(categoryOf func(itemId int) string, category string, min, max int) SlateConstraint {
+	return SlateConstraint{
+		Name:  "category:" + category,
+		Match: func(is ItemScore) bool { return categoryOf(is.ItemId) == category },
+		Min:   min,
+		Max:   max,
+	}
+}
+
+// SponsoredSlots limits the count of the items marked Sponsored, e.g. by
+// SponsoredBlender
+func SponsoredSlots(max int) SlateConstraint {
+	return SlateConstraint{
+		Name:  "sponsored",
+		Match: func(is ItemScore) bool { return is.Sponsored },
+		Max:   max,
+	}
+}
+
+// FreshnessQuota requires at least min fresh items
+func FreshnessQuota(isFresh func(itemId int) bool, min int) SlateConstraint {
+	return SlateConstraint{
+		Name:  "freshness",
+		Match: func(is ItemScore) bool { return isFresh(is.ItemId) },
+		Min:   min,
+	}
+}
+
+// SlateSolver is a PostRanker composing the top K items maximizing the total
+// score subject to all the Constraints together, instead of chaining filters
+// which could undo each other. It fills the slate greedily by score, and only
+// picks an item if the Min of the hard constraints could still be met by the
+// slots left, which makes it exact for disjoint constraints and conservative
+// for overlapping ones.
+type SlateSolver struct {
+	// K is the slate size, K <= 0 means all the candidates
+	K           int
+	Constraints []SlateConstraint
+}
+
+func NewSlateSolver(k int, constraints ...SlateConstraint) *SlateSolver {
+	return &SlateSolver{K: k, Constraints: constraints}
+}
+
+func (s *SlateSolver) PostRank(_ context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+	return s.Solve(itemScores), nil
+}
+
+// Solve returns the slate in the order of selection
+func (s *SlateSolver) Solve(itemScores []ItemScore) (slate []ItemScore) {
+	k := s.K
+	if k <= 0 || k > len(itemScores) {
+		k = len(itemScores)
+	}
+	var (
+		cons     = s.Constraints
+		matches  = make([][]bool, len(cons))
+		counts   = make([]int, len(cons))
+		mins     = make([]int, len(cons))
+		selected = make([]bool, len(itemScores))
+	)
+	for c, con := range cons {
+		matches[c] = make([]bool, len(itemScores))
+		var avail int
+		for i, is := range itemScores {
+			if con.Match(is) {
+				matches[c][i] = true
+				avail++
+			}
+		}
+		// a hard Min could not be met beyond the candidates
+		mins[c] = con.Min
+		if !con.Soft && mins[c] > avail {
+			mins[c] = avail
+		}
+	}
+
+	slate = make([]ItemScore, 0, k)
+	for len(slate) < k {
+		var (
+			best       = -1
+			bestScore  float32
+			bestNeeded int
+			slotsLeft  = k - len(slate) - 1
+		)
+		for i, is := range itemScores {
+			if selected[i] {
+				continue
+			}
+			var (
+				score  = is.Score
+				needed int
+				banned bool
+			)
+			for c, con := range cons {
+				cnt := counts[c]
+				if matches[c][i] {
+					cnt++
+				}
+				if con.Max > 0 && cnt > con.Max {
+					if !con.Soft {
+						banned = true
+						break
+					}
+					score -= con.Penalty
+				}
+				if con.Soft {
+					if matches[c][i] && counts[c] < con.Min {
+						score += con.Penalty
+					}
+				} else if deficit := mins[c] - cnt; deficit > 0 {
+					needed += deficit
+				}
+			}
+			if banned {
+				continue
+			}
+			// prefer the items keeping the hard Min feasible, then the ones
+			// closest to feasible if none does
+			if needed < slotsLeft {
+				needed = slotsLeft
+			}
+			if best == -1 || needed < bestNeeded || (needed == bestNeeded && score > bestScore) {
+				best, bestScore, bestNeeded = i, score, needed
+			}
+		}
+		if best == -1 {
+			break
+		}
+		selected[best] = true
+		slate = append(slate, itemScores[best])
+		for c := range cons {
+			if matches[c][best] {
+				counts[c]++
+			}
+		}
+	}
+	return
+}
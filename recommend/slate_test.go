@@ -0,0 +1,72 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSlateSolver(t *testing.T) {
+	// items 1-10 scored 1.0, 0.9 ... 0.1, even items are "video", items > 7 are fresh
+	input := func() (itemScores []ItemScore) {
+		for i := 1; i <= 10; i++ {
+			itemScores = append(itemScores, ItemScore{ItemId: i, Score: float32(11-i) / 10})
+		}
+		itemScores[0].Sponsored = true
+		itemScores[2].Sponsored = true
+		return
+	}
+	categoryOf := func(itemId int) string {
+		if itemId%2 == 0 {
+			return "video"
+		}
+		return "article"
+	}
+	isFresh := func(itemId int) bool { return itemId > 7 }
+
+	Convey("no constraint is top K", t, func() {
+		slate, err := NewSlateSolver(3).PostRank(context.Background(), 1, input())
+		So(err, ShouldBeNil)
+		So(scoredIds(slate), ShouldResemble, []int{1, 2, 3})
+	})
+
+	Convey("interacting hard constraints", t, func() {
+		solver := NewSlateSolver(4,
+			CategoryMix(categoryOf, "video", 0, 2),
+			SponsoredSlots(1),
+			FreshnessQuota(isFresh, 1),
+		)
+		// 3 is sponsored after 1, 8 would be the third video so 9 fills the fresh quota
+		So(scoredIds(solver.Solve(input())), ShouldResemble, []int{1, 2, 4, 9})
+	})
+
+	Convey("quota met by a lower item when slots run out", t, func() {
+		solver := NewSlateSolver(3, FreshnessQuota(isFresh, 2))
+		So(scoredIds(solver.Solve(input())), ShouldResemble, []int{1, 8, 9})
+	})
+
+	Convey("unsatisfiable Min is capped by candidates", t, func() {
+		solver := NewSlateSolver(3, FreshnessQuota(isFresh, 5))
+		So(scoredIds(solver.Solve(input()[:8])), ShouldResemble, []int{1, 2, 8})
+	})
+
+	Convey("slate is short if Max bans the rest", t, func() {
+		solver := NewSlateSolver(5, CategoryMix(categoryOf, "video", 0, 1), CategoryMix(categoryOf, "article", 0, 2))
+		So(scoredIds(solver.Solve(input())), ShouldResemble, []int{1, 2, 3})
+	})
+
+	Convey("soft constraints trade score", t, func() {
+		cheap := SponsoredSlots(1)
+		cheap.Soft, cheap.Penalty = true, 0.05
+		So(scoredIds(NewSlateSolver(3, cheap).Solve(input())), ShouldResemble, []int{1, 2, 3})
+
+		costly := SponsoredSlots(1)
+		costly.Soft, costly.Penalty = true, 0.5
+		So(scoredIds(NewSlateSolver(3, costly).Solve(input())), ShouldResemble, []int{1, 2, 4})
+
+		fresh := FreshnessQuota(isFresh, 1)
+		fresh.Soft, fresh.Penalty = true, 0.75
+		So(scoredIds(NewSlateSolver(3, fresh).Solve(input())), ShouldResemble, []int{8, 1, 2})
+	})
+}
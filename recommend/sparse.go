@@ -0,0 +1,121 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gorgonia.org/tensor"
+)
+
+// SparseFeatureDim is the width of the sparse features of SparseFeaturer,
+// they follow all the dense features, see SampleInfo.SparseRange. 0 means no
+// sparse features. Must be the same in Train and predict.
+var SparseFeatureDim int
+
+// SparseTensor is a sparse vector of Dim, e.g. the one-hot of a high
+// cardinality feature. Indices are ascending.
+type SparseTensor struct {
+	Dim     int       `json:"dim"`
+	Indices []int     `json:"indices"`
+	Values  []float32 `json:"values"`
+}
+
+// OneHot returns the SparseTensor of dim with 1 at the indices
+func OneHot(dim int, indices ...int) SparseTensor {
+	s := SparseTensor{Dim: dim, Indices: append([]int(nil), indices...), Values: make([]float32, len(indices))}
+	sort.Ints(s.Indices)
+	for i := range s.Values {
+		s.Values[i] = 1
+	}
+	return s
+}
+
+// Dense returns the dense Tensor of s
+func (s SparseTensor) Dense() Tensor {
+	return s.AppendDense(make(Tensor, 0, s.Dim))
+}
+
+// AppendDense appends the dense values of s to dst
+func (s SparseTensor) AppendDense(dst []float32) []float32 {
+	start := len(dst)
+	for i := 0; i < s.Dim; i++ {
+		dst = append(dst, 0)
+	}
+	for i, idx := range s.Indices {
+		dst[start+idx] = s.Values[i]
+	}
+	return dst
+}
+
+func (s SparseTensor) validate() error {
+	if s.Dim != SparseFeatureDim {
+		return fmt.Errorf("sparse feature dim %d != %d", s.Dim, SparseFeatureDim)
+	}
+	if len(s.Indices) != len(s.Values) {
+		return fmt.Errorf("sparse feature indices %d != values %d", len(s.Indices), len(s.Values))
+	}
+	for i, idx := range s.Indices {
+		if idx < 0 || idx >= s.Dim || i > 0 && idx <= s.Indices[i-1] {
+			return fmt.Errorf("sparse feature index %d at %d out of order or range", idx, i)
+		}
+	}
+	return nil
+}
+
+// SparseFeaturer provides the sparse features of a sample of
+// SparseFeatureDim, e.g. the one-hot of the user id crossed with the item
+// category
+type SparseFeaturer interface {
+	GetSparseFeature(ctx context.Context, sample *Sample) (SparseTensor, error)
+}
+
+// SparseFitter is implemented by the Fitters accepting the TrainSample with
+// the sparse features in Sparse, the others get the densified TrainSample
+type SparseFitter interface {
+	FitSparse(sample *TrainSample) (PredictAbstract, error)
+}
+
+// SparsePredictAbstract is implemented by the models predicting with the
+// sparse features apart, BatchPredict densifies them for the others. The
+// Predict of it should accept the densified X too, see DebugSample.
+type SparsePredictAbstract interface {
+	PredictSparse(X tensor.Tensor, sparse []SparseTensor) tensor.Tensor
+}
+
+// Densify appends the dense Sparse features to every row of X
+func (s *TrainSample) Densify() {
+	if s.Sparse == nil {
+		return
+	}
+	xCols := s.XCols + SparseFeatureDim
+	x := make([]float32, 0, s.Rows*xCols)
+	for i := 0; i < s.Rows; i++ {
+		x = append(x, s.X[i*s.XCols:(i+1)*s.XCols]...)
+		x = s.Sparse[i].AppendDense(x)
+	}
+	s.X, s.XCols, s.Sparse = x, xCols, nil
+}
+
+// getSparseFeature returns the sparse features of sampleKey, zeros if
+// SparseFeaturer is not implemented
+func getSparseFeature(ctx context.Context, featureProvider interface{}, sampleKey *Sample) (sparse SparseTensor, err error) {
+	sparse.Dim = SparseFeatureDim
+	if SparseFeatureDim <= 0 {
+		return
+	}
+	sparseFeaturer, ok := featureProvider.(SparseFeaturer)
+	if !ok {
+		return
+	}
+	ctx, span := startSpan(ctx, "GetSparseFeature")
+	sparse, err = sparseFeaturer.GetSparseFeature(ctx, sampleKey)
+	endSpan(span, err)
+	if err == nil {
+		err = sparse.validate()
+	}
+	if err != nil {
+		return sparse, newSampleError(sampleKey, ErrProvider, err)
+	}
+	return
+}
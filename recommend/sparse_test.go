@@ -0,0 +1,121 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// oneHotRecSys is idRecSys with the one-hot of itemId % SparseFeatureDim
+type oneHotRecSys struct {
+	idRecSys
+}
+
+func (oneHotRecSys) GetSparseFeature(_ context.Context, sample *Sample) (SparseTensor, error) {
+	return OneHot(SparseFeatureDim, sample.ItemId%SparseFeatureDim), nil
+}
+
+// sparseModel scores by the one-hot index of the sparse features
+type sparseModel struct {
+	idPredictor
+	rows int
+}
+
+func (m *sparseModel) PredictSparse(X tensor.Tensor, sparse []SparseTensor) tensor.Tensor {
+	m.rows = X.Shape()[0]
+	y := make([]float32, len(sparse))
+	for i, sp := range sparse {
+		y[i] = float32(sp.Indices[0])
+	}
+	return tensor.New(tensor.WithShape(len(y), 1), tensor.WithBacking(y))
+}
+
+// sparseFitter records the TrainSample it is fitted with
+type sparseFitter struct {
+	dense, sparse *TrainSample
+}
+
+func (f *sparseFitter) Fit(sample *TrainSample) (PredictAbstract, error) {
+	f.dense = sample
+	return idPredictor{}, nil
+}
+
+func (f *sparseFitter) FitSparse(sample *TrainSample) (PredictAbstract, error) {
+	f.sparse = sample
+	return &sparseModel{}, nil
+}
+
+func TestSparseFeature(t *testing.T) {
+	Convey("sparse features", t, func() {
+		resetFeatureCache()
+		SparseFeatureDim = 8
+		defer func() { SparseFeatureDim = 0 }()
+
+		Convey("sparse tensor", func() {
+			s := OneHot(8, 5, 2)
+			So(s.Indices, ShouldResemble, []int{2, 5})
+			So(s.Dense(), ShouldResemble, Tensor{0, 0, 1, 0, 0, 1, 0, 0})
+			So(s.validate(), ShouldBeNil)
+			So(OneHot(8, 2, 2).validate(), ShouldNotBeNil)
+			So(OneHot(8, 8).validate(), ShouldNotBeNil)
+			So(OneHot(4, 1).validate(), ShouldNotBeNil)
+		})
+
+		Convey("densified in the sample vector", func() {
+			vec, _, _, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache,
+				oneHotRecSys{}, &Sample{UserId: 1, ItemId: 11})
+			So(err, ShouldBeNil)
+			So(vec[len(vec)-8:], ShouldResemble, []float32{0, 0, 0, 1, 0, 0, 0, 0})
+			// the dense features are untouched
+			plain, _, _, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache,
+				idPredictor{}, &Sample{UserId: 1, ItemId: 11})
+			So(err, ShouldBeNil)
+			So(vec[:len(vec)-8], ShouldResemble, plain[:len(plain)-8])
+		})
+
+		Convey("densify train sample", func() {
+			sample := &TrainSample{
+				X: []float32{1, 2}, Rows: 2, XCols: 1,
+				Sparse: []SparseTensor{OneHot(8, 0), OneHot(8, 7)},
+			}
+			sample.Densify()
+			So(sample.XCols, ShouldEqual, 9)
+			So(sample.Sparse, ShouldBeNil)
+			So(sample.X, ShouldResemble, []float32{1, 1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 1})
+		})
+
+		Convey("sparse fitter gets the sparse features apart", func() {
+			fitter := &sparseFitter{}
+			result, err := TrainWithResult(context.Background(), oneHotRecSys{}, fitter)
+			So(err, ShouldBeNil)
+			So(fitter.dense, ShouldBeNil)
+			So(fitter.sparse.Sparse, ShouldHaveLength, fitter.sparse.Rows)
+			So(fitter.sparse.XCols, ShouldEqual, result.SampleInfo.SparseRange[0])
+			So(result.SampleInfo.SparseRange[1]-result.SampleInfo.SparseRange[0], ShouldEqual, 8)
+		})
+
+		Convey("streamed dense in the mini-batches", func() {
+			info, batchCh, errCh, err := GetSampleStream(oneHotRecSys{}, context.Background(), 64)
+			So(err, ShouldBeNil)
+			fitter := &countFitter{}
+			_, err = fitter.FitStream(batchCh, info)
+			So(err, ShouldBeNil)
+			So(<-errCh, ShouldBeNil)
+			So(fitter.xCols, ShouldEqual, info.SparseRange[1])
+		})
+
+		Convey("batch predict with the sparse model", func() {
+			model := &sparseModel{}
+			rec := &modelImpl{UserFeaturer: oneHotRecSys{}, ItemFeaturer: oneHotRecSys{}, PredictAbstract: model}
+			scores, err := Rank(context.Background(), rec, 1, []int{3, 13, 6})
+			So(err, ShouldBeNil)
+			So(model.rows, ShouldEqual, 3)
+			So(scores, ShouldHaveLength, 3)
+			So(scores[0].Score, ShouldEqual, 3)
+			So(scores[1].Score, ShouldEqual, 5)
+			So(scores[2].Score, ShouldEqual, 6)
+		})
+	})
+}
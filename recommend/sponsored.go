@@ -0,0 +1,233 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Campaign sponsors ItemIds, Bid is charged for each sponsored exposure
+// until Budget is spent
+type Campaign struct {
+	Id      string
+	ItemIds []int
+	Bid     float32
+	Budget  float64
+	Start   time.Time
+	End     time.Time
+}
+
+type campaignState struct {
+	Campaign
+	spent, reserved float64
+}
+
+// Pacer throttles the sponsored exposure to spend the Budget of the campaigns
+// evenly from Start to End. A campaign is allowed while the spent and the
+// reserved are below the even pacing line plus Slack * Budget.
+type Pacer struct {
+	Slack float64
+
+	sync.Mutex
+	campaigns map[string]*campaignState
+	byItem    map[int]*campaignState
+	now       func() time.Time
+}
+
+func NewPacer(campaigns ...Campaign) *Pacer {
+	p := &Pacer{
+		Slack:     0.05,
+		campaigns: make(map[string]*campaignState),
+		byItem:    make(map[int]*campaignState),
+		now:       time.Now,
+	}
+	for _, c := range campaigns {
+		p.AddCampaign(c)
+	}
+	return p
+}
+
+// AddCampaign adds or replaces the campaign with the same Id, the spent and
+// the reserved are kept. An item in several campaigns is sponsored by the highest Bid.
+func (p *Pacer) AddCampaign(c Campaign) {
+	p.Lock()
+	defer p.Unlock()
+	state := &campaignState{Campaign: c}
+	if old, ok := p.campaigns[c.Id]; ok {
+		state.spent, state.reserved = old.spent, old.reserved
+		for _, itemId := range old.ItemIds {
+			if p.byItem[itemId] == old {
+				delete(p.byItem, itemId)
+			}
+		}
+	}
+	p.campaigns[c.Id] = state
+	for _, itemId := range c.ItemIds {
+		if cur, ok := p.byItem[itemId]; !ok || cur.Bid < c.Bid {
+			p.byItem[itemId] = state
+		}
+	}
+}
+
+func (p *Pacer) allowed(c *campaignState, now time.Time) bool {
+	committed := c.spent + c.reserved
+	if now.Before(c.Start) || !now.Before(c.End) || committed+float64(c.Bid) > c.Budget {
+		return false
+	}
+	elapsed := float64(now.Sub(c.Start)) / float64(c.End.Sub(c.Start))
+	return committed < c.Budget*(elapsed+p.Slack)
+}
+
+// Allow reserves the Bid of the campaign sponsoring itemId and returns it if
+// the campaign could be exposed now. The reservation is spent by Charge on
+// the impression or given back by Release, so the concurrent requests never
+// overspend the Budget.
+func (p *Pacer) Allow(itemId int) (bid float32, ok bool) {
+	p.Lock()
+	defer p.Unlock()
+	c, found := p.byItem[itemId]
+	if !found || !p.allowed(c, p.now()) {
+		return
+	}
+	c.reserved += float64(c.Bid)
+	return c.Bid, true
+}
+
+// bidOf returns the Bid of itemId like Allow without reserving it
+func (p *Pacer) bidOf(itemId int) (bid float32, ok bool) {
+	p.Lock()
+	defer p.Unlock()
+	c, found := p.byItem[itemId]
+	if !found || !p.allowed(c, p.now()) {
+		return
+	}
+	return c.Bid, true
+}
+
+// Charge charges the Bid of the campaign sponsoring itemId, the reservation
+// of Allow is spent
+func (p *Pacer) Charge(itemId int) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	c, ok := p.byItem[itemId]
+	if !ok {
+		return fmt.Errorf("item %d not sponsored", itemId)
+	}
+	c.spent += float64(c.Bid)
+	c.release()
+	return
+}
+
+// Release gives back the reservation of Allow of itemId not exposed
+func (p *Pacer) Release(itemId int) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	c, ok := p.byItem[itemId]
+	if !ok {
+		return fmt.Errorf("item %d not sponsored", itemId)
+	}
+	c.release()
+	return
+}
+
+func (c *campaignState) release() {
+	if c.reserved -= float64(c.Bid); c.reserved < 0 {
+		c.reserved = 0
+	}
+}
+
+// Spent returns the budget spent by the campaign
+func (p *Pacer) Spent(campaignId string) float64 {
+	p.Lock()
+	defer p.Unlock()
+	if c, ok := p.campaigns[campaignId]; ok {
+		return c.spent
+	}
+	return 0
+}
+
+// SponsoredBlender is a PostRanker mixing the sponsored items allowed by Pacer
+// into the organic ranking with the blended score:
+//
+//	score' = (1-Alpha)*score + Alpha*bid/maxBid
+//
+// where maxBid is the highest Bid among the candidates. At most MaxSponsored
+// items with the highest blended scores are marked Sponsored, the others keep
+// their organic scores. The Bid of a Sponsored item is reserved by
+// Pacer.Allow, call Pacer.Charge on its served impression or Pacer.Release
+// if it is not served.
+type SponsoredBlender struct {
+	Pacer        *Pacer
+	Alpha        float32
+	MaxSponsored int
+	// MinScore is the relevance required to sponsor an item
+	MinScore float32
+	// ChargeOnRank charges the Bid when an item is ranked as Sponsored
+	// instead of on the served impression, for the tests or the surfaces
+	// serving every ranked item
+	ChargeOnRank bool
+}
+
+func NewSponsoredBlender(pacer *Pacer) *SponsoredBlender {
+	return &SponsoredBlender{
+		Pacer:        pacer,
+		Alpha:        0.3,
+		MaxSponsored: 1,
+	}
+}
+
+func (b *SponsoredBlender) PostRank(_ context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+	type candidate struct {
+		idx     int
+		blended float32
+	}
+	var (
+		candidates []candidate
+		bids       = make(map[int]float32)
+		maxBid     float32
+	)
+	for i, is := range itemScores {
+		if is.Score < b.MinScore {
+			continue
+		}
+		if bid, ok := b.Pacer.bidOf(is.ItemId); ok && bid > 0 {
+			bids[i] = bid
+			if bid > maxBid {
+				maxBid = bid
+			}
+		}
+	}
+	for i, bid := range bids {
+		candidates = append(candidates, candidate{
+			idx:     i,
+			blended: (1-b.Alpha)*itemScores[i].Score + b.Alpha*bid/maxBid,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].blended != candidates[j].blended {
+			return candidates[i].blended > candidates[j].blended
+		}
+		return candidates[i].idx < candidates[j].idx
+	})
+	var sponsored int
+	for _, c := range candidates {
+		if sponsored >= b.MaxSponsored {
+			break
+		}
+		// reserved by the concurrent requests meanwhile
+		if _, ok := b.Pacer.Allow(itemScores[c.idx].ItemId); !ok {
+			continue
+		}
+		sponsored++
+		itemScores[c.idx].Score = c.blended
+		itemScores[c.idx].Sponsored = true
+		if b.ChargeOnRank {
+			if err := b.Pacer.Charge(itemScores[c.idx].ItemId); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return itemScores, nil
+}
@@ -0,0 +1,90 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSponsored(t *testing.T) {
+	Convey("sponsored pacing and blending", t, func() {
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		now := start
+		pacer := NewPacer(
+			Campaign{Id: "a", ItemIds: []int{1, 2}, Bid: 1, Budget: 10, Start: start, End: start.Add(10 * time.Hour)},
+			Campaign{Id: "b", ItemIds: []int{2}, Bid: 2, Budget: 100, Start: start, End: start.Add(10 * time.Hour)},
+		)
+		pacer.Slack = 0
+		pacer.now = func() time.Time { return now }
+
+		Convey("even pacing", func() {
+			now = start.Add(time.Hour)
+			_, ok := pacer.Allow(1)
+			So(ok, ShouldBeTrue)
+			So(pacer.Charge(1), ShouldBeNil)
+			// 1 of 10 spent in the first 10% of the flight
+			_, ok = pacer.Allow(1)
+			So(ok, ShouldBeFalse)
+			now = start.Add(5 * time.Hour)
+			_, ok = pacer.Allow(1)
+			So(ok, ShouldBeTrue)
+
+			// item 2 is sponsored by the higher bid of b
+			bid, ok := pacer.Allow(2)
+			So(ok, ShouldBeTrue)
+			So(bid, ShouldEqual, 2)
+
+			now = start.Add(11 * time.Hour)
+			_, ok = pacer.Allow(1)
+			So(ok, ShouldBeFalse)
+			So(pacer.Charge(3), ShouldNotBeNil)
+		})
+
+		Convey("reserve on allow", func() {
+			pacer.AddCampaign(Campaign{Id: "c", ItemIds: []int{5}, Bid: 1, Budget: 1, Start: start, End: start.Add(time.Hour)})
+			now = start.Add(30 * time.Minute)
+			_, ok := pacer.Allow(5)
+			So(ok, ShouldBeTrue)
+			// the budget is reserved before the charge
+			_, ok = pacer.Allow(5)
+			So(ok, ShouldBeFalse)
+			So(pacer.Release(5), ShouldBeNil)
+			_, ok = pacer.Allow(5)
+			So(ok, ShouldBeTrue)
+			So(pacer.Charge(5), ShouldBeNil)
+			So(pacer.Spent("c"), ShouldEqual, 1)
+			So(pacer.Release(5), ShouldBeNil)
+			_, ok = pacer.Allow(5)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("blend in the post rank chain", func() {
+			now = start.Add(5 * time.Hour)
+			blender := NewSponsoredBlender(pacer)
+			blender.Alpha = 0.5
+			chain := ChainPostRankers(Blocklist(9), blender)
+			scores, err := chain.PostRank(context.Background(), 1, []ItemScore{
+				{ItemId: 1, Score: 0.6}, {ItemId: 2, Score: 0.2}, {ItemId: 3, Score: 0.9}, {ItemId: 9, Score: 1},
+			})
+			So(err, ShouldBeNil)
+			So(scores, ShouldHaveLength, 3)
+			// item 1: 0.5*0.6+0.5*1/2=0.55, item 2: 0.5*0.2+0.5*2/2=0.6
+			So(scores[1].Sponsored, ShouldBeTrue)
+			So(scores[1].Score, ShouldAlmostEqual, 0.6, 1e-6)
+			So(scores[0].Sponsored, ShouldBeFalse)
+			So(scores[0].Score, ShouldEqual, 0.6)
+			So(scores[2].Sponsored, ShouldBeFalse)
+			// charged on the served impression
+			So(pacer.Spent("b"), ShouldEqual, 0)
+			So(pacer.Charge(2), ShouldBeNil)
+			So(pacer.Spent("b"), ShouldEqual, 2)
+
+			blender.MinScore = 0.5
+			scores, err = blender.PostRank(context.Background(), 1, []ItemScore{{ItemId: 2, Score: 0.2}})
+			So(err, ShouldBeNil)
+			So(scores[0].Sponsored, ShouldBeFalse)
+		})
+	})
+}
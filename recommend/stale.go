@@ -0,0 +1,64 @@
+package recommend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// StaleWhileRevalidate serves the cache entries expired for up to it
+	// immediately while a background goroutine refreshes them, so the
+	// expiration of hot features does not add the loader latency to
+	// BatchPredict. 0 disables it, the expired entries are fetched in line.
+	StaleWhileRevalidate time.Duration
+	// StaleRefreshTimeout bounds the background refreshes, the stale entry is
+	// kept on failure
+	StaleRefreshTimeout = 10 * time.Second
+
+	// staleRefreshes are the keys being refreshed by name + "/" + key
+	staleRefreshes sync.Map
+)
+
+// detachedCtx keeps the values of the request ctx for the background
+// refreshes without its cancellation and deadline
+type detachedCtx struct {
+	context.Context
+}
+
+func (detachedCtx) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedCtx) Done() <-chan struct{}                   { return nil }
+func (detachedCtx) Err() error                              { return nil }
+
+// serveStale returns the value of key if it is expired within
+// StaleWhileRevalidate, and refreshes it in the background once at a time
+func serveStale(ctx context.Context, cache *ccache.Cache, name string, key string, duration time.Duration,
+	fetch func(ctx context.Context) (interface{}, error)) (value interface{}, ok bool) {
+	if StaleWhileRevalidate <= 0 {
+		return
+	}
+	item := cache.Get(key)
+	if item == nil || !item.Expired() || time.Since(item.Expires()) > StaleWhileRevalidate {
+		return
+	}
+	refreshKey := name + "/" + key
+	if _, loaded := staleRefreshes.LoadOrStore(refreshKey, struct{}{}); !loaded {
+		go func() {
+			defer staleRefreshes.Delete(refreshKey)
+			ctx, cancel := context.WithTimeout(detachedCtx{ctx}, StaleRefreshTimeout)
+			defer cancel()
+			start := time.Now()
+			value, err := fetch(ctx)
+			metrics.providerSeconds[name].since(start)
+			if err != nil {
+				log.Warnf("refresh stale %s %s error: %v", name, key, err)
+				return
+			}
+			cache.Set(key, value, duration)
+		}()
+	}
+	return item.Value(), true
+}
@@ -0,0 +1,60 @@
+package recommend
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	defer func(d time.Duration) { StaleWhileRevalidate = d }(StaleWhileRevalidate)
+
+	Convey("stale while revalidate", t, func() {
+		resetFeatureCache()
+		StaleWhileRevalidate = time.Hour
+		var fetches int64
+		release := make(chan struct{})
+		fetch := func(ctx context.Context) (interface{}, error) {
+			<-release
+			return Tensor{float32(atomic.AddInt64(&fetches, 1))}, nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		ItemFeatureCache.Set("1", Tensor{0}, -time.Minute)
+
+		// served stale without waiting for the loader, refreshed once
+		for i := 0; i < 3; i++ {
+			value, err := fetchCache(ctx, ItemFeatureCache, cacheItem, "1", time.Hour, fetch)
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, Tensor{0})
+		}
+		// the request is done before the refresh
+		cancel()
+		close(release)
+		So(waitFor(func() bool {
+			item := ItemFeatureCache.Get("1")
+			return !item.Expired()
+		}), ShouldBeTrue)
+		So(ItemFeatureCache.Get("1").Value(), ShouldResemble, Tensor{1})
+		So(atomic.LoadInt64(&fetches), ShouldEqual, 1)
+
+		// expired beyond StaleWhileRevalidate is fetched in line
+		ItemFeatureCache.Set("2", Tensor{0}, -2*time.Hour)
+		value, err := fetchCache(context.Background(), ItemFeatureCache, cacheItem, "2", time.Hour, fetch)
+		So(err, ShouldBeNil)
+		So(value, ShouldResemble, Tensor{2})
+	})
+}
+
+// waitFor polls cond for up to a second
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package recommend
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// StockProvider provides the stock level of an item
+type StockProvider interface {
+	GetItemStock(ctx context.Context, itemId int) (int, error)
+}
+
+// StockDemoter is a PostRanker filtering the out of stock items, and
+// multiplying the scores of the items with stock below LowStock by
+// DemoteFactor. The stock levels are cached for TTL, keep it short during
+// flash sales. Items failed to get the stock are kept as is.
+type StockDemoter struct {
+	Provider     StockProvider
+	LowStock     int
+	DemoteFactor float32
+	TTL          time.Duration
+
+	cache *ccache.Cache
+}
+
+func NewStockDemoter(provider StockProvider, lowStock int) *StockDemoter {
+	return &StockDemoter{
+		Provider:     provider,
+		LowStock:     lowStock,
+		DemoteFactor: 0.5,
+		TTL:          10 * time.Second,
+		cache:        ccache.New(ccache.Configure().MaxSize(itemFeatureCacheSize).ItemsToPrune(itemFeatureCacheSize / 100)),
+	}
+}
+
+func (d *StockDemoter) stock(ctx context.Context, itemId int) (stock int, err error) {
+	item, err := d.cache.Fetch(strconv.Itoa(itemId), d.TTL, func() (interface{}, error) {
+		return d.Provider.GetItemStock(ctx, itemId)
+	})
+	if err != nil {
+		return
+	}
+	return item.Value().(int), nil
+}
+
+// Invalidate drops the cached stock of itemIds, e.g. on a stock change event
+func (d *StockDemoter) Invalidate(itemIds ...int) {
+	for _, itemId := range itemIds {
+		d.cache.Delete(strconv.Itoa(itemId))
+	}
+}
+
+func (d *StockDemoter) PostRank(ctx context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+	result := itemScores[:0]
+	for _, is := range itemScores {
+		stock, err := d.stock(ctx, is.ItemId)
+		if err != nil {
+			log.Warnf("get item %d stock error: %v", is.ItemId, err)
+		} else if stock <= 0 {
+			continue
+		} else if stock < d.LowStock {
+			is.Score *= d.DemoteFactor
+		}
+		result = append(result, is)
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type stockMap struct {
+	stocks map[int]int
+	calls  int64
+}
+
+func (s *stockMap) GetItemStock(_ context.Context, itemId int) (int, error) {
+	atomic.AddInt64(&s.calls, 1)
+	if stock, ok := s.stocks[itemId]; ok {
+		return stock, nil
+	}
+	return 0, errors.New("stock service timeout")
+}
+
+func TestStockDemoter(t *testing.T) {
+	Convey("stock aware demotion", t, func() {
+		stocks := &stockMap{stocks: map[int]int{1: 100, 2: 3, 3: 0}}
+		demoter := NewStockDemoter(stocks, 5)
+		input := func() []ItemScore {
+			return []ItemScore{{ItemId: 1, Score: 0.5}, {ItemId: 2, Score: 0.8}, {ItemId: 3, Score: 0.9}, {ItemId: 4, Score: 0.1}}
+		}
+
+		scores, err := demoter.PostRank(context.Background(), 1, input())
+		So(err, ShouldBeNil)
+		So(scoredIds(scores), ShouldResemble, []int{1, 2, 4})
+		So(scores[0].Score, ShouldEqual, 0.5)
+		So(scores[1].Score, ShouldEqual, 0.4)
+		So(scores[2].Score, ShouldEqual, 0.1)
+		So(stocks.calls, ShouldEqual, 4)
+
+		// cached until TTL or invalidated
+		stocks.stocks[2] = 0
+		scores, _ = demoter.PostRank(context.Background(), 1, input())
+		So(scoredIds(scores), ShouldResemble, []int{1, 2, 4})
+		// failed lookups are not cached
+		So(stocks.calls, ShouldEqual, 5)
+		demoter.Invalidate(2)
+		scores, _ = demoter.PostRank(context.Background(), 1, input())
+		So(scoredIds(scores), ShouldResemble, []int{1, 4})
+
+		demoter = NewStockDemoter(stocks, 5)
+		demoter.TTL = time.Millisecond
+		scores, _ = demoter.PostRank(context.Background(), 1, input())
+		So(scoredIds(scores), ShouldResemble, []int{1, 4})
+		stocks.stocks[3] = 10
+		time.Sleep(2 * time.Millisecond)
+		scores, _ = demoter.PostRank(context.Background(), 1, input())
+		So(scoredIds(scores), ShouldResemble, []int{1, 3, 4})
+	})
+}
@@ -0,0 +1,354 @@
+package recommend
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// MiniBatchSize is the max rows of a MiniBatch sent to StreamFitter
+	MiniBatchSize = 1024
+
+	// SpillPath is the file all the mini-batches are spilled to while
+	// streaming if not empty, use ReplaySpill to read them again for
+	// the following epochs.
+	SpillPath string
+)
+
+// MiniBatch is a row-major slice of the training samples, same layout
+// as TrainSample
+type MiniBatch struct {
+	X     []float32
+	Y     []float32
+	Rows  int
+	XCols int
+	// Tasks and Labels are the labels of the multi-task samples, Labels are
+	// Rows*Tasks, see TrainSample.Tasks
+	Tasks  int
+	Labels []float32
+}
+
+// StreamFitter is implemented by the Fitters that can be trained without
+// materializing all the samples in RAM. If the Fitter passed to Train
+// implements StreamFitter, FitStream is used instead of Fit.
+type StreamFitter interface {
+	FitStream(batchCh <-chan MiniBatch, info SampleInfo) (PredictAbstract, error)
+}
+
+// GetSampleStream is the streaming version of GetSample. It blocks until the
+// first sample is assembled to figure out the SampleInfo, then the samples
+// are sent to batchCh in batches of batchSize rows.
+// errCh receives at most one error and is closed after batchCh is closed.
+func GetSampleStream(recSys RecSys, ctx context.Context, batchSize int) (
+	info SampleInfo, batchCh <-chan MiniBatch, errCh <-chan error, err error) {
+	return getSampleStream(ctx, recSys, batchSize, SpillPath, nil)
+}
+
+func getSampleStream(ctx context.Context, recSys RecSys, batchSize int, spillPath string, onDone func(info SampleInfo, rows, xCols, tasks int) error) (
+	info SampleInfo, batchCh <-chan MiniBatch, errCh <-chan error, err error) {
+	if batchSize <= 0 {
+		err = fmt.Errorf("invalid batch size: %d", batchSize)
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var drops dropCounter
+	sampleVecCh, err := startSampleAssembler(ctx, recSys, &drops)
+	if err != nil {
+		cancel()
+		return
+	}
+	// stop cancels the assembler and waits for its workers, sampleVecCh is
+	// closed after them
+	stop := func() {
+		cancel()
+		for range sampleVecCh {
+		}
+	}
+
+	first, ok := <-sampleVecCh
+	if !ok {
+		cancel()
+		err = fmt.Errorf("no sample generated")
+		return
+	}
+	if first.err != nil {
+		err = first.err
+		stop()
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		stop()
+		return
+	}
+	info = newSampleInfo(first.uWidth, first.iWidth)
+
+	var spill *spillWriter
+	if spillPath != "" {
+		if spill, err = newSpillWriter(spillPath); err != nil {
+			stop()
+			return
+		}
+	}
+
+	var (
+		bCh = make(chan MiniBatch, 4)
+		eCh = make(chan error, 1)
+	)
+	go func() {
+		var (
+			xCols = len(first.vec)
+			tasks int
+		)
+		if SparseFeatureDim > 0 {
+			// the sparse features are dense in X like TrainSample.Densify
+			xCols += SparseFeatureDim
+		}
+		if len(first.labels) != 0 {
+			tasks = 1 + len(first.labels)
+		}
+		var (
+			batch = newMiniBatch(batchSize, xCols, tasks)
+			rows  int
+			er    error
+		)
+		defer func() {
+			if spill != nil {
+				if e := spill.Close(); e != nil && er == nil {
+					er = e
+				}
+			}
+			if er == nil && onDone != nil {
+				er = onDone(info, rows, xCols, tasks)
+			}
+			if er != nil {
+				eCh <- er
+			}
+			stop()
+			close(bCh)
+			close(eCh)
+		}()
+		flush := func() {
+			if batch.Rows == 0 {
+				return
+			}
+			if spill != nil {
+				if er = spill.Write(batch); er != nil {
+					return
+				}
+			}
+			select {
+			case bCh <- batch:
+			case <-ctx.Done():
+				er = ctx.Err()
+				return
+			}
+			batch = newMiniBatch(batchSize, xCols, tasks)
+		}
+
+		for sv := first; sv != nil; sv = <-sampleVecCh {
+			if sv.err != nil {
+				er = sv.err
+				return
+			}
+			if sv.uWidth != first.uWidth {
+				er = fmt.Errorf("user feature length mismatch: %v:%v", first.uWidth, sv.uWidth)
+				return
+			}
+			if sv.iWidth != first.iWidth {
+				er = fmt.Errorf("item feature length mismatch: %v:%v", first.iWidth, sv.iWidth)
+				return
+			}
+			vec := sv.vec
+			if SparseFeatureDim > 0 {
+				vec = sv.sparse.AppendDense(vec)
+			}
+			if len(vec) != xCols {
+				er = fmt.Errorf("sample width mismatch: %v:%v", xCols, len(vec))
+				return
+			}
+			batch.X = append(batch.X, vec...)
+			batch.Y = append(batch.Y, sv.label)
+			if tasks != 0 {
+				if len(sv.labels) != tasks-1 {
+					er = fmt.Errorf("sample labels mismatch: %v:%v", tasks-1, len(sv.labels))
+					return
+				}
+				batch.Labels = append(append(batch.Labels, sv.label), sv.labels...)
+			}
+			batch.Rows++
+			rows++
+			if batch.Rows == batchSize {
+				if flush(); er != nil {
+					return
+				}
+			}
+			if rows%10000 == 0 {
+				log.Infof("streamed sample size: %d", rows)
+			}
+		}
+		if er = ctx.Err(); er != nil {
+			// the assembler stopped early
+			return
+		}
+		if flush(); er != nil {
+			return
+		}
+		if d := drops.stats(); d.Total() != 0 {
+			log.Warnf("%d samples dropped: %+v", d.Total(), d)
+		}
+	}()
+
+	return info, bCh, eCh, nil
+}
+
+func fitStream(ctx context.Context, recSys RecSys, streamFitter StreamFitter, ckpt *Checkpoint) (
+	pred PredictAbstract, info SampleInfo, err error) {
+	var (
+		batchCh <-chan MiniBatch
+		errCh   <-chan error
+	)
+	if ckpt == nil {
+		info, batchCh, errCh, err = GetSampleStream(recSys, ctx, MiniBatchSize)
+	} else if ckpt.Meta.SampleDone {
+		info = ckpt.Meta.SampleInfo
+		batchCh, errCh, err = ReplaySpill(ckpt.path(checkpointSampleFile))
+	} else {
+		// spill to the checkpoint, it is marked done after all samples streamed
+		info, batchCh, errCh, err = getSampleStream(ctx, recSys, MiniBatchSize,
+			ckpt.path(checkpointSampleFile), ckpt.sampleDone)
+	}
+	if err != nil {
+		log.Errorf("get train sample stream error: %v", err)
+		return
+	}
+	log.Infof("\nstart stream training with %d cols samples\n", info.RequestCtxRange[1])
+
+	pred, err = streamFitter.FitStream(batchCh, info)
+	// make sure the stream is drained even if FitStream returned early
+	for range batchCh {
+	}
+	if er := <-errCh; er != nil {
+		log.Errorf("get train sample stream error: %v", er)
+		return nil, info, er
+	}
+	if err != nil {
+		log.Errorf("fit stream error: %v", err)
+		return
+	}
+	return
+}
+
+func newMiniBatch(batchSize, xCols, tasks int) MiniBatch {
+	batch := MiniBatch{
+		X:     make([]float32, 0, batchSize*xCols),
+		Y:     make([]float32, 0, batchSize),
+		XCols: xCols,
+		Tasks: tasks,
+	}
+	if tasks != 0 {
+		batch.Labels = make([]float32, 0, batchSize*tasks)
+	}
+	return batch
+}
+
+// ReplaySpill reads the mini-batches spilled to SpillPath by GetSampleStream
+func ReplaySpill(path string) (batchCh <-chan MiniBatch, errCh <-chan error, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	var (
+		bCh = make(chan MiniBatch, 4)
+		eCh = make(chan error, 1)
+	)
+	go func() {
+		defer func() {
+			f.Close()
+			close(bCh)
+			close(eCh)
+		}()
+		r := bufio.NewReader(f)
+		for {
+			batch, er := readMiniBatch(r)
+			if er == io.EOF {
+				return
+			}
+			if er != nil {
+				eCh <- er
+				return
+			}
+			bCh <- batch
+		}
+	}()
+	return bCh, eCh, nil
+}
+
+type spillWriter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func newSpillWriter(path string) (sw *spillWriter, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	return &spillWriter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Write a mini-batch as: rows(int32) xCols(int32) tasks(int32) X([]float32)
+// Y([]float32) Labels([]float32)
+func (sw *spillWriter) Write(batch MiniBatch) (err error) {
+	header := [3]int32{int32(batch.Rows), int32(batch.XCols), int32(batch.Tasks)}
+	if err = binary.Write(sw.w, binary.LittleEndian, header); err != nil {
+		return
+	}
+	if err = binary.Write(sw.w, binary.LittleEndian, batch.X); err != nil {
+		return
+	}
+	if err = binary.Write(sw.w, binary.LittleEndian, batch.Y); err != nil {
+		return
+	}
+	if batch.Tasks == 0 {
+		return
+	}
+	return binary.Write(sw.w, binary.LittleEndian, batch.Labels)
+}
+
+// spillSize is the bytes of batch in the spill file
+func spillSize(batch MiniBatch) int64 {
+	return int64(12 + 4*(len(batch.X)+len(batch.Y)+len(batch.Labels)))
+}
+
+func (sw *spillWriter) Close() (err error) {
+	if err = sw.w.Flush(); err != nil {
+		sw.f.Close()
+		return
+	}
+	return sw.f.Close()
+}
+
+func readMiniBatch(r io.Reader) (batch MiniBatch, err error) {
+	var header [3]int32
+	if err = binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return
+	}
+	batch.Rows, batch.XCols, batch.Tasks = int(header[0]), int(header[1]), int(header[2])
+	batch.X = make([]float32, batch.Rows*batch.XCols)
+	batch.Y = make([]float32, batch.Rows)
+	if err = binary.Read(r, binary.LittleEndian, batch.X); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.LittleEndian, batch.Y); err != nil || batch.Tasks == 0 {
+		return
+	}
+	batch.Labels = make([]float32, batch.Rows*batch.Tasks)
+	err = binary.Read(r, binary.LittleEndian, batch.Labels)
+	return
+}
@@ -0,0 +1,107 @@
+package recommend
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countFitter is a StreamFitter counting the streamed rows
+type countFitter struct {
+	info    SampleInfo
+	rows    int
+	batches int
+	maxRows int
+	xCols   int
+}
+
+func (f *countFitter) Fit(*TrainSample) (PredictAbstract, error) {
+	panic("fit in memory")
+}
+
+func (f *countFitter) FitStream(batchCh <-chan MiniBatch, info SampleInfo) (PredictAbstract, error) {
+	f.info = info
+	for batch := range batchCh {
+		f.rows += batch.Rows
+		f.batches++
+		if batch.Rows > f.maxRows {
+			f.maxRows = batch.Rows
+		}
+		f.xCols = batch.XCols
+	}
+	return idPredictor{}, nil
+}
+
+func TestSpill(t *testing.T) {
+	Convey("spill mini-batches and replay", t, func() {
+		path := filepath.Join(t.TempDir(), "spill.bin")
+		sw, err := newSpillWriter(path)
+		So(err, ShouldBeNil)
+		batches := []MiniBatch{
+			{X: []float32{1, 2, 3, 4}, Y: []float32{0, 1}, Rows: 2, XCols: 2},
+			{X: []float32{5, 6}, Y: []float32{1}, Rows: 1, XCols: 2},
+			// multi-task
+			{X: []float32{7, 8}, Y: []float32{1}, Rows: 1, XCols: 2, Tasks: 2, Labels: []float32{1, 0}},
+		}
+		for _, b := range batches {
+			So(sw.Write(b), ShouldBeNil)
+		}
+		So(sw.Close(), ShouldBeNil)
+
+		batchCh, errCh, err := ReplaySpill(path)
+		So(err, ShouldBeNil)
+		var got []MiniBatch
+		for b := range batchCh {
+			got = append(got, b)
+		}
+		So(<-errCh, ShouldBeNil)
+		So(got, ShouldResemble, batches)
+	})
+}
+
+func TestSampleStream(t *testing.T) {
+	Convey("stream the samples in mini-batches", t, func() {
+		resetFeatureCache()
+		ctx := context.Background()
+		info, batchCh, errCh, err := GetSampleStream(idRecSys{}, ctx, 64)
+		So(err, ShouldBeNil)
+		fitter := &countFitter{}
+		_, err = fitter.FitStream(batchCh, info)
+		So(err, ShouldBeNil)
+		So(<-errCh, ShouldBeNil)
+		So(fitter.rows, ShouldEqual, 1000)
+		So(fitter.maxRows, ShouldEqual, 64)
+		So(fitter.xCols, ShouldEqual, info.RequestCtxRange[1])
+
+		_, _, _, err = GetSampleStream(idRecSys{}, ctx, 0)
+		So(err, ShouldNotBeNil)
+
+		Convey("spill failed", func() {
+			_, _, _, err := getSampleStream(ctx, idRecSys{}, 64, filepath.Join(t.TempDir(), "none", "spill.bin"), nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("train with the stream fitter and spill", func() {
+			defer func(size int, path string) { MiniBatchSize, SpillPath = size, path }(MiniBatchSize, SpillPath)
+			MiniBatchSize = 100
+			SpillPath = filepath.Join(t.TempDir(), "spill.bin")
+			fitter := &countFitter{}
+			result, err := TrainWithResult(ctx, idRecSys{}, fitter)
+			So(err, ShouldBeNil)
+			So(fitter.rows, ShouldEqual, 1000)
+			So(fitter.batches, ShouldEqual, 10)
+			So(result.SampleInfo, ShouldResemble, fitter.info)
+
+			batchCh, errCh, err := ReplaySpill(SpillPath)
+			So(err, ShouldBeNil)
+			var rows int
+			for batch := range batchCh {
+				rows += batch.Rows
+			}
+			So(<-errCh, ShouldBeNil)
+			So(rows, ShouldEqual, 1000)
+		})
+	})
+}
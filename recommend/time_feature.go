@@ -0,0 +1,49 @@
+package recommend
+
+import (
+	"math"
+	"time"
+)
+
+// CyclicalTimeWidth is the width of CyclicalTimeEncoding
+const CyclicalTimeWidth = 6
+
+var (
+	// CyclicalTimeFeatures appends CyclicalTimeEncoding of Sample.Timestamp
+	// after the CtxFeatureWidth context features in the RequestCtxRange, the
+	// training samples should have the Timestamp set. Must be the same in
+	// Train and predict.
+	CyclicalTimeFeatures bool
+	// CyclicalTimeLocation is the time zone of the hour and the day encoded
+	CyclicalTimeLocation = time.UTC
+)
+
+// CyclicalTimeEncoding returns the sin and cos of the hour of day, the day
+// of week and the day of month of the unix timestamp ts in seconds, so 23:00
+// is as close to 00:00 as 01:00 is
+func CyclicalTimeEncoding(ts int64, loc *time.Location) Tensor {
+	t := time.Unix(ts, 0).In(loc)
+	var (
+		hour     = (float64(t.Hour()) + float64(t.Minute())/60) / 24
+		weekday  = float64(t.Weekday()) / 7
+		monthDay = float64(t.Day()-1) / float64(daysIn(t))
+	)
+	enc := make(Tensor, 0, CyclicalTimeWidth)
+	for _, v := range []float64{hour, weekday, monthDay} {
+		enc = append(enc, float32(math.Sin(2*math.Pi*v)), float32(math.Cos(2*math.Pi*v)))
+	}
+	return enc
+}
+
+// daysIn returns the days of the month of t
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// ctxFeatureWidth is the width of the RequestCtxRange
+func ctxFeatureWidth() int {
+	if CyclicalTimeFeatures {
+		return CtxFeatureWidth + CyclicalTimeWidth
+	}
+	return CtxFeatureWidth
+}
@@ -0,0 +1,47 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCyclicalTimeEncoding(t *testing.T) {
+	Convey("cyclical time encoding", t, func() {
+		// Thursday 1970-01-01 00:00 UTC
+		enc := CyclicalTimeEncoding(0, time.UTC)
+		So(enc, ShouldHaveLength, CyclicalTimeWidth)
+		So(enc[0], ShouldEqual, 0)
+		So(enc[1], ShouldEqual, 1)
+		So(enc[2], ShouldAlmostEqual, math.Sin(2*math.Pi*4/7), 1e-6)
+		So(enc[4], ShouldEqual, 0)
+		So(enc[5], ShouldEqual, 1)
+
+		// 23:00 and 01:00 are equally close to 00:00
+		near := func(a, b Tensor) float64 {
+			return math.Hypot(float64(a[0]-b[0]), float64(a[1]-b[1]))
+		}
+		So(near(CyclicalTimeEncoding(-3600, time.UTC), enc), ShouldAlmostEqual, near(CyclicalTimeEncoding(3600, time.UTC), enc), 1e-6)
+
+		// 18:00 UTC is 02:00 of the next day in UTC+8
+		loc := time.FixedZone("UTC+8", 8*3600)
+		local := CyclicalTimeEncoding(18*3600, loc)
+		So(local[0], ShouldAlmostEqual, math.Sin(2*math.Pi*2/24), 1e-6)
+		So(local[4], ShouldAlmostEqual, math.Sin(2*math.Pi/31), 1e-6)
+	})
+
+	Convey("cyclical time in the context features", t, func() {
+		defer func(w int, c bool) { CtxFeatureWidth, CyclicalTimeFeatures = w, c }(CtxFeatureWidth, CyclicalTimeFeatures)
+		resetFeatureCache()
+		CtxFeatureWidth, CyclicalTimeFeatures = 2, true
+		vec, uWidth, iWidth, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache,
+			ctxPredictor{}, &Sample{UserId: 1, ItemId: 2, Timestamp: 6 * 3600})
+		So(err, ShouldBeNil)
+		info := newSampleInfo(uWidth, iWidth)
+		So(info.RequestCtxRange[1]-info.RequestCtxRange[0], ShouldEqual, 2+CyclicalTimeWidth)
+		So(vec[info.RequestCtxRange[0]:], ShouldResemble, append([]float32{6, 1}, CyclicalTimeEncoding(6*3600, time.UTC)...))
+	})
+}
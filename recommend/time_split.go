@@ -0,0 +1,59 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const timeSplitKey ctxKey = "timeSplit"
+
+// WithTimeSplit returns the ctx of the split time, the samples at or after
+// it assembled with ctx see the user behaviors strictly before it only
+func WithTimeSplit(ctx context.Context, split int64) context.Context {
+	return context.WithValue(ctx, timeSplitKey, split)
+}
+
+// behaviorMaxTs returns the maxTs of the user behaviors of a sample at ts,
+// strictly below the time split of ctx if any
+func behaviorMaxTs(ctx context.Context, ts int64) int64 {
+	if split, ok := ctx.Value(timeSplitKey).(int64); ok && ts >= split {
+		return split - 1
+	}
+	return ts
+}
+
+// TimeSplit assembles the samples of recSys in a single pass and splits
+// them at split: the samples before it are to train on and the others to
+// evaluate. The user behaviors of the evaluation samples are limited to
+// before split too, so the evaluation never travels in time. The item
+// embedding is trained on the whole ItemSeqGenerator still.
+func TimeSplit(ctx context.Context, recSys RecSys, split int64) (train, test *TrainSample, err error) {
+	if IsEdgeProfile() {
+		return nil, nil, ErrEdgeProfile
+	}
+	ctx = WithTimeSplit(WithStage(ctx, TrainStage), split)
+	if err = preTrain(ctx, recSys, nil); err != nil {
+		return
+	}
+	sample, err := GetSample(recSys, ctx)
+	if err != nil {
+		log.Errorf("get time split sample error: %v", err)
+		return
+	}
+	if len(sample.Keys) != sample.Rows {
+		return nil, nil, fmt.Errorf("sample has no keys to split")
+	}
+	var before, after []int
+	for r, key := range sample.Keys {
+		if key.Timestamp < split {
+			before = append(before, r)
+		} else {
+			after = append(after, r)
+		}
+	}
+	train, test = sample.subset(before), sample.subset(after)
+	train.Dropped = sample.Dropped
+	return
+}
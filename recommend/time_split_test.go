@@ -0,0 +1,61 @@
+package recommend
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// splitRecSys generates the samples of the timestamps [0, 100) and records
+// the maxTs of the user behaviors
+type splitRecSys struct {
+	idPredictor
+	mu    sync.Mutex
+	maxTs []int64
+}
+
+func (r *splitRecSys) SampleGenerator(context.Context) (<-chan Sample, error) {
+	ch := make(chan Sample)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 100; i++ {
+			ch <- Sample{UserId: i, ItemId: 1, Timestamp: int64(i)}
+		}
+	}()
+	return ch, nil
+}
+
+func (r *splitRecSys) GetUserBehavior(_ context.Context, _ int, _, _, maxTs int64) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxTs = append(r.maxTs, maxTs)
+	return []int{1}, nil
+}
+
+func TestTimeSplit(t *testing.T) {
+	defer itemEmbeddingMap.store(itemEmbeddingMap.load())
+
+	Convey("split at a timestamp", t, func() {
+		resetFeatureCache()
+		itemEmbeddingMap.store(word2vec.EmbeddingMap32{"1": make([]float32, ItemEmbDim)})
+		recSys := &splitRecSys{}
+		train, test, err := TimeSplit(context.Background(), recSys, 60)
+		So(err, ShouldBeNil)
+		So(train.Rows, ShouldEqual, 60)
+		So(test.Rows, ShouldEqual, 40)
+		for _, key := range train.Keys {
+			So(key.Timestamp, ShouldBeLessThan, 60)
+		}
+		for _, key := range test.Keys {
+			So(key.Timestamp, ShouldBeGreaterThanOrEqualTo, 60)
+		}
+		So(recSys.maxTs, ShouldHaveLength, 100)
+		for _, ts := range recSys.maxTs {
+			So(ts, ShouldBeLessThan, 60)
+		}
+		So(behaviorMaxTs(context.Background(), 80), ShouldEqual, 80)
+	})
+}
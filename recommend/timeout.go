@@ -0,0 +1,121 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+)
+
+const itemFetchKey ctxKey = "itemFetch"
+
+var (
+	// ItemFetchTimeout bounds the item feature fetches of BatchPredict if > 0.
+	// The items missing in ItemFeatureCache are fetched concurrently, the ones
+	// not fetched within ItemFetchTimeout are predicted with DefaultItemFeature,
+	// or the zero vector if it is nil, while their fetches keep running to fill
+	// the cache. A timeout of the first item fails the batch if
+	// DefaultItemFeature is nil.
+	ItemFetchTimeout time.Duration
+
+	ErrFetchTimeout = errors.New("item feature fetch timeout")
+)
+
+// fetchItemFeature fetches the item feature of sampleKey through cache
+func fetchItemFeature(ctx context.Context, cache *ccache.Cache, featureProvider BasicFeatureProvider,
+	sampleKey *Sample) (feature Tensor, err error) {
+	value, err := fetchCache(ctx, cache, cacheItem, strconv.Itoa(sampleKey.ItemId), time.Hour*24, func(ctx context.Context) (ci interface{}, err error) {
+		ctx, span := startSpan(ctx, "GetItemFeature")
+		defer func() { endSpan(span, err) }()
+		var feature Tensor
+		if feature, err = bulkOrFetch(ctx, cacheItem, sampleKey.ItemId, func(ctx context.Context) (Tensor, error) {
+			return featureProvider.GetItemFeature(ctx, sampleKey.ItemId)
+		}); err != nil {
+			err = newSampleError(sampleKey, ErrMissingItem, err)
+			return
+		}
+		observeFeature(ctx, featureProvider, cacheItem, sampleKey.ItemId, feature)
+		return feature, nil
+	})
+	if err != nil {
+		return
+	}
+	return value.(Tensor), nil
+}
+
+type itemFetch struct {
+	done    chan struct{}
+	feature Tensor
+	err     error
+}
+
+// itemFetches are the item feature fetches of a batch sharing the deadline
+type itemFetches struct {
+	deadline time.Time
+	fetches  map[int]*itemFetch
+}
+
+func itemFetchesOf(ctx context.Context) *itemFetches {
+	fetches, _ := ctx.Value(itemFetchKey).(*itemFetches)
+	return fetches
+}
+
+// prefetchItems starts fetching the items of sampleKeys missing in cache
+func prefetchItems(ctx context.Context, cache *ccache.Cache, featureProvider BasicFeatureProvider,
+	sampleKeys []Sample) *itemFetches {
+	f := &itemFetches{
+		deadline: time.Now().Add(ItemFetchTimeout),
+		fetches:  make(map[int]*itemFetch),
+	}
+	for i := range sampleKeys {
+		sampleKey := &sampleKeys[i]
+		if _, ok := f.fetches[sampleKey.ItemId]; ok {
+			continue
+		}
+		if _, ok := inlineItemOf(ctx, sampleKey.ItemId); ok {
+			continue
+		}
+		if SharedItemFeatures != nil {
+			if feature, _ := SharedItemFeatures.Get(sampleKey.ItemId); feature != nil {
+				continue
+			}
+		}
+		if item := cache.Get(strconv.Itoa(sampleKey.ItemId)); item != nil && !item.Expired() {
+			continue
+		}
+		fetch := &itemFetch{done: make(chan struct{})}
+		f.fetches[sampleKey.ItemId] = fetch
+		go func() {
+			defer close(fetch.done)
+			fetch.feature, fetch.err = fetchItemFeature(ctx, cache, featureProvider, sampleKey)
+		}()
+	}
+	return f
+}
+
+// wait returns the item feature of sampleKey fetched before the deadline
+func (f *itemFetches) wait(ctx context.Context, cache *ccache.Cache, featureProvider BasicFeatureProvider,
+	sampleKey *Sample) (Tensor, error) {
+	fetch, ok := f.fetches[sampleKey.ItemId]
+	if !ok {
+		return fetchItemFeature(ctx, cache, featureProvider, sampleKey)
+	}
+	// prefer the fetched one to the expired timer
+	select {
+	case <-fetch.done:
+		return fetch.feature, fetch.err
+	default:
+	}
+	timer := time.NewTimer(time.Until(f.deadline))
+	defer timer.Stop()
+	select {
+	case <-fetch.done:
+		return fetch.feature, fetch.err
+	case <-timer.C:
+		return nil, newSampleError(sampleKey, ErrMissingItem, ErrFetchTimeout)
+	case <-ctx.Done():
+		return nil, newSampleError(sampleKey, ErrMissingItem, ctx.Err())
+	}
+}
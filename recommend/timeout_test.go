@@ -0,0 +1,61 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// hangPredictor fetches the item features of ids >= 10 slowly
+type hangPredictor struct {
+	idPredictor
+}
+
+func (hangPredictor) GetItemFeature(_ context.Context, itemId int) (Tensor, error) {
+	if itemId >= 10 {
+		time.Sleep(200 * time.Millisecond)
+	}
+	return Tensor{float32(itemId)}, nil
+}
+
+func TestItemFetchTimeout(t *testing.T) {
+	defer func(timeout time.Duration, def []float32) {
+		ItemFetchTimeout, DefaultItemFeature = timeout, def
+	}(ItemFetchTimeout, DefaultItemFeature)
+	ItemFetchTimeout = 30 * time.Millisecond
+
+	Convey("slow items fall back while the batch proceeds", t, func() {
+		resetFeatureCache()
+		start := time.Now()
+		scores, err := Rank(context.Background(), hangPredictor{}, 1, []int{1, 11, 2, 12})
+		So(time.Since(start), ShouldBeLessThan, 150*time.Millisecond)
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, []ItemScore{
+			{ItemId: 1, Score: 1}, {ItemId: 11, Score: 0}, {ItemId: 2, Score: 2}, {ItemId: 12, Score: 0},
+		})
+
+		DefaultItemFeature = []float32{42}
+		scores, err = Rank(context.Background(), hangPredictor{}, 1, []int{1, 13})
+		So(err, ShouldBeNil)
+		So(scores[1].Score, ShouldEqual, 42)
+
+		// the fetches in the background fill the cache
+		time.Sleep(250 * time.Millisecond)
+		scores, err = Rank(context.Background(), hangPredictor{}, 1, []int{1, 11, 13})
+		So(err, ShouldBeNil)
+		So(scoredIds(scores), ShouldResemble, []int{1, 11, 13})
+		So(scores[1].Score, ShouldEqual, 11)
+		So(scores[2].Score, ShouldEqual, 13)
+	})
+
+	Convey("timeout of the first item without default fails the batch", t, func() {
+		resetFeatureCache()
+		DefaultItemFeature = nil
+		_, err := Rank(context.Background(), hangPredictor{}, 1, []int{14, 1})
+		So(errors.Is(err, ErrFetchTimeout), ShouldBeTrue)
+		So(errors.Is(err, ErrProvider), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,127 @@
+package recommend
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorgonia.org/tensor"
+)
+
+// RankChunkSize is the candidates predicted in a batch by RankTopK
+var RankChunkSize = 1024
+
+// RankTopK scores itemIds like Rank in chunks of RankChunkSize and keeps
+// the top k of them only in a heap, for the pre-rank of a lot of candidates
+// where the memory of all the scores is wasted. The result is in the score
+// desc order. The seen items are filtered like Rank, but the exploration,
+// the PostRanker and the PostProcessors are not applied, they are for the
+// final stage.
+func RankTopK(ctx context.Context, recSys Predictor, userId int, itemIds []int, k int) (itemScores []ItemScore, err error) {
+	ctx, span := startSpan(ctx, "RankTopK")
+	span.SetAttribute("user.id", userId)
+	span.SetAttribute("items", len(itemIds))
+	defer func() { endSpan(span, err) }()
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid k %d", k)
+	}
+	if ctx, recSys, err = servingModel(ctx, recSys); err != nil {
+		return
+	}
+	if itemIds, err = filterSeen(ctx, recSys, userId, itemIds); err != nil {
+		return
+	}
+	if len(itemIds) == 0 {
+		return []ItemScore{}, nil
+	}
+	chunkSize := RankChunkSize
+	if chunkSize <= 0 {
+		chunkSize = len(itemIds)
+	}
+
+	var (
+		top   = make(scoreHeap, 0, k)
+		chunk []ItemScore
+		now   = time.Now().Unix()
+	)
+	for start := 0; start < len(itemIds); start += chunkSize {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		end := start + chunkSize
+		if end > len(itemIds) {
+			end = len(itemIds)
+		}
+		if chunk, err = scoreChunk(ctx, recSys, userId, itemIds[start:end], now); err != nil {
+			return
+		}
+		for _, is := range chunk {
+			if len(top) < k {
+				heap.Push(&top, is)
+			} else if is.Score > top[0].Score {
+				top[0] = is
+				heap.Fix(&top, 0)
+			}
+		}
+	}
+	itemScores = []ItemScore(top)
+	sort.SliceStable(itemScores, func(i, j int) bool { return itemScores[i].Score > itemScores[j].Score })
+	return
+}
+
+// scoreChunk returns the scores of itemIds by the ItemScorer or
+// BatchPredict, the task scores are filled
+func scoreChunk(ctx context.Context, recSys Predictor, userId int, itemIds []int, ts int64) (itemScores []ItemScore, err error) {
+	itemScores = make([]ItemScore, len(itemIds))
+	if scorer, ok := recSys.(ItemScorer); ok {
+		var scores []float32
+		if scores, err = scorer.ScoreItems(ctx, userId, itemIds); err != nil {
+			logOf(ctx).Errorf("score items error: %v", err)
+			return nil, err
+		}
+		if len(scores) != len(itemIds) {
+			err = fmt.Errorf("item scores not match: %v:%v", len(scores), len(itemIds))
+			logOf(ctx).Errorf("score items error: %v", err)
+			return nil, err
+		}
+		for i, itemId := range itemIds {
+			itemScores[i] = ItemScore{ItemId: itemId, Score: scores[i]}
+		}
+		return
+	}
+	sampleKeys := make([]Sample, len(itemIds))
+	for i, itemId := range itemIds {
+		sampleKeys[i] = Sample{UserId: userId, ItemId: itemId, Timestamp: ts}
+	}
+	var y tensor.Tensor
+	if y, err = BatchPredict(ctx, recSys, sampleKeys); err != nil {
+		return nil, err
+	}
+	for i, itemId := range itemIds {
+		var score interface{}
+		if score, err = y.At(i, 0); err != nil {
+			return nil, err
+		}
+		itemScores[i] = ItemScore{ItemId: itemId, Score: score.(float32)}
+	}
+	if err = fillTaskScores(y, itemScores); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// scoreHeap is the min heap of the scores
+type scoreHeap []ItemScore
+
+func (h scoreHeap) Len() int            { return len(h) }
+func (h scoreHeap) Less(i, j int) bool  { return h[i].Score < h[j].Score }
+func (h scoreHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scoreHeap) Push(x interface{}) { *h = append(*h, x.(ItemScore)) }
+func (h *scoreHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,53 @@
+package recommend
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRankTopK(t *testing.T) {
+	Convey("top k of the chunked scores", t, func() {
+		resetFeatureCache()
+		defer func(size int) { RankChunkSize = size }(RankChunkSize)
+		RankChunkSize = 7
+		itemIds := rand.New(rand.NewSource(1)).Perm(100)
+
+		itemScores, err := RankTopK(context.Background(), idPredictor{}, 1, itemIds, 5)
+		So(err, ShouldBeNil)
+		So(scoredIds(itemScores), ShouldResemble, []int{99, 98, 97, 96, 95})
+		So(itemScores[0].Score, ShouldEqual, 99)
+
+		// the same as the top of Rank
+		all, err := Rank(context.Background(), idPredictor{}, 1, itemIds)
+		So(err, ShouldBeNil)
+		So(topItemScores(all, 5), ShouldResemble, itemScores)
+
+		itemScores, err = RankTopK(context.Background(), idPredictor{}, 1, itemIds[:3], 5)
+		So(err, ShouldBeNil)
+		So(itemScores, ShouldHaveLength, 3)
+
+		_, err = RankTopK(context.Background(), idPredictor{}, 1, itemIds, 0)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("scores of the ItemScorer not matching the items", t, func() {
+		_, err := RankTopK(context.Background(), shortScorer{}, 1, []int{1, 2, 3}, 2)
+		So(err, ShouldNotBeNil)
+		_, err = Rank(context.Background(), shortScorer{}, 1, []int{1, 2, 3})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+// shortScorer is an ItemScorer dropping the last score
+type shortScorer struct{ idPredictor }
+
+func (shortScorer) ScoreItems(_ context.Context, _ int, itemIds []int) ([]float32, error) {
+	scores := make([]float32, len(itemIds)-1)
+	for i := range scores {
+		scores[i] = float32(itemIds[i])
+	}
+	return scores, nil
+}
@@ -0,0 +1,62 @@
+package recommend
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracing creates the spans of the rank path if not nil:
+//
+//	Rank -> BatchPredict -> GetSampleVector -> GetUserFeature/GetItemFeature/GetUserBehavior
+//	                     -> Predict
+//
+// The provider spans are only created on cache miss, so slow feature providers
+// and cold caches show up in the traces. Adapt an OpenTelemetry tracer with:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string) (context.Context, recommend.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+var Tracing Tracer
+
+// Tracer starts a Span as the child of the span in ctx
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// TraceExtractor is optionally implemented by the Tracer to continue the
+// trace of the incoming http request, e.g. from the W3C traceparent header.
+type TraceExtractor interface {
+	Extract(ctx context.Context, header http.Header) context.Context
+}
+
+type Span interface {
+	// SetAttribute value is one of bool, int, float64 and string
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
+
+func startSpan(ctx context.Context, name string) (context.Context, Span) {
+	// the training path is not traced to avoid a span for every sample
+	if Tracing == nil || inStage(ctx, TrainStage) {
+		return ctx, noopSpan{}
+	}
+	return Tracing.Start(ctx, name)
+}
+
+// endSpan records err if not nil and ends span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
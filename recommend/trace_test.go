@@ -0,0 +1,102 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type spanParentKey struct{}
+
+type recordedSpan struct {
+	name, parent string
+	attrs        map[string]interface{}
+	err          error
+	ended        bool
+}
+
+type recordTracer struct {
+	sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanParentKey{}).(string)
+	s := &recordedSpan{name: name, parent: parent, attrs: make(map[string]interface{})}
+	t.Lock()
+	t.spans = append(t.spans, s)
+	t.Unlock()
+	return context.WithValue(ctx, spanParentKey{}, name), s
+}
+
+func (t *recordTracer) names() (names []string) {
+	for _, s := range t.spans {
+		names = append(names, s.parent+">"+s.name)
+	}
+	return
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *recordedSpan) RecordError(err error)                      { s.err = err }
+func (s *recordedSpan) End()                                       { s.ended = true }
+
+type failItemPredictor struct {
+	idPredictor
+}
+
+func (failItemPredictor) GetItemFeature(context.Context, int) (Tensor, error) {
+	return nil, errors.New("item feature unavailable")
+}
+
+func TestTracing(t *testing.T) {
+	Convey("rank path spans", t, func() {
+		tracer := &recordTracer{}
+		Tracing = tracer
+		defer func() { Tracing = nil }()
+		resetFeatureCache()
+		ctx := context.WithValue(context.Background(), spanParentKey{}, "http")
+
+		_, err := Rank(ctx, idPredictor{}, 1, []int{7})
+		So(err, ShouldBeNil)
+		So(tracer.names(), ShouldResemble, []string{
+			"http>Rank",
+			"Rank>BatchPredict",
+			"BatchPredict>GetSampleVector",
+			"GetSampleVector>GetUserFeature",
+			"GetSampleVector>GetItemFeature",
+			"BatchPredict>Predict",
+		})
+		for _, s := range tracer.spans {
+			So(s.ended, ShouldBeTrue)
+		}
+		So(tracer.spans[2].attrs["item.id"], ShouldEqual, 7)
+
+		Convey("warm cache skips the provider spans", func() {
+			tracer.spans = nil
+			_, err := Rank(ctx, idPredictor{}, 1, []int{7})
+			So(err, ShouldBeNil)
+			So(tracer.names(), ShouldHaveLength, 4)
+		})
+
+		Convey("provider error recorded", func() {
+			tracer.spans = nil
+			_, err := Rank(ctx, failItemPredictor{}, 1, []int{8})
+			So(err, ShouldNotBeNil)
+			// user feature is cached
+			So(tracer.spans[3].name, ShouldEqual, "GetItemFeature")
+			So(tracer.spans[3].err, ShouldNotBeNil)
+			So(tracer.spans[0].err, ShouldNotBeNil)
+		})
+
+		Convey("training not traced", func() {
+			tracer.spans = nil
+			trainCtx := WithStage(ctx, TrainStage)
+			_, _, _, err := GetSampleVector(trainCtx, UserFeatureCache, ItemFeatureCache, idPredictor{}, &Sample{UserId: 2, ItemId: 9})
+			So(err, ShouldBeNil)
+			So(tracer.spans, ShouldBeEmpty)
+		})
+	})
+}
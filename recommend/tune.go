@@ -0,0 +1,204 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// TuneValidationRatio is the ratio of the samples held out to score the
+	// trials of Tune
+	TuneValidationRatio = 0.2
+	// TuneSeed is the seed to sample the trials if the grid is larger
+	TuneSeed int64 = 42
+)
+
+// TrialParams is the hyperparameters of a trial, e.g. {"hidden": 64,
+// "learnRate": 0.01}
+type TrialParams map[string]interface{}
+
+// SearchSpace is the candidate values of every hyperparameter, Fitter
+// builds the Fitter of the params of a trial. The params are of the Fitter
+// only, the samples are assembled once for all the trials so the sample
+// layout, e.g. the ItemEmbDim of the item embedding, is not tunable.
+type SearchSpace struct {
+	Params map[string][]interface{}
+	Fitter func(params TrialParams) (Fitter, error)
+}
+
+// Trial is the result of a configuration, Score is the higher the better
+// AUC or negative RMSE by LabelObjective
+type Trial struct {
+	Id       int          `json:"id"`
+	Params   TrialParams  `json:"params"`
+	Eval     *EvalMetrics `json:"eval,omitempty"`
+	Score    float32      `json:"score"`
+	Duration float64      `json:"duration"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// TuneReport is the trials run by Tune, Best is the index of the best one
+type TuneReport struct {
+	SampleCount    int     `json:"sampleCount"`
+	SampleDuration float64 `json:"sampleDuration"`
+	Trials         []Trial `json:"trials"`
+	Best           int     `json:"best"`
+}
+
+// Tune fits the trials of space on the samples of a single GetSample pass,
+// scores them on the TuneValidationRatio held out and returns the best
+// model. The whole grid is tried if it has at most trials configurations,
+// or else trials of them sampled by TuneSeed. The best model is fitted on
+// the training split only, its Eval is on the validation split.
+func Tune(ctx context.Context, recSys RecSys, space SearchSpace, trials int) (best *TrainResult, report *TuneReport, err error) {
+	if IsEdgeProfile() {
+		return nil, nil, ErrEdgeProfile
+	}
+	if space.Fitter == nil || trials <= 0 {
+		return nil, nil, fmt.Errorf("empty search space")
+	}
+	ctx = WithStage(ctx, TrainStage)
+	setTrainSeed(ctx, nil)
+	if err = preTrain(ctx, recSys, nil); err != nil {
+		return
+	}
+
+	start := time.Now()
+	sample, err := GetSample(recSys, ctx)
+	if err != nil {
+		log.Errorf("get tune sample error: %v", err)
+		return
+	}
+	sample.Densify()
+	report = &TuneReport{
+		SampleCount:    sample.Rows,
+		SampleDuration: time.Since(start).Seconds(),
+		Best:           -1,
+	}
+	trainSample, validSample := splitValidation(sample, int(float64(sample.Rows)*TuneValidationRatio))
+	if validSample.Rows == 0 {
+		return nil, report, fmt.Errorf("too few samples to tune: %d", sample.Rows)
+	}
+
+	var bestPred PredictAbstract
+	for i, params := range searchGrid(space.Params, trials, TuneSeed) {
+		if err = ctx.Err(); err != nil {
+			return nil, report, err
+		}
+		var (
+			trial      = Trial{Id: i, Params: params}
+			trialStart = time.Now()
+			pred       PredictAbstract
+			trialErr   error
+		)
+		if pred, trialErr = fitTrial(ctx, space, params, trainSample); trialErr == nil {
+			trial.Eval, trialErr = Evaluate(pred, validSample)
+		}
+		trial.Duration = time.Since(trialStart).Seconds()
+		if trialErr != nil {
+			trial.Error = trialErr.Error()
+			log.Warnf("tune trial %d %v error: %v", i, params, trialErr)
+		} else {
+			trial.Score = trial.Eval.score()
+			log.Infof("tune trial %d %v score %v", i, params, trial.Score)
+			if report.Best < 0 || trial.Score > report.Trials[report.Best].Score {
+				report.Best, bestPred = len(report.Trials), pred
+			}
+		}
+		report.Trials = append(report.Trials, trial)
+	}
+	if bestPred == nil {
+		return nil, report, fmt.Errorf("all %d trials failed", len(report.Trials))
+	}
+
+	schema := featureSchemaOf(recSys)
+	best = &TrainResult{
+		Fitted:      bestPred,
+		Schema:      schema,
+		SampleInfo:  sample.Info,
+		SampleCount: sample.Rows,
+		Eval:        report.Trials[report.Best].Eval,
+		Model: &modelImpl{
+			UserFeaturer:    recSys,
+			ItemFeaturer:    recSys,
+			PredictAbstract: bestPred,
+			schema:          schema,
+		},
+	}
+	return best, report, nil
+}
+
+// fitTrial fits the Fitter of params on sample
+func fitTrial(ctx context.Context, space SearchSpace, params TrialParams, sample *TrainSample) (pred PredictAbstract, err error) {
+	fitter, err := space.Fitter(params)
+	if err != nil {
+		return
+	}
+	if err = setTrainLoss(fitter); err != nil {
+		return
+	}
+	setTrainSeed(ctx, fitter)
+	return fitSample(ctx, fitter, sample)
+}
+
+// searchGrid returns the params of every configuration of params if at
+// most n, or else n of them sampled by seed
+func searchGrid(params map[string][]interface{}, n int, seed int64) (grid []TrialParams) {
+	names := make([]string, 0, len(params))
+	// size is capped at n+1, the product of a large space overflows
+	size := 1
+	for name, values := range params {
+		if len(values) == 0 {
+			continue
+		}
+		names = append(names, name)
+		if size <= n {
+			size *= len(values)
+		}
+	}
+	sort.Strings(names)
+
+	// the configuration of the digits, one index of the values of every name
+	config := func(digits []int) TrialParams {
+		p := make(TrialParams, len(names))
+		for i, name := range names {
+			p[name] = params[name][digits[i]]
+		}
+		return p
+	}
+	digits := make([]int, len(names))
+	if size <= n {
+		// every configuration by counting the mixed radix digits
+		for k := 0; k < size; k++ {
+			grid = append(grid, config(digits))
+			for i, name := range names {
+				if digits[i]++; digits[i] < len(params[name]) {
+					break
+				}
+				digits[i] = 0
+			}
+		}
+		return
+	}
+	var (
+		rnd  = rand.New(rand.NewSource(seed))
+		seen = make(map[string]bool, n)
+	)
+	for len(grid) < n {
+		for i, name := range names {
+			digits[i] = rnd.Intn(len(params[name]))
+		}
+		key := fmt.Sprint(digits)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		grid = append(grid, config(digits))
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorgonia.org/tensor"
+)
+
+// thresholdPredictor scores 1 if the item id is at least the threshold
+type thresholdPredictor float32
+
+func (t thresholdPredictor) Predict(X tensor.Tensor) tensor.Tensor {
+	y := idPredictor{}.Predict(X).Data().([]float32)
+	for i, v := range y {
+		if v >= float32(t) {
+			y[i] = 1
+		} else {
+			y[i] = 0
+		}
+	}
+	return tensor.New(tensor.WithShape(len(y), 1), tensor.WithBacking(y))
+}
+
+type thresholdFitter struct {
+	threshold float32
+	fits      *int
+}
+
+func (f thresholdFitter) Fit(*TrainSample) (PredictAbstract, error) {
+	*f.fits++
+	return thresholdPredictor(f.threshold), nil
+}
+
+func TestTune(t *testing.T) {
+	Convey("tune the threshold", t, func() {
+		resetFeatureCache()
+		var fits int
+		space := SearchSpace{
+			Params: map[string][]interface{}{
+				"threshold": {10, 30, 50, 70, -1},
+				"unused":    {"a", "b"},
+			},
+			Fitter: func(p TrialParams) (Fitter, error) {
+				th := p["threshold"].(int)
+				if th < 0 {
+					return nil, fmt.Errorf("bad threshold %d", th)
+				}
+				return thresholdFitter{threshold: float32(th), fits: &fits}, nil
+			},
+		}
+
+		best, report, err := Tune(context.Background(), idRecSys{}, space, 100)
+		So(err, ShouldBeNil)
+		So(report.SampleCount, ShouldEqual, 1000)
+		So(report.Trials, ShouldHaveLength, 10)
+		So(fits, ShouldEqual, 8)
+		So(report.Trials[report.Best].Params["threshold"], ShouldEqual, 50)
+		So(best.Eval.AUC, ShouldEqual, 1)
+		So(best.Model, ShouldNotBeNil)
+		var failed int
+		for _, trial := range report.Trials {
+			if trial.Error != "" {
+				failed++
+			}
+		}
+		So(failed, ShouldEqual, 2)
+
+		Convey("sampled trials", func() {
+			_, report, err := Tune(context.Background(), idRecSys{}, space, 3)
+			So(err, ShouldBeNil)
+			So(report.Trials, ShouldHaveLength, 3)
+		})
+	})
+
+	Convey("search grid", t, func() {
+		grid := searchGrid(map[string][]interface{}{"a": {1, 2}, "b": {"x", "y", "z"}, "c": nil}, 10, 1)
+		So(grid, ShouldHaveLength, 6)
+		seen := make(map[string]bool)
+		for _, p := range grid {
+			seen[fmt.Sprint(p["a"], p["b"])] = true
+		}
+		So(seen, ShouldHaveLength, 6)
+		So(searchGrid(map[string][]interface{}{"a": {1, 2, 3}}, 2, 1), ShouldHaveLength, 2)
+
+		// a space too large to enumerate
+		large := make(map[string][]interface{})
+		for i := 0; i < 40; i++ {
+			large[fmt.Sprint("p", i)] = []interface{}{1, 2, 3, 4, 5, 6, 7, 8}
+		}
+		grid = searchGrid(large, 20, 1)
+		So(grid, ShouldHaveLength, 20)
+		seen = make(map[string]bool)
+		for _, p := range grid {
+			seen[fmt.Sprint(p)] = true
+		}
+		So(seen, ShouldHaveLength, 20)
+		So(searchGrid(large, 20, 1), ShouldResemble, grid)
+	})
+}
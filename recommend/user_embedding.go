@@ -0,0 +1,125 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/auxten/go-ctr/feature/embedding"
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	log "github.com/sirupsen/logrus"
+)
+
+const userWordPrefix = "user:"
+
+// UserItemSeq is the items a user interacted with ordered by time
+type UserItemSeq struct {
+	UserId  int
+	ItemSeq []string
+}
+
+// UserEmbedding is implemented by the recSys providing the item sequences of
+// the users. If implemented, Train learns the user2vec embedding: the users
+// are the words in the context of every item they interacted with, so the
+// users of the similar items are embedded nearby.
+// During training, the item sequences should be limited to avoid time travel
+// as UserBehavior.
+type UserEmbedding interface {
+	UserItemSeqGenerator(context.Context) (<-chan UserItemSeq, error)
+}
+
+var (
+	userEmbeddingMap embeddingMap
+
+	// AppendUserEmbedding appends the user embedding of ItemEmbDim to the user
+	// feature. The users not in the user2vec embedding get the average of
+	// their behavior item embeddings, or zeros. Must be the same in Train and
+	// predict.
+	AppendUserEmbedding bool
+)
+
+// GetUserEmbedding returns the user2vec embedding of userId trained by the
+// last Train
+func GetUserEmbedding(userId int) (emb []float32, ok bool) {
+	return userEmbeddingMap.Get(userWord(userId))
+}
+
+func userWord(userId int) string {
+	return userWordPrefix + strconv.Itoa(userId)
+}
+
+// trainUserEmbedding trains the user2vec embedding with ItemEmbeddingOptions
+// on the item sequences interleaved with the user, e.g. "i1 u i2 u i3 u"
+func trainUserEmbedding(ctx context.Context, userEbd UserEmbedding) (embMap word2vec.EmbeddingMap32, err error) {
+	seqCh, err := userEbd.UserItemSeqGenerator(ctx)
+	if err != nil {
+		log.Errorf("get user item seq error: %v", err)
+		return
+	}
+	wordCh := make(chan string, 1000)
+	go func() {
+		defer close(wordCh)
+		for seq := range seqCh {
+			user := userWord(seq.UserId)
+			for _, item := range seq.ItemSeq {
+				for _, word := range [2]string{item, user} {
+					select {
+					case wordCh <- word:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	mod, err := embedding.TrainEmbeddingWithOptions(ctx, wordCh, itemEmbeddingOptions(ctx))
+	if err != nil {
+		log.Errorf("train user embedding error: %v", err)
+		return
+	}
+	words, err := mod.GenEmbeddingMap32()
+	if err != nil {
+		log.Errorf("get user embedding map error: %v", err)
+		return
+	}
+	embMap = make(word2vec.EmbeddingMap32)
+	for word, vec := range words {
+		if strings.HasPrefix(word, userWordPrefix) {
+			embMap[word] = vec
+		}
+	}
+	if len(embMap) == 0 {
+		return nil, fmt.Errorf("no user embedding trained")
+	}
+	log.Infof("trained %d user embeddings", len(embMap))
+	return
+}
+
+// userEmbeddingOf returns the user2vec embedding of userId, or the average of
+// the non zero item embeddings in userBehaviors, or zeros
+func userEmbeddingOf(userId int, userBehaviors []float32) (emb []float32) {
+	if emb, ok := GetUserEmbedding(userId); ok {
+		return emb
+	}
+	emb = make([]float32, ItemEmbDim)
+	var n int
+	for i := 0; i+ItemEmbDim <= len(userBehaviors); i += ItemEmbDim {
+		itemEmb := userBehaviors[i : i+ItemEmbDim]
+		for _, v := range itemEmb {
+			if v != 0 {
+				n++
+				for j := range emb {
+					emb[j] += itemEmb[j]
+				}
+				break
+			}
+		}
+	}
+	for j := range emb {
+		if n != 0 {
+			emb[j] /= float32(n)
+		}
+	}
+	return
+}
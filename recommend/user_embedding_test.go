@@ -0,0 +1,105 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/auxten/go-ctr/feature/embedding"
+	"github.com/auxten/go-ctr/feature/embedding/model/word2vec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// clusterUsers are the even users interacting with items 0-9 and the odd
+// users with items 10-19
+type clusterUsers struct {
+	users int
+}
+
+func (c clusterUsers) UserItemSeqGenerator(context.Context) (<-chan UserItemSeq, error) {
+	var (
+		rnd = rand.New(rand.NewSource(1))
+		ch  = make(chan UserItemSeq, c.users)
+	)
+	for u := 0; u < c.users; u++ {
+		seq := UserItemSeq{UserId: u}
+		for i := 0; i < 30; i++ {
+			seq.ItemSeq = append(seq.ItemSeq, strconv.Itoa(u%2*10+rnd.Intn(10)))
+		}
+		ch <- seq
+	}
+	close(ch)
+	return ch, nil
+}
+
+func cosine32(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i] * b[i])
+		na += float64(a[i] * a[i])
+		nb += float64(b[i] * b[i])
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func TestUserEmbedding(t *testing.T) {
+	defer func(m word2vec.EmbeddingMap32, opts embedding.Options) {
+		userEmbeddingMap.store(m)
+		ItemEmbeddingOptions = opts
+	}(userEmbeddingMap.load(), ItemEmbeddingOptions)
+
+	Convey("user2vec", t, func() {
+		ItemEmbeddingOptions.Iter = 5
+		embMap, err := trainUserEmbedding(context.Background(), clusterUsers{users: 40})
+		So(err, ShouldBeNil)
+		So(embMap, ShouldHaveLength, 40)
+		So(embMap, ShouldNotContainKey, "0")
+		userEmbeddingMap.store(embMap)
+
+		var same, other float64
+		for u := 2; u < 40; u++ {
+			emb, ok := GetUserEmbedding(u)
+			So(ok, ShouldBeTrue)
+			So(emb, ShouldHaveLength, ItemEmbDim)
+			u0, _ := GetUserEmbedding(0)
+			if u%2 == 0 {
+				same += cosine32(u0, emb)
+			} else {
+				other += cosine32(u0, emb)
+			}
+		}
+		So(same, ShouldBeGreaterThan, other)
+		_, ok := GetUserEmbedding(40)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("averaged behavior embedding", t, func() {
+		userEmbeddingMap.store(word2vec.EmbeddingMap32{userWord(1): {1}})
+		So(userEmbeddingOf(1, nil), ShouldResemble, []float32{1})
+
+		behaviors := make([]float32, ItemEmbDim*UserBehaviorLen)
+		behaviors[0], behaviors[ItemEmbDim] = 1, 3
+		emb := userEmbeddingOf(2, behaviors)
+		So(emb, ShouldHaveLength, ItemEmbDim)
+		So(emb[0], ShouldEqual, 2)
+		So(emb[1], ShouldEqual, 0)
+		So(userEmbeddingOf(2, nil), ShouldResemble, make([]float32, ItemEmbDim))
+	})
+
+	Convey("append user embedding to the user feature", t, func() {
+		defer func(b bool) { AppendUserEmbedding = b }(AppendUserEmbedding)
+		resetFeatureCache()
+		AppendUserEmbedding = true
+		emb := make([]float32, ItemEmbDim)
+		emb[0] = 0.5
+		userEmbeddingMap.store(word2vec.EmbeddingMap32{userWord(1): emb})
+		vec, uWidth, iWidth, err := GetSampleVector(context.Background(), UserFeatureCache, ItemFeatureCache, idPredictor{}, &Sample{UserId: 1, ItemId: 2})
+		So(err, ShouldBeNil)
+		So(uWidth, ShouldEqual, 1+ItemEmbDim)
+		So(iWidth, ShouldEqual, 1)
+		So(vec[:2], ShouldResemble, []float32{1, 0.5})
+		So(vec[len(vec)-1], ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,54 @@
+package recommend
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ItemValuer provides the value of an item, e.g. the margin or the price
+type ItemValuer interface {
+	GetItemValue(ctx context.Context, itemId int) (float32, error)
+}
+
+// UtilityRanker is a PostRanker ranking by the expected utility score × value
+// blended with the pure relevance:
+//
+//	score' = (1-Beta)*score + Beta*score*value/maxUtility
+//
+// where maxUtility is the highest score × value among the candidates, so
+// Beta = 0 is pure relevance and Beta = 1 is pure expected utility. Items
+// failed to get the value are treated as value 0.
+type UtilityRanker struct {
+	Valuer ItemValuer
+	Beta   float32
+}
+
+func NewUtilityRanker(valuer ItemValuer, beta float32) *UtilityRanker {
+	return &UtilityRanker{Valuer: valuer, Beta: beta}
+}
+
+func (u *UtilityRanker) PostRank(ctx context.Context, _ int, itemScores []ItemScore) ([]ItemScore, error) {
+	var (
+		utilities  = make([]float32, len(itemScores))
+		maxUtility float32
+	)
+	for i, is := range itemScores {
+		value, err := u.Valuer.GetItemValue(ctx, is.ItemId)
+		if err != nil {
+			log.Warnf("get item %d value error: %v", is.ItemId, err)
+			continue
+		}
+		utilities[i] = is.Score * value
+		if utilities[i] > maxUtility {
+			maxUtility = utilities[i]
+		}
+	}
+	if maxUtility <= 0 {
+		return itemScores, nil
+	}
+	for i := range itemScores {
+		itemScores[i].Score = (1-u.Beta)*itemScores[i].Score + u.Beta*utilities[i]/maxUtility
+	}
+	return itemScores, nil
+}
@@ -0,0 +1,44 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type priceValuer map[int]float32
+
+func (p priceValuer) GetItemValue(_ context.Context, itemId int) (float32, error) {
+	if v, ok := p[itemId]; ok {
+		return v, nil
+	}
+	return 0, errors.New("no price")
+}
+
+func TestUtilityRanker(t *testing.T) {
+	Convey("price aware utility", t, func() {
+		prices := priceValuer{1: 10, 2: 100}
+		input := func() []ItemScore {
+			return []ItemScore{{ItemId: 1, Score: 0.8}, {ItemId: 2, Score: 0.2}, {ItemId: 3, Score: 0.5}}
+		}
+
+		scores, err := NewUtilityRanker(prices, 0).PostRank(context.Background(), 1, input())
+		So(err, ShouldBeNil)
+		So(scores, ShouldResemble, input())
+
+		// utilities 8, 20, 0
+		scores, err = NewUtilityRanker(prices, 1).PostRank(context.Background(), 1, input())
+		So(err, ShouldBeNil)
+		So(scores[0].Score, ShouldAlmostEqual, 0.4, 1e-6)
+		So(scores[1].Score, ShouldAlmostEqual, 1, 1e-6)
+		So(scores[2].Score, ShouldEqual, 0)
+
+		scores, err = NewUtilityRanker(prices, 0.5).PostRank(context.Background(), 1, input())
+		So(err, ShouldBeNil)
+		So(scores[0].Score, ShouldAlmostEqual, 0.6, 1e-6)
+		So(scores[1].Score, ShouldAlmostEqual, 0.6, 1e-6)
+		So(scores[2].Score, ShouldAlmostEqual, 0.25, 1e-6)
+	})
+}
@@ -0,0 +1,248 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/auxten/go-ctr/feature/embedding"
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ValidateSamples is the samples assembled by ValidatePipeline
+	ValidateSamples = 200
+	// ValidateWords is the words of the item sequence ValidatePipeline trains
+	// the item embedding with
+	ValidateWords = 10000
+)
+
+// ValidationReport of ValidatePipeline, Issues are the data or integration
+// problems found
+type ValidationReport struct {
+	Samples          int        `json:"samples"`
+	Dropped          DropStats  `json:"dropped"`
+	Positives        int        `json:"positives"`
+	UserFeatureWidth int        `json:"userFeatureWidth"`
+	ItemFeatureWidth int        `json:"itemFeatureWidth"`
+	XCols            int        `json:"xCols"`
+	Info             SampleInfo `json:"info"`
+
+	EmbeddingWords   int     `json:"embeddingWords"`
+	EmbeddingSeconds float64 `json:"embeddingSeconds"`
+	// EmbeddingCoverage is the ratio of the sampled items with embedding
+	EmbeddingCoverage float64 `json:"embeddingCoverage"`
+
+	AssembleSecondsPerSample float64 `json:"assembleSecondsPerSample"`
+	FitSeconds               float64 `json:"fitSeconds"`
+
+	Capabilities *CapabilityReport `json:"capabilities"`
+	Issues       []string          `json:"issues"`
+}
+
+func (r *ValidationReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// ProjectAssembly projects the time to assemble samples by one assembler,
+// Train runs SampleAssembler of them concurrently
+func (r *ValidationReport) ProjectAssembly(samples int) time.Duration {
+	return time.Duration(r.AssembleSecondsPerSample * float64(samples) * float64(time.Second))
+}
+
+func (r *ValidationReport) issuef(format string, args ...interface{}) {
+	r.Issues = append(r.Issues, fmt.Sprintf(format, args...))
+}
+
+// ValidatePipeline runs a bounded dry run of Train: the item embedding of
+// ValidateWords words, the assembly of ValidateSamples samples and a Fit of
+// them if mlp is not nil. The caches and the embedding of Train are not
+// touched. err is returned only if the pipeline could not run, the problems
+// of the data are reported in the Issues.
+func ValidatePipeline(ctx context.Context, recSys RecSys, mlp Fitter) (report *ValidationReport, err error) {
+	ctx = WithStage(ctx, TrainStage)
+	report = &ValidationReport{Capabilities: Capabilities(recSys)}
+
+	if preTrain, ok := recSys.(PreTrainer); ok {
+		if err = preTrain.PreTrain(ctx); err != nil {
+			log.Errorf("pre train error: %v", err)
+			return
+		}
+	}
+
+	if itemEbd, ok := itemEmbeddingOfRecSys(recSys); ok && len(itemEmbeddingMap.load()) == 0 {
+		if err = validateEmbedding(ctx, itemEbd, report); err != nil {
+			return
+		}
+		// only for the assembly below, GetSampleVector reads the global
+		defer itemEmbeddingMap.store(nil)
+	}
+
+	sampleCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sampleCh, err := recSys.SampleGenerator(sampleCtx)
+	if err != nil {
+		log.Errorf("sample generator error: %v", err)
+		return
+	}
+	var (
+		userCache = ccache.New(ccache.Configure())
+		itemCache = ccache.New(ccache.Configure())
+		drops     dropCounter
+		sample    = &TrainSample{}
+		start     = time.Now()
+		noTs      = true
+		embedded  = 0
+	)
+	for s := range sampleCh {
+		if report.Samples+report.Dropped.Total() >= ValidateSamples {
+			break
+		}
+		if s.Timestamp != 0 {
+			noTs = false
+		}
+		vec, uWidth, iWidth, er := GetSampleVector(ctx, userCache, itemCache, recSys, &s)
+		if er != nil {
+			drops.add(er)
+			report.Dropped = drops.stats()
+			if report.Dropped.Total() == 1 {
+				report.issuef("sample dropped: %v", er)
+			}
+			continue
+		}
+		if report.Samples == 0 {
+			report.UserFeatureWidth, report.ItemFeatureWidth, report.XCols = uWidth, iWidth, len(vec)
+			report.Info = newSampleInfo(uWidth, iWidth)
+			sample.XCols, sample.Info = len(vec), report.Info
+		} else if uWidth != report.UserFeatureWidth || iWidth != report.ItemFeatureWidth {
+			report.issuef("feature width mismatch: user %d:%d item %d:%d of user %d item %d",
+				report.UserFeatureWidth, uWidth, report.ItemFeatureWidth, iWidth, s.UserId, s.ItemId)
+			return
+		}
+		if LabelObjective == ObjectiveRegression {
+			if math.IsNaN(float64(s.Label)) || math.IsInf(float64(s.Label), 0) {
+				report.issuef("label %v of user %d item %d is not finite", s.Label, s.UserId, s.ItemId)
+				return
+			}
+		} else if s.Label != 0 && s.Label != 1 {
+			report.issuef("label %v of user %d item %d is not 0 or 1", s.Label, s.UserId, s.ItemId)
+			return
+		}
+		for i, v := range vec {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				report.issuef("column %d of user %d item %d is %v", i, s.UserId, s.ItemId, v)
+				return
+			}
+		}
+		if _, ok := getItemEmbedding(s.ItemId); ok {
+			embedded++
+		}
+		if s.Label == 1 {
+			report.Positives++
+		}
+		report.Samples++
+		sample.X = append(sample.X, vec...)
+		sample.Y = append(sample.Y, s.Label)
+		sample.Rows++
+	}
+	cancel()
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if report.Samples+report.Dropped.Total() != 0 {
+		report.AssembleSecondsPerSample = time.Since(start).Seconds() / float64(report.Samples+report.Dropped.Total())
+	}
+
+	switch {
+	case report.Samples == 0:
+		report.issuef("no sample assembled")
+		return
+	case report.Positives == 0 || report.Positives == report.Samples:
+		report.issuef("only one class in %d samples", report.Samples)
+	}
+	if total := report.Samples + report.Dropped.Total(); report.Dropped.Total()*2 > total {
+		report.issuef("%d of %d samples dropped: %+v", report.Dropped.Total(), total, report.Dropped)
+	}
+	if hasItemEmbedding() {
+		report.EmbeddingCoverage = float64(embedded) / float64(report.Samples)
+		if report.EmbeddingCoverage < 0.5 {
+			report.issuef("%.0f%% of the sampled items have no embedding", 100*(1-report.EmbeddingCoverage))
+		}
+	}
+	_, multi := recSys.(MultiBehavior)
+	if noTs && (hasBehavior(recSys) || multi && len(BehaviorChannels) != 0) {
+		report.issuef("sample timestamps are 0, user behavior is not limited to avoid time travel")
+	}
+
+	if mlp != nil {
+		fitStart := time.Now()
+		if _, er := mlp.Fit(sample); er != nil {
+			report.issuef("fit error: %v", er)
+		}
+		report.FitSeconds = time.Since(fitStart).Seconds()
+	}
+	return
+}
+
+// validateEmbedding trains the item embedding of the first ValidateWords
+// words of itemEbd into itemEmbeddingMap
+func validateEmbedding(ctx context.Context, itemEbd ItemEmbedding, report *ValidationReport) (err error) {
+	start := time.Now()
+	seqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	itemSeq, err := itemEbd.ItemSeqGenerator(seqCtx)
+	if err != nil {
+		log.Errorf("get item seq error: %v", err)
+		return
+	}
+	var (
+		words  = make(chan string, ValidateWords)
+		unique = make(map[string]bool)
+	)
+	for word := range itemSeq {
+		if len(words) == ValidateWords {
+			break
+		}
+		if _, er := strconv.Atoi(word); er != nil && len(unique) == 0 {
+			report.issuef("item seq word %q is not an item id, one item id per string expected", word)
+		}
+		unique[word] = true
+		words <- word
+	}
+	close(words)
+	cancel()
+	report.EmbeddingWords = len(unique)
+	if len(unique) < 2 {
+		report.issuef("%d words in the item seq", len(unique))
+		return
+	}
+
+	opts := itemEmbeddingOptions(ctx)
+	opts.MinCount = 1
+	mod, err := embedding.TrainEmbeddingWithOptions(ctx, words, opts)
+	if err != nil {
+		log.Errorf("train item embedding error: %v", err)
+		return
+	}
+	embMap, err := mod.GenEmbeddingMap32()
+	if err != nil {
+		log.Errorf("get item embedding map error: %v", err)
+		return
+	}
+	itemEmbeddingMap.store(embMap)
+	report.EmbeddingSeconds = time.Since(start).Seconds()
+	return
+}
+
+// hasBehavior returns true if the user behavior of featureProvider is
+// encoded by GetSampleVector
+func hasBehavior(featureProvider interface{}) bool {
+	switch featureProvider.(type) {
+	case UserBehavior, SessionBehavior, TimedUserBehavior:
+		return true
+	}
+	return false
+}
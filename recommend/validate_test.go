@@ -0,0 +1,74 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// badLabelRecSys is lossyRecSys labeling the samples with the item id
+type badLabelRecSys struct {
+	lossyRecSys
+}
+
+func (badLabelRecSys) SampleGenerator(ctx context.Context) (<-chan Sample, error) {
+	ch := make(chan Sample)
+	go func() {
+		defer close(ch)
+		for i := 0; ; i++ {
+			select {
+			case ch <- Sample{UserId: 1, ItemId: i % 100, Label: float32(i % 100)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// behaviorRecSys is idRecSys with the item sequence and user behavior
+type behaviorRecSys struct {
+	idRecSys
+	countingItemSeq
+}
+
+func (behaviorRecSys) GetUserBehavior(context.Context, int, int64, int64, int64) ([]int, error) {
+	return []int{1, 2, 3}, nil
+}
+
+func TestValidatePipeline(t *testing.T) {
+	Convey("validate a good pipeline", t, func() {
+		fitter := &idFitter{}
+		report, err := ValidatePipeline(context.Background(), idRecSys{}, fitter)
+		So(err, ShouldBeNil)
+		So(report.Issues, ShouldBeEmpty)
+		So(report.OK(), ShouldBeTrue)
+		So(report.Samples, ShouldEqual, ValidateSamples)
+		So(fitter.rows, ShouldEqual, ValidateSamples)
+		So(report.UserFeatureWidth, ShouldEqual, 1)
+		So(report.ItemFeatureWidth, ShouldEqual, 1)
+		So(report.XCols, ShouldEqual, report.Info.CtxFeatureRange[1])
+		So(report.Positives, ShouldEqual, 100)
+		So(report.ProjectAssembly(1000), ShouldBeGreaterThan, 0)
+	})
+
+	Convey("validate the item embedding and behavior", t, func() {
+		report, err := ValidatePipeline(context.Background(), &behaviorRecSys{}, nil)
+		So(err, ShouldBeNil)
+		So(report.EmbeddingWords, ShouldEqual, 20)
+		// items 0-19 of 100 embedded, no timestamp
+		So(report.EmbeddingCoverage, ShouldEqual, 0.2)
+		So(report.Issues, ShouldHaveLength, 2)
+		So(report.Issues[1], ShouldContainSubstring, "time travel")
+		So(itemEmbeddingMap.load(), ShouldBeNil)
+	})
+
+	Convey("validate a bad pipeline", t, func() {
+		report, err := ValidatePipeline(context.Background(), badLabelRecSys{}, nil)
+		So(err, ShouldBeNil)
+		So(report.OK(), ShouldBeFalse)
+		So(report.Issues, ShouldHaveLength, 1)
+		So(report.Issues[0], ShouldContainSubstring, "label 2 of user 1 item 2")
+	})
+}
@@ -0,0 +1,115 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// WarmUpConcurrency is the concurrent fetches of WarmUp
+var WarmUpConcurrency = SampleAssembler
+
+// WarmUp fetches the features of userIds and itemIds missing in
+// UserFeatureCache and ItemFeatureCache concurrently, so the first requests
+// after a deploy are not slowed down by the cold fetches. The ones failed,
+// e.g. not found, are skipped and counted in the error.
+func WarmUp(ctx context.Context, featureProvider BasicFeatureProvider, userIds []int, itemIds []int) (err error) {
+	start := time.Now()
+	initFeatureCaches()
+	ctx = WithStage(ctx, PredictStage)
+	ctx = withBulkFeatures(ctx, warmUpBulk(ctx, featureProvider, userIds, itemIds))
+
+	type warmUpKey struct {
+		name string
+		id   int
+	}
+	var (
+		keys     = make(chan warmUpKey)
+		wg       sync.WaitGroup
+		failed   int64
+		errOnce  sync.Once
+		firstErr error
+	)
+	workers := WarmUpConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for c := 0; c < workers; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				var err error
+				if key.name == cacheUser {
+					_, err = fetchUserFeature(ctx, UserFeatureCache, featureProvider, &Sample{UserId: key.id})
+				} else {
+					_, err = fetchItemFeature(ctx, ItemFeatureCache, featureProvider, &Sample{ItemId: key.id})
+				}
+				if err != nil {
+					atomic.AddInt64(&failed, 1)
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+
+	send := func(name string, ids []int) bool {
+		for _, id := range ids {
+			select {
+			case keys <- warmUpKey{name, id}:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+	_ = send(cacheUser, userIds) && send(cacheItem, itemIds)
+	close(keys)
+	wg.Wait()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	log.Infof("warmed up %d users and %d items in %v, %d failed",
+		len(userIds), len(itemIds), time.Since(start), failed)
+	if failed != 0 {
+		err = fmt.Errorf("warm up: %d of %d fetches failed, first: %w", failed, len(userIds)+len(itemIds), firstErr)
+	}
+	return
+}
+
+// warmUpBulk fetches the features of userIds and itemIds missing in the
+// caches in bulk if featureProvider is a BatchUserFeaturer or
+// BatchItemFeaturer
+func warmUpBulk(ctx context.Context, featureProvider interface{}, userIds []int, itemIds []int) (bulk *bulkFeatures) {
+	batchUser, userOk := featureProvider.(BatchUserFeaturer)
+	batchItem, itemOk := featureProvider.(BatchItemFeaturer)
+	if !userOk && !itemOk {
+		return
+	}
+	missing := func(cache *ccache.Cache, ids []int) (ret []int) {
+		for _, id := range ids {
+			if !cached(cache, id) {
+				ret = append(ret, id)
+			}
+		}
+		return
+	}
+	bulk = &bulkFeatures{}
+	if userOk {
+		if ids := missing(UserFeatureCache, userIds); len(ids) != 0 {
+			bulk.users = fetchBulkOf(ctx, cacheUser, ids, batchUser.GetUserFeatures)
+		}
+	}
+	if itemOk {
+		if ids := missing(ItemFeatureCache, itemIds); len(ids) != 0 {
+			bulk.items = fetchBulkOf(ctx, cacheItem, ids, batchItem.GetItemFeatures)
+		}
+	}
+	return
+}
@@ -0,0 +1,45 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWarmUp(t *testing.T) {
+	Convey("warm up", t, func() {
+		resetFeatureCache()
+
+		Convey("fills the caches", func() {
+			So(WarmUp(context.Background(), idPredictor{}, []int{1, 2}, []int{3, 4, 5}), ShouldBeNil)
+			So(UserFeatureCache.Get("2") != nil, ShouldBeTrue)
+			for _, itemId := range []int{3, 4, 5} {
+				So(ItemFeatureCache.Get(strconv.Itoa(itemId)).Value(), ShouldResemble, Tensor{float32(itemId)})
+			}
+		})
+
+		Convey("bulk and missing", func() {
+			recSys := &bulkRecSys{}
+			err := WarmUp(context.Background(), recSys, []int{1}, []int{3, 300, 301})
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, ErrMissingItem), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "2 of 4 fetches failed")
+			So(recSys.single, ShouldEqual, 0)
+			So(recSys.itemBulks, ShouldEqual, 1)
+			So(ItemFeatureCache.Get("3") != nil, ShouldBeTrue)
+
+			// warm already
+			So(WarmUp(context.Background(), recSys, []int{1}, []int{3}), ShouldBeNil)
+			So(recSys.userBulks, ShouldEqual, 1)
+		})
+
+		Convey("canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(WarmUp(ctx, idPredictor{}, []int{1}, []int{2}), ShouldEqual, context.Canceled)
+		})
+	})
+}
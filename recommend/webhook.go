@@ -0,0 +1,132 @@
+package recommend
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	EventTrainStarted    = "train.started"
+	EventTrainFinished   = "train.finished"
+	EventModelPromoted   = "model.promoted"
+	EventDriftAlert      = "drift.alert"
+	EventServingDegraded = "serving.degraded"
+
+	// WebhookSignatureHeader is "sha256=" + hex(hmac_sha256(Secret, body))
+	WebhookSignatureHeader = "X-Ctr-Signature"
+	WebhookEventHeader     = "X-Ctr-Event"
+)
+
+var (
+	// Webhooks are notified on the lifecycle events, nil means disabled
+	Webhooks []Webhook
+	// WebhookClient is the http client to post the events
+	WebhookClient = &http.Client{Timeout: 5 * time.Second}
+	// DegradedNotifyInterval is the min interval between two
+	// EventServingDegraded notifications to avoid flooding
+	DegradedNotifyInterval = time.Minute
+
+	lastDegradedNotify int64
+)
+
+type Webhook struct {
+	URL string
+	// Secret signs the payload with HMAC-SHA256 if not empty
+	Secret string
+	// Events subscribed, empty means all
+	Events []string
+}
+
+type WebhookEvent struct {
+	Type      string                 `json:"type"`
+	Timestamp int64                  `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+func (w *Webhook) subscribed(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify posts the event to all the subscribed Webhooks asynchronously,
+// errors are only logged.
+func Notify(eventType string, data map[string]interface{}) {
+	if len(Webhooks) == 0 {
+		return
+	}
+	if eventType == EventServingDegraded {
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&lastDegradedNotify)
+		if now-last < int64(DegradedNotifyInterval) ||
+			!atomic.CompareAndSwapInt64(&lastDegradedNotify, last, now) {
+			return
+		}
+	}
+	body, err := json.Marshal(WebhookEvent{
+		Type:      eventType,
+		Timestamp: time.Now().Unix(),
+		Data:      data,
+	})
+	if err != nil {
+		log.Errorf("marshal webhook event %s error: %v", eventType, err)
+		return
+	}
+	for i := range Webhooks {
+		hook := Webhooks[i]
+		if !hook.subscribed(eventType) {
+			continue
+		}
+		go func() {
+			if err := PostWebhook(context.Background(), &hook, eventType, body); err != nil {
+				log.Errorf("post webhook %s to %s error: %v", eventType, hook.URL, err)
+			}
+		}()
+	}
+}
+
+// PostWebhook posts body to hook synchronously
+func PostWebhook(ctx context.Context, hook *Webhook, eventType string, body []byte) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, eventType)
+	if hook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(hook.Secret, body))
+	}
+	resp, err := WebhookClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of body, receivers could use it to
+// verify the WebhookSignatureHeader.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,51 @@
+package recommend
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebhook(t *testing.T) {
+	Convey("notify signed webhook", t, func() {
+		type received struct {
+			event     WebhookEvent
+			signature string
+			valid     bool
+		}
+		recvCh := make(chan received, 10)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			var recv received
+			_ = json.Unmarshal(body, &recv.event)
+			recv.signature = r.Header.Get(WebhookSignatureHeader)
+			recv.valid = recv.signature == "sha256="+SignWebhook("secret", body)
+			recvCh <- recv
+		}))
+		defer srv.Close()
+
+		Webhooks = []Webhook{{URL: srv.URL, Secret: "secret", Events: []string{EventModelPromoted}}}
+		defer func() { Webhooks = nil }()
+
+		Notify(EventTrainStarted, nil)
+		r := NewModelRegistry()
+		So(r.Register(idPredictor{}, ModelMeta{Version: "v1"}), ShouldBeNil)
+		So(r.Activate("v1"), ShouldBeNil)
+
+		select {
+		case recv := <-recvCh:
+			So(recv.valid, ShouldBeTrue)
+			So(recv.event.Type, ShouldEqual, EventModelPromoted)
+			So(recv.event.Data["version"], ShouldEqual, "v1")
+		case <-time.After(5 * time.Second):
+			So("webhook timeout", ShouldBeEmpty)
+		}
+		// not subscribed event is not posted
+		So(recvCh, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package utils
+
+import (
+	"os"
+)
+
+// MmapFile falls back to reading the whole file where mmap is not supported
+func MmapFile(path string) (data []byte, unmmap func() error, err error) {
+	data, err = os.ReadFile(path)
+	return data, func() error { return nil }, err
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// MmapFile maps the file at path into memory read only, unmmap must be
+// called after the data is no longer used
+func MmapFile(path string) (data []byte, unmmap func() error, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if fi.Size() == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"unsafe"
 
 	"github.com/auxten/go-ctr/nn/metrics"
 	"gonum.org/v1/gonum/mat"
@@ -146,3 +147,36 @@ func RocAuc32(pred, y []float32) float32 {
 
 	return float32(metrics.ROCAUCScore(yTrue, yScore, "", nil))
 }
+
+// Cosine32 returns the cosine similarity of a and b, 0 if any of them is zero
+func Cosine32(a, b []float32) float32 {
+	var dot, na, nb float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(na*nb))
+}
+
+// Float32sFromBytes returns the little-endian float32 slice in b, b is used
+// in place without copy if possible so it should not be modified after.
+func Float32sFromBytes(b []byte) []float32 {
+	n := len(b) / 4
+	if n == 0 {
+		return nil
+	}
+	var x uint16 = 1
+	littleEndian := *(*byte)(unsafe.Pointer(&x)) == 1
+	if littleEndian && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		return unsafe.Slice((*float32)(unsafe.Pointer(&b[0])), n)
+	}
+	f := make([]float32, n)
+	for i := range f {
+		f[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return f
+}
@@ -51,3 +51,12 @@ func TestInt64SeqToIntSeq(t *testing.T) {
 		So(seq, ShouldResemble, []int{1, 2, 3, 4, 5})
 	})
 }
+
+func TestCosine32(t *testing.T) {
+	Convey("test cosine32", t, func() {
+		So(Cosine32([]float32{1, 0}, []float32{2, 0}), ShouldAlmostEqual, 1, 1e-6)
+		So(Cosine32([]float32{1, 0}, []float32{0, 3}), ShouldAlmostEqual, 0, 1e-6)
+		So(Cosine32([]float32{1, 1}, []float32{-1, -1}), ShouldAlmostEqual, -1, 1e-6)
+		So(Cosine32([]float32{0, 0}, []float32{1, 1}), ShouldEqual, 0)
+	})
+}